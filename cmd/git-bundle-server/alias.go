@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'alias --json'.
+type aliasResult struct {
+	Route   string   `json:"route"`
+	Aliases []string `json:"aliases"`
+}
+
+type aliasCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewAliasCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &aliasCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (aliasCmd) Name() string {
+	return "alias"
+}
+
+func (aliasCmd) Description() string {
+	return `
+Display the aliases of the repository at '<route>' or, if '<alias>' is
+specified, add it as an alias. The web server serves the repository's bundles
+from each of its aliases as well as from '<route>'.`
+}
+
+func (a *aliasCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(a.logger, "git-bundle-server alias [--remove] <route> [<alias>]")
+	remove := parser.Bool("remove", false, "remove the alias instead of adding it")
+	route := parser.PositionalString("route", "the route of the repository", true)
+	alias := parser.PositionalString("alias", "the alias to add or remove", false)
+	parser.Parse(ctx, args)
+
+	if *remove && *alias == "" {
+		parser.Usage(ctx, "'--remove' requires '<alias>'.")
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, a.container)
+	output := utils.GetDependency[utils.Output](ctx, a.container)
+
+	if *alias != "" && !*remove {
+		depth, err := repoProvider.GetRouteDepth(ctx)
+		if err != nil {
+			return a.logger.Error(ctx, err)
+		}
+		if err := core.ValidateRoute(*alias, depth); err != nil {
+			parser.Usage(ctx, "Invalid alias '%s': %s", *alias, err)
+		}
+	}
+
+	if *alias == "" {
+		repos, err := repoProvider.GetRepositories(ctx)
+		if err != nil {
+			return a.logger.Error(ctx, err)
+		}
+
+		repo, contains := repos[*route]
+		if !contains {
+			return a.logger.Error(ctx, &core.RouteNotFoundError{Route: *route})
+		}
+
+		// Nothing to configure, just print the current aliases
+		aliases := repo.Aliases
+		if aliases == nil {
+			aliases = []string{}
+		}
+		err = output.Result(aliasResult{Route: repo.Route, Aliases: aliases}, func(w io.Writer) {
+			if len(aliases) == 0 {
+				fmt.Fprintf(w, "'%s' has no aliases\n", *route)
+			}
+			for _, alias := range aliases {
+				fmt.Fprintln(w, alias)
+			}
+		})
+		if err != nil {
+			return a.logger.Error(ctx, err)
+		}
+		return nil
+	}
+
+	err := repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+		repo, contains := repos[*route]
+		if !contains {
+			return &core.RouteNotFoundError{Route: *route}
+		}
+
+		if *remove {
+			aliases := []string{}
+			for _, existing := range repo.Aliases {
+				if existing != *alias {
+					aliases = append(aliases, existing)
+				}
+			}
+			if len(aliases) == len(repo.Aliases) {
+				return fmt.Errorf("'%s' is not an alias of '%s'", *alias, *route)
+			}
+			repo.Aliases = aliases
+		} else {
+			if existing, contains := core.FindRepository(repos, *alias); contains {
+				if existing.Route == *alias {
+					return fmt.Errorf("'%s' is a registered route", *alias)
+				}
+				return fmt.Errorf("'%s' is already an alias of '%s'", *alias, existing.Route)
+			}
+			repo.Aliases = append(repo.Aliases, *alias)
+		}
+
+		repos[*route] = repo
+		return nil
+	})
+	if err != nil {
+		return a.logger.Errorf(ctx, "failed to update aliases: %w", err)
+	}
+
+	if *remove {
+		output.Printf("Removed alias '%s' of '%s'\n", *alias, *route)
+	} else {
+		output.Printf("Added alias '%s' of '%s'\n", *alias, *route)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'base-url --json <route>'.
+type baseURLResult struct {
+	Route         string `json:"route"`
+	BaseURL       string `json:"baseURL"`
+	ServerBaseURL string `json:"serverBaseURL"`
+}
+
+// The information printed by 'base-url --json' without a route.
+type serverBaseURLResult struct {
+	ServerBaseURL string `json:"serverBaseURL"`
+}
+
+type baseURLCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewBaseURLCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &baseURLCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (baseURLCmd) Name() string {
+	return "base-url"
+}
+
+func (baseURLCmd) Description() string {
+	return `
+Display or configure the base URL used to generate absolute bundle URIs in the
+bundle list of '<route>' or, if no route is specified, the server-wide base URL
+used by every route without one of its own. The affected bundle lists are
+regenerated when the base URL changes.`
+}
+
+func describeBaseURL(repo *core.Repository) string {
+	if repo.BaseURL != "" {
+		return repo.BaseURL
+	} else if repo.ServerBaseURL != "" {
+		return fmt.Sprintf("%s (server default)", repo.ServerBaseURL)
+	} else {
+		return "none (bundle URIs are relative)"
+	}
+}
+
+// regenerateBundleList rewrites the repository's bundle list so that it
+// reflects the repository's current settings.
+func (b *baseURLCmd) regenerateBundleList(ctx context.Context, repo *core.Repository) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, b.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, b.container)
+
+	// Don't rewrite the list out from under an in-progress update.
+	lock, _, err := repoProvider.LockForUpdate(ctx, repo, true)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	list, err := bundleProvider.GetBundleList(ctx, repo)
+	if err != nil {
+		return fmt.Errorf("failed to load bundle list: %w", err)
+	}
+
+	err = bundleProvider.WriteBundleList(ctx, list, repo)
+	if err != nil {
+		return fmt.Errorf("failed to write bundle list: %w", err)
+	}
+
+	return nil
+}
+
+func (b *baseURLCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(b.logger, "git-bundle-server base-url [--set <url>|--unset] [<route>]")
+	set := parser.String("set", "", "the base URL (e.g. 'https://bundles.example.com') of bundle URIs")
+	unset := parser.Bool("unset", false, "remove the base URL")
+	route := parser.PositionalString("route", "the route to configure", false)
+	parser.Parse(ctx, args)
+
+	if *set != "" && *unset {
+		parser.Usage(ctx, "'--set' and '--unset' cannot be used together.")
+	}
+	if *set != "" {
+		if err := core.ValidateBaseURL(*set); err != nil {
+			parser.Usage(ctx, "Invalid base URL '%s': %s", *set, err)
+		}
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, b.container)
+	output := utils.GetDependency[utils.Output](ctx, b.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return b.logger.Error(ctx, err)
+	}
+
+	repo, contains := repos[*route]
+	if *route != "" && !contains {
+		return b.logger.Error(ctx, &core.RouteNotFoundError{Route: *route})
+	}
+
+	if *set == "" && !*unset {
+		// Nothing to configure, just print the current base URL
+		if *route != "" {
+			result := baseURLResult{
+				Route:         repo.Route,
+				BaseURL:       repo.BaseURL,
+				ServerBaseURL: repo.ServerBaseURL,
+			}
+			err = output.Result(result, func(w io.Writer) {
+				fmt.Fprintf(w, "%s: %s\n", repo.Route, describeBaseURL(&repo))
+			})
+		} else {
+			var serverBaseURL string
+			serverBaseURL, err = repoProvider.GetServerBaseURL(ctx)
+			if err != nil {
+				return b.logger.Error(ctx, err)
+			}
+			err = output.Result(serverBaseURLResult{ServerBaseURL: serverBaseURL}, func(w io.Writer) {
+				if serverBaseURL == "" {
+					fmt.Fprintln(w, "No server-wide base URL is configured")
+				} else {
+					fmt.Fprintln(w, serverBaseURL)
+				}
+			})
+		}
+		if err != nil {
+			return b.logger.Error(ctx, err)
+		}
+		return nil
+	}
+
+	if *route != "" {
+		err = repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+			repo, contains = repos[*route]
+			if !contains {
+				return &core.RouteNotFoundError{Route: *route}
+			}
+
+			repo.BaseURL = *set
+			repos[*route] = repo
+			return nil
+		})
+	} else {
+		err = repoProvider.SetServerBaseURL(ctx, *set)
+	}
+	if err != nil {
+		return b.logger.Errorf(ctx, "failed to write routes: %w", err)
+	}
+
+	// Regenerate the bundle lists of the routes using the new base URL
+	repos, err = repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return b.logger.Error(ctx, err)
+	}
+
+	affectedRoutes := []string{}
+	for name, repo := range repos {
+		if name == *route || (*route == "" && repo.BaseURL == "") {
+			affectedRoutes = append(affectedRoutes, name)
+		}
+	}
+	sort.Strings(affectedRoutes)
+
+	for _, name := range affectedRoutes {
+		repo := repos[name]
+		err = b.regenerateBundleList(ctx, &repo)
+		if err != nil {
+			return b.logger.Errorf(ctx, "failed to regenerate bundle list for '%s': %w", name, err)
+		}
+		output.Printf("%s: %s\n", name, describeBaseURL(&repo))
+	}
+
+	return nil
+}
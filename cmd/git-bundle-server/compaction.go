@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'compaction --json', with the defaults of unset
+// settings filled in.
+type compactionResult struct {
+	Route              string `json:"route"`
+	MaxBundles         int    `json:"maxBundles"`
+	MaxIncrementalSize int64  `json:"maxIncrementalSize"`
+	Strategy           string `json:"strategy"`
+}
+
+type compactionCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewCompactionCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &compactionCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (compactionCmd) Name() string {
+	return "compaction"
+}
+
+func (compactionCmd) Description() string {
+	return `
+Display or configure the policy used to merge the incremental bundles of the
+repository at '<route>' when it is updated. Bundles are merged once the bundle
+list contains more than '--max-bundles' bundles or the incremental bundles'
+total size exceeds '--max-size'.`
+}
+
+func describeCompactionPolicy(policy core.CompactionPolicy) string {
+	settings := []string{}
+
+	if policy.MaxBundles > 0 {
+		settings = append(settings, fmt.Sprintf("at most %d bundles", policy.MaxBundles))
+	} else {
+		settings = append(settings, fmt.Sprintf("at most %d bundles (default)", core.DefaultMaxBundles))
+	}
+
+	if policy.MaxIncrementalSize > 0 {
+		settings = append(settings, fmt.Sprintf("at most %s of incremental bundles", core.FormatByteSize(policy.MaxIncrementalSize)))
+	}
+
+	if policy.Strategy != "" {
+		settings = append(settings, fmt.Sprintf("'%s' strategy", policy.Strategy))
+	} else {
+		settings = append(settings, fmt.Sprintf("'%s' strategy (default)", core.CompactionStrategyBase))
+	}
+
+	return strings.Join(settings, ", ")
+}
+
+func (c *compactionCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(c.logger,
+		"git-bundle-server compaction [--max-bundles <n>] [--max-size <size>] [--strategy <strategy>] [--default] <route>")
+	maxBundles := parser.IntRange("max-bundles", 0, 0, math.MaxInt, "the maximum number of bundles in the bundle list (0 for the default)")
+	maxSize := parser.ByteSize("max-size", 0, "the maximum total size (e.g. '500M') of the incremental bundles (0 for no limit)")
+	strategy := parser.Enum("strategy", "", []string{core.CompactionStrategyBase, core.CompactionStrategyWeekly},
+		fmt.Sprintf("how bundles are merged: '%s' or '%s'", core.CompactionStrategyBase, core.CompactionStrategyWeekly))
+	useDefault := parser.Bool("default", false, "reset the route to the default compaction policy")
+	route := parser.PositionalString("route", "the route to configure", true)
+	parser.Parse(ctx, args)
+
+	configure := parser.IsSet("max-bundles") || parser.IsSet("max-size") || parser.IsSet("strategy")
+	if configure && *useDefault {
+		parser.Usage(ctx, "'--default' cannot be used with other options.")
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, c.container)
+	output := utils.GetDependency[utils.Output](ctx, c.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return c.logger.Error(ctx, err)
+	}
+
+	repo, contains := repos[*route]
+	if !contains {
+		return c.logger.Error(ctx, &core.RouteNotFoundError{Route: *route})
+	}
+
+	if !configure && !*useDefault {
+		// Nothing to configure, just print the current policy
+		result := compactionResult{
+			Route:              repo.Route,
+			MaxBundles:         repo.Compaction.MaxBundles,
+			MaxIncrementalSize: repo.Compaction.MaxIncrementalSize,
+			Strategy:           repo.Compaction.Strategy,
+		}
+		if result.MaxBundles == 0 {
+			result.MaxBundles = core.DefaultMaxBundles
+		}
+		if result.Strategy == "" {
+			result.Strategy = core.CompactionStrategyBase
+		}
+		err = output.Result(result, func(w io.Writer) {
+			fmt.Fprintf(w, "%s: %s\n", repo.Route, describeCompactionPolicy(repo.Compaction))
+		})
+		if err != nil {
+			return c.logger.Error(ctx, err)
+		}
+		return nil
+	}
+
+	err = repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+		repo, contains = repos[*route]
+		if !contains {
+			return &core.RouteNotFoundError{Route: *route}
+		}
+
+		policy := repo.Compaction
+		if *useDefault {
+			policy = core.CompactionPolicy{}
+		}
+		if parser.IsSet("max-bundles") {
+			policy.MaxBundles = *maxBundles
+		}
+		if parser.IsSet("max-size") {
+			policy.MaxIncrementalSize = *maxSize
+		}
+		if parser.IsSet("strategy") {
+			policy.Strategy = *strategy
+		}
+
+		err := policy.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid compaction policy: %w", err)
+		}
+
+		repo.Compaction = policy
+		repos[*route] = repo
+		return nil
+	})
+	if err != nil {
+		return c.logger.Errorf(ctx, "failed to write routes: %w", err)
+	}
+
+	output.Printf("%s: %s\n", repo.Route, describeCompactionPolicy(repo.Compaction))
+	output.Printf("The policy will be applied the next time the route is updated.\n")
+
+	return nil
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
 	"github.com/git-ecosystem/git-bundle-server/internal/core"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
 )
@@ -29,15 +31,98 @@ func (deleteCmd) Name() string {
 func (deleteCmd) Description() string {
 	return `
 Remove the configuration for the given '<route>' and delete its repository
-data.`
+data. With '--keep-data' or '--trash', the data is retained (in place or in the
+trash directory, respectively) so that the route can be restored with
+'restore'. Otherwise, the deletion must be confirmed, either interactively or
+with '--force'.`
+}
+
+// retainRoute unregisters the route but retains its data, moving it to the
+// trash if 'trash' is true.
+func (d *deleteCmd) retainRoute(ctx context.Context, route string, trash bool) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, d.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return err
+	}
+
+	repo, contains := repos[route]
+	if !contains {
+		return &core.RouteNotFoundError{Route: route}
+	}
+
+	// Don't delete the route out from under an in-progress update.
+	lock, _, err := repoProvider.LockForUpdate(ctx, &repo, true)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	deleted, err := repoProvider.DeleteRoute(ctx, route, trash)
+	if err != nil {
+		return err
+	}
+
+	if trash {
+		err = moveRepository(&repo, &deleted.Repository)
+		if err != nil {
+			// Register the route again so that it matches its data.
+			_, undoErr := repoProvider.RestoreRoute(ctx, route)
+			if undoErr != nil {
+				return fmt.Errorf("%w (and failed to restore route '%s': %s)", err, route, undoErr)
+			}
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (d *deleteCmd) Run(ctx context.Context, args []string) error {
-	parser := argparse.NewArgParser(d.logger, "git-bundle-server delete <route>")
+	parser := argparse.NewArgParser(d.logger, "git-bundle-server delete [-f | --force] [--keep-data | --trash] <route>")
+	force := utils.ForceFlag(parser)
+	keepData := parser.Bool("keep-data", false, "unregister the route, but keep its data in place so that it can be restored")
+	trash := parser.Bool("trash", false, "unregister the route and move its data to the trash, from which it can be restored")
 	route := parser.PositionalString("route", "the route to delete", true)
 	parser.Parse(ctx, args)
 
+	if err := checkWritable(ctx, d.logger, d.container); err != nil {
+		return err
+	}
+
+	if *keepData && *trash {
+		parser.Usage(ctx, "'--keep-data' and '--trash' cannot be used together.")
+	}
+
+	if *keepData || *trash {
+		err := d.retainRoute(ctx, *route, *trash)
+		if err != nil {
+			return d.logger.Errorf(ctx, "failed to delete route: %w", err)
+		}
+
+		output := utils.GetDependency[utils.Output](ctx, d.container)
+		output.Printf("Deleted '%s'; restore it with 'git-bundle-server restore %s'\n", *route, *route)
+		return nil
+	}
+
 	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, d.container)
+	prompter := utils.GetDependency[utils.Prompter](ctx, d.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return d.logger.Error(ctx, err)
+	}
+	if _, contains := repos[*route]; !contains {
+		return d.logger.Error(ctx, &core.RouteNotFoundError{Route: *route})
+	}
+
+	// The data can't be recovered, so make sure it's meant to be deleted.
+	err = utils.ConfirmDestructive(ctx, prompter, *force,
+		fmt.Sprintf("Delete route '%s' and all of its data?", *route))
+	if err != nil {
+		return d.logger.Error(ctx, err)
+	}
 
 	repo, err := repoProvider.CreateRepository(ctx, *route)
 	if err != nil {
@@ -49,6 +134,12 @@ func (d *deleteCmd) Run(ctx context.Context, args []string) error {
 		return d.logger.Error(ctx, err)
 	}
 
+	storage := utils.GetDependency[bundles.BundleStorage](ctx, d.container)
+	err = bundles.UnpublishWebDir(ctx, storage, repo)
+	if err != nil {
+		return d.logger.Error(ctx, err)
+	}
+
 	err = os.RemoveAll(repo.WebDir)
 	if err != nil {
 		return d.logger.Error(ctx, err)
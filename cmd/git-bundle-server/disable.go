@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+type disableCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewDisableCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &disableCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (disableCmd) Name() string {
+	return "disable"
+}
+
+func (disableCmd) Description() string {
+	return `
+Pause the repository at '<route>': it is no longer updated by 'update-all' or
+the web server, and the web server responds to requests for it with '503
+Service Unavailable'. Its settings and data are kept; use 'enable' to resume
+it.`
+}
+
+// setRouteDisabled enables or disables the route, returning whether it
+// changed.
+func setRouteDisabled(ctx context.Context, repoProvider core.RepositoryProvider, route string, disabled bool) (bool, error) {
+	changed := false
+	err := repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+		repo, contains := repos[route]
+		if !contains {
+			return &core.RouteNotFoundError{Route: route}
+		}
+
+		changed = repo.Disabled != disabled
+		repo.Disabled = disabled
+		repos[route] = repo
+		return nil
+	})
+	return changed, err
+}
+
+func (d *disableCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(d.logger, "git-bundle-server disable <route>")
+	route := parser.PositionalString("route", "the route to disable", true)
+	parser.Parse(ctx, args)
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, d.container)
+	output := utils.GetDependency[utils.Output](ctx, d.container)
+
+	changed, err := setRouteDisabled(ctx, repoProvider, *route, true)
+	if err != nil {
+		return d.logger.Errorf(ctx, "failed to disable route: %w", err)
+	}
+
+	if changed {
+		output.Printf("Disabled '%s'\n", *route)
+	} else {
+		output.Printf("'%s' is already disabled\n", *route)
+	}
+	return nil
+}
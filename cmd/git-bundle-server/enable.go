@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+type enableCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewEnableCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &enableCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (enableCmd) Name() string {
+	return "enable"
+}
+
+func (enableCmd) Description() string {
+	return `
+Resume the repository at '<route>' after it was paused with 'disable'. Its
+bundles are served again immediately; it is brought up to date at its next
+scheduled update.`
+}
+
+func (e *enableCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(e.logger, "git-bundle-server enable <route>")
+	route := parser.PositionalString("route", "the route to enable", true)
+	parser.Parse(ctx, args)
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, e.container)
+	output := utils.GetDependency[utils.Output](ctx, e.container)
+
+	changed, err := setRouteDisabled(ctx, repoProvider, *route, false)
+	if err != nil {
+		return e.logger.Errorf(ctx, "failed to enable route: %w", err)
+	}
+
+	if changed {
+		output.Printf("Enabled '%s'\n", *route)
+	} else {
+		output.Printf("'%s' is already enabled\n", *route)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'export --json'.
+type exportResult struct {
+	Output   string   `json:"output"`
+	Routes   []string `json:"routes"`
+	Files    []string `json:"files"`
+	Redacted []string `json:"redacted"`
+}
+
+type exportCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewExportCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &exportCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (exportCmd) Name() string {
+	return "export"
+}
+
+func (exportCmd) Description() string {
+	return `
+Write the configuration of the bundle server to a gzipped tarball, from which
+it can be rebuilt on another host with 'git-bundle-server import': its routes,
+their settings (including their update schedules) and remote URLs, the
+server-wide settings, and the bundle storage and signing configuration. Secrets
+(e.g. credentials in remote URLs or the bundle storage configuration) are left
+out and must be configured again after importing. The archive is written to
+stdout unless '--output' is given.`
+}
+
+func (e *exportCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(e.logger, "git-bundle-server export [--output <file>]")
+	outputFile := parser.String("output", "", "the file to which the archive is written (default: stdout)")
+	parser.Parse(ctx, args)
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, e.container)
+	output := utils.GetDependency[utils.Output](ctx, e.container)
+
+	if *outputFile == "" && output.IsJson() {
+		// The JSON result is printed to stdout.
+		parser.Usage(ctx, "'--output' is required with '--json'.")
+	}
+
+	config, err := repoProvider.ExportConfig(ctx)
+	if err != nil {
+		return e.logger.Errorf(ctx, "failed to export configuration: %w", err)
+	}
+
+	if *outputFile == "" {
+		err = config.WriteArchive(os.Stdout)
+	} else {
+		var file *os.File
+		file, err = os.OpenFile(*outputFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return e.logger.Error(ctx, err)
+		}
+		err = config.WriteArchive(file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return e.logger.Errorf(ctx, "failed to write configuration archive: %w", err)
+	}
+
+	result := exportResult{
+		Output:   *outputFile,
+		Routes:   config.Routes(),
+		Files:    []string{},
+		Redacted: config.Redacted,
+	}
+	for name := range config.Files {
+		result.Files = append(result.Files, name)
+	}
+	sort.Strings(result.Files)
+	printSummary := func(w io.Writer) {
+		fmt.Fprintf(w, "Exported %d route(s)\n", len(result.Routes))
+		for _, secret := range result.Redacted {
+			fmt.Fprintf(w, "Left out %s; configure it again after importing\n", secret)
+		}
+	}
+
+	if *outputFile == "" {
+		// The archive was written to stdout, so the summary can only be a
+		// message.
+		if output.Level() != utils.QuietOutput {
+			printSummary(os.Stderr)
+		}
+		return nil
+	}
+
+	err = output.Result(result, printSummary)
+	if err != nil {
+		return e.logger.Error(ctx, err)
+	}
+	return nil
+}
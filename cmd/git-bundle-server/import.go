@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/replica"
+)
+
+// The information printed by 'import --json'.
+type importResult struct {
+	Initialized  []string      `json:"initialized"`
+	Skipped      []string      `json:"skipped"`
+	Failed       []initFailure `json:"failed"`
+	FilesWritten []string      `json:"filesWritten"`
+	FilesSkipped []string      `json:"filesSkipped"`
+	Redacted     []string      `json:"redacted"`
+}
+
+type importCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewImportCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &importCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (importCmd) Name() string {
+	return "import"
+}
+
+func (importCmd) Description() string {
+	return `
+Rebuild a bundle server from the configuration written by 'git-bundle-server
+export' to '<file>' ('-' for stdin): apply its server-wide settings, register
+each of its routes that isn't already registered with its settings, clone their
+repositories, and write their base bundles (or, for a replica, download their
+bundles from the primary). Routes that are already registered are left
+unchanged, and routes that fail to initialize are unregistered, so the command
+can be rerun to retry failures. The bundle storage and signing configuration
+are written unless they already exist (or with '--overwrite').`
+}
+
+// initImportedRoute clones the repository of a route registered by the
+// import and writes its base bundle or, if the server is a replica, downloads
+// the route's bundles from the primary. If that fails, the route is
+// unregistered and its partial data is removed.
+func (i *importCmd) initImportedRoute(ctx context.Context, repo core.Repository, remote string, client *replica.Client) error {
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, i.container)
+	initializer := &initCmd{logger: i.logger, container: i.container}
+
+	err := os.MkdirAll(repo.WebDir, os.ModePerm)
+	if err == nil && client != nil {
+		_, err = replica.SyncBundles(ctx, client, bundleProvider, &repo)
+	} else if err == nil {
+		err = initializer.initRepo(ctx, &repo, core.RouteSource{URL: remote, Route: repo.Route},
+			initOptions{heuristic: bundles.HeuristicCreationToken})
+	}
+	if err != nil {
+		removeErr := initializer.removePartialRoute(ctx, &repo)
+		if removeErr != nil {
+			return fmt.Errorf("%w (and failed to remove route '%s': %s)", err, repo.Route, removeErr)
+		}
+	}
+	return err
+}
+
+func (i *importCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(i.logger, "git-bundle-server import [--overwrite] [--jobs <n>] <file>")
+	overwrite := parser.Bool("overwrite", false, "replace the bundle storage and signing configuration if they exist")
+	jobs := parser.IntRange("jobs", 1, 1, math.MaxInt, "the number of repositories to clone in parallel")
+	filename := parser.PositionalString("file", "the archive written by 'git-bundle-server export' ('-' for stdin)", true)
+	parser.Parse(ctx, args)
+
+	if err := checkWritable(ctx, i.logger, i.container); err != nil {
+		return err
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, i.container)
+	output := utils.GetDependency[utils.Output](ctx, i.container)
+
+	var config *core.ServerConfig
+	var err error
+	if *filename == "-" {
+		config, err = core.ReadConfigArchive(os.Stdin)
+	} else {
+		var file *os.File
+		file, err = os.Open(*filename)
+		if err != nil {
+			return i.logger.Error(ctx, err)
+		}
+		config, err = core.ReadConfigArchive(file)
+		file.Close()
+	}
+	if err != nil {
+		return i.logger.Error(ctx, err)
+	}
+
+	imported, err := repoProvider.ImportConfig(ctx, config, *overwrite)
+	if err != nil {
+		return i.logger.Errorf(ctx, "failed to import configuration: %w", err)
+	}
+
+	client, err := newReplicaClient(ctx, i.container)
+	if err != nil {
+		return i.logger.Error(ctx, err)
+	}
+
+	pending := make([]string, 0, len(imported.Added))
+	for route := range imported.Added {
+		pending = append(pending, route)
+	}
+	sort.Strings(pending)
+	for _, route := range imported.Skipped {
+		output.Printf("Skipping %s: already registered\n", route)
+	}
+
+	// Start the workers before queueing the routes so that the queue never
+	// blocks.
+	errs := make([]error, len(pending))
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < *jobs && w < len(pending); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, exitThread := i.logger.Goroutine(ctx, "import-worker")
+			defer exitThread()
+
+			for index := range queue {
+				route := pending[index]
+				remote, contains := config.Remotes[route]
+				if client != nil {
+					output.Printf("Initializing %s from the primary\n", route)
+					errs[index] = i.initImportedRoute(ctx, imported.Added[route], "", client)
+				} else if !contains {
+					errs[index] = fmt.Errorf("the configuration has no remote URL for route '%s'", route)
+				} else {
+					output.Printf("Initializing %s from %s\n", route, remote)
+					errs[index] = i.initImportedRoute(ctx, imported.Added[route], remote, nil)
+				}
+				if errs[index] != nil {
+					output.Printf("Failed to initialize %s: %s\n", route, errs[index])
+				} else {
+					output.Printf("Initialized %s\n", route)
+				}
+			}
+		}()
+	}
+	for index := range pending {
+		queue <- index
+	}
+	close(queue)
+	wg.Wait()
+
+	result := importResult{
+		Initialized:  []string{},
+		Skipped:      imported.Skipped,
+		Failed:       []initFailure{},
+		FilesWritten: imported.FilesWritten,
+		FilesSkipped: imported.FilesSkipped,
+		Redacted:     config.Redacted,
+	}
+	for index, err := range errs {
+		if err != nil {
+			result.Failed = append(result.Failed, initFailure{Route: pending[index], Error: err.Error()})
+		} else {
+			result.Initialized = append(result.Initialized, pending[index])
+		}
+	}
+
+	err = output.Result(result, func(w io.Writer) {
+		if len(result.Failed) > 0 {
+			fmt.Fprintln(w, "\nFailed routes:")
+			for _, failure := range result.Failed {
+				fmt.Fprintf(w, "  %s: %s\n", failure.Route, failure.Error)
+			}
+		}
+		for _, name := range result.FilesSkipped {
+			fmt.Fprintf(w, "Kept the existing %s (use '--overwrite' to replace it)\n", name)
+		}
+		for _, secret := range result.Redacted {
+			fmt.Fprintf(w, "The export left out %s; configure it again\n", secret)
+		}
+		fmt.Fprintf(w, "\nInitialized %d, skipped %d, failed %d of %d routes\n",
+			len(result.Initialized), len(result.Skipped), len(result.Failed), len(config.Routes()))
+	})
+	if err != nil {
+		return i.logger.Error(ctx, err)
+	}
+
+	// Schedule updates of the new routes, even if some failed.
+	if len(result.Initialized) > 0 {
+		cron := utils.GetDependency[utils.CronHelper](ctx, i.container)
+		cron.SetCronSchedule(ctx)
+	}
+
+	if len(result.Failed) > 0 {
+		return i.logger.Errorf(ctx, "%d of %d routes failed to initialize (rerun the command to retry)",
+			len(result.Failed), len(config.Routes()))
+	}
+	return nil
+}
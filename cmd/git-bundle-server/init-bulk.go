@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+)
+
+const (
+	// The environment variable containing the token used to list the
+	// repositories of a GitHub organization.
+	githubTokenEnvVar string = "GITHUB_TOKEN"
+
+	// The environment variable overriding the URL of the GitHub API (e.g. for
+	// GitHub Enterprise Server).
+	githubAPIURLEnvVar string = "GITHUB_API_URL"
+
+	defaultGitHubAPIURL string = "https://api.github.com"
+	githubReposPerPage  int    = 100
+)
+
+// The information printed by 'init --json' when initializing multiple routes.
+type initBulkResult struct {
+	Initialized []string      `json:"initialized"`
+	Skipped     []string      `json:"skipped"`
+	Failed      []initFailure `json:"failed"`
+}
+
+type initFailure struct {
+	Route string `json:"route"`
+	Error string `json:"error"`
+}
+
+// readRouteSources reads the repositories to initialize from the given file
+// (see core.ParseRouteSources for its format).
+func readRouteSources(filename string) ([]core.RouteSource, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sources, err := core.ParseRouteSources(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", filename, err)
+	}
+	return sources, nil
+}
+
+type githubRepo struct {
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+}
+
+// listGitHubOrgRepos lists the repositories of the given GitHub organization,
+// each hosted at the route '<org>/<repo>'. If 'token' is empty, only public
+// repositories are listed.
+func listGitHubOrgRepos(ctx context.Context, org string, token string) ([]core.RouteSource, error) {
+	apiURL := os.Getenv(githubAPIURLEnvVar)
+	if apiURL == "" {
+		apiURL = defaultGitHubAPIURL
+	}
+
+	sources := []core.RouteSource{}
+	for page := 1; ; page++ {
+		reqURL := fmt.Sprintf("%s/orgs/%s/repos?per_page=%d&page=%d",
+			strings.TrimSuffix(apiURL, "/"), url.PathEscape(org), githubReposPerPage, page)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repositories of '%s': %w", org, err)
+		}
+
+		var repos []githubRepo
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to list repositories of '%s': %s", org, resp.Status)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&repos)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse repositories of '%s': %w", org, err)
+		}
+
+		for _, repo := range repos {
+			sources = append(sources, core.RouteSource{URL: repo.CloneURL, Route: repo.FullName})
+		}
+		if len(repos) < githubReposPerPage {
+			return sources, nil
+		}
+	}
+}
+
+// initRoutes initializes the routes of the given repositories, up to 'jobs' at
+// a time, and prints a summary of the results. Routes that already have a
+// bundle list are skipped.
+func (i *initCmd) initRoutes(ctx context.Context, sources []core.RouteSource, opts initOptions, jobs int) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, i.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, i.container)
+	output := utils.GetDependency[utils.Output](ctx, i.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return i.logger.Error(ctx, err)
+	}
+
+	result := initBulkResult{
+		Initialized: []string{},
+		Skipped:     []string{},
+		Failed:      []initFailure{},
+	}
+	pending := []core.RouteSource{}
+	for _, source := range sources {
+		if repo, contains := repos[source.Route]; contains {
+			if _, err := bundleProvider.GetBundleList(ctx, &repo); err == nil {
+				output.Printf("Skipping %s: already initialized\n", source.Route)
+				result.Skipped = append(result.Skipped, source.Route)
+				continue
+			}
+		}
+		pending = append(pending, source)
+	}
+
+	// Start the workers before queueing the sources so that the queue never
+	// blocks.
+	errs := make([]error, len(pending))
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < jobs && w < len(pending); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, exitThread := i.logger.Goroutine(ctx, "init-worker")
+			defer exitThread()
+
+			for index := range queue {
+				source := pending[index]
+				output.Printf("Initializing %s from %s\n", source.Route, source.URL)
+				errs[index] = i.initRoute(ctx, source, opts)
+				if errs[index] != nil {
+					output.Printf("Failed to initialize %s: %s\n", source.Route, errs[index])
+				} else {
+					output.Printf("Initialized %s\n", source.Route)
+				}
+			}
+		}()
+	}
+	for index := range pending {
+		queue <- index
+	}
+	close(queue)
+	wg.Wait()
+
+	for index, err := range errs {
+		if err != nil {
+			result.Failed = append(result.Failed, initFailure{Route: pending[index].Route, Error: err.Error()})
+		} else {
+			result.Initialized = append(result.Initialized, pending[index].Route)
+		}
+	}
+
+	err = output.Result(result, func(w io.Writer) {
+		if len(result.Failed) > 0 {
+			fmt.Fprintln(w, "\nFailed routes:")
+			for _, failure := range result.Failed {
+				fmt.Fprintf(w, "  %s: %s\n", failure.Route, failure.Error)
+			}
+		}
+		fmt.Fprintf(w, "\nInitialized %d, skipped %d, failed %d of %d routes\n",
+			len(result.Initialized), len(result.Skipped), len(result.Failed), len(sources))
+	})
+	if err != nil {
+		return i.logger.Error(ctx, err)
+	}
+
+	// Schedule updates of the new routes, even if some failed.
+	if len(result.Failed) < len(pending) {
+		cron := utils.GetDependency[utils.CronHelper](ctx, i.container)
+		cron.SetCronSchedule(ctx)
+	}
+
+	if len(result.Failed) > 0 {
+		return i.logger.Errorf(ctx, "%d of %d routes failed to initialize (rerun the command to retry)",
+			len(result.Failed), len(sources))
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"text/tabwriter"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+)
+
+// submoduleManifest is the information printed by 'init --recurse-submodules':
+// the routes serving the bundles of a repository's submodules, with which
+// clients (or their operators) can configure the bundle URIs of all of them at
+// once.
+type submoduleManifest struct {
+	Route      string           `json:"route"`
+	URL        string           `json:"url"`
+	Submodules []submoduleRoute `json:"submodules"`
+}
+
+type submoduleRoute struct {
+	// The path of the submodule in the working tree of the repository; the
+	// paths of nested submodules include those of their parents.
+	Path string `json:"path"`
+	Name string `json:"name"`
+
+	// The URL of the submodule, resolved against the URL of its superproject
+	// if it is relative.
+	URL string `json:"url"`
+
+	// The route of the submodule and the path of its bundle list on the web
+	// server; empty if no route could be initialized for the submodule.
+	Route      string `json:"route,omitempty"`
+	BundleList string `json:"bundleList,omitempty"`
+
+	// Why the submodule's route could not be initialized, if it failed.
+	Error string `json:"error,omitempty"`
+}
+
+// readSubmoduleRoutes reads the routes of submodules from the given file, in
+// the format of '--from-file' (see core.ParseRouteSources), keyed by URL.
+func readSubmoduleRoutes(filename string) (map[string]string, error) {
+	sources, err := readRouteSources(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make(map[string]string, len(sources))
+	for _, source := range sources {
+		routes[source.URL] = source.Route
+	}
+	return routes, nil
+}
+
+// initSubmodules initializes a route for each submodule (recursively) of the
+// repository of the given (initialized) route, using the same options. The
+// route of a submodule is taken from 'submoduleRoutes' if its URL is mapped
+// there, and otherwise derived from its URL. Routes that are already
+// initialized are skipped, and a route shared by several submodules is only
+// initialized once. Once done, the manifest of the submodules' routes is
+// printed.
+func (i *initCmd) initSubmodules(ctx context.Context, root core.RouteSource, opts initOptions, submoduleRoutes map[string]string) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, i.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, i.container)
+	gitHelper := utils.GetDependency[git.GitHelper](ctx, i.container)
+	output := utils.GetDependency[utils.Output](ctx, i.container)
+
+	type superproject struct {
+		source core.RouteSource
+		path   string
+	}
+
+	manifest := submoduleManifest{Route: root.Route, URL: root.URL, Submodules: []submoduleRoute{}}
+	queue := []superproject{{source: root}}
+	seen := map[string]bool{root.Route: true}
+	routeErrors := map[string]string{}
+	failed := 0
+	for len(queue) > 0 {
+		super := queue[0]
+		queue = queue[1:]
+
+		repos, err := repoProvider.GetRepositories(ctx)
+		if err != nil {
+			return i.logger.Error(ctx, err)
+		}
+		superRepo, contains := repos[super.source.Route]
+		if !contains {
+			return i.logger.Error(ctx, &core.RouteNotFoundError{Route: super.source.Route})
+		}
+
+		submodules, err := gitHelper.GetSubmodules(ctx, superRepo.RepoDir)
+		if err != nil {
+			return i.logger.Errorf(ctx, "failed to list submodules of '%s': %w", super.source.Route, err)
+		}
+
+		for _, submodule := range submodules {
+			entry := submoduleRoute{
+				Path: path.Join(super.path, submodule.Path),
+				Name: submodule.Name,
+				URL:  core.ResolveSubmoduleURL(super.source.URL, submodule.URL),
+			}
+
+			route, mapped := submoduleRoutes[entry.URL]
+			if !mapped {
+				var ok bool
+				route, ok = core.GetRouteFromUrl(entry.URL)
+				if !ok {
+					entry.Error = fmt.Sprintf("cannot parse route from url '%s'; map it to a route with '--submodule-routes'", entry.URL)
+					output.Printf("Skipping submodule %s: %s\n", entry.Path, entry.Error)
+					manifest.Submodules = append(manifest.Submodules, entry)
+					failed++
+					continue
+				}
+			}
+
+			if !seen[route] {
+				seen[route] = true
+				source := core.RouteSource{URL: entry.URL, Route: route}
+
+				var initErr error
+				repo, registered := repos[route]
+				if _, listErr := bundleProvider.GetBundleList(ctx, &repo); registered && listErr == nil {
+					output.Printf("Skipping submodule %s: %s is already initialized\n", entry.Path, route)
+				} else {
+					output.Printf("Initializing submodule %s at %s from %s\n", entry.Path, route, entry.URL)
+					initErr = i.initRoute(ctx, source, opts)
+				}
+
+				if initErr != nil {
+					routeErrors[route] = initErr.Error()
+					output.Printf("Failed to initialize %s: %s\n", route, initErr)
+				} else {
+					queue = append(queue, superproject{source: source, path: entry.Path})
+				}
+			}
+
+			if routeErrors[route] != "" {
+				entry.Error = routeErrors[route]
+				manifest.Submodules = append(manifest.Submodules, entry)
+				failed++
+				continue
+			}
+
+			entry.Route = route
+			entry.BundleList = "/" + route
+			manifest.Submodules = append(manifest.Submodules, entry)
+		}
+	}
+
+	err := output.Result(manifest, func(w io.Writer) {
+		if len(manifest.Submodules) == 0 {
+			fmt.Fprintf(w, "\n%s has no submodules\n", root.Route)
+			return
+		}
+
+		fmt.Fprintf(w, "\nSubmodules of %s:\n", root.Route)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  PATH\tROUTE\tBUNDLE LIST")
+		for _, submodule := range manifest.Submodules {
+			if submodule.Error != "" {
+				fmt.Fprintf(tw, "  %s\t-\tfailed: %s\n", submodule.Path, submodule.Error)
+			} else {
+				fmt.Fprintf(tw, "  %s\t%s\t%s\n", submodule.Path, submodule.Route, submodule.BundleList)
+			}
+		}
+		tw.Flush()
+	})
+	if err != nil {
+		return i.logger.Error(ctx, err)
+	}
+
+	if failed > 0 {
+		return i.logger.Errorf(ctx, "%d of %d submodules failed to initialize (rerun the command to retry)",
+			failed, len(manifest.Submodules))
+	}
+	return nil
+}
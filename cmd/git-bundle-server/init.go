@@ -3,6 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
@@ -31,55 +35,321 @@ func (initCmd) Name() string {
 func (initCmd) Description() string {
 	return `
 Initialize a repository by cloning a bare repo from '<url>', whose bundles
-should be hosted at '<route>'.`
+should be hosted at '<route>'. With '--filter', the route's bundles omit the
+objects excluded by the filter, for use by partial clones. With '--refs', only
+the refs matching the given patterns are fetched and bundled. With '--depth',
+the route's base bundles only contain the last '<n>' commits of each ref, for
+repositories too large for a full base bundle.
+
+With '--from-file' or '--github-org', initialize many repositories at once: those
+listed in a file, or every repository of a GitHub organization. Routes that are
+already initialized are skipped, so the command can be rerun to retry failures.
+
+With '--recurse-submodules', also initialize a route for each submodule of the
+repository (recursively), and print the routes of the submodules.`
 }
 
-func (i *initCmd) Run(ctx context.Context, args []string) error {
-	parser := argparse.NewArgParser(i.logger, "git-bundle-server init <url> [<route>]")
-	url := parser.PositionalString("url", "the URL of a repository to clone", true)
-	route := parser.PositionalString("route", "the route to host the specified repo", false)
-	parser.Parse(ctx, args)
+// initOptions are the settings of the routes created by 'init'.
+type initOptions struct {
+	baseURL   string
+	heuristic string
+	filter    string
+	refs      []string
+	proxy     string
+	depth     int
+}
 
-	// Set route value, if needed
-	if *route == "" {
-		var ok bool
-		*route, ok = core.GetRouteFromUrl(*url)
-		if !ok {
-			parser.Usage(ctx, "Cannot parse route from url '%s'; please specify an explicit route.", *url)
+// initRoute registers the route, clones its repository, and writes its base
+// bundle. If the route wasn't already registered and its initialization fails
+// (or is interrupted), it is unregistered and its partial data is removed, so
+// that initializing it can simply be retried.
+func (i *initCmd) initRoute(ctx context.Context, source core.RouteSource, opts initOptions) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, i.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return err
+	}
+	_, registered := repos[source.Route]
+
+	repo, err := repoProvider.CreateRepository(ctx, source.Route)
+	if err != nil {
+		return err
+	}
+
+	err = i.initRepo(ctx, repo, source, opts)
+	if err != nil && !registered {
+		removeErr := i.removePartialRoute(ctx, repo)
+		if removeErr != nil {
+			return fmt.Errorf("%w (and failed to remove route '%s': %s)", err, repo.Route, removeErr)
 		}
 	}
+	return err
+}
+
+// removePartialRoute unregisters a route whose initialization failed and
+// removes its data.
+func (i *initCmd) removePartialRoute(ctx context.Context, repo *core.Repository) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, i.container)
+
+	err := repoProvider.RemoveRoute(ctx, repo.Route)
+	if err != nil {
+		return err
+	}
+
+	storage := utils.GetDependency[bundles.BundleStorage](ctx, i.container)
+	err = bundles.UnpublishWebDir(ctx, storage, repo)
+	if err != nil {
+		return err
+	}
 
+	err = os.RemoveAll(repo.WebDir)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(repo.RepoDir)
+}
+
+// initRepo configures the newly registered route's repository, clones it, and
+// writes its base bundle.
+func (i *initCmd) initRepo(ctx context.Context, repo *core.Repository, source core.RouteSource, opts initOptions) error {
 	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, i.container)
 	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, i.container)
 	gitHelper := utils.GetDependency[git.GitHelper](ctx, i.container)
+	output := utils.GetDependency[utils.Output](ctx, i.container)
+
+	var err error
 
-	repo, err := repoProvider.CreateRepository(ctx, *route)
+	if opts.baseURL != "" || opts.filter != "" || len(opts.refs) > 0 || opts.proxy != "" || opts.depth > 0 {
+		err = repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+			updated, contains := repos[repo.Route]
+			if !contains {
+				return &core.RouteNotFoundError{Route: repo.Route}
+			}
+
+			updated.BaseURL = opts.baseURL
+			updated.Filter = opts.filter
+			updated.Proxy = opts.proxy
+			updated.Depth = opts.depth
+			if len(opts.refs) > 0 {
+				updated.Refs = opts.refs
+			}
+			repos[repo.Route] = updated
+			*repo = updated
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to configure route: %w", err)
+		}
+	}
+
+	output.Printf("Cloning repository from %s\n", source.URL)
+	err = gitHelper.CloneBareRepo(ctx, source.URL, repo.RepoDir, repo.RemoteConfig())
 	if err != nil {
-		return i.logger.Error(ctx, err)
+		return err
 	}
 
-	fmt.Printf("Cloning repository from %s\n", *url)
-	gitHelper.CloneBareRepo(ctx, *url, repo.RepoDir)
+	if len(repo.Refs) > 0 {
+		err = gitHelper.SetFetchRefPatterns(ctx, repo.RepoDir, repo.Refs)
+		if err != nil {
+			return fmt.Errorf("failed to configure ref patterns: %w", err)
+		}
+
+		// The clone fetched all branches; fetch the refs matching the
+		// patterns instead (e.g. tags).
+		err = gitHelper.UpdateBareRepo(ctx, repo.RepoDir, repo.RemoteConfig(), !repo.NoPrune)
+		if err != nil {
+			return fmt.Errorf("failed to fetch refs: %w", err)
+		}
+	}
+
+	err = bundleProvider.EnsureSpaceForBaseBundle(ctx, repo)
+	if err != nil {
+		return err
+	}
 
 	bundle := bundleProvider.CreateInitialBundle(ctx, repo)
-	fmt.Printf("Constructing base bundle file at %s\n", bundle.Filename)
+	output.Printf("Constructing base bundle file at %s\n", bundle.Filename)
 
-	written, gitErr := gitHelper.CreateBundle(ctx, repo.RepoDir, bundle.Filename)
+	written, gitErr := gitHelper.CreateBundle(ctx, repo.RepoDir, bundle.Filename, repo.Refs, bundle.Filter, bundle.Depth)
 	if gitErr != nil {
-		return i.logger.Errorf(ctx, "failed to create bundle: %w", gitErr)
+		return fmt.Errorf("failed to create bundle: %w", gitErr)
 	}
 	if !written {
-		return i.logger.Errorf(ctx, "refused to write empty bundle. Is the repo empty?")
+		return &git.BundleError{Err: fmt.Errorf("refused to write empty bundle. Is the repo empty?")}
+	}
+
+	err = bundleProvider.VerifyBundle(ctx, repo, bundle)
+	if err != nil {
+		return fmt.Errorf("base bundle failed verification: %w", err)
+	}
+
+	bundle.Checksum, err = bundleProvider.ComputeChecksum(ctx, bundle)
+	if err != nil {
+		return fmt.Errorf("failed to compute checksum of base bundle: %w", err)
+	}
+
+	list := bundleProvider.CreateSingletonList(ctx, bundle, opts.heuristic)
+
+	// The clone pointed HEAD at the remote's default branch.
+	list.Head, err = gitHelper.GetHead(ctx, repo.RepoDir)
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD: %w", err)
 	}
 
-	list := bundleProvider.CreateSingletonList(ctx, bundle)
 	listErr := bundleProvider.WriteBundleList(ctx, list, repo)
 	if listErr != nil {
-		return i.logger.Errorf(ctx, "failed to write bundle list: %w", listErr)
+		return fmt.Errorf("failed to write bundle list: %w", listErr)
 	}
 
+	updateTime := time.Unix(bundle.CreationToken, 0)
+	err = repoProvider.RecordUpdate(ctx, repo, updateTime)
+	if err != nil {
+		return fmt.Errorf("failed to record update time: %w", err)
+	}
+	err = repoProvider.RecordUpdateResult(ctx, repo, &core.UpdateResult{
+		Time:           updateTime,
+		BundlesCreated: 1,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record update result: %w", err)
+	}
+
+	return nil
+}
+
+func (i *initCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(i.logger,
+		"git-bundle-server init [--base-url <url>] [--heuristic <name>] [--filter <filter>] [--refs <patterns>] [--depth <n>] [--proxy <url>] [--jobs <n>] "+
+			"(<url> [<route>] [--recurse-submodules [--submodule-routes <file>]] | --from-file <file> | --github-org <org>)")
+	baseURL := parser.String("base-url", "", "the base URL of the route's bundle URIs (see 'git-bundle-server base-url')")
+	heuristicName := parser.Enum("heuristic", bundles.HeuristicCreationToken,
+		[]string{bundles.HeuristicCreationToken, bundles.HeuristicNone},
+		fmt.Sprintf("the bundle list heuristic ('%s' or '%s')", bundles.HeuristicCreationToken, bundles.HeuristicNone))
+	filter := parser.String("filter", "", "the object filter of the route's bundles ('blob:none' or 'blob:limit=<n>')")
+	refs := parser.String("refs", "", "comma-separated patterns of the refs to bundle (e.g. 'refs/heads/main,refs/tags/v*')")
+	depth := parser.IntRange("depth", 0, 0, math.MaxInt, "the number of commits of each ref's history in the route's base bundles (0 for the full history)")
+	proxy := parser.String("proxy", "", "the proxy through which to fetch the repository (see 'git-bundle-server proxy')")
+	fromFile := parser.String("from-file", "", "initialize the repositories listed in the given file ('<url> [<route>]' per line)")
+	githubOrg := parser.String("github-org", "", "initialize every repository of the given GitHub organization")
+	jobs := parser.IntRange("jobs", 1, 1, math.MaxInt, "the number of repositories to initialize in parallel with '--from-file' or '--github-org'")
+	recurseSubmodules := parser.Bool("recurse-submodules", false, "also initialize a route for each submodule of the repository")
+	submoduleRoutesFile := parser.String("submodule-routes", "", "map the URLs of submodules to routes with the given file ('<url> <route>' per line)")
+	url := parser.PositionalString("url", "the URL of a repository to clone", false)
+	route := parser.PositionalString("route", "the route to host the specified repo", false)
+	parser.Parse(ctx, args)
+
+	if err := checkWritable(ctx, i.logger, i.container); err != nil {
+		return err
+	}
+
+	if *baseURL != "" {
+		if err := core.ValidateBaseURL(*baseURL); err != nil {
+			parser.Usage(ctx, "Invalid base URL '%s': %s", *baseURL, err)
+		}
+	}
+	if *filter != "" {
+		if err := core.ValidateFilter(*filter); err != nil {
+			parser.Usage(ctx, "Invalid filter '%s': %s", *filter, err)
+		}
+	}
+	if *proxy != "" {
+		if err := core.ValidateProxy(*proxy); err != nil {
+			parser.Usage(ctx, "Invalid proxy '%s': %s", core.RedactProxy(*proxy), err)
+		}
+	}
+	refPatterns := []string{}
+	if *refs != "" {
+		refPatterns = strings.Split(*refs, ",")
+		for _, pattern := range refPatterns {
+			if err := core.ValidateRefPattern(pattern); err != nil {
+				parser.Usage(ctx, "Invalid ref pattern '%s': %s", pattern, err)
+			}
+		}
+	}
+	// The heuristic name was validated by its flag.
+	heuristic, _ := bundles.ParseHeuristic(*heuristicName)
+
+	// The routes of a replica are those of its primary.
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, i.container)
+	source, err := repoProvider.GetReplicaSource(ctx)
+	if err != nil {
+		return i.logger.Error(ctx, err)
+	} else if source != nil {
+		return i.logger.Errorf(ctx, "this server is a replica of %s; initialize routes on the primary instead", source.URL)
+	}
+
+	opts := initOptions{
+		baseURL:   *baseURL,
+		heuristic: heuristic,
+		filter:    *filter,
+		refs:      refPatterns,
+		proxy:     *proxy,
+		depth:     *depth,
+	}
+
+	if *submoduleRoutesFile != "" && !*recurseSubmodules {
+		parser.Usage(ctx, "'--submodule-routes' requires '--recurse-submodules'.")
+	}
+
+	if *fromFile != "" || *githubOrg != "" {
+		if *url != "" {
+			parser.Usage(ctx, "'<url>' cannot be used with '--from-file' or '--github-org'.")
+		} else if *fromFile != "" && *githubOrg != "" {
+			parser.Usage(ctx, "'--from-file' cannot be used with '--github-org'.")
+		} else if *recurseSubmodules {
+			parser.Usage(ctx, "'--recurse-submodules' cannot be used with '--from-file' or '--github-org'.")
+		}
+
+		var sources []core.RouteSource
+		var err error
+		if *fromFile != "" {
+			sources, err = readRouteSources(*fromFile)
+		} else {
+			sources, err = listGitHubOrgRepos(ctx, *githubOrg, os.Getenv(githubTokenEnvVar))
+		}
+		if err != nil {
+			return i.logger.Errorf(ctx, "failed to get repositories: %w", err)
+		}
+
+		return i.initRoutes(ctx, sources, opts, *jobs)
+	} else if *url == "" {
+		parser.Usage(ctx, "'<url>' is required.")
+	}
+
+	// Set route value, if needed
+	if *route == "" {
+		var ok bool
+		*route, ok = core.GetRouteFromUrl(*url)
+		if !ok {
+			parser.Usage(ctx, "Cannot parse route from url '%s'; please specify an explicit route.", *url)
+		}
+	}
+
+	// Read the submodule routes before initializing anything, so that an
+	// invalid file doesn't leave the submodules uninitialized.
+	submoduleRoutes := map[string]string{}
+	if *submoduleRoutesFile != "" {
+		submoduleRoutes, err = readSubmoduleRoutes(*submoduleRoutesFile)
+		if err != nil {
+			return i.logger.Errorf(ctx, "failed to read submodule routes: %w", err)
+		}
+	}
+
+	rootSource := core.RouteSource{URL: *url, Route: *route}
+	err = i.initRoute(ctx, rootSource, opts)
+	if err != nil {
+		return i.logger.Error(ctx, err)
+	}
+
+	if *recurseSubmodules {
+		err = i.initSubmodules(ctx, rootSource, opts, submoduleRoutes)
+	}
+
+	// Schedule updates of the new routes, even if some submodules failed.
 	cron := utils.GetDependency[utils.CronHelper](ctx, i.container)
 	cron.SetCronSchedule(ctx)
 
-	return nil
+	return err
 }
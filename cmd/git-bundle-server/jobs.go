@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/jobs"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+type jobsCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewJobsCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	j := &jobsCmd{
+		logger:    logger,
+		container: container,
+	}
+
+	return argparse.NewSubcommandGroup(logger, "jobs",
+		`Manage the queue of the web server's background updates (scheduled, triggered
+by webhooks, or requested through the admin API)`,
+		"git-bundle-server jobs (list|cancel) <options>",
+		argparse.NewSubcommand("list", "List the running and pending updates", j.listJobs),
+		argparse.NewSubcommand("cancel", "Cancel an update by ID, or all updates of a route", j.cancelJobs),
+	)
+}
+
+// printJobs prints the given jobs as a table, or as JSON.
+func (j *jobsCmd) printJobs(ctx context.Context, jobList []jobs.Job, emptyMessage string) error {
+	output := utils.GetDependency[utils.Output](ctx, j.container)
+	return output.Result(jobList, func(w io.Writer) {
+		if len(jobList) == 0 {
+			fmt.Fprintln(w, emptyMessage)
+			return
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tROUTE\tSTATE\tPRIORITY\tREASON\tQUEUED")
+		for _, job := range jobList {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.Route, job.State,
+				job.Priority, job.Reason, job.QueuedAt.Local().Format(time.RFC3339))
+		}
+		tw.Flush()
+	})
+}
+
+func (j *jobsCmd) listJobs(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(j.logger, "git-bundle-server jobs list")
+	parser.Parse(ctx, args)
+
+	queue := utils.GetDependency[jobs.JobQueue](ctx, j.container)
+	jobList, err := queue.List(ctx)
+	if err != nil {
+		return j.logger.Error(ctx, err)
+	}
+
+	err = j.printJobs(ctx, jobList, "No updates are queued")
+	if err != nil {
+		return j.logger.Error(ctx, err)
+	}
+	return nil
+}
+
+func (j *jobsCmd) cancelJobs(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(j.logger, "git-bundle-server jobs cancel <id | route>")
+	idOrRoute := parser.PositionalString("id | route", "the ID of the update to cancel, or the route whose updates to cancel", true)
+	parser.Parse(ctx, args)
+
+	queue := utils.GetDependency[jobs.JobQueue](ctx, j.container)
+	output := utils.GetDependency[utils.Output](ctx, j.container)
+	cancelled, err := queue.Cancel(ctx, *idOrRoute)
+	if err != nil {
+		return j.logger.Errorf(ctx, "failed to cancel updates: %w", err)
+	}
+	if len(cancelled) == 0 {
+		return j.logger.Errorf(ctx, "no queued update matches '%s'", *idOrRoute)
+	}
+
+	err = j.printJobs(ctx, cancelled, "")
+	if err != nil {
+		return j.logger.Error(ctx, err)
+	}
+
+	for _, job := range cancelled {
+		if job.State == jobs.StateCancelled {
+			// The web server stops running jobs when it next checks the queue
+			output.Printf("Update %d of %s is running; the web server will stop it shortly\n", job.ID, job.Route)
+		}
+	}
+	return nil
+}
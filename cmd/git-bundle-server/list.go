@@ -3,15 +3,34 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
 	"github.com/git-ecosystem/git-bundle-server/internal/core"
 	"github.com/git-ecosystem/git-bundle-server/internal/git"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
 )
 
+// The information printed for each route by 'list --json'.
+type listEntry struct {
+	Route                string             `json:"route"`
+	Remote               string             `json:"remote"`
+	Head                 string             `json:"head,omitempty"`
+	Disabled             bool               `json:"disabled"`
+	LastUpdate           *core.UpdateResult `json:"lastUpdate"`
+	LastSuccessfulUpdate *time.Time         `json:"lastSuccessfulUpdate"`
+
+	// The disk usage recorded by the last update (nil if never measured) and
+	// the route's quota (0 if unlimited).
+	DiskUsage *core.DiskUsage `json:"diskUsage"`
+	Quota     int64           `json:"quota"`
+}
+
 type listCmd struct {
 	logger    log.TraceLogger
 	container *utils.DependencyContainer
@@ -34,11 +53,22 @@ List the routes registered to the bundle server.`
 }
 
 func (l *listCmd) Run(ctx context.Context, args []string) error {
-	parser := argparse.NewArgParser(l.logger, "git-bundle-server list [--name-only]")
+	parser := argparse.NewArgParser(l.logger, "git-bundle-server list [--name-only | --json]")
 	nameOnly := parser.Bool("name-only", false, "print only the names of configured routes")
+	jsonOutput := parser.Bool("json", false, "print the configured routes and the results of their last update as JSON")
 	parser.Parse(ctx, args)
 
+	output := utils.GetDependency[utils.Output](ctx, l.container)
+	if *jsonOutput {
+		// Equivalent to 'git-bundle-server --json list'.
+		output.SetJson(true)
+	}
+	if *nameOnly && output.IsJson() {
+		parser.Usage(ctx, "'--name-only' and '--json' cannot be used together.")
+	}
+
 	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, l.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, l.container)
 	gitHelper := utils.GetDependency[git.GitHelper](ctx, l.container)
 
 	repos, err := repoProvider.GetRepositories(ctx)
@@ -46,19 +76,81 @@ func (l *listCmd) Run(ctx context.Context, args []string) error {
 		return l.logger.Error(ctx, err)
 	}
 
+	entries := make([]listEntry, 0, len(repos))
 	for _, repo := range repos {
-		info := []string{repo.Route}
-		if !*nameOnly {
-			remote, err := gitHelper.GetRemoteUrl(ctx, repo.RepoDir)
+		repo := repo
+
+		entry := listEntry{
+			Route:    repo.Route,
+			Disabled: repo.Disabled,
+			Quota:    repo.Quota,
+		}
+		if *nameOnly {
+			entries = append(entries, entry)
+			continue
+		}
+
+		entry.Remote, err = gitHelper.GetRemoteUrl(ctx, repo.RepoDir)
+		if err != nil {
+			return l.logger.Error(ctx, err)
+		}
+
+		entry.DiskUsage, err = repoProvider.GetDiskUsage(ctx, &repo)
+		if err != nil {
+			return l.logger.Errorf(ctx, "failed to get disk usage of '%s': %w", repo.Route, err)
+		}
+
+		if output.IsJson() {
+			entry.LastUpdate, err = repoProvider.GetLastUpdateResult(ctx, &repo)
+			if err != nil {
+				return l.logger.Errorf(ctx, "failed to get last update result for '%s': %w", repo.Route, err)
+			}
+
+			lastSuccess, err := repoProvider.GetLastUpdateTime(ctx, &repo)
 			if err != nil {
-				return l.logger.Error(ctx, err)
+				return l.logger.Errorf(ctx, "failed to get last update time for '%s': %w", repo.Route, err)
+			} else if !lastSuccess.IsZero() {
+				entry.LastSuccessfulUpdate = &lastSuccess
+			}
+
+			// Routes that were never (successfully) initialized have no
+			// bundle list, and so no known HEAD.
+			if list, err := bundleProvider.GetBundleList(ctx, &repo); err == nil {
+				entry.Head = list.Head
 			}
-			info = append(info, remote)
 		}
 
-		// Join with space & tab to ensure each element of the info array is
-		// separated by at least two spaces (for better readability).
-		fmt.Println(strings.Join(info, " \t"))
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Route < entries[j].Route })
+
+	err = output.Result(entries, func(w io.Writer) {
+		for _, entry := range entries {
+			info := []string{entry.Route}
+			if !*nameOnly {
+				info = append(info, entry.Remote)
+				if entry.DiskUsage != nil {
+					usage := core.FormatApproxByteSize(entry.DiskUsage.Total())
+					if entry.Quota > 0 {
+						usage += "/" + core.FormatByteSize(entry.Quota)
+					}
+					info = append(info, usage)
+				}
+				if entry.Quota > 0 && entry.DiskUsage != nil && entry.DiskUsage.Total() > entry.Quota {
+					info = append(info, "(over quota)")
+				}
+				if entry.Disabled {
+					info = append(info, "(disabled)")
+				}
+			}
+
+			// Join with space & tab to ensure each element of the info array
+			// is separated by at least two spaces (for better readability).
+			fmt.Fprintln(w, strings.Join(info, " \t"))
+		}
+	})
+	if err != nil {
+		return l.logger.Error(ctx, err)
 	}
 
 	return nil
@@ -2,25 +2,54 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
 )
 
-func all(logger log.TraceLogger) []argparse.Subcommand {
-	container := utils.BuildGitBundleServerContainer(logger)
-
+func all(logger log.TraceLogger, container *utils.DependencyContainer) []argparse.Subcommand {
 	return []argparse.Subcommand{
+		NewAliasCommand(logger, container),
+		NewBaseURLCommand(logger, container),
+		NewCompactionCommand(logger, container),
 		NewDeleteCommand(logger, container),
+		NewDisableCommand(logger, container),
+		NewEnableCommand(logger, container),
+		NewExportCommand(logger, container),
+		NewImportCommand(logger, container),
 		NewInitCommand(logger, container),
+		NewJobsCommand(logger, container),
+		NewMaintenanceCommand(logger, container),
+		NewMigrateCommand(logger, container),
+		NewNotifyCommand(logger, container),
+		NewPruneCommand(logger, container),
+		NewProxyCommand(logger, container),
+		NewQuotaCommand(logger, container),
+		NewReadOnlyCommand(logger, container),
+		NewRenameCommand(logger, container),
 		NewRepairCommand(logger, container),
+		NewReplicaCommand(logger, container),
+		NewRestoreCommand(logger, container),
+		NewRetentionCommand(logger, container),
+		NewRouteCommand(logger, container),
+		NewRouteDepthCommand(logger, container),
 		NewStartCommand(logger, container),
 		NewStopCommand(logger, container),
 		NewUpdateCommand(logger, container),
 		NewUpdateAllCommand(logger, container),
+		NewUpdateRefsCommand(logger, container),
+		NewUpdateScheduleCommand(logger, container),
+		NewURLRewriteCommand(logger, container),
+		NewVerifyCommand(logger, container),
 		NewListCommand(logger, container),
+		NewStatusCommand(logger, container),
 		NewVersionCommand(logger, container),
 		NewWebServerCommand(logger, container),
 	}
@@ -28,18 +57,85 @@ func all(logger log.TraceLogger) []argparse.Subcommand {
 
 func main() {
 	log.WithTraceLogger(context.Background(), func(ctx context.Context, logger log.TraceLogger) {
-		cmds := all(logger)
+		container := utils.BuildGitBundleServerContainer(logger)
+		cmds := all(logger, container)
 
-		parser := argparse.NewArgParser(logger, "git-bundle-server <command> [<options>]")
+		parser := argparse.NewArgParser(logger, "git-bundle-server [--version] [-q | --quiet | --verbose] [--json] [--root <dir>] [--repo-root <dir>] [--web-root <dir>] [<git-options>] [<log-options>] <command> [<options>]")
 		parser.SetIsTopLevel(true)
+		version := parser.Bool("version", false, "display version information and exit (same as the 'version' command)")
+		outputFlags, applyOutputFlags := utils.OutputFlags(parser)
+		outputFlags.VisitAll(func(f *flag.Flag) {
+			parser.Var(f.Value, f.Name, f.Usage)
+		})
+		parser.Alias("quiet", "q")
+		rootFlags, applyRootFlags := utils.StorageRootFlags(parser)
+		rootFlags.VisitAll(func(f *flag.Flag) {
+			parser.Var(f.Value, f.Name, f.Usage)
+		})
+		gitFlags, applyGitFlags := utils.GitFlags(parser)
+		gitFlags.VisitAll(func(f *flag.Flag) {
+			parser.Var(f.Value, f.Name, f.Usage)
+		})
+		logFlags, applyLogFlags := utils.AppLogFlags(parser)
+		logFlags.VisitAll(func(f *flag.Flag) {
+			parser.Var(f.Value, f.Name, f.Usage)
+			parser.Env(f.Name, utils.AppLogEnvVar(f.Name))
+		})
 		for _, cmd := range cmds {
 			parser.Subcommand(cmd)
 		}
-		parser.Parse(ctx, os.Args[1:])
 
-		err := parser.InvokeSubcommand(ctx)
+		// Like Git, treat '--version' on its own as the 'version' command
+		// (which would otherwise be rejected for lacking a subcommand).
+		args := os.Args[1:]
+		if len(args) == 1 && (args[0] == "--version" || args[0] == "-version") {
+			args = []string{"version"}
+		}
+
+		parser.Parse(ctx, args)
+		applyRootFlags(ctx)
+		applyGitFlags(ctx)
+		applyLogFlags(ctx)
+
+		output := utils.GetDependency[utils.Output](ctx, container)
+		applyOutputFlags(ctx, output)
+		if output.IsJson() {
+			// Anything else printed to stdout (e.g. by Git) would corrupt the
+			// JSON result, so send it to stderr instead.
+			os.Stdout = os.Stderr
+		}
+
+		// On Ctrl-C (or SIGTERM), cancel the context rather than exiting
+		// immediately, so that the command stops its child processes and
+		// cleans up after itself (e.g. releases its locks). A second signal
+		// exits immediately.
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+
+		appLogger := utils.GetDependency[log.AppLogger](ctx, container)
+		defer appLogger.Close()
+		command := strings.Join(append([]string{"git-bundle-server"}, args...), " ")
+		appLogger.Debugf(ctx, "Running '%s'", command)
+
+		var err error
+		if *version {
+			err = NewVersionCommand(logger, container).Run(ctx, []string{})
+		} else {
+			err = checkStorageVersion(ctx, logger, container, parser.SubcommandName())
+			if err == nil {
+				err = parser.InvokeSubcommand(ctx)
+			}
+		}
 		if err != nil {
-			logger.Fatalf(ctx, "Failed with error: %s", err)
+			// Exit with a code describing the failure (see 'utils.ExitCode')
+			// so that scripts can handle it without parsing the message.
+			fmt.Fprintf(os.Stderr, "Failed with error: %s\n", err)
+			appLogger.Errorf(ctx, "'%s' failed: %s", command, err)
+			logger.Exit(ctx, utils.ExitCode(err))
 		}
 	})
 }
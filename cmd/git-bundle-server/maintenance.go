@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+type maintenanceCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewMaintenanceCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &maintenanceCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (maintenanceCmd) Name() string {
+	return "maintenance"
+}
+
+func (maintenanceCmd) Description() string {
+	return `
+Garbage collect and repack the repository at '<route>' (or, if no route is
+specified, every enabled repository) and write its commit-graph. Maintenance
+also runs automatically when a repository is updated, at the interval
+configured with '--every', '--never', or '--default'.`
+}
+
+func describeMaintenanceInterval(repo core.Repository) string {
+	switch {
+	case repo.MaintenanceInterval == core.MaintenanceDisabled:
+		return "on demand only"
+	case repo.MaintenanceInterval > 0:
+		return fmt.Sprintf("every %s", repo.MaintenanceInterval)
+	default:
+		return fmt.Sprintf("every %s (default)", core.DefaultMaintenanceInterval)
+	}
+}
+
+func (m *maintenanceCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(m.logger, "git-bundle-server maintenance [--every <interval> | --never | --default] [<route>]")
+	every := parser.Duration("every", 0, "the interval (e.g. '72h') at which maintenance runs when the route is updated")
+	never := parser.Bool("never", false, "only run maintenance on demand")
+	useDefault := parser.Bool("default", false, "reset the route to the default maintenance interval")
+	route := parser.PositionalString("route", "the route to maintain or configure", false)
+	parser.Parse(ctx, args)
+
+	configureCount := 0
+	for _, set := range []bool{*every > 0, *never, *useDefault} {
+		if set {
+			configureCount++
+		}
+	}
+	if configureCount > 1 {
+		parser.Usage(ctx, "'--every', '--never', and '--default' cannot be used together.")
+	} else if configureCount == 1 {
+		if *route == "" {
+			parser.Usage(ctx, "A route must be specified to configure its maintenance interval.")
+		}
+
+		interval := *every
+		if *never {
+			interval = core.MaintenanceDisabled
+		}
+		return m.configure(ctx, *route, interval)
+	}
+
+	if err := checkWritable(ctx, m.logger, m.container); err != nil {
+		return err
+	}
+	return m.runMaintenance(ctx, *route)
+}
+
+// configure sets the maintenance interval of the route (0 for the default).
+func (m *maintenanceCmd) configure(ctx context.Context, route string, interval time.Duration) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, m.container)
+	output := utils.GetDependency[utils.Output](ctx, m.container)
+
+	var repo core.Repository
+	err := repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+		var contains bool
+		repo, contains = repos[route]
+		if !contains {
+			return &core.RouteNotFoundError{Route: route}
+		}
+
+		repo.MaintenanceInterval = interval
+		repos[route] = repo
+		return nil
+	})
+	if err != nil {
+		return m.logger.Errorf(ctx, "failed to write routes: %w", err)
+	}
+
+	output.Printf("%s: maintenance runs %s\n", repo.Route, describeMaintenanceInterval(repo))
+	return nil
+}
+
+// runMaintenance runs maintenance on the given route or, if empty, on every
+// enabled route.
+func (m *maintenanceCmd) runMaintenance(ctx context.Context, route string) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, m.container)
+	output := utils.GetDependency[utils.Output](ctx, m.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return m.logger.Error(ctx, err)
+	}
+
+	routes := []string{}
+	if route != "" {
+		if _, contains := repos[route]; !contains {
+			return m.logger.Error(ctx, &core.RouteNotFoundError{Route: route})
+		}
+		routes = append(routes, route)
+	} else {
+		for route, repo := range repos {
+			if !repo.Disabled {
+				routes = append(routes, route)
+			}
+		}
+		sort.Strings(routes)
+	}
+
+	// Maintain each route in turn; a failure doesn't stop the others.
+	failed := []string{}
+	var lastErr error
+	for _, route := range routes {
+		repo := repos[route]
+
+		lock, _, err := repoProvider.LockForUpdate(ctx, &repo, true)
+		if err == nil {
+			err = maintainRepo(ctx, m.logger, m.container, &repo)
+			lock.Unlock()
+		}
+
+		if err != nil {
+			failed = append(failed, route)
+			lastErr = err
+			if len(routes) > 1 {
+				output.Printf("Failed to run maintenance on %s: %s\n", route, err)
+			}
+		}
+	}
+
+	if len(routes) == 1 {
+		return lastErr
+	} else if len(failed) > 0 {
+		return m.logger.Errorf(ctx, "maintenance failed on %d of %d routes: %s",
+			len(failed), len(routes), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// maintainRepo runs maintenance on the repository (see
+// 'GitHelper.RunMaintenance') and records when it ran. The caller must hold
+// the repository's update lock.
+func maintainRepo(ctx context.Context, logger log.TraceLogger, container *utils.DependencyContainer, repo *core.Repository) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, container)
+	gitHelper := utils.GetDependency[git.GitHelper](ctx, container)
+	output := utils.GetDependency[utils.Output](ctx, container)
+
+	startTime := time.Now()
+	output.Printf("Running maintenance on %s\n", repo.Route)
+	err := gitHelper.RunMaintenance(ctx, repo.RepoDir)
+	if err != nil {
+		return logger.Errorf(ctx, "failed to run maintenance on %s: %w", repo.Route, err)
+	}
+	output.Verbosef("Maintenance took %s\n", time.Since(startTime).Round(time.Millisecond))
+
+	err = repoProvider.RecordMaintenance(ctx, repo, startTime)
+	if err != nil {
+		return logger.Errorf(ctx, "failed to record maintenance time: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'migrate --json'.
+type migrateResult struct {
+	FromVersion int      `json:"fromVersion"`
+	ToVersion   int      `json:"toVersion"`
+	Migrated    bool     `json:"migrated"`
+	Steps       []string `json:"steps"`
+	Backup      string   `json:"backup,omitempty"`
+}
+
+type migrateCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewMigrateCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &migrateCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (migrateCmd) Name() string {
+	return "migrate"
+}
+
+func (migrateCmd) Description() string {
+	return `
+Upgrade the layout of the bundle server's storage (e.g. the route registry) to
+the version used by this version of the bundle server, first backing up the
+files it replaces. Other commands refuse to run on storage that needs to be
+migrated, offering to migrate it if stdin is a terminal.`
+}
+
+func (m *migrateCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(m.logger, "git-bundle-server migrate [--dry-run]")
+	dryRun := parser.Bool("dry-run", false, "Report the migration that would be performed without performing it")
+	parser.Parse(ctx, args)
+
+	if !*dryRun {
+		if err := checkWritable(ctx, m.logger, m.container); err != nil {
+			return err
+		}
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, m.container)
+	output := utils.GetDependency[utils.Output](ctx, m.container)
+
+	var migration *core.StorageMigration
+	if *dryRun {
+		version, err := repoProvider.StorageVersion(ctx)
+		if err != nil {
+			return m.logger.Errorf(ctx, "failed to read storage version: %w", err)
+		}
+		migration = &core.StorageMigration{
+			FromVersion: version,
+			ToVersion:   core.CurrentStorageVersion,
+			Steps:       core.StorageMigrationSteps(version),
+		}
+	} else {
+		var err error
+		migration, err = repoProvider.MigrateStorage(ctx)
+		if err != nil {
+			return m.logger.Errorf(ctx, "failed to migrate storage: %w", err)
+		}
+	}
+
+	result := migrateResult{
+		FromVersion: migration.FromVersion,
+		ToVersion:   migration.ToVersion,
+		Migrated:    !*dryRun && migration.FromVersion != migration.ToVersion,
+		Steps:       migration.Steps,
+		Backup:      migration.Backup,
+	}
+	err := output.Result(result, func(w io.Writer) {
+		switch {
+		case migration.FromVersion > migration.ToVersion:
+			fmt.Fprintf(w, "Storage version %d is newer than this version of git-bundle-server supports (%d)\n",
+				migration.FromVersion, migration.ToVersion)
+			return
+		case migration.FromVersion == migration.ToVersion:
+			fmt.Fprintf(w, "Storage is up-to-date (version %d)\n", migration.ToVersion)
+			return
+		case *dryRun:
+			fmt.Fprintf(w, "Would migrate storage from version %d to %d:\n", migration.FromVersion, migration.ToVersion)
+		default:
+			fmt.Fprintf(w, "Migrated storage from version %d to %d:\n", migration.FromVersion, migration.ToVersion)
+		}
+		for _, step := range migration.Steps {
+			fmt.Fprintf(w, "  - %s\n", step)
+		}
+		if migration.Backup != "" {
+			fmt.Fprintf(w, "Backup: %s\n", migration.Backup)
+		}
+	})
+	if err != nil {
+		return m.logger.Error(ctx, err)
+	}
+
+	return nil
+}
+
+// Commands that run regardless of the storage version: those that don't read
+// the storage, and those that migrate or repair it.
+var storageVersionExemptCommands = map[string]bool{
+	"migrate":    true,
+	"repair":     true,
+	"version":    true,
+	"web-server": true,
+}
+
+// checkStorageVersion returns an error if the storage must be migrated before
+// running the command 'command', after offering to migrate it if stdin is a
+// terminal.
+func checkStorageVersion(ctx context.Context, logger log.TraceLogger, container *utils.DependencyContainer, command string) error {
+	if storageVersionExemptCommands[command] {
+		return nil
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, container)
+	version, err := repoProvider.StorageVersion(ctx)
+	if err != nil {
+		// Leave it to the command to report an unreadable registry (or to
+		// 'repair routes' to rebuild it).
+		return nil
+	}
+
+	if version > core.CurrentStorageVersion {
+		return logger.Errorf(ctx, "storage version %d is not supported; "+
+			"it may have been written by a newer version of git-bundle-server", version)
+	} else if version == core.CurrentStorageVersion {
+		return nil
+	}
+
+	prompter := utils.GetDependency[utils.Prompter](ctx, container)
+	if !prompter.IsInteractive() {
+		return logger.Errorf(ctx, "storage version %d must be migrated to version %d; "+
+			"run 'git-bundle-server migrate'", version, core.CurrentStorageVersion)
+	}
+
+	// Don't offer to migrate the storage while it must not be modified
+	if err := checkWritable(ctx, logger, container); err != nil {
+		return err
+	}
+
+	confirmed, err := prompter.Confirm(ctx, fmt.Sprintf("The bundle server's storage must be migrated "+
+		"from version %d to version %d (the current layout will be backed up). Migrate now?",
+		version, core.CurrentStorageVersion))
+	if err != nil {
+		return logger.Error(ctx, err)
+	} else if !confirmed {
+		return logger.Errorf(ctx, "storage version %d must be migrated to version %d; "+
+			"run 'git-bundle-server migrate'", version, core.CurrentStorageVersion)
+	}
+
+	migration, err := repoProvider.MigrateStorage(ctx)
+	if err != nil {
+		return logger.Errorf(ctx, "failed to migrate storage: %w", err)
+	}
+	if migration.Backup != "" {
+		utils.GetDependency[utils.Output](ctx, container).Printf("Migrated storage to version %d (backup: %s)\n",
+			migration.ToVersion, migration.Backup)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/notify"
+)
+
+type notifyCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewNotifyCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &notifyCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (notifyCmd) Name() string {
+	return "notify"
+}
+
+func (notifyCmd) Description() string {
+	return `
+Send a test notification to each sink configured in the bundle server's
+'notifications.json' file, to check the configuration.`
+}
+
+func (n *notifyCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(n.logger, "git-bundle-server notify [--message <message>]")
+	message := parser.String("message", "Test notification", "the summary of the test notification")
+	parser.Parse(ctx, args)
+
+	notifier := utils.GetDependency[*notify.Notifier](ctx, n.container)
+	output := utils.GetDependency[utils.Output](ctx, n.container)
+	if notifier == nil {
+		return n.logger.Errorf(ctx, "notifications are not configured")
+	}
+
+	err := notifier.Notify(ctx, notify.NewEvent(notify.EventTest, "", *message, ""))
+	if err != nil {
+		return n.logger.Error(ctx, err)
+	}
+
+	output.Printf("Sent test notification\n")
+	return nil
+}
+
+// consecutiveFailures returns the number of consecutive failed updates ending
+// with the given update (if any).
+func consecutiveFailures(result *core.UpdateResult) int {
+	if result == nil || result.Succeeded() {
+		return 0
+	}
+	if result.ConsecutiveFailures == 0 {
+		// Recorded before failures were counted
+		return 1
+	}
+	return result.ConsecutiveFailures
+}
+
+// notifyUpdateResult notifies the configured sinks (if any) when a route
+// fails to update the configured number of times in a row, and when it next
+// updates successfully. Failing to notify doesn't fail the update.
+func notifyUpdateResult(ctx context.Context,
+	container *utils.DependencyContainer,
+	repo *core.Repository,
+	previous *core.UpdateResult,
+	result *core.UpdateResult,
+) {
+	notifier := utils.GetDependency[*notify.Notifier](ctx, container)
+	if notifier == nil {
+		return
+	}
+
+	var event notify.Event
+	threshold := notifier.UpdateFailures()
+	switch {
+	case result.ConsecutiveFailures == threshold:
+		event = notify.NewEvent(notify.EventUpdateFailed, repo.Route,
+			fmt.Sprintf("%s failed to update %d times in a row", repo.Route, result.ConsecutiveFailures),
+			result.Error)
+	case result.Succeeded() && consecutiveFailures(previous) >= threshold:
+		event = notify.NewEvent(notify.EventUpdateRecovered, repo.Route,
+			fmt.Sprintf("%s updated successfully after %d failed updates", repo.Route, consecutiveFailures(previous)),
+			"")
+	default:
+		return
+	}
+
+	err := notifier.Notify(ctx, event)
+	if err != nil {
+		output := utils.GetDependency[utils.Output](ctx, container)
+		appLogger := utils.GetDependency[log.AppLogger](ctx, container)
+		output.Printf("Warning: %s\n", err)
+		appLogger.Warnf(ctx, "Failed to send notification about %s: %s", repo.Route, err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'proxy --json <route>'. Credentials in the proxy
+// URLs are redacted.
+type proxyResult struct {
+	Route       string `json:"route"`
+	Proxy       string `json:"proxy"`
+	ServerProxy string `json:"serverProxy"`
+}
+
+// The information printed by 'proxy --json' without a route.
+type serverProxyResult struct {
+	ServerProxy string `json:"serverProxy"`
+}
+
+type proxyCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewProxyCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &proxyCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (proxyCmd) Name() string {
+	return "proxy"
+}
+
+func (proxyCmd) Description() string {
+	return `
+Display or configure the proxy through which the repository at '<route>' is
+fetched or, if no route is specified, the server-wide proxy used by every route
+without one of its own. Without a configured proxy, Git's own configuration
+(including the 'HTTPS_PROXY' environment variable) applies.`
+}
+
+func describeProxy(repo *core.Repository) string {
+	if repo.Proxy != "" {
+		return core.RedactProxy(repo.Proxy)
+	} else if repo.ServerProxy != "" {
+		return fmt.Sprintf("%s (server default)", core.RedactProxy(repo.ServerProxy))
+	} else {
+		return "none (Git's configuration applies)"
+	}
+}
+
+func (p *proxyCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(p.logger, "git-bundle-server proxy [--set <url>|--unset] [<route>]")
+	set := parser.String("set", "", "the URL of the proxy (e.g. 'http://proxy.example.com:3128')")
+	unset := parser.Bool("unset", false, "remove the proxy")
+	route := parser.PositionalString("route", "the route to configure", false)
+	parser.Parse(ctx, args)
+
+	if *set != "" && *unset {
+		parser.Usage(ctx, "'--set' and '--unset' cannot be used together.")
+	}
+	if *set != "" {
+		if err := core.ValidateProxy(*set); err != nil {
+			parser.Usage(ctx, "Invalid proxy '%s': %s", core.RedactProxy(*set), err)
+		}
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, p.container)
+	output := utils.GetDependency[utils.Output](ctx, p.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return p.logger.Error(ctx, err)
+	}
+
+	repo, contains := repos[*route]
+	if *route != "" && !contains {
+		return p.logger.Error(ctx, &core.RouteNotFoundError{Route: *route})
+	}
+
+	if *set == "" && !*unset {
+		// Nothing to configure, just print the current proxy
+		if *route != "" {
+			result := proxyResult{
+				Route:       repo.Route,
+				Proxy:       core.RedactProxy(repo.Proxy),
+				ServerProxy: core.RedactProxy(repo.ServerProxy),
+			}
+			err = output.Result(result, func(w io.Writer) {
+				fmt.Fprintf(w, "%s: %s\n", repo.Route, describeProxy(&repo))
+			})
+		} else {
+			var serverProxy string
+			serverProxy, err = repoProvider.GetServerProxy(ctx)
+			if err != nil {
+				return p.logger.Error(ctx, err)
+			}
+			serverProxy = core.RedactProxy(serverProxy)
+			err = output.Result(serverProxyResult{ServerProxy: serverProxy}, func(w io.Writer) {
+				if serverProxy == "" {
+					fmt.Fprintln(w, "No server-wide proxy is configured")
+				} else {
+					fmt.Fprintln(w, serverProxy)
+				}
+			})
+		}
+		if err != nil {
+			return p.logger.Error(ctx, err)
+		}
+		return nil
+	}
+
+	if *route != "" {
+		err = repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+			repo, contains = repos[*route]
+			if !contains {
+				return &core.RouteNotFoundError{Route: *route}
+			}
+
+			repo.Proxy = *set
+			repos[*route] = repo
+			return nil
+		})
+	} else {
+		err = repoProvider.SetServerProxy(ctx, *set)
+	}
+	if err != nil {
+		return p.logger.Errorf(ctx, "failed to write routes: %w", err)
+	}
+
+	// Show the proxy of each affected route
+	repos, err = repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return p.logger.Error(ctx, err)
+	}
+
+	affectedRoutes := []string{}
+	for name, repo := range repos {
+		if name == *route || (*route == "" && repo.Proxy == "") {
+			affectedRoutes = append(affectedRoutes, name)
+		}
+	}
+	sort.Strings(affectedRoutes)
+
+	for _, name := range affectedRoutes {
+		repo := repos[name]
+		output.Printf("%s: %s\n", name, describeProxy(&repo))
+	}
+
+	return nil
+}
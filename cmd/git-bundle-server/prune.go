@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	typeutils "github.com/git-ecosystem/git-bundle-server/internal/utils"
+)
+
+// The information printed by 'prune --json'.
+type pruneResult struct {
+	DryRun bool `json:"dryRun"`
+
+	// The total size in bytes of the removed files (or, with '--dry-run', of
+	// the files that would be removed).
+	Reclaimed int64 `json:"reclaimed"`
+}
+
+type pruneCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewPruneCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &pruneCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (pruneCmd) Name() string {
+	return "prune"
+}
+
+func (pruneCmd) Description() string {
+	return `
+Remove the files the bundle server no longer needs: bundles that are not in
+their route's bundle list and temporary files left behind by failed updates of
+'<route>' (or of every route, if no route is specified). If no route is
+specified, the web directories of deleted routes are also removed. Unless
+'--dry-run' is given, the removal must be confirmed, either interactively or
+with '--force'.`
+}
+
+// dirSize returns the total size of the files in the given directory.
+func dirSize(dir string) (int64, error) {
+	size := int64(0)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// pruneRoute removes the stale files of the given route (or, if 'dryRun' is
+// true, just reports them). The route is locked for update while doing so so
+// that an in-progress update isn't disturbed; if the route is being updated,
+// it is skipped.
+func (p *pruneCmd) pruneRoute(ctx context.Context, repo *core.Repository, dryRun bool) (int64, error) {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, p.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, p.container)
+	storage := utils.GetDependency[bundles.BundleStorage](ctx, p.container)
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, p.container)
+	output := utils.GetDependency[utils.Output](ctx, p.container)
+
+	lock, acquired, err := repoProvider.LockForUpdate(ctx, repo, false)
+	if err != nil {
+		return 0, err
+	} else if !acquired {
+		output.Printf("Skipping %s: an update is in progress\n", repo.Route)
+		return 0, nil
+	}
+	defer lock.Unlock()
+
+	list, err := bundleProvider.GetBundleList(ctx, repo)
+	if err != nil {
+		// Without a bundle list, every bundle would appear to be stale.
+		output.Printf("Skipping %s: failed to load bundle list: %s\n", repo.Route, err)
+		return 0, nil
+	}
+
+	staleFiles, err := bundleProvider.FindStaleFiles(ctx, repo, list)
+	if err != nil {
+		return 0, err
+	}
+
+	reclaimed := int64(0)
+	for _, file := range staleFiles {
+		if dryRun {
+			output.Printf("Would remove %s (%s, %d bytes)\n", file.Filename, file.Reason, file.Size)
+		} else {
+			output.Printf("Removing %s (%s, %d bytes)\n", file.Filename, file.Reason, file.Size)
+
+			// Files of the web directory may also have been published to the
+			// storage backend.
+			if filepath.Dir(file.Filename) == filepath.Clean(repo.WebDir) {
+				err := storage.Delete(ctx, repo, filepath.Base(file.Filename))
+				if err != nil {
+					return reclaimed, fmt.Errorf("failed to remove %s: %w", file.Filename, err)
+				}
+			}
+			_, err := fileSystem.DeleteFile(file.Filename)
+			if err != nil {
+				return reclaimed, fmt.Errorf("failed to remove %s: %w", file.Filename, err)
+			}
+		}
+		reclaimed += file.Size
+	}
+
+	return reclaimed, nil
+}
+
+// pruneDeletedRoutes removes the web directories that don't belong to any
+// registered route.
+func (p *pruneCmd) pruneDeletedRoutes(ctx context.Context, dryRun bool) (int64, error) {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, p.container)
+	userProvider := utils.GetDependency[common.UserProvider](ctx, p.container)
+	storage := utils.GetDependency[bundles.BundleStorage](ctx, p.container)
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, p.container)
+	output := utils.GetDependency[utils.Output](ctx, p.container)
+
+	user, err := userProvider.CurrentUser()
+	if err != nil {
+		return 0, err
+	}
+
+	depth, err := repoProvider.GetRouteDepth(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	webRoot := core.WebRoot(user)
+	entries := []common.ReadDirEntry{}
+	for d := depth.Min; d <= depth.Max; d++ {
+		depthEntries, err := fileSystem.ReadDirRecursive(webRoot, d, true)
+		if os.IsNotExist(err) {
+			return 0, nil
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to read web root: %w", err)
+		}
+		entries = append(entries, depthEntries...)
+	}
+
+	// Read the routes after the directories so that a route initialized in
+	// the meantime is never mistaken for a deleted one.
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Routes deleted with their data kept in place can still be restored.
+	deleted, err := repoProvider.GetDeletedRoutes(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// The directories of these routes (and their parent directories) are
+	// kept, as are the contents of the directories already pruned.
+	keptRoutes := typeutils.Keys(repos)
+	for route, deletedRepo := range deleted {
+		if !deletedRepo.Trashed {
+			keptRoutes = append(keptRoutes, route)
+		}
+	}
+	prunedRoutes := []string{}
+
+	reclaimed := int64(0)
+	for _, entry := range entries {
+		route, err := filepath.Rel(webRoot, entry.Path())
+		if err != nil {
+			return reclaimed, err
+		}
+		route = filepath.ToSlash(route)
+		if _, contains := repos[route]; contains || !entry.IsDir() {
+			continue
+		}
+		if deletedRepo, contains := deleted[route]; contains && !deletedRepo.Trashed {
+			continue
+		}
+		if core.ValidateRouteNesting(route, keptRoutes) != nil ||
+			core.ValidateRouteNesting(route, prunedRoutes) != nil {
+			continue
+		}
+		prunedRoutes = append(prunedRoutes, route)
+
+		size, err := dirSize(entry.Path())
+		if err != nil {
+			return reclaimed, fmt.Errorf("failed to get size of %s: %w", entry.Path(), err)
+		}
+
+		if dryRun {
+			output.Printf("Would remove %s (deleted route, %d bytes)\n", entry.Path(), size)
+		} else {
+			output.Printf("Removing %s (deleted route, %d bytes)\n", entry.Path(), size)
+			err = bundles.UnpublishWebDir(ctx, storage, &core.Repository{Route: route, WebDir: entry.Path()})
+			if err != nil {
+				return reclaimed, fmt.Errorf("failed to remove %s: %w", entry.Path(), err)
+			}
+			err = os.RemoveAll(entry.Path())
+			if err != nil {
+				return reclaimed, fmt.Errorf("failed to remove %s: %w", entry.Path(), err)
+			}
+		}
+		reclaimed += size
+	}
+
+	return reclaimed, nil
+}
+
+func (p *pruneCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(p.logger, "git-bundle-server prune [-f | --force] [--dry-run] [<route>]")
+	force := utils.ForceFlag(parser)
+	dryRun := parser.Bool("dry-run", false, "report the files that would be removed without removing them")
+	route := parser.PositionalString("route", "the route to prune", false)
+	parser.Parse(ctx, args)
+
+	if !*dryRun {
+		if err := checkWritable(ctx, p.logger, p.container); err != nil {
+			return err
+		}
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, p.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return p.logger.Error(ctx, err)
+	}
+
+	routes := []string{}
+	if *route != "" {
+		if _, contains := repos[*route]; !contains {
+			return p.logger.Error(ctx, &core.RouteNotFoundError{Route: *route})
+		}
+		routes = append(routes, *route)
+	} else {
+		for name := range repos {
+			routes = append(routes, name)
+		}
+		sort.Strings(routes)
+	}
+
+	if !*dryRun {
+		question := "Remove the stale files of every route and the data of deleted routes?"
+		if *route != "" {
+			question = fmt.Sprintf("Remove the stale files of route '%s'?", *route)
+		}
+
+		prompter := utils.GetDependency[utils.Prompter](ctx, p.container)
+		err = utils.ConfirmDestructive(ctx, prompter, *force, question)
+		if err != nil {
+			return p.logger.Error(ctx, err)
+		}
+	}
+
+	reclaimed := int64(0)
+	for _, name := range routes {
+		repo := repos[name]
+		size, err := p.pruneRoute(ctx, &repo, *dryRun)
+		reclaimed += size
+		if err != nil {
+			return p.logger.Errorf(ctx, "failed to prune '%s': %w", name, err)
+		}
+	}
+
+	if *route == "" {
+		size, err := p.pruneDeletedRoutes(ctx, *dryRun)
+		reclaimed += size
+		if err != nil {
+			return p.logger.Errorf(ctx, "failed to prune deleted routes: %w", err)
+		}
+	}
+
+	output := utils.GetDependency[utils.Output](ctx, p.container)
+	err = output.Result(pruneResult{DryRun: *dryRun, Reclaimed: reclaimed}, func(w io.Writer) {
+		if *dryRun {
+			fmt.Fprintf(w, "Would reclaim %d bytes\n", reclaimed)
+		} else {
+			fmt.Fprintf(w, "Reclaimed %d bytes\n", reclaimed)
+		}
+	})
+	if err != nil {
+		return p.logger.Error(ctx, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'quota --json'. A quota of 0 means that the disk
+// usage of the route is not limited.
+type quotaResult struct {
+	Route     string          `json:"route"`
+	Quota     int64           `json:"quota"`
+	DiskUsage *core.DiskUsage `json:"diskUsage"`
+}
+
+type quotaCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewQuotaCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &quotaCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (quotaCmd) Name() string {
+	return "quota"
+}
+
+func (quotaCmd) Description() string {
+	return `
+Display the disk space used by the repository at '<route>' (its repository and
+bundles) or configure the quota limiting it. When an update leaves the route
+over its quota, space is reclaimed by running maintenance and removing bundles;
+a route that still exceeds its quota is not updated.`
+}
+
+// describeDiskUsage describes the disk usage of the route relative to its
+// quota. If the usage has never been measured, 'usage' is nil.
+func describeDiskUsage(repo *core.Repository, usage *core.DiskUsage) string {
+	var description string
+	if usage == nil {
+		description = "unknown"
+	} else {
+		description = fmt.Sprintf("%s (repository %s, bundles %s)",
+			core.FormatApproxByteSize(usage.Total()),
+			core.FormatApproxByteSize(usage.RepoBytes),
+			core.FormatApproxByteSize(usage.WebBytes))
+	}
+
+	if repo.Quota > 0 {
+		description += fmt.Sprintf(" of %s quota", core.FormatByteSize(repo.Quota))
+		if usage != nil && usage.Total() > repo.Quota {
+			description += " (exceeded)"
+		}
+	} else {
+		description += ", no quota"
+	}
+	return description
+}
+
+func (q *quotaCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(q.logger, "git-bundle-server quota [--set <size>|--unset] <route>")
+	set := parser.ByteSize("set", 0, "the maximum disk space (e.g. '10G') used by the route")
+	unset := parser.Bool("unset", false, "remove the quota")
+	route := parser.PositionalString("route", "the route to display or configure", true)
+	parser.Parse(ctx, args)
+
+	if parser.IsSet("set") && *unset {
+		parser.Usage(ctx, "'--set' and '--unset' cannot be used together.")
+	}
+	if parser.IsSet("set") && *set == 0 {
+		parser.Usage(ctx, "The quota must be greater than 0 (use '--unset' to remove it).")
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, q.container)
+	output := utils.GetDependency[utils.Output](ctx, q.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return q.logger.Error(ctx, err)
+	}
+
+	repo, contains := repos[*route]
+	if !contains {
+		return q.logger.Error(ctx, &core.RouteNotFoundError{Route: *route})
+	}
+
+	if parser.IsSet("set") || *unset {
+		err = repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+			repo, contains = repos[*route]
+			if !contains {
+				return &core.RouteNotFoundError{Route: *route}
+			}
+
+			repo.Quota = *set
+			repos[*route] = repo
+			return nil
+		})
+		if err != nil {
+			return q.logger.Errorf(ctx, "failed to write routes: %w", err)
+		}
+	}
+
+	usage, err := repoProvider.MeasureDiskUsage(ctx, &repo)
+	if err != nil {
+		return q.logger.Errorf(ctx, "failed to measure disk usage: %w", err)
+	}
+
+	result := quotaResult{Route: repo.Route, Quota: repo.Quota, DiskUsage: usage}
+	err = output.Result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "%s: %s\n", repo.Route, describeDiskUsage(&repo, usage))
+	})
+	if err != nil {
+		return q.logger.Error(ctx, err)
+	}
+	return nil
+}
+
+// enforceQuota measures the disk usage of the route and, if it exceeds the
+// route's quota, tries to reclaim space: first by running maintenance, then by
+// removing bundles as if the route's retention policy limited their total size
+// to the space left by the repository (see ApplyRetention). If the route still
+// exceeds its quota, a 'core.QuotaExceededError' is returned. The caller must
+// hold the route's update lock.
+func enforceQuota(ctx context.Context, logger log.TraceLogger, container *utils.DependencyContainer, repo *core.Repository) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, container)
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, container)
+	output := utils.GetDependency[utils.Output](ctx, container)
+
+	usage, err := repoProvider.MeasureDiskUsage(ctx, repo)
+	if err != nil {
+		return logger.Errorf(ctx, "failed to measure disk usage: %w", err)
+	}
+	if repo.Quota == 0 || usage.Total() <= repo.Quota {
+		return nil
+	}
+
+	output.Printf("%s exceeds its quota (%s of %s), reclaiming disk space\n",
+		repo.Route, core.FormatApproxByteSize(usage.Total()), core.FormatByteSize(repo.Quota))
+
+	err = maintainRepo(ctx, logger, container, repo)
+	if err != nil {
+		return err
+	}
+	usage, err = repoProvider.MeasureDiskUsage(ctx, repo)
+	if err != nil {
+		return logger.Errorf(ctx, "failed to measure disk usage: %w", err)
+	}
+
+	if usage.Total() > repo.Quota {
+		list, err := bundleProvider.GetBundleList(ctx, repo)
+		if err != nil {
+			return logger.Errorf(ctx, "failed to load bundle list: %w", err)
+		}
+
+		// Limit the bundles to the space left by the repository, but never
+		// below the size of a lone base bundle: replacing it with a new base
+		// bundle wouldn't reclaim anything.
+		maxSize := repo.Quota - usage.RepoBytes
+		if len(list.Bundles) == 1 {
+			for _, bundle := range list.Bundles {
+				info, err := fileSystem.Stat(bundle.Filename)
+				if err == nil && info.Size() > maxSize {
+					maxSize = info.Size()
+				}
+			}
+		}
+		if maxSize < 1 {
+			maxSize = 1
+		}
+		limited := *repo
+		if limited.Retention.MaxSize == 0 || limited.Retention.MaxSize > maxSize {
+			limited.Retention.MaxSize = maxSize
+		}
+
+		retention, err := bundleProvider.ApplyRetention(ctx, &limited, list)
+		if err != nil {
+			return logger.Errorf(ctx, "failed to remove bundles: %w", err)
+		}
+		if retention.Rebased {
+			output.Printf("Replaced bundle list with a new base bundle to satisfy the quota\n")
+		}
+		if len(retention.DeletedFiles) > 0 {
+			output.Printf("Deleted %d bundle file(s), reclaiming %d bytes\n",
+				len(retention.DeletedFiles), retention.ReclaimedBytes)
+		}
+
+		usage, err = repoProvider.MeasureDiskUsage(ctx, repo)
+		if err != nil {
+			return logger.Errorf(ctx, "failed to measure disk usage: %w", err)
+		}
+	}
+
+	if usage.Total() > repo.Quota {
+		return logger.Error(ctx, &core.QuotaExceededError{Route: repo.Route, Usage: usage.Total(), Quota: repo.Quota})
+	}
+
+	output.Printf("%s is within its quota again (%s of %s)\n",
+		repo.Route, core.FormatApproxByteSize(usage.Total()), core.FormatByteSize(repo.Quota))
+	return nil
+}
+
+// isQuotaExceeded returns whether 'err' is (or wraps) a
+// 'core.QuotaExceededError'.
+func isQuotaExceeded(err error) bool {
+	var quotaErr *core.QuotaExceededError
+	return errors.As(err, &quotaErr)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'read-only --json'.
+type readOnlyResult struct {
+	ReadOnly bool       `json:"readOnly"`
+	Since    *time.Time `json:"since,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+}
+
+type readOnlyCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewReadOnlyCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	r := &readOnlyCmd{
+		logger:    logger,
+		container: container,
+	}
+
+	return argparse.NewSubcommandGroup(logger, "read-only",
+		`Manage the read-only mode of the bundle server (e.g. during a storage
+migration), in which the web server keeps serving the existing bundles, but
+background updates are paused and the commands that modify or delete data
+refuse to run`,
+		"git-bundle-server read-only (on|off|status) <options>",
+		argparse.NewSubcommand("on", "Turn the read-only mode on", r.turnOn),
+		argparse.NewSubcommand("off", "Turn the read-only mode off, resuming background updates", r.turnOff),
+		argparse.NewSubcommand("status", "Display whether the read-only mode is on", r.status),
+	)
+}
+
+// checkWritable returns a 'core.ReadOnlyError' if the bundle server is in
+// read-only mode, for the commands that modify or delete its data to refuse to
+// run.
+func checkWritable(ctx context.Context, logger log.TraceLogger, container *utils.DependencyContainer) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, container)
+	mode, err := repoProvider.GetReadOnlyMode(ctx)
+	if err != nil {
+		// Leave it to the command to report an unreadable registry (or to
+		// 'repair routes' to rebuild it).
+		return nil
+	}
+	if mode != nil {
+		return logger.Error(ctx, &core.ReadOnlyError{Mode: *mode})
+	}
+	return nil
+}
+
+func (r *readOnlyCmd) printMode(ctx context.Context, mode *core.ReadOnlyMode) error {
+	output := utils.GetDependency[utils.Output](ctx, r.container)
+
+	result := readOnlyResult{ReadOnly: mode != nil}
+	if mode != nil {
+		result.Since = &mode.Since
+		result.Reason = mode.Reason
+	}
+	return output.Result(result, func(w io.Writer) {
+		if mode == nil {
+			fmt.Fprintln(w, "Read-only mode is off")
+			return
+		}
+		fmt.Fprintf(w, "Read-only mode is on since %s", formatTime(mode.Since))
+		if mode.Reason != "" {
+			fmt.Fprintf(w, " (%s)", mode.Reason)
+		}
+		fmt.Fprintln(w)
+	})
+}
+
+func (r *readOnlyCmd) turnOn(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(r.logger, "git-bundle-server read-only on [--reason <reason>]")
+	reason := parser.String("reason", "", "why the bundle server is read-only, displayed to anyone running a refused command")
+	parser.Parse(ctx, args)
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, r.container)
+	appLogger := utils.GetDependency[log.AppLogger](ctx, r.container)
+
+	mode, err := repoProvider.GetReadOnlyMode(ctx)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+	if mode == nil || mode.Reason != *reason {
+		// Keep the original start time if only the reason changes
+		since := time.Now()
+		if mode != nil {
+			since = mode.Since
+		}
+		mode = &core.ReadOnlyMode{Since: since, Reason: *reason}
+		err = repoProvider.SetReadOnlyMode(ctx, mode)
+		if err != nil {
+			return r.logger.Errorf(ctx, "failed to turn on read-only mode: %w", err)
+		}
+		appLogger.Infof(ctx, "Turned on read-only mode")
+	}
+
+	err = r.printMode(ctx, mode)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+	return nil
+}
+
+func (r *readOnlyCmd) turnOff(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(r.logger, "git-bundle-server read-only off")
+	parser.Parse(ctx, args)
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, r.container)
+	appLogger := utils.GetDependency[log.AppLogger](ctx, r.container)
+
+	mode, err := repoProvider.GetReadOnlyMode(ctx)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+	if mode != nil {
+		err = repoProvider.SetReadOnlyMode(ctx, nil)
+		if err != nil {
+			return r.logger.Errorf(ctx, "failed to turn off read-only mode: %w", err)
+		}
+		appLogger.Infof(ctx, "Turned off read-only mode")
+	}
+
+	err = r.printMode(ctx, nil)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+	return nil
+}
+
+func (r *readOnlyCmd) status(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(r.logger, "git-bundle-server read-only status")
+	parser.Parse(ctx, args)
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, r.container)
+	mode, err := repoProvider.GetReadOnlyMode(ctx)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	err = r.printMode(ctx, mode)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+type renameCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewRenameCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &renameCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (renameCmd) Name() string {
+	return "rename"
+}
+
+func (renameCmd) Description() string {
+	return `
+Move the repository at '<old-route>', along with its settings and bundles, to
+'<new-route>'. With '--redirect', the web server redirects requests for
+'<old-route>' to '<new-route>'.`
+}
+
+// moveDir renames the directory 'from' to 'to', creating the parent
+// directories of 'to' as needed.
+func moveDir(from string, to string) error {
+	err := os.MkdirAll(filepath.Dir(to), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// removeEmptyParents removes the directories containing 'dir' that were
+// created for the owner (and any other leading elements) of 'route', if they
+// are empty.
+func removeEmptyParents(dir string, route string) {
+	for i := strings.Count(route, "/"); i > 0; i-- {
+		dir = filepath.Dir(dir)
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// moveRepository moves the repository and web directories of 'repo' to those
+// of 'movedRepo'. If either cannot be moved, neither is.
+func moveRepository(repo *core.Repository, movedRepo *core.Repository) error {
+	for _, dir := range []string{movedRepo.RepoDir, movedRepo.WebDir} {
+		_, err := os.Stat(dir)
+		if err == nil {
+			return fmt.Errorf("'%s' already exists", dir)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	err := moveDir(repo.RepoDir, movedRepo.RepoDir)
+	if err != nil {
+		return fmt.Errorf("failed to move repository: %w", err)
+	}
+
+	err = moveDir(repo.WebDir, movedRepo.WebDir)
+	if err != nil {
+		os.Rename(movedRepo.RepoDir, repo.RepoDir)
+		return fmt.Errorf("failed to move web directory: %w", err)
+	}
+
+	// Remove the old owner directories if the route was the last one in them.
+	removeEmptyParents(repo.RepoDir, repo.Route)
+	removeEmptyParents(repo.WebDir, repo.Route)
+
+	return nil
+}
+
+func (r *renameCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(r.logger, "git-bundle-server rename [--redirect] <old-route> <new-route>")
+	redirect := parser.Bool("redirect", false, "redirect web server requests for the old route to the new route")
+	oldRoute := parser.PositionalString("old-route", "the route to rename", true)
+	newRoute := parser.PositionalString("new-route", "the new route of the repository", true)
+	parser.Parse(ctx, args)
+
+	if err := checkWritable(ctx, r.logger, r.container); err != nil {
+		return err
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, r.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, r.container)
+
+	depth, err := repoProvider.GetRouteDepth(ctx)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+	if err := core.ValidateRoute(*newRoute, depth); err != nil {
+		parser.Usage(ctx, "Invalid route '%s': %s", *newRoute, err)
+	}
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	repo, contains := repos[*oldRoute]
+	if !contains {
+		return r.logger.Error(ctx, &core.RouteNotFoundError{Route: *oldRoute})
+	}
+	if _, contains := repos[*newRoute]; contains {
+		return r.logger.Errorf(ctx, "route '%s' is already registered", *newRoute)
+	}
+
+	// Don't move the repository out from under an in-progress update. The
+	// lock file moves along with the repository, so the lock is held until
+	// the rename is complete.
+	lock, _, err := repoProvider.LockForUpdate(ctx, &repo, true)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+	defer lock.Unlock()
+
+	renamedRepo, err := repoProvider.RenameRoute(ctx, *oldRoute, *newRoute, *redirect)
+	if err != nil {
+		return r.logger.Errorf(ctx, "failed to rename route: %w", err)
+	}
+
+	err = moveRepository(&repo, renamedRepo)
+	if err != nil {
+		// Restore the old route so that the registry matches the directories.
+		_, undoErr := repoProvider.RenameRoute(ctx, *newRoute, *oldRoute, false)
+		if undoErr != nil {
+			return r.logger.Errorf(ctx, "%w (and failed to restore route '%s': %s)", err, *oldRoute, undoErr)
+		}
+		return r.logger.Error(ctx, err)
+	}
+
+	// The bundle list contains the paths of the bundles, so it must be
+	// rewritten for the new route.
+	list, err := bundleProvider.GetBundleList(ctx, renamedRepo)
+	if err != nil {
+		return r.logger.Errorf(ctx, "failed to load bundle list: %w", err)
+	}
+	list.Relocate(renamedRepo)
+
+	err = bundleProvider.WriteBundleList(ctx, list, renamedRepo)
+	if err != nil {
+		return r.logger.Errorf(ctx, "failed to write bundle list: %w", err)
+	}
+
+	output := utils.GetDependency[utils.Output](ctx, r.container)
+	output.Printf("Renamed '%s' to '%s'\n", *oldRoute, *newRoute)
+	if *redirect {
+		output.Printf("Requests for '%s' are redirected to '%s'\n", *oldRoute, *newRoute)
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
@@ -11,103 +12,174 @@ import (
 	typeutils "github.com/git-ecosystem/git-bundle-server/internal/utils"
 )
 
+// The information printed by 'repair routes --json'.
+type repairRoutesResult struct {
+	DryRun     bool     `json:"dryRun"`
+	RouteDepth string   `json:"routeDepth"`
+	Added      []string `json:"added"`
+	Removed    []string `json:"removed"`
+}
+
 type repairCmd struct {
 	logger    log.TraceLogger
 	container *utils.DependencyContainer
 }
 
 func NewRepairCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
-	return &repairCmd{
+	r := &repairCmd{
 		logger:    logger,
 		container: container,
 	}
-}
-
-func (repairCmd) Name() string {
-	return "repair"
-}
 
-func (repairCmd) Description() string {
-	return `
+	return argparse.NewSubcommandGroup(logger, "repair", `
 Scan and correct inconsistencies in the bundle server's internal registries and
-storage.`
+storage.`,
+		"git-bundle-server repair <subcommand> [<options>]",
+		argparse.NewSubcommand("routes", "Correct the contents of the internal route registry", r.repairRoutes),
+	)
 }
 
 func (r *repairCmd) repairRoutes(ctx context.Context, args []string) error {
-	parser := argparse.NewArgParser(r.logger, "git-bundle-server repair routes [--start-all] [--dry-run]")
+	parser := argparse.NewArgParser(r.logger, "git-bundle-server repair routes [--start-all] [--route-depth <depth>] [--dry-run]")
 	enable := parser.Bool("start-all", false, "turn on bundle computation for all repositories found")
+	routeDepthArg := parser.String("route-depth", "",
+		"the route depth of the repositories to look for (see 'git-bundle-server route-depth'), if not the configured one")
 	dryRun := parser.Bool("dry-run", false, "report the repairs needed, but do not perform them")
 	// TODO: add a '--cleanup' option to delete non-repo contents inside repo root
 	parser.Parse(ctx, args)
 
+	if !*dryRun {
+		if err := checkWritable(ctx, r.logger, r.container); err != nil {
+			return err
+		}
+	}
+
 	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, r.container)
+	output := utils.GetDependency[utils.Output](ctx, r.container)
 
-	// Read the routes file
+	// Read the route registry
 	repos, err := repoProvider.GetRepositories(ctx)
-	if err != nil {
-		// If routes file cannot be read, start over
-		fmt.Println("warning: cannot load routes file; rebuilding from scratch...")
+	rebuild := err != nil
+	if rebuild {
+		// If the route registry cannot be read, start over
+		output.Printf("warning: cannot load route registry; rebuilding from scratch...\n")
 		repos = make(map[string]core.Repository)
 	}
 
+	// A rebuilt route registry starts with the default route depth.
+	configuredDepth := core.DefaultRouteDepth
+	if !rebuild {
+		configuredDepth, err = repoProvider.GetRouteDepth(ctx)
+		if err != nil {
+			return r.logger.Error(ctx, err)
+		}
+	}
+	depth := configuredDepth
+	if *routeDepthArg != "" {
+		depth, err = core.ParseRouteDepth(*routeDepthArg)
+		if err != nil {
+			parser.Usage(ctx, "Invalid route depth: %s", err)
+		}
+	}
+
 	// Read the repositories as represented by internal storage
-	storedRepos, err := repoProvider.ReadRepositoryStorage(ctx)
+	storedRepos, err := repoProvider.ReadRepositoryStorage(ctx, depth)
 	if err != nil {
 		return r.logger.Errorf(ctx, "could not read internal repository storage: %w", err)
 	}
 
 	_, missingOnDisk, notRegistered := typeutils.SegmentKeys(repos, storedRepos)
 
+	result := repairRoutesResult{
+		DryRun:     *dryRun,
+		RouteDepth: depth.String(),
+		Added:      []string{},
+		Removed:    missingOnDisk,
+	}
+	if *enable {
+		result.Added = notRegistered
+	}
+	for _, route := range result.Added {
+		repos[route] = storedRepos[route]
+	}
+	for _, route := range result.Removed {
+		delete(repos, route)
+	}
+
 	// Print the updates to be made
-	fmt.Print("\n")
-
-	if *enable && len(notRegistered) > 0 {
-		fmt.Println("Unregistered routes to add")
-		fmt.Println("--------------------------")
-		for _, route := range notRegistered {
-			fmt.Printf("* %s\n", route)
-			repos[route] = storedRepos[route]
+	err = output.Result(result, func(w io.Writer) {
+		fmt.Fprint(w, "\n")
+
+		if len(result.Added) > 0 {
+			fmt.Fprintln(w, "Unregistered routes to add")
+			fmt.Fprintln(w, "--------------------------")
+			for _, route := range result.Added {
+				fmt.Fprintf(w, "* %s\n", route)
+			}
+			fmt.Fprint(w, "\n")
+		}
+
+		if len(result.Removed) > 0 {
+			fmt.Fprintln(w, "Missing or invalid routes to remove")
+			fmt.Fprintln(w, "-----------------------------------")
+			for _, route := range result.Removed {
+				fmt.Fprintf(w, "* %s\n", route)
+			}
+			fmt.Fprint(w, "\n")
 		}
-		fmt.Print("\n")
-	}
 
-	if len(missingOnDisk) > 0 {
-		fmt.Println("Missing or invalid routes to remove")
-		fmt.Println("-----------------------------------")
-		for _, route := range missingOnDisk {
-			fmt.Printf("* %s\n", route)
-			delete(repos, route)
+		if depth != configuredDepth {
+			fmt.Fprintf(w, "Route depth to set: %s\n\n", depth)
 		}
-		fmt.Print("\n")
+
+		if len(result.Added) == 0 && len(result.Removed) == 0 && depth == configuredDepth {
+			fmt.Fprintln(w, "No repairs needed.")
+		}
+	})
+	if err != nil {
+		return r.logger.Error(ctx, err)
 	}
 
-	if (!*enable || len(notRegistered) == 0) && len(missingOnDisk) == 0 {
-		fmt.Println("No repairs needed.")
+	if len(result.Added) == 0 && len(result.Removed) == 0 && depth == configuredDepth {
 		return nil
 	}
 
 	if *dryRun {
-		fmt.Println("Skipping updates (dry run)")
+		output.Printf("Skipping updates (dry run)\n")
 	} else {
-		fmt.Println("Applying route repairs...")
-		err := repoProvider.WriteAllRoutes(ctx, repos)
+		output.Printf("Applying route repairs...\n")
+		if rebuild {
+			err = repoProvider.WriteAllRoutes(ctx, repos)
+		} else {
+			// Apply the repairs in a single transaction so that concurrent
+			// route changes aren't lost.
+			err = repoProvider.UpdateRoutes(ctx, func(current map[string]core.Repository) error {
+				if *enable {
+					for _, route := range notRegistered {
+						current[route] = storedRepos[route]
+					}
+				}
+				for _, route := range missingOnDisk {
+					delete(current, route)
+				}
+				return nil
+			})
+		}
 		if err != nil {
 			return err
 		}
+		if depth != configuredDepth {
+			err = repoProvider.SetRouteDepth(ctx, depth)
+			if err != nil {
+				return r.logger.Errorf(ctx, "failed to set route depth: %w", err)
+			}
+		}
 
 		// Start the global cron schedule (if it's not already running)
 		cron := utils.GetDependency[utils.CronHelper](ctx, r.container)
 		cron.SetCronSchedule(ctx)
-		fmt.Println("Done")
+		output.Printf("Done\n")
 	}
 
 	return nil
 }
-
-func (r *repairCmd) Run(ctx context.Context, args []string) error {
-	parser := argparse.NewArgParser(r.logger, "git-bundle-server repair <subcommand> [<options>]")
-	parser.Subcommand(argparse.NewSubcommand("routes", "Correct the contents of the internal route registry", r.repairRoutes))
-	parser.Parse(ctx, args)
-
-	return parser.InvokeSubcommand(ctx)
-}
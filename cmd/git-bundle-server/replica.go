@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/replica"
+)
+
+// The information printed by 'replica --json'.
+type replicaResult struct {
+	Primary   string `json:"primary"`
+	TokenFile string `json:"tokenFile,omitempty"`
+}
+
+type replicaCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewReplicaCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &replicaCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (replicaCmd) Name() string {
+	return "replica"
+}
+
+func (replicaCmd) Description() string {
+	return `
+Display or configure the primary bundle server mirrored by this server. A
+replica doesn't fetch its routes from their remotes: 'update-all' replaces its
+routes with those of the primary (removing the data of any other route), and
+'update' downloads the primary's bundles and bundle list. Listing the routes
+of the primary requires the token of its admin API ('--token-file').`
+}
+
+// newReplicaClient returns a client of the primary bundle server, or nil if
+// this server isn't a replica.
+func newReplicaClient(ctx context.Context, container *utils.DependencyContainer) (*replica.Client, error) {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, container)
+
+	source, err := repoProvider.GetReplicaSource(ctx)
+	if err != nil {
+		return nil, err
+	} else if source == nil {
+		return nil, nil
+	}
+	return replica.NewClient(source, http.DefaultClient)
+}
+
+func (r *replicaCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(r.logger, "git-bundle-server replica [--set <url> [--token-file <file>] | --unset]")
+	set := parser.String("set", "", "the base URL of the primary's web server (e.g. 'https://bundles.example.com')")
+	tokenFile := parser.String("token-file", "", "the file containing the token of the primary's admin API")
+	unset := parser.Bool("unset", false, "stop mirroring the primary")
+	parser.Parse(ctx, args)
+
+	if *set != "" && *unset {
+		parser.Usage(ctx, "'--set' and '--unset' cannot be used together.")
+	}
+	if *tokenFile != "" && *set == "" {
+		parser.Usage(ctx, "'--token-file' requires '--set'.")
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, r.container)
+	output := utils.GetDependency[utils.Output](ctx, r.container)
+
+	var err error
+	switch {
+	case *unset:
+		err = repoProvider.SetReplicaSource(ctx, nil)
+	case *set != "":
+		source := &core.ReplicaSource{URL: *set}
+		if *tokenFile != "" {
+			// The token is read by later commands, which may run from a
+			// different directory.
+			source.TokenFile, err = filepath.Abs(*tokenFile)
+			if err != nil {
+				return r.logger.Error(ctx, err)
+			}
+		}
+		if err := source.Validate(); err != nil {
+			parser.Usage(ctx, "%s", err)
+		}
+		err = repoProvider.SetReplicaSource(ctx, source)
+	}
+	if err != nil {
+		return r.logger.Errorf(ctx, "failed to write routes: %w", err)
+	}
+
+	source, err := repoProvider.GetReplicaSource(ctx)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	result := replicaResult{}
+	if source != nil {
+		result.Primary = source.URL
+		result.TokenFile = source.TokenFile
+	}
+	err = output.Result(result, func(w io.Writer) {
+		if source == nil {
+			fmt.Fprintln(w, "Not a replica")
+			return
+		}
+		fmt.Fprintf(w, "Replica of %s\n", source.URL)
+		if source.TokenFile != "" {
+			fmt.Fprintf(w, "Admin token: %s\n", source.TokenFile)
+		}
+	})
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	if *set != "" {
+		output.Printf("Run 'git-bundle-server update-all' to mirror the routes of the primary\n")
+	}
+	return nil
+}
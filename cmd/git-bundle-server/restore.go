@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed for each route by 'restore --json'.
+type deletedRouteEntry struct {
+	Route     string    `json:"route"`
+	DeletedAt time.Time `json:"deletedAt"`
+
+	// Whether the route's data was moved to the trash (rather than kept in
+	// place).
+	Trashed bool `json:"trashed"`
+}
+
+type restoreCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewRestoreCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &restoreCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (restoreCmd) Name() string {
+	return "restore"
+}
+
+func (restoreCmd) Description() string {
+	return `
+Register '<route>' again after it was deleted with 'delete --keep-data' or
+'delete --trash', with the settings and data it was deleted with. If no route is
+specified, list the routes that can be restored.`
+}
+
+func (r *restoreCmd) printDeletedRoutes(output utils.Output, deleted map[string]core.DeletedRepository) error {
+	routes := make([]string, 0, len(deleted))
+	for route := range deleted {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	entries := make([]deletedRouteEntry, 0, len(routes))
+	for _, route := range routes {
+		repo := deleted[route]
+		entries = append(entries, deletedRouteEntry{
+			Route:     route,
+			DeletedAt: repo.DeletedAt,
+			Trashed:   repo.Trashed,
+		})
+	}
+
+	return output.Result(entries, func(w io.Writer) {
+		if len(entries) == 0 {
+			fmt.Fprintln(w, "No deleted routes can be restored")
+			return
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ROUTE\tDELETED\tDATA")
+		for _, entry := range entries {
+			location := "kept in place"
+			if entry.Trashed {
+				location = "in trash"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Route, formatTime(entry.DeletedAt), location)
+		}
+		tw.Flush()
+	})
+}
+
+func (r *restoreCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(r.logger, "git-bundle-server restore [<route>]")
+	route := parser.PositionalString("route", "the route to restore", false)
+	parser.Parse(ctx, args)
+
+	if *route != "" {
+		if err := checkWritable(ctx, r.logger, r.container); err != nil {
+			return err
+		}
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, r.container)
+	output := utils.GetDependency[utils.Output](ctx, r.container)
+
+	deleted, err := repoProvider.GetDeletedRoutes(ctx)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	if *route == "" {
+		err = r.printDeletedRoutes(output, deleted)
+		if err != nil {
+			return r.logger.Error(ctx, err)
+		}
+		return nil
+	}
+
+	deletedRepo, contains := deleted[*route]
+	if !contains {
+		return utils.WithExitCode(utils.ExitRouteNotFound,
+			r.logger.Errorf(ctx, "route '%s' was not deleted with its data retained", *route))
+	}
+
+	_, err = os.Stat(deletedRepo.RepoDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return r.logger.Errorf(ctx, "the data of route '%s' no longer exists; use 'init' instead", *route)
+	} else if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	repo, err := repoProvider.RestoreRoute(ctx, *route)
+	if err != nil {
+		return r.logger.Errorf(ctx, "failed to restore route: %w", err)
+	}
+
+	if deletedRepo.Trashed {
+		err = moveRepository(&deletedRepo.Repository, repo)
+		if err != nil {
+			// Delete the route again so that it matches its data.
+			_, undoErr := repoProvider.DeleteRoute(ctx, *route, true)
+			if undoErr != nil {
+				return r.logger.Errorf(ctx, "%w (and failed to delete route '%s' again: %s)", err, *route, undoErr)
+			}
+			return r.logger.Error(ctx, err)
+		}
+
+		// Remove the route's directory in the trash (and its owner's, if the
+		// route was the last one in it).
+		trashDir := filepath.Dir(deletedRepo.RepoDir)
+		if os.Remove(trashDir) == nil {
+			removeEmptyParents(trashDir, deletedRepo.Route)
+		}
+	}
+
+	// Make sure we have the global schedule running.
+	cron := utils.GetDependency[utils.CronHelper](ctx, r.container)
+	cron.SetCronSchedule(ctx)
+
+	output.Printf("Restored '%s'\n", *route)
+	return nil
+}
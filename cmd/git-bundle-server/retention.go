@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'retention --json'. A limit of 0 means that the
+// setting is not limited.
+type retentionResult struct {
+	Route      string `json:"route"`
+	MaxBundles int    `json:"maxBundles"`
+
+	// The maximum age of a bundle file, in nanoseconds.
+	MaxAge time.Duration `json:"maxAge"`
+
+	MaxSize int64 `json:"maxSize"`
+}
+
+type retentionCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewRetentionCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &retentionCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (retentionCmd) Name() string {
+	return "retention"
+}
+
+func (retentionCmd) Description() string {
+	return `
+Display or configure the limits on the bundle files kept for the repository at
+'<route>'. The limits are enforced after every update, oldest bundles first.`
+}
+
+func describeRetentionPolicy(policy core.RetentionPolicy) string {
+	if policy.IsDefault() {
+		return "all bundles are kept (default)"
+	}
+
+	limits := []string{}
+	if policy.MaxBundles > 0 {
+		limits = append(limits, fmt.Sprintf("at most %d bundles", policy.MaxBundles))
+	}
+	if policy.MaxAge > 0 {
+		limits = append(limits, fmt.Sprintf("at most %s old", policy.MaxAge))
+	}
+	if policy.MaxSize > 0 {
+		limits = append(limits, fmt.Sprintf("at most %s in total", core.FormatByteSize(policy.MaxSize)))
+	}
+	return strings.Join(limits, ", ")
+}
+
+func (r *retentionCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(r.logger,
+		"git-bundle-server retention [--max-bundles <n>] [--max-age <age>] [--max-size <size>] [--default] <route>")
+	maxBundles := parser.IntRange("max-bundles", 0, 0, math.MaxInt, "the maximum number of bundle files (0 for no limit)")
+	maxAge := parser.Duration("max-age", 0, "the maximum age (e.g. '720h') of a bundle file (0 for no limit)")
+	maxSize := parser.ByteSize("max-size", 0, "the maximum total size (e.g. '10G') of the bundle files (0 for no limit)")
+	useDefault := parser.Bool("default", false, "remove all limits")
+	route := parser.PositionalString("route", "the route to configure", true)
+	parser.Parse(ctx, args)
+
+	configure := parser.IsSet("max-bundles") || parser.IsSet("max-age") || parser.IsSet("max-size")
+	if configure && *useDefault {
+		parser.Usage(ctx, "'--default' cannot be used with other options.")
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, r.container)
+	output := utils.GetDependency[utils.Output](ctx, r.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	repo, contains := repos[*route]
+	if !contains {
+		return r.logger.Error(ctx, &core.RouteNotFoundError{Route: *route})
+	}
+
+	if !configure && !*useDefault {
+		// Nothing to configure, just print the current policy
+		result := retentionResult{
+			Route:      repo.Route,
+			MaxBundles: repo.Retention.MaxBundles,
+			MaxAge:     repo.Retention.MaxAge,
+			MaxSize:    repo.Retention.MaxSize,
+		}
+		err = output.Result(result, func(w io.Writer) {
+			fmt.Fprintf(w, "%s: %s\n", repo.Route, describeRetentionPolicy(repo.Retention))
+		})
+		if err != nil {
+			return r.logger.Error(ctx, err)
+		}
+		return nil
+	}
+
+	err = repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+		repo, contains = repos[*route]
+		if !contains {
+			return &core.RouteNotFoundError{Route: *route}
+		}
+
+		policy := repo.Retention
+		if *useDefault {
+			policy = core.RetentionPolicy{}
+		}
+		if parser.IsSet("max-bundles") {
+			policy.MaxBundles = *maxBundles
+		}
+		if parser.IsSet("max-age") {
+			policy.MaxAge = *maxAge
+		}
+		if parser.IsSet("max-size") {
+			policy.MaxSize = *maxSize
+		}
+
+		err := policy.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid retention policy: %w", err)
+		}
+
+		repo.Retention = policy
+		repos[*route] = repo
+		return nil
+	})
+	if err != nil {
+		return r.logger.Errorf(ctx, "failed to write routes: %w", err)
+	}
+
+	output.Printf("%s: %s\n", repo.Route, describeRetentionPolicy(repo.Retention))
+	output.Printf("The policy will be applied the next time the route is updated.\n")
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'route-depth --json'.
+type routeDepthResult struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+type routeDepthCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewRouteDepthCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &routeDepthCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (routeDepthCmd) Name() string {
+	return "route-depth"
+}
+
+func (routeDepthCmd) Description() string {
+	return `
+Display or configure the number of '/'-separated elements in the routes of the
+bundle server, either as a single number (e.g. '1' for top-level routes like
+'<repo>') or as a range (e.g. '1-3' for routes from '<repo>' to
+'<org>/<team>/<repo>'). The default is '2', for routes like '<owner>/<repo>'.
+The route depth can only be changed if every registered route and alias is
+within the new one.`
+}
+
+func (r *routeDepthCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(r.logger, "git-bundle-server route-depth [--set <depth>]")
+	set := parser.String("set", "", "the route depth, as '<n>' or '<min>-<max>'")
+	parser.Parse(ctx, args)
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, r.container)
+	output := utils.GetDependency[utils.Output](ctx, r.container)
+
+	if *set != "" {
+		depth, err := core.ParseRouteDepth(*set)
+		if err != nil {
+			parser.Usage(ctx, "Invalid route depth: %s", err)
+		}
+
+		err = repoProvider.SetRouteDepth(ctx, depth)
+		if err != nil {
+			return r.logger.Errorf(ctx, "failed to set route depth: %w", err)
+		}
+	}
+
+	depth, err := repoProvider.GetRouteDepth(ctx)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	err = output.Result(routeDepthResult{Min: depth.Min, Max: depth.Max}, func(w io.Writer) {
+		fmt.Fprintln(w, depth)
+	})
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// NewRouteCommand groups the commands that manage the routes registered to the
+// bundle server under 'git-bundle-server route'. Each of them is also
+// available as a top-level command of the same name.
+func NewRouteCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return argparse.NewSubcommandGroup(logger, "route", `
+Manage the routes registered to the bundle server. Each subcommand is
+equivalent to the top-level command of the same name.`,
+		"git-bundle-server route <subcommand> [<options>]",
+		NewAliasCommand(logger, container),
+		NewDeleteCommand(logger, container),
+		NewDisableCommand(logger, container),
+		NewEnableCommand(logger, container),
+		NewListCommand(logger, container),
+		NewRenameCommand(logger, container),
+		NewRestoreCommand(logger, container),
+		NewStatusCommand(logger, container),
+	)
+}
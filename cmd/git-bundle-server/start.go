@@ -47,7 +47,8 @@ func (s *startCmd) Run(ctx context.Context, args []string) error {
 
 	_, err = os.ReadDir(repo.RepoDir)
 	if err != nil {
-		return s.logger.Errorf(ctx, "route '%s' appears to have been deleted; use 'init' instead", *route)
+		return utils.WithExitCode(utils.ExitRouteNotFound,
+			s.logger.Errorf(ctx, "route '%s' appears to have been deleted; use 'init' instead", *route))
 	}
 
 	// Make sure we have the global schedule running.
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/admin"
+	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
+)
+
+// The timeout of each request to the admin API, so that an unresponsive web
+// server doesn't stall the refreshes.
+const watchRequestTimeout time.Duration = 5 * time.Second
+
+// The information printed at each refresh of 'status --watch --json'.
+type watchSnapshot struct {
+	Time time.Time `json:"time"`
+
+	// The state of the web server daemon, or nil if it couldn't be read.
+	WebServer *webServerStatusResult `json:"webServer"`
+
+	// The activity reported by the web server's admin API, or nil if no
+	// admin token is configured or the request failed (see 'activityError').
+	Activity      *admin.Activity `json:"activity"`
+	ActivityError string          `json:"activityError,omitempty"`
+
+	Routes []statusEntry `json:"routes"`
+}
+
+// watch displays the state of the web server daemon, the activity reported by
+// the web server's admin API (if a token file is given), and the result of the
+// last update of each route every 'interval', until the context is done (e.g.
+// on Ctrl-C). On a terminal, each refresh replaces the previous one; with
+// '--json', a JSON object is printed for each refresh.
+func (s *statusCmd) watch(ctx context.Context, interval time.Duration, serverURL string, tokenFile string) error {
+	output := utils.GetDependency[utils.Output](ctx, s.container)
+
+	var client *admin.Client
+	if tokenFile != "" {
+		var err error
+		client, err = admin.NewClient(serverURL, tokenFile, &http.Client{Timeout: watchRequestTimeout})
+		if err != nil {
+			return s.logger.Error(ctx, err)
+		}
+	}
+
+	clearScreen := !output.IsJson() && utils.IsTerminal(os.Stdout)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		snapshot, err := s.getSnapshot(ctx, client)
+		if err != nil {
+			return s.logger.Error(ctx, err)
+		}
+
+		err = output.Result(snapshot, func(w io.Writer) {
+			if clearScreen {
+				// Move the cursor home and clear the screen
+				fmt.Fprint(w, "\033[H\033[2J")
+			} else {
+				fmt.Fprintln(w)
+			}
+			printSnapshot(w, snapshot, interval, client != nil)
+		})
+		if err != nil {
+			return s.logger.Error(ctx, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// getSnapshot collects the information displayed at each refresh of 'status
+// --watch'. Failures to reach the web server are reported in the snapshot
+// rather than returned, so that watching continues (e.g. while the web server
+// restarts).
+func (s *statusCmd) getSnapshot(ctx context.Context, client *admin.Client) (*watchSnapshot, error) {
+	d := utils.GetDependency[daemon.DaemonProvider](ctx, s.container)
+
+	snapshot := &watchSnapshot{Time: time.Now()}
+
+	config, err := (&webServerCmd{logger: s.logger, container: s.container}).getDaemonConfig(ctx)
+	if err == nil {
+		status, err := d.Status(ctx, config.Label)
+		if err == nil {
+			snapshot.WebServer = &webServerStatusResult{
+				Installed:    status.Installed,
+				Running:      status.Running,
+				State:        status.State,
+				LastExitCode: status.LastExitCode,
+				LogPath:      status.LogPath,
+			}
+			if status.PID != 0 {
+				snapshot.WebServer.PID = &status.PID
+			}
+			if !status.StartTime.IsZero() {
+				uptime := status.Uptime(snapshot.Time).Seconds()
+				snapshot.WebServer.StartTime = &status.StartTime
+				snapshot.WebServer.Uptime = &uptime
+			}
+		}
+	}
+
+	if client != nil {
+		snapshot.Activity, err = client.GetActivity(ctx)
+		if err != nil {
+			snapshot.ActivityError = err.Error()
+		}
+	}
+
+	snapshot.Routes, err = s.getSummary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func printSnapshot(w io.Writer, snapshot *watchSnapshot, interval time.Duration, hasAdminAPI bool) {
+	fmt.Fprintf(w, "Every %s: git-bundle-server status  %s\n\n", interval, formatTime(snapshot.Time))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	switch {
+	case snapshot.WebServer == nil:
+		fmt.Fprintf(tw, "Web server:\tunknown\n")
+	case snapshot.WebServer.Running:
+		state := "running"
+		if snapshot.WebServer.PID != nil {
+			state += fmt.Sprintf(" (PID %d", *snapshot.WebServer.PID)
+			if snapshot.WebServer.Uptime != nil {
+				uptime := time.Duration(*snapshot.WebServer.Uptime * float64(time.Second))
+				state += fmt.Sprintf(", up %s", uptime.Round(time.Second))
+			}
+			state += ")"
+		}
+		fmt.Fprintf(tw, "Web server:\t%s\n", state)
+	case snapshot.WebServer.Installed:
+		fmt.Fprintf(tw, "Web server:\tconfigured, but not running\n")
+	default:
+		fmt.Fprintf(tw, "Web server:\tnot configured\n")
+	}
+
+	activity := snapshot.Activity
+	updating := map[string]admin.Update{}
+	switch {
+	case !hasAdminAPI:
+		fmt.Fprintf(tw, "Activity:\tunavailable (no '--admin-token-file')\n")
+	case activity == nil:
+		fmt.Fprintf(tw, "Activity:\tunavailable (%s)\n", snapshot.ActivityError)
+	default:
+		describe := func(counts admin.RequestCounts) string {
+			return fmt.Sprintf("%d (%d client errors, %d server errors)",
+				counts.Total, counts.ClientErrors, counts.ServerErrors)
+		}
+		fmt.Fprintf(tw, "Version:\t%s\n", activity.Version)
+		fmt.Fprintf(tw, "Requests (last minute):\t%s\n", describe(activity.RequestsLastMinute))
+		fmt.Fprintf(tw, "Requests (last 15 minutes):\t%s\n", describe(activity.RequestsLast15Minutes))
+		fmt.Fprintf(tw, "Requests (since %s):\t%s\n", formatTime(activity.StartedAt), describe(activity.RequestsTotal))
+		if activity.ReadOnly != nil {
+			fmt.Fprintf(tw, "Background updates:\tpaused (read-only since %s)\n", formatTime(activity.ReadOnly.Since))
+		}
+		for _, update := range activity.Updates {
+			updating[update.Route] = update
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, entry := range snapshot.Routes {
+		if update, isUpdating := updating[entry.Route]; isUpdating {
+			state := fmt.Sprintf("updating (%s, for %s)", update.Reason,
+				snapshot.Time.Sub(update.StartedAt).Round(time.Second))
+			if update.Progress != nil {
+				state += ": " + formatUpdateProgress(update.Progress)
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", entry.Route, state)
+		} else if entry.Progress != nil {
+			// Updated on the command line rather than by the web server
+			fmt.Fprintf(tw, "%s\tupdating: %s\n", entry.Route, formatUpdateProgress(entry.Progress))
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\n", entry.Route, formatUpdateResult(entry.LastUpdate))
+		}
+	}
+	tw.Flush()
+}
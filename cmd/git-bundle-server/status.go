@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed for each route by 'status --json'.
+type statusEntry struct {
+	Route      string             `json:"route"`
+	LastUpdate *core.UpdateResult `json:"lastUpdate"`
+
+	// The progress of the route's update in progress, if any.
+	Progress *core.UpdateProgress `json:"progress,omitempty"`
+}
+
+// The information printed by 'status --json <route>'.
+type routeStatus struct {
+	Route  string `json:"route"`
+	Remote string `json:"remote"`
+
+	// The URL from which the repository is fetched, if the server's URL
+	// rewrite rules apply to the remote.
+	FetchURL string `json:"fetchUrl,omitempty"`
+
+	// The ref of the remote's default branch as of the last update, if
+	// known.
+	Head string `json:"head,omitempty"`
+
+	// One of 'active', 'disabled', or 'stopped'.
+	Status string `json:"status"`
+
+	UpdateInterval       time.Duration      `json:"updateInterval"`
+	BaseURL              string             `json:"baseURL"`
+	Filter               string             `json:"filter"`
+	Depth                int                `json:"depth"`
+	Refs                 []string           `json:"refs"`
+	Prune                bool               `json:"prune"`
+	Proxy                string             `json:"proxy"`
+	Aliases              []string           `json:"aliases"`
+	LastFetch            *time.Time         `json:"lastFetch"`
+	LastUpdate           *core.UpdateResult `json:"lastUpdate"`
+	LastSuccessfulUpdate *time.Time         `json:"lastSuccessfulUpdate"`
+
+	// The progress of the update in progress, if any.
+	Progress *core.UpdateProgress `json:"progress,omitempty"`
+
+	// The maintenance interval, or -1 if maintenance is only run on demand.
+	MaintenanceInterval time.Duration `json:"maintenanceInterval"`
+	LastMaintenance     *time.Time    `json:"lastMaintenance"`
+
+	// The disk usage recorded by the last update (nil if never measured) and
+	// the quota (0 if unlimited).
+	DiskUsage *core.DiskUsage `json:"diskUsage"`
+	Quota     int64           `json:"quota"`
+
+	Bundles []bundleStatus `json:"bundles"`
+}
+
+type bundleStatus struct {
+	CreationToken int64  `json:"creationToken"`
+	URI           string `json:"uri"`
+
+	// The size of the bundle file in bytes, or nil if the file is missing.
+	Size *int64 `json:"size"`
+}
+
+type statusCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewStatusCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &statusCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (statusCmd) Name() string {
+	return "status"
+}
+
+func (statusCmd) Description() string {
+	return `
+Display the update status of all repositories or, if '<route>' is specified,
+detailed information about a single repository.`
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// formatUpdateProgress describes the progress of an update in progress, e.g.
+// 'fetch: Receiving objects 45% (1.2 MiB)'.
+func formatUpdateProgress(progress *core.UpdateProgress) string {
+	description := progress.Phase
+	if progress.Stage != "" {
+		description += ": " + progress.Stage
+	}
+	if progress.Percent != nil {
+		description += fmt.Sprintf(" %d%%", *progress.Percent)
+	}
+	if progress.Bytes > 0 {
+		description += fmt.Sprintf(" (%s)", formatSize(progress.Bytes))
+	}
+	return description
+}
+
+func formatUpdateResult(result *core.UpdateResult) string {
+	if result == nil {
+		return "never"
+	} else if result.Succeeded() {
+		return fmt.Sprintf("%s (succeeded)", formatTime(result.Time))
+	} else {
+		return fmt.Sprintf("%s (failed: %s)", formatTime(result.Time), result.Error)
+	}
+}
+
+// getSummary returns the result of the most recent update (and the progress
+// of the update in progress, if any) of each active route, sorted by route.
+func (s *statusCmd) getSummary(ctx context.Context) ([]statusEntry, error) {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, s.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]string, 0, len(repos))
+	for route := range repos {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	entries := make([]statusEntry, 0, len(routes))
+	for _, route := range routes {
+		repo := repos[route]
+		result, err := repoProvider.GetLastUpdateResult(ctx, &repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get last update result for '%s': %w", route, err)
+		}
+		progress, err := repoProvider.GetUpdateProgress(ctx, &repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get update progress for '%s': %w", route, err)
+		}
+		entries = append(entries, statusEntry{Route: route, LastUpdate: result, Progress: progress})
+	}
+	return entries, nil
+}
+
+func (s *statusCmd) printSummary(ctx context.Context) error {
+	output := utils.GetDependency[utils.Output](ctx, s.container)
+
+	entries, err := s.getSummary(ctx)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	err = output.Result(entries, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, entry := range entries {
+			if entry.Progress != nil {
+				fmt.Fprintf(tw, "%s\tupdating: %s\n", entry.Route, formatUpdateProgress(entry.Progress))
+			} else {
+				fmt.Fprintf(tw, "%s\t%s\n", entry.Route, formatUpdateResult(entry.LastUpdate))
+			}
+		}
+		tw.Flush()
+	})
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+	return nil
+}
+
+func (s *statusCmd) printRouteDetail(ctx context.Context, route string) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, s.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, s.container)
+	gitHelper := utils.GetDependency[git.GitHelper](ctx, s.container)
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, s.container)
+	output := utils.GetDependency[utils.Output](ctx, s.container)
+
+	// Look up the route in all repositories on disk so that stopped routes
+	// can be reported, too.
+	depth, err := repoProvider.GetRouteDepth(ctx)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+	allRepos, err := repoProvider.ReadRepositoryStorage(ctx, depth)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+	activeRepos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	repo, isActive := activeRepos[route]
+	if !isActive {
+		var exists bool
+		repo, exists = allRepos[route]
+		if !exists {
+			return s.logger.Error(ctx, &core.RouteNotFoundError{Route: route})
+		}
+	}
+
+	remote, err := gitHelper.GetRemoteUrl(ctx, repo.RepoDir)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	lastFetch := time.Time{}
+	if info, err := fileSystem.Stat(filepath.Join(repo.RepoDir, "FETCH_HEAD")); err == nil {
+		lastFetch = info.ModTime()
+	}
+
+	lastSuccess, err := repoProvider.GetLastUpdateTime(ctx, &repo)
+	if err != nil {
+		return s.logger.Errorf(ctx, "failed to get last update time: %w", err)
+	}
+
+	lastResult, err := repoProvider.GetLastUpdateResult(ctx, &repo)
+	if err != nil {
+		return s.logger.Errorf(ctx, "failed to get last update result: %w", err)
+	}
+
+	lastMaintenance, err := repoProvider.GetLastMaintenanceTime(ctx, &repo)
+	if err != nil {
+		return s.logger.Errorf(ctx, "failed to get last maintenance time: %w", err)
+	}
+
+	progress, err := repoProvider.GetUpdateProgress(ctx, &repo)
+	if err != nil {
+		return s.logger.Errorf(ctx, "failed to get update progress: %w", err)
+	}
+
+	diskUsage, err := repoProvider.GetDiskUsage(ctx, &repo)
+	if err != nil {
+		return s.logger.Errorf(ctx, "failed to get disk usage: %w", err)
+	}
+
+	list, err := bundleProvider.GetBundleList(ctx, &repo)
+	if err != nil {
+		return s.logger.Errorf(ctx, "failed to load bundle list: %w", err)
+	}
+
+	status := "active"
+	if !isActive {
+		status = "stopped"
+	} else if repo.Disabled {
+		status = "disabled"
+	}
+
+	detail := routeStatus{
+		Route:               repo.Route,
+		Remote:              remote,
+		Head:                list.Head,
+		Status:              status,
+		UpdateInterval:      repo.EffectiveUpdateInterval(),
+		BaseURL:             repo.EffectiveBaseURL(),
+		Filter:              repo.Filter,
+		Depth:               repo.Depth,
+		Refs:                []string{},
+		Prune:               !repo.NoPrune,
+		Proxy:               core.RedactProxy(repo.EffectiveProxy()),
+		Aliases:             []string{},
+		LastUpdate:          lastResult,
+		Progress:            progress,
+		MaintenanceInterval: repo.EffectiveMaintenanceInterval(),
+		DiskUsage:           diskUsage,
+		Quota:               repo.Quota,
+		Bundles:             []bundleStatus{},
+	}
+	if fetchURL := git.RewriteURL(remote, repo.ServerURLRewrites); fetchURL != remote {
+		detail.FetchURL = core.RedactURL(fetchURL)
+	}
+	detail.Refs = append(detail.Refs, repo.Refs...)
+	detail.Aliases = append(detail.Aliases, repo.Aliases...)
+	if !lastFetch.IsZero() {
+		detail.LastFetch = &lastFetch
+	}
+	if !lastSuccess.IsZero() {
+		detail.LastSuccessfulUpdate = &lastSuccess
+	}
+	if !lastMaintenance.IsZero() {
+		detail.LastMaintenance = &lastMaintenance
+	}
+
+	tokens := make([]int64, 0, len(list.Bundles))
+	for token := range list.Bundles {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i] < tokens[j] })
+
+	for _, token := range tokens {
+		bundle := list.Bundles[token]
+		entry := bundleStatus{CreationToken: token, URI: bundle.URI}
+		if info, err := fileSystem.Stat(bundle.Filename); err == nil {
+			size := info.Size()
+			entry.Size = &size
+		}
+		detail.Bundles = append(detail.Bundles, entry)
+	}
+
+	err = output.Result(detail, func(w io.Writer) {
+		interval := detail.UpdateInterval.String()
+		if repo.UpdateInterval == 0 {
+			interval += " (default)"
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "Route:\t%s\n", repo.Route)
+		fmt.Fprintf(tw, "Remote:\t%s\n", remote)
+		if detail.FetchURL != "" {
+			fmt.Fprintf(tw, "Fetched from:\t%s (rewritten)\n", detail.FetchURL)
+		}
+		if detail.Head != "" {
+			fmt.Fprintf(tw, "Default branch:\t%s\n", detail.Head)
+		}
+		fmt.Fprintf(tw, "Status:\t%s\n", status)
+		fmt.Fprintf(tw, "Update interval:\t%s\n", interval)
+		fmt.Fprintf(tw, "Base URL:\t%s\n", describeBaseURL(&repo))
+		if repo.Filter != "" {
+			fmt.Fprintf(tw, "Filter:\t%s\n", repo.Filter)
+		}
+		if repo.Depth > 0 {
+			fmt.Fprintf(tw, "Base bundle depth:\t%d commits\n", repo.Depth)
+		}
+		fmt.Fprintf(tw, "Refs:\t%s\n", describeRefs(repo))
+		fmt.Fprintf(tw, "Proxy:\t%s\n", describeProxy(&repo))
+		if len(repo.Aliases) > 0 {
+			fmt.Fprintf(tw, "Aliases:\t%s\n", strings.Join(repo.Aliases, ", "))
+		}
+		fmt.Fprintf(tw, "Last fetch:\t%s\n", formatTime(lastFetch))
+		fmt.Fprintf(tw, "Last update:\t%s\n", formatUpdateResult(lastResult))
+		if lastResult != nil {
+			fmt.Fprintf(tw, "  Duration:\t%s\n", lastResult.Duration.Round(time.Millisecond))
+			fmt.Fprintf(tw, "  Refs fetched:\t%d\n", lastResult.RefsFetched)
+			fmt.Fprintf(tw, "  Bundles created:\t%d\n", lastResult.BundlesCreated)
+			if len(lastResult.RewrittenRefs) > 0 {
+				fmt.Fprintf(tw, "  Rewritten refs:\t%s\n", strings.Join(lastResult.RewrittenRefs, ", "))
+			}
+		}
+		fmt.Fprintf(tw, "Last successful update:\t%s\n", formatTime(lastSuccess))
+		if progress != nil {
+			// A progress that stops changing means the update is hung (or was
+			// killed).
+			fmt.Fprintf(tw, "Update in progress:\t%s\n", formatUpdateProgress(progress))
+			fmt.Fprintf(tw, "  Started:\t%s\n", formatTime(progress.StartedAt))
+			fmt.Fprintf(tw, "  Last progress:\t%s ago\n", time.Since(progress.UpdatedAt).Round(time.Second))
+		}
+		fmt.Fprintf(tw, "Maintenance:\t%s\n", describeMaintenanceInterval(repo))
+		fmt.Fprintf(tw, "Last maintenance:\t%s\n", formatTime(lastMaintenance))
+		fmt.Fprintf(tw, "Disk usage:\t%s\n", describeDiskUsage(&repo, diskUsage))
+		tw.Flush()
+
+		fmt.Fprintf(w, "\nBundles (%d):\n", len(detail.Bundles))
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, bundle := range detail.Bundles {
+			size := "missing"
+			if bundle.Size != nil {
+				size = formatSize(*bundle.Size)
+			}
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\n", bundle.CreationToken,
+				formatTime(time.Unix(bundle.CreationToken, 0)), size, bundle.URI)
+		}
+		tw.Flush()
+	})
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+	return nil
+}
+
+func (s *statusCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(s.logger, "git-bundle-server status [--watch [--interval <seconds>] [--server <url>] [--admin-token-file <file>]] [<route>]")
+	watch := parser.Bool("watch", false, "refresh the status of the web server and the routes until interrupted")
+	interval := parser.IntRange("interval", 5, 1, 3600, "the number of seconds between refreshes with '--watch'")
+	server := parser.String("server", "http://localhost:8080", "the URL of the web server whose admin API is queried with '--watch'")
+	tokenFile := parser.String("admin-token-file", "", "the file containing the token of the web server's admin API; "+
+		"without it, '--watch' doesn't display the web server's activity")
+	route := parser.PositionalString("route", "the route to display", false)
+	parser.Alias("interval", "n")
+	parser.Parse(ctx, args)
+
+	if *watch {
+		if *route != "" {
+			parser.Usage(ctx, "'--watch' cannot be used with a route.")
+		}
+		return s.watch(ctx, time.Duration(*interval)*time.Second, *server, *tokenFile)
+	}
+
+	if *route == "" {
+		return s.printSummary(ctx)
+	}
+	return s.printRouteDetail(ctx, *route)
+}
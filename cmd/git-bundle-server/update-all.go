@@ -1,8 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
@@ -10,8 +22,45 @@ import (
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
 	"github.com/git-ecosystem/git-bundle-server/internal/core"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/replica"
 )
 
+// The outcomes of updating a route in 'update-all'.
+const (
+	routeUpdated string = "updated"
+	routeSkipped string = "skipped"
+	routeFailed  string = "failed"
+)
+
+// routeUpdateReport describes the outcome of updating a single route.
+type routeUpdateReport struct {
+	Route  string `json:"route"`
+	Status string `json:"status"`
+
+	// How long the update took, in seconds.
+	Duration float64 `json:"duration"`
+
+	RefsFetched    int    `json:"refsFetched"`
+	BundlesCreated int    `json:"bundlesCreated"`
+	Error          string `json:"error,omitempty"`
+
+	// The exit code of the failed update (see 'utils.ExitCode').
+	ExitCode int `json:"exitCode,omitempty"`
+}
+
+// updateAllReport is the report written by 'update-all --report'.
+type updateAllReport struct {
+	Time time.Time `json:"time"`
+
+	// How long the whole run took, in seconds.
+	Duration float64 `json:"duration"`
+
+	Updated int                 `json:"updated"`
+	Skipped int                 `json:"skipped"`
+	Failed  int                 `json:"failed"`
+	Routes  []routeUpdateReport `json:"routes"`
+}
+
 type updateAllCmd struct {
 	logger    log.TraceLogger
 	container *utils.DependencyContainer
@@ -30,16 +79,201 @@ func (updateAllCmd) Name() string {
 
 func (updateAllCmd) Description() string {
 	return `
-For every configured route, run 'git-bundle-server update <options> <route>'.`
+For every configured route, run 'git-bundle-server update <options> <route>',
+updating up to '--parallel' routes at once. A failed update does not stop the
+other routes from being updated; a summary of the results is printed at the
+end.`
+}
+
+// parseMaxFailures parses the value of '--max-failures': either a number of
+// routes or a percentage of the updated routes (e.g. '10%').
+func parseMaxFailures(value string, routeCount int) (int, error) {
+	if percent, isPercent := strings.CutSuffix(value, "%"); isPercent {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("invalid percentage '%s'", value)
+		}
+		return int(float64(routeCount) * p / 100), nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid count '%s'", value)
+	}
+	return count, nil
+}
+
+// updateErrorMessage extracts the error message of a failed update from its
+// standard error.
+func updateErrorMessage(stderr string, exitCode int) string {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if _, message, found := strings.Cut(last, "Failed with error: "); found {
+		return message
+	} else if last != "" {
+		return last
+	}
+	return fmt.Sprintf("git-bundle-server update exited with status %d", exitCode)
+}
+
+// updateRoute runs 'git-bundle-server update' for the given route and reports
+// its outcome. If 'output' is non-nil, the command's output is written to it
+// rather than to the terminal.
+func (u *updateAllCmd) updateRoute(ctx context.Context, exe string, repo *core.Repository, output *bytes.Buffer) routeUpdateReport {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, u.container)
+	commandExecutor := utils.GetDependency[cmd.CommandExecutor](ctx, u.container)
+	messages := utils.GetDependency[utils.Output](ctx, u.container)
+
+	report := routeUpdateReport{Route: repo.Route}
+
+	var stdout, stderr io.Writer = messages.Messages(), os.Stderr
+	if output != nil {
+		stdout, stderr = output, output
+	}
+	stderrCopy := &bytes.Buffer{}
+
+	// Skip routes that are already being updated (e.g. manually or by the web
+	// server) rather than blocking the rest of the routes. The update's output
+	// is configured like that of this command.
+	args := append(messages.Args(), "update", "--no-wait", repo.Route)
+	startTime := time.Now()
+	exitCode, err := commandExecutor.Run(ctx, exe, args,
+		cmd.Stdout(stdout),
+		cmd.Stderr(io.MultiWriter(stderr, stderrCopy)),
+	)
+	report.Duration = time.Since(startTime).Seconds()
+	if err != nil {
+		report.Status = routeFailed
+		report.Error = err.Error()
+		report.ExitCode = utils.ExitFailure
+		return report
+	}
+
+	// The update records its result (unless it was skipped, or failed before
+	// it started), which has more details than the exit code.
+	result, resultErr := repoProvider.GetLastUpdateResult(ctx, repo)
+	if resultErr != nil || result == nil || result.Time.Before(startTime) {
+		result = nil
+	}
+
+	switch {
+	case exitCode != 0:
+		report.Status = routeFailed
+		report.ExitCode = exitCode
+		if result != nil && result.Error != "" {
+			report.Error = result.Error
+		} else {
+			report.Error = updateErrorMessage(stderrCopy.String(), exitCode)
+		}
+	case result == nil:
+		report.Status = routeSkipped
+	default:
+		report.Status = routeUpdated
+		report.RefsFetched = result.RefsFetched
+		report.BundlesCreated = result.BundlesCreated
+	}
+	return report
+}
+
+// printUpdateSummary prints a table of the outcome of each route, followed by
+// the errors of the routes that failed.
+func printUpdateSummary(w io.Writer, report *updateAllReport) {
+	fmt.Fprintln(w, "Summary:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  ROUTE\tSTATUS\tDURATION\tREFS FETCHED\tBUNDLES CREATED")
+	for _, route := range report.Routes {
+		fmt.Fprintf(tw, "  %s\t%s\t%.1fs\t%d\t%d\n",
+			route.Route, route.Status, route.Duration, route.RefsFetched, route.BundlesCreated)
+	}
+	tw.Flush()
+
+	if report.Failed > 0 {
+		fmt.Fprintln(w, "\nFailed routes:")
+		for _, route := range report.Routes {
+			if route.Status == routeFailed {
+				fmt.Fprintf(w, "  %s: %s\n", route.Route, route.Error)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d updated, %d skipped, %d failed (of %d routes) in %.1fs\n",
+		report.Updated, report.Skipped, report.Failed, len(report.Routes), report.Duration)
+}
+
+// syncRoutes replaces the routes of the replica with those of its primary.
+func (u *updateAllCmd) syncRoutes(ctx context.Context, client *replica.Client) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+
+	routes, err := client.ListRoutes(ctx)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+
+	sync, err := replica.SyncRoutes(ctx, repoProvider, routes)
+	if err != nil {
+		return u.logger.Errorf(ctx, "failed to sync routes from primary: %w", err)
+	}
+	for _, route := range sync.Added {
+		output.Printf("Added %s from primary\n", route)
+	}
+	for _, route := range sync.Changed {
+		output.Verbosef("Updated the settings of %s from primary\n", route)
+	}
+	for _, route := range sync.Removed {
+		output.Printf("Removed %s (no longer on primary)\n", route)
+	}
+	failed := make([]string, 0, len(sync.Failed))
+	for route := range sync.Failed {
+		failed = append(failed, route)
+	}
+	sort.Strings(failed)
+	for _, route := range failed {
+		output.Printf("Warning: cannot mirror %s: %s\n", route, sync.Failed[route])
+	}
+	u.logger.DataJSON(ctx, "update_all", "replica_routes", map[string]int{
+		"added":   len(sync.Added),
+		"changed": len(sync.Changed),
+		"removed": len(sync.Removed),
+		"failed":  len(sync.Failed),
+	})
+	return nil
 }
 
 func (u *updateAllCmd) Run(ctx context.Context, args []string) error {
-	parser := argparse.NewArgParser(u.logger, "git-bundle-server update-all")
+	parser := argparse.NewArgParser(u.logger,
+		"git-bundle-server update-all [--due-only] [-p | --parallel <n>] [--report <file>] [--max-failures <n>|<n>%]")
+	dueOnly := parser.Bool("due-only", false, "only update routes whose update interval has elapsed since their last update")
+	parallel := parser.IntRange("parallel", runtime.NumCPU(), 1, math.MaxInt, "the maximum number of routes to update at once")
+	parser.Alias("parallel", "p")
+	reportFile := parser.String("report", "", "write a JSON report of the results to the given file")
+	maxFailuresArg := parser.String("max-failures", "0",
+		"the number (or percentage, e.g. '10%') of routes that may fail before the command exits with an error")
 	parser.Parse(ctx, args)
 
+	if err := checkWritable(ctx, u.logger, u.container); err != nil {
+		return err
+	}
+
+	if _, err := parseMaxFailures(*maxFailuresArg, 0); err != nil {
+		parser.Usage(ctx, "Invalid '--max-failures': %s", err)
+	}
+
 	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, u.container)
 	fileSystem := utils.GetDependency[common.FileSystem](ctx, u.container)
-	commandExecutor := utils.GetDependency[cmd.CommandExecutor](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+
+	// A replica first mirrors the routes of its primary, so that the new
+	// routes are updated along with the others.
+	client, err := newReplicaClient(ctx, u.container)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	} else if client != nil {
+		err = u.syncRoutes(ctx, client)
+		if err != nil {
+			return err
+		}
+	}
 
 	repos, err := repoProvider.GetRepositories(ctx)
 	if err != nil {
@@ -51,20 +285,107 @@ func (u *updateAllCmd) Run(ctx context.Context, args []string) error {
 		return u.logger.Errorf(ctx, "failed to get path to execuable: %w", err)
 	}
 
-	subargs := []string{"update", ""}
-	subargs = append(subargs, args...)
+	routes := []string{}
+	for route, repo := range repos {
+		if repo.Disabled {
+			continue
+		}
+		if *dueOnly {
+			lastUpdate, err := repoProvider.GetLastUpdateTime(ctx, &repo)
+			if err != nil {
+				return u.logger.Error(ctx, err)
+			}
+			if !repo.IsUpdateDue(lastUpdate, time.Now()) {
+				continue
+			}
+		}
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	u.logger.Data(ctx, "update_all", "routes", len(routes))
+
+	// A failed update doesn't stop the other routes from being updated; the
+	// failures are reported once all routes are done. When updating routes
+	// in parallel, the output of each update is buffered and printed when it
+	// finishes so that the output of different routes isn't interleaved.
+	report := &updateAllReport{
+		Time:   time.Now(),
+		Routes: make([]routeUpdateReport, len(routes)),
+	}
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < *parallel && w < len(routes); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, exitThread := u.logger.Goroutine(ctx, "update-worker")
+			defer exitThread()
+
+			for index := range queue {
+				repo := repos[routes[index]]
+				if *parallel == 1 {
+					output.Printf("*** Updating %s ***\n", repo.Route)
+					report.Routes[index] = u.updateRoute(ctx, exe, &repo, nil)
+					output.Printf("\n")
+					continue
+				}
+
+				updateOutput := &bytes.Buffer{}
+				report.Routes[index] = u.updateRoute(ctx, exe, &repo, updateOutput)
+				output.Printf("*** Updating %s ***\n%s\n", repo.Route, updateOutput.String())
+			}
+		}()
+	}
+	for index := range routes {
+		queue <- index
+	}
+	close(queue)
+	wg.Wait()
+	report.Duration = time.Since(report.Time).Seconds()
+
+	for _, route := range report.Routes {
+		switch route.Status {
+		case routeUpdated:
+			report.Updated++
+		case routeSkipped:
+			report.Skipped++
+		case routeFailed:
+			report.Failed++
+		}
+	}
+	u.logger.DataJSON(ctx, "update_all", "summary", map[string]int{
+		"updated": report.Updated,
+		"skipped": report.Skipped,
+		"failed":  report.Failed,
+	})
+	err = output.Result(report, func(w io.Writer) { printUpdateSummary(w, report) })
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
 
-	for route := range repos {
-		subargs[1] = route
-		fmt.Printf("*** Updating %s ***\n", route)
-		exitCode, err := commandExecutor.RunStdout(ctx, exe, subargs...)
+	if *reportFile != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return u.logger.Errorf(ctx, "failed to serialize report: %w", err)
+		}
+		err = fileSystem.WriteFile(*reportFile, append(data, '\n'))
 		if err != nil {
-			return u.logger.Error(ctx, err)
-		} else if exitCode != 0 {
-			return u.logger.Errorf(ctx, "git-bundle-server update exited with status %d", exitCode)
+			return u.logger.Errorf(ctx, "failed to write report: %w", err)
 		}
-		fmt.Print("\n")
 	}
 
+	maxFailures, _ := parseMaxFailures(*maxFailuresArg, len(routes))
+	if report.Failed > maxFailures {
+		// If every route failed the same way, exit as its update did.
+		codes := []int{}
+		for _, route := range report.Routes {
+			if route.Status == routeFailed {
+				codes = append(codes, route.ExitCode)
+			}
+		}
+		return utils.WithExitCode(utils.CommonExitCode(codes),
+			u.logger.Errorf(ctx, "%d of %d routes failed to update (at most %d allowed)",
+				report.Failed, len(routes), maxFailures))
+	}
 	return nil
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var parseMaxFailuresTests = []struct {
+	title string
+
+	// Inputs
+	value      string
+	routeCount int
+
+	// Expected values
+	expectedCount int
+	expectErr     bool
+}{
+	{"Count", "3", 10, 3, false},
+	{"Zero", "0", 10, 0, false},
+	{"Count larger than the number of routes", "20", 10, 20, false},
+	{"Negative count", "-1", 10, 0, true},
+	{"Invalid count", "three", 10, 0, true},
+	{"Empty value", "", 10, 0, true},
+	{"Percentage", "10%", 50, 5, false},
+	{"Percentage is rounded down", "10%", 19, 1, false},
+	{"Percentage of too few routes", "10%", 9, 0, false},
+	{"Fractional percentage", "12.5%", 40, 5, false},
+	{"Zero percent", "0%", 10, 0, false},
+	{"All routes", "100%", 10, 10, false},
+	{"Percentage over 100", "101%", 10, 0, true},
+	{"Negative percentage", "-10%", 10, 0, true},
+	{"Invalid percentage", "ten%", 10, 0, true},
+	{"Percent sign only", "%", 10, 0, true},
+}
+
+func TestParseMaxFailures(t *testing.T) {
+	for _, tt := range parseMaxFailuresTests {
+		t.Run(tt.title, func(t *testing.T) {
+			count, err := parseMaxFailures(tt.value, tt.routeCount)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedCount, count)
+			}
+		})
+	}
+}
+
+var updateErrorMessageTests = []struct {
+	title string
+
+	// Inputs
+	stderr   string
+	exitCode int
+
+	// Expected values
+	expectedMessage string
+}{
+	{
+		"Error of the update",
+		"Fetching remote...\nFailed with error: failed to fetch: exit status 128\n",
+		1,
+		"failed to fetch: exit status 128",
+	},
+	{
+		"Last line without an error prefix",
+		"warning: something\n  update is already running  \n",
+		1,
+		"update is already running",
+	},
+	{
+		"Empty stderr",
+		"",
+		2,
+		"git-bundle-server update exited with status 2",
+	},
+	{
+		"Whitespace-only stderr",
+		"\n  \n",
+		137,
+		"git-bundle-server update exited with status 137",
+	},
+}
+
+func TestUpdateErrorMessage(t *testing.T) {
+	for _, tt := range updateErrorMessageTests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.expectedMessage, updateErrorMessage(tt.stderr, tt.exitCode))
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+)
+
+// The minimum interval between writes of an update's progress within the same
+// phase and stage; Git reports progress far more often than it is read.
+const progressWriteInterval time.Duration = time.Second
+
+// progressRecorder records the progress of an update of a repository, for
+// 'status <route>' and the web server's admin API to report.
+type progressRecorder struct {
+	repoProvider core.RepositoryProvider
+	repo         *core.Repository
+
+	lock      sync.Mutex
+	progress  core.UpdateProgress
+	lastWrite time.Time
+}
+
+type progressRecorderKey struct{}
+
+// startProgress starts recording the progress of the update of 'repo' that
+// started at 'startTime', returning a context with which the update's Git
+// operations (and calls to setUpdatePhase) report their progress, and a
+// function to call once the update is done.
+func startProgress(ctx context.Context,
+	repoProvider core.RepositoryProvider,
+	repo *core.Repository,
+	startTime time.Time,
+) (context.Context, func()) {
+	r := &progressRecorder{
+		repoProvider: repoProvider,
+		repo:         repo,
+		progress: core.UpdateProgress{
+			StartedAt: startTime,
+			Phase:     core.UpdatePhaseStart,
+		},
+	}
+	r.write(ctx)
+
+	ctx = context.WithValue(ctx, progressRecorderKey{}, r)
+	ctx = git.WithProgressFunc(ctx, func(progress git.Progress) {
+		r.gitProgress(ctx, progress)
+	})
+
+	// The progress is informational, so failing to record (or clear) it
+	// doesn't fail the update.
+	return ctx, func() {
+		_ = repoProvider.ClearUpdateProgress(ctx, repo)
+	}
+}
+
+// setUpdatePhase records that the update using the given context (see
+// startProgress) entered a new phase. It does nothing if the update's progress
+// isn't recorded.
+func setUpdatePhase(ctx context.Context, phase string) {
+	r, ok := ctx.Value(progressRecorderKey{}).(*progressRecorder)
+	if !ok {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.progress.Phase == phase {
+		return
+	}
+	r.progress.Phase = phase
+	r.progress.Stage = ""
+	r.progress.Percent = nil
+	r.progress.Bytes = 0
+	r.write(ctx)
+}
+
+func (r *progressRecorder) gitProgress(ctx context.Context, progress git.Progress) {
+	phase := core.UpdatePhaseFetch
+	if progress.Operation == "bundle" {
+		phase = core.UpdatePhaseBundle
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	changed := r.progress.Phase != phase || r.progress.Stage != progress.Stage
+	r.progress.Phase = phase
+	r.progress.Stage = progress.Stage
+	r.progress.Percent = nil
+	if progress.Percent >= 0 {
+		percent := progress.Percent
+		r.progress.Percent = &percent
+	}
+	r.progress.Bytes = progress.Bytes
+
+	if changed || time.Since(r.lastWrite) >= progressWriteInterval {
+		r.write(ctx)
+	}
+}
+
+// write records the current progress. The caller must hold the lock (or be
+// the only user of the recorder).
+func (r *progressRecorder) write(ctx context.Context) {
+	r.lastWrite = time.Now()
+	r.progress.UpdatedAt = r.lastWrite
+	_ = r.repoProvider.RecordUpdateProgress(ctx, r.repo, &r.progress)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'update-refs --json'. If 'refs' is empty, all
+// branches are bundled.
+type updateRefsResult struct {
+	Route string   `json:"route"`
+	Refs  []string `json:"refs"`
+	Prune bool     `json:"prune"`
+}
+
+type updateRefsCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewUpdateRefsCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &updateRefsCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (updateRefsCmd) Name() string {
+	return "update-refs"
+}
+
+func (updateRefsCmd) Description() string {
+	return `
+Display or configure the refs fetched and bundled for the repository at
+'<route>'. If patterns (e.g. 'refs/heads/main', 'refs/tags/v*') are given, only
+the matching refs are included in new bundles; by default, all branches are.
+Refs deleted from the remote are pruned from the repository unless pruning is
+disabled with '--no-prune'.`
+}
+
+func describeRefPatterns(patterns []string) string {
+	if len(patterns) == 0 {
+		return "all branches (default)"
+	}
+	return strings.Join(patterns, ", ")
+}
+
+func describeRefs(repo core.Repository) string {
+	if repo.NoPrune {
+		return describeRefPatterns(repo.Refs) + " (deleted refs are not pruned)"
+	}
+	return describeRefPatterns(repo.Refs)
+}
+
+func (u *updateRefsCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(u.logger, "git-bundle-server update-refs [--default] [--prune | --no-prune] <route> [<pattern>...]")
+	useDefault := parser.Bool("default", false, "bundle all branches")
+	prune := parser.Bool("prune", false, "delete refs that no longer exist on the remote when updating (default)")
+	noPrune := parser.Bool("no-prune", false, "keep refs deleted from the remote")
+	route := parser.PositionalString("route", "the route to configure", true)
+	patterns := parser.PositionalList("pattern", "the patterns of the refs to bundle", false)
+	parser.Parse(ctx, args)
+
+	if len(*patterns) > 0 && *useDefault {
+		parser.Usage(ctx, "'--default' cannot be used with ref patterns.")
+	}
+	if *prune && *noPrune {
+		parser.Usage(ctx, "'--prune' and '--no-prune' cannot be used together.")
+	}
+	for _, pattern := range *patterns {
+		if err := core.ValidateRefPattern(pattern); err != nil {
+			parser.Usage(ctx, "Invalid ref pattern '%s': %s", pattern, err)
+		}
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, u.container)
+	gitHelper := utils.GetDependency[git.GitHelper](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+
+	repo, contains := repos[*route]
+	if !contains {
+		return u.logger.Error(ctx, &core.RouteNotFoundError{Route: *route})
+	}
+
+	setRefs := len(*patterns) > 0 || *useDefault
+	if !setRefs && !*prune && !*noPrune {
+		// Nothing to configure, just print the current patterns
+		result := updateRefsResult{Route: repo.Route, Refs: append([]string{}, repo.Refs...), Prune: !repo.NoPrune}
+		err = output.Result(result, func(w io.Writer) {
+			fmt.Fprintf(w, "%s: %s\n", repo.Route, describeRefs(repo))
+		})
+		if err != nil {
+			return u.logger.Error(ctx, err)
+		}
+		return nil
+	}
+
+	err = repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+		repo, contains = repos[*route]
+		if !contains {
+			return &core.RouteNotFoundError{Route: *route}
+		}
+
+		if setRefs {
+			repo.Refs = nil
+			if len(*patterns) > 0 {
+				repo.Refs = *patterns
+			}
+		}
+		if *prune || *noPrune {
+			repo.NoPrune = *noPrune
+		}
+		repos[*route] = repo
+		return nil
+	})
+	if err != nil {
+		return u.logger.Errorf(ctx, "failed to write routes: %w", err)
+	}
+
+	if setRefs {
+		err = gitHelper.SetFetchRefPatterns(ctx, repo.RepoDir, repo.Refs)
+		if err != nil {
+			return u.logger.Errorf(ctx, "failed to configure fetched refs (run the command again to retry): %w", err)
+		}
+	}
+
+	output.Printf("%s: %s\n", repo.Route, describeRefs(repo))
+	output.Printf("The changes apply from the next time the route is updated.\n")
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'update-schedule --json'.
+type updateScheduleResult struct {
+	Route string `json:"route"`
+
+	// The interval between updates of the route, in nanoseconds.
+	UpdateInterval time.Duration `json:"updateInterval"`
+}
+
+type updateScheduleCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewUpdateScheduleCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &updateScheduleCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (updateScheduleCmd) Name() string {
+	return "update-schedule"
+}
+
+func (updateScheduleCmd) Description() string {
+	return `
+Display or configure the interval at which the repository at '<route>' is
+updated by the bundle server's update schedule.`
+}
+
+func (u *updateScheduleCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(u.logger, "git-bundle-server update-schedule [--every <interval>|--default] <route>")
+	every := parser.Duration("every", 0, "the interval (e.g. '15m', '6h') at which the route should be updated")
+	useDefault := parser.Bool("default", false, "reset the route to the default update interval")
+	route := parser.PositionalString("route", "the route to configure", true)
+	parser.Parse(ctx, args)
+
+	if *every > 0 && *useDefault {
+		parser.Usage(ctx, "'--every' and '--default' cannot be used together.")
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+
+	repo, contains := repos[*route]
+	if !contains {
+		return u.logger.Error(ctx, &core.RouteNotFoundError{Route: *route})
+	}
+
+	if *every == 0 && !*useDefault {
+		// Nothing to configure, just print the current schedule
+		result := updateScheduleResult{Route: repo.Route, UpdateInterval: repo.EffectiveUpdateInterval()}
+		err = output.Result(result, func(w io.Writer) {
+			if repo.UpdateInterval > 0 {
+				fmt.Fprintf(w, "%s is updated every %s\n", repo.Route, repo.UpdateInterval)
+			} else {
+				fmt.Fprintf(w, "%s is updated every %s (default)\n", repo.Route, core.DefaultUpdateInterval)
+			}
+		})
+		if err != nil {
+			return u.logger.Error(ctx, err)
+		}
+		return nil
+	}
+
+	err = repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+		repo, contains = repos[*route]
+		if !contains {
+			return &core.RouteNotFoundError{Route: *route}
+		}
+
+		repo.UpdateInterval = *every
+		repos[*route] = repo
+		return nil
+	})
+	if err != nil {
+		return u.logger.Errorf(ctx, "failed to write routes: %w", err)
+	}
+
+	if repo.UpdateInterval > 0 {
+		output.Printf("%s will be updated every %s\n", repo.Route, repo.UpdateInterval)
+	} else {
+		output.Printf("%s will be updated every %s (default)\n", repo.Route, core.DefaultUpdateInterval)
+	}
+
+	// Make sure the update schedule reflects the new configuration
+	cron := utils.GetDependency[utils.CronHelper](ctx, u.container)
+	cron.SetCronSchedule(ctx)
+
+	return nil
+}
@@ -3,12 +3,19 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
 	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
 	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/replica"
 )
 
 type updateCmd struct {
@@ -31,53 +38,570 @@ func (updateCmd) Description() string {
 	return `
 For the repository in the current directory (or the one specified by
 '<route>'), fetch the latest content from the remote, create a new set of
-bundles, and update the bundle list.`
+bundles, and update the bundle list. Several routes may be given, including
+patterns (e.g. 'org/*') matching the registered routes. With '--base', replace
+the bundle list with a single new base bundle rather than adding to it.`
+}
+
+// resolveRoutes expands the route arguments of 'update' into the routes to
+// update. Arguments containing pattern characters (as in 'path.Match', e.g.
+// 'org/*') are replaced with the matching registered routes; other arguments
+// are used as-is. Each route is included at most once.
+func resolveRoutes(ctx context.Context, repoProvider core.RepositoryProvider, args []string) ([]string, error) {
+	var registered []string
+	routes := []string{}
+	seen := map[string]bool{}
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[\\") {
+			if !seen[arg] {
+				seen[arg] = true
+				routes = append(routes, arg)
+			}
+			continue
+		}
+
+		if _, err := path.Match(arg, ""); err != nil {
+			return nil, fmt.Errorf("invalid route pattern '%s': %w", arg, err)
+		}
+		if registered == nil {
+			repos, err := repoProvider.GetRepositories(ctx)
+			if err != nil {
+				return nil, err
+			}
+			registered = make([]string, 0, len(repos))
+			for route := range repos {
+				registered = append(registered, route)
+			}
+			sort.Strings(registered)
+		}
+
+		matched := false
+		for _, route := range registered {
+			if ok, _ := path.Match(arg, route); ok {
+				matched = true
+				if !seen[route] {
+					seen[route] = true
+					routes = append(routes, route)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("route pattern '%s' does not match any route", arg)
+		}
+	}
+
+	return routes, nil
 }
 
 func (u *updateCmd) Run(ctx context.Context, args []string) error {
-	parser := argparse.NewArgParser(u.logger, "git-bundle-server update <route>")
-	route := parser.PositionalString("route", "the route to update", true)
+	parser := argparse.NewArgParser(u.logger, "git-bundle-server update [--no-wait] [--base] <route>...")
+	noWait := parser.Bool("no-wait", false, "skip the update (rather than waiting) if the route is already being updated")
+	base := parser.Bool("base", false, "replace the bundle list with a single new base bundle, rather than adding an incremental bundle")
+	routeArgs := parser.PositionalList("route", "the routes (or route patterns, e.g. 'org/*') to update", true)
 	parser.Parse(ctx, args)
 
+	if err := checkWritable(ctx, u.logger, u.container); err != nil {
+		return err
+	}
+
 	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, u.container)
-	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, u.container)
+	routes, err := resolveRoutes(ctx, repoProvider, *routeArgs)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+	u.logger.Data(ctx, "update", "routes", len(routes))
+
+	// Update each route in turn; a failed update doesn't stop the others.
+	reports := make([]routeUpdateReport, 0, len(routes))
+	failed := []string{}
+	failureCodes := []int{}
+	var lastErr error
+	for _, route := range routes {
+		if len(routes) > 1 {
+			output.Printf("*** Updating %s ***\n", route)
+		}
+
+		startTime := time.Now()
+		result, err := u.updateRoute(ctx, route, *noWait, *base)
+
+		report := routeUpdateReport{Route: route, Duration: time.Since(startTime).Seconds()}
+		switch {
+		case err != nil:
+			report.Status = routeFailed
+			report.Error = err.Error()
+			report.ExitCode = utils.ExitCode(err)
+			failed = append(failed, route)
+			failureCodes = append(failureCodes, report.ExitCode)
+			lastErr = err
+		case result == nil:
+			report.Status = routeSkipped
+		default:
+			report.Status = routeUpdated
+			report.RefsFetched = result.RefsFetched
+			report.BundlesCreated = result.BundlesCreated
+		}
+		reports = append(reports, report)
+		u.logger.AddToCounter(ctx, "update", report.Status, 1)
 
-	repo, err := repoProvider.CreateRepository(ctx, *route)
+		if len(routes) > 1 {
+			if err != nil {
+				output.Printf("Failed to update %s: %s\n", route, err)
+			}
+			output.Printf("\n")
+		}
+	}
+
+	// The progress messages describe the updates well enough, so there's no
+	// additional text output.
+	err = output.Result(reports, func(w io.Writer) {})
 	if err != nil {
 		return u.logger.Error(ctx, err)
 	}
 
+	if len(routes) == 1 {
+		return lastErr
+	} else if len(failed) > 0 {
+		return utils.WithExitCode(utils.CommonExitCode(failureCodes),
+			u.logger.Errorf(ctx, "%d of %d routes failed to update: %s",
+				len(failed), len(routes), strings.Join(failed, ", ")))
+	}
+	return nil
+}
+
+// updateRoute updates the given route, unless it is disabled or it is already
+// being updated and 'noWait' is true, and returns the result of the update (or
+// nil if it was skipped). If 'base' is true, the route's bundles are replaced
+// with a new base bundle (see 'rebaseRepo').
+func (u *updateCmd) updateRoute(ctx context.Context, route string, noWait bool, base bool) (*core.UpdateResult, error) {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+	appLogger := utils.GetDependency[log.AppLogger](ctx, u.container)
+
+	// Only registered routes are updated ('CreateRepository' would register
+	// an unknown route instead).
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return nil, u.logger.Error(ctx, err)
+	}
+	if _, contains := repos[route]; !contains {
+		return nil, u.logger.Error(ctx, &core.RouteNotFoundError{Route: route})
+	}
+
+	repo, err := repoProvider.CreateRepository(ctx, route)
+	if err != nil {
+		return nil, u.logger.Error(ctx, err)
+	}
+
+	if repo.Disabled {
+		output.Printf("Skipping update of %s: the route is disabled\n", repo.Route)
+		return nil, nil
+	}
+
+	// Only one process may update the repository at a time; either wait for
+	// any in-progress update to finish or skip this one.
+	lock, acquired, err := repoProvider.LockForUpdate(ctx, repo, false)
+	if err != nil {
+		return nil, u.logger.Error(ctx, err)
+	} else if !acquired {
+		if noWait {
+			output.Printf("Skipping update of %s: another update is already in progress\n", repo.Route)
+			return nil, nil
+		}
+
+		output.Printf("Waiting for another update of %s to finish...\n", repo.Route)
+		lock, _, err = repoProvider.LockForUpdate(ctx, repo, true)
+		if err != nil {
+			return nil, u.logger.Error(ctx, err)
+		}
+	}
+	defer lock.Unlock()
+
+	// A replica mirrors the bundles of its primary rather than fetching from
+	// the route's remote.
+	client, err := newReplicaClient(ctx, u.container)
+	if err != nil {
+		return nil, u.logger.Error(ctx, err)
+	}
+	if client != nil && base {
+		return nil, u.logger.Errorf(ctx, "cannot regenerate the base bundle of a replica; run '--base' on the primary instead")
+	}
+
+	// Record the time the update started (rather than finished) so the
+	// update schedule isn't shifted by the duration of the update.
+	startTime := time.Now()
+
+	// Publish the progress of the update while it runs
+	ctx, clearProgress := startProgress(ctx, repoProvider, repo, startTime)
+	defer clearProgress()
+
+	// The outcome of the previous update, to count consecutive failures
+	previous, err := repoProvider.GetLastUpdateResult(ctx, repo)
+	if err != nil {
+		return nil, u.logger.Errorf(ctx, "failed to get last update result: %w", err)
+	}
+
+	// Record the outcome of the update, whether or not it succeeded
+	result := &core.UpdateResult{Time: startTime}
+	var updateErr error
+	if client != nil {
+		setUpdatePhase(ctx, core.UpdatePhaseSync)
+		updateErr = u.syncRepo(ctx, client, repo, result)
+	} else if base {
+		updateErr = u.rebaseRepo(ctx, repo, result)
+	} else {
+		updateErr = u.updateRepo(ctx, repo, result)
+	}
+	result.Duration = time.Since(startTime)
+	if updateErr != nil {
+		result.Error = updateErr.Error()
+		result.ConsecutiveFailures = consecutiveFailures(previous) + 1
+	}
+	err = repoProvider.RecordUpdateResult(ctx, repo, result)
+	notifyUpdateResult(ctx, u.container, repo, previous, result)
+	if updateErr != nil {
+		appLogger.Errorf(ctx, "Update of %s failed: %s", repo.Route, updateErr)
+		return result, updateErr
+	} else if err != nil {
+		return result, u.logger.Errorf(ctx, "failed to record update result: %w", err)
+	}
+
+	err = repoProvider.RecordUpdate(ctx, repo, startTime)
+	if err != nil {
+		return result, u.logger.Errorf(ctx, "failed to record update time: %w", err)
+	}
+
+	// The primary maintains the repository and enforces its quota; the
+	// replica's bundles only ever match the primary's.
+	if client != nil {
+		appLogger.Infof(ctx, "Synced %s from primary in %s (%d bundles downloaded)",
+			repo.Route, result.Duration.Round(time.Millisecond), result.BundlesCreated)
+		return result, nil
+	}
+
+	// Run maintenance once the repository's maintenance interval has elapsed,
+	// while still holding the update lock.
+	lastMaintenance, err := repoProvider.GetLastMaintenanceTime(ctx, repo)
+	if err != nil {
+		return result, u.logger.Error(ctx, err)
+	}
+	if repo.IsMaintenanceDue(lastMaintenance, startTime) {
+		setUpdatePhase(ctx, core.UpdatePhaseMaintenance)
+		err = maintainRepo(ctx, u.logger, u.container, repo)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// Record the disk usage after the update, reclaiming space if the update
+	// pushed the route over its quota. The update itself succeeded, so a
+	// route that is still over its quota only blocks its next update.
+	err = enforceQuota(ctx, u.logger, u.container, repo)
+	if isQuotaExceeded(err) {
+		output.Printf("Warning: %s; it will not be updated until its disk usage is reduced or its quota is raised\n", err)
+		appLogger.Warnf(ctx, "Route %s exceeds its quota: %s", repo.Route, err)
+	} else if err != nil {
+		return result, err
+	}
+
+	appLogger.Infof(ctx, "Updated %s in %s (%d refs fetched, %d bundles created)",
+		repo.Route, result.Duration.Round(time.Millisecond), result.RefsFetched, result.BundlesCreated)
+	return result, nil
+}
+
+// countChangedRefs returns the number of refs that were created, updated, or
+// deleted between the 'before' and 'after' ref name to object ID mappings.
+func countChangedRefs(before map[string]string, after map[string]string) int {
+	count := 0
+	for ref, oid := range after {
+		if before[ref] != oid {
+			count++
+		}
+	}
+	for ref := range before {
+		if _, exists := after[ref]; !exists {
+			count++
+		}
+	}
+	return count
+}
+
+// findRewrittenRefs returns the refs (sorted by name) that were updated by a
+// non-fast-forward change between the 'before' and 'after' ref name to object
+// ID mappings, e.g. because they were force-pushed on the remote. Created and
+// deleted refs are not rewritten.
+func findRewrittenRefs(ctx context.Context, gitHelper git.GitHelper, repoDir string,
+	before map[string]string, after map[string]string,
+) ([]string, error) {
+	rewritten := []string{}
+	for ref, oid := range after {
+		oldOid, existed := before[ref]
+		if !existed || oldOid == oid {
+			continue
+		}
+
+		isAncestor, err := gitHelper.IsAncestor(ctx, repoDir, oldOid, oid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check history of '%s': %w", ref, err)
+		}
+		if !isAncestor {
+			rewritten = append(rewritten, ref)
+		}
+	}
+	sort.Strings(rewritten)
+	return rewritten, nil
+}
+
+// updateRepo fetches the latest content of the repository and creates a new
+// bundle from it, filling in the details of 'result' as it goes.
+func (u *updateCmd) updateRepo(ctx context.Context, repo *core.Repository, result *core.UpdateResult) error {
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, u.container)
+	gitHelper := utils.GetDependency[git.GitHelper](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+	appLogger := utils.GetDependency[log.AppLogger](ctx, u.container)
+
+	// A route that exceeds its quota (even after reclaiming space) must not
+	// grow any further.
+	err := enforceQuota(ctx, u.logger, u.container, repo)
+	if err != nil {
+		return err
+	}
+
 	list, err := bundleProvider.GetBundleList(ctx, repo)
 	if err != nil {
 		return u.logger.Errorf(ctx, "failed to load bundle list: %w", err)
 	}
 
-	fmt.Printf("Checking for updates to %s\n", repo.Route)
+	refsBefore, err := gitHelper.GetBranches(ctx, repo.RepoDir)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+
+	output.Printf("Checking for updates to %s\n", repo.Route)
+	setUpdatePhase(ctx, core.UpdatePhaseFetch)
 	bundle, err := bundleProvider.CreateIncrementalBundle(ctx, repo, list)
 	if err != nil {
 		return u.logger.Error(ctx, err)
 	}
 
+	refsAfter, err := gitHelper.GetBranches(ctx, repo.RepoDir)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+	result.RefsFetched = countChangedRefs(refsBefore, refsAfter)
+	output.Verbosef("Fetched %d changed refs\n", result.RefsFetched)
+
+	headChanged, err := u.updateHead(ctx, repo, list)
+	if err != nil {
+		return err
+	}
+
+	// If the remote's history was rewritten, the existing bundles (and the new
+	// incremental bundle, whose prerequisites are their tips) carry history
+	// that no longer exists upstream, so the bundle list starts over from a
+	// new base bundle. The discarded incremental bundle is never listed, and
+	// is left for 'prune' to remove.
+	rewritten, err := findRewrittenRefs(ctx, gitHelper, repo.RepoDir, refsBefore, refsAfter)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+	if len(rewritten) > 0 {
+		result.RewrittenRefs = rewritten
+		output.Printf("History of %s was rewritten upstream (%s); regenerating its base bundle\n",
+			repo.Route, strings.Join(rewritten, ", "))
+		appLogger.Warnf(ctx, "History of %s was rewritten upstream (%s); regenerating its base bundle",
+			repo.Route, strings.Join(rewritten, ", "))
+		return u.replaceBundles(ctx, repo, list, result)
+	}
+
 	// Nothing new!
 	if bundle == nil {
-		fmt.Printf("%s is up-to-date, no new bundles generated\n", repo.Route)
-		return nil
+		output.Printf("%s is up-to-date, no new bundles generated\n", repo.Route)
+		if headChanged {
+			setUpdatePhase(ctx, core.UpdatePhaseList)
+			listErr := bundleProvider.WriteBundleList(ctx, list, repo)
+			if listErr != nil {
+				return u.logger.Errorf(ctx, "failed to write bundle list: %w", listErr)
+			}
+		}
+		return u.applyRetention(ctx, repo, list)
 	}
 
 	list.Bundles[bundle.CreationToken] = *bundle
+	result.BundlesCreated++
+	output.Verbosef("Created bundle %s\n", bundle.Filename)
 
-	fmt.Println("Updating bundle list")
+	output.Printf("Compacting bundle list\n")
+	bundleCount := len(list.Bundles)
 	err = bundleProvider.CollapseList(ctx, repo, list)
 	if err != nil {
 		return u.logger.Error(ctx, err)
 	}
+	if len(list.Bundles) < bundleCount {
+		output.Printf("Merged %d bundles into %d\n", bundleCount, len(list.Bundles))
+	}
 
-	fmt.Println("Writing updated bundle list")
+	output.Printf("Writing updated bundle list\n")
+	setUpdatePhase(ctx, core.UpdatePhaseList)
 	listErr := bundleProvider.WriteBundleList(ctx, list, repo)
 	if listErr != nil {
 		return u.logger.Errorf(ctx, "failed to write bundle list: %w", listErr)
 	}
 
-	fmt.Println("Update complete")
+	err = u.applyRetention(ctx, repo, list)
+	if err != nil {
+		return err
+	}
+
+	output.Printf("Update complete\n")
+	return nil
+}
+
+// rebaseRepo fetches the latest content of the repository and replaces its
+// bundle list with a single new base bundle, e.g. after the remote's history
+// was rewritten or the incremental bundles have grown too many. The new list
+// is written in one step; the previous bundles are left for 'prune' (or the
+// retention policy) to remove.
+func (u *updateCmd) rebaseRepo(ctx context.Context, repo *core.Repository, result *core.UpdateResult) error {
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, u.container)
+	gitHelper := utils.GetDependency[git.GitHelper](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+
+	err := enforceQuota(ctx, u.logger, u.container, repo)
+	if err != nil {
+		return err
+	}
+
+	list, err := bundleProvider.GetBundleList(ctx, repo)
+	if err != nil {
+		return u.logger.Errorf(ctx, "failed to load bundle list: %w", err)
+	}
+
+	refsBefore, err := gitHelper.GetBranches(ctx, repo.RepoDir)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+
+	output.Printf("Fetching the latest content of %s\n", repo.Route)
+	err = gitHelper.UpdateBareRepo(ctx, repo.RepoDir, repo.RemoteConfig(), !repo.NoPrune)
+	if err != nil {
+		return u.logger.Errorf(ctx, "failed to fetch updates to repo: %w", err)
+	}
+
+	refsAfter, err := gitHelper.GetBranches(ctx, repo.RepoDir)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+	result.RefsFetched = countChangedRefs(refsBefore, refsAfter)
+	output.Verbosef("Fetched %d changed refs\n", result.RefsFetched)
+
+	_, err = u.updateHead(ctx, repo, list)
+	if err != nil {
+		return err
+	}
+
+	return u.replaceBundles(ctx, repo, list, result)
+}
+
+// updateHead points the HEAD of the repository at the remote's default branch
+// and records it in 'list' (which is not written), returning whether it
+// changed. If the remote's default branch is unknown, the recorded one is
+// kept.
+func (u *updateCmd) updateHead(ctx context.Context, repo *core.Repository, list *bundles.BundleList) (bool, error) {
+	gitHelper := utils.GetDependency[git.GitHelper](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+
+	head, err := gitHelper.UpdateHead(ctx, repo.RepoDir, repo.RemoteConfig())
+	if err != nil {
+		return false, u.logger.Errorf(ctx, "failed to update HEAD: %w", err)
+	}
+	if head == "" || head == list.Head {
+		return false, nil
+	}
+
+	if list.Head != "" {
+		output.Printf("Default branch of %s changed from %s to %s\n", repo.Route, list.Head, head)
+	}
+	list.Head = head
+	return true, nil
+}
+
+// replaceBundles replaces the bundle list of the repository with a single new
+// base bundle of its current content, leaving the previous bundles for 'prune'
+// (or the retention policy) to remove. 'list' must be the repository's current
+// bundle list.
+func (u *updateCmd) replaceBundles(ctx context.Context, repo *core.Repository, list *bundles.BundleList, result *core.UpdateResult) error {
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+
+	output.Printf("Creating new base bundle\n")
+	previous := len(list.Bundles)
+	list, err := bundleProvider.Rebase(ctx, repo, list)
+	if err != nil {
+		return u.logger.Errorf(ctx, "failed to regenerate base bundle: %w", err)
+	}
+	result.BundlesCreated++
+	if previous > 0 {
+		output.Printf("Replaced %d bundle(s) with the new base bundle; run 'git-bundle-server prune %s' to remove them\n",
+			previous, repo.Route)
+	}
+
+	err = u.applyRetention(ctx, repo, list)
+	if err != nil {
+		return err
+	}
+
+	output.Printf("Update complete\n")
+	return nil
+}
+
+// syncRepo replaces the bundles of the repository with those of the replica's
+// primary, counting the downloaded bundles as created in 'result'.
+func (u *updateCmd) syncRepo(ctx context.Context, client *replica.Client, repo *core.Repository, result *core.UpdateResult) error {
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+
+	output.Printf("Syncing %s from primary\n", repo.Route)
+	sync, err := replica.SyncBundles(ctx, client, bundleProvider, repo)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+	result.BundlesCreated = sync.Downloaded
+
+	for _, file := range sync.Deleted {
+		output.Verbosef("Deleted %s\n", file)
+	}
+	if sync.Downloaded == 0 && len(sync.Deleted) == 0 {
+		output.Printf("%s is up-to-date with the primary\n", repo.Route)
+	} else {
+		output.Printf("Downloaded %d bundle(s) (%d bytes), deleted %d bundle file(s)\n",
+			sync.Downloaded, sync.DownloadedBytes, len(sync.Deleted))
+	}
+	return nil
+}
+
+// applyRetention removes the bundles of the repository that exceed its
+// retention policy. 'list' must be the repository's current bundle list.
+func (u *updateCmd) applyRetention(ctx context.Context, repo *core.Repository, list *bundles.BundleList) error {
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+
+	retention, err := bundleProvider.ApplyRetention(ctx, repo, list)
+	if err != nil {
+		return u.logger.Errorf(ctx, "failed to apply retention policy: %w", err)
+	}
+
+	if retention.Rebased {
+		output.Printf("Replaced bundle list with a new base bundle to satisfy the retention policy\n")
+	}
+	for _, file := range retention.DeletedFiles {
+		output.Verbosef("Deleted %s\n", file)
+	}
+	if len(retention.DeletedFiles) > 0 {
+		output.Printf("Deleted %d bundle file(s), reclaiming %d bytes\n",
+			len(retention.DeletedFiles), retention.ReclaimedBytes)
+	}
+
 	return nil
 }
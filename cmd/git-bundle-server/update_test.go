@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var resolveRoutesTests = []struct {
+	title string
+
+	// Inputs
+	args []string
+
+	// Expected values
+	expectedRoutes []string
+	expectedCalls  int
+	expectErr      string
+}{
+	{
+		"Routes are used as-is",
+		[]string{"org/b", "unregistered/repo"},
+		[]string{"org/b", "unregistered/repo"},
+		0,
+		"",
+	},
+	{
+		"Pattern is expanded to the matching routes, sorted",
+		[]string{"org/*"},
+		[]string{"org/a", "org/b"},
+		1,
+		"",
+	},
+	{
+		"Routes are included once",
+		[]string{"org/b", "org/*", "*/a", "org/b"},
+		[]string{"org/b", "org/a"},
+		1,
+		"",
+	},
+	{
+		"Character class patterns are expanded",
+		[]string{"other/[rs]epo", "org/?"},
+		[]string{"other/repo", "org/a", "org/b"},
+		1,
+		"",
+	},
+	{
+		"Invalid pattern",
+		[]string{"org/["},
+		nil,
+		0,
+		"invalid route pattern 'org/['",
+	},
+	{
+		"Pattern matching no route",
+		[]string{"org/a", "missing/*"},
+		nil,
+		1,
+		"route pattern 'missing/*' does not match any route",
+	},
+}
+
+func TestResolveRoutes(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range resolveRoutesTests {
+		t.Run(tt.title, func(t *testing.T) {
+			repoProvider := &MockRepositoryProvider{}
+			repoProvider.On("GetRepositories", mock.Anything).Return(map[string]core.Repository{
+				"org/b":      {Route: "org/b"},
+				"org/a":      {Route: "org/a"},
+				"other/repo": {Route: "other/repo"},
+			}, nil)
+
+			routes, err := resolveRoutes(ctx, repoProvider, tt.args)
+			if tt.expectErr != "" {
+				assert.ErrorContains(t, err, tt.expectErr)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedRoutes, routes)
+			}
+
+			// The registered routes are only read (once) if needed
+			repoProvider.AssertNumberOfCalls(t, "GetRepositories", tt.expectedCalls)
+		})
+	}
+
+	t.Run("Registry read failure", func(t *testing.T) {
+		repoProvider := &MockRepositoryProvider{}
+		repoProvider.On("GetRepositories", mock.Anything).Return(nil, errors.New("failed to read routes"))
+
+		_, err := resolveRoutes(ctx, repoProvider, []string{"org/*"})
+		assert.ErrorContains(t, err, "failed to read routes")
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed by 'url-rewrite --json'.
+type urlRewriteResult struct {
+	URLRewrites []git.URLRewrite `json:"urlRewrites"`
+}
+
+type urlRewriteCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewURLRewriteCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &urlRewriteCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (urlRewriteCmd) Name() string {
+	return "url-rewrite"
+}
+
+func (urlRewriteCmd) Description() string {
+	return `
+Display or configure the server-wide rules rewriting the URLs of the routes'
+remotes when they are cloned and fetched, like Git's 'url.<base>.insteadOf'.
+A remote URL starting with '<prefix>' is fetched from '<base>' followed by the
+rest of the URL instead; the URL stored with the route is unchanged.`
+}
+
+func (u *urlRewriteCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(u.logger, "git-bundle-server url-rewrite [--add <base> --instead-of <prefix> | --remove <prefix> | --clear]")
+	add := parser.String("add", "", "the base (e.g. 'https://mirror.example.com/') replacing the prefix")
+	insteadOf := parser.String("instead-of", "", "the prefix (e.g. 'https://github.com/') of the URLs rewritten by '--add'")
+	remove := parser.String("remove", "", "remove the rule rewriting URLs starting with the given prefix")
+	clearAll := parser.Bool("clear", false, "remove all rules")
+	parser.Parse(ctx, args)
+
+	actions := 0
+	for _, set := range []bool{*add != "", *remove != "", *clearAll} {
+		if set {
+			actions++
+		}
+	}
+	if actions > 1 {
+		parser.Usage(ctx, "Only one of '--add', '--remove', and '--clear' can be used.")
+	}
+	if (*add != "") != (*insteadOf != "") {
+		parser.Usage(ctx, "'--add' and '--instead-of' must be used together.")
+	}
+
+	newRewrite := git.URLRewrite{Base: *add, InsteadOf: *insteadOf}
+	if *add != "" {
+		if err := newRewrite.Validate(); err != nil {
+			parser.Usage(ctx, "Invalid URL rewrite: %s", err)
+		}
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, u.container)
+	gitHelper := utils.GetDependency[git.GitHelper](ctx, u.container)
+	output := utils.GetDependency[utils.Output](ctx, u.container)
+
+	rewrites, err := repoProvider.GetServerURLRewrites(ctx)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+
+	if actions == 0 {
+		// Nothing to configure, just print the current rules (redacting
+		// the credentials in their bases)
+		result := urlRewriteResult{URLRewrites: []git.URLRewrite{}}
+		for _, rewrite := range rewrites {
+			result.URLRewrites = append(result.URLRewrites, git.URLRewrite{
+				Base:      core.RedactURL(rewrite.Base),
+				InsteadOf: rewrite.InsteadOf,
+			})
+		}
+		err = output.Result(result, func(w io.Writer) {
+			if len(result.URLRewrites) == 0 {
+				fmt.Fprintln(w, "No URL rewrite rules are configured")
+			}
+			for _, rewrite := range result.URLRewrites {
+				fmt.Fprintf(w, "%s -> %s\n", rewrite.InsteadOf, rewrite.Base)
+			}
+		})
+		if err != nil {
+			return u.logger.Error(ctx, err)
+		}
+		return nil
+	}
+
+	updated := []git.URLRewrite{}
+	if !*clearAll {
+		// A prefix is rewritten by at most one rule, so adding a rule for a
+		// prefix replaces the existing one
+		removed := false
+		for _, rewrite := range rewrites {
+			if rewrite.InsteadOf == *remove || rewrite.InsteadOf == *insteadOf {
+				removed = true
+				continue
+			}
+			updated = append(updated, rewrite)
+		}
+
+		if *remove != "" && !removed {
+			return u.logger.Errorf(ctx, "no rule rewrites URLs starting with '%s'", *remove)
+		}
+		if *add != "" {
+			updated = append(updated, newRewrite)
+			sort.Slice(updated, func(i, j int) bool { return updated[i].InsteadOf < updated[j].InsteadOf })
+		}
+	}
+
+	err = repoProvider.SetServerURLRewrites(ctx, updated)
+	if err != nil {
+		return u.logger.Errorf(ctx, "failed to write routes: %w", err)
+	}
+
+	// Show where each route is now fetched from, if it is rewritten
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return u.logger.Error(ctx, err)
+	}
+
+	routes := make([]string, 0, len(repos))
+	for route := range repos {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	for _, route := range routes {
+		remote, err := gitHelper.GetRemoteUrl(ctx, repos[route].RepoDir)
+		if err != nil {
+			// Replicas and routes that are not cloned have no remote
+			continue
+		}
+		if fetchURL := git.RewriteURL(remote, updated); fetchURL != remote {
+			output.Printf("%s: %s\n", route, core.RedactURL(fetchURL))
+		}
+	}
+
+	return nil
+}
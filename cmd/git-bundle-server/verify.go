@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The information printed for each route by 'verify --json'.
+type verifyResult struct {
+	Route string `json:"route"`
+	Valid bool   `json:"valid"`
+
+	// The number of bundles in the route's bundle list.
+	Bundles int `json:"bundles"`
+
+	// The problems found with the route's bundles.
+	Errors []string `json:"errors"`
+}
+
+type verifyCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewVerifyCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &verifyCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (verifyCmd) Name() string {
+	return "verify"
+}
+
+func (verifyCmd) Description() string {
+	return `
+Check that every bundle in the bundle list of '<route>' (or of every route, if
+no route is specified) exists on disk and is a valid bundle of the route's
+repository. With '--integrity', also check that the content of each bundle
+still matches the checksum recorded when it was created.`
+}
+
+// verifyRoute verifies the bundles in the bundle list of the given route. If
+// 'integrity' is true, the checksum of each bundle is also checked.
+func (v *verifyCmd) verifyRoute(ctx context.Context, repo *core.Repository, integrity bool) (verifyResult, error) {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, v.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, v.container)
+	output := utils.GetDependency[utils.Output](ctx, v.container)
+
+	result := verifyResult{Route: repo.Route, Errors: []string{}}
+
+	// Wait for any in-progress update so that the bundle list and the bundles
+	// on disk are consistent.
+	lock, _, err := repoProvider.LockForUpdate(ctx, repo, true)
+	if err != nil {
+		return result, err
+	}
+	defer lock.Unlock()
+
+	list, err := bundleProvider.GetBundleList(ctx, repo)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to load bundle list: %s", err))
+		return result, nil
+	}
+
+	tokens := make([]int64, 0, len(list.Bundles))
+	for token := range list.Bundles {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i] < tokens[j] })
+	result.Bundles = len(tokens)
+
+	for _, token := range tokens {
+		bundle := list.Bundles[token]
+		err := bundleProvider.VerifyBundle(ctx, repo, bundle)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("invalid bundle %s: %s", bundle.Filename, err))
+			continue
+		}
+
+		if !integrity {
+			continue
+		} else if bundle.Checksum == "" {
+			output.Printf("%s: no checksum recorded for %s, skipping integrity check\n", repo.Route, bundle.Filename)
+			continue
+		}
+
+		checksum, err := bundleProvider.ComputeChecksum(ctx, bundle)
+		if err != nil {
+			return result, err
+		}
+		if checksum != bundle.Checksum {
+			result.Errors = append(result.Errors, fmt.Sprintf("checksum mismatch for %s: expected %s, got %s",
+				bundle.Filename, bundle.Checksum, checksum))
+		}
+	}
+
+	return result, nil
+}
+
+func (v *verifyCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(v.logger, "git-bundle-server verify [--integrity] [<route>]")
+	integrity := parser.Bool("integrity", false, "check the bundles against their recorded checksums")
+	route := parser.PositionalString("route", "the route to verify", false)
+	parser.Parse(ctx, args)
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, v.container)
+	output := utils.GetDependency[utils.Output](ctx, v.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return v.logger.Error(ctx, err)
+	}
+
+	routes := []string{}
+	if *route != "" {
+		if _, contains := repos[*route]; !contains {
+			return v.logger.Error(ctx, &core.RouteNotFoundError{Route: *route})
+		}
+		routes = append(routes, *route)
+	} else {
+		for name := range repos {
+			routes = append(routes, name)
+		}
+		sort.Strings(routes)
+	}
+
+	results := make([]verifyResult, 0, len(routes))
+	failed := 0
+	for _, name := range routes {
+		repo := repos[name]
+		result, err := v.verifyRoute(ctx, &repo, *integrity)
+		if err != nil {
+			return v.logger.Errorf(ctx, "failed to verify '%s': %w", name, err)
+		}
+		result.Valid = len(result.Errors) == 0
+		if !result.Valid {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	err = output.Result(results, func(w io.Writer) {
+		for _, result := range results {
+			for _, message := range result.Errors {
+				fmt.Fprintf(w, "%s: %s\n", result.Route, message)
+			}
+			if result.Valid {
+				fmt.Fprintf(w, "%s: OK (%d bundles)\n", result.Route, result.Bundles)
+			}
+		}
+	})
+	if err != nil {
+		return v.logger.Error(ctx, err)
+	}
+
+	if failed > 0 {
+		return v.logger.Errorf(ctx, "%d of %d routes failed verification", failed, len(routes))
+	}
+
+	return nil
+}
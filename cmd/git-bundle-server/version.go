@@ -3,12 +3,24 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
+	"runtime"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/buildinfo"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
 )
 
+// The information printed by 'version --json'. Build information that is
+// unknown (e.g. when built with 'go build') is empty.
+type versionResult struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
 type versionCmd struct {
 	logger    log.TraceLogger
 	container *utils.DependencyContainer
@@ -27,19 +39,27 @@ func (versionCmd) Name() string {
 
 func (versionCmd) Description() string {
 	return `
-Display the version information for the bundle server CLI.`
+Display the version information for the bundle server CLI: its version, the
+commit and time it was built from, and the version of Go it was built with.`
 }
 
 func (v *versionCmd) Run(ctx context.Context, args []string) error {
 	parser := argparse.NewArgParser(v.logger, "git-bundle-server version")
 	parser.Parse(ctx, args)
 
-	versionStr := utils.Version
-	if versionStr == "" {
-		versionStr = "<no version>"
+	output := utils.GetDependency[utils.Output](ctx, v.container)
+	result := versionResult{
+		Version:   buildinfo.Version,
+		Commit:    buildinfo.Commit,
+		BuildDate: buildinfo.BuildDate,
+		GoVersion: runtime.Version(),
+	}
+	err := output.Result(result, func(w io.Writer) {
+		fmt.Fprint(w, buildinfo.Describe("git-bundle-server"))
+	})
+	if err != nil {
+		return v.logger.Error(ctx, err)
 	}
-
-	fmt.Printf("git-bundle-server version %s\n", versionStr)
 
 	return nil
 }
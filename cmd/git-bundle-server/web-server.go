@@ -4,11 +4,22 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
 	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
 )
@@ -19,18 +30,73 @@ type webServerCmd struct {
 }
 
 func NewWebServerCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
-	return &webServerCmd{
+	w := &webServerCmd{
 		logger:    logger,
 		container: container,
 	}
+
+	return argparse.NewSubcommandGroup(logger, "web-server",
+		`Manage the web server hosting bundle content`,
+		"git-bundle-server web-server (start|stop|restart|status|logs) <options>",
+		argparse.NewSubcommand("start", "Start the web server", w.startServer),
+		argparse.NewSubcommand("stop", "Stop the web server", w.stopServer),
+		argparse.NewSubcommand("restart", "Restart the web server with its current configuration", w.restartServer),
+		argparse.NewSubcommand("status", "Display whether the web server is configured and running", w.serverStatus),
+		argparse.NewSubcommand("logs", "Display the logs of the web server", w.serverLogs),
+	)
 }
 
-func (webServerCmd) Name() string {
-	return "web-server"
+// The information printed by 'web-server status --json'.
+type webServerStatusResult struct {
+	Installed bool `json:"installed"`
+	Running   bool `json:"running"`
+
+	// The daemon manager's description of the web server's state.
+	State string `json:"state"`
+
+	// The process ID and start time of the running web server, and how long
+	// it has been running (in seconds). Nil if the web server is not running
+	// or the daemon manager does not report them.
+	PID       *int       `json:"pid"`
+	StartTime *time.Time `json:"startTime"`
+	Uptime    *float64   `json:"uptime"`
+
+	// The exit code of the last run of the web server, or nil if it has not
+	// exited (or the daemon manager does not report it).
+	LastExitCode *int `json:"lastExitCode"`
+
+	// The file to which the daemon manager writes the output of the web
+	// server, if any.
+	LogPath string `json:"logPath"`
 }
 
-func (webServerCmd) Description() string {
-	return `Manage the web server hosting bundle content`
+// The service account as which a system-level web server daemon runs by
+// default.
+const defaultSystemUser string = "git-bundle-server"
+
+// The usage of the '--system' flag of each subcommand.
+const systemFlagUsage string = "Manage the system-level web server daemon (see 'start --system') " +
+	"rather than the current user's"
+
+// daemonProvider returns the provider of the web server daemon: the current
+// user's daemon manager or, if 'system' is true, the system's (running the web
+// server as 'systemUser').
+func (w *webServerCmd) daemonProvider(ctx context.Context, system bool, systemUser string) (daemon.DaemonProvider, error) {
+	if !system {
+		return utils.GetDependency[daemon.DaemonProvider](ctx, w.container), nil
+	}
+
+	d, err := daemon.NewSystemDaemonProvider(
+		ctx,
+		w.logger,
+		utils.GetDependency[cmd.CommandExecutor](ctx, w.container),
+		utils.GetDependency[common.FileSystem](ctx, w.container),
+		systemUser,
+	)
+	if err != nil {
+		return nil, utils.WithExitCode(utils.ExitDaemonFailed, w.logger.Error(ctx, err))
+	}
+	return d, nil
 }
 
 func (w *webServerCmd) getDaemonConfig(ctx context.Context) (*daemon.DaemonConfig, error) {
@@ -50,37 +116,91 @@ func (w *webServerCmd) getDaemonConfig(ctx context.Context) (*daemon.DaemonConfi
 
 func (w *webServerCmd) startServer(ctx context.Context, args []string) error {
 	// Parse subcommand arguments
-	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server start [-f|--force]")
+	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server start [-f|--force] [--foreground] "+
+		"[--system [--system-user <user>]] [--socket-activation] "+
+		"[--restart-policy (never|on-failure|always)] [--env <key>=<value>]... "+
+		"[--limit-open-files <n>] [--limit-memory <size>]")
 
 	// Args for 'git-bundle-server web-server start'
 	force := parser.Bool("force", false, "Force reconfiguration of the web server daemon")
-	parser.BoolVar(force, "f", false, "Alias of --force")
+	parser.Alias("force", "f")
+	foreground := parser.Bool("foreground", false, "Run the web server in the current process rather than as a daemon")
+	system := parser.Bool("system", false, "Install the web server as a system-level daemon (systemd, OpenRC, or launchd only), "+
+		"started at boot and run as a dedicated service account; requires root")
+	systemUser := parser.String("system-user", defaultSystemUser, "The service account as which the system-level "+
+		"web server daemon runs")
+	socketActivation := parser.Bool("socket-activation", false, "Have the daemon manager (systemd only) listen on the "+
+		"web server's port, so that connections are not refused while the web server restarts")
+	restartPolicy := parser.Enum("restart-policy", "on-failure", []string{"never", "on-failure", "always"},
+		"When the daemon manager restarts the web server after it exits: 'never', 'on-failure' "+
+			"(if it crashes or fails), or 'always'")
+
+	environment := parser.KeyValue("env", "Set an environment variable of the web server, as 'KEY=VALUE' "+
+		"(may be given multiple times)")
+	openFiles := parser.IntRange("limit-open-files", 0, 0, math.MaxInt, "The maximum number of files "+
+		"(including connections) the web server daemon may have open (0 for the system default)")
+	memory := parser.ByteSize("limit-memory", 0, "The maximum memory the web server daemon may use (e.g. '2G'; 0 for no limit)")
 
 	// Arguments passed through to 'git-bundle-web-server'
 	webServerFlags, validate := utils.WebServerFlags(parser)
 	webServerFlags.VisitAll(func(f *flag.Flag) {
 		parser.Var(f.Value, f.Name, fmt.Sprintf("[Web server] %s", f.Usage))
 	})
+	logFlags, _ := utils.AppLogFlags(parser)
+	logFlags.VisitAll(func(f *flag.Flag) {
+		parser.Var(f.Value, f.Name, fmt.Sprintf("[Web server] %s", f.Usage))
+	})
 
 	parser.Parse(ctx, args)
 	validate(ctx)
-
-	d := utils.GetDependency[daemon.DaemonProvider](ctx, w.container)
+	if *socketActivation && *foreground {
+		parser.Usage(ctx, "'--socket-activation' cannot be used with '--foreground'.")
+	}
+	if *socketActivation && runtime.GOOS != "linux" {
+		parser.Usage(ctx, "'--socket-activation' is only supported with systemd.")
+	}
+	if *system && *foreground {
+		parser.Usage(ctx, "'--system' cannot be used with '--foreground'.")
+	}
+	if *systemUser == "" {
+		parser.Usage(ctx, "'--system-user' cannot be empty.")
+	}
 
 	config, err := w.getDaemonConfig(ctx)
 	if err != nil {
 		return w.logger.Error(ctx, err)
 	}
+	if *restartPolicy != "never" {
+		config.RestartPolicy = daemon.RestartPolicy(*restartPolicy)
+	}
+	config.Environment = *environment
+	config.Limits = daemon.ResourceLimits{
+		OpenFiles: *openFiles,
+		Memory:    *memory,
+	}
+	if *socketActivation {
+		config.SocketPort, err = strconv.Atoi(webServerFlags.Lookup("port").Value.String())
+		if err != nil {
+			return w.logger.Errorf(ctx, "invalid port: %w", err)
+		}
+	}
 
 	// Configure flags
 	loopErr := error(nil)
 	parser.Visit(func(f *flag.Flag) {
-		if webServerFlags.Lookup(f.Name) != nil {
+		if webServerFlags.Lookup(f.Name) != nil || logFlags.Lookup(f.Name) != nil {
 			value := f.Value.String()
 			if f.Name == "cert" ||
 				f.Name == "key" ||
 				f.Name == "client-ca" ||
-				f.Name == "auth-config" {
+				f.Name == "auth-config" ||
+				f.Name == "cache-config" ||
+				f.Name == "vhost-config" ||
+				f.Name == "webhook-secret-file" ||
+				f.Name == "admin-token-file" ||
+				f.Name == "log-file" ||
+				(f.Name == "audit-log" && !strings.Contains(value, "://")) ||
+				f.Name == "config" {
 
 				// Need the absolute value of the path
 				value, err = filepath.Abs(value)
@@ -103,14 +223,86 @@ func (w *webServerCmd) startServer(ctx context.Context, args []string) error {
 		return w.logger.Error(ctx, loopErr)
 	}
 
+	// Serve content from the same storage locations as this process
+	config.Arguments = append(config.Arguments, utils.StorageRootArgs()...)
+
+	if *foreground {
+		return w.runForeground(ctx, config)
+	}
+
+	if *system {
+		err = w.configureSystemDaemon(ctx, config, parser.IsSet("config"))
+		if err != nil {
+			return w.logger.Error(ctx, err)
+		}
+	}
+
+	d, err := w.daemonProvider(ctx, *system, *systemUser)
+	if err != nil {
+		return err
+	}
+
 	err = d.Create(ctx, config, *force)
 	if err != nil {
-		return w.logger.Error(ctx, err)
+		return utils.WithExitCode(utils.ExitDaemonFailed, w.logger.Error(ctx, err))
 	}
 
 	err = d.Start(ctx, config.Label)
 	if err != nil {
-		return w.logger.Error(ctx, err)
+		return utils.WithExitCode(utils.ExitDaemonFailed, w.logger.Error(ctx, err))
+	}
+
+	return nil
+}
+
+// configureSystemDaemon points a system-level web server daemon at the system
+// locations: its storage root defaults to 'core.SystemRoot' (rather than a
+// directory in the home directory of the service account), and it reads its
+// options from 'web-server.json' in 'core.SystemConfigDir', if that file
+// exists and no other is given with '--config'.
+func (w *webServerCmd) configureSystemDaemon(ctx context.Context, config *daemon.DaemonConfig, hasConfigFile bool) error {
+	if os.Getenv(core.RootEnvVar) == "" {
+		config.Arguments = append(config.Arguments, fmt.Sprintf("--root=%s", core.SystemRoot))
+	}
+
+	if !hasConfigFile {
+		fileSystem := utils.GetDependency[common.FileSystem](ctx, w.container)
+		configFile := filepath.Join(core.SystemConfigDir, "web-server.json")
+		exists, err := fileSystem.FileExists(configFile)
+		if err != nil {
+			return fmt.Errorf("could not determine whether '%s' exists: %w", configFile, err)
+		} else if exists {
+			config.Arguments = append(config.Arguments, "--config", configFile)
+		}
+	}
+
+	return nil
+}
+
+// runForeground runs the web server as a child of the current process (e.g. as
+// the entrypoint of a container), bypassing the daemon provider. Termination
+// signals are forwarded to the web server so that it shuts down gracefully.
+func (w *webServerCmd) runForeground(ctx context.Context, config *daemon.DaemonConfig) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	cmdExec := utils.GetDependency[cmd.CommandExecutor](ctx, w.container)
+	env := make([]string, 0, len(config.Environment))
+	for key, value := range config.Environment {
+		env = append(env, key+"="+value)
+	}
+
+	exitCode, err := cmdExec.Run(ctx, config.Program, config.Arguments,
+		cmd.Env(env),
+		cmd.Stdout(os.Stdout),
+		cmd.Stderr(os.Stderr),
+		cmd.ForwardSignals(signals),
+	)
+	if err != nil {
+		return w.logger.Errorf(ctx, "failed to run web server: %w", err)
+	} else if exitCode != 0 {
+		return w.logger.Errorf(ctx, "web server exited with status %d", exitCode)
 	}
 
 	return nil
@@ -118,11 +310,15 @@ func (w *webServerCmd) startServer(ctx context.Context, args []string) error {
 
 func (w *webServerCmd) stopServer(ctx context.Context, args []string) error {
 	// Parse subcommand arguments
-	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server stop [--remove]")
+	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server stop [--remove] [--system]")
 	remove := parser.Bool("remove", false, "Remove the web server daemon configuration from the system after stopping")
+	system := parser.Bool("system", false, systemFlagUsage)
 	parser.Parse(ctx, args)
 
-	d := utils.GetDependency[daemon.DaemonProvider](ctx, w.container)
+	d, err := w.daemonProvider(ctx, *system, defaultSystemUser)
+	if err != nil {
+		return err
+	}
 
 	config, err := w.getDaemonConfig(ctx)
 	if err != nil {
@@ -131,25 +327,151 @@ func (w *webServerCmd) stopServer(ctx context.Context, args []string) error {
 
 	err = d.Stop(ctx, config.Label)
 	if err != nil {
-		return w.logger.Error(ctx, err)
+		return utils.WithExitCode(utils.ExitDaemonFailed, w.logger.Error(ctx, err))
 	}
 
 	if *remove {
 		err = d.Remove(ctx, config.Label)
 		if err != nil {
-			return w.logger.Error(ctx, err)
+			return utils.WithExitCode(utils.ExitDaemonFailed, w.logger.Error(ctx, err))
+		}
+	}
+
+	return nil
+}
+
+func (w *webServerCmd) restartServer(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server restart [--system]")
+	system := parser.Bool("system", false, systemFlagUsage)
+	parser.Parse(ctx, args)
+
+	d, err := w.daemonProvider(ctx, *system, defaultSystemUser)
+	if err != nil {
+		return err
+	}
+
+	config, err := w.getDaemonConfig(ctx)
+	if err != nil {
+		return w.logger.Error(ctx, err)
+	}
+
+	// Only restart a configured web server, so that it keeps its options;
+	// restarting an unconfigured one would start it without any.
+	status, err := d.Status(ctx, config.Label)
+	if err != nil {
+		return utils.WithExitCode(utils.ExitDaemonFailed, w.logger.Error(ctx, err))
+	} else if !status.Installed {
+		return utils.WithExitCode(utils.ExitDaemonFailed,
+			w.logger.Errorf(ctx, "the web server is not configured; use 'web-server start' instead"))
+	}
+
+	err = d.Restart(ctx, config.Label)
+	if err != nil {
+		return utils.WithExitCode(utils.ExitDaemonFailed, w.logger.Error(ctx, err))
+	}
+
+	return nil
+}
+
+func (w *webServerCmd) serverStatus(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server status [--system]")
+	system := parser.Bool("system", false, systemFlagUsage)
+	parser.Parse(ctx, args)
+
+	d, err := w.daemonProvider(ctx, *system, defaultSystemUser)
+	if err != nil {
+		return err
+	}
+	output := utils.GetDependency[utils.Output](ctx, w.container)
+
+	config, err := w.getDaemonConfig(ctx)
+	if err != nil {
+		return w.logger.Error(ctx, err)
+	}
+
+	status, err := d.Status(ctx, config.Label)
+	if err != nil {
+		return utils.WithExitCode(utils.ExitDaemonFailed, w.logger.Error(ctx, err))
+	}
+
+	result := webServerStatusResult{
+		Installed:    status.Installed,
+		Running:      status.Running,
+		State:        status.State,
+		LastExitCode: status.LastExitCode,
+		LogPath:      status.LogPath,
+	}
+	if status.PID != 0 {
+		result.PID = &status.PID
+	}
+	if !status.StartTime.IsZero() {
+		uptime := status.Uptime(time.Now()).Seconds()
+		result.StartTime = &status.StartTime
+		result.Uptime = &uptime
+	}
+
+	err = output.Result(result, func(out io.Writer) {
+		switch {
+		case status.Running:
+			fmt.Fprintln(out, "The web server is running")
+		case status.Installed:
+			fmt.Fprintln(out, "The web server is configured, but not running")
+		default:
+			fmt.Fprintln(out, "The web server is not configured")
+			return
 		}
+
+		if status.State != "" {
+			fmt.Fprintf(out, "State: %s\n", status.State)
+		}
+		if status.PID != 0 {
+			fmt.Fprintf(out, "PID: %d\n", status.PID)
+		}
+		if !status.StartTime.IsZero() {
+			fmt.Fprintf(out, "Started: %s (up %s)\n", formatTime(status.StartTime),
+				status.Uptime(time.Now()).Round(time.Second))
+		}
+		if status.LastExitCode != nil {
+			fmt.Fprintf(out, "Last exit code: %d\n", *status.LastExitCode)
+		}
+		if status.LogPath != "" {
+			fmt.Fprintf(out, "Log: %s\n", status.LogPath)
+		}
+	})
+	if err != nil {
+		return w.logger.Error(ctx, err)
 	}
 
 	return nil
 }
 
-func (w *webServerCmd) Run(ctx context.Context, args []string) error {
-	// Parse command arguments
-	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server (start|stop) <options>")
-	parser.Subcommand(argparse.NewSubcommand("start", "Start the web server", w.startServer))
-	parser.Subcommand(argparse.NewSubcommand("stop", "Stop the web server", w.stopServer))
+func (w *webServerCmd) serverLogs(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server logs [-n|--lines <n>] [-f|--follow] [--system]")
+	lines := parser.Int("lines", 100, "The number of the most recent lines of the logs to display")
+	parser.Alias("lines", "n")
+	follow := parser.Bool("follow", false, "Keep displaying new lines of the logs as they are written")
+	parser.Alias("follow", "f")
+	system := parser.Bool("system", false, systemFlagUsage)
 	parser.Parse(ctx, args)
 
-	return parser.InvokeSubcommand(ctx)
+	if *lines < 0 {
+		parser.Usage(ctx, "Invalid number of lines '%d'.", *lines)
+	}
+
+	d, err := w.daemonProvider(ctx, *system, defaultSystemUser)
+	if err != nil {
+		return err
+	}
+
+	config, err := w.getDaemonConfig(ctx)
+	if err != nil {
+		return w.logger.Error(ctx, err)
+	}
+
+	err = d.Logs(ctx, config.Label, daemon.LogOptions{Lines: *lines, Follow: *follow}, os.Stdout)
+	if err != nil {
+		return utils.WithExitCode(utils.ExitDaemonFailed, w.logger.Error(ctx, err))
+	}
+
+	return nil
 }
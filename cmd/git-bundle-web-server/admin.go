@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/admin"
+	"github.com/git-ecosystem/git-bundle-server/internal/buildinfo"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/jobs"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/replica"
+)
+
+const (
+	adminPathPrefix string = admin.PathPrefix
+
+	// Admin requests only carry a route; anything larger than this is
+	// rejected.
+	maxAdminRequestSize int64 = 4096
+)
+
+type adminHandler struct {
+	logger    log.TraceLogger
+	appLogger log.AppLogger
+	container *utils.DependencyContainer
+	token     []byte
+
+	// The sources of the web server's activity: its background updates and
+	// the requests it answered since it started.
+	updater   *routeUpdater
+	requests  *requestStats
+	startedAt time.Time
+}
+
+func newAdminHandler(logger log.TraceLogger,
+	appLogger log.AppLogger,
+	container *utils.DependencyContainer,
+	tokenFile string,
+	updater *routeUpdater,
+) (*adminHandler, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read admin token: %w", err)
+	}
+	token = []byte(strings.TrimSpace(string(token)))
+	if len(token) == 0 {
+		return nil, fmt.Errorf("admin token is empty")
+	}
+
+	return &adminHandler{
+		logger:    logger,
+		appLogger: appLogger,
+		container: container,
+		token:     token,
+		updater:   updater,
+		requests:  newRequestStats(),
+		startedAt: time.Now(),
+	}, nil
+}
+
+// validateToken checks the bearer token in the 'Authorization' header.
+func (h *adminHandler) validateToken(r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), h.token) == 1
+}
+
+func (h *adminHandler) getStatus(ctx context.Context) ([]admin.RouteStatus, error) {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, h.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]admin.RouteStatus, 0, len(repos))
+	for _, repo := range repos {
+		repo := repo
+
+		lastResult, err := repoProvider.GetLastUpdateResult(ctx, &repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get last update result for '%s': %w", repo.Route, err)
+		}
+
+		status := admin.RouteStatus{
+			Route:      repo.Route,
+			Disabled:   repo.Disabled,
+			LastUpdate: lastResult,
+		}
+
+		lastSuccess, err := repoProvider.GetLastUpdateTime(ctx, &repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get last update time for '%s': %w", repo.Route, err)
+		} else if !lastSuccess.IsZero() {
+			status.LastSuccessfulUpdate = &lastSuccess
+		}
+
+		status.Progress, err = repoProvider.GetUpdateProgress(ctx, &repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get update progress for '%s': %w", repo.Route, err)
+		}
+
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Route < statuses[j].Route })
+
+	return statuses, nil
+}
+
+// getActivity reports the live state of the web server.
+func (h *adminHandler) getActivity(ctx context.Context) *admin.Activity {
+	now := time.Now()
+	activity := &admin.Activity{
+		Version:               buildinfo.Version,
+		StartedAt:             h.startedAt,
+		Updates:               h.updater.InProgress(),
+		ReadOnly:              h.updater.ReadOnly(),
+		RequestsLastMinute:    h.requests.recent(now, time.Minute),
+		RequestsLast15Minutes: h.requests.recent(now, 15*time.Minute),
+		RequestsTotal:         h.requests.totals(),
+	}
+	h.addUpdateProgress(ctx, activity.Updates)
+	return activity
+}
+
+// addUpdateProgress fills in the progress recorded by the given updates. The
+// progress is informational, so failing to read it is only logged.
+func (h *adminHandler) addUpdateProgress(ctx context.Context, updates []admin.Update) {
+	if len(updates) == 0 {
+		return
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, h.container)
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		h.appLogger.Warnf(ctx, "Failed to read update progress: %s", err)
+		return
+	}
+
+	for i := range updates {
+		repo, exists := repos[updates[i].Route]
+		if !exists {
+			continue
+		}
+		updates[i].Progress, err = repoProvider.GetUpdateProgress(ctx, &repo)
+		if err != nil {
+			h.appLogger.Warnf(ctx, "Failed to read update progress of %s: %s", repo.Route, err)
+		}
+	}
+}
+
+// getRoutes lists the routes mirrored by replicas of this server (see
+// 'git-bundle-server replica').
+func (h *adminHandler) getRoutes(ctx context.Context) ([]replica.Route, error) {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, h.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]replica.Route, 0, len(repos))
+	for _, repo := range repos {
+		repo := repo
+		routes = append(routes, replica.NewRoute(&repo))
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Route < routes[j].Route })
+
+	return routes, nil
+}
+
+func (h *adminHandler) serve(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ctx, exitRegion := h.logger.Region(ctx, "http", "admin")
+	defer exitRegion()
+
+	if !h.validateToken(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		h.appLogger.Warnf(ctx, "Rejected admin request with invalid token")
+		return
+	}
+
+	endpoint := strings.TrimPrefix(r.URL.Path, adminPathPrefix)
+	switch endpoint {
+	case "status":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		statuses, err := h.getStatus(ctx)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			h.appLogger.Errorf(ctx, "Failed to get route status: %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(statuses)
+	case "activity":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(h.getActivity(ctx))
+	case "routes":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		routes, err := h.getRoutes(ctx)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			h.appLogger.Errorf(ctx, "Failed to list routes: %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(routes)
+	case "jobs":
+		switch r.Method {
+		case http.MethodGet:
+			h.listJobs(w, r)
+		case http.MethodPost:
+			h.queueUpdate(w, r)
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case "read-only":
+		switch r.Method {
+		case http.MethodGet:
+			h.getReadOnly(w, r)
+		case http.MethodPost:
+			h.setReadOnly(w, r)
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// listJobs responds with the jobs in the queue of background updates.
+func (h *adminHandler) listJobs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	jobList, err := h.updater.queue.List(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.appLogger.Errorf(ctx, "Failed to list jobs: %s", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(jobList)
+}
+
+// queueUpdate queues an update of the route in the request (an
+// admin.UpdateRequest) with the highest priority, responding with the job.
+func (h *adminHandler) queueUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request admin.UpdateRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminRequestSize)).Decode(&request)
+	if err != nil || request.Route == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, h.container)
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.appLogger.Errorf(ctx, "Failed to list routes: %s", err)
+		return
+	}
+	if _, contains := repos[request.Route]; !contains {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	job, queued, err := h.updater.StartUpdate(ctx, request.Route, "admin", jobs.PriorityHigh)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.appLogger.Errorf(ctx, "Failed to queue update for %s: %s", request.Route, err)
+		return
+	}
+
+	if queued {
+		h.appLogger.Infof(ctx, "Queued admin-requested update of %s", request.Route)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// getReadOnly responds with the read-only mode of the bundle server.
+func (h *adminHandler) getReadOnly(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, h.container)
+	mode, err := repoProvider.GetReadOnlyMode(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.appLogger.Errorf(ctx, "Failed to get read-only mode: %s", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(admin.NewReadOnlyStatus(mode))
+}
+
+// setReadOnly turns the read-only mode of the bundle server on or off as in the
+// request (an admin.ReadOnlyRequest), responding with the resulting mode.
+// Turning it on pauses the background updates once the running ones complete.
+func (h *adminHandler) setReadOnly(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request admin.ReadOnlyRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminRequestSize)).Decode(&request)
+	if err != nil || (!request.Enabled && request.Reason != "") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, h.container)
+	mode, err := repoProvider.GetReadOnlyMode(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.appLogger.Errorf(ctx, "Failed to get read-only mode: %s", err)
+		return
+	}
+
+	if !request.Enabled {
+		mode = nil
+	} else if mode == nil {
+		mode = &core.ReadOnlyMode{Since: time.Now(), Reason: request.Reason}
+	} else {
+		// Keep the original start time if only the reason changes
+		mode.Reason = request.Reason
+	}
+
+	err = repoProvider.SetReadOnlyMode(ctx, mode)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.appLogger.Errorf(ctx, "Failed to set read-only mode: %s", err)
+		return
+	}
+
+	if mode != nil {
+		h.appLogger.Infof(ctx, "Turned on read-only mode on admin request")
+	} else {
+		h.appLogger.Infof(ctx, "Turned off read-only mode on admin request")
+	}
+
+	// Pause or resume the background updates without waiting for the next
+	// check of the queue
+	h.updater.runner.Notify()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(admin.NewReadOnlyStatus(mode))
+}
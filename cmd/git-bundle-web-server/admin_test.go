@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/jobs"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+var adminValidationTests = []struct {
+	title string
+
+	method  string
+	path    string
+	headers map[string]string
+
+	expectedCode int
+}{
+	{
+		"Missing token is rejected",
+		http.MethodGet,
+		"/-/admin/status",
+		map[string]string{},
+		http.StatusUnauthorized,
+	},
+	{
+		"Invalid token is rejected",
+		http.MethodGet,
+		"/-/admin/status",
+		map[string]string{"Authorization": "Bearer wrong-token"},
+		http.StatusUnauthorized,
+	},
+	{
+		"Non-bearer authorization is rejected",
+		http.MethodGet,
+		"/-/admin/status",
+		map[string]string{"Authorization": "Basic my-token"},
+		http.StatusUnauthorized,
+	},
+	{
+		"Unknown endpoint is not found",
+		http.MethodGet,
+		"/-/admin/unknown",
+		map[string]string{"Authorization": "Bearer my-token"},
+		http.StatusNotFound,
+	},
+	{
+		"Status endpoint only allows GET",
+		http.MethodPost,
+		"/-/admin/status",
+		map[string]string{"Authorization": "Bearer my-token"},
+		http.StatusMethodNotAllowed,
+	},
+	{
+		"Activity endpoint only allows GET",
+		http.MethodPost,
+		"/-/admin/activity",
+		map[string]string{"Authorization": "Bearer my-token"},
+		http.StatusMethodNotAllowed,
+	},
+	{
+		"Activity endpoint is available",
+		http.MethodGet,
+		"/-/admin/activity",
+		map[string]string{"Authorization": "Bearer my-token"},
+		http.StatusOK,
+	},
+	{
+		"Routes endpoint only allows GET",
+		http.MethodDelete,
+		"/-/admin/routes",
+		map[string]string{"Authorization": "Bearer my-token"},
+		http.StatusMethodNotAllowed,
+	},
+	{
+		"Jobs endpoint only allows GET and POST",
+		http.MethodDelete,
+		"/-/admin/jobs",
+		map[string]string{"Authorization": "Bearer my-token"},
+		http.StatusMethodNotAllowed,
+	},
+	{
+		"Jobs endpoint lists the queue",
+		http.MethodGet,
+		"/-/admin/jobs",
+		map[string]string{"Authorization": "Bearer my-token"},
+		http.StatusOK,
+	},
+	{
+		"Queueing an update requires a route",
+		http.MethodPost,
+		"/-/admin/jobs",
+		map[string]string{"Authorization": "Bearer my-token"},
+		http.StatusBadRequest,
+	},
+	{
+		"Read-only endpoint only allows GET and POST",
+		http.MethodDelete,
+		"/-/admin/read-only",
+		map[string]string{"Authorization": "Bearer my-token"},
+		http.StatusMethodNotAllowed,
+	},
+	{
+		"Setting the read-only mode requires a body",
+		http.MethodPost,
+		"/-/admin/read-only",
+		map[string]string{"Authorization": "Bearer my-token"},
+		http.StatusBadRequest,
+	},
+}
+
+func TestAdminHandler(t *testing.T) {
+	logger := &MockTraceLogger{}
+	queue := jobs.NewJobQueue(logger, common.NewFileSystem(), filepath.Join(t.TempDir(), "jobs.json"))
+	handler := &adminHandler{
+		logger:    logger,
+		appLogger: log.NopAppLogger(),
+		token:     []byte("my-token"),
+		updater:   newRouteUpdater(logger, log.NopAppLogger(), nil, queue, 1),
+		requests:  newRequestStats(),
+	}
+
+	for _, tt := range adminValidationTests {
+		t.Run(tt.title, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+
+			handler.serve(w, r)
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+const (
+	// How often the audit events are sent to an HTTP sink, and how many
+	// events are sent at once at most.
+	auditFlushInterval time.Duration = 5 * time.Second
+	auditBatchSize     int           = 500
+
+	// The maximum number of events kept while an HTTP sink is unavailable;
+	// the oldest events are dropped beyond it.
+	auditMaxPending int = 100000
+
+	auditPostTimeout time.Duration = 30 * time.Second
+)
+
+// auditEvent records a bundle download, written to the audit log as a line of
+// JSON.
+type auditEvent struct {
+	Time      time.Time `json:"time"`
+	RequestId string    `json:"requestId,omitempty"`
+	ClientIP  string    `json:"clientIp"`
+
+	// The authenticated identity of the client (see 'requestPrincipal'), if
+	// any.
+	Principal string `json:"principal,omitempty"`
+
+	Host   string `json:"host,omitempty"`
+	Method string `json:"method"`
+	Route  string `json:"route"`
+	Bundle string `json:"bundle"`
+
+	// The status of the response. A '302 Found' response redirected the
+	// client to download the bundle elsewhere (e.g. from a CDN or its
+	// storage backend).
+	Status    int    `json:"status"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// requestPrincipal returns the authenticated identity of the client: the
+// username of the HTTP Basic credentials accepted by the auth middleware, or
+// the subject of the client's verified certificate. Returns an empty string if
+// the client is anonymous (or authenticated otherwise, e.g. with a token).
+func requestPrincipal(r *http.Request, authorized bool) string {
+	if username, _, ok := r.BasicAuth(); authorized && ok && username != "" {
+		return username
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return r.TLS.VerifiedChains[0][0].Subject.String()
+	}
+	return ""
+}
+
+// auditLog records the bundle downloads served by the web server as NDJSON,
+// either appended to a file or sent in batches to an HTTP endpoint (with a
+// 'POST' request per batch).
+type auditLog struct {
+	appLogger log.AppLogger
+
+	lock sync.Mutex
+
+	// The file to which events are appended, if the sink is a file.
+	file *os.File
+
+	// The endpoint to which events are sent, if the sink is an HTTP URL, and
+	// the encoded events not yet sent.
+	url     string
+	client  *http.Client
+	pending [][]byte
+	dropped int
+	stop    chan struct{}
+	done    sync.WaitGroup
+}
+
+// isAuditLogURL returns whether the audit log target is the URL of an HTTP
+// sink, rather than the path of a file.
+func isAuditLogURL(target string) bool {
+	u, err := url.Parse(target)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// newAuditLog opens the audit log at the given target: an 'http' or 'https'
+// URL, or the path of a file (created if needed).
+func newAuditLog(ctx context.Context, appLogger log.AppLogger, target string) (*auditLog, error) {
+	a := &auditLog{appLogger: appLogger}
+
+	if isAuditLogURL(target) {
+		a.url = target
+		a.client = &http.Client{Timeout: auditPostTimeout}
+		a.stop = make(chan struct{})
+
+		a.done.Add(1)
+		go func() {
+			defer a.done.Done()
+			ticker := time.NewTicker(auditFlushInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-a.stop:
+					a.flush(ctx)
+					return
+				case <-ticker.C:
+					a.flush(ctx)
+				}
+			}
+		}()
+		return a, nil
+	}
+
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log: %w", err)
+	}
+	a.file = file
+	return a, nil
+}
+
+// record writes the event to the audit log. Events are written to a file
+// right away, and queued for an HTTP sink.
+func (a *auditLog) record(ctx context.Context, event auditEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		a.appLogger.Errorf(ctx, "Failed to encode audit event: %s", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.file != nil {
+		_, err = a.file.Write(line)
+		if err != nil {
+			a.appLogger.Errorf(ctx, "Failed to write audit event: %s", err)
+		}
+		return
+	}
+
+	if len(a.pending) >= auditMaxPending {
+		a.pending = a.pending[1:]
+		a.dropped++
+	}
+	a.pending = append(a.pending, line)
+}
+
+// flush sends the pending events to the HTTP sink, in batches of at most
+// 'auditBatchSize' events. Events that fail to send are kept for the next
+// flush.
+func (a *auditLog) flush(ctx context.Context) {
+	for {
+		a.lock.Lock()
+		if a.dropped > 0 {
+			a.appLogger.Warnf(ctx, "Dropped %d audit events because the audit log endpoint is unavailable", a.dropped)
+			a.dropped = 0
+		}
+		count := len(a.pending)
+		if count > auditBatchSize {
+			count = auditBatchSize
+		}
+		batch := a.pending[:count]
+		a.pending = a.pending[count:]
+		a.lock.Unlock()
+
+		if count == 0 {
+			return
+		}
+
+		err := a.post(bytes.Join(batch, nil))
+		if err != nil {
+			a.appLogger.Warnf(ctx, "Failed to send %d audit events: %s", count, err)
+
+			// Put the batch back in front of the events queued meanwhile.
+			a.lock.Lock()
+			a.pending = append(append([][]byte{}, batch...), a.pending...)
+			if excess := len(a.pending) - auditMaxPending; excess > 0 {
+				a.pending = a.pending[excess:]
+				a.dropped += excess
+			}
+			a.lock.Unlock()
+			return
+		}
+	}
+}
+
+func (a *auditLog) post(body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("endpoint returned '%s'", resp.Status)
+	}
+	return nil
+}
+
+// Close sends the pending events (to an HTTP sink) and closes the audit log.
+func (a *auditLog) Close() {
+	if a.stop != nil {
+		close(a.stop)
+		a.done.Wait()
+	}
+	if a.file != nil {
+		a.file.Close()
+	}
+}
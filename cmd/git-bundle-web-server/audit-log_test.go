@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func readAuditEvents(t *testing.T, r io.Reader) []auditEvent {
+	events := []auditEvent{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var event auditEvent
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestAuditLog_File(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "audit.log")
+
+	audit, err := newAuditLog(ctx, log.NopAppLogger(), filename)
+	assert.Nil(t, err)
+	audit.record(ctx, auditEvent{ClientIP: "10.0.0.1", Route: "test/repo", Bundle: "bundle-1.bundle", Status: 200})
+	audit.record(ctx, auditEvent{ClientIP: "10.0.0.2", Route: "test/repo", Bundle: "bundle-2.bundle", Status: 302})
+	audit.Close()
+
+	// Events are appended to an existing log
+	audit, err = newAuditLog(ctx, log.NopAppLogger(), filename)
+	assert.Nil(t, err)
+	audit.record(ctx, auditEvent{ClientIP: "10.0.0.3", Route: "test/repo", Bundle: "bundle-1.bundle", Status: 304})
+	audit.Close()
+
+	file, err := os.Open(filename)
+	assert.Nil(t, err)
+	defer file.Close()
+	events := readAuditEvents(t, file)
+	assert.Len(t, events, 3)
+	assert.Equal(t, "10.0.0.1", events[0].ClientIP)
+	assert.Equal(t, "bundle-2.bundle", events[1].Bundle)
+	assert.Equal(t, 304, events[2].Status)
+}
+
+func TestAuditLog_HTTP(t *testing.T) {
+	ctx := context.Background()
+
+	lock := sync.Mutex{}
+	received := []auditEvent{}
+	available := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		received = append(received, readAuditEvents(t, r.Body)...)
+	}))
+	defer server.Close()
+
+	audit, err := newAuditLog(ctx, log.NopAppLogger(), server.URL+"/audit")
+	assert.Nil(t, err)
+	audit.record(ctx, auditEvent{ClientIP: "10.0.0.1", Route: "test/repo", Bundle: "bundle-1.bundle", Status: 200})
+
+	// Events that fail to send are kept
+	audit.flush(ctx)
+	assert.Empty(t, received)
+	assert.Len(t, audit.pending, 1)
+
+	lock.Lock()
+	available = true
+	lock.Unlock()
+	audit.record(ctx, auditEvent{ClientIP: "10.0.0.2", Route: "test/repo", Bundle: "bundle-2.bundle", Status: 200})
+	audit.Close()
+
+	assert.Len(t, received, 2)
+	assert.Equal(t, "bundle-1.bundle", received[0].Bundle)
+	assert.Equal(t, "bundle-2.bundle", received[1].Bundle)
+	assert.Empty(t, audit.pending)
+}
+
+func TestRequestPrincipal(t *testing.T) {
+	t.Run("Anonymous", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/test/repo/bundle-1.bundle", nil)
+		assert.Equal(t, "", requestPrincipal(r, false))
+	})
+
+	t.Run("Basic auth is only trusted if authorized", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/test/repo/bundle-1.bundle", nil)
+		r.SetBasicAuth("octocat", "secret")
+		assert.Equal(t, "octocat", requestPrincipal(r, true))
+		assert.Equal(t, "", requestPrincipal(r, false))
+	})
+
+	t.Run("Client certificate", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/test/repo/bundle-1.bundle", nil)
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ci-runner", Organization: []string{"Example"}}}
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		principal := requestPrincipal(r, false)
+		assert.True(t, strings.Contains(principal, "CN=ci-runner"), principal)
+	})
+}
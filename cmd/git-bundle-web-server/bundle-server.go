@@ -1,21 +1,28 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/buildinfo"
 	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
-	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
 	"github.com/git-ecosystem/git-bundle-server/internal/core"
 	"github.com/git-ecosystem/git-bundle-server/internal/git"
@@ -26,37 +33,258 @@ import (
 type authFunc func(*http.Request, string, string) auth.AuthResult
 
 type bundleWebServer struct {
-	logger             log.TraceLogger
-	server             *http.Server
-	serverWaitGroup    *sync.WaitGroup
-	listenAndServeFunc func() error
-	authorize          authFunc
+	logger          log.TraceLogger
+	appLogger       log.AppLogger
+	container       *utils.DependencyContainer
+	server          *http.Server
+	serverWaitGroup *sync.WaitGroup
+	serveFunc       func(net.Listener) error
+	reusePort       bool
+	http3Server     http3Server
+	authorize       authFunc
+	cacheConfig     *cacheConfig
+
+	// The base URL to which bundle downloads are redirected (e.g. a CDN
+	// serving the contents of the web directory). If empty, bundles are
+	// served by this server (or redirected to their storage backend).
+	redirectBaseURL string
+
+	// The path (e.g. '/bundles') under which the server is mounted behind a
+	// reverse proxy, stripped from requests before their routes are resolved
+	// and included in the paths the server sends to clients. Empty if the
+	// server is mounted at the root.
+	pathPrefix string
+
+	// The virtual hosts served with their own routes and storage, instead of
+	// the server's own (see 'forRequest').
+	virtualHosts virtualHosts
+
+	// The routes (of the server's own storage roots) found to be broken, and
+	// whether requests for them are answered with '503 Service Unavailable'
+	// (rather than the '404 Not Found' of the missing files).
+	routeHealth             *routeHealth
+	unavailableBrokenRoutes bool
+
+	// Route patterns (as in 'path.Match') for which a verified client
+	// certificate is required. If empty and a client CA is configured, the
+	// certificate is required for all connections at the TLS layer.
+	clientCARoutes []string
+
+	// The log recording each bundle download (see '--audit-log'), if any,
+	// and how the IP address of the client is determined for it.
+	auditLog *auditLog
+	clientIP func(*http.Request) string
+}
+
+const (
+	// The file (relative to a route) serving the creation token of the
+	// route's newest bundle (see 'serveCreationToken').
+	creationTokenFilename string = "creation-token"
+
+	// The header with the creation token of the route's newest bundle.
+	creationTokenHeader string = "X-Bundle-Creation-Token"
+
+	// The file (relative to a route) serving the metadata of the route's
+	// repository (see 'serveMetadata').
+	metadataFilename string = "metadata"
+)
+
+// The header identifying the version of the bundle server that handled a
+// request, for clients and proxies that drop or rewrite the 'Server' header.
+const versionHeader string = "X-Bundle-Server-Version"
+
+// versionHeaders wraps 'next' to identify the server (and its version) in the
+// headers of every response.
+func versionHeaders(next http.Handler) http.Handler {
+	server := buildinfo.UserAgent("git-bundle-server")
+	version := buildinfo.VersionString()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", server)
+		w.Header().Set(versionHeader, version)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The header identifying each request, given by the client (or a proxy) or
+// generated by the server, and echoed in the response so that the request can
+// be found in the server's logs.
+const requestIdHeader string = "X-Request-Id"
+
+// requestIds wraps 'next' to attribute each request (and the updates it
+// triggers) to a request ID, echoed in the response headers. A valid ID given
+// by the client is kept; otherwise, a new one is generated.
+func requestIds(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := log.NewRequestId(r.Header.Get(requestIdHeader))
+		w.Header().Set(requestIdHeader, requestId)
+		next.ServeHTTP(w, r.WithContext(log.WithRequestId(r.Context(), requestId)))
+	})
+}
+
+// normalizePathPrefix normalizes the path prefix of the server to a path with a
+// leading slash and no trailing slash (e.g. 'bundles/' to '/bundles'), or to
+// an empty string if the server is mounted at the root.
+func normalizePathPrefix(prefix string) string {
+	elements := strings.FieldsFunc(prefix, func(char rune) bool { return char == '/' })
+	if len(elements) == 0 {
+		return ""
+	}
+	return "/" + strings.Join(elements, "/")
+}
+
+// stripPathPrefix wraps 'next' to remove the path prefix (e.g. '/bundles') from
+// the path of each request. Requests for paths outside of the prefix are
+// rejected with '404 Not Found'.
+func stripPathPrefix(prefix string, next http.Handler) http.Handler {
+	if prefix == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, prefix)
+		if path == r.URL.Path || (path != "" && path[0] != '/') {
+			http.NotFound(w, r)
+			return
+		}
+		if path == "" {
+			path = "/"
+		}
+
+		stripped := r.Clone(r.Context())
+		stripped.URL.Path = path
+		stripped.URL.RawPath = ""
+		next.ServeHTTP(w, stripped)
+	})
+}
+
+// statusRecorder records the status code of the response written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(p)
+}
+
+// traceRequests wraps 'next' to attribute the trace2 events of each request to
+// a thread of its own, since requests are handled concurrently. The request
+// (and its response status) is recorded as data of the thread, timed, and
+// counted by status class (e.g. 'responses_4xx'). If the client sends a W3C
+// 'traceparent' header, the request's span continues the client's trace.
+func traceRequests(logger log.TraceLogger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := log.WithTraceParent(r.Context(), r.Header.Get("traceparent"))
+		ctx, exitThread := logger.Goroutine(ctx, "request")
+		defer exitThread()
+
+		logger.Data(ctx, "http", "request_id", log.RequestId(ctx))
+		logger.Data(ctx, "http", "method", r.Method)
+		logger.Data(ctx, "http", "path", r.URL.Path)
+		stopTimer := logger.StartTimer(ctx, "http", "request")
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		stopTimer()
+		logger.Data(ctx, "http", "status_code", recorder.status)
+		logger.AddToCounter(ctx, "http", fmt.Sprintf("responses_%dxx", recorder.status/100), 1)
+	})
 }
 
 func NewBundleWebServer(logger log.TraceLogger,
+	appLogger log.AppLogger,
+	container *utils.DependencyContainer,
 	port string,
 	certFile string, keyFile string,
 	tlsMinVersion uint16,
 	clientCAFile string,
+	clientCARoutes []string,
 	middlewareAuthorize authFunc,
+	cacheConfig *cacheConfig,
+	redirectBaseURL string,
+	pathPrefix string,
+	vhosts virtualHosts,
+	enableH2C bool,
+	enableHTTP3 bool,
+	enableCompression bool,
+	unavailableBrokenRoutes bool,
+	reusePort bool,
+	limiter *rateLimiter,
+	filter *ipFilter,
+	ipResolver *clientIPResolver,
+	webhook *webhookHandler,
+	admin *adminHandler,
+	audit *auditLog,
 ) (*bundleWebServer, error) {
 	bundleServer := &bundleWebServer{
 		logger:          logger,
+		appLogger:       appLogger,
+		container:       container,
 		serverWaitGroup: &sync.WaitGroup{},
+		reusePort:       reusePort,
 		authorize:       middlewareAuthorize,
+		cacheConfig:     cacheConfig,
+		redirectBaseURL: redirectBaseURL,
+		pathPrefix:      pathPrefix,
+		virtualHosts:    vhosts,
+
+		routeHealth:             newRouteHealth(),
+		unavailableBrokenRoutes: unavailableBrokenRoutes,
+
+		auditLog: audit,
+		clientIP: ipResolver.ClientIP,
 	}
 
 	// Configure the http.Server
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", bundleServer.serve)
+	if webhook != nil {
+		mux.HandleFunc(webhookPathPrefix, webhook.serve)
+	}
+	if admin != nil {
+		mux.HandleFunc(adminPathPrefix, admin.serve)
+	}
+	var handler http.Handler = mux
+	if enableCompression {
+		handler = compressResponses(handler)
+	}
+	handler = traceRequests(logger, stripPathPrefix(pathPrefix, handler))
+	if limiter != nil {
+		handler = limiter.Middleware(appLogger, ipResolver.ClientIP, handler)
+	}
+	if filter != nil {
+		handler = filter.Middleware(appLogger, ipResolver.ClientIP, handler)
+	}
+	if admin != nil {
+		// Count every request, including those rejected by the filters
+		handler = countRequests(admin.requests, handler)
+	}
+	handler = versionHeaders(requestIds(handler))
 	bundleServer.server = &http.Server{
-		Handler: mux,
+		Handler: handler,
 		Addr:    ":" + port,
 	}
 
 	// No TLS configuration to be done, return
 	if certFile == "" {
-		bundleServer.listenAndServeFunc = func() error { return bundleServer.server.ListenAndServe() }
+		bundleServer.serveFunc = bundleServer.server.Serve
+		err := configureHTTP2(bundleServer.server, enableH2C)
+		if err != nil {
+			return nil, err
+		}
 		return bundleServer, nil
 	}
 
@@ -65,7 +293,9 @@ func NewBundleWebServer(logger log.TraceLogger,
 		MinVersion: tlsMinVersion,
 	}
 	bundleServer.server.TLSConfig = tlsConfig
-	bundleServer.listenAndServeFunc = func() error { return bundleServer.server.ListenAndServeTLS(certFile, keyFile) }
+	bundleServer.serveFunc = func(listener net.Listener) error {
+		return bundleServer.server.ServeTLS(listener, certFile, keyFile)
+	}
 
 	if clientCAFile != "" {
 		caBytes, err := os.ReadFile(clientCAFile)
@@ -74,27 +304,148 @@ func NewBundleWebServer(logger log.TraceLogger,
 		}
 		certPool := x509.NewCertPool()
 		certPool.AppendCertsFromPEM(caBytes)
-		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
 		tlsConfig.ClientCAs = certPool
+
+		if len(clientCARoutes) == 0 {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			// Only some routes require a client certificate, so we can't
+			// reject the connection during the handshake. Instead, verify any
+			// certificate that is provided and check for it per-request.
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			bundleServer.clientCARoutes = clientCARoutes
+		}
+	}
+
+	if enableHTTP3 {
+		h3Server, err := newHTTP3Server(bundleServer.server.Addr, handler, tlsConfig, certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		bundleServer.http3Server = h3Server
+		bundleServer.server.Handler = advertiseHTTP3(port, handler)
+	}
+
+	err := configureHTTP2(bundleServer.server, enableH2C)
+	if err != nil {
+		return nil, err
 	}
 
 	return bundleServer, nil
 }
 
-func (b *bundleWebServer) parseRoute(ctx context.Context, path string) (string, string, string, error) {
+// isValidPathElement checks whether a single '/'-separated element of a request
+// path can be safely used to construct a path on disk.
+func isValidPathElement(element string) bool {
+	return element != "." &&
+		element != ".." &&
+		!strings.ContainsAny(element, "\\\x00")
+}
+
+// parseRoute splits a request path into the route and the requested file
+// (empty for the bundle list). Since routes may have any number of elements
+// (see 'core.RouteDepth'), the route is the longest prefix of the path for
+// which 'isRoute' is true, followed by at most the filename. If there is no
+// such prefix, the whole path is returned as the (unknown) route.
+func (b *bundleWebServer) parseRoute(ctx context.Context, path string, isRoute func(string) bool) (string, string, error) {
 	elements := strings.FieldsFunc(path, func(char rune) bool { return char == '/' })
-	switch len(elements) {
-	case 0:
-		return "", "", "", fmt.Errorf("empty route")
-	case 1:
-		return "", "", "", fmt.Errorf("route has owner, but no repo")
-	case 2:
-		return elements[0], elements[1], "", nil
-	case 3:
-		return elements[0], elements[1], elements[2], nil
-	default:
-		return "", "", "", fmt.Errorf("path has depth exceeding three")
+	for _, element := range elements {
+		if !isValidPathElement(element) {
+			return "", "", fmt.Errorf("invalid path element '%s'", element)
+		}
+	}
+
+	if len(elements) == 0 {
+		return "", "", fmt.Errorf("empty route")
+	}
+
+	for i := len(elements); i > 0 && i >= len(elements)-1; i-- {
+		route := strings.Join(elements[:i], "/")
+		if isRoute(route) {
+			return route, strings.Join(elements[i:], "/"), nil
+		}
+	}
+	return strings.Join(elements, "/"), "", nil
+}
+
+// splitRoute splits a route into its owner (every element but the last, empty
+// for top-level routes) and its repository name.
+func splitRoute(route string) (string, string) {
+	if i := strings.LastIndex(route, "/"); i >= 0 {
+		return route[:i], route[i+1:]
+	}
+	return "", route
+}
+
+func (b *bundleWebServer) requiresClientCert(route string) bool {
+	for _, pattern := range b.clientCARoutes {
+		if matched, _ := path.Match(pattern, route); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleRedirectURL returns the URL to which requests for the given bundle are
+// redirected, or an empty string if no redirect base URL is configured. The
+// bundle is expected at the same path relative to the base URL as it is on
+// this server.
+func (b *bundleWebServer) bundleRedirectURL(route string, filename string) string {
+	if b.redirectBaseURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(b.redirectBaseURL, "/") + "/" + route + "/" + filename
+}
+
+// checkAccess applies the client certificate and authorization requirements of
+// the route to the request. If the route is an alias, the request must also be
+// allowed to access the repository's own route, 'canonicalRoute'. If the
+// request is not allowed, the response is written and 'false' is returned.
+func (b *bundleWebServer) checkAccess(w http.ResponseWriter, r *http.Request, route string, canonicalRoute string) bool {
+	if !b.checkRouteAccess(w, r, route) {
+		return false
+	}
+	if canonicalRoute != route {
+		return b.checkRouteAccess(w, r, canonicalRoute)
+	}
+	return true
+}
+
+// checkRouteAccess applies the requirements of a single route (see
+// 'checkAccess').
+func (b *bundleWebServer) checkRouteAccess(w http.ResponseWriter, r *http.Request, route string) bool {
+	if b.requiresClientCert(route) && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		// Respond with 404 rather than 403 so we don't indirectly reveal which
+		// routes are configured in the bundle server.
+		serveError(w, http.StatusNotFound, errorRouteNotFound, route, "route not found")
+		b.appLogger.Warnf(r.Context(), "Missing verified client certificate for route %s", route)
+		return false
+	}
+
+	if b.authorize != nil {
+		owner, repo := splitRoute(route)
+		authResult := b.authorize(r, owner, repo)
+		authWriter := &authErrorWriter{ResponseWriter: w}
+		if authResult.ApplyResult(authWriter) {
+			authWriter.writeBody(route)
+			return false
+		}
+	}
+	return true
+}
+
+// renamedRouteURL returns the path (under the server's path prefix, if any) to
+// which a request for 'filename' (empty for the bundle list) in a renamed route
+// is redirected. A trailing slash in the request path is kept, since it
+// determines how relative bundle URIs in the bundle list are resolved.
+func renamedRouteURL(pathPrefix string, newRoute string, filename string, requestPath string) string {
+	redirectURL := pathPrefix + "/" + newRoute
+	if filename != "" {
+		redirectURL += "/" + filename
+	} else if strings.HasSuffix(requestPath, "/") {
+		redirectURL += "/"
 	}
+	return redirectURL
 }
 
 func (b *bundleWebServer) serve(w http.ResponseWriter, r *http.Request) {
@@ -103,99 +454,593 @@ func (b *bundleWebServer) serve(w http.ResponseWriter, r *http.Request) {
 	ctx, exitRegion := b.logger.Region(ctx, "http", "serve")
 	defer exitRegion()
 
-	path := r.URL.Path
-	owner, repo, filename, err := b.parseRoute(ctx, path)
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, b.container)
+	roots := core.StorageRoots{}
+	health := b.routeHealth
+	if vhost := b.virtualHosts.forRequest(r); vhost != nil {
+		repoProvider = vhost.repoProvider
+		roots = vhost.roots
+		health = vhost.routeHealth
+	}
+
+	repos, err := repoProvider.GetRepositories(ctx)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Printf("Failed to parse route: %s\n", err)
+		serveError(w, http.StatusInternalServerError, errorInternal, "", "internal server error")
+		b.appLogger.Errorf(ctx, "Failed to load routes: %s", err)
 		return
 	}
+	// The route may have been renamed, in which case the client is sent to
+	// the same file under the new route.
+	redirects, err := repoProvider.GetRouteRedirects(ctx)
+	if err != nil {
+		b.appLogger.Warnf(ctx, "Failed to load route redirects: %s", err)
+	}
 
-	route := owner + "/" + repo
+	path := r.URL.Path
+	route, filename, err := b.parseRoute(ctx, path, func(route string) bool {
+		_, isRegistered := core.FindRepository(repos, route)
+		_, isRedirected := redirects[route]
+		return isRegistered || isRedirected
+	})
+	if err != nil {
+		serveError(w, http.StatusNotFound, errorRouteNotFound, "", "route not found")
+		b.appLogger.Infof(ctx, "Failed to parse route: %s", err)
+		return
+	}
 
-	if b.authorize != nil {
-		authResult := b.authorize(r, owner, repo)
-		if authResult.ApplyResult(w) {
+	isPrivate := b.authorize != nil || (r.TLS != nil && len(r.TLS.VerifiedChains) > 0)
+	repository, contains := core.FindRepository(repos, route)
+	canonicalRoute := route
+	if contains {
+		canonicalRoute = repository.Route
+	}
+	if !b.checkAccess(w, r, route, canonicalRoute) {
+		return
+	}
+	if !contains {
+		if newRoute, isRedirected := redirects[route]; isRedirected {
+			redirectURL := renamedRouteURL(b.pathPrefix, newRoute, filename, path)
+			if r.URL.RawQuery != "" {
+				redirectURL += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, redirectURL, http.StatusMovedPermanently)
+			b.appLogger.Infof(ctx, "Redirecting renamed route %s to %s", route, redirectURL)
 			return
 		}
+
+		serveError(w, http.StatusNotFound, errorRouteNotFound, route, "route not found")
+		b.appLogger.Infof(ctx, "Route %s is not registered", route)
+		return
 	}
 
-	userProvider := common.NewUserProvider()
-	fileSystem := common.NewFileSystem()
-	commandExecutor := cmd.NewCommandExecutor(b.logger)
-	gitHelper := git.NewGitHelper(b.logger, commandExecutor)
-	repoProvider := core.NewRepositoryProvider(b.logger, userProvider, fileSystem, gitHelper)
+	if repository.Disabled {
+		serveError(w, http.StatusServiceUnavailable, errorRouteDisabled, route, "route is disabled")
+		b.appLogger.Infof(ctx, "Route %s is disabled", repository.Route)
+		return
+	}
 
-	repos, err := repoProvider.GetRepositories(ctx)
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, b.container)
+	if b.unavailableBrokenRoutes {
+		if problem, isBroken := health.isBroken(fileSystem, &repository); isBroken {
+			serveBrokenRoute(w, repository.Route, problem)
+			b.appLogger.Warnf(ctx, "Route %s is broken: %s", repository.Route, problem)
+			return
+		}
+	}
+
+	// The storage config is loaded for each request (rather than from the
+	// container) so that changes to it apply without restarting the server.
+	userProvider := utils.GetDependency[common.UserProvider](ctx, b.container)
+	gitHelper := utils.GetDependency[git.GitHelper](ctx, b.container)
+	storage, err := bundles.NewBundleStorage(b.logger, userProvider, roots)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Printf("Failed to load routes\n")
+		serveError(w, http.StatusInternalServerError, errorInternal, route, "internal server error")
+		b.appLogger.Errorf(ctx, "Failed to load bundle storage: %s", err)
 		return
 	}
+	// The web server only reads bundle lists, so it never needs to sign them.
+	bundleProvider := bundles.NewBundleProvider(b.logger, fileSystem, gitHelper, storage, nil)
 
-	repository, contains := repos[route]
-	if !contains {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Printf("Failed to get route out of repos\n")
+	// Bundle lists requested without a trailing slash contain bundle URIs
+	// relative to the route's owner, so they differ for aliases with another
+	// repository name.
+	_, repo := splitRoute(route)
+	_, canonicalRepo := splitRoute(repository.Route)
+	isRenamingAlias := repo != canonicalRepo
+
+	routeCacheConfig := b.cacheConfig.forRoute(repository.Route)
+	var contentType string
+	var cachePolicy cachePolicy
+
+	// The bundle being downloaded, recorded in the audit log once served.
+	var auditedBundle string
+
+	if filename == "" {
+		// The format of the bundle list depends on the 'Accept' header
+		w.Header().Add("Vary", "Accept")
+	}
+	if (filename == "" && acceptsJson(r)) || filename == bundles.BundleListJsonFilename {
+		b.serveBundleListJson(w, r, &repository, bundleProvider, routeCacheConfig.BundleList, isPrivate)
+		return
+	}
+
+	if filename == creationTokenFilename {
+		list, err := bundleProvider.GetBundleList(ctx, &repository)
+		if err != nil {
+			serveError(w, http.StatusNotFound, errorBundleListNotFound, route, "bundle list not found")
+			b.appLogger.Warnf(ctx, "Failed to load bundle list: %s", err)
+			return
+		}
+		serveCreationToken(w, r, list, routeCacheConfig.BundleList, isPrivate)
+		b.appLogger.Infof(ctx, "Successfully serving creation token for %s", route)
+		return
+	}
+
+	if filename == metadataFilename {
+		list, err := bundleProvider.GetBundleList(ctx, &repository)
+		if err != nil {
+			serveError(w, http.StatusNotFound, errorBundleListNotFound, route, "bundle list not found")
+			b.appLogger.Warnf(ctx, "Failed to load bundle list: %s", err)
+			return
+		}
+		serveMetadata(w, r, repository.Route, list, routeCacheConfig.BundleList, isPrivate)
+		b.appLogger.Infof(ctx, "Successfully serving metadata for %s", route)
 		return
 	}
 
 	var fileToServe string
 	if filename == "" {
+		contentType = bundleListContentType
+		cachePolicy = routeCacheConfig.BundleList
+
 		if path[len(path)-1] == '/' {
 			// Trailing slash, so the bundle URIs should be relative to the
 			// request's URL as if it were a directory
 			fileToServe = filepath.Join(repository.WebDir, bundles.BundleListFilename)
+		} else if isRenamingAlias {
+			b.serveAliasBundleList(w, r, route, &repository, bundleProvider, cachePolicy, isPrivate)
+			return
 		} else {
 			// No trailing slash, so the bundle URIs should be relative to the
 			// request's URL as if it were a file
 			fileToServe = filepath.Join(repository.WebDir, bundles.RepoBundleListFilename)
 		}
-	} else if filename == bundles.BundleListFilename || filename == bundles.RepoBundleListFilename {
-		// If the request identifies a non-bundle "reserved" file, return 404
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Printf("Failed to open file\n")
-		return
+	} else if filename == bundles.ChecksumManifestFilename {
+		// The manifest changes with the bundle list, so it is cached like it.
+		contentType = checksumManifestContentType
+		cachePolicy = routeCacheConfig.BundleList
+		fileToServe = filepath.Join(repository.WebDir, bundles.ChecksumManifestFilename)
+	} else if signedFile, isSignature := strings.CutSuffix(filename, bundles.SignatureSuffix); isSignature {
+		// Signatures are served from the web directory (even if the bundles
+		// are in remote storage) and cached like the file they sign.
+		contentType = signatureContentType
+		switch signedFile {
+		case bundles.RepoBundleListFilename:
+			if isRenamingAlias {
+				// The list served for this alias is generated on the fly,
+				// so it has no signature.
+				serveError(w, http.StatusNotFound, errorFileNotFound, route, "file not found")
+				b.appLogger.Infof(ctx, "Bundle list of alias %s is not signed", route)
+				return
+			}
+			cachePolicy = routeCacheConfig.BundleList
+		case bundles.BundleListFilename, bundles.ChecksumManifestFilename:
+			cachePolicy = routeCacheConfig.BundleList
+		default:
+			list, err := bundleProvider.GetBundleList(ctx, &repository)
+			if err != nil {
+				serveError(w, http.StatusNotFound, errorBundleListNotFound, route, "bundle list not found")
+				b.appLogger.Warnf(ctx, "Failed to load bundle list: %s", err)
+				return
+			}
+
+			if !list.ContainsBundleFile(signedFile) {
+				serveError(w, http.StatusNotFound, errorFileNotFound, route, "file not found")
+				b.appLogger.Infof(ctx, "Requested file is not the signature of a registered bundle")
+				return
+			}
+			cachePolicy = routeCacheConfig.Bundles
+		}
+		fileToServe = filepath.Join(repository.WebDir, filename)
 	} else {
+		// Only serve bundles that are registered in the route's bundle list;
+		// any other file (including the "reserved" bundle list files) is a 404.
+		list, err := bundleProvider.GetBundleList(ctx, &repository)
+		if err != nil {
+			serveError(w, http.StatusNotFound, errorBundleListNotFound, route, "bundle list not found")
+			b.appLogger.Warnf(ctx, "Failed to load bundle list: %s", err)
+			return
+		}
+
+		if !list.ContainsBundleFile(filename) {
+			serveError(w, http.StatusNotFound, errorFileNotFound, route, "file not found")
+			b.appLogger.Infof(ctx, "Requested file is not a registered bundle")
+			return
+		}
+
+		// If a redirect base URL is configured, send the client there. Unlike
+		// a storage URL, the redirect target is fixed, so it can be cached
+		// like the bundle itself.
+		if redirectURL := b.bundleRedirectURL(repository.Route, filename); redirectURL != "" {
+			if cacheControl := routeCacheConfig.Bundles.headerValue(isPrivate); cacheControl != "" {
+				w.Header().Set("Cache-Control", cacheControl)
+			}
+			http.Redirect(w, r, redirectURL, http.StatusFound)
+			b.appLogger.Infof(ctx, "Redirecting to %s", redirectURL)
+			b.auditDownload(r, route, filename, http.StatusFound)
+			return
+		}
+
+		// If the bundle is published to remote storage, redirect the client
+		// to download it from there.
+		storageURL, err := storage.URL(ctx, &repository, filename)
+		if err != nil {
+			serveError(w, http.StatusInternalServerError, errorInternal, route, "internal server error")
+			b.appLogger.Errorf(ctx, "Failed to get storage URL for bundle: %s", err)
+			return
+		} else if storageURL != "" {
+			// The URL may expire, so the redirect must not be cached.
+			w.Header().Set("Cache-Control", "no-store")
+			http.Redirect(w, r, storageURL, http.StatusFound)
+			b.appLogger.Infof(ctx, "Redirecting to storage for %s/%s", route, filename)
+			b.auditDownload(r, route, filename, http.StatusFound)
+			return
+		}
+
 		fileToServe = filepath.Join(repository.WebDir, filename)
+		contentType = bundleContentType
+		cachePolicy = routeCacheConfig.Bundles
+		auditedBundle = filename
+	}
+
+	// Defense-in-depth: make sure the resolved file is inside the route's web
+	// directory.
+	if relPath, err := filepath.Rel(repository.WebDir, fileToServe); err != nil ||
+		relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		serveError(w, http.StatusNotFound, errorFileNotFound, route, "file not found")
+		b.appLogger.Warnf(ctx, "Requested file is outside of the web directory")
+		return
 	}
 
 	file, err := os.OpenFile(fileToServe, os.O_RDONLY, 0)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Printf("Failed to open file\n")
+		serveError(w, http.StatusNotFound, errorFileNotFound, route, "file not found")
+		b.appLogger.Warnf(ctx, "Failed to open file: %s", err)
+		return
+	}
+
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, errorInternal, route, "internal server error")
+		b.appLogger.Errorf(ctx, "Failed to stat file: %s", err)
+		return
+	}
+
+	// Set the ETag so that 'ServeContent' can respond to conditional requests
+	// (If-None-Match, If-Modified-Since) with '304 Not Modified'.
+	w.Header().Set("ETag", fileETag(fileInfo))
+
+	// Set the content type explicitly so 'ServeContent' doesn't try to sniff
+	// it from the file contents.
+	w.Header().Set("Content-Type", contentType)
+	if cacheControl := cachePolicy.headerValue(isPrivate); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+
+	b.appLogger.Infof(ctx, "Successfully serving content for %s/%s", route, filename)
+	if auditedBundle != "" {
+		recorder := &statusRecorder{ResponseWriter: w}
+		http.ServeContent(recorder, r, filename, fileInfo.ModTime(), file)
+		b.auditDownload(r, route, auditedBundle, recorder.status)
+		return
+	}
+	http.ServeContent(w, r, filename, fileInfo.ModTime(), file)
+}
+
+// auditDownload records the download of the given bundle in the audit log, if
+// one is configured.
+func (b *bundleWebServer) auditDownload(r *http.Request, route string, bundle string, status int) {
+	if b.auditLog == nil {
 		return
 	}
+	b.auditLog.record(r.Context(), auditEvent{
+		Time:      time.Now().UTC(),
+		RequestId: log.RequestId(r.Context()),
+		ClientIP:  b.clientIP(r),
+		Principal: requestPrincipal(r, b.authorize != nil),
+		Host:      r.Host,
+		Method:    r.Method,
+		Route:     route,
+		Bundle:    bundle,
+		Status:    status,
+		UserAgent: r.UserAgent(),
+	})
+}
+
+// mediaTypeQuality returns the quality value ('q') given to the media type in
+// the request's 'Accept' header, or 0 if the media type is not listed
+// explicitly.
+func mediaTypeQuality(r *http.Request, mediaType string) float64 {
+	quality := 0.0
+	for _, header := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(header, ",") {
+			rangeType, params, _ := strings.Cut(mediaRange, ";")
+			if !strings.EqualFold(strings.TrimSpace(rangeType), mediaType) {
+				continue
+			}
+
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if key == "q" {
+					var err error
+					q, err = strconv.ParseFloat(value, 64)
+					if err != nil {
+						q = 0
+					}
+				}
+			}
+			if q > quality {
+				quality = q
+			}
+		}
+	}
+	return quality
+}
 
-	fmt.Printf("Successfully serving content for %s/%s\n", route, filename)
-	http.ServeContent(w, r, filename, time.UnixMicro(0), file)
+// acceptsJson returns whether the client prefers the JSON representation of
+// the bundle list over the default (Git config) format. Wildcards are ignored
+// so that clients accepting anything (like Git) get the default format.
+func acceptsJson(r *http.Request) bool {
+	return mediaTypeQuality(r, "application/json") > mediaTypeQuality(r, "text/plain")
+}
+
+func (b *bundleWebServer) serveBundleListJson(w http.ResponseWriter,
+	r *http.Request,
+	repo *core.Repository,
+	bundleProvider bundles.BundleProvider,
+	policy cachePolicy,
+	isPrivate bool,
+) {
+	ctx := r.Context()
+	list, err := bundleProvider.GetBundleList(ctx, repo)
+	if err != nil {
+		serveError(w, http.StatusNotFound, errorBundleListNotFound, repo.Route, "bundle list not found")
+		b.appLogger.Warnf(ctx, "Failed to load bundle list: %s", err)
+		return
+	}
+
+	data, err := json.MarshalIndent(bundles.NewBundleListJson(list, repo, b.pathPrefix), "", "  ")
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, errorInternal, repo.Route, "internal server error")
+		b.appLogger.Errorf(ctx, "Failed to serialize bundle list: %s", err)
+		return
+	}
+
+	// The JSON is generated on the fly, so identify it by its content.
+	checksum := sha256.Sum256(data)
+	w.Header().Set("ETag", fmt.Sprintf("\"%x\"", checksum[:16]))
+	w.Header().Set("Content-Type", bundleListJsonContentType)
+	if cacheControl := policy.headerValue(isPrivate); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+
+	b.appLogger.Infof(ctx, "Successfully serving JSON bundle list for %s", repo.Route)
+	http.ServeContent(w, r, bundles.BundleListJsonFilename, time.Time{}, bytes.NewReader(data))
+}
+
+// serveAliasBundleList serves the bundle list of a repository requested from
+// one of its aliases (without a trailing slash), with bundle URIs relative to
+// the alias.
+func (b *bundleWebServer) serveAliasBundleList(w http.ResponseWriter,
+	r *http.Request,
+	alias string,
+	repo *core.Repository,
+	bundleProvider bundles.BundleProvider,
+	policy cachePolicy,
+	isPrivate bool,
+) {
+	ctx := r.Context()
+	list, err := bundleProvider.GetBundleList(ctx, repo)
+	if err != nil {
+		serveError(w, http.StatusNotFound, errorBundleListNotFound, alias, "bundle list not found")
+		b.appLogger.Warnf(ctx, "Failed to load bundle list: %s", err)
+		return
+	}
+
+	// Bundles requested from the alias are served from the repository's web
+	// directory, so only their URIs change.
+	aliasRepo := *repo
+	aliasRepo.Route = alias
+	list.Relocate(&aliasRepo)
+
+	content := bytes.Buffer{}
+	err = bundles.WriteBundleListFile(&content, list, &aliasRepo, "/"+alias)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, errorInternal, alias, "internal server error")
+		b.appLogger.Errorf(ctx, "Failed to write bundle list: %s", err)
+		return
+	}
+
+	// The list is generated on the fly, so identify it by its content.
+	checksum := sha256.Sum256(content.Bytes())
+	w.Header().Set("ETag", fmt.Sprintf("\"%x\"", checksum[:16]))
+	w.Header().Set("Content-Type", bundleListContentType)
+	if cacheControl := policy.headerValue(isPrivate); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+
+	b.appLogger.Infof(ctx, "Successfully serving bundle list for alias %s", alias)
+	http.ServeContent(w, r, bundles.RepoBundleListFilename, time.Time{}, bytes.NewReader(content.Bytes()))
+}
+
+// serveCreationToken serves the creation token of the newest bundle in the
+// list, so that clients can cheaply poll whether new bundles exist before
+// fetching the bundle list. The token is the body of the response, the value of
+// its 'X-Bundle-Creation-Token' header, and its entity tag, so a conditional
+// request with the token of the last poll in 'If-None-Match' is answered with
+// '304 Not Modified' until a new bundle is created.
+func serveCreationToken(w http.ResponseWriter,
+	r *http.Request,
+	list *bundles.BundleList,
+	policy cachePolicy,
+	isPrivate bool,
+) {
+	token := strconv.FormatInt(list.LatestCreationToken(), 10)
+	w.Header().Set("ETag", "\""+token+"\"")
+	w.Header().Set(creationTokenHeader, token)
+	w.Header().Set("Content-Type", creationTokenContentType)
+	if cacheControl := policy.headerValue(isPrivate); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	http.ServeContent(w, r, creationTokenFilename, time.Time{}, strings.NewReader(token+"\n"))
+}
+
+// routeMetadata is the metadata of a route's repository served at
+// '<route>/metadata'.
+type routeMetadata struct {
+	Route string `json:"route"`
+
+	// The ref of the remote's default branch (e.g. 'refs/heads/main') and its
+	// short name (e.g. 'main'), if known. The bundles are created with the
+	// repository's HEAD pointing to it.
+	Head          string `json:"head,omitempty"`
+	DefaultBranch string `json:"defaultBranch,omitempty"`
+
+	// The creation token of the route's newest bundle, as served at
+	// '<route>/creation-token'.
+	CreationToken int64 `json:"creationToken"`
+}
+
+// serveMetadata serves the metadata of the route's repository (see
+// routeMetadata) as JSON, e.g. for automation to find out which branch the
+// route's bundles are based on. It changes with the bundle list, so it is
+// cached like it.
+func serveMetadata(w http.ResponseWriter,
+	r *http.Request,
+	route string,
+	list *bundles.BundleList,
+	policy cachePolicy,
+	isPrivate bool,
+) {
+	metadata := routeMetadata{
+		Route:         route,
+		Head:          list.Head,
+		DefaultBranch: strings.TrimPrefix(list.Head, "refs/heads/"),
+		CreationToken: list.LatestCreationToken(),
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, errorInternal, route, "internal server error")
+		return
+	}
+	data = append(data, '\n')
+
+	// The JSON is generated on the fly, so identify it by its content.
+	checksum := sha256.Sum256(data)
+	w.Header().Set("ETag", fmt.Sprintf("\"%x\"", checksum[:16]))
+	w.Header().Set("Content-Type", metadataContentType)
+	if cacheControl := policy.headerValue(isPrivate); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	http.ServeContent(w, r, metadataFilename, time.Time{}, bytes.NewReader(data))
+}
+
+// fileETag generates a strong entity tag for the given file from its
+// modification time and size. Bundle server content is never modified in
+// place (it is replaced with a lockfile rename), so this is sufficient to
+// identify a unique version of the file without hashing its contents.
+func fileETag(fileInfo os.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", fileInfo.ModTime().UnixNano(), fileInfo.Size())
 }
 
 func (b *bundleWebServer) StartServerAsync(ctx context.Context) {
 	// Add to wait group
 	b.serverWaitGroup.Add(1)
 
+	// Derive the context of each request from the server's (without its
+	// cancellation), so that the requests share its trace2 session.
+	b.server.BaseContext = func(net.Listener) context.Context {
+		return detachedContext{ctx}
+	}
+
+	listener, isActivated, err := listen(ctx, b.server.Addr, b.reusePort)
+	if err != nil {
+		b.logger.Fatal(ctx, err)
+	}
+
 	go func(ctx context.Context) {
 		defer b.serverWaitGroup.Done()
 
 		// Return error unless it indicates graceful shutdown
-		err := b.listenAndServeFunc()
+		err := b.serveFunc(listener)
 		if err != nil && err != http.ErrServerClosed {
 			b.logger.Fatal(ctx, err)
 		}
 	}(ctx)
 
+	if b.http3Server != nil {
+		b.serverWaitGroup.Add(1)
+		go func(ctx context.Context) {
+			defer b.serverWaitGroup.Done()
+
+			err := b.http3Server.ListenAndServe(detachedContext{ctx})
+			if err != nil && err != http.ErrServerClosed {
+				b.logger.Fatal(ctx, err)
+			}
+		}(ctx)
+	}
+
 	// Wait 0.1s before reporting that the server is started in case
-	// 'listenAndServeFunc' exits immediately.
+	// 'serveFunc' exits immediately.
 	//
-	// It's a hack, but a necessary one because 'ListenAndServe[TLS]()' doesn't
+	// It's a hack, but a necessary one because 'Serve[TLS]()' doesn't
 	// have any mechanism of notifying if it starts successfully, only that it
 	// fails. We could get around that by copying/reimplementing those functions
 	// with a print statement inserted at the right place, but that's way more
 	// cumbersome than just adding a delay here (see:
 	// https://stackoverflow.com/questions/53332667/how-to-notify-when-http-server-starts-successfully).
 	time.Sleep(time.Millisecond * 100)
-	fmt.Println("Server is running at address " + b.server.Addr)
+	if isActivated {
+		b.appLogger.Infof(ctx, "Server is running at address %s (socket-activated)", listener.Addr())
+	} else {
+		b.appLogger.Infof(ctx, "Server is running at address %s", b.server.Addr)
+	}
+
+	// Check the routes in the background, so that servers with many routes
+	// start serving immediately.
+	go b.validateRoutes(ctx)
+	if b.http3Server != nil {
+		b.appLogger.Infof(ctx, "Serving HTTP/3 at UDP address %s", b.server.Addr)
+	}
+}
+
+// validateRoutes checks that the web directory and bundle list of each route
+// (including those of virtual hosts) exist, logging a warning for each broken
+// route.
+func (b *bundleWebServer) validateRoutes(ctx context.Context) {
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, b.container)
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, b.container)
+
+	brokenCount, err := b.routeHealth.validate(ctx, b.logger, b.appLogger, fileSystem, repoProvider)
+	for host, vhost := range b.virtualHosts {
+		if err != nil {
+			break
+		}
+		var count int
+		count, err = vhost.routeHealth.validate(ctx, b.logger, b.appLogger, fileSystem, vhost.repoProvider)
+		if err != nil {
+			err = fmt.Errorf("virtual host '%s': %w", host, err)
+		}
+		brokenCount += count
+	}
+	if err != nil {
+		b.appLogger.Errorf(ctx, "Failed to validate routes: %s", err)
+	} else if brokenCount > 0 {
+		b.appLogger.Warnf(ctx, "Found %d broken route(s)", brokenCount)
+	}
 }
 
 func (b *bundleWebServer) HandleSignalsAsync(ctx context.Context) {
@@ -204,9 +1049,26 @@ func (b *bundleWebServer) HandleSignalsAsync(ctx context.Context) {
 	signal.Notify(c, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	go func(ctx context.Context) {
 		<-c
-		fmt.Println("Starting graceful server shutdown...")
+		b.appLogger.Infof(ctx, "Starting graceful server shutdown...")
+		if b.http3Server != nil {
+			b.http3Server.Close()
+		}
 		b.server.Shutdown(ctx)
 	}(ctx)
+
+	// Reload the routes on SIGHUP, rather than waiting for the cache to
+	// notice that the route registry changed.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func(ctx context.Context) {
+		for range hup {
+			b.appLogger.Infof(ctx, "Reloading routes")
+			utils.GetDependency[core.CachedRepositoryProvider](ctx, b.container).Reload()
+			for _, vhost := range b.virtualHosts {
+				vhost.repoProvider.Reload()
+			}
+		}
+	}(ctx)
 }
 
 func (b *bundleWebServer) Wait() {
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/buildinfo"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// The routes known to the web server in 'parseRouteTests'.
+var parseRouteKnownRoutes = map[string]bool{
+	"test/repo":     true,
+	"toplevel":      true,
+	"org/team/repo": true,
+}
+
+var parseRouteTests = []struct {
+	title string
+
+	path string
+
+	expectedRoute    string
+	expectedFilename string
+	expectErr        bool
+}{
+	{
+		"Route with no file",
+		"/test/repo",
+		"test/repo", "",
+		false,
+	},
+	{
+		"Route with bundle file",
+		"/test/repo/bundle-1.bundle",
+		"test/repo", "bundle-1.bundle",
+		false,
+	},
+	{
+		"Repeated slashes are ignored",
+		"//test//repo/",
+		"test/repo", "",
+		false,
+	},
+	{
+		"Top-level route",
+		"/toplevel",
+		"toplevel", "",
+		false,
+	},
+	{
+		"Top-level route with bundle file",
+		"/toplevel/bundle-1.bundle",
+		"toplevel", "bundle-1.bundle",
+		false,
+	},
+	{
+		"Nested route with bundle file",
+		"/org/team/repo/bundle-1.bundle",
+		"org/team/repo", "bundle-1.bundle",
+		false,
+	},
+	{
+		"Unknown route",
+		"/test/other/bundle-1.bundle",
+		"test/other/bundle-1.bundle", "",
+		false,
+	},
+	{
+		"Path too deep",
+		"/test/repo/extra/bundle-1.bundle",
+		"test/repo/extra/bundle-1.bundle", "",
+		false,
+	},
+	{
+		"Empty path",
+		"/",
+		"", "",
+		true,
+	},
+	{
+		"Parent directory file",
+		"/test/repo/..",
+		"", "",
+		true,
+	},
+	{
+		"Parent directory repo",
+		"/test/../bundle-1.bundle",
+		"", "",
+		true,
+	},
+	{
+		"Current directory element",
+		"/./repo",
+		"", "",
+		true,
+	},
+	{
+		"Backslash in path",
+		"/test/repo/..\\..\\secret",
+		"", "",
+		true,
+	},
+	{
+		"NUL byte in path",
+		"/test/repo/bundle-1.bundle\x00",
+		"", "",
+		true,
+	},
+}
+
+func TestParseRoute(t *testing.T) {
+	server := &bundleWebServer{logger: &MockTraceLogger{}}
+	isRoute := func(route string) bool { return parseRouteKnownRoutes[route] }
+
+	for _, tt := range parseRouteTests {
+		t.Run(tt.title, func(t *testing.T) {
+			route, filename, err := server.parseRoute(context.Background(), tt.path, isRoute)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, tt.expectedRoute, route)
+			assert.Equal(t, tt.expectedFilename, filename)
+		})
+	}
+}
+
+var bundleRedirectURLTests = []struct {
+	title string
+
+	redirectBaseURL string
+	route           string
+	filename        string
+
+	expectedURL string
+}{
+	{
+		"No redirect base URL",
+		"",
+		"test/repo", "bundle-1.bundle",
+		"",
+	},
+	{
+		"Redirect base URL",
+		"https://cdn.example.com",
+		"test/repo", "bundle-1.bundle",
+		"https://cdn.example.com/test/repo/bundle-1.bundle",
+	},
+	{
+		"Redirect base URL with path and trailing slash",
+		"https://cdn.example.com/bundles/",
+		"test/repo", "bundle-1.bundle",
+		"https://cdn.example.com/bundles/test/repo/bundle-1.bundle",
+	},
+}
+
+func TestBundleRedirectURL(t *testing.T) {
+	for _, tt := range bundleRedirectURLTests {
+		t.Run(tt.title, func(t *testing.T) {
+			server := &bundleWebServer{
+				logger:          &MockTraceLogger{},
+				redirectBaseURL: tt.redirectBaseURL,
+			}
+			assert.Equal(t, tt.expectedURL, server.bundleRedirectURL(tt.route, tt.filename))
+		})
+	}
+}
+
+var requiresClientCertTests = []struct {
+	title string
+
+	clientCARoutes []string
+	route          string
+
+	expectedResult bool
+}{
+	{"No routes require a client certificate", []string{}, "secure/repo", false},
+	{"Route matching a pattern", []string{"other", "secure/*"}, "secure/repo", true},
+	{"Exact route", []string{"secure/repo"}, "secure/repo", true},
+	{"Pattern doesn't match nested routes", []string{"secure/*"}, "secure/team/repo", false},
+	{"Pattern doesn't match route prefixes", []string{"secure"}, "secure/repo", false},
+	{"Character class pattern", []string{"secure/[a-m]*"}, "secure/repo", false},
+}
+
+func TestRequiresClientCert(t *testing.T) {
+	for _, tt := range requiresClientCertTests {
+		t.Run(tt.title, func(t *testing.T) {
+			server := &bundleWebServer{
+				logger:         &MockTraceLogger{},
+				clientCARoutes: tt.clientCARoutes,
+			}
+			assert.Equal(t, tt.expectedResult, server.requiresClientCert(tt.route))
+		})
+	}
+}
+
+// A TLS connection with a client certificate verified by the client CA.
+var verifiedClientTLS = &tls.ConnectionState{
+	VerifiedChains: [][]*x509.Certificate{{&x509.Certificate{}}},
+}
+
+var checkAccessTests = []struct {
+	title string
+
+	route          string
+	canonicalRoute string
+	tlsState       *tls.ConnectionState
+
+	expectedAllowed bool
+	expectedStatus  int
+	expectedError   string
+}{
+	{
+		"Unrestricted route",
+		"public/repo", "public/repo", nil,
+		true, http.StatusOK, "",
+	},
+	{
+		"Client certificate required without TLS",
+		"secure/repo", "secure/repo", nil,
+		false, http.StatusNotFound, errorRouteNotFound,
+	},
+	{
+		"Client certificate required without verified chains",
+		"secure/repo", "secure/repo", &tls.ConnectionState{},
+		false, http.StatusNotFound, errorRouteNotFound,
+	},
+	{
+		"Client certificate required and verified",
+		"secure/repo", "secure/repo", verifiedClientTLS,
+		true, http.StatusOK, "",
+	},
+	{
+		"Alias of a route requiring a client certificate",
+		"public/alias", "secure/repo", nil,
+		false, http.StatusNotFound, errorRouteNotFound,
+	},
+	{
+		"Alias of a route requiring a client certificate, verified",
+		"public/alias", "secure/repo", verifiedClientTLS,
+		true, http.StatusOK, "",
+	},
+	{
+		"Authorization denied",
+		"denied/repo", "denied/repo", nil,
+		false, http.StatusForbidden, errorAccessDenied,
+	},
+	{
+		"Alias of a route denied by authorization",
+		"public/alias", "denied/repo", nil,
+		false, http.StatusForbidden, errorAccessDenied,
+	},
+}
+
+func TestCheckAccess(t *testing.T) {
+	server := &bundleWebServer{
+		logger:         &MockTraceLogger{},
+		appLogger:      log.NopAppLogger(),
+		clientCARoutes: []string{"secure/*"},
+		authorize: func(r *http.Request, owner string, repo string) auth.AuthResult {
+			if owner == "denied" {
+				return auth.Deny(http.StatusForbidden)
+			}
+			return auth.Allow()
+		},
+	}
+
+	for _, tt := range checkAccessTests {
+		t.Run(tt.title, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/"+tt.route, nil)
+			r.TLS = tt.tlsState
+			w := httptest.NewRecorder()
+
+			allowed := server.checkAccess(w, r, tt.route, tt.canonicalRoute)
+			assert.Equal(t, tt.expectedAllowed, allowed)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var body errorResponse
+				err := json.Unmarshal(w.Body.Bytes(), &body)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedError, body.Error)
+			} else {
+				assert.Empty(t, w.Body.String())
+			}
+		})
+	}
+}
+
+var renamedRouteURLTests = []struct {
+	title string
+
+	pathPrefix  string
+	newRoute    string
+	filename    string
+	requestPath string
+
+	expectedURL string
+}{
+	{
+		"Bundle",
+		"", "new/repo", "bundle-1.bundle", "/old/repo/bundle-1.bundle",
+		"/new/repo/bundle-1.bundle",
+	},
+	{
+		"Bundle list",
+		"", "new/repo", "", "/old/repo",
+		"/new/repo",
+	},
+	{
+		"Bundle list with trailing slash",
+		"", "new/repo", "", "/old/repo/",
+		"/new/repo/",
+	},
+	{
+		"Bundle with path prefix",
+		"/bundles", "new/repo", "bundle-1.bundle", "/old/repo/bundle-1.bundle",
+		"/bundles/new/repo/bundle-1.bundle",
+	},
+}
+
+func TestRenamedRouteURL(t *testing.T) {
+	for _, tt := range renamedRouteURLTests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.expectedURL, renamedRouteURL(tt.pathPrefix, tt.newRoute, tt.filename, tt.requestPath))
+		})
+	}
+}
+
+var acceptsJsonTests = []struct {
+	title string
+
+	acceptHeaders []string
+
+	expected bool
+}{
+	{"No Accept header", []string{}, false},
+	{"Wildcard", []string{"*/*"}, false},
+	{"JSON only", []string{"application/json"}, true},
+	{"JSON with parameters", []string{"application/json; charset=utf-8"}, true},
+	{"Case insensitive", []string{"Application/JSON"}, true},
+	{"Plain text preferred", []string{"text/plain, application/json;q=0.5"}, false},
+	{"JSON preferred", []string{"text/plain;q=0.5, application/json"}, true},
+	{"Equal preference", []string{"application/json, text/plain"}, false},
+	{"JSON refused", []string{"application/json;q=0"}, false},
+	{"Multiple headers", []string{"text/plain;q=0.1", "application/json;q=0.9"}, true},
+}
+
+func TestAcceptsJson(t *testing.T) {
+	for _, tt := range acceptsJsonTests {
+		t.Run(tt.title, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/test/repo", nil)
+			for _, header := range tt.acceptHeaders {
+				r.Header.Add("Accept", header)
+			}
+			assert.Equal(t, tt.expected, acceptsJson(r))
+		})
+	}
+}
+
+var serveCreationTokenTests = []struct {
+	title string
+
+	tokens      []int64
+	ifNoneMatch string
+
+	expectedStatus int
+	expectedBody   string
+}{
+	{"Latest token", []int64{1, 3, 2}, "", http.StatusOK, "3\n"},
+	{"Empty list", []int64{}, "", http.StatusOK, "0\n"},
+	{"Unchanged token", []int64{1, 3}, "\"3\"", http.StatusNotModified, ""},
+	{"Changed token", []int64{1, 3, 4}, "\"3\"", http.StatusOK, "4\n"},
+}
+
+func TestServeCreationToken(t *testing.T) {
+	repo := &core.Repository{Route: "test/repo", WebDir: "/test/www/test/repo"}
+	for _, tt := range serveCreationTokenTests {
+		t.Run(tt.title, func(t *testing.T) {
+			list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+			for _, token := range tt.tokens {
+				list.Bundles[token] = bundles.NewBundle(repo, token)
+			}
+
+			r := httptest.NewRequest("GET", "/test/repo/creation-token", nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			serveCreationToken(w, r, list, defaultCacheConfig().BundleList, false)
+
+			token := strings.TrimSpace(tt.expectedBody)
+			if tt.expectedStatus == http.StatusNotModified {
+				token = strings.Trim(tt.ifNoneMatch, "\"")
+			}
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+			assert.Equal(t, "\""+token+"\"", w.Header().Get("ETag"))
+			assert.Equal(t, token, w.Header().Get("X-Bundle-Creation-Token"))
+			assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+var serveMetadataTests = []struct {
+	title string
+
+	head string
+
+	expectedBody string
+}{
+	{
+		"Known default branch",
+		"refs/heads/main",
+		`{
+  "route": "test/repo",
+  "head": "refs/heads/main",
+  "defaultBranch": "main",
+  "creationToken": 3
+}
+`,
+	},
+	{
+		"Unknown default branch",
+		"",
+		`{
+  "route": "test/repo",
+  "creationToken": 3
+}
+`,
+	},
+}
+
+func TestServeMetadata(t *testing.T) {
+	repo := &core.Repository{Route: "test/repo", WebDir: "/test/www/test/repo"}
+	for _, tt := range serveMetadataTests {
+		t.Run(tt.title, func(t *testing.T) {
+			list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+			list.Head = tt.head
+			for _, token := range []int64{1, 3, 2} {
+				list.Bundles[token] = bundles.NewBundle(repo, token)
+			}
+
+			w := httptest.NewRecorder()
+			serveMetadata(w, httptest.NewRequest("GET", "/test/repo/metadata", nil),
+				repo.Route, list, defaultCacheConfig().BundleList, false)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.NotEmpty(t, w.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestVersionHeaders(t *testing.T) {
+	defer func(version string) { buildinfo.Version = version }(buildinfo.Version)
+	buildinfo.Version = "1.0.1-g1a2b3c4d"
+
+	handler := versionHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/test/repo", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "git-bundle-server/1.0.1-g1a2b3c4d", w.Header().Get("Server"))
+	assert.Equal(t, "1.0.1-g1a2b3c4d", w.Header().Get("X-Bundle-Server-Version"))
+}
+
+var requestIdsTests = []struct {
+	title string
+
+	clientId string
+
+	expectClientId bool
+}{
+	{"Client ID is kept", "abc-123", true},
+	{"No client ID", "", false},
+	{"Client ID with spaces", "abc 123", false},
+	{"Client ID too long", strings.Repeat("a", 129), false},
+}
+
+func TestRequestIds(t *testing.T) {
+	for _, tt := range requestIdsTests {
+		t.Run(tt.title, func(t *testing.T) {
+			var requestId string
+			handler := requestIds(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestId = log.RequestId(r.Context())
+			}))
+
+			r := httptest.NewRequest("GET", "/test/repo", nil)
+			if tt.clientId != "" {
+				r.Header.Set("X-Request-Id", tt.clientId)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.NotEmpty(t, requestId)
+			assert.Equal(t, requestId, w.Header().Get("X-Request-Id"))
+			if tt.expectClientId {
+				assert.Equal(t, tt.clientId, requestId)
+			} else {
+				assert.NotEqual(t, tt.clientId, requestId)
+			}
+		})
+	}
+}
+
+var normalizePathPrefixTests = []struct {
+	prefix   string
+	expected string
+}{
+	{"", ""},
+	{"/", ""},
+	{"bundles", "/bundles"},
+	{"/bundles/", "/bundles"},
+	{"//git//bundles/", "/git/bundles"},
+}
+
+func TestNormalizePathPrefix(t *testing.T) {
+	for _, tt := range normalizePathPrefixTests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalizePathPrefix(tt.prefix))
+		})
+	}
+}
+
+var stripPathPrefixTests = []struct {
+	title string
+
+	prefix string
+	path   string
+
+	expectedPath   string
+	expectNotFound bool
+}{
+	{"No prefix", "", "/test/repo", "/test/repo", false},
+	{"Route under prefix", "/bundles", "/bundles/test/repo", "/test/repo", false},
+	{"Prefix only", "/bundles", "/bundles", "/", false},
+	{"Prefix with trailing slash", "/bundles", "/bundles/", "/", false},
+	{"Path outside of prefix", "/bundles", "/test/repo", "", true},
+	{"Partial prefix element", "/bundles", "/bundlesX/test/repo", "", true},
+}
+
+func TestStripPathPrefix(t *testing.T) {
+	for _, tt := range stripPathPrefixTests {
+		t.Run(tt.title, func(t *testing.T) {
+			var path string
+			handler := stripPathPrefix(tt.prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+			}))
+
+			r := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if tt.expectNotFound {
+				assert.Equal(t, http.StatusNotFound, w.Code)
+			} else {
+				assert.Equal(t, http.StatusOK, w.Code)
+			}
+			assert.Equal(t, tt.expectedPath, path)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+)
+
+const (
+	bundleContentType           string = "application/x-git-bundle"
+	bundleListContentType       string = "text/plain; charset=utf-8"
+	bundleListJsonContentType   string = "application/json"
+	checksumManifestContentType string = "text/plain; charset=utf-8"
+	creationTokenContentType    string = "text/plain; charset=utf-8"
+	metadataContentType         string = "application/json"
+	signatureContentType        string = "text/plain; charset=utf-8"
+)
+
+type cachePolicy struct {
+	// The value of 'max-age' (in seconds) in the 'Cache-Control' header. If
+	// negative, 'no-store' is sent instead.
+	MaxAge *int `json:"maxAge,omitempty"`
+
+	// Whether to mark the content 'immutable' in the 'Cache-Control' header.
+	Immutable *bool `json:"immutable,omitempty"`
+}
+
+func (p cachePolicy) merge(override cachePolicy) cachePolicy {
+	if override.MaxAge != nil {
+		p.MaxAge = override.MaxAge
+	}
+	if override.Immutable != nil {
+		p.Immutable = override.Immutable
+	}
+	return p
+}
+
+// headerValue returns the 'Cache-Control' header value for the policy. If
+// 'private' is true (e.g., because the content requires authentication), shared
+// caches are not permitted to store the content.
+func (p cachePolicy) headerValue(private bool) string {
+	if p.MaxAge == nil {
+		return ""
+	} else if *p.MaxAge < 0 {
+		return "no-store"
+	}
+
+	value := "public"
+	if private {
+		value = "private"
+	}
+	value += ", max-age=" + strconv.Itoa(*p.MaxAge)
+	if p.Immutable != nil && *p.Immutable {
+		value += ", immutable"
+	}
+	return value
+}
+
+type routeCacheConfig struct {
+	BundleList cachePolicy `json:"bundleList"`
+	Bundles    cachePolicy `json:"bundles"`
+}
+
+type cacheConfig struct {
+	routeCacheConfig
+
+	// Per-route overrides, keyed by route pattern (as in 'path.Match').
+	Routes map[string]routeCacheConfig `json:"routes,omitempty"`
+}
+
+func intPtr(i int) *int    { return &i }
+func boolPtr(b bool) *bool { return &b }
+
+// defaultCacheConfig returns the caching policy used when no custom cache
+// config is specified. Bundle lists change every time a route is updated, so
+// they should only be cached briefly. Bundles are never modified after they
+// are created, so they can be cached indefinitely.
+func defaultCacheConfig() *cacheConfig {
+	return &cacheConfig{
+		routeCacheConfig: routeCacheConfig{
+			BundleList: cachePolicy{MaxAge: intPtr(60), Immutable: boolPtr(false)},
+			Bundles:    cachePolicy{MaxAge: intPtr(365 * 24 * 60 * 60), Immutable: boolPtr(true)},
+		},
+		Routes: map[string]routeCacheConfig{},
+	}
+}
+
+func parseCacheConfig(configPath string) (*cacheConfig, error) {
+	fileBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var userConfig cacheConfig
+	err = json.Unmarshal(fileBytes, &userConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply the user's settings on top of the defaults
+	config := defaultCacheConfig()
+	config.BundleList = config.BundleList.merge(userConfig.BundleList)
+	config.Bundles = config.Bundles.merge(userConfig.Bundles)
+	for pattern, routeConfig := range userConfig.Routes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid route pattern '%s': %w", pattern, err)
+		}
+		config.Routes[pattern] = routeConfig
+	}
+
+	return config, nil
+}
+
+// forRoute returns the cache config for the given route, applying the
+// overrides of the most specific (i.e., longest) matching route pattern.
+func (c *cacheConfig) forRoute(route string) routeCacheConfig {
+	config := c.routeCacheConfig
+
+	bestPattern := ""
+	foundMatch := false
+	for pattern := range c.Routes {
+		if matched, _ := path.Match(pattern, route); !matched {
+			continue
+		}
+		if !foundMatch || len(pattern) > len(bestPattern) ||
+			(len(pattern) == len(bestPattern) && pattern < bestPattern) {
+			bestPattern = pattern
+			foundMatch = true
+		}
+	}
+
+	if foundMatch {
+		override := c.Routes[bestPattern]
+		config.BundleList = config.BundleList.merge(override.BundleList)
+		config.Bundles = config.Bundles.merge(override.Bundles)
+	}
+	return config
+}
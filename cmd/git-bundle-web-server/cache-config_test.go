@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var parseCacheConfigTests = []struct {
+	title string
+
+	// Inputs
+	content string
+	route   string
+
+	// Expected values
+	expectedBundleList string
+	expectedBundles    string
+	expectErr          bool
+}{
+	{
+		"Empty config uses the defaults",
+		`{}`,
+		"test/repo",
+		"public, max-age=60",
+		"public, max-age=31536000, immutable",
+		false,
+	},
+	{
+		"Settings are merged with the defaults",
+		`{"bundleList": {"maxAge": 300}, "bundles": {"immutable": false}}`,
+		"test/repo",
+		"public, max-age=300",
+		"public, max-age=31536000",
+		false,
+	},
+	{
+		"Negative max age disables caching",
+		`{"bundleList": {"maxAge": -1}}`,
+		"test/repo",
+		"no-store",
+		"public, max-age=31536000, immutable",
+		false,
+	},
+	{
+		"Route pattern overrides the server-wide settings",
+		`{"bundleList": {"maxAge": 300}, "routes": {"test/*": {"bundleList": {"maxAge": 10}}}}`,
+		"test/repo",
+		"public, max-age=10",
+		"public, max-age=31536000, immutable",
+		false,
+	},
+	{
+		"Unmatched route pattern is ignored",
+		`{"routes": {"other/*": {"bundleList": {"maxAge": 10}}}}`,
+		"test/repo",
+		"public, max-age=60",
+		"public, max-age=31536000, immutable",
+		false,
+	},
+	{
+		"Longest matching route pattern takes precedence",
+		`{"routes": {` +
+			`"*/*": {"bundleList": {"maxAge": 10}, "bundles": {"maxAge": 3600}}, ` +
+			`"test/*": {"bundleList": {"maxAge": 20}}, ` +
+			`"test/repo": {"bundleList": {"maxAge": 30}}}}`,
+		"test/repo",
+		"public, max-age=30",
+		"public, max-age=31536000, immutable",
+		false,
+	},
+	{
+		"Longest matching route pattern applies to other routes",
+		`{"routes": {` +
+			`"*/*": {"bundleList": {"maxAge": 10}}, ` +
+			`"test/*": {"bundleList": {"maxAge": 20}}, ` +
+			`"test/repo": {"bundleList": {"maxAge": 30}}}}`,
+		"test/other",
+		"public, max-age=20",
+		"public, max-age=31536000, immutable",
+		false,
+	},
+	{
+		"Route patterns of the same length are ordered",
+		`{"routes": {` +
+			`"test/re?o": {"bundleList": {"maxAge": 10}}, ` +
+			`"test/r?po": {"bundleList": {"maxAge": 20}}}}`,
+		"test/repo",
+		"public, max-age=20",
+		"public, max-age=31536000, immutable",
+		false,
+	},
+	{
+		"Invalid route pattern",
+		`{"routes": {"test/[": {"bundleList": {"maxAge": 10}}}}`,
+		"test/repo",
+		"",
+		"",
+		true,
+	},
+	{
+		"Invalid JSON",
+		`{"bundleList": {"maxAge": "60"}}`,
+		"test/repo",
+		"",
+		"",
+		true,
+	},
+}
+
+func TestParseCacheConfig(t *testing.T) {
+	for _, tt := range parseCacheConfigTests {
+		t.Run(tt.title, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "cache.json")
+			err := os.WriteFile(configPath, []byte(tt.content), 0o600)
+			assert.Nil(t, err)
+
+			config, err := parseCacheConfig(configPath)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+
+			routeConfig := config.forRoute(tt.route)
+			assert.Equal(t, tt.expectedBundleList, routeConfig.BundleList.headerValue(false))
+			assert.Equal(t, tt.expectedBundles, routeConfig.Bundles.headerValue(false))
+		})
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := parseCacheConfig(filepath.Join(t.TempDir(), "missing.json"))
+		assert.NotNil(t, err)
+	})
+}
+
+func TestCachePolicy_HeaderValue(t *testing.T) {
+	policy := cachePolicy{MaxAge: intPtr(60), Immutable: boolPtr(true)}
+	assert.Equal(t, "public, max-age=60, immutable", policy.headerValue(false))
+	assert.Equal(t, "private, max-age=60, immutable", policy.headerValue(true))
+	assert.Equal(t, "", cachePolicy{}.headerValue(false))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/notify"
+)
+
+// The interval at which the expiry of the web server's TLS certificate is
+// checked, and thus at which an expiring certificate is notified.
+const certCheckInterval time.Duration = 24 * time.Hour
+
+// readCertExpiry returns the expiry time of the first certificate in the given
+// PEM file (the server's own certificate, followed by any intermediates).
+func readCertExpiry(certFile string) (time.Time, error) {
+	certBytes, err := os.ReadFile(certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for {
+		var block *pem.Block
+		block, certBytes = pem.Decode(certBytes)
+		if block == nil {
+			return time.Time{}, fmt.Errorf("no certificate found in '%s'", certFile)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid certificate in '%s': %w", certFile, err)
+		}
+		return cert.NotAfter, nil
+	}
+}
+
+// certExpiryChecker notifies when the web server's TLS certificate is about to
+// expire. The certificate is re-read at each check, so that a renewed
+// certificate (e.g. by an ACME client) stops the notifications, even though
+// the web server only serves it once restarted.
+type certExpiryChecker struct {
+	logger    log.TraceLogger
+	appLogger log.AppLogger
+	notifier  *notify.Notifier
+	certFile  string
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newCertExpiryChecker(logger log.TraceLogger,
+	appLogger log.AppLogger,
+	notifier *notify.Notifier,
+	certFile string,
+) *certExpiryChecker {
+	return &certExpiryChecker{
+		logger:    logger,
+		appLogger: appLogger,
+		notifier:  notifier,
+		certFile:  certFile,
+		stop:      make(chan struct{}),
+	}
+}
+
+// check notifies if the certificate expires within the notifier's warning
+// period, returning whether it did.
+func (c *certExpiryChecker) check(ctx context.Context, now time.Time) bool {
+	expiry, err := readCertExpiry(c.certFile)
+	if err != nil {
+		c.appLogger.Warnf(ctx, "Failed to check TLS certificate expiry: %s", err)
+		return false
+	}
+
+	remaining := expiry.Sub(now)
+	if remaining > c.notifier.CertExpiry() {
+		return false
+	}
+
+	var summary string
+	if remaining <= 0 {
+		summary = fmt.Sprintf("The web server's TLS certificate expired on %s", expiry.Format(time.RFC3339))
+	} else {
+		summary = fmt.Sprintf("The web server's TLS certificate expires in %d day(s), on %s",
+			int(remaining.Hours()/24), expiry.Format(time.RFC3339))
+	}
+	c.appLogger.Warnf(ctx, "%s", summary)
+
+	err = c.notifier.Notify(ctx, notify.NewEvent(notify.EventCertExpiring, "", summary, "Certificate: "+c.certFile))
+	if err != nil {
+		c.appLogger.Errorf(ctx, "Failed to send notification: %s", err)
+	}
+	return true
+}
+
+// Start checks the certificate now and then at every check interval in the
+// background, until Stop is called.
+func (c *certExpiryChecker) Start(ctx context.Context) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ctx, exitThread := c.logger.Goroutine(ctx, "cert-expiry")
+		defer exitThread()
+
+		ticker := time.NewTicker(certCheckInterval)
+		defer ticker.Stop()
+		for {
+			c.check(ctx, time.Now())
+
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop halts the checks and waits for the checker to exit.
+func (c *certExpiryChecker) Stop() {
+	close(c.stop)
+	c.wg.Wait()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/notify"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCert writes a self-signed certificate expiring at the given time,
+// preceded by its key, to a PEM file.
+func writeTestCert(t *testing.T, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "bundles.example.com"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	content := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})
+	content = append(content, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})...)
+	assert.NoError(t, os.WriteFile(certFile, content, 0o600))
+	return certFile
+}
+
+func TestCertExpiryChecker(t *testing.T) {
+	now := time.Now()
+
+	var notified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified.Add(1)
+	}))
+	defer server.Close()
+
+	notifier, err := notify.NewNotifierFromConfig(&MockTraceLogger{}, notify.Config{
+		CertExpiryDays: 14,
+		Sinks:          []notify.SinkConfig{{Type: "webhook", URL: server.URL}},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		title          string
+		notAfter       time.Time
+		expectNotified bool
+	}{
+		{"Valid for months", now.Add(90 * 24 * time.Hour), false},
+		{"Expires soon", now.Add(7 * 24 * time.Hour), true},
+		{"Expired", now.Add(-time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			notified.Store(0)
+			checker := newCertExpiryChecker(&MockTraceLogger{}, log.NopAppLogger(), notifier, writeTestCert(t, tt.notAfter))
+
+			assert.Equal(t, tt.expectNotified, checker.check(context.Background(), now))
+			if tt.expectNotified {
+				assert.Equal(t, int32(1), notified.Load())
+			} else {
+				assert.Equal(t, int32(0), notified.Load())
+			}
+		})
+	}
+
+	t.Run("Missing certificate", func(t *testing.T) {
+		checker := newCertExpiryChecker(&MockTraceLogger{}, log.NopAppLogger(), notifier, filepath.Join(t.TempDir(), "missing.pem"))
+		assert.False(t, checker.check(context.Background(), now))
+	})
+}
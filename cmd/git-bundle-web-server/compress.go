@@ -0,0 +1,180 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Responses smaller than this (if their length is known in advance) are not
+// worth compressing.
+const minCompressLength int = 256
+
+type compressionEncoding struct {
+	name      string
+	newWriter func(io.Writer) io.WriteCloser
+}
+
+// The content codings the server can compress responses with, in order of
+// preference.
+var compressionEncodings = []compressionEncoding{
+	{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+	{"deflate", func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+}
+
+// encodingQuality returns the quality value ('q') given to the content coding
+// in the request's 'Accept-Encoding' header (or to '*', if the coding is not
+// listed explicitly), or 0 if the coding is not accepted.
+func encodingQuality(r *http.Request, encoding string) float64 {
+	quality := -1.0
+	wildcardQuality := 0.0
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, codingRange := range strings.Split(header, ",") {
+			coding, params, _ := strings.Cut(codingRange, ";")
+			coding = strings.TrimSpace(coding)
+
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if key == "q" {
+					var err error
+					q, err = strconv.ParseFloat(value, 64)
+					if err != nil {
+						q = 0
+					}
+				}
+			}
+
+			if strings.EqualFold(coding, encoding) {
+				quality = q
+			} else if coding == "*" {
+				wildcardQuality = q
+			}
+		}
+	}
+	if quality < 0 {
+		return wildcardQuality
+	}
+	return quality
+}
+
+// isCompressible returns whether content of the given type benefits from
+// compression. Bundles are already compressed, so only text (like bundle lists
+// in Git config format) and JSON are.
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json")
+}
+
+// compressWriter compresses the response written through it, if its content
+// type is compressible and the client accepts the encoding.
+type compressWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	wroteHeader bool
+	writer      io.WriteCloser
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+
+	header := c.Header()
+	if !isCompressible(header.Get("Content-Type")) {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	// The response depends on 'Accept-Encoding' even if it isn't compressed,
+	// so that caches don't serve an uncompressed copy to every client.
+	header.Add("Vary", "Accept-Encoding")
+
+	// Ranges apply to the uncompressed content, so partial responses (and
+	// responses without a body) are sent as-is.
+	encoding := c.encoding()
+	if encoding == nil ||
+		status < http.StatusOK ||
+		status == http.StatusNoContent ||
+		status == http.StatusPartialContent ||
+		status == http.StatusNotModified ||
+		header.Get("Content-Encoding") != "" ||
+		header.Get("Content-Range") != "" {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < minCompressLength {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	// The compressed content is a different representation, so it can only be
+	// identified by a weak entity tag. Conditional requests still match it,
+	// since 'If-None-Match' uses weak comparison.
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+	header.Set("Content-Encoding", encoding.name)
+	header.Del("Content-Length")
+	if c.request.Method != http.MethodHead {
+		c.writer = encoding.newWriter(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+// encoding returns the most preferred encoding accepted by the client, or nil
+// if the client accepts none of them.
+func (c *compressWriter) encoding() *compressionEncoding {
+	for i := range compressionEncodings {
+		if encodingQuality(c.request, compressionEncodings[i].name) > 0 {
+			return &compressionEncodings[i]
+		}
+	}
+	return nil
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.writer != nil {
+		return c.writer.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// close flushes the remaining compressed content, if any.
+func (c *compressWriter) close() error {
+	if c.writer != nil {
+		return c.writer.Close()
+	}
+	return nil
+}
+
+// compressResponses wraps 'next' to compress responses (like bundle lists and
+// the JSON of the admin API) with gzip or deflate, for clients that accept
+// either encoding. Bundles, which are already compressed, are sent as-is.
+func compressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ranges apply to the uncompressed content, so don't compress the
+		// response to a range request.
+		if r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: w, request: r}
+		defer writer.close()
+		next.ServeHTTP(writer, r)
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A bundle list long enough to be compressed.
+var compressTestContent = strings.Repeat("[bundle \"1\"]\n\turi = 1.bundle\n\tcreationToken = 1\n", 16)
+
+var compressResponsesTests = []struct {
+	title string
+
+	contentType    string
+	content        string
+	acceptEncoding string
+	requestHeaders map[string]string
+
+	expectedEncoding string
+	expectedStatus   int
+	expectedETag     string
+	expectVary       bool
+}{
+	{
+		"gzip is preferred",
+		bundleListContentType,
+		compressTestContent,
+		"deflate, gzip",
+		nil,
+		"gzip",
+		http.StatusOK,
+		"W/\"abc\"",
+		true,
+	},
+	{
+		"deflate is used if gzip is not accepted",
+		bundleListJsonContentType,
+		compressTestContent,
+		"gzip;q=0, deflate",
+		nil,
+		"deflate",
+		http.StatusOK,
+		"W/\"abc\"",
+		true,
+	},
+	{
+		"Wildcard accepts gzip",
+		bundleListContentType,
+		compressTestContent,
+		"*",
+		nil,
+		"gzip",
+		http.StatusOK,
+		"W/\"abc\"",
+		true,
+	},
+	{
+		"No accepted encoding",
+		bundleListContentType,
+		compressTestContent,
+		"br",
+		nil,
+		"",
+		http.StatusOK,
+		"\"abc\"",
+		true,
+	},
+	{
+		"Bundles are not compressed",
+		bundleContentType,
+		compressTestContent,
+		"gzip",
+		nil,
+		"",
+		http.StatusOK,
+		"\"abc\"",
+		false,
+	},
+	{
+		"Short content is not compressed",
+		bundleListContentType,
+		"[bundle]\n\tversion = 1\n",
+		"gzip",
+		nil,
+		"",
+		http.StatusOK,
+		"\"abc\"",
+		true,
+	},
+	{
+		"Range requests are not compressed",
+		bundleListContentType,
+		compressTestContent,
+		"gzip",
+		map[string]string{"Range": "bytes=0-9"},
+		"",
+		http.StatusPartialContent,
+		"\"abc\"",
+		false,
+	},
+	{
+		"Compressed content matches its weak ETag",
+		bundleListContentType,
+		compressTestContent,
+		"gzip",
+		map[string]string{"If-None-Match": "W/\"abc\""},
+		"",
+		http.StatusNotModified,
+		"\"abc\"",
+		false,
+	},
+}
+
+func TestCompressResponses(t *testing.T) {
+	for _, tt := range compressResponsesTests {
+		t.Run(tt.title, func(t *testing.T) {
+			handler := compressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", "\"abc\"")
+				w.Header().Set("Content-Type", tt.contentType)
+				http.ServeContent(w, r, "bundle-list", time.Time{}, strings.NewReader(tt.content))
+			}))
+
+			r := httptest.NewRequest("GET", "/owner/repo", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			for name, value := range tt.requestHeaders {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedEncoding, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, tt.expectedETag, w.Header().Get("ETag"))
+			assert.Equal(t, tt.expectVary, strings.Contains(strings.Join(w.Header().Values("Vary"), ","), "Accept-Encoding"))
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var reader io.Reader = w.Body
+			switch tt.expectedEncoding {
+			case "gzip":
+				gzipReader, err := gzip.NewReader(w.Body)
+				assert.Nil(t, err)
+				reader = gzipReader
+				assert.Empty(t, w.Header().Get("Content-Length"))
+			case "deflate":
+				zlibReader, err := zlib.NewReader(w.Body)
+				assert.Nil(t, err)
+				reader = zlibReader
+				assert.Empty(t, w.Header().Get("Content-Length"))
+			}
+			content, err := io.ReadAll(reader)
+			assert.Nil(t, err)
+			assert.True(t, bytes.Equal([]byte(tt.content), content))
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// The codes in the 'error' field of error response bodies (see
+// 'errorResponse'), which tell apart the causes of responses with the same
+// status.
+const (
+	// The route is not registered (or, to avoid revealing which routes exist,
+	// requires a client certificate the request didn't present).
+	errorRouteNotFound string = "route_not_found"
+
+	// The route has no bundle list yet (e.g. it is still being initialized).
+	errorBundleListNotFound string = "bundle_list_not_found"
+
+	// The requested file isn't a bundle (or signature) of the route's bundle
+	// list, or is missing from the web directory.
+	errorFileNotFound string = "file_not_found"
+
+	// The route is disabled (see 'git-bundle-server disable').
+	errorRouteDisabled string = "route_disabled"
+
+	// The route's web directory or bundle list is missing (see
+	// '--unavailable-broken-routes').
+	errorRouteUnavailable string = "route_unavailable"
+
+	// The request was denied by the authorization middleware: '401
+	// Unauthorized' means that it requires (other) credentials, any other
+	// status that the credentials don't grant access.
+	errorAuthRequired string = "auth_required"
+	errorAccessDenied string = "access_denied"
+
+	// The client's IP address isn't allowed (see '--allow-ips' and
+	// '--deny-ips').
+	errorClientNotAllowed string = "client_not_allowed"
+
+	// The client exceeded the rate or connection limits (see '--rate-limit').
+	errorRateLimited string = "rate_limited"
+
+	errorInternal string = "internal_error"
+)
+
+// errorResponse is the JSON body of the error responses of the web server, so
+// that tooling and monitoring can tell apart errors with the same status.
+type errorResponse struct {
+	Error   string `json:"error"`
+	Route   string `json:"route,omitempty"`
+	Message string `json:"message"`
+}
+
+// serveError responds with the given status and an 'errorResponse' body. The
+// response is never cached, since the error may be transient.
+func serveError(w http.ResponseWriter, status int, code string, route string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{
+		Error:   code,
+		Route:   route,
+		Message: message,
+	})
+}
+
+// authErrorWriter adds the headers of an 'errorResponse' body to error
+// responses of the authorization middleware, which only writes their status
+// and its own headers (see 'auth.Deny').
+type authErrorWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (a *authErrorWriter) WriteHeader(status int) {
+	if a.status == 0 {
+		a.status = status
+		if status >= http.StatusBadRequest {
+			a.Header().Set("Content-Type", "application/json")
+			a.Header().Set("Cache-Control", "no-store")
+		}
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+// writeBody writes the 'errorResponse' body of the error response written by
+// the authorization middleware, if any.
+func (a *authErrorWriter) writeBody(route string) {
+	var body errorResponse
+	switch {
+	case a.status == http.StatusUnauthorized:
+		body = errorResponse{Error: errorAuthRequired, Route: route, Message: "authentication required"}
+	case a.status >= http.StatusInternalServerError:
+		body = errorResponse{Error: errorInternal, Message: "internal server error"}
+	case a.status >= http.StatusBadRequest:
+		body = errorResponse{Error: errorAccessDenied, Route: route, Message: "access denied"}
+	default:
+		return
+	}
+	json.NewEncoder(a.ResponseWriter).Encode(body)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeError(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveError(w, http.StatusNotFound, errorRouteNotFound, "test/repo", "route not found")
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"error": "route_not_found", "route": "test/repo", "message": "route not found"}`, w.Body.String())
+}
+
+var authErrorWriterTests = []struct {
+	title string
+
+	result auth.AuthResult
+
+	expectedStatus int
+	expectedError  string
+}{
+	{
+		"Unauthorized",
+		auth.Deny(http.StatusUnauthorized, auth.Header{Key: "WWW-Authenticate", Value: "Basic"}),
+		http.StatusUnauthorized,
+		errorAuthRequired,
+	},
+	{
+		"Forbidden",
+		auth.Deny(http.StatusForbidden),
+		http.StatusForbidden,
+		errorAccessDenied,
+	},
+	{
+		"Not found",
+		auth.Deny(http.StatusNotFound),
+		http.StatusNotFound,
+		errorAccessDenied,
+	},
+	{
+		"Invalid result",
+		auth.AuthResult{},
+		http.StatusInternalServerError,
+		errorInternal,
+	},
+}
+
+func TestAuthErrorWriter(t *testing.T) {
+	for _, tt := range authErrorWriterTests {
+		t.Run(tt.title, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			authWriter := &authErrorWriter{ResponseWriter: w}
+			assert.True(t, tt.result.ApplyResult(authWriter))
+			authWriter.writeBody("test/repo")
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var body errorResponse
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tt.expectedError, body.Error)
+		})
+	}
+
+	t.Run("Allowed requests have no error body", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		authWriter := &authErrorWriter{ResponseWriter: w}
+		result := auth.Allow(auth.Header{Key: "X-Owner", Value: "test"})
+		assert.False(t, result.ApplyResult(authWriter))
+		authWriter.writeBody("test/repo")
+
+		assert.Empty(t, w.Body.String())
+		assert.Empty(t, w.Header().Get("Content-Type"))
+		assert.Equal(t, "test", w.Header().Get("X-Owner"))
+	})
+}
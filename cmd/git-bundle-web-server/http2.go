@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// configureHTTP2 enables HTTP/2 for the server. Over TLS, clients negotiate
+// HTTP/2 with ALPN. If 'enableH2C' is true, the server also accepts HTTP/2
+// without TLS ('h2c') from clients with prior knowledge of it, such as a
+// reverse proxy terminating TLS in front of the server. HTTP/2 lets clients
+// fetch several bundles in parallel over a single connection.
+func configureHTTP2(server *http.Server, enableH2C bool) error {
+	h2Server := &http2.Server{}
+	if enableH2C {
+		server.Handler = h2c.NewHandler(server.Handler, h2Server)
+	}
+	return http2.ConfigureServer(server, h2Server)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+var configureHTTP2Tests = []struct {
+	title string
+
+	enableH2C bool
+
+	expectHTTP2 bool
+}{
+	{
+		"h2c enabled",
+		true,
+		true,
+	},
+	{
+		"h2c disabled",
+		false,
+		false,
+	},
+}
+
+func TestConfigureHTTP2(t *testing.T) {
+	for _, tt := range configureHTTP2Tests {
+		t.Run(tt.title, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Proto))
+			}))
+			err := configureHTTP2(server.Config, tt.enableH2C)
+			assert.Nil(t, err)
+			server.Start()
+			defer server.Close()
+
+			// Send a request with HTTP/2 "prior knowledge" (without TLS or an
+			// upgrade), as a reverse proxy would.
+			client := &http.Client{
+				Transport: &http2.Transport{
+					AllowHTTP: true,
+					DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+						return (&net.Dialer{}).DialContext(ctx, network, addr)
+					},
+				},
+			}
+			resp, err := client.Get(server.URL)
+			if !tt.expectHTTP2 {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, 2, resp.ProtoMajor)
+		})
+	}
+}
+
+func TestAdvertiseHTTP3(t *testing.T) {
+	handler := advertiseHTTP3("8443", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/owner/repo", nil))
+	assert.Equal(t, "h3=\":8443\"; ma=86400", w.Header().Get("Alt-Svc"))
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/owner/repo", nil)
+	r.ProtoMajor = 3
+	handler.ServeHTTP(w, r)
+	assert.Empty(t, w.Header().Get("Alt-Svc"))
+}
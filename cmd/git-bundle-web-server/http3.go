@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// http3Server serves the bundle server over HTTP/3 (QUIC), on the UDP port
+// with the same number as the server's TCP port. It is only available if the
+// web server is built with the 'http3' build tag (see 'newHTTP3Server').
+type http3Server interface {
+	// ListenAndServe serves requests with the given base context (see
+	// 'http.Server.BaseContext') until the server is closed, after which it
+	// returns 'http.ErrServerClosed'.
+	ListenAndServe(baseContext context.Context) error
+
+	// Close immediately closes the server and its connections.
+	Close() error
+}
+
+// requestContext is the context of a request served with a base context: it is
+// canceled with the request (e.g. when the client disconnects), but also holds
+// the values of the base context (like 'http.Server.BaseContext' does).
+type requestContext struct {
+	context.Context
+	base context.Context
+}
+
+func (c requestContext) Value(key any) any {
+	if value := c.Context.Value(key); value != nil {
+		return value
+	}
+	return c.base.Value(key)
+}
+
+// withBaseContext returns 'r' with the values of 'baseContext' added to its
+// context.
+func withBaseContext(r *http.Request, baseContext context.Context) *http.Request {
+	return r.WithContext(requestContext{Context: r.Context(), base: baseContext})
+}
+
+// advertiseHTTP3 wraps 'next' to advertise, in the 'Alt-Svc' header of every
+// response, that the server is also available over HTTP/3 on 'port'. Clients
+// supporting HTTP/3 switch to it for their subsequent requests.
+func advertiseHTTP3(port string, next http.Handler) http.Handler {
+	altSvc := fmt.Sprintf("h3=\":%s\"; ma=86400", port)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			w.Header().Set("Alt-Svc", altSvc)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,13 @@
+//go:build !http3
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+func newHTTP3Server(addr string, handler http.Handler, tlsConfig *tls.Config, certFile string, keyFile string) (http3Server, error) {
+	return nil, fmt.Errorf("HTTP/3 is not supported by this build of git-bundle-web-server (built without the 'http3' tag)")
+}
@@ -0,0 +1,48 @@
+//go:build http3
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+type quicServer struct {
+	server  *http3.Server
+	handler http.Handler
+}
+
+// newHTTP3Server creates an HTTP/3 server with the same TLS configuration (and
+// certificate) as the server's HTTP/1.1 and HTTP/2 listener.
+func newHTTP3Server(addr string, handler http.Handler, tlsConfig *tls.Config, certFile string, keyFile string) (http3Server, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	quicTLSConfig := tlsConfig.Clone()
+	quicTLSConfig.Certificates = []tls.Certificate{cert}
+	return &quicServer{
+		server: &http3.Server{
+			Addr:      addr,
+			TLSConfig: quicTLSConfig,
+		},
+		handler: handler,
+	}, nil
+}
+
+func (s *quicServer) ListenAndServe(baseContext context.Context) error {
+	// Unlike 'http.Server', the QUIC server has no base context for its
+	// requests, so add the values of the given one to each request's context.
+	s.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handler.ServeHTTP(w, withBaseContext(r, baseContext))
+	})
+	return s.server.ListenAndServe()
+}
+
+func (s *quicServer) Close() error {
+	return s.server.Close()
+}
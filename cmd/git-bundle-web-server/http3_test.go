@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testContextKey string
+
+func TestWithBaseContext(t *testing.T) {
+	baseContext := context.WithValue(context.Background(), testContextKey("base"), "base value")
+
+	requestContext, cancel := context.WithCancel(context.Background())
+	requestContext = context.WithValue(requestContext, testContextKey("request"), "request value")
+	r := httptest.NewRequest("GET", "/", nil).WithContext(requestContext)
+
+	ctx := withBaseContext(r, baseContext).Context()
+	assert.Equal(t, "base value", ctx.Value(testContextKey("base")))
+	assert.Equal(t, "request value", ctx.Value(testContextKey("request")))
+
+	// The request is still canceled with its original context
+	assert.NoError(t, ctx.Err())
+	cancel()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// parseIPNets parses a comma-separated list of IP addresses and/or CIDR ranges
+// (e.g. "10.0.0.0/8,192.168.1.1"). Single IP addresses are treated as ranges
+// containing only that address.
+func parseIPNets(list string) ([]*net.IPNet, error) {
+	ipNets := []*net.IPNet{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR range '%s': %w", entry, err)
+			}
+			ipNets = append(ipNets, ipNet)
+			continue
+		}
+
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address '%s'", entry)
+		}
+		bits := 8 * net.IPv4len
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len
+		} else {
+			ip = ip.To4()
+		}
+		ipNets = append(ipNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+
+	return ipNets, nil
+}
+
+func containsIP(ipNets []*net.IPNet, ipStr string) bool {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range ipNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type clientIPResolver struct {
+	trustedProxies []*net.IPNet
+}
+
+// ClientIP determines the IP address of the client that originated the
+// request. If the request was received from a trusted proxy, the client IP is
+// read from the 'X-Forwarded-For' header (skipping any other trusted proxies
+// in the chain) or, if that is not present, the 'X-Real-IP' header. Otherwise,
+// the address of the direct peer is used.
+func (c *clientIPResolver) ClientIP(r *http.Request) string {
+	peerIP := remoteIP(r)
+	if !containsIP(c.trustedProxies, peerIP) {
+		return peerIP
+	}
+
+	if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		// Each proxy appends the address it received the request from, so
+		// walk the chain from the right until we find an untrusted address.
+		hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				// Malformed entry; don't trust anything to the left of it.
+				break
+			}
+			if i == 0 || !containsIP(c.trustedProxies, hop) {
+				return hop
+			}
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return peerIP
+}
+
+type ipFilter struct {
+	allowed []*net.IPNet
+	denied  []*net.IPNet
+}
+
+// newIPFilter creates an ipFilter from the given allowed and denied ranges. If
+// both are empty, newIPFilter returns nil.
+func newIPFilter(allowed []*net.IPNet, denied []*net.IPNet) *ipFilter {
+	if len(allowed) == 0 && len(denied) == 0 {
+		return nil
+	}
+	return &ipFilter{allowed: allowed, denied: denied}
+}
+
+// IsAllowed checks whether a client IP may access the server. Denied ranges
+// take precedence over allowed ranges; if no allowed ranges are configured,
+// all IPs not explicitly denied are allowed.
+func (f *ipFilter) IsAllowed(ip string) bool {
+	if containsIP(f.denied, ip) {
+		return false
+	}
+	return len(f.allowed) == 0 || containsIP(f.allowed, ip)
+}
+
+// Middleware wraps the given handler, responding with '403 Forbidden' if the
+// client IP is not allowed to access the server.
+func (f *ipFilter) Middleware(appLogger log.AppLogger, clientIP func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if !f.IsAllowed(ip) {
+			serveError(w, http.StatusForbidden, errorClientNotAllowed, "", "client address not allowed")
+			appLogger.Warnf(r.Context(), "Rejected request from disallowed client %s", ip)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
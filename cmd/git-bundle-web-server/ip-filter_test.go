@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var clientIPTests = []struct {
+	title string
+
+	trustedProxies string
+	remoteAddr     string
+	headers        map[string]string
+
+	expectedIP string
+}{
+	{
+		"No trusted proxies uses remote address",
+		"",
+		"203.0.113.5:54321",
+		map[string]string{"X-Forwarded-For": "198.51.100.1"},
+		"203.0.113.5",
+	},
+	{
+		"Untrusted peer ignores headers",
+		"10.0.0.0/8",
+		"203.0.113.5:54321",
+		map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"},
+		"203.0.113.5",
+	},
+	{
+		"Trusted peer uses X-Forwarded-For",
+		"10.0.0.0/8",
+		"10.1.2.3:54321",
+		map[string]string{"X-Forwarded-For": "198.51.100.1"},
+		"198.51.100.1",
+	},
+	{
+		"Trusted proxy chain is skipped",
+		"10.0.0.0/8",
+		"10.1.2.3:54321",
+		map[string]string{"X-Forwarded-For": "192.0.2.9, 198.51.100.1, 10.4.5.6"},
+		"198.51.100.1",
+	},
+	{
+		"Malformed X-Forwarded-For entry stops the walk",
+		"10.0.0.0/8",
+		"10.1.2.3:54321",
+		map[string]string{"X-Forwarded-For": "198.51.100.1, garbage"},
+		"10.1.2.3",
+	},
+	{
+		"Trusted peer falls back on X-Real-IP",
+		"10.1.2.3",
+		"10.1.2.3:54321",
+		map[string]string{"X-Real-IP": "198.51.100.2"},
+		"198.51.100.2",
+	},
+	{
+		"Trusted peer with no headers uses remote address",
+		"10.1.2.3",
+		"10.1.2.3:54321",
+		map[string]string{},
+		"10.1.2.3",
+	},
+}
+
+func TestClientIPResolver(t *testing.T) {
+	for _, tt := range clientIPTests {
+		t.Run(tt.title, func(t *testing.T) {
+			trusted, err := parseIPNets(tt.trustedProxies)
+			assert.Nil(t, err)
+			resolver := &clientIPResolver{trustedProxies: trusted}
+
+			r := httptest.NewRequest("GET", "/test/repo", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			assert.Equal(t, tt.expectedIP, resolver.ClientIP(r))
+		})
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	t.Run("Invalid ranges are rejected", func(t *testing.T) {
+		_, err := parseIPNets("10.0.0.0/33")
+		assert.NotNil(t, err)
+		_, err = parseIPNets("not-an-ip")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Empty filter is nil", func(t *testing.T) {
+		assert.Nil(t, newIPFilter(nil, nil))
+	})
+
+	t.Run("Deny takes precedence over allow", func(t *testing.T) {
+		allowed, _ := parseIPNets("10.0.0.0/8, 2001:db8::/32")
+		denied, _ := parseIPNets("10.0.0.1")
+		filter := newIPFilter(allowed, denied)
+
+		assert.True(t, filter.IsAllowed("10.0.0.2"))
+		assert.True(t, filter.IsAllowed("2001:db8::1"))
+		assert.False(t, filter.IsAllowed("10.0.0.1"))
+		assert.False(t, filter.IsAllowed("192.168.0.1"))
+	})
+
+	t.Run("Deny-only filter allows everything else", func(t *testing.T) {
+		denied, _ := parseIPNets("192.168.0.0/16")
+		filter := newIPFilter(nil, denied)
+
+		assert.True(t, filter.IsAllowed("10.0.0.1"))
+		assert.False(t, filter.IsAllowed("192.168.3.4"))
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// The first file descriptor passed by systemd socket activation (see
+// sd_listen_fds(3)).
+const listenFdsStart = 3
+
+// activatedListener returns the listening socket passed to the web server by
+// systemd socket activation, or nil if the server was not socket-activated.
+// Because systemd keeps the socket open while the server restarts, new
+// connections wait in its backlog (rather than being refused) until the new
+// server starts accepting them.
+func activatedListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+
+	// Don't pass the activation variables on to the updates run by the server.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if count > 1 {
+		return nil, fmt.Errorf("expected one socket from socket activation, got %d", count)
+	}
+
+	// 'net.FileListener' duplicates the socket, so the original can be closed.
+	file := os.NewFile(uintptr(listenFdsStart), "LISTEN_FD_3")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket from socket activation: %w", err)
+	}
+	return listener, nil
+}
+
+// listen returns the listener on which the web server accepts connections:
+// the socket passed by systemd socket activation, if any, or else a new TCP
+// listener on 'addr'. If 'reusePort' is true, the new listener is created with
+// SO_REUSEPORT, so that a new server can listen on the same port before this
+// one shuts down (gracefully, finishing its in-flight requests).
+func listen(ctx context.Context, addr string, reusePort bool) (net.Listener, bool, error) {
+	listener, err := activatedListener()
+	if err != nil {
+		return nil, false, err
+	} else if listener != nil {
+		return listener, true, nil
+	}
+
+	config := net.ListenConfig{}
+	if reusePort {
+		config.Control = reusePortControl
+	}
+	listener, err = config.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return nil, false, err
+	}
+	return listener, false, nil
+}
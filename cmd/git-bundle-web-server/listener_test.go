@@ -0,0 +1,45 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListen(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Not socket-activated without LISTEN_PID", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", "")
+		t.Setenv("LISTEN_FDS", "1")
+
+		listener, err := activatedListener()
+		assert.Nil(t, err)
+		assert.Nil(t, listener)
+	})
+
+	t.Run("Port can be reused with SO_REUSEPORT", func(t *testing.T) {
+		first, isActivated, err := listen(ctx, "127.0.0.1:0", true)
+		assert.Nil(t, err)
+		assert.False(t, isActivated)
+		defer first.Close()
+
+		second, _, err := listen(ctx, first.Addr().String(), true)
+		assert.Nil(t, err)
+		if err == nil {
+			second.Close()
+		}
+	})
+
+	t.Run("Port cannot be reused without SO_REUSEPORT", func(t *testing.T) {
+		first, _, err := listen(ctx, "127.0.0.1:0", false)
+		assert.Nil(t, err)
+		defer first.Close()
+
+		_, _, err = listen(ctx, first.Addr().String(), false)
+		assert.NotNil(t, err)
+	})
+}
@@ -12,12 +12,17 @@ import (
 	"io"
 	"os"
 	"plugin"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
 	auth_internal "github.com/git-ecosystem/git-bundle-server/internal/auth"
+	"github.com/git-ecosystem/git-bundle-server/internal/buildinfo"
+	"github.com/git-ecosystem/git-bundle-server/internal/jobs"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/notify"
 	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
 )
 
@@ -119,25 +124,81 @@ type authConfig struct {
 
 func main() {
 	log.WithTraceLogger(context.Background(), func(ctx context.Context, logger log.TraceLogger) {
-		parser := argparse.NewArgParser(logger, "git-bundle-web-server [--port <port>] [--cert <filename> --key <filename>]")
+		parser := argparse.NewArgParser(logger, "git-bundle-web-server [--version] [--port <port>] [--cert <filename> --key <filename>] [<log-options>]")
+		version := parser.Bool("version", false, "display version information and exit")
 		flags, validate := utils.WebServerFlags(parser)
 		flags.VisitAll(func(f *flag.Flag) {
 			parser.Var(f.Value, f.Name, f.Usage)
+			parser.Env(f.Name, utils.WebServerEnvVar(f.Name))
+		})
+		logFlags, applyLogFlags := utils.AppLogFlags(parser)
+		logFlags.VisitAll(func(f *flag.Flag) {
+			parser.Var(f.Value, f.Name, f.Usage)
+			parser.Env(f.Name, utils.AppLogEnvVar(f.Name))
+		})
+		parser.ConfigFile("config")
+		rootFlags, applyRootFlags := utils.StorageRootFlags(parser)
+		rootFlags.VisitAll(func(f *flag.Flag) {
+			parser.Var(f.Value, f.Name, f.Usage)
 		})
 
-		parser.Parse(ctx, os.Args[1:])
+		// For consistency with 'git-bundle-server', accept 'version' as a
+		// synonym of '--version'.
+		args := os.Args[1:]
+		if len(args) == 1 && args[0] == "version" {
+			args = []string{"--version"}
+		}
+
+		parser.Parse(ctx, args)
+		if *version {
+			fmt.Print(buildinfo.Describe("git-bundle-web-server"))
+			return
+		}
 		validate(ctx)
+		applyRootFlags(ctx)
+		applyLogFlags(ctx)
+
+		container := utils.BuildGitBundleWebServerContainer(logger)
+		appLogger := utils.GetDependency[log.AppLogger](ctx, container)
+		defer appLogger.Close()
 
 		// Get the flag values
-		port := utils.GetFlagValue[string](parser, "port")
+		port := strconv.Itoa(utils.GetFlagValue[int](parser, "port"))
 		cert := utils.GetFlagValue[string](parser, "cert")
 		key := utils.GetFlagValue[string](parser, "key")
 		tlsMinVersion := utils.GetFlagValue[uint16](parser, "tls-version")
+		enableH2C := utils.GetFlagValue[bool](parser, "h2c")
+		enableHTTP3 := utils.GetFlagValue[bool](parser, "http3")
+		enableCompression := utils.GetFlagValue[bool](parser, "compress")
+		unavailableBrokenRoutes := utils.GetFlagValue[bool](parser, "unavailable-broken-routes")
+		reusePort := utils.GetFlagValue[bool](parser, "reuse-port")
 		clientCA := utils.GetFlagValue[string](parser, "client-ca")
+		clientCARoutes := utils.GetFlagValue[string](parser, "client-ca-routes")
 		authConfig := utils.GetFlagValue[string](parser, "auth-config")
+		cacheConfigPath := utils.GetFlagValue[string](parser, "cache-config")
+		rateLimit := utils.GetFlagValue[float64](parser, "rate-limit")
+		maxClientConcurrency := utils.GetFlagValue[int](parser, "max-client-connections")
+		maxConcurrency := utils.GetFlagValue[int](parser, "max-connections")
+		allowIPs := utils.GetFlagValue[string](parser, "allow-ips")
+		denyIPs := utils.GetFlagValue[string](parser, "deny-ips")
+		trustedProxies := utils.GetFlagValue[string](parser, "trusted-proxies")
+		webhookSecretFile := utils.GetFlagValue[string](parser, "webhook-secret-file")
+		adminTokenFile := utils.GetFlagValue[string](parser, "admin-token-file")
+		redirectURL := utils.GetFlagValue[string](parser, "redirect-url")
+		pathPrefix := utils.GetFlagValue[string](parser, "path-prefix")
+		vhostConfigPath := utils.GetFlagValue[string](parser, "vhost-config")
+		autoUpdateInterval := utils.GetFlagValue[time.Duration](parser, "auto-update")
+		maxUpdates := utils.GetFlagValue[int](parser, "max-updates")
+		otlpEndpoint := utils.GetFlagValue[string](parser, "otlp-endpoint")
+		auditLogTarget := utils.GetFlagValue[string](parser, "audit-log")
+
+		// Export telemetry through the environment, so that the updates run by
+		// the server (as child processes) export to the same collector.
+		if otlpEndpoint != "" {
+			os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", otlpEndpoint)
+		}
 
 		// Configure auth
-		var err error
 		middlewareAuthorize := authFunc(nil)
 		if authConfig != "" {
 			middleware, err := parseAuthConfig(authConfig)
@@ -156,27 +217,153 @@ func main() {
 			middlewareAuthorize = middleware.Authorize
 		}
 
+		// Configure caching
+		cacheConfig := defaultCacheConfig()
+		if cacheConfigPath != "" {
+			var err error
+			cacheConfig, err = parseCacheConfig(cacheConfigPath)
+			if err != nil {
+				logger.Fatalf(ctx, "Invalid cache config: %w", err)
+			}
+		}
+
+		// Configure virtual hosts
+		var vhosts virtualHosts
+		if vhostConfigPath != "" {
+			vhostConfig, err := parseVirtualHostConfig(vhostConfigPath)
+			if err != nil {
+				logger.Fatalf(ctx, "Invalid virtual host config: %w", err)
+			}
+			vhosts = newVirtualHosts(ctx, logger, container, vhostConfig)
+		}
+
+		// Configure client IP handling
+		allowedIPNets, err := parseIPNets(allowIPs)
+		if err != nil {
+			logger.Fatalf(ctx, "Invalid '--allow-ips': %w", err)
+		}
+		deniedIPNets, err := parseIPNets(denyIPs)
+		if err != nil {
+			logger.Fatalf(ctx, "Invalid '--deny-ips': %w", err)
+		}
+		trustedProxyIPNets, err := parseIPNets(trustedProxies)
+		if err != nil {
+			logger.Fatalf(ctx, "Invalid '--trusted-proxies': %w", err)
+		}
+
+		// Configure webhooks
+		updater := newRouteUpdater(logger, appLogger, container,
+			utils.GetDependency[jobs.JobQueue](ctx, container), maxUpdates)
+		var webhook *webhookHandler
+		if webhookSecretFile != "" {
+			webhook, err = newWebhookHandler(logger, appLogger, container, webhookSecretFile, updater)
+			if err != nil {
+				logger.Fatalf(ctx, "Invalid webhook config: %w", err)
+			}
+		}
+
+		// Configure the admin API
+		var admin *adminHandler
+		if adminTokenFile != "" {
+			admin, err = newAdminHandler(logger, appLogger, container, adminTokenFile, updater)
+			if err != nil {
+				logger.Fatalf(ctx, "Invalid admin API config: %w", err)
+			}
+		}
+
+		// Configure the audit log
+		var audit *auditLog
+		if auditLogTarget != "" {
+			audit, err = newAuditLog(ctx, appLogger, auditLogTarget)
+			if err != nil {
+				logger.Fatalf(ctx, "Invalid audit log config: %w", err)
+			}
+		}
+
+		// Parse the routes requiring client certificates
+		clientCARoutePatterns := []string{}
+		for _, pattern := range strings.Split(clientCARoutes, ",") {
+			pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+			if pattern != "" {
+				clientCARoutePatterns = append(clientCARoutePatterns, pattern)
+			}
+		}
+
 		// Configure the server
-		bundleServer, err := NewBundleWebServer(logger,
+		bundleServer, err := NewBundleWebServer(logger, appLogger, container,
 			port,
 			cert, key,
 			tlsMinVersion,
 			clientCA,
+			clientCARoutePatterns,
 			middlewareAuthorize,
+			cacheConfig,
+			redirectURL,
+			normalizePathPrefix(pathPrefix),
+			vhosts,
+			enableH2C,
+			enableHTTP3,
+			enableCompression,
+			unavailableBrokenRoutes,
+			reusePort,
+			newRateLimiter(rateLimit, maxClientConcurrency, maxConcurrency),
+			newIPFilter(allowedIPNets, deniedIPNets),
+			&clientIPResolver{trustedProxies: trustedProxyIPNets},
+			webhook,
+			admin,
+			audit,
 		)
 		if err != nil {
 			logger.Fatal(ctx, err)
 		}
 
+		// Run the queued updates if anything queues updates (otherwise, the
+		// bundle server's root is left untouched)
+		if webhook != nil || admin != nil || autoUpdateInterval > 0 {
+			err = updater.Start(ctx)
+			if err != nil {
+				logger.Fatalf(ctx, "Failed to start background updates: %w", err)
+			}
+		}
+
 		// Start the server asynchronously
 		bundleServer.StartServerAsync(ctx)
 
+		// Start the background update scheduler, if configured
+		var scheduler *updateScheduler
+		if autoUpdateInterval > 0 {
+			scheduler = newUpdateScheduler(logger, appLogger, container, updater, autoUpdateInterval)
+			scheduler.Start(ctx)
+		}
+
+		// Notify when the TLS certificate is about to expire, if
+		// notifications are configured
+		var certChecker *certExpiryChecker
+		if notifier := utils.GetDependency[*notify.Notifier](ctx, container); notifier != nil && cert != "" {
+			certChecker = newCertExpiryChecker(logger, appLogger, notifier, cert)
+			certChecker.Start(ctx)
+		}
+
 		// Intercept interrupt signals
 		bundleServer.HandleSignalsAsync(ctx)
 
 		// Wait for server to shut down
 		bundleServer.Wait()
 
-		fmt.Println("Shutdown complete")
+		// Stop scheduling updates & wait for any in-progress updates
+		if scheduler != nil {
+			scheduler.Stop()
+		}
+		if certChecker != nil {
+			certChecker.Stop()
+		}
+		updater.Wait()
+
+		// Send any audit events not yet sent
+		if audit != nil {
+			audit.Close()
+		}
+
+		appLogger.Infof(ctx, "Shutdown complete")
 	})
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// How often idle per-client state is pruned from the rate limiter.
+const rateLimitPruneInterval = time.Minute
+
+type clientLimitState struct {
+	// Token bucket state for requests/second limiting
+	tokens     float64
+	lastRefill time.Time
+
+	// Number of in-flight requests
+	active int
+}
+
+type rateLimiter struct {
+	// Configuration
+	requestsPerSecond    float64
+	burst                float64
+	maxClientConcurrency int
+	maxGlobalConcurrency int
+
+	// State
+	lock         sync.Mutex
+	clients      map[string]*clientLimitState
+	globalActive int
+	lastPrune    time.Time
+
+	now func() time.Time
+}
+
+// newRateLimiter creates a rateLimiter with the given limits. A limit of 0
+// disables that limit. If all limits are disabled, newRateLimiter returns nil.
+func newRateLimiter(requestsPerSecond float64, maxClientConcurrency int, maxGlobalConcurrency int) *rateLimiter {
+	if requestsPerSecond <= 0 && maxClientConcurrency <= 0 && maxGlobalConcurrency <= 0 {
+		return nil
+	}
+
+	// Allow a client to burst up to one second's worth of requests (but
+	// always at least one request).
+	burst := math.Max(1, requestsPerSecond)
+
+	return &rateLimiter{
+		requestsPerSecond:    requestsPerSecond,
+		burst:                burst,
+		maxClientConcurrency: maxClientConcurrency,
+		maxGlobalConcurrency: maxGlobalConcurrency,
+		clients:              make(map[string]*clientLimitState),
+		now:                  time.Now,
+	}
+}
+
+func (l *rateLimiter) pruneClients(now time.Time) {
+	if now.Sub(l.lastPrune) < rateLimitPruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	for ip, state := range l.clients {
+		l.refill(state, now)
+		if state.active == 0 && state.tokens >= l.burst {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+func (l *rateLimiter) refill(state *clientLimitState, now time.Time) {
+	if l.requestsPerSecond <= 0 {
+		return
+	}
+	elapsed := now.Sub(state.lastRefill).Seconds()
+	state.tokens = math.Min(l.burst, state.tokens+elapsed*l.requestsPerSecond)
+	state.lastRefill = now
+}
+
+// acquire attempts to reserve capacity for a request from the given client. If
+// the request is allowed, it returns a function that must be called when the
+// request is complete. Otherwise, it returns the duration after which the
+// client should retry.
+func (l *rateLimiter) acquire(clientIP string) (func(), time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	l.pruneClients(now)
+
+	state, ok := l.clients[clientIP]
+	if !ok {
+		state = &clientLimitState{tokens: l.burst, lastRefill: now}
+		l.clients[clientIP] = state
+	}
+
+	if l.maxGlobalConcurrency > 0 && l.globalActive >= l.maxGlobalConcurrency {
+		return nil, time.Second
+	}
+	if l.maxClientConcurrency > 0 && state.active >= l.maxClientConcurrency {
+		return nil, time.Second
+	}
+	if l.requestsPerSecond > 0 {
+		l.refill(state, now)
+		if state.tokens < 1 {
+			wait := (1 - state.tokens) / l.requestsPerSecond
+			return nil, time.Duration(wait * float64(time.Second))
+		}
+		state.tokens--
+	}
+
+	state.active++
+	l.globalActive++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+			state.active--
+			l.globalActive--
+		})
+	}, 0
+}
+
+// remoteIP gets the IP address of the direct peer of the request.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Middleware wraps the given handler, responding with '429 Too Many Requests'
+// (and an appropriate 'Retry-After' header) if the request exceeds any of the
+// configured limits.
+func (l *rateLimiter) Middleware(appLogger log.AppLogger, clientIP func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, retryAfter := l.acquire(clientIP(r))
+		if release == nil {
+			retrySeconds := int(math.Ceil(retryAfter.Seconds()))
+			if retrySeconds < 1 {
+				retrySeconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(retrySeconds))
+			serveError(w, http.StatusTooManyRequests, errorRateLimited, "", "too many requests")
+			appLogger.Warnf(r.Context(), "Rate limit exceeded for client %s", clientIP(r))
+			return
+		}
+		defer release()
+
+		next.ServeHTTP(w, r)
+	})
+}
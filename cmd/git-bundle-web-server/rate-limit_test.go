@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("No limits returns nil limiter", func(t *testing.T) {
+		assert.Nil(t, newRateLimiter(0, 0, 0))
+	})
+
+	t.Run("Requests per second limit", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		limiter := newRateLimiter(2, 0, 0)
+		limiter.now = func() time.Time { return now }
+
+		// Burst of two requests allowed
+		for i := 0; i < 2; i++ {
+			release, _ := limiter.acquire("1.2.3.4")
+			assert.NotNil(t, release)
+			release()
+		}
+
+		// Third is rejected, and should retry after half a second
+		release, retryAfter := limiter.acquire("1.2.3.4")
+		assert.Nil(t, release)
+		assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+		// Other clients are unaffected
+		release, _ = limiter.acquire("5.6.7.8")
+		assert.NotNil(t, release)
+
+		// Token is refilled after waiting
+		now = now.Add(500 * time.Millisecond)
+		release, _ = limiter.acquire("1.2.3.4")
+		assert.NotNil(t, release)
+	})
+
+	t.Run("Per-client concurrency limit", func(t *testing.T) {
+		limiter := newRateLimiter(0, 1, 0)
+
+		release, _ := limiter.acquire("1.2.3.4")
+		assert.NotNil(t, release)
+
+		blocked, retryAfter := limiter.acquire("1.2.3.4")
+		assert.Nil(t, blocked)
+		assert.Equal(t, time.Second, retryAfter)
+
+		other, _ := limiter.acquire("5.6.7.8")
+		assert.NotNil(t, other)
+
+		// Releasing more than once has no additional effect
+		release()
+		release()
+		release, _ = limiter.acquire("1.2.3.4")
+		assert.NotNil(t, release)
+		blocked, _ = limiter.acquire("1.2.3.4")
+		assert.Nil(t, blocked)
+	})
+
+	t.Run("Global concurrency limit", func(t *testing.T) {
+		limiter := newRateLimiter(0, 0, 2)
+
+		first, _ := limiter.acquire("1.2.3.4")
+		second, _ := limiter.acquire("5.6.7.8")
+		assert.NotNil(t, first)
+		assert.NotNil(t, second)
+
+		blocked, _ := limiter.acquire("9.10.11.12")
+		assert.Nil(t, blocked)
+
+		first()
+		third, _ := limiter.acquire("9.10.11.12")
+		assert.NotNil(t, third)
+	})
+}
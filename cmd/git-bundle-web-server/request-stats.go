@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/admin"
+)
+
+const (
+	// The requests of the last 15 minutes are counted in 10-second buckets,
+	// so recent counts are accurate to within 10 seconds.
+	requestStatsBucket  time.Duration = 10 * time.Second
+	requestStatsBuckets int           = int(15 * time.Minute / requestStatsBucket)
+)
+
+type requestBucket struct {
+	// The index of the bucket's period since the epoch.
+	period int64
+	counts admin.RequestCounts
+}
+
+// requestStats counts the requests answered by the web server, in total and
+// over recent periods, for the admin API.
+type requestStats struct {
+	lock    sync.Mutex
+	total   admin.RequestCounts
+	buckets [requestStatsBuckets]requestBucket
+}
+
+func newRequestStats() *requestStats {
+	return &requestStats{}
+}
+
+func period(t time.Time) int64 {
+	return t.UnixNano() / int64(requestStatsBucket)
+}
+
+// record counts a request answered with the given status at the given time.
+func (s *requestStats) record(now time.Time, status int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.total.Add(status)
+
+	p := period(now)
+	bucket := &s.buckets[p%int64(requestStatsBuckets)]
+	if bucket.period != p {
+		*bucket = requestBucket{period: p}
+	}
+	bucket.counts.Add(status)
+}
+
+// recent returns the counts of the requests answered within 'window' (at most
+// 15 minutes) before 'now'.
+func (s *requestStats) recent(now time.Time, window time.Duration) admin.RequestCounts {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p := period(now)
+	oldest := p - int64(window/requestStatsBucket) + 1
+	counts := admin.RequestCounts{}
+	for _, bucket := range s.buckets {
+		if bucket.period >= oldest && bucket.period <= p {
+			counts.Total += bucket.counts.Total
+			counts.ClientErrors += bucket.counts.ClientErrors
+			counts.ServerErrors += bucket.counts.ServerErrors
+		}
+	}
+	return counts
+}
+
+// totals returns the counts of all requests answered since the server started.
+func (s *requestStats) totals() admin.RequestCounts {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.total
+}
+
+// countRequests wraps 'next' to count the requests it answers in 'stats'.
+func countRequests(stats *requestStats, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		stats.record(time.Now(), recorder.status)
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/admin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestStats(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	stats := newRequestStats()
+
+	stats.record(now.Add(-20*time.Minute), http.StatusOK)
+	stats.record(now.Add(-10*time.Minute), http.StatusNotFound)
+	stats.record(now.Add(-30*time.Second), http.StatusOK)
+	stats.record(now, http.StatusServiceUnavailable)
+
+	assert.Equal(t, admin.RequestCounts{Total: 2, ServerErrors: 1}, stats.recent(now, time.Minute))
+	assert.Equal(t, admin.RequestCounts{Total: 3, ClientErrors: 1, ServerErrors: 1}, stats.recent(now, 15*time.Minute))
+	assert.Equal(t, admin.RequestCounts{Total: 4, ClientErrors: 1, ServerErrors: 1}, stats.totals())
+
+	// Old buckets are reused for new periods
+	later := now.Add(15 * time.Minute)
+	stats.record(later, http.StatusOK)
+	assert.Equal(t, admin.RequestCounts{Total: 1}, stats.recent(later, 15*time.Minute))
+}
+
+func TestCountRequests(t *testing.T) {
+	stats := newRequestStats()
+	handler := countRequests(stats, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	for _, path := range []string{"/test/repo", "/missing", "/test/repo"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Equal(t, admin.RequestCounts{Total: 3, ClientErrors: 1}, stats.totals())
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// routeHealth records the routes whose web directory or bundle list was
+// missing when they were last checked. Routes are checked at startup (see
+// 'validate'), and each broken route is checked again whenever it is
+// requested, so a route is no longer broken once it is repaired (e.g. by
+// 'git-bundle-server update'). It is safe for concurrent use.
+type routeHealth struct {
+	lock   sync.RWMutex
+	broken map[string]string
+}
+
+func newRouteHealth() *routeHealth {
+	return &routeHealth{
+		broken: map[string]string{},
+	}
+}
+
+// checkRoute returns a description of what is missing from the repository's
+// web directory, or an empty string if nothing is.
+func checkRoute(fileSystem common.FileSystem, repo *core.Repository) string {
+	info, err := fileSystem.Stat(repo.WebDir)
+	if err != nil {
+		return fmt.Sprintf("web directory '%s' is missing", repo.WebDir)
+	} else if !info.IsDir() {
+		return fmt.Sprintf("web directory '%s' is not a directory", repo.WebDir)
+	}
+
+	for _, filename := range []string{bundles.BundleListFilename, bundles.RepoBundleListFilename} {
+		exists, err := fileSystem.FileExists(filepath.Join(repo.WebDir, filename))
+		if err != nil || !exists {
+			return fmt.Sprintf("bundle list '%s' is missing", filename)
+		}
+	}
+	return ""
+}
+
+// validate checks every enabled route of the repository provider, logging a
+// warning for each broken route, and returns the number of broken routes.
+func (h *routeHealth) validate(ctx context.Context,
+	logger log.TraceLogger,
+	appLogger log.AppLogger,
+	fileSystem common.FileSystem,
+	repoProvider core.RepositoryProvider,
+) (int, error) {
+	ctx, exitRegion := logger.Region(ctx, "http", "validate_routes")
+	defer exitRegion()
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	broken := map[string]string{}
+	for route, repo := range repos {
+		if repo.Disabled {
+			continue
+		}
+		if problem := checkRoute(fileSystem, &repo); problem != "" {
+			broken[route] = problem
+		}
+	}
+
+	h.lock.Lock()
+	h.broken = broken
+	h.lock.Unlock()
+
+	routes := make([]string, 0, len(broken))
+	for route := range broken {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		appLogger.Warnf(ctx, "Route %s is broken: %s", route, broken[route])
+	}
+	logger.Data(ctx, "http", "broken_routes", len(broken))
+	return len(broken), nil
+}
+
+// isBroken returns whether the repository's route was found to be broken (and
+// why). A broken route is checked again, so that it is no longer reported once
+// it is repaired.
+func (h *routeHealth) isBroken(fileSystem common.FileSystem, repo *core.Repository) (string, bool) {
+	h.lock.RLock()
+	_, isBroken := h.broken[repo.Route]
+	h.lock.RUnlock()
+	if !isBroken {
+		return "", false
+	}
+
+	problem := checkRoute(fileSystem, repo)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if problem == "" {
+		delete(h.broken, repo.Route)
+		return "", false
+	}
+	h.broken[repo.Route] = problem
+	return problem, true
+}
+
+// serveBrokenRoute responds to a request for a broken route with '503 Service
+// Unavailable', so that clients can tell it apart from a route that is
+// unavailable for other reasons (e.g. disabled).
+func serveBrokenRoute(w http.ResponseWriter, route string, problem string) {
+	serveError(w, http.StatusServiceUnavailable, errorRouteUnavailable, route, problem)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+var checkRouteTests = []struct {
+	title string
+
+	createWebDir bool
+	files        []string
+
+	expectedProblem string
+}{
+	{
+		"Healthy route",
+		true,
+		[]string{bundles.BundleListFilename, bundles.RepoBundleListFilename},
+		"",
+	},
+	{
+		"Missing web directory",
+		false,
+		nil,
+		"web directory '<webdir>' is missing",
+	},
+	{
+		"Missing bundle list",
+		true,
+		[]string{bundles.RepoBundleListFilename},
+		"bundle list 'bundle-list' is missing",
+	},
+	{
+		"Missing repo bundle list",
+		true,
+		[]string{bundles.BundleListFilename},
+		"bundle list 'repo-bundle-list' is missing",
+	},
+}
+
+func TestCheckRoute(t *testing.T) {
+	fileSystem := common.NewFileSystem()
+	for _, tt := range checkRouteTests {
+		t.Run(tt.title, func(t *testing.T) {
+			repo := &core.Repository{
+				Route:  "test/repo",
+				WebDir: filepath.Join(t.TempDir(), "test", "repo"),
+			}
+			if tt.createWebDir {
+				assert.Nil(t, os.MkdirAll(repo.WebDir, 0755))
+			}
+			for _, filename := range tt.files {
+				assert.Nil(t, os.WriteFile(filepath.Join(repo.WebDir, filename), []byte{}, 0644))
+			}
+
+			expectedProblem := strings.ReplaceAll(tt.expectedProblem, "<webdir>", repo.WebDir)
+			assert.Equal(t, expectedProblem, checkRoute(fileSystem, repo))
+		})
+	}
+}
+
+func TestRouteHealth_IsBroken(t *testing.T) {
+	fileSystem := common.NewFileSystem()
+	repo := &core.Repository{
+		Route:  "test/repo",
+		WebDir: filepath.Join(t.TempDir(), "test", "repo"),
+	}
+	otherRepo := &core.Repository{
+		Route:  "test/other",
+		WebDir: filepath.Join(t.TempDir(), "test", "other"),
+	}
+
+	health := newRouteHealth()
+	health.broken[repo.Route] = "web directory is missing"
+
+	// Routes not found to be broken are not checked again.
+	_, isBroken := health.isBroken(fileSystem, otherRepo)
+	assert.False(t, isBroken)
+
+	problem, isBroken := health.isBroken(fileSystem, repo)
+	assert.True(t, isBroken)
+	assert.Equal(t, "web directory '"+repo.WebDir+"' is missing", problem)
+
+	// Once the route is repaired, it is no longer broken.
+	assert.Nil(t, os.MkdirAll(repo.WebDir, 0755))
+	for _, filename := range []string{bundles.BundleListFilename, bundles.RepoBundleListFilename} {
+		assert.Nil(t, os.WriteFile(filepath.Join(repo.WebDir, filename), []byte{}, 0644))
+	}
+	_, isBroken = health.isBroken(fileSystem, repo)
+	assert.False(t, isBroken)
+	assert.NotContains(t, health.broken, repo.Route)
+}
+
+func TestServeBrokenRoute(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveBrokenRoute(w, "test/repo", "bundle list 'bundle-list' is missing")
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var body errorResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, errorResponse{
+		Error:   "route_unavailable",
+		Route:   "test/repo",
+		Message: "bundle list 'bundle-list' is missing",
+	}, body)
+}
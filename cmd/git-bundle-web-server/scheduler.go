@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/jobs"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// updateScheduler periodically updates all routes registered to the bundle
+// server. Rather than updating every route at once, the updates in each cycle
+// are spread out evenly across the update interval (with some random jitter)
+// to avoid overloading the host and the upstream remotes.
+type updateScheduler struct {
+	logger    log.TraceLogger
+	appLogger log.AppLogger
+	container *utils.DependencyContainer
+	updater   *routeUpdater
+	interval  time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+	rand *rand.Rand
+}
+
+func newUpdateScheduler(logger log.TraceLogger,
+	appLogger log.AppLogger,
+	container *utils.DependencyContainer,
+	updater *routeUpdater,
+	interval time.Duration,
+) *updateScheduler {
+	return &updateScheduler{
+		logger:    logger,
+		appLogger: appLogger,
+		container: container,
+		updater:   updater,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// routeOffsets computes the delay, relative to the start of an update cycle,
+// at which each route should be updated.
+func (s *updateScheduler) routeOffsets(routes []core.Repository) []time.Duration {
+	offsets := make([]time.Duration, len(routes))
+	if len(routes) == 0 {
+		return offsets
+	}
+
+	slot := s.interval / time.Duration(len(routes))
+	for i := range routes {
+		// Jitter up to half of the route's slot so that updates never overlap
+		// with the next slot.
+		jitter := time.Duration(0)
+		if slot > 1 {
+			jitter = time.Duration(s.rand.Int63n(int64(slot / 2)))
+		}
+		offsets[i] = time.Duration(i)*slot + jitter
+	}
+	return offsets
+}
+
+func (s *updateScheduler) getRoutes(ctx context.Context, repoProvider core.RepositoryProvider) ([]core.Repository, error) {
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]core.Repository, 0, len(repos))
+	for _, repo := range repos {
+		if !repo.Disabled {
+			routes = append(routes, repo)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Route < routes[j].Route })
+	return routes, nil
+}
+
+// isDue checks whether a route with a custom update interval (see
+// 'git-bundle-server update-schedule') is due for an update. Routes without a
+// custom interval are updated every cycle.
+func (s *updateScheduler) isDue(ctx context.Context, repoProvider core.RepositoryProvider, repo *core.Repository) bool {
+	if repo.UpdateInterval == 0 {
+		return true
+	}
+
+	lastUpdate, err := repoProvider.GetLastUpdateTime(ctx, repo)
+	if err != nil {
+		// Can't determine whether it's due, so update to be safe
+		return true
+	}
+	return repo.IsUpdateDue(lastUpdate, time.Now())
+}
+
+// wait pauses until the given time, returning false if the scheduler is
+// stopped in the meantime.
+func (s *updateScheduler) wait(until time.Time) bool {
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+
+	select {
+	case <-s.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (s *updateScheduler) runCycle(ctx context.Context) bool {
+	ctx, exitRegion := s.logger.Region(ctx, "scheduler", "update_cycle")
+	defer exitRegion()
+
+	cycleStart := time.Now()
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, s.container)
+	routes, err := s.getRoutes(ctx, repoProvider)
+	if err != nil {
+		s.appLogger.Errorf(ctx, "Scheduled update failed to load routes: %s", err)
+	}
+
+	for i, offset := range s.routeOffsets(routes) {
+		if !s.wait(cycleStart.Add(offset)) {
+			return false
+		}
+
+		if !s.isDue(ctx, repoProvider, &routes[i]) {
+			continue
+		}
+
+		_, _, err := s.updater.StartUpdate(ctx, routes[i].Route, "scheduled", jobs.PriorityLow)
+		if err != nil {
+			s.appLogger.Errorf(ctx, "Failed to start scheduled update for %s: %s", routes[i].Route, err)
+		}
+	}
+
+	return s.wait(cycleStart.Add(s.interval))
+}
+
+// Start begins running update cycles in the background until Stop is called.
+func (s *updateScheduler) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ctx, exitThread := s.logger.Goroutine(ctx, "scheduler")
+		defer exitThread()
+
+		// Wait a random fraction of the interval before starting the first
+		// cycle so that restarting the server doesn't trigger an immediate
+		// flood of updates.
+		if !s.wait(time.Now().Add(time.Duration(s.rand.Int63n(int64(s.interval))))) {
+			return
+		}
+		for s.runCycle(ctx) {
+		}
+	}()
+}
+
+// Stop halts the scheduler and waits for it to exit. Updates that have already
+// started are not interrupted.
+func (s *updateScheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
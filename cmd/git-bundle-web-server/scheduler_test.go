@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateScheduler_RouteOffsets(t *testing.T) {
+	logger := &MockTraceLogger{}
+	interval := time.Hour
+	scheduler := newUpdateScheduler(logger, log.NopAppLogger(), nil, newRouteUpdater(logger, log.NopAppLogger(), nil, nil, 1), interval)
+
+	t.Run("No routes", func(t *testing.T) {
+		assert.Empty(t, scheduler.routeOffsets([]core.Repository{}))
+	})
+
+	for _, count := range []int{1, 2, 7, 60} {
+		t.Run(fmt.Sprintf("%d routes are staggered", count), func(t *testing.T) {
+			routes := make([]core.Repository, count)
+			offsets := scheduler.routeOffsets(routes)
+			assert.Len(t, offsets, count)
+
+			slot := interval / time.Duration(count)
+			for i, offset := range offsets {
+				// Each offset falls in the first half of its own slot
+				assert.GreaterOrEqual(t, offset, time.Duration(i)*slot)
+				assert.Less(t, offset, time.Duration(i)*slot+slot/2)
+			}
+		})
+	}
+}
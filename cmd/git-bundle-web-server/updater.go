@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/admin"
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/jobs"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// detachedContext keeps the values of its parent context, but is never
+// cancelled.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// routeUpdater runs 'git-bundle-server update' for routes in the background on
+// behalf of the web server. The updates are queued in the bundle server's job
+// queue, which runs at most one update per route at a time, and at most
+// 'maxUpdates' updates overall. No update is started while the bundle server is
+// read-only (see 'git-bundle-server read-only').
+type routeUpdater struct {
+	logger    log.TraceLogger
+	appLogger log.AppLogger
+	container *utils.DependencyContainer
+	queue     jobs.JobQueue
+	runner    *jobs.Runner
+	started   bool
+
+	// The read-only mode found when last starting updates, if on
+	readOnlyLock sync.Mutex
+	readOnly     *core.ReadOnlyMode
+}
+
+func newRouteUpdater(logger log.TraceLogger,
+	appLogger log.AppLogger,
+	container *utils.DependencyContainer,
+	queue jobs.JobQueue,
+	maxUpdates int,
+) *routeUpdater {
+	u := &routeUpdater{
+		logger:    logger,
+		appLogger: appLogger,
+		container: container,
+		queue:     queue,
+	}
+	u.runner = jobs.NewRunner(logger, appLogger, queue, maxUpdates, u.runUpdate)
+	u.runner.SetPauseFunc(u.checkReadOnly)
+	return u
+}
+
+// checkReadOnly returns whether the bundle server is read-only, logging when
+// the background updates are paused or resumed as a result.
+func (u *routeUpdater) checkReadOnly(ctx context.Context) bool {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, u.container)
+	mode, err := repoProvider.GetReadOnlyMode(ctx)
+	if err != nil {
+		// The updates report the unreadable registry themselves
+		u.appLogger.Warnf(ctx, "Failed to check read-only mode: %s", err)
+		return false
+	}
+
+	u.readOnlyLock.Lock()
+	defer u.readOnlyLock.Unlock()
+	if mode != nil && u.readOnly == nil {
+		u.appLogger.Infof(ctx, "Pausing background updates: the bundle server is read-only")
+	} else if mode == nil && u.readOnly != nil {
+		u.appLogger.Infof(ctx, "Resuming background updates: the bundle server is no longer read-only")
+	}
+	u.readOnly = mode
+	return mode != nil
+}
+
+// ReadOnly returns the read-only mode pausing the background updates, if on.
+func (u *routeUpdater) ReadOnly() *core.ReadOnlyMode {
+	u.readOnlyLock.Lock()
+	defer u.readOnlyLock.Unlock()
+	return u.readOnly
+}
+
+// Start runs the queued updates, including those queued (or interrupted) when
+// the web server last ran, in the background until Wait is called.
+func (u *routeUpdater) Start(ctx context.Context) error {
+	// Detach from the caller's context so the updates are only stopped when
+	// they are cancelled in the queue.
+	err := u.runner.Start(detachedContext{ctx})
+	if err != nil {
+		return err
+	}
+	u.started = true
+	return nil
+}
+
+// StartUpdate queues an update of the given route with the given priority,
+// unless one is already pending. The 'reason' identifies what triggered the
+// update in the output. Returns the pending job, and whether it was queued by
+// this call.
+func (u *routeUpdater) StartUpdate(ctx context.Context, route string, reason string, priority jobs.Priority) (jobs.Job, bool, error) {
+	job, queued, err := u.queue.Enqueue(ctx, route, reason, priority)
+	if err != nil {
+		return jobs.Job{}, false, err
+	}
+	u.runner.Notify()
+	return job, queued, nil
+}
+
+// runUpdate runs the update of a job, stopping it if the job is cancelled.
+func (u *routeUpdater) runUpdate(ctx context.Context, job jobs.Job) error {
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, u.container)
+	exe, err := fileSystem.GetLocalExecutable("git-bundle-server")
+	if err != nil {
+		return err
+	}
+
+	commandExecutor := utils.GetDependency[cmd.CommandExecutor](ctx, u.container)
+	exitCode, err := commandExecutor.RunStdout(ctx, exe, "update", job.Route)
+	if err != nil {
+		return err
+	} else if exitCode != 0 {
+		return fmt.Errorf("'git-bundle-server update' exited with status %d", exitCode)
+	}
+	return nil
+}
+
+// InProgress returns the updates in progress, sorted by route.
+func (u *routeUpdater) InProgress() []admin.Update {
+	running := u.runner.Running()
+	updates := make([]admin.Update, 0, len(running))
+	for _, job := range running {
+		updates = append(updates, admin.Update{Route: job.Route, Reason: job.Reason, StartedAt: *job.StartedAt})
+	}
+	return updates
+}
+
+// Wait stops starting queued updates and blocks until all in-progress updates
+// are complete. The updates still pending run when the web server next starts.
+func (u *routeUpdater) Wait() {
+	if u.started {
+		u.runner.Stop()
+	}
+}
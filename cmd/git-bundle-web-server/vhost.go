@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// virtualHost is a bundle server, with routes and storage of its own, served
+// to the requests for one host name.
+type virtualHost struct {
+	roots        core.StorageRoots
+	repoProvider core.CachedRepositoryProvider
+	routeHealth  *routeHealth
+}
+
+// virtualHosts maps host names (in lower case, without a port) to the virtual
+// hosts serving them.
+type virtualHosts map[string]*virtualHost
+
+type virtualHostConfig struct {
+	// The storage roots of each virtual host, keyed by host name.
+	Hosts map[string]core.StorageRoots `json:"hosts"`
+}
+
+// normalizeHost converts a host name to the form used as the key of
+// virtualHosts: in lower case, without a port or a trailing dot.
+func normalizeHost(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func parseVirtualHostConfig(configPath string) (map[string]core.StorageRoots, error) {
+	fileBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var userConfig virtualHostConfig
+	err = json.Unmarshal(fileBytes, &userConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]core.StorageRoots, len(userConfig.Hosts))
+	for host, roots := range userConfig.Hosts {
+		name := normalizeHost(host)
+		if name == "" || strings.ContainsAny(name, "/:") {
+			return nil, fmt.Errorf("invalid host name '%s'", host)
+		}
+		if _, contains := config[name]; contains {
+			return nil, fmt.Errorf("host '%s' is configured more than once", name)
+		}
+		if roots.Root == "" {
+			return nil, fmt.Errorf("host '%s' has no 'root'", host)
+		}
+		for _, root := range []string{roots.Root, roots.RepoRoot, roots.WebRoot} {
+			if root != "" && !filepath.IsAbs(root) {
+				return nil, fmt.Errorf("root '%s' of host '%s' is not an absolute path", root, host)
+			}
+		}
+		config[name] = roots
+	}
+
+	return config, nil
+}
+
+// newVirtualHosts creates the virtual hosts with the given storage roots, each
+// caching its routes like the web server's own repository provider.
+func newVirtualHosts(ctx context.Context,
+	logger log.TraceLogger,
+	container *utils.DependencyContainer,
+	config map[string]core.StorageRoots,
+) virtualHosts {
+	userProvider := utils.GetDependency[common.UserProvider](ctx, container)
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, container)
+	gitHelper := utils.GetDependency[git.GitHelper](ctx, container)
+
+	hosts := make(virtualHosts, len(config))
+	for host, roots := range config {
+		hosts[host] = &virtualHost{
+			roots: roots,
+			repoProvider: core.NewCachedRepositoryProvider(logger,
+				core.NewRepositoryProviderWithRoots(logger, userProvider, fileSystem, gitHelper, roots),
+				roots,
+				userProvider,
+				fileSystem,
+			),
+		}
+	}
+	return hosts
+}
+
+// forRequest returns the virtual host serving the request, or nil if the
+// request is for any other host (and is served from the web server's own
+// storage roots).
+func (v virtualHosts) forRequest(r *http.Request) *virtualHost {
+	return v[normalizeHost(r.Host)]
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+var parseVirtualHostConfigTests = []struct {
+	title string
+
+	config string
+
+	expectedConfig map[string]core.StorageRoots
+	expectErr      bool
+}{
+	{
+		"Hosts with roots",
+		`{"hosts": {"Bundles.Foo.com": {"root": "/srv/foo"}, "bundles.bar.com": {"root": "/srv/bar", "webRoot": "/var/www/bar"}}}`,
+		map[string]core.StorageRoots{
+			"bundles.foo.com": {Root: "/srv/foo"},
+			"bundles.bar.com": {Root: "/srv/bar", WebRoot: "/var/www/bar"},
+		},
+		false,
+	},
+	{
+		"No hosts",
+		`{}`,
+		map[string]core.StorageRoots{},
+		false,
+	},
+	{
+		"Missing root",
+		`{"hosts": {"bundles.foo.com": {"webRoot": "/var/www/foo"}}}`,
+		nil,
+		true,
+	},
+	{
+		"Relative root",
+		`{"hosts": {"bundles.foo.com": {"root": "srv/foo"}}}`,
+		nil,
+		true,
+	},
+	{
+		"Duplicate host",
+		`{"hosts": {"bundles.foo.com": {"root": "/srv/foo"}, "BUNDLES.FOO.COM": {"root": "/srv/bar"}}}`,
+		nil,
+		true,
+	},
+	{
+		"Invalid host",
+		`{"hosts": {"bundles.foo.com/path": {"root": "/srv/foo"}}}`,
+		nil,
+		true,
+	},
+}
+
+func TestParseVirtualHostConfig(t *testing.T) {
+	for _, tt := range parseVirtualHostConfigTests {
+		t.Run(tt.title, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "vhosts.json")
+			assert.Nil(t, os.WriteFile(configPath, []byte(tt.config), 0o644))
+
+			config, err := parseVirtualHostConfig(configPath)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedConfig, config)
+			}
+		})
+	}
+}
+
+func TestVirtualHosts_ForRequest(t *testing.T) {
+	foo := &virtualHost{roots: core.StorageRoots{Root: "/srv/foo"}}
+	vhosts := virtualHosts{"bundles.foo.com": foo}
+
+	for _, host := range []string{"bundles.foo.com", "Bundles.Foo.Com:8080", "bundles.foo.com."} {
+		r := httptest.NewRequest("GET", "/test/repo", nil)
+		r.Host = host
+		assert.Equal(t, foo, vhosts.forRequest(r), host)
+	}
+
+	r := httptest.NewRequest("GET", "/test/repo", nil)
+	r.Host = "bundles.bar.com"
+	assert.Nil(t, vhosts.forRequest(r))
+}
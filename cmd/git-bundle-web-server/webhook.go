@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/git-ecosystem/git-bundle-server/internal/jobs"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+const (
+	webhookPathPrefix string = "/-/hooks/"
+
+	// Webhook payloads for push events are typically a few kilobytes; anything
+	// larger than this is almost certainly not a valid request. The payload is
+	// buffered in memory to check its signature, so the limit also bounds the
+	// memory used by each request.
+	maxWebhookPayloadSize int64 = 1024 * 1024
+)
+
+// The subset of the GitHub and GitLab push event payloads needed to identify
+// the pushed repository.
+type webhookPayload struct {
+	Repository struct {
+		// GitHub
+		FullName string `json:"full_name"`
+		CloneUrl string `json:"clone_url"`
+		SshUrl   string `json:"ssh_url"`
+
+		// GitLab
+		GitHttpUrl string `json:"git_http_url"`
+		GitSshUrl  string `json:"git_ssh_url"`
+	} `json:"repository"`
+
+	// GitLab
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+}
+
+func (p *webhookPayload) remoteUrls() []string {
+	urls := []string{}
+	for _, url := range []string{
+		p.Repository.CloneUrl,
+		p.Repository.SshUrl,
+		p.Repository.GitHttpUrl,
+		p.Repository.GitSshUrl,
+	} {
+		if url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+func (p *webhookPayload) repoName() string {
+	if p.Repository.FullName != "" {
+		return p.Repository.FullName
+	}
+	return p.Project.PathWithNamespace
+}
+
+// cachedRemote is the remote URL of a repository, read when its Git config
+// had the given modification time and size.
+type cachedRemote struct {
+	url     string
+	modTime time.Time
+	size    int64
+}
+
+// remoteCache caches the remote URLs of the routes' repositories, so that
+// each webhook delivery doesn't run 'git remote get-url' for every route. A
+// repository's remote URL is only read again once its Git config changes
+// (e.g. because the route was deleted and initialized again).
+type remoteCache struct {
+	lock    sync.Mutex
+	remotes map[string]cachedRemote
+}
+
+// remoteUrls returns the remote URL of each of the given repositories, by
+// route. Repositories whose remote URL can't be read are left out.
+func (c *remoteCache) remoteUrls(ctx context.Context,
+	fileSystem common.FileSystem,
+	gitHelper git.GitHelper,
+	repos map[string]core.Repository,
+) map[string]string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	remotes := make(map[string]cachedRemote, len(repos))
+	urls := make(map[string]string, len(repos))
+	for route, repo := range repos {
+		info, err := fileSystem.Stat(filepath.Join(repo.RepoDir, "config"))
+		if err != nil {
+			continue
+		}
+
+		remote, contains := c.remotes[repo.RepoDir]
+		if !contains || !remote.modTime.Equal(info.ModTime()) || remote.size != info.Size() {
+			url, err := gitHelper.GetRemoteUrl(ctx, repo.RepoDir)
+			if err != nil {
+				continue
+			}
+			remote = cachedRemote{url: url, modTime: info.ModTime(), size: info.Size()}
+		}
+
+		// Only the repositories of registered routes are kept
+		remotes[repo.RepoDir] = remote
+		urls[route] = remote.url
+	}
+	c.remotes = remotes
+
+	return urls
+}
+
+// matchRoutes returns the routes configured for the repository in the
+// payload, sorted: every route whose remote URL (in 'remotes') matches the
+// payload's, or, if none does, the route named after the repository. Several
+// routes may mirror the same remote (e.g. with different refs).
+func matchRoutes(payload *webhookPayload,
+	repos map[string]core.Repository,
+	remotes map[string]string,
+) []string {
+	matches := []string{}
+	payloadUrls := payload.remoteUrls()
+	for route, remote := range remotes {
+		for _, url := range payloadUrls {
+			if strings.TrimSuffix(remote, ".git") == strings.TrimSuffix(url, ".git") {
+				matches = append(matches, route)
+				break
+			}
+		}
+	}
+	sort.Strings(matches)
+
+	if len(matches) == 0 {
+		if _, contains := repos[payload.repoName()]; contains {
+			matches = append(matches, payload.repoName())
+		}
+	}
+	return matches
+}
+
+type webhookHandler struct {
+	logger    log.TraceLogger
+	appLogger log.AppLogger
+	container *utils.DependencyContainer
+	secret    []byte
+	updater   *routeUpdater
+	remotes   remoteCache
+}
+
+func newWebhookHandler(logger log.TraceLogger,
+	appLogger log.AppLogger,
+	container *utils.DependencyContainer,
+	secretFile string,
+	updater *routeUpdater,
+) (*webhookHandler, error) {
+	secret, err := os.ReadFile(secretFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read webhook secret: %w", err)
+	}
+	secret = []byte(strings.TrimSpace(string(secret)))
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("webhook secret is empty")
+	}
+
+	return &webhookHandler{
+		logger:    logger,
+		appLogger: appLogger,
+		container: container,
+		secret:    secret,
+		updater:   updater,
+	}, nil
+}
+
+// validateGitHubSignature checks the HMAC-SHA256 signature of the payload in
+// the 'X-Hub-Signature-256' header.
+func (h *webhookHandler) validateGitHubSignature(r *http.Request, body []byte) bool {
+	signature, found := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if !found {
+		return false
+	}
+	signatureBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write(body)
+	return hmac.Equal(signatureBytes, mac.Sum(nil))
+}
+
+// validateGitLabToken checks the shared secret in the 'X-Gitlab-Token' header.
+func (h *webhookHandler) validateGitLabToken(r *http.Request) bool {
+	token := r.Header.Get("X-Gitlab-Token")
+	return subtle.ConstantTimeCompare([]byte(token), h.secret) == 1
+}
+
+// findRoutes identifies the routes configured for the repository in the
+// payload (see 'matchRoutes').
+func (h *webhookHandler) findRoutes(ctx context.Context, payload *webhookPayload) ([]string, error) {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, h.container)
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, h.container)
+	gitHelper := utils.GetDependency[git.GitHelper](ctx, h.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	remotes := h.remotes.remoteUrls(ctx, fileSystem, gitHelper, repos)
+	routes := matchRoutes(payload, repos, remotes)
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("no route configured for repository")
+	}
+	return routes, nil
+}
+
+func (h *webhookHandler) serve(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ctx, exitRegion := h.logger.Region(ctx, "http", "webhook")
+	defer exitRegion()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayloadSize))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	provider := strings.TrimPrefix(r.URL.Path, webhookPathPrefix)
+	var isValid, isPush bool
+	switch provider {
+	case "github":
+		isValid = h.validateGitHubSignature(r, body)
+		isPush = r.Header.Get("X-GitHub-Event") == "push"
+	case "gitlab":
+		isValid = h.validateGitLabToken(r)
+		isPush = r.Header.Get("X-Gitlab-Event") == "Push Hook"
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if !isValid {
+		w.WriteHeader(http.StatusUnauthorized)
+		h.appLogger.Warnf(ctx, "Rejected %s webhook with invalid signature", provider)
+		return
+	}
+
+	if !isPush {
+		// Acknowledge (but ignore) non-push events, e.g. 'ping'
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var payload webhookPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.appLogger.Warnf(ctx, "Failed to parse %s webhook payload: %s", provider, err)
+		return
+	}
+
+	routes, err := h.findRoutes(ctx, &payload)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		h.appLogger.Infof(ctx, "Failed to find route for %s webhook: %s", provider, err)
+		return
+	}
+
+	// Queue the updates of all of the routes, even if some fail
+	failed := false
+	for _, route := range routes {
+		_, queued, err := h.updater.StartUpdate(ctx, route, "webhook", jobs.PriorityNormal)
+		if err != nil {
+			failed = true
+			h.appLogger.Errorf(ctx, "Failed to queue update for %s: %s", route, err)
+		} else if queued {
+			h.appLogger.Infof(ctx, "Queued webhook-triggered update of %s", route)
+		} else {
+			h.appLogger.Infof(ctx, "Update of %s already queued", route)
+		}
+	}
+
+	if failed {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
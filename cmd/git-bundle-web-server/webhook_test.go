@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func githubSignature(secret string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var webhookValidationTests = []struct {
+	title string
+
+	method  string
+	path    string
+	headers map[string]string
+	body    string
+
+	expectedCode int
+}{
+	{
+		"Non-POST request is rejected",
+		"GET",
+		"/-/hooks/github",
+		map[string]string{},
+		"",
+		http.StatusMethodNotAllowed,
+	},
+	{
+		"Unknown provider is not found",
+		"POST",
+		"/-/hooks/bitbucket",
+		map[string]string{},
+		"{}",
+		http.StatusNotFound,
+	},
+	{
+		"GitHub request with no signature is unauthorized",
+		"POST",
+		"/-/hooks/github",
+		map[string]string{"X-GitHub-Event": "push"},
+		"{}",
+		http.StatusUnauthorized,
+	},
+	{
+		"GitHub request with incorrect signature is unauthorized",
+		"POST",
+		"/-/hooks/github",
+		map[string]string{
+			"X-GitHub-Event":      "push",
+			"X-Hub-Signature-256": githubSignature("wrong-secret", "{}"),
+		},
+		"{}",
+		http.StatusUnauthorized,
+	},
+	{
+		"GitHub ping with valid signature is acknowledged",
+		"POST",
+		"/-/hooks/github",
+		map[string]string{
+			"X-GitHub-Event":      "ping",
+			"X-Hub-Signature-256": githubSignature("my-secret", `{"zen":"hi"}`),
+		},
+		`{"zen":"hi"}`,
+		http.StatusNoContent,
+	},
+	{
+		"GitLab request with incorrect token is unauthorized",
+		"POST",
+		"/-/hooks/gitlab",
+		map[string]string{
+			"X-Gitlab-Event": "Push Hook",
+			"X-Gitlab-Token": "wrong-secret",
+		},
+		"{}",
+		http.StatusUnauthorized,
+	},
+	{
+		"GitLab non-push event with valid token is acknowledged",
+		"POST",
+		"/-/hooks/gitlab",
+		map[string]string{
+			"X-Gitlab-Event": "Issue Hook",
+			"X-Gitlab-Token": "my-secret",
+		},
+		"{}",
+		http.StatusNoContent,
+	},
+	{
+		"Oversized payload is rejected",
+		"POST",
+		"/-/hooks/github",
+		map[string]string{"X-GitHub-Event": "push"},
+		`{"zen":"` + strings.Repeat("a", 1024*1024) + `"}`,
+		http.StatusRequestEntityTooLarge,
+	},
+}
+
+func TestWebhookHandler(t *testing.T) {
+	logger := &MockTraceLogger{}
+	handler := &webhookHandler{
+		logger:    logger,
+		appLogger: log.NopAppLogger(),
+		secret:    []byte("my-secret"),
+		updater:   newRouteUpdater(logger, log.NopAppLogger(), nil, nil, 1),
+	}
+
+	for _, tt := range webhookValidationTests {
+		t.Run(tt.title, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+
+			handler.serve(w, r)
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
+
+var matchRoutesTests = []struct {
+	title string
+
+	// Inputs
+	payload string
+	remotes map[string]string
+
+	// Expected values
+	expectedRoutes []string
+}{
+	{
+		"All routes with a matching remote are returned, sorted",
+		`{"repository":{"full_name":"org/repo","clone_url":"https://github.com/org/repo.git"}}`,
+		map[string]string{
+			"mirror/repo-main": "https://github.com/org/repo",
+			"mirror/repo-all":  "https://github.com/org/repo.git",
+			"org/repo":         "https://github.com/org/repo.git",
+			"org/other":        "https://github.com/org/other.git",
+		},
+		[]string{"mirror/repo-all", "mirror/repo-main", "org/repo"},
+	},
+	{
+		"GitLab SSH remote matches",
+		`{"project":{"path_with_namespace":"group/project"},"repository":{"git_ssh_url":"git@gitlab.com:group/project.git"}}`,
+		map[string]string{
+			"gitlab/project": "git@gitlab.com:group/project.git",
+			"group/project":  "https://gitlab.com/group/project.git",
+		},
+		[]string{"gitlab/project"},
+	},
+	{
+		"Route named after the repository is the fallback",
+		`{"repository":{"full_name":"org/repo","clone_url":"https://github.com/org/repo.git"}}`,
+		map[string]string{
+			"org/repo":  "https://mirror.example.com/org/repo.git",
+			"org/other": "https://github.com/org/other.git",
+		},
+		[]string{"org/repo"},
+	},
+	{
+		"Unknown repository matches no route",
+		`{"repository":{"full_name":"org/unknown","clone_url":"https://github.com/org/unknown.git"}}`,
+		map[string]string{
+			"org/repo": "https://github.com/org/repo.git",
+		},
+		[]string{},
+	},
+}
+
+func TestMatchRoutes(t *testing.T) {
+	for _, tt := range matchRoutesTests {
+		t.Run(tt.title, func(t *testing.T) {
+			var payload webhookPayload
+			err := json.Unmarshal([]byte(tt.payload), &payload)
+			assert.Nil(t, err)
+
+			repos := map[string]core.Repository{}
+			for route := range tt.remotes {
+				repos[route] = core.Repository{Route: route}
+			}
+
+			routes := matchRoutes(&payload, repos, tt.remotes)
+			assert.Equal(t, tt.expectedRoutes, routes)
+		})
+	}
+}
+
+func TestRemoteCache(t *testing.T) {
+	ctx := context.Background()
+
+	// Use the info of real files, so the modification times can be changed
+	repoDir := t.TempDir()
+	configFile := filepath.Join(repoDir, "config")
+	err := os.WriteFile(configFile, []byte("[remote \"origin\"]"), 0o600)
+	assert.Nil(t, err)
+	statConfig := func() os.FileInfo {
+		info, err := os.Stat(configFile)
+		assert.Nil(t, err)
+		return info
+	}
+
+	repos := map[string]core.Repository{
+		"org/repo":    {Route: "org/repo", RepoDir: repoDir},
+		"org/missing": {Route: "org/missing", RepoDir: "/missing"},
+	}
+
+	fileSystem := &MockFileSystem{}
+	gitHelper := &MockGitHelper{}
+	cache := &remoteCache{}
+
+	// The remote is read on the first lookup only
+	fileSystem.On("Stat", configFile).Return(statConfig(), nil).Twice()
+	fileSystem.On("Stat", "/missing/config").Return(nil, os.ErrNotExist)
+	gitHelper.On("GetRemoteUrl", mock.Anything, repoDir).
+		Return("https://github.com/org/repo.git", nil).Once()
+
+	expectedUrls := map[string]string{"org/repo": "https://github.com/org/repo.git"}
+	assert.Equal(t, expectedUrls, cache.remoteUrls(ctx, fileSystem, gitHelper, repos))
+	assert.Equal(t, expectedUrls, cache.remoteUrls(ctx, fileSystem, gitHelper, repos))
+	gitHelper.AssertExpectations(t)
+
+	// The remote is read again once the config changes
+	newTime := time.Now().Add(time.Hour)
+	err = os.Chtimes(configFile, newTime, newTime)
+	assert.Nil(t, err)
+	fileSystem.On("Stat", configFile).Return(statConfig(), nil).Once()
+	gitHelper.On("GetRemoteUrl", mock.Anything, repoDir).
+		Return("https://github.com/org/renamed.git", nil).Once()
+
+	expectedUrls = map[string]string{"org/repo": "https://github.com/org/renamed.git"}
+	assert.Equal(t, expectedUrls, cache.remoteUrls(ctx, fileSystem, gitHelper, repos))
+	fileSystem.AssertExpectations(t)
+	gitHelper.AssertExpectations(t)
+
+	// Repositories of routes that are no longer registered are dropped
+	assert.Empty(t, cache.remoteUrls(ctx, fileSystem, gitHelper, map[string]core.Repository{}))
+	assert.Empty(t, cache.remotes)
+}
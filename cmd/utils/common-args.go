@@ -5,8 +5,18 @@ import (
 	"crypto/tls"
 	"flag"
 	"fmt"
-	"strconv"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
 )
 
 // Helpers
@@ -17,6 +27,7 @@ import (
 // functions we want to call from the parser.
 type argParser interface {
 	Lookup(name string) *flag.Flag
+	IsSet(name string) bool
 	Usage(ctx context.Context, errFmt string, args ...any)
 }
 
@@ -41,6 +52,330 @@ func GetFlagValue[T any](parser argParser, name string) T {
 
 // Sets of flags shared between multiple commands/programs
 
+// The storage root flags and the environment variables they set.
+var storageRootFlags = []struct {
+	name   string
+	envVar string
+	usage  string
+}{
+	{"root", core.RootEnvVar, "The directory containing the bundle server's configuration and, " +
+		"by default, its repositories and web content"},
+	{"repo-root", core.RepoRootEnvVar, "The directory containing the bundle server's repositories"},
+	{"web-root", core.WebRootEnvVar, "The directory containing the bundles and bundle lists served by the web server"},
+}
+
+// StorageRootFlags defines the flags that configure where the bundle server
+// stores its data. Because the storage locations must be consistent across
+// every process that touches bundle server data (including child processes
+// and scheduled jobs), the flags are applied by setting the corresponding
+// environment variables with the returned function.
+func StorageRootFlags(parser argParser) (*flag.FlagSet, func(context.Context)) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+	values := make([]*string, len(storageRootFlags))
+	for i, rootFlag := range storageRootFlags {
+		values[i] = f.String(rootFlag.name, "", fmt.Sprintf("%s (overrides $%s)", rootFlag.usage, rootFlag.envVar))
+	}
+
+	applyFunc := func(ctx context.Context) {
+		for i, rootFlag := range storageRootFlags {
+			if *values[i] == "" {
+				continue
+			}
+
+			root, err := filepath.Abs(*values[i])
+			if err != nil {
+				parser.Usage(ctx, "Invalid '--%s' path '%s': %s", rootFlag.name, *values[i], err)
+			}
+			os.Setenv(rootFlag.envVar, root)
+		}
+	}
+
+	return f, applyFunc
+}
+
+// StorageRootArgs returns the arguments needed to configure another bundle
+// server process (e.g. a scheduled job or the web server daemon) with the same
+// storage locations as the current process.
+func StorageRootArgs() []string {
+	args := []string{}
+	for _, rootFlag := range storageRootFlags {
+		if root := os.Getenv(rootFlag.envVar); root != "" {
+			// Use '--flag=value' so the flag is a single argument.
+			args = append(args, fmt.Sprintf("--%s=%s", rootFlag.name, root))
+		}
+	}
+	return args
+}
+
+// The environment variables configuring how Git clones and fetches (see
+// GitFlags).
+const (
+	CloneTimeoutEnvVar     string = "GIT_BUNDLE_SERVER_CLONE_TIMEOUT"
+	FetchTimeoutEnvVar     string = "GIT_BUNDLE_SERVER_FETCH_TIMEOUT"
+	FetchAttemptsEnvVar    string = "GIT_BUNDLE_SERVER_FETCH_ATTEMPTS"
+	FetchRetryDelayEnvVar  string = "GIT_BUNDLE_SERVER_FETCH_RETRY_DELAY"
+	FetchRetryJitterEnvVar string = "GIT_BUNDLE_SERVER_FETCH_RETRY_JITTER"
+)
+
+// The Git flags, the environment variables they set, and their values (with
+// their defaults) for parsing the flags or the environment variables.
+var gitFlags = []struct {
+	name   string
+	envVar string
+	value  func() flag.Value
+	usage  string
+}{
+	{
+		"clone-timeout", CloneTimeoutEnvVar,
+		func() flag.Value { return argparse.NewDurationValue(new(time.Duration), 0) },
+		"The maximum duration of cloning a repository, e.g. '2h' (0 for no limit)",
+	},
+	{
+		"fetch-timeout", FetchTimeoutEnvVar,
+		func() flag.Value { return argparse.NewDurationValue(new(time.Duration), git.DefaultFetchTimeout) },
+		"The maximum duration of fetching updates to a repository, e.g. '30m' (0 for no limit)",
+	},
+	{
+		"fetch-attempts", FetchAttemptsEnvVar,
+		func() flag.Value {
+			return argparse.NewIntRangeValue(new(int), git.DefaultRetryPolicy.Attempts, 1, math.MaxInt)
+		},
+		"The number of times to try a clone or fetch that fails because of a transient network error",
+	},
+	{
+		"fetch-retry-delay", FetchRetryDelayEnvVar,
+		func() flag.Value {
+			return argparse.NewDurationValue(new(time.Duration), git.DefaultRetryPolicy.BaseDelay)
+		},
+		"The delay before retrying a failed clone or fetch, doubling with every retry",
+	},
+	{
+		"fetch-retry-jitter", FetchRetryJitterEnvVar,
+		func() flag.Value {
+			return argparse.NewIntRangeValue(new(int), int(git.DefaultRetryPolicy.Jitter*100), 0, 100)
+		},
+		"The percentage by which each retry delay is randomly lengthened or shortened",
+	},
+}
+
+// GitFlags defines the flags that configure how Git clones and fetches
+// repositories: how long it may take before it is killed, and how failures
+// caused by transient network errors are retried. Like the storage root
+// flags, they are applied by setting the corresponding environment variables
+// with the returned function, so that they also apply to child processes
+// (e.g. the updates run by 'update-all').
+func GitFlags(parser argParser) (*flag.FlagSet, func(context.Context)) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+	for _, gitFlag := range gitFlags {
+		f.Var(gitFlag.value(), gitFlag.name, fmt.Sprintf("%s (overrides $%s)", gitFlag.usage, gitFlag.envVar))
+	}
+
+	applyFunc := func(ctx context.Context) {
+		for _, gitFlag := range gitFlags {
+			if parser.IsSet(gitFlag.name) {
+				os.Setenv(gitFlag.envVar, parser.Lookup(gitFlag.name).Value.String())
+			}
+		}
+	}
+
+	return f, applyFunc
+}
+
+// gitFlagValue returns the value configured by the given Git flag's
+// environment variable, or the flag's default if it is unset or invalid.
+func gitFlagValue[T any](name string) T {
+	for _, gitFlag := range gitFlags {
+		if gitFlag.name != name {
+			continue
+		}
+		value := gitFlag.value()
+		if envValue := os.Getenv(gitFlag.envVar); envValue != "" {
+			err := value.Set(envValue)
+			if err != nil {
+				value = gitFlag.value()
+			}
+		}
+		return value.(flag.Getter).Get().(T)
+	}
+	panic(fmt.Sprintf("flag '--%s' is undefined", name))
+}
+
+// gitOptions returns the options of the Git helper used by commands: the
+// configured timeouts and retry policy and, if the user is watching a
+// terminal, Git's progress.
+func gitOptions(output Output) git.Options {
+	options := git.Options{
+		CloneTimeout: gitFlagValue[time.Duration]("clone-timeout"),
+		FetchTimeout: gitFlagValue[time.Duration]("fetch-timeout"),
+		Retry: git.RetryPolicy{
+			Attempts:  gitFlagValue[int]("fetch-attempts"),
+			BaseDelay: gitFlagValue[time.Duration]("fetch-retry-delay"),
+			Jitter:    float64(gitFlagValue[int]("fetch-retry-jitter")) / 100,
+		},
+	}
+	if output.Level() != QuietOutput && IsTerminal(os.Stderr) {
+		options.Progress = os.Stderr
+	}
+	return options
+}
+
+// The environment variables configuring the application log (see
+// AppLogFlags).
+const (
+	LogLevelEnvVar      string = "GIT_BUNDLE_SERVER_LOG_LEVEL"
+	LogFormatEnvVar     string = "GIT_BUNDLE_SERVER_LOG_FORMAT"
+	LogTargetEnvVar     string = "GIT_BUNDLE_SERVER_LOG_TARGET"
+	LogFileEnvVar       string = "GIT_BUNDLE_SERVER_LOG_FILE"
+	LogMaxSizeEnvVar    string = "GIT_BUNDLE_SERVER_LOG_MAX_SIZE"
+	LogMaxAgeEnvVar     string = "GIT_BUNDLE_SERVER_LOG_MAX_AGE"
+	LogMaxBackupsEnvVar string = "GIT_BUNDLE_SERVER_LOG_MAX_BACKUPS"
+
+	LogSyslogAddressEnvVar string = "GIT_BUNDLE_SERVER_LOG_SYSLOG_ADDRESS"
+)
+
+// The default limits on the size and number of rotated log files.
+const (
+	defaultLogMaxSize    int64 = 100 * 1024 * 1024
+	defaultLogMaxBackups int   = 5
+)
+
+// The application log flags, the environment variables they fall back on, and
+// their values (with their defaults) for parsing the flags or the environment
+// variables. A flag without a value is a string flag.
+var appLogFlags = []struct {
+	name   string
+	envVar string
+	value  func() flag.Value
+	usage  string
+}{
+	{
+		"log-level", LogLevelEnvVar,
+		func() flag.Value { return argparse.NewEnumValue(new(string), "info", log.AppLogLevels) },
+		"The minimum level of the messages logged",
+	},
+	{
+		"log-format", LogFormatEnvVar,
+		func() flag.Value { return argparse.NewEnumValue(new(string), "console", log.AppLogFormats) },
+		"The format of the messages logged: one tab-separated line ('console') or JSON object ('json') per message",
+	},
+	{
+		"log-target", LogTargetEnvVar,
+		func() flag.Value { return argparse.NewEnumValue(new(string), "file", log.AppLogTargets) },
+		"Where messages are sent: the log file ('file'), a syslog daemon ('syslog'), or the local journald ('journald')",
+	},
+	{
+		"log-file", LogFileEnvVar,
+		nil,
+		"The file to which messages are appended",
+	},
+	{
+		"log-max-size", LogMaxSizeEnvVar,
+		func() flag.Value { return argparse.NewByteSizeValue(new(int64), defaultLogMaxSize) },
+		"The size (e.g. '100M') at which the log file is rotated (0 for no limit)",
+	},
+	{
+		"log-max-age", LogMaxAgeEnvVar,
+		func() flag.Value { return argparse.NewDurationValue(new(time.Duration), 0) },
+		"The age (e.g. '720h') after which rotated log files are removed (0 for no limit)",
+	},
+	{
+		"log-max-backups", LogMaxBackupsEnvVar,
+		func() flag.Value { return argparse.NewIntRangeValue(new(int), defaultLogMaxBackups, 0, math.MaxInt) },
+		"The number of rotated log files that are kept (0 for no limit)",
+	},
+	{
+		"log-syslog-address", LogSyslogAddressEnvVar,
+		nil,
+		"The URL (e.g. 'udp://logs.example.com:514') of the syslog daemon to which messages are sent, if not the local one",
+	},
+}
+
+// AppLogEnvVar returns the environment variable on which the given application
+// log flag (e.g. 'log-level') falls back.
+func AppLogEnvVar(name string) string {
+	for _, logFlag := range appLogFlags {
+		if logFlag.name == name {
+			return logFlag.envVar
+		}
+	}
+	panic(fmt.Sprintf("flag '--%s' is undefined", name))
+}
+
+// AppLogFlags defines the flags that configure the application log: the
+// operator-facing messages describing what the bundle server is doing (as
+// opposed to the output of commands and trace2 telemetry), and the rotation of
+// the log file. The flags fall back on their environment variables (see
+// AppLogEnvVar) and, like the Git flags, are applied by setting those
+// variables with the returned function, so that child processes (e.g. the
+// updates run by the web server) log to the same file.
+func AppLogFlags(parser argParser) (*flag.FlagSet, func(context.Context)) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+	for _, logFlag := range appLogFlags {
+		if logFlag.value == nil {
+			f.String(logFlag.name, "", logFlag.usage)
+		} else {
+			f.Var(logFlag.value(), logFlag.name, logFlag.usage)
+		}
+	}
+
+	applyFunc := func(ctx context.Context) {
+		for _, logFlag := range appLogFlags {
+			if !parser.IsSet(logFlag.name) {
+				continue
+			}
+
+			value := parser.Lookup(logFlag.name).Value.String()
+			if logFlag.name == "log-file" && value != "" {
+				// Child processes may run in another directory.
+				path, err := filepath.Abs(value)
+				if err != nil {
+					parser.Usage(ctx, "Invalid '--log-file' path '%s': %s", value, err)
+				}
+				value = path
+			}
+			os.Setenv(logFlag.envVar, value)
+		}
+	}
+
+	return f, applyFunc
+}
+
+// appLogFlagValue returns the value configured by the given application log
+// flag's environment variable, or the flag's default if it is unset or
+// invalid.
+func appLogFlagValue[T any](name string) T {
+	for _, logFlag := range appLogFlags {
+		if logFlag.name != name {
+			continue
+		}
+		value := logFlag.value()
+		if envValue := os.Getenv(logFlag.envVar); envValue != "" {
+			err := value.Set(envValue)
+			if err != nil {
+				value = logFlag.value()
+			}
+		}
+		return value.(flag.Getter).Get().(T)
+	}
+	panic(fmt.Sprintf("flag '--%s' is undefined", name))
+}
+
+// AppLogConfig returns the configuration of the application log set by the
+// environment (see AppLogFlags).
+func AppLogConfig() log.AppLogConfig {
+	return log.AppLogConfig{
+		Level:      appLogFlagValue[string]("log-level"),
+		Format:     appLogFlagValue[string]("log-format"),
+		Target:     appLogFlagValue[string]("log-target"),
+		File:       os.Getenv(LogFileEnvVar),
+		MaxSize:    appLogFlagValue[int64]("log-max-size"),
+		MaxAge:     appLogFlagValue[time.Duration]("log-max-age"),
+		MaxBackups: appLogFlagValue[int]("log-max-backups"),
+
+		SyslogAddress: os.Getenv(LogSyslogAddressEnvVar),
+	}
+}
+
 type tlsVersionValue uint16
 
 var tlsVersions = map[tlsVersionValue]string{
@@ -78,25 +413,107 @@ func (v *tlsVersionValue) Get() any {
 	return uint16(*v)
 }
 
+// WebServerEnvVar returns the environment variable from which the web server
+// reads the given option (e.g. 'GIT_BUNDLE_WEB_SERVER_PORT' for 'port') if it
+// is not given on the command line.
+func WebServerEnvVar(name string) string {
+	return "GIT_BUNDLE_WEB_SERVER_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
 func WebServerFlags(parser argParser) (*flag.FlagSet, func(context.Context)) {
 	f := flag.NewFlagSet("", flag.ContinueOnError)
-	port := f.String("port", "8080", "The port on which the server should be hosted")
+	f.Var(argparse.NewIntRangeValue(new(int), 8080, 0, 65535), "port", "The port on which the server should be hosted")
 	cert := f.String("cert", "", "The path to the X.509 SSL certificate file to use in securely hosting the server")
 	key := f.String("key", "", "The path to the certificate's private key")
 	tlsVersion := tlsVersionValue(tls.VersionTLS12)
 	f.Var(&tlsVersion, "tls-version", "The minimum TLS version the server will accept")
-	f.String("client-ca", "", "The path to the client authentication certificate authority PEM")
+	clientCA := f.String("client-ca", "", "The path to the client authentication certificate authority PEM")
+	clientCARoutes := f.String("client-ca-routes", "", "Comma-separated list of route patterns (e.g. 'owner/*') requiring a "+
+		"verified client certificate; if unset, all routes require one")
 	f.String("auth-config", "", "File containing the configuration for server auth middleware")
+	h2c := f.Bool("h2c", false, "Accept HTTP/2 without TLS ('h2c') from clients with prior knowledge of it, "+
+		"such as a reverse proxy terminating TLS")
+	http3 := f.Bool("http3", false, "Also serve HTTP/3 (QUIC) on the UDP port with the same number as '--port' (experimental; "+
+		"requires '--cert' and '--key', and a build with the 'http3' tag)")
+	f.Bool("compress", false, "Compress bundle lists and other text and JSON responses with gzip or deflate "+
+		"for clients that accept it")
+	f.Bool("unavailable-broken-routes", false, "Respond to requests for routes whose web directory or bundle list is missing "+
+		"with '503 Service Unavailable' and a JSON error, rather than '404 Not Found'")
+	f.Bool("reuse-port", false, "Listen with SO_REUSEPORT, so that a new server can be started on the same port "+
+		"before this one is stopped")
+	f.String("cache-config", "", "File containing the 'Cache-Control' configuration for served content")
+	rateLimit := f.Float64("rate-limit", 0, "The maximum sustained requests per second from a single client IP (0 for no limit)")
+	f.Var(argparse.NewIntRangeValue(new(int), 0, 0, math.MaxInt), "max-client-connections",
+		"The maximum concurrent requests from a single client IP (0 for no limit)")
+	f.Var(argparse.NewIntRangeValue(new(int), 0, 0, math.MaxInt), "max-connections",
+		"The maximum concurrent requests across all clients (0 for no limit)")
+	f.String("allow-ips", "", "Comma-separated list of IP addresses or CIDR ranges allowed to access the server")
+	f.String("deny-ips", "", "Comma-separated list of IP addresses or CIDR ranges denied access to the server")
+	f.String("trusted-proxies", "", "Comma-separated list of IP addresses or CIDR ranges of proxies trusted "+
+		"to report the client IP in 'X-Forwarded-For' or 'X-Real-IP'")
+	f.Var(argparse.NewDurationValue(new(time.Duration), 0), "auto-update", "The interval (e.g. '6h') at which the server updates all routes "+
+		"in the background; if unset, routes are not updated by the server")
+	f.Var(argparse.NewIntRangeValue(new(int), 2, 1, 64), "max-updates", "The maximum number of background updates "+
+		"(scheduled, webhook-triggered, or requested through the admin API) run at the same time")
+	f.String("webhook-secret-file", "", "File containing the shared secret used to validate push webhooks; "+
+		"if unset, webhooks are disabled")
+	f.String("admin-token-file", "", "File containing the bearer token required to access the admin API; "+
+		"if unset, the admin API is disabled")
+	redirectURL := f.String("redirect-url", "", "Base URL (e.g. of a CDN) to which bundle downloads are redirected; "+
+		"if unset, bundles are served by the web server")
+	f.String("vhost-config", "", "File mapping host names to the storage roots of the bundle servers "+
+		"served to them; if unset, every host is served from the same storage roots")
+	auditLog := f.String("audit-log", "", "File (or 'http(s)' URL) to which each bundle download is recorded as a line of JSON; "+
+		"if unset, downloads are not audited")
+	pathPrefix := f.String("path-prefix", "", "The path (e.g. '/bundles') under which the server is mounted behind a reverse proxy; "+
+		"if unset, the server is mounted at the root")
+	otlpEndpoint := f.String("otlp-endpoint", "", "Base URL (e.g. 'http://localhost:4318') of the OpenTelemetry collector "+
+		"to which traces and metrics are exported with OTLP/HTTP; if unset, $OTEL_EXPORTER_OTLP_ENDPOINT is used")
+	f.String("config", "", "JSON file containing the values of options (keyed by name, e.g. 'port') "+
+		"that are given neither on the command line nor in the environment")
 
 	// Function to call for additional arg validation (may exit with 'Usage()')
 	validationFunc := func(ctx context.Context) {
-		p, err := strconv.Atoi(*port)
-		if err != nil || p < 0 || p > 65535 {
-			parser.Usage(ctx, "Invalid port '%s'.", *port)
-		}
 		if (*cert == "") != (*key == "") {
 			parser.Usage(ctx, "Both '--cert' and '--key' are needed to specify SSL configuration.")
 		}
+		if *http3 && *cert == "" {
+			parser.Usage(ctx, "'--http3' requires '--cert' and '--key'.")
+		}
+		if *h2c && *cert != "" {
+			parser.Usage(ctx, "'--h2c' cannot be used with '--cert' and '--key'.")
+		}
+		if *rateLimit < 0 {
+			parser.Usage(ctx, "Invalid rate limit '%g'.", *rateLimit)
+		}
+		if *clientCARoutes != "" && *clientCA == "" {
+			parser.Usage(ctx, "'--client-ca-routes' requires '--client-ca'.")
+		}
+		for _, pattern := range strings.Split(*clientCARoutes, ",") {
+			if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil {
+				parser.Usage(ctx, "Invalid route pattern '%s' in '--client-ca-routes'.", pattern)
+			}
+		}
+		if *redirectURL != "" {
+			u, err := url.Parse(*redirectURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				parser.Usage(ctx, "Invalid redirect URL '%s'; must be an absolute http(s) URL.", *redirectURL)
+			}
+		}
+		if u, err := url.Parse(*auditLog); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host == "" {
+			parser.Usage(ctx, "Invalid audit log URL '%s'.", u.Redacted())
+		}
+		for _, element := range strings.FieldsFunc(*pathPrefix, func(char rune) bool { return char == '/' }) {
+			if element == "." || element == ".." || strings.ContainsAny(element, "\\?#\x00") {
+				parser.Usage(ctx, "Invalid path prefix '%s'.", *pathPrefix)
+			}
+		}
+		if *otlpEndpoint != "" {
+			u, err := url.Parse(*otlpEndpoint)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				parser.Usage(ctx, "Invalid OTLP endpoint '%s'; must be an absolute http(s) URL.", *otlpEndpoint)
+			}
+		}
 	}
 
 	return f, validationFunc
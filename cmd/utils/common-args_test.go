@@ -0,0 +1,88 @@
+package utils_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+var storageRootTests = []struct {
+	title string
+
+	// Inputs
+	args []string
+
+	// Expected values
+	expectedEnv  map[string]string
+	expectedArgs []string
+}{
+	{
+		"no flags set",
+		[]string{},
+		map[string]string{
+			core.RootEnvVar:     "",
+			core.RepoRootEnvVar: "",
+			core.WebRootEnvVar:  "",
+		},
+		[]string{},
+	},
+	{
+		"root only",
+		[]string{"--root", "/data/bundle-server"},
+		map[string]string{
+			core.RootEnvVar:     "/data/bundle-server",
+			core.RepoRootEnvVar: "",
+			core.WebRootEnvVar:  "",
+		},
+		[]string{"--root=/data/bundle-server"},
+	},
+	{
+		"all roots",
+		[]string{"--root", "/data/config", "--repo-root", "/data/repos", "--web-root", "/mnt/large volume/www"},
+		map[string]string{
+			core.RootEnvVar:     "/data/config",
+			core.RepoRootEnvVar: "/data/repos",
+			core.WebRootEnvVar:  "/mnt/large volume/www",
+		},
+		[]string{"--root=/data/config", "--repo-root=/data/repos", "--web-root=/mnt/large volume/www"},
+	},
+}
+
+func TestStorageRootFlags(t *testing.T) {
+	for _, tt := range storageRootTests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Clear the environment (restored after the test)
+			t.Setenv(core.RootEnvVar, "")
+			t.Setenv(core.RepoRootEnvVar, "")
+			t.Setenv(core.WebRootEnvVar, "")
+
+			flags, apply := utils.StorageRootFlags(nil)
+			err := flags.Parse(tt.args)
+			assert.Nil(t, err)
+			apply(context.Background())
+
+			for envVar, expectedValue := range tt.expectedEnv {
+				assert.Equal(t, filepath.FromSlash(expectedValue), os.Getenv(envVar))
+			}
+			assert.Equal(t, tt.expectedArgs, utils.StorageRootArgs())
+		})
+	}
+
+	t.Run("relative paths are made absolute", func(t *testing.T) {
+		t.Setenv(core.RootEnvVar, "")
+
+		flags, apply := utils.StorageRootFlags(nil)
+		err := flags.Parse([]string{"--root", "relative/dir"})
+		assert.Nil(t, err)
+		apply(context.Background())
+
+		expected, err := filepath.Abs("relative/dir")
+		assert.Nil(t, err)
+		assert.Equal(t, expected, os.Getenv(core.RootEnvVar))
+	})
+}
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"context"
+	"io"
+	"os"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
@@ -9,11 +11,14 @@ import (
 	"github.com/git-ecosystem/git-bundle-server/internal/core"
 	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
 	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/git-ecosystem/git-bundle-server/internal/jobs"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/notify"
 )
 
-func BuildGitBundleServerContainer(logger log.TraceLogger) *DependencyContainer {
-	container := NewDependencyContainer()
+// registerCommonDependencies registers the dependencies shared by
+// 'git-bundle-server' and 'git-bundle-web-server'.
+func registerCommonDependencies(container *DependencyContainer, logger log.TraceLogger) {
 	registerDependency(container, func(ctx context.Context) common.UserProvider {
 		return common.NewUserProvider()
 	})
@@ -23,6 +28,32 @@ func BuildGitBundleServerContainer(logger log.TraceLogger) *DependencyContainer
 	registerDependency(container, func(ctx context.Context) common.FileSystem {
 		return common.NewFileSystem()
 	})
+	registerDependency(container, func(ctx context.Context) jobs.JobQueue {
+		user, err := GetDependency[common.UserProvider](ctx, container).CurrentUser()
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		return jobs.NewJobQueue(
+			logger,
+			GetDependency[common.FileSystem](ctx, container),
+			core.JobQueueFile(user),
+		)
+	})
+	registerDependency(container, func(ctx context.Context) *notify.Notifier {
+		n, err := notify.NewNotifier(
+			logger,
+			GetDependency[common.UserProvider](ctx, container),
+		)
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		return n
+	})
+}
+
+func BuildGitBundleServerContainer(logger log.TraceLogger) *DependencyContainer {
+	container := NewDependencyContainer()
+	registerCommonDependencies(container, logger)
 	registerDependency(container, func(ctx context.Context) core.RepositoryProvider {
 		return core.NewRepositoryProvider(
 			logger,
@@ -31,15 +62,55 @@ func BuildGitBundleServerContainer(logger log.TraceLogger) *DependencyContainer
 			GetDependency[git.GitHelper](ctx, container),
 		)
 	})
+	registerDependency(container, func(ctx context.Context) Output {
+		return NewOutput(os.Stdout, os.Stderr)
+	})
+	registerDependency(container, func(ctx context.Context) log.AppLogger {
+		// Commands describe their progress in their output, so their messages
+		// are only logged if a log file, syslog, or journald is configured.
+		appLogger, err := log.NewAppLogger(AppLogConfig(), io.Discard)
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		return appLogger
+	})
+	registerDependency(container, func(ctx context.Context) Prompter {
+		return NewPrompter(os.Stdin, os.Stderr)
+	})
 	registerDependency(container, func(ctx context.Context) bundles.BundleProvider {
 		return bundles.NewBundleProvider(
 			logger,
 			GetDependency[common.FileSystem](ctx, container),
 			GetDependency[git.GitHelper](ctx, container),
+			GetDependency[bundles.BundleStorage](ctx, container),
+			GetDependency[bundles.Signer](ctx, container),
 		)
 	})
+	registerDependency(container, func(ctx context.Context) bundles.BundleStorage {
+		s, err := bundles.NewBundleStorage(
+			logger,
+			GetDependency[common.UserProvider](ctx, container),
+			core.StorageRoots{},
+		)
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		return s
+	})
+	registerDependency(container, func(ctx context.Context) bundles.Signer {
+		s, err := bundles.NewSigner(
+			logger,
+			GetDependency[common.UserProvider](ctx, container),
+			GetDependency[cmd.CommandExecutor](ctx, container),
+		)
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		return s
+	})
 	registerDependency(container, func(ctx context.Context) core.CronScheduler {
-		return core.NewCronScheduler(
+		return core.NewScheduler(
+			ctx,
 			logger,
 			GetDependency[common.UserProvider](ctx, container),
 			GetDependency[cmd.CommandExecutor](ctx, container),
@@ -54,13 +125,15 @@ func BuildGitBundleServerContainer(logger log.TraceLogger) *DependencyContainer
 		)
 	})
 	registerDependency(container, func(ctx context.Context) git.GitHelper {
-		return git.NewGitHelper(
+		return git.NewGitHelperWithOptions(
 			logger,
 			GetDependency[cmd.CommandExecutor](ctx, container),
+			gitOptions(GetDependency[Output](ctx, container)),
 		)
 	})
 	registerDependency(container, func(ctx context.Context) daemon.DaemonProvider {
 		t, err := daemon.NewDaemonProvider(
+			ctx,
 			logger,
 			GetDependency[common.UserProvider](ctx, container),
 			GetDependency[cmd.CommandExecutor](ctx, container),
@@ -74,3 +147,46 @@ func BuildGitBundleServerContainer(logger log.TraceLogger) *DependencyContainer
 
 	return container
 }
+
+func BuildGitBundleWebServerContainer(logger log.TraceLogger) *DependencyContainer {
+	container := NewDependencyContainer()
+	registerCommonDependencies(container, logger)
+	registerDependency(container, func(ctx context.Context) log.AppLogger {
+		// Unless a log file, syslog, or journald is configured, log to stdout
+		// (e.g. to be captured by the daemon's service manager).
+		appLogger, err := log.NewAppLogger(AppLogConfig(), os.Stdout)
+		if err != nil {
+			logger.Fatalf(ctx, "Invalid log config: %w", err)
+		}
+		return appLogger
+	})
+	registerDependency(container, func(ctx context.Context) core.CachedRepositoryProvider {
+		// The web server reads the routes for every request, so it caches
+		// them until the route registry changes.
+		return core.NewCachedRepositoryProvider(
+			logger,
+			core.NewRepositoryProvider(
+				logger,
+				GetDependency[common.UserProvider](ctx, container),
+				GetDependency[common.FileSystem](ctx, container),
+				GetDependency[git.GitHelper](ctx, container),
+			),
+			core.StorageRoots{},
+			GetDependency[common.UserProvider](ctx, container),
+			GetDependency[common.FileSystem](ctx, container),
+		)
+	})
+	registerDependency(container, func(ctx context.Context) core.RepositoryProvider {
+		return GetDependency[core.CachedRepositoryProvider](ctx, container)
+	})
+	registerDependency(container, func(ctx context.Context) git.GitHelper {
+		// The web server only reads the repositories (updates are run by
+		// 'git-bundle-server update'), so it needs no Git options.
+		return git.NewGitHelper(
+			logger,
+			GetDependency[cmd.CommandExecutor](ctx, container),
+		)
+	})
+
+	return container
+}
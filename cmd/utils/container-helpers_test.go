@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
 	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
 	typeutils "github.com/git-ecosystem/git-bundle-server/internal/utils"
 	"github.com/stretchr/testify/assert"
@@ -52,8 +53,20 @@ func findAllGetDependencyTypesInDir(relativePathToDir string) (*token.FileSet, [
 	return fset, typeNodes
 }
 
-// Test that all GetDependency invocations in the 'git-bundle-server' 'main'
-// package are in the container built by 'BuildGitBundleServerContainer'.
+var dependencyContainerTests = []struct {
+	title string
+
+	buildContainer func(log.TraceLogger) *utils.DependencyContainer
+	packageDir     string
+}{
+	{"git-bundle-server", utils.BuildGitBundleServerContainer, "../git-bundle-server"},
+	{"git-bundle-web-server", utils.BuildGitBundleWebServerContainer, "../git-bundle-web-server"},
+}
+
+// Test that all GetDependency invocations in the 'git-bundle-server' and
+// 'git-bundle-web-server' 'main' packages are in the containers built by
+// 'BuildGitBundleServerContainer' and 'BuildGitBundleWebServerContainer',
+// respectively.
 //
 // This test is somewhat fragile, and it isn't comprehensive. Its main utility
 // is to cover easy-to-miss runtime issues that could arise from the dependency
@@ -70,24 +83,37 @@ func TestDependencyContainer(t *testing.T) {
 	logger := &MockTraceLogger{}
 	ctx := context.Background()
 
+	for _, tt := range dependencyContainerTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testDependencyContainer(t, ctx, logger, tt.buildContainer, tt.packageDir)
+		})
+	}
+}
+
+func testDependencyContainer(t *testing.T,
+	ctx context.Context,
+	logger log.TraceLogger,
+	buildContainer func(log.TraceLogger) *utils.DependencyContainer,
+	packageDir string,
+) {
 	t.Run("Container is created successfully", func(t *testing.T) {
-		assert.NotPanics(t, func() { utils.BuildGitBundleServerContainer(logger) })
+		assert.NotPanics(t, func() { buildContainer(logger) })
 	})
 
 	t.Run("Verify container is internally consistent", func(t *testing.T) {
-		container := utils.BuildGitBundleServerContainer(logger)
+		container := buildContainer(logger)
 		assert.NotPanics(t, func() { container.InvokeAll(ctx) })
 	})
 
 	t.Run("Verify all external invocations are registered", func(t *testing.T) {
-		container := utils.BuildGitBundleServerContainer(logger)
+		container := buildContainer(logger)
 		registeredTypes := typeutils.Map(container.ListRegisteredTypes(),
 			func(t reflect.Type) string {
 				return t.String()
 			},
 		)
 
-		fset, typeNodes := findAllGetDependencyTypesInDir("../git-bundle-server")
+		fset, typeNodes := findAllGetDependencyTypesInDir(packageDir)
 
 		// We expect at least one registered dependency, otherwise get rid of
 		// this test.
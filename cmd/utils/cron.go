@@ -36,7 +36,10 @@ func (c *cronHelper) SetCronSchedule(ctx context.Context) error {
 		return c.logger.Errorf(ctx, "failed to get executable: %w", err)
 	}
 
-	err = c.scheduler.AddJob(ctx, core.CronDaily, pathToExec, []string{"update-all"})
+	// Run frequently, but only update the routes that are due for an update
+	// based on their configured update interval.
+	args := append(StorageRootArgs(), "update-all", "--due-only")
+	err = c.scheduler.AddJob(ctx, core.CronQuarterHourly, pathToExec, args)
 	if err != nil {
 		return c.logger.Errorf(ctx, "failed to set cron schedule: %w", err)
 	}
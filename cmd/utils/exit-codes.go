@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"errors"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+)
+
+// The exit codes of 'git-bundle-server', which allow scripts to distinguish
+// the ways in which a command can fail.
+const (
+	ExitSuccess int = 0
+
+	// The command failed for a reason not covered by the other exit codes.
+	ExitFailure int = 1
+
+	// The command line arguments are invalid (see 'argparse').
+	ExitUsage int = 2
+
+	// The command references a route that is not registered.
+	ExitRouteNotFound int = 3
+
+	// Git failed to clone or fetch from a route's remote.
+	ExitFetchFailed int = 4
+
+	// Git failed to create a bundle.
+	ExitBundleFailed int = 5
+
+	// The daemon running the web server could not be managed.
+	ExitDaemonFailed int = 6
+
+	// A route exceeds its disk quota.
+	ExitQuotaExceeded int = 7
+
+	// The command would modify the data of a bundle server in read-only mode.
+	ExitReadOnly int = 8
+)
+
+// exitCodeError associates an error with the exit code of the command that
+// failed with it.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
+// WithExitCode wraps 'err' such that a command failing with it exits with the
+// given code (see ExitCode). If 'err' is nil, nil is returned.
+func WithExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitCodeError{code: code, err: err}
+}
+
+// ExitCode returns the code with which a command failing with 'err' exits: the
+// code given to WithExitCode or, if there is none, the code corresponding to
+// the type of error in the error chain.
+func ExitCode(err error) int {
+	var exitErr *exitCodeError
+	var routeErr *core.RouteNotFoundError
+	var fetchErr *git.FetchError
+	var bundleErr *git.BundleError
+	var quotaErr *core.QuotaExceededError
+	var readOnlyErr *core.ReadOnlyError
+
+	switch {
+	case err == nil:
+		return ExitSuccess
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case errors.As(err, &routeErr):
+		return ExitRouteNotFound
+	case errors.As(err, &fetchErr):
+		return ExitFetchFailed
+	case errors.As(err, &bundleErr):
+		return ExitBundleFailed
+	case errors.As(err, &quotaErr):
+		return ExitQuotaExceeded
+	case errors.As(err, &readOnlyErr):
+		return ExitReadOnly
+	default:
+		return ExitFailure
+	}
+}
+
+// CommonExitCode returns the exit code of a command that failed several times
+// (e.g. once for each of several routes): the code shared by every failure, or
+// ExitFailure if their codes differ.
+func CommonExitCode(codes []int) int {
+	if len(codes) == 0 {
+		return ExitSuccess
+	}
+	for _, code := range codes[1:] {
+		if code != codes[0] {
+			return ExitFailure
+		}
+	}
+	return codes[0]
+}
@@ -0,0 +1,91 @@
+package utils_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/stretchr/testify/assert"
+)
+
+var exitCodeTests = []struct {
+	title string
+
+	// Inputs
+	err error
+
+	// Expected values
+	expectedCode int
+}{
+	{
+		"no error",
+		nil,
+		utils.ExitSuccess,
+	},
+	{
+		"generic error",
+		errors.New("something went wrong"),
+		utils.ExitFailure,
+	},
+	{
+		"route not found",
+		fmt.Errorf("failed to update: %w", &core.RouteNotFoundError{Route: "org/repo"}),
+		utils.ExitRouteNotFound,
+	},
+	{
+		"fetch failure",
+		fmt.Errorf("failed to fetch updates to repo: %w", &git.FetchError{Err: errors.New("'git' exited with status 128")}),
+		utils.ExitFetchFailed,
+	},
+	{
+		"bundle failure",
+		&git.BundleError{Err: errors.New("'git' exited with status 1")},
+		utils.ExitBundleFailed,
+	},
+	{
+		"quota exceeded",
+		&core.QuotaExceededError{Route: "org/repo", Usage: 2 << 30, Quota: 1 << 30},
+		utils.ExitQuotaExceeded,
+	},
+	{
+		"read-only mode",
+		fmt.Errorf("cannot update: %w", &core.ReadOnlyError{Mode: core.ReadOnlyMode{Since: time.Now()}}),
+		utils.ExitReadOnly,
+	},
+	{
+		"explicit exit code",
+		utils.WithExitCode(utils.ExitDaemonFailed, errors.New("failed to start daemon")),
+		utils.ExitDaemonFailed,
+	},
+	{
+		"explicit exit code overrides error type",
+		utils.WithExitCode(utils.ExitFailure, &core.RouteNotFoundError{Route: "org/repo"}),
+		utils.ExitFailure,
+	},
+}
+
+func TestExitCode(t *testing.T) {
+	for _, tt := range exitCodeTests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.expectedCode, utils.ExitCode(tt.err))
+		})
+	}
+
+	t.Run("wrapping preserves the message", func(t *testing.T) {
+		err := utils.WithExitCode(utils.ExitDaemonFailed, errors.New("failed to start daemon"))
+		assert.Equal(t, "failed to start daemon", err.Error())
+		assert.Nil(t, utils.WithExitCode(utils.ExitDaemonFailed, nil))
+	})
+}
+
+func TestCommonExitCode(t *testing.T) {
+	assert.Equal(t, utils.ExitSuccess, utils.CommonExitCode([]int{}))
+	assert.Equal(t, utils.ExitFetchFailed,
+		utils.CommonExitCode([]int{utils.ExitFetchFailed, utils.ExitFetchFailed}))
+	assert.Equal(t, utils.ExitFailure,
+		utils.CommonExitCode([]int{utils.ExitFetchFailed, utils.ExitBundleFailed}))
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type OutputLevel int
+
+const (
+	// Print only the results of commands.
+	QuietOutput OutputLevel = iota
+
+	// Print the results of commands and messages describing their progress.
+	NormalOutput
+
+	// Print the results of commands and detailed messages describing their
+	// progress.
+	VerboseOutput
+)
+
+// Output prints the output of a command, as configured by the top-level
+// '--quiet', '--verbose', and '--json' flags. The output of a command consists
+// of messages describing its progress and the command's result (e.g. the
+// routes printed by 'list'). With '--json', the result is printed to stdout as
+// a single JSON value, and messages are printed to stderr so that they don't
+// corrupt it.
+type Output interface {
+	// SetLevel configures which messages are printed.
+	SetLevel(level OutputLevel)
+
+	// Level returns which messages are printed.
+	Level() OutputLevel
+
+	// SetJson configures whether results are printed as JSON.
+	SetJson(json bool)
+
+	// IsJson returns whether results are printed as JSON.
+	IsJson() bool
+
+	// Printf prints a message, unless the output is quiet.
+	Printf(format string, a ...any)
+
+	// Verbosef prints a message only if the output is verbose.
+	Verbosef(format string, a ...any)
+
+	// Messages returns the writer to which messages are printed (e.g. for
+	// relaying the output of a child process). Unlike Printf, writes to it are
+	// not synchronized.
+	Messages() io.Writer
+
+	// Result prints the result of a command: 'v' if results are printed as
+	// JSON, otherwise the text written by 'text'. Results are printed even if
+	// the output is quiet.
+	Result(v any, text func(w io.Writer)) error
+
+	// Args returns the flags that configure the output of another
+	// 'git-bundle-server' command (e.g. one run by 'update-all') like the
+	// output of the current command. Results are never printed as JSON by
+	// such commands, since their output is relayed as messages.
+	Args() []string
+}
+
+type output struct {
+	lock   sync.Mutex
+	stdout io.Writer
+	stderr io.Writer
+	level  OutputLevel
+	json   bool
+}
+
+func NewOutput(stdout io.Writer, stderr io.Writer) Output {
+	return &output{
+		stdout: stdout,
+		stderr: stderr,
+		level:  NormalOutput,
+	}
+}
+
+func (o *output) SetLevel(level OutputLevel) {
+	o.level = level
+}
+
+func (o *output) Level() OutputLevel {
+	return o.level
+}
+
+func (o *output) SetJson(json bool) {
+	o.json = json
+}
+
+func (o *output) IsJson() bool {
+	return o.json
+}
+
+func (o *output) Messages() io.Writer {
+	if o.level == QuietOutput {
+		return io.Discard
+	} else if o.json {
+		return o.stderr
+	} else {
+		return o.stdout
+	}
+}
+
+func (o *output) Printf(format string, a ...any) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	fmt.Fprintf(o.Messages(), format, a...)
+}
+
+func (o *output) Verbosef(format string, a ...any) {
+	if o.level == VerboseOutput {
+		o.Printf(format, a...)
+	}
+}
+
+func (o *output) Result(v any, text func(w io.Writer)) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if !o.json {
+		text(o.stdout)
+		return nil
+	}
+
+	encoder := json.NewEncoder(o.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (o *output) Args() []string {
+	switch o.level {
+	case QuietOutput:
+		return []string{"--quiet"}
+	case VerboseOutput:
+		return []string{"--verbose"}
+	default:
+		return []string{}
+	}
+}
+
+// OutputFlags defines the top-level flags that configure the output of every
+// command. Once parsed, the flags are applied to an Output with the returned
+// function.
+func OutputFlags(parser argParser) (*flag.FlagSet, func(context.Context, Output)) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+	quiet := f.Bool("quiet", false, "Print only the results of commands, without progress messages")
+	verbose := f.Bool("verbose", false, "Print detailed progress messages")
+	jsonResults := f.Bool("json", false, "Print the results of commands as JSON (and progress messages to stderr)")
+
+	applyFunc := func(ctx context.Context, output Output) {
+		if *quiet && *verbose {
+			parser.Usage(ctx, "'--quiet' and '--verbose' cannot be used together.")
+		}
+
+		level := NormalOutput
+		if *quiet {
+			level = QuietOutput
+		} else if *verbose {
+			level = VerboseOutput
+		}
+		output.SetLevel(level)
+		output.SetJson(*jsonResults)
+	}
+
+	return f, applyFunc
+}
@@ -0,0 +1,93 @@
+package utils_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var outputTests = []struct {
+	title string
+
+	// Inputs
+	args []string
+
+	// Expected values
+	expectedStdout string
+	expectedStderr string
+	expectedArgs   []string
+}{
+	{
+		"no flags set",
+		[]string{},
+		"message\nresult\n",
+		"",
+		[]string{},
+	},
+	{
+		"quiet",
+		[]string{"--quiet"},
+		"result\n",
+		"",
+		[]string{"--quiet"},
+	},
+	{
+		"verbose",
+		[]string{"--verbose"},
+		"message\ndetail\nresult\n",
+		"",
+		[]string{"--verbose"},
+	},
+	{
+		"json",
+		[]string{"--json"},
+		"{\n  \"value\": 1\n}\n",
+		"message\n",
+		[]string{},
+	},
+	{
+		"quiet json",
+		[]string{"--quiet", "--json"},
+		"{\n  \"value\": 1\n}\n",
+		"",
+		[]string{"--quiet"},
+	},
+	{
+		"verbose json",
+		[]string{"--verbose", "--json"},
+		"{\n  \"value\": 1\n}\n",
+		"message\ndetail\n",
+		[]string{"--verbose"},
+	},
+}
+
+func TestOutputFlags(t *testing.T) {
+	for _, tt := range outputTests {
+		t.Run(tt.title, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			output := utils.NewOutput(stdout, stderr)
+
+			flags, apply := utils.OutputFlags(nil)
+			err := flags.Parse(tt.args)
+			assert.Nil(t, err)
+			apply(context.Background(), output)
+
+			output.Printf("message\n")
+			output.Verbosef("detail\n")
+			err = output.Result(map[string]int{"value": 1}, func(w io.Writer) {
+				fmt.Fprintln(w, "result")
+			})
+			assert.Nil(t, err)
+
+			assert.Equal(t, tt.expectedStdout, stdout.String())
+			assert.Equal(t, tt.expectedStderr, stderr.String())
+			assert.Equal(t, tt.expectedArgs, output.Args())
+		})
+	}
+}
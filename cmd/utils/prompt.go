@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Prompter asks the user of an interactive command questions on the terminal.
+type Prompter interface {
+	// IsInteractive returns whether the user can be prompted, i.e. whether
+	// stdin is a terminal.
+	IsInteractive() bool
+
+	// Confirm asks the user the yes/no 'question', returning whether they
+	// answered yes. Any answer other than 'y' or 'yes' is a no. If the context
+	// is done (e.g. the user pressed Ctrl-C) before the user answers, its
+	// error is returned.
+	Confirm(ctx context.Context, question string) (bool, error)
+}
+
+type prompter struct {
+	stdin  *os.File
+	stderr io.Writer
+}
+
+// NewPrompter returns a Prompter reading answers from 'stdin'. Questions are
+// printed to 'stderr' so that they don't mix with the output of the command.
+func NewPrompter(stdin *os.File, stderr io.Writer) Prompter {
+	return &prompter{
+		stdin:  stdin,
+		stderr: stderr,
+	}
+}
+
+// IsTerminal returns whether the given file (e.g. stdin) is a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	// The null device is a character device too, but not a terminal.
+	devNull, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, devNull)
+}
+
+func (p *prompter) IsInteractive() bool {
+	return IsTerminal(p.stdin)
+}
+
+func (p *prompter) Confirm(ctx context.Context, question string) (bool, error) {
+	fmt.Fprintf(p.stderr, "%s [y/N] ", question)
+
+	// Reading from the terminal can't be interrupted, so read in the
+	// background (abandoning the read if the context is done).
+	type readResult struct {
+		answer string
+		err    error
+	}
+	read := make(chan readResult, 1)
+	go func() {
+		answer, err := bufio.NewReader(p.stdin).ReadString('\n')
+		read <- readResult{answer, err}
+	}()
+
+	var answer string
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(p.stderr)
+		return false, ctx.Err()
+	case result := <-read:
+		if result.err != nil && !errors.Is(result.err, io.EOF) {
+			return false, fmt.Errorf("failed to read answer: %w", result.err)
+		}
+		answer = result.answer
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// forceParser is the subset of 'argparse.argParser' used to define the
+// '--force' flag.
+type forceParser interface {
+	Bool(name string, value bool, usage string) *bool
+	Alias(name string, aliases ...string)
+}
+
+// ForceFlag defines the '--force' flag (with the aliases '-f', '--yes', and
+// '-y') of a destructive command, with which the command runs without asking
+// for confirmation (see ConfirmDestructive).
+func ForceFlag(parser forceParser) *bool {
+	force := parser.Bool("force", false, "Do not ask for confirmation (required if stdin is not a terminal)")
+	parser.Alias("force", "f", "yes", "y")
+	return force
+}
+
+// ConfirmDestructive asks the user to confirm the destructive operation
+// described by 'question' (e.g. "Delete route 'org/repo'?") unless 'force' is
+// set, returning an error if the operation must not proceed. If stdin is not a
+// terminal, the operation is refused rather than performed unconfirmed.
+func ConfirmDestructive(ctx context.Context, prompter Prompter, force bool, question string) error {
+	if force {
+		return nil
+	}
+
+	if !prompter.IsInteractive() {
+		return errors.New("refusing to continue without confirmation; " +
+			"stdin is not a terminal (use '--force' to continue anyway)")
+	}
+
+	confirmed, err := prompter.Confirm(ctx, question)
+	if err != nil {
+		return err
+	} else if !confirmed {
+		return errors.New("aborted by user")
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package utils_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePrompter struct {
+	interactive bool
+	answer      bool
+	asked       bool
+}
+
+func (p *fakePrompter) IsInteractive() bool {
+	return p.interactive
+}
+
+func (p *fakePrompter) Confirm(ctx context.Context, question string) (bool, error) {
+	p.asked = true
+	return p.answer, nil
+}
+
+var confirmDestructiveTests = []struct {
+	title string
+
+	// Inputs
+	force       bool
+	interactive bool
+	answer      bool
+
+	// Expected values
+	expectedAsked bool
+	expectedErr   string
+}{
+	{
+		"forced",
+		true,
+		false,
+		false,
+		false,
+		"",
+	},
+	{
+		"confirmed",
+		false,
+		true,
+		true,
+		true,
+		"",
+	},
+	{
+		"declined",
+		false,
+		true,
+		false,
+		true,
+		"aborted by user",
+	},
+	{
+		"not interactive",
+		false,
+		false,
+		true,
+		false,
+		"refusing to continue without confirmation; stdin is not a terminal (use '--force' to continue anyway)",
+	},
+}
+
+func TestConfirmDestructive(t *testing.T) {
+	for _, tt := range confirmDestructiveTests {
+		t.Run(tt.title, func(t *testing.T) {
+			prompter := &fakePrompter{interactive: tt.interactive, answer: tt.answer}
+
+			err := utils.ConfirmDestructive(context.Background(), prompter, tt.force, "Delete it?")
+			if tt.expectedErr == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr)
+			}
+			assert.Equal(t, tt.expectedAsked, prompter.asked)
+		})
+	}
+}
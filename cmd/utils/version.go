@@ -1,9 +0,0 @@
-package utils
-
-// The purpose of this file is to contain globally-accessible variables that
-// specify version information for the bundle server. The values of these
-// variables are set during the build process when using 'make'.
-
-// The executable's version string with no leading 'v' (e.g. "1.0.0" or
-// "1.0.1-g1a2b3c4d").
-var Version string
@@ -0,0 +1,201 @@
+// Package admin contains the types exchanged with the admin API of the web
+// server (see 'git-bundle-web-server --admin-token-file') and a client for it.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/buildinfo"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+)
+
+// The prefix of the admin API's endpoints, and the endpoints themselves.
+const (
+	PathPrefix   string = "/-/admin/"
+	StatusPath   string = PathPrefix + "status"
+	ActivityPath string = PathPrefix + "activity"
+	JobsPath     string = PathPrefix + "jobs"
+	ReadOnlyPath string = PathPrefix + "read-only"
+)
+
+// RouteStatus is the status of a single route reported by the admin API. The
+// remote URL is intentionally omitted, since it may contain credentials.
+type RouteStatus struct {
+	Route                string             `json:"route"`
+	Disabled             bool               `json:"disabled"`
+	LastUpdate           *core.UpdateResult `json:"lastUpdate"`
+	LastSuccessfulUpdate *time.Time         `json:"lastSuccessfulUpdate"`
+
+	// The progress of the route's update in progress, if any, whether it was
+	// started by the web server or on the command line.
+	Progress *core.UpdateProgress `json:"progress,omitempty"`
+}
+
+// Activity is the live state of the web server reported by the admin API.
+type Activity struct {
+	// The version of the web server and the time it started.
+	Version   string    `json:"version"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// The updates started by the web server (e.g. by its scheduler or a
+	// webhook) that are in progress, sorted by route.
+	Updates []Update `json:"updates"`
+
+	// The read-only mode of the bundle server, if on, in which case the
+	// background updates are paused.
+	ReadOnly *core.ReadOnlyMode `json:"readOnly,omitempty"`
+
+	// The requests answered by the web server in the last minute, in the last
+	// 15 minutes, and since it started.
+	RequestsLastMinute    RequestCounts `json:"requestsLastMinute"`
+	RequestsLast15Minutes RequestCounts `json:"requestsLast15Minutes"`
+	RequestsTotal         RequestCounts `json:"requestsTotal"`
+}
+
+// Update is an update of a route in progress.
+type Update struct {
+	Route string `json:"route"`
+
+	// What triggered the update (e.g. 'scheduled' or 'webhook').
+	Reason    string    `json:"reason"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// The progress of the update, once the update has recorded it.
+	Progress *core.UpdateProgress `json:"progress,omitempty"`
+}
+
+// UpdateRequest is the body of a request to the jobs endpoint queueing an
+// update of a route. The queued job (a 'jobs.Job') is returned.
+type UpdateRequest struct {
+	Route string `json:"route"`
+}
+
+// ReadOnlyRequest is the body of a request to the read-only endpoint turning
+// the read-only mode of the bundle server on or off. The resulting mode (a
+// 'ReadOnlyStatus') is returned.
+type ReadOnlyRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// ReadOnlyStatus is the read-only mode of the bundle server reported by the
+// read-only endpoint.
+type ReadOnlyStatus struct {
+	Enabled bool       `json:"enabled"`
+	Since   *time.Time `json:"since,omitempty"`
+	Reason  string     `json:"reason,omitempty"`
+}
+
+// NewReadOnlyStatus creates the status of the given read-only mode (nil if
+// off).
+func NewReadOnlyStatus(mode *core.ReadOnlyMode) ReadOnlyStatus {
+	if mode == nil {
+		return ReadOnlyStatus{}
+	}
+	since := mode.Since
+	return ReadOnlyStatus{Enabled: true, Since: &since, Reason: mode.Reason}
+}
+
+// RequestCounts are the numbers of requests answered over some period: in
+// total, and those answered with a client (4xx) or server (5xx) error.
+type RequestCounts struct {
+	Total        int64 `json:"total"`
+	ClientErrors int64 `json:"clientErrors"`
+	ServerErrors int64 `json:"serverErrors"`
+}
+
+// Add counts a request answered with the given status code.
+func (c *RequestCounts) Add(status int) {
+	c.Total++
+	switch status / 100 {
+	case 4:
+		c.ClientErrors++
+	case 5:
+		c.ServerErrors++
+	}
+}
+
+// Client queries the admin API of a web server over HTTP.
+type Client struct {
+	baseURL    *url.URL
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient creates a client of the admin API of the web server at 'serverURL'
+// (e.g. 'http://localhost:8080', including the path under which the web server
+// is mounted, if any), authenticating with the token read from 'tokenFile'.
+func NewClient(serverURL string, tokenFile string, httpClient *http.Client) (*Client, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(serverURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid web server URL: %w", err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid web server URL '%s': the scheme must be 'http' or 'https'", serverURL)
+	}
+
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read admin token: %w", err)
+	}
+
+	return &Client{
+		baseURL:    baseURL,
+		token:      strings.TrimSpace(string(token)),
+		httpClient: httpClient,
+	}, nil
+}
+
+func (c *Client) getJson(ctx context.Context, endpoint string, v any) error {
+	reqURL := *c.baseURL
+	reqURL.Path += endpoint
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", buildinfo.UserAgent("git-bundle-server"))
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned '%s'", reqURL.Redacted(), resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("failed to parse response to GET %s: %w", reqURL.Redacted(), err)
+	}
+	return nil
+}
+
+// GetStatus returns the status of each route of the web server.
+func (c *Client) GetStatus(ctx context.Context) ([]RouteStatus, error) {
+	statuses := []RouteStatus{}
+	err := c.getJson(ctx, StatusPath, &statuses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get route status: %w", err)
+	}
+	return statuses, nil
+}
+
+// GetActivity returns the live state of the web server.
+func (c *Client) GetActivity(ctx context.Context) (*Activity, error) {
+	activity := &Activity{}
+	err := c.getJson(ctx, ActivityPath, activity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get web server activity: %w", err)
+	}
+	return activity, nil
+}
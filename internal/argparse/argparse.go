@@ -4,6 +4,9 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"sort"
 	"strings"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
@@ -19,19 +22,39 @@ type positionalArg struct {
 	value       interface{}
 }
 
+// The context key under which InvokeSubcommand stores the invoked subcommand,
+// so that the subcommand's own parser can describe it in its help text.
+type subcommandContextKey struct{}
+
 type argParser struct {
 	// State
 	isTopLevel bool
 	parsed     bool
 	argOffset  int
+	help       *bool
 
 	// Pre-parsing
 	subcommands    map[string]Subcommand
 	positionalArgs []*positionalArg
 
+	// The aliases of each flag (e.g. 'f' for 'force'), and the flag each alias
+	// refers to.
+	aliases map[string][]string
+	aliasOf map[string]string
+
+	// The fallbacks of flags not given on the command line: the environment
+	// variable of each flag, and the flag naming a config file (see Env and
+	// ConfigFile).
+	envVars    map[string]string
+	configFlag string
+
 	// Post-parsing
 	selectedSubcommand Subcommand
 
+	// Where the value of each flag set by a fallback came from (e.g.
+	// '$GIT_BUNDLE_WEB_SERVER_PORT').
+	sources map[string]string
+
 	logger log.TraceLogger
 	flag.FlagSet
 }
@@ -44,22 +67,25 @@ func NewArgParser(logger log.TraceLogger, usageString string) *argParser {
 		parsed:      false,
 		argOffset:   0,
 		subcommands: make(map[string]Subcommand),
+		aliases:     make(map[string][]string),
+		aliasOf:     make(map[string]string),
+		envVars:     make(map[string]string),
+		sources:     make(map[string]string),
 		logger:      logger,
 		FlagSet:     *flagSet,
 	}
 
+	a.help = a.FlagSet.Bool("help", false, "Show this help and exit")
+	a.Alias("help", "h")
+
 	a.FlagSet.Usage = func() {
 		out := a.FlagSet.Output()
 		fmt.Fprintf(out, "usage: %s\n\n", usageString)
 
 		// Print flags (if any)
-		flagCount := 0
-		a.FlagSet.VisitAll(func(f *flag.Flag) { flagCount++ })
-		if flagCount > 0 {
-			fmt.Fprintln(out, "Flags:")
-			a.FlagSet.PrintDefaults()
-			fmt.Fprint(out, "\n")
-		}
+		fmt.Fprintln(out, "Flags:")
+		a.printFlags()
+		fmt.Fprint(out, "\n")
 
 		// Print subcommands or positional args (if any)
 		if len(a.subcommands) > 0 {
@@ -84,13 +110,98 @@ func (a *argParser) SetIsTopLevel(isTopLevel bool) {
 	a.isTopLevel = isTopLevel
 }
 
-func (a *argParser) printSubcommands() {
+// Alias registers additional names (e.g. the short option 'f') for the flag
+// 'name', which must already be defined. The aliases are listed alongside the
+// flag in the usage text rather than as separate flags.
+func (a *argParser) Alias(name string, aliases ...string) {
+	f := a.FlagSet.Lookup(name)
+	if f == nil {
+		panic(fmt.Sprintf("cannot alias undefined flag '%s'", name))
+	}
+
+	for _, alias := range aliases {
+		a.FlagSet.Var(f.Value, alias, f.Usage)
+		a.aliases[name] = append(a.aliases[name], alias)
+		a.aliasOf[alias] = name
+	}
+}
+
+// flagName formats the name of a flag as it is given on the command line:
+// '-x' for single-letter flags, '--name' otherwise.
+func flagName(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+// printFlags prints the flags of the parser, like 'flag.PrintDefaults' but
+// with each flag's aliases listed alongside it.
+func (a *argParser) printFlags() {
 	out := a.FlagSet.Output()
+	a.FlagSet.VisitAll(func(f *flag.Flag) {
+		if _, isAlias := a.aliasOf[f.Name]; isAlias {
+			return
+		}
+
+		names := []string{}
+		for _, alias := range a.aliases[f.Name] {
+			names = append(names, flagName(alias))
+		}
+		sort.Slice(names, func(i, j int) bool { return len(names[i]) < len(names[j]) })
+		names = append(names, flagName(f.Name))
+
+		typeName, usage := flag.UnquoteUsage(f)
+		if typed, ok := f.Value.(interface{ typeName() string }); ok && typeName == "value" {
+			typeName = typed.typeName()
+		}
+		line := "  " + strings.Join(names, ", ")
+		if typeName != "" {
+			line += " " + typeName
+		}
+		line += "\n    \t" + strings.ReplaceAll(usage, "\n", "\n    \t")
+		if envVar, ok := a.envVars[f.Name]; ok {
+			line += fmt.Sprintf(" (env $%s)", envVar)
+		}
+		if f.DefValue != "" && f.DefValue != "0" && f.DefValue != "0s" && f.DefValue != "false" && f.DefValue != "[]" {
+			if typeName == "string" {
+				line += fmt.Sprintf(" (default %q)", f.DefValue)
+			} else {
+				line += fmt.Sprintf(" (default %v)", f.DefValue)
+			}
+		}
+		if source, ok := a.sources[f.Name]; ok {
+			line += fmt.Sprintf("\n    \tCurrently %q, from %s", f.Value.String(), source)
+		}
+		fmt.Fprintln(out, line)
+	})
+}
+
+func (a *argParser) printSubcommands() {
+	subcommands := make([]Subcommand, 0, len(a.subcommands))
 	for _, subcommand := range a.subcommands {
-		fmt.Fprintf(out, "  %s\n    \t%s\n",
+		subcommands = append(subcommands, subcommand)
+	}
+	printSubcommandTree(a.FlagSet.Output(), subcommands, "  ")
+}
+
+// printSubcommandTree prints the name and description of each subcommand in
+// alphabetical order, followed (further indented) by the subcommands of any
+// SubcommandGroup.
+func printSubcommandTree(out io.Writer, subcommands []Subcommand, indent string) {
+	sort.Slice(subcommands, func(i, j int) bool {
+		return subcommands[i].Name() < subcommands[j].Name()
+	})
+	for _, subcommand := range subcommands {
+		fmt.Fprintf(out, "%s%s\n%s  \t%s\n",
+			indent,
 			subcommand.Name(),
-			strings.ReplaceAll(strings.TrimSpace(subcommand.Description()), "\n", "\n    \t"),
+			indent,
+			strings.ReplaceAll(strings.TrimSpace(subcommand.Description()), "\n", "\n"+indent+"  \t"),
 		)
+		if group, ok := subcommand.(SubcommandGroup); ok {
+			printSubcommandTree(out, group.Subcommands(), indent+"  ")
+		}
 	}
 }
 
@@ -143,6 +254,23 @@ func (a *argParser) PositionalList(name string, description string, required boo
 	return arg
 }
 
+// printHelp prints the usage text of the parser to stdout, preceded by the
+// description of the subcommand being parsed (if any), and exits.
+func (a *argParser) printHelp(ctx context.Context) {
+	a.FlagSet.SetOutput(os.Stdout)
+	if subcommand, ok := ctx.Value(subcommandContextKey{}).(Subcommand); ok {
+		fmt.Fprintf(os.Stdout, "%s\n\n", strings.TrimSpace(subcommand.Description()))
+	}
+	a.FlagSet.Usage()
+	a.logger.Exit(ctx, 0)
+}
+
+// Parse parses the flags, then the subcommand or positional arguments, in
+// 'args'. Flags may be given as '-name', '--name', '--name=value', or
+// '--name value' (see 'flag'), or by any of their aliases. Flags that are not
+// given fall back on their environment variable, then their value in the
+// config file (see Env and ConfigFile). '-h' or '--help' prints the usage text
+// and exits.
 func (a *argParser) Parse(ctx context.Context, args []string) {
 	if a.parsed {
 		// Do nothing if we've already parsed args
@@ -177,6 +305,11 @@ func (a *argParser) Parse(ctx context.Context, args []string) {
 		a.logger.Error(ctx, err)
 		a.logger.Exit(ctx, usageExitCode)
 	}
+	a.applyFallbacks(ctx)
+
+	if *a.help {
+		a.printHelp(ctx)
+	}
 
 	if len(a.subcommands) > 0 {
 		// Parse subcommand, if applicable
@@ -247,14 +380,23 @@ func (a *argParser) NArg() int {
 	}
 }
 
+// SubcommandName returns the name of the subcommand selected by Parse.
+func (a *argParser) SubcommandName() string {
+	if !a.parsed || a.selectedSubcommand == nil {
+		panic("subcommand has not been parsed")
+	}
+	return a.selectedSubcommand.Name()
+}
+
 func (a *argParser) InvokeSubcommand(ctx context.Context) error {
 	if !a.parsed || a.selectedSubcommand == nil {
 		panic("subcommand has not been parsed")
 	}
 
 	if a.isTopLevel {
-		a.logger.LogCommand(ctx, a.selectedSubcommand.Name())
+		ctx = a.logger.LogCommand(ctx, a.selectedSubcommand.Name())
 	}
+	ctx = context.WithValue(ctx, subcommandContextKey{}, a.selectedSubcommand)
 
 	return a.selectedSubcommand.Run(ctx, a.Args())
 }
@@ -0,0 +1,169 @@
+package argparse_test
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+var flagSyntaxTests = []struct {
+	title string
+
+	// Inputs
+	args []string
+
+	// Expected values
+	expectedForce    bool
+	expectedParallel int
+	expectedRoute    string
+}{
+	{
+		"defaults",
+		[]string{"org/repo"},
+		false,
+		1,
+		"org/repo",
+	},
+	{
+		"long flags with separate values",
+		[]string{"--force", "--parallel", "4", "org/repo"},
+		true,
+		4,
+		"org/repo",
+	},
+	{
+		"long flags with attached values",
+		[]string{"--force=true", "--parallel=4", "org/repo"},
+		true,
+		4,
+		"org/repo",
+	},
+	{
+		"single-dash flags",
+		[]string{"-force", "-parallel", "4", "org/repo"},
+		true,
+		4,
+		"org/repo",
+	},
+	{
+		"short aliases",
+		[]string{"-f", "-p=4", "org/repo"},
+		true,
+		4,
+		"org/repo",
+	},
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range flagSyntaxTests {
+		t.Run(tt.title, func(t *testing.T) {
+			parser := argparse.NewArgParser(&MockTraceLogger{}, "test [-f|--force] [-p|--parallel <n>] <route>")
+			force := parser.Bool("force", false, "force the operation")
+			parser.Alias("force", "f")
+			parallel := parser.Int("parallel", 1, "the number of parallel jobs")
+			parser.Alias("parallel", "p")
+			route := parser.PositionalString("route", "the route", true)
+
+			parser.Parse(context.Background(), tt.args)
+
+			assert.Equal(t, tt.expectedForce, *force)
+			assert.Equal(t, tt.expectedParallel, *parallel)
+			assert.Equal(t, tt.expectedRoute, *route)
+		})
+	}
+}
+
+func TestUsageListsAliases(t *testing.T) {
+	parser := argparse.NewArgParser(&MockTraceLogger{}, "test [-f|--force]")
+	parser.Bool("force", false, "force the operation")
+	parser.Alias("force", "f")
+	parser.String("name", "default", "the name")
+
+	out := &bytes.Buffer{}
+	parser.SetOutput(out)
+	parser.FlagSet.Usage()
+
+	assert.Equal(t, `usage: test [-f|--force]
+
+Flags:
+  -f, --force
+    	force the operation
+  -h, --help
+    	Show this help and exit
+  --name string
+    	the name (default "default")
+
+`, out.String())
+}
+
+func TestAliasOfUndefinedFlag(t *testing.T) {
+	parser := argparse.NewArgParser(&MockTraceLogger{}, "test")
+	assert.Panics(t, func() { parser.Alias("missing", "m") })
+}
+
+func TestUsageListsSubcommandTree(t *testing.T) {
+	noop := func(ctx context.Context, args []string) error { return nil }
+
+	parser := argparse.NewArgParser(&MockTraceLogger{}, "test <command>")
+	parser.Subcommand(argparse.NewSubcommand("version", "Print the version", noop))
+	parser.Subcommand(argparse.NewSubcommandGroup(&MockTraceLogger{}, "route", "Manage routes", "test route <subcommand>",
+		argparse.NewSubcommand("list", "List routes", noop),
+		argparse.NewSubcommand("delete", "Delete a route", noop),
+	))
+
+	out := &bytes.Buffer{}
+	parser.SetOutput(out)
+	parser.FlagSet.Usage()
+
+	assert.Equal(t, `usage: test <command>
+
+Flags:
+  -h, --help
+    	Show this help and exit
+
+Subcommands:
+  route
+    	Manage routes
+    delete
+      	Delete a route
+    list
+      	List routes
+  version
+    	Print the version
+
+`, out.String())
+}
+
+func TestSubcommandGroup(t *testing.T) {
+	var invokedArgs []string
+	group := argparse.NewSubcommandGroup(&MockTraceLogger{}, "route", "Manage routes", "test route <subcommand>",
+		argparse.NewSubcommand("list", "List routes", func(ctx context.Context, args []string) error {
+			invokedArgs = args
+			return nil
+		}),
+	)
+
+	assert.Equal(t, "route", group.Name())
+	assert.Len(t, group.Subcommands(), 1)
+
+	err := group.Run(context.Background(), []string{"list", "--name-only"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--name-only"}, invokedArgs)
+}
+
+func TestIsSet(t *testing.T) {
+	parser := argparse.NewArgParser(&MockTraceLogger{}, "test")
+	parser.IntRange("max-bundles", 0, 0, math.MaxInt, "the maximum number of bundles")
+	parser.Alias("max-bundles", "n")
+	parser.ByteSize("max-size", 0, "the maximum size")
+
+	parser.Parse(context.Background(), []string{"-n", "0"})
+
+	assert.True(t, parser.IsSet("max-bundles"))
+	assert.False(t, parser.IsSet("max-size"))
+}
@@ -0,0 +1,160 @@
+package argparse
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Env declares that the flag 'name' (which must already be defined) falls back
+// on the value of the environment variable 'envVar' if it is not given on the
+// command line.
+func (a *argParser) Env(name string, envVar string) {
+	if a.FlagSet.Lookup(name) == nil {
+		panic(fmt.Sprintf("cannot set environment variable of undefined flag '%s'", name))
+	}
+	a.envVars[name] = envVar
+}
+
+// ConfigFile declares that the flag 'name' (which must already be defined)
+// names a JSON config file. The file contains an object mapping flag names
+// (without leading dashes) to values, which are used for the flags given
+// neither on the command line nor in the environment. Values may be strings,
+// numbers, booleans, or arrays (joined with commas).
+func (a *argParser) ConfigFile(name string) {
+	if a.FlagSet.Lookup(name) == nil {
+		panic(fmt.Sprintf("cannot use undefined flag '%s' as config file", name))
+	}
+	a.configFlag = name
+}
+
+// configValue converts a value in a config file to the string form of a flag
+// value.
+func configValue(raw json.RawMessage) (string, error) {
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str, nil
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		values := make([]string, len(list))
+		for i, item := range list {
+			value, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			values[i] = value
+		}
+		return strings.Join(values, ","), nil
+	}
+
+	var scalar any
+	if err := json.Unmarshal(raw, &scalar); err != nil {
+		return "", err
+	}
+	switch scalar.(type) {
+	case float64, bool:
+		return strings.TrimSpace(string(raw)), nil
+	default:
+		return "", fmt.Errorf("unsupported value %s", string(raw))
+	}
+}
+
+// readConfigFile reads the flag values in the given config file.
+func readConfigFile(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	rawValues := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &rawValues)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(rawValues))
+	for name, raw := range rawValues {
+		value, err := configValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of '%s': %w", name, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// applyFallbacks sets the flags that were not given on the command line from
+// their environment variables or the config file, in that order of precedence,
+// and records where each value came from.
+func (a *argParser) applyFallbacks(ctx context.Context) {
+	given := map[string]bool{}
+	a.FlagSet.Visit(func(f *flag.Flag) {
+		if name, isAlias := a.aliasOf[f.Name]; isAlias {
+			given[name] = true
+		} else {
+			given[f.Name] = true
+		}
+	})
+
+	setFromEnv := func(name string) bool {
+		envVar, ok := a.envVars[name]
+		if !ok || given[name] {
+			return false
+		}
+		value, ok := os.LookupEnv(envVar)
+		if !ok || value == "" {
+			return false
+		}
+
+		err := a.FlagSet.Lookup(name).Value.Set(value)
+		if err != nil {
+			a.Usage(ctx, "Invalid value '%s' of $%s: %s", value, envVar, err)
+		}
+		a.sources[name] = "$" + envVar
+		return true
+	}
+
+	// The config file may itself be named by an environment variable.
+	config := map[string]string{}
+	configSource := ""
+	if a.configFlag != "" {
+		setFromEnv(a.configFlag)
+		if filename := a.FlagSet.Lookup(a.configFlag).Value.String(); filename != "" {
+			var err error
+			config, err = readConfigFile(filename)
+			if err != nil {
+				a.Usage(ctx, "Invalid config file '%s': %s", filename, err)
+			}
+			configSource = fmt.Sprintf("config file '%s'", filename)
+		}
+	}
+
+	for name := range config {
+		f := a.FlagSet.Lookup(name)
+		if _, isAlias := a.aliasOf[name]; f == nil || isAlias || name == a.configFlag {
+			a.Usage(ctx, "Invalid config file '%s': unknown option '%s'",
+				a.FlagSet.Lookup(a.configFlag).Value.String(), name)
+		}
+	}
+
+	a.FlagSet.VisitAll(func(f *flag.Flag) {
+		if _, isAlias := a.aliasOf[f.Name]; isAlias || f.Name == a.configFlag || given[f.Name] {
+			return
+		}
+		if setFromEnv(f.Name) {
+			return
+		}
+		if value, ok := config[f.Name]; ok {
+			err := f.Value.Set(value)
+			if err != nil {
+				a.Usage(ctx, "Invalid value '%s' of '%s' in %s: %s", value, f.Name, configSource, err)
+			}
+			a.sources[f.Name] = configSource
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package argparse_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+var fallbackTests = []struct {
+	title string
+
+	// Inputs
+	args   []string
+	env    map[string]string
+	config string
+
+	// Expected values
+	expectedPort  string
+	expectedIPs   string
+	expectedDebug bool
+}{
+	{
+		"defaults",
+		[]string{},
+		map[string]string{},
+		"",
+		"8080",
+		"",
+		false,
+	},
+	{
+		"environment overrides default",
+		[]string{},
+		map[string]string{"TEST_PORT": "9000", "TEST_DEBUG": "true"},
+		"",
+		"9000",
+		"",
+		true,
+	},
+	{
+		"flag overrides environment",
+		[]string{"--port", "9001"},
+		map[string]string{"TEST_PORT": "9000"},
+		"",
+		"9001",
+		"",
+		false,
+	},
+	{
+		"config overrides default",
+		[]string{},
+		map[string]string{},
+		`{"port": 9002, "allow-ips": ["10.0.0.0/8", "127.0.0.1"], "debug": true}`,
+		"9002",
+		"10.0.0.0/8,127.0.0.1",
+		true,
+	},
+	{
+		"environment overrides config",
+		[]string{},
+		map[string]string{"TEST_PORT": "9000"},
+		`{"port": "9002"}`,
+		"9000",
+		"",
+		false,
+	},
+	{
+		"alias on command line overrides config",
+		[]string{"-p", "9003"},
+		map[string]string{},
+		`{"port": "9002"}`,
+		"9003",
+		"",
+		false,
+	},
+}
+
+func TestFallbacks(t *testing.T) {
+	for _, tt := range fallbackTests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Clear the environment (restored after the test)
+			for _, envVar := range []string{"TEST_PORT", "TEST_DEBUG", "TEST_CONFIG"} {
+				t.Setenv(envVar, "")
+			}
+			for envVar, value := range tt.env {
+				t.Setenv(envVar, value)
+			}
+
+			args := tt.args
+			if tt.config != "" {
+				configFile := filepath.Join(t.TempDir(), "config.json")
+				err := os.WriteFile(configFile, []byte(tt.config), 0o600)
+				assert.Nil(t, err)
+				args = append([]string{"--config", configFile}, args...)
+			}
+
+			parser := argparse.NewArgParser(&MockTraceLogger{}, "test")
+			port := parser.String("port", "8080", "the port")
+			parser.Alias("port", "p")
+			parser.Env("port", "TEST_PORT")
+			allowIPs := parser.String("allow-ips", "", "the allowed IPs")
+			debug := parser.Bool("debug", false, "enable debugging")
+			parser.Env("debug", "TEST_DEBUG")
+			parser.String("config", "", "the config file")
+			parser.Env("config", "TEST_CONFIG")
+			parser.ConfigFile("config")
+
+			parser.Parse(context.Background(), args)
+
+			assert.Equal(t, tt.expectedPort, *port)
+			assert.Equal(t, tt.expectedIPs, *allowIPs)
+			assert.Equal(t, tt.expectedDebug, *debug)
+		})
+	}
+
+	t.Run("config file named by environment", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "config.json")
+		err := os.WriteFile(configFile, []byte(`{"port": "9004"}`), 0o600)
+		assert.Nil(t, err)
+		t.Setenv("TEST_PORT", "")
+		t.Setenv("TEST_CONFIG", configFile)
+
+		parser := argparse.NewArgParser(&MockTraceLogger{}, "test")
+		port := parser.String("port", "8080", "the port")
+		parser.Env("port", "TEST_PORT")
+		parser.String("config", "", "the config file")
+		parser.Env("config", "TEST_CONFIG")
+		parser.ConfigFile("config")
+
+		parser.Parse(context.Background(), []string{})
+
+		assert.Equal(t, "9004", *port)
+	})
+}
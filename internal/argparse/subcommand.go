@@ -1,6 +1,10 @@
 package argparse
 
-import "context"
+import (
+	"context"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
 
 type Subcommand interface {
 	Name() string
@@ -37,3 +41,55 @@ func (s *genericSubcommand) Description() string {
 func (s *genericSubcommand) Run(ctx context.Context, args []string) error {
 	return s.runFunc(ctx, args)
 }
+
+// SubcommandGroup is a Subcommand whose first argument selects one of its own
+// subcommands (e.g. 'web-server start'). The subcommands of a group are listed
+// under it in the usage text of the parent command.
+type SubcommandGroup interface {
+	Subcommand
+	Subcommands() []Subcommand
+}
+
+type subcommandGroup struct {
+	genericSubcommand
+	logger      log.TraceLogger
+	usageString string
+	subcommands []Subcommand
+}
+
+// NewSubcommandGroup creates a SubcommandGroup that parses its arguments with
+// an argParser using the given usage string, then runs the selected
+// subcommand. Groups may be nested.
+func NewSubcommandGroup(
+	logger log.TraceLogger,
+	name string,
+	description string,
+	usageString string,
+	subcommands ...Subcommand,
+) SubcommandGroup {
+	g := &subcommandGroup{
+		logger:      logger,
+		usageString: usageString,
+		subcommands: subcommands,
+	}
+	g.genericSubcommand = genericSubcommand{
+		nameStr:        name,
+		descriptionStr: description,
+		runFunc:        g.run,
+	}
+	return g
+}
+
+func (g *subcommandGroup) Subcommands() []Subcommand {
+	return append([]Subcommand{}, g.subcommands...)
+}
+
+func (g *subcommandGroup) run(ctx context.Context, args []string) error {
+	parser := NewArgParser(g.logger, g.usageString)
+	for _, subcommand := range g.subcommands {
+		parser.Subcommand(subcommand)
+	}
+	parser.Parse(ctx, args)
+
+	return parser.InvokeSubcommand(ctx)
+}
@@ -0,0 +1,274 @@
+package argparse
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+)
+
+// Flag values that validate their input, so that commands don't need to. An
+// invalid value is reported like any other flag parsing error, e.g.:
+//
+//	invalid value "70000" for flag -port: must be between 0 and 65535
+
+type intRangeValue struct {
+	value *int
+	min   int
+	max   int
+}
+
+// NewIntRangeValue returns a flag value storing an integer between 'min' and
+// 'max' (inclusive) in 'p', initially 'value'.
+func NewIntRangeValue(p *int, value int, min int, max int) flag.Value {
+	*p = value
+	return &intRangeValue{value: p, min: min, max: max}
+}
+
+func (v *intRangeValue) Set(s string) error {
+	value, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("'%s' is not an integer", s)
+	}
+	if value < v.min || value > v.max {
+		if v.max == math.MaxInt {
+			return fmt.Errorf("must be at least %d", v.min)
+		}
+		return fmt.Errorf("must be between %d and %d", v.min, v.max)
+	}
+	*v.value = value
+	return nil
+}
+
+func (v *intRangeValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return strconv.Itoa(*v.value)
+}
+
+func (v *intRangeValue) typeName() string {
+	return "int"
+}
+
+func (v *intRangeValue) Get() any {
+	return *v.value
+}
+
+type durationValue struct {
+	value *time.Duration
+}
+
+// NewDurationValue returns a flag value storing a non-negative duration (e.g.
+// '90m' or '6h') in 'p', initially 'value'.
+func NewDurationValue(p *time.Duration, value time.Duration) flag.Value {
+	*p = value
+	return &durationValue{value: p}
+}
+
+func (v *durationValue) Set(s string) error {
+	value, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("'%s' is not a duration (e.g. '90m' or '6h')", s)
+	}
+	if value < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	*v.value = value
+	return nil
+}
+
+func (v *durationValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return v.value.String()
+}
+
+func (v *durationValue) typeName() string {
+	return "duration"
+}
+
+func (v *durationValue) Get() any {
+	return *v.value
+}
+
+type byteSizeValue struct {
+	value *int64
+}
+
+// NewByteSizeValue returns a flag value storing a size in bytes, given as a
+// number with an optional unit suffix (e.g. '500M'; see 'core.ParseByteSize'),
+// in 'p', initially 'value'.
+func NewByteSizeValue(p *int64, value int64) flag.Value {
+	*p = value
+	return &byteSizeValue{value: p}
+}
+
+func (v *byteSizeValue) Set(s string) error {
+	value, err := core.ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*v.value = value
+	return nil
+}
+
+func (v *byteSizeValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return core.FormatByteSize(*v.value)
+}
+
+func (v *byteSizeValue) typeName() string {
+	return "size"
+}
+
+func (v *byteSizeValue) Get() any {
+	return *v.value
+}
+
+type enumValue struct {
+	value   *string
+	allowed []string
+}
+
+// NewEnumValue returns a flag value storing one of the 'allowed' strings in
+// 'p', initially 'value' (which need not be allowed, e.g. to detect that the
+// flag is unset).
+func NewEnumValue(p *string, value string, allowed []string) flag.Value {
+	*p = value
+	return &enumValue{value: p, allowed: allowed}
+}
+
+func (v *enumValue) Set(s string) error {
+	for _, allowed := range v.allowed {
+		if s == allowed {
+			*v.value = s
+			return nil
+		}
+	}
+
+	quoted := make([]string, len(v.allowed))
+	for i, allowed := range v.allowed {
+		quoted[i] = "'" + allowed + "'"
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(quoted, ", "))
+}
+
+func (v *enumValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v *enumValue) typeName() string {
+	return "string"
+}
+
+func (v *enumValue) Get() any {
+	return *v.value
+}
+
+type keyValueValue struct {
+	value *map[string]string
+}
+
+// NewKeyValueValue returns a flag value storing the 'KEY=VALUE' pairs given by
+// each use of the flag (e.g. '--env A=1 --env B=2') in 'p'. Later uses of the
+// same key override earlier ones.
+func NewKeyValueValue(p *map[string]string) flag.Value {
+	*p = map[string]string{}
+	return &keyValueValue{value: p}
+}
+
+func (v *keyValueValue) Set(s string) error {
+	key, value, found := strings.Cut(s, "=")
+	if !found || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("'%s' is not of the form 'KEY=VALUE'", s)
+	}
+	(*v.value)[key] = value
+	return nil
+}
+
+func (v *keyValueValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*v.value))
+	for key, value := range *v.value {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v *keyValueValue) typeName() string {
+	return "key=value"
+}
+
+func (v *keyValueValue) Get() any {
+	return *v.value
+}
+
+// IntRange defines a flag storing an integer between 'min' and 'max'
+// (inclusive).
+func (a *argParser) IntRange(name string, value int, min int, max int, usage string) *int {
+	p := new(int)
+	a.FlagSet.Var(NewIntRangeValue(p, value, min, max), name, usage)
+	return p
+}
+
+// Duration defines a flag storing a non-negative duration. Unlike
+// 'flag.Duration', negative durations are rejected.
+func (a *argParser) Duration(name string, value time.Duration, usage string) *time.Duration {
+	p := new(time.Duration)
+	a.FlagSet.Var(NewDurationValue(p, value), name, usage)
+	return p
+}
+
+// ByteSize defines a flag storing a size in bytes (e.g. '500M').
+func (a *argParser) ByteSize(name string, value int64, usage string) *int64 {
+	p := new(int64)
+	a.FlagSet.Var(NewByteSizeValue(p, value), name, usage)
+	return p
+}
+
+// Enum defines a flag storing one of the 'allowed' strings.
+func (a *argParser) Enum(name string, value string, allowed []string, usage string) *string {
+	p := new(string)
+	a.FlagSet.Var(NewEnumValue(p, value, allowed), name, usage)
+	return p
+}
+
+// KeyValue defines a flag storing the 'KEY=VALUE' pairs given by each of its
+// uses.
+func (a *argParser) KeyValue(name string, usage string) *map[string]string {
+	p := new(map[string]string)
+	a.FlagSet.Var(NewKeyValueValue(p), name, usage)
+	return p
+}
+
+// IsSet returns whether the flag 'name' was given on the command line (by any
+// of its names) or set by a fallback (see Env and ConfigFile), rather than
+// left at its default value.
+func (a *argParser) IsSet(name string) bool {
+	if _, ok := a.sources[name]; ok {
+		return true
+	}
+
+	set := false
+	a.FlagSet.Visit(func(f *flag.Flag) {
+		if f.Name == name || a.aliasOf[f.Name] == name {
+			set = true
+		}
+	})
+	return set
+}
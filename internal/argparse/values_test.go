@@ -0,0 +1,128 @@
+package argparse_test
+
+import (
+	"flag"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/stretchr/testify/assert"
+)
+
+var flagValueTests = []struct {
+	title string
+
+	// Inputs
+	value flag.Value
+	input string
+
+	// Expected values
+	expectedValue any
+	expectedErr   string
+}{
+	{
+		"int in range",
+		argparse.NewIntRangeValue(new(int), 8080, 0, 65535),
+		"443",
+		443,
+		"",
+	},
+	{
+		"int out of range",
+		argparse.NewIntRangeValue(new(int), 8080, 0, 65535),
+		"70000",
+		8080,
+		"must be between 0 and 65535",
+	},
+	{
+		"int below unbounded range",
+		argparse.NewIntRangeValue(new(int), 1, 1, math.MaxInt),
+		"0",
+		1,
+		"must be at least 1",
+	},
+	{
+		"int not a number",
+		argparse.NewIntRangeValue(new(int), 1, 1, math.MaxInt),
+		"many",
+		1,
+		"'many' is not an integer",
+	},
+	{
+		"duration",
+		argparse.NewDurationValue(new(time.Duration), 0),
+		"6h",
+		6 * time.Hour,
+		"",
+	},
+	{
+		"negative duration",
+		argparse.NewDurationValue(new(time.Duration), 0),
+		"-1h",
+		time.Duration(0),
+		"must not be negative",
+	},
+	{
+		"invalid duration",
+		argparse.NewDurationValue(new(time.Duration), 0),
+		"6 hours",
+		time.Duration(0),
+		"'6 hours' is not a duration (e.g. '90m' or '6h')",
+	},
+	{
+		"byte size",
+		argparse.NewByteSizeValue(new(int64), 0),
+		"500M",
+		int64(500 * 1024 * 1024),
+		"",
+	},
+	{
+		"invalid byte size",
+		argparse.NewByteSizeValue(new(int64), 0),
+		"lots",
+		int64(0),
+		"invalid size 'lots'",
+	},
+	{
+		"allowed enum value",
+		argparse.NewEnumValue(new(string), "", []string{"base", "weekly"}),
+		"weekly",
+		"weekly",
+		"",
+	},
+	{
+		"disallowed enum value",
+		argparse.NewEnumValue(new(string), "", []string{"base", "weekly"}),
+		"daily",
+		"",
+		"must be one of 'base', 'weekly'",
+	}, {
+		"key-value pair",
+		argparse.NewKeyValueValue(new(map[string]string)),
+		"HTTPS_PROXY=http://proxy:3128",
+		map[string]string{"HTTPS_PROXY": "http://proxy:3128"},
+		"",
+	},
+	{
+		"not a key-value pair",
+		argparse.NewKeyValueValue(new(map[string]string)),
+		"HTTPS_PROXY",
+		map[string]string{},
+		"'HTTPS_PROXY' is not of the form 'KEY=VALUE'",
+	},
+}
+
+func TestFlagValues(t *testing.T) {
+	for _, tt := range flagValueTests {
+		t.Run(tt.title, func(t *testing.T) {
+			err := tt.value.Set(tt.input)
+			if tt.expectedErr == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr)
+			}
+			assert.Equal(t, tt.expectedValue, tt.value.(flag.Getter).Get())
+		})
+	}
+}
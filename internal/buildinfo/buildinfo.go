@@ -0,0 +1,64 @@
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// The purpose of this package is to contain globally-accessible variables that
+// specify build information for the bundle server. The values of these
+// variables are set during the build process when using 'make' (see 'LDFLAGS'
+// in the Makefile).
+
+// The executable's version string with no leading 'v' (e.g. "1.0.0" or
+// "1.0.1-g1a2b3c4d").
+var Version string
+
+// The full hash of the commit the executable was built from.
+var Commit string
+
+// The UTC time at which the executable was built, in RFC 3339 format (e.g.
+// "2023-01-02T15:04:05Z").
+var BuildDate string
+
+const unknown string = "<unknown>"
+
+// VersionString returns the executable's version, or "<no version>" if it was
+// built without one (e.g. with 'go build').
+func VersionString() string {
+	if Version == "" {
+		return "<no version>"
+	}
+	return Version
+}
+
+// UserAgent returns the product token (as in the HTTP 'Server' and
+// 'User-Agent' headers) of the given program, e.g.
+// "git-bundle-server/1.0.0".
+func UserAgent(program string) string {
+	if Version == "" {
+		return program
+	}
+	return program + "/" + Version
+}
+
+// Describe returns the build information of the given program, as printed by
+// its 'version' command.
+func Describe(program string) string {
+	commit := Commit
+	if commit == "" {
+		commit = unknown
+	}
+	buildDate := BuildDate
+	if buildDate == "" {
+		buildDate = unknown
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s version %s\n", program, VersionString())
+	fmt.Fprintf(&sb, "commit: %s\n", commit)
+	fmt.Fprintf(&sb, "build date: %s\n", buildDate)
+	fmt.Fprintf(&sb, "go version: %s\n", runtime.Version())
+	return sb.String()
+}
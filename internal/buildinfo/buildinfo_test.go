@@ -0,0 +1,56 @@
+package buildinfo_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/buildinfo"
+	"github.com/stretchr/testify/assert"
+)
+
+var describeTests = []struct {
+	title string
+
+	version   string
+	commit    string
+	buildDate string
+
+	expectedUserAgent string
+	expectedDescribe  string
+}{
+	{
+		"no build information",
+		"", "", "",
+		"git-bundle-server",
+		"git-bundle-server version <no version>\n" +
+			"commit: <unknown>\n" +
+			"build date: <unknown>\n" +
+			"go version: " + runtime.Version() + "\n",
+	},
+	{
+		"full build information",
+		"1.0.1-g1a2b3c4d", "1a2b3c4d5e6f", "2023-01-02T15:04:05Z",
+		"git-bundle-server/1.0.1-g1a2b3c4d",
+		"git-bundle-server version 1.0.1-g1a2b3c4d\n" +
+			"commit: 1a2b3c4d5e6f\n" +
+			"build date: 2023-01-02T15:04:05Z\n" +
+			"go version: " + runtime.Version() + "\n",
+	},
+}
+
+func TestDescribe(t *testing.T) {
+	defer func(version, commit, buildDate string) {
+		buildinfo.Version, buildinfo.Commit, buildinfo.BuildDate = version, commit, buildDate
+	}(buildinfo.Version, buildinfo.Commit, buildinfo.BuildDate)
+
+	for _, tt := range describeTests {
+		t.Run(tt.title, func(t *testing.T) {
+			buildinfo.Version = tt.version
+			buildinfo.Commit = tt.commit
+			buildinfo.BuildDate = tt.buildDate
+
+			assert.Equal(t, tt.expectedUserAgent, buildinfo.UserAgent("git-bundle-server"))
+			assert.Equal(t, tt.expectedDescribe, buildinfo.Describe("git-bundle-server"))
+		})
+	}
+}
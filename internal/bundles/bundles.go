@@ -2,7 +2,10 @@ package bundles
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -24,6 +27,10 @@ const (
 	BundleListJsonFilename string = "bundle-list.json"
 	BundleListFilename     string = "bundle-list"
 	RepoBundleListFilename string = "repo-bundle-list"
+
+	// The checksum manifest of a route's bundles, in the format of
+	// 'sha256sum' (so it can be checked with 'sha256sum --check').
+	ChecksumManifestFilename string = "bundle-checksums"
 )
 
 type BundleHeader struct {
@@ -47,29 +54,87 @@ type Bundle struct {
 
 	// The creation token used in Git's 'creationToken' heuristic
 	CreationToken int64
+
+	// The hex-encoded SHA-256 checksum of the bundle file, computed when the
+	// bundle is created. Empty for bundles created before checksums were
+	// recorded.
+	Checksum string
+
+	// The object filter (e.g. 'blob:none') the bundle was created with; empty
+	// if the bundle contains all objects.
+	Filter string
+
+	// The depth of the history of a depth-limited base bundle (see
+	// 'core.Repository.Depth'); zero if the bundle isn't depth-limited.
+	Depth int
 }
 
 func NewBundle(repo *core.Repository, timestamp int64) Bundle {
-	bundleName := fmt.Sprintf("bundle-%d.bundle", timestamp)
+	return newBundleWithPrefix(repo, "bundle", timestamp)
+}
+
+// newBundleWithPrefix creates a bundle whose filename starts with the given
+// prefix (e.g. "base" for a bundle containing the whole repository), so that
+// bundles created in different ways with the same creation token don't share
+// a file.
+func newBundleWithPrefix(repo *core.Repository, prefix string, timestamp int64) Bundle {
+	bundleName := fmt.Sprintf("%s-%d.bundle", prefix, timestamp)
 	return Bundle{
 		URI:           path.Join("/", repo.Route, bundleName),
 		Filename:      filepath.Join(repo.WebDir, bundleName),
 		CreationToken: timestamp,
+		Filter:        repo.Filter,
+	}
+}
+
+// The bundle list heuristics supported by the bundle server.
+const (
+	// Each bundle is assigned a creation token (its creation timestamp) that
+	// is greater than those of the bundles it builds on, so that clients can
+	// download only the bundles newer than the ones they already have.
+	HeuristicCreationToken string = "creationToken"
+
+	// No heuristic: clients download every bundle in the list.
+	HeuristicNone string = "none"
+)
+
+// ParseHeuristic converts the name of a heuristic (as given by a user) to the
+// value stored in a BundleList.
+func ParseHeuristic(name string) (string, error) {
+	switch name {
+	case HeuristicCreationToken:
+		return HeuristicCreationToken, nil
+	case HeuristicNone:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported heuristic '%s' (valid heuristics are: '%s', '%s')",
+			name, HeuristicCreationToken, HeuristicNone)
 	}
 }
 
 type BundleList struct {
-	Version   int
-	Mode      string
+	Version int
+
+	// The bundle list mode (see 'bundle.mode' in git-config(1)).
+	Mode string
+
+	// The heuristic clients use to choose which bundles to download; empty
+	// if the list has no heuristic.
 	Heuristic string
-	Bundles   map[int64]Bundle
+
+	// The ref the remote's HEAD pointed to (its default branch, e.g.
+	// 'refs/heads/main') when the repository was last fetched; empty if
+	// unknown.
+	Head string
+
+	Bundles map[int64]Bundle
 }
 
-func NewBundleList() *BundleList {
+func NewBundleList(heuristic string) *BundleList {
 	return &BundleList{
 		Version:   1,
 		Mode:      "any",
-		Heuristic: "creationToken",
+		Heuristic: heuristic,
 		Bundles:   make(map[int64]Bundle),
 	}
 }
@@ -89,39 +154,228 @@ func (list *BundleList) sortedCreationTokens() []int64 {
 	return keys
 }
 
+// LatestCreationToken returns the creation token of the newest bundle in the
+// list, or 0 if the list is empty. It only changes when a new bundle is added,
+// so clients can compare it to the one they last fetched.
+func (list *BundleList) LatestCreationToken() int64 {
+	latest := int64(0)
+	for token := range list.Bundles {
+		if token > latest {
+			latest = token
+		}
+	}
+	return latest
+}
+
+// Relocate updates the URIs and filenames of the bundles in the list to those
+// of the same files in the given repository (e.g. after its route is renamed).
+func (list *BundleList) Relocate(repo *core.Repository) {
+	for token, bundle := range list.Bundles {
+		bundleName := path.Base(bundle.URI)
+		bundle.URI = path.Join("/", repo.Route, bundleName)
+		bundle.Filename = filepath.Join(repo.WebDir, bundleName)
+		list.Bundles[token] = bundle
+	}
+}
+
+// ContainsBundleFile returns whether the given filename (with no leading
+// directories) identifies one of the bundles in the list.
+func (list *BundleList) ContainsBundleFile(filename string) bool {
+	for _, bundle := range list.Bundles {
+		if path.Base(bundle.URI) == filename {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleURI returns the URI of the bundle in the repository's bundle list. If
+// the repository has a base URL, the URI is absolute; otherwise, it is the
+// path of the bundle relative to 'uriBase' (the directory of the request URI
+// of the bundle list).
+func bundleURI(repo *core.Repository, bundle Bundle, uriBase string) string {
+	if baseURL := strings.TrimSuffix(repo.EffectiveBaseURL(), "/"); baseURL != "" {
+		return baseURL + bundle.URI
+	}
+
+	// Get the URI relative to the bundle server root
+	uri := strings.TrimPrefix(bundle.URI, uriBase)
+	if uri == bundle.URI {
+		panic("error resolving bundle URI paths")
+	}
+	return uri
+}
+
+// WriteBundleListFile writes the bundle list in the format read by Git, with
+// bundle URIs relative to the given request URI (unless the repository has a
+// base URL, in which case they are absolute).
+func WriteBundleListFile(f io.Writer, list *BundleList, repo *core.Repository, requestUri string) error {
+	out := bufio.NewWriter(f)
+	defer out.Flush()
+
+	fmt.Fprintf(out, "[bundle]\n\tversion = %d\n\tmode = %s\n", list.Version, list.Mode)
+	if list.Heuristic != "" {
+		fmt.Fprintf(out, "\theuristic = %s\n", list.Heuristic)
+	}
+	fmt.Fprint(out, "\n")
+
+	uriBase := path.Dir(requestUri) + "/"
+	for _, token := range list.sortedCreationTokens() {
+		bundle := list.Bundles[token]
+
+		fmt.Fprintf(
+			out, "[bundle \"%d\"]\n\turi = %s\n\tcreationToken = %d\n",
+			token, bundleURI(repo, bundle, uriBase), token)
+		if bundle.Filter != "" {
+			// Lets clients choose the bundles matching their own filter
+			fmt.Fprintf(out, "\tfilter = %s\n", bundle.Filter)
+		}
+		if bundle.Depth > 0 {
+			// Git ignores unknown keys; lets clients aware of it skip a
+			// base bundle whose prerequisites they don't have, rather
+			// than downloading it only to fail to apply it.
+			fmt.Fprintf(out, "\tdepth = %d\n", bundle.Depth)
+		}
+		fmt.Fprint(out, "\n")
+	}
+	return nil
+}
+
+// BundleListJson is the JSON representation of a bundle list served to
+// clients (e.g. tooling inspecting the server). Unlike the internal JSON
+// representation, it doesn't include any details of the server's storage.
+type BundleListJson struct {
+	Version   int    `json:"version"`
+	Mode      string `json:"mode"`
+	Heuristic string `json:"heuristic,omitempty"`
+
+	// The ref of the remote's default branch (e.g. 'refs/heads/main'), if
+	// known.
+	Head string `json:"head,omitempty"`
+
+	// The bundles in the list, sorted by creation token.
+	Bundles []BundleJson `json:"bundles"`
+}
+
+type BundleJson struct {
+	ID string `json:"id"`
+
+	// The URI of the bundle: either an absolute URL (if a base URL is
+	// configured) or the absolute path of the bundle on the web server.
+	URI string `json:"uri"`
+
+	CreationToken int64 `json:"creationToken"`
+
+	// The hex-encoded SHA-256 checksum of the bundle, if known.
+	Checksum string `json:"sha256,omitempty"`
+
+	// The object filter of the bundle, if it is filtered.
+	Filter string `json:"filter,omitempty"`
+
+	// The depth of the history of the bundle, if it is a depth-limited base
+	// bundle.
+	Depth int `json:"depth,omitempty"`
+}
+
+// NewBundleListJson converts the bundle list of the given repository to its
+// client-facing JSON representation. If the repository has no base URL, the
+// bundle URIs are paths on the web server, under 'pathPrefix' (e.g.
+// '/bundles') if the web server is mounted under one.
+func NewBundleListJson(list *BundleList, repo *core.Repository, pathPrefix string) *BundleListJson {
+	listJson := &BundleListJson{
+		Version:   list.Version,
+		Mode:      list.Mode,
+		Heuristic: list.Heuristic,
+		Head:      list.Head,
+		Bundles:   []BundleJson{},
+	}
+
+	baseURL := strings.TrimSuffix(repo.EffectiveBaseURL(), "/")
+	if baseURL == "" {
+		baseURL = pathPrefix
+	}
+	for _, token := range list.sortedCreationTokens() {
+		listJson.Bundles = append(listJson.Bundles, BundleJson{
+			ID:            strconv.FormatInt(token, 10),
+			URI:           baseURL + list.Bundles[token].URI,
+			CreationToken: token,
+			Checksum:      list.Bundles[token].Checksum,
+			Filter:        list.Bundles[token].Filter,
+			Depth:         list.Bundles[token].Depth,
+		})
+	}
+
+	return listJson
+}
+
 type BundleProvider interface {
 	CreateInitialBundle(ctx context.Context, repo *core.Repository) Bundle
 	CreateIncrementalBundle(ctx context.Context, repo *core.Repository, list *BundleList) (*Bundle, error)
 
-	CreateSingletonList(ctx context.Context, bundle Bundle) *BundleList
+	CreateSingletonList(ctx context.Context, bundle Bundle, heuristic string) *BundleList
 	WriteBundleList(ctx context.Context, list *BundleList, repo *core.Repository) error
 	GetBundleList(ctx context.Context, repo *core.Repository) (*BundleList, error)
 	CollapseList(ctx context.Context, repo *core.Repository, list *BundleList) error
+	ApplyRetention(ctx context.Context, repo *core.Repository, list *BundleList) (*RetentionResult, error)
+
+	// Rebase replaces the route's bundle list with a single new base bundle
+	// of the current content of its repository, and returns the new list.
+	// The list is replaced in one step, so clients are never served a list
+	// without a base bundle; the previous bundles are left for 'prune' (or
+	// the retention policy) to remove.
+	Rebase(ctx context.Context, repo *core.Repository, list *BundleList) (*BundleList, error)
+	FindStaleFiles(ctx context.Context, repo *core.Repository, list *BundleList) ([]StaleFile, error)
+
+	// VerifyBundle checks that the bundle's file exists and that Git considers
+	// it a valid bundle of the repository.
+	VerifyBundle(ctx context.Context, repo *core.Repository, bundle Bundle) error
+
+	// ComputeChecksum computes the hex-encoded SHA-256 checksum of the
+	// bundle's file.
+	ComputeChecksum(ctx context.Context, bundle Bundle) (string, error)
+
+	// EnsureSpaceForBaseBundle returns an InsufficientSpaceError if the
+	// filesystem of the route's web directory doesn't have room for a base
+	// bundle of its repository, estimated from the size of the repository's
+	// objects.
+	EnsureSpaceForBaseBundle(ctx context.Context, repo *core.Repository) error
 }
 
 type bundleProvider struct {
 	logger     log.TraceLogger
 	fileSystem common.FileSystem
 	gitHelper  git.GitHelper
+	storage    BundleStorage
+
+	// The signer of bundles and bundle lists; nil if signing is disabled.
+	signer Signer
 }
 
 func NewBundleProvider(
 	l log.TraceLogger,
 	fs common.FileSystem,
 	g git.GitHelper,
+	s BundleStorage,
+	signer Signer,
 ) BundleProvider {
 	return &bundleProvider{
 		logger:     l,
 		fileSystem: fs,
 		gitHelper:  g,
+		storage:    s,
+		signer:     signer,
 	}
 }
 
 func (b *bundleProvider) CreateInitialBundle(ctx context.Context, repo *core.Repository) Bundle {
-	return NewBundle(repo, time.Now().UTC().Unix())
+	bundle := NewBundle(repo, time.Now().UTC().Unix())
+	bundle.Depth = repo.Depth
+	return bundle
 }
 
-func (b *bundleProvider) createDistinctBundle(repo *core.Repository, list *BundleList) Bundle {
+// distinctCreationToken returns a creation token for a new bundle that is
+// greater than those of all bundles in the list.
+func (b *bundleProvider) distinctCreationToken(list *BundleList) int64 {
 	timestamp := time.Now().UTC().Unix()
 
 	keys := list.sortedCreationTokens()
@@ -131,29 +385,40 @@ func (b *bundleProvider) createDistinctBundle(repo *core.Repository, list *Bundl
 		timestamp = maxTimestamp + 1
 	}
 
-	return NewBundle(repo, timestamp)
+	return timestamp
 }
 
-func (b *bundleProvider) CreateSingletonList(ctx context.Context, bundle Bundle) *BundleList {
-	list := NewBundleList()
+func (b *bundleProvider) CreateSingletonList(ctx context.Context, bundle Bundle, heuristic string) *BundleList {
+	list := NewBundleList(heuristic)
 	list.addBundle(bundle)
 	return list
 }
 
 // Given a BundleList, write the bundle list content to the web directory.
+//
+// The update is atomic: each file is written to a lock file and renamed into
+// place only once every bundle in the list is fully written to disk (and
+// published), so a reader never sees a list referencing a missing or partial
+// bundle, even if the process dies partway through.
 func (b *bundleProvider) WriteBundleList(ctx context.Context, list *BundleList, repo *core.Repository) error {
-	//lint:ignore SA4006 always override the ctx with the result from 'Region()'
 	ctx, exitRegion := b.logger.Region(ctx, "bundles", "write_bundle_list")
 	defer exitRegion()
 
-	var listLockFile, repoListLockFile, jsonLockFile common.LockFile
+	var listLockFile, repoListLockFile, checksumLockFile, jsonLockFile common.LockFile
+	signatureLockFiles := []common.LockFile{}
 	rollbackAll := func() {
+		for _, lockFile := range signatureLockFiles {
+			lockFile.Rollback()
+		}
 		if listLockFile != nil {
 			listLockFile.Rollback()
 		}
 		if repoListLockFile != nil {
 			repoListLockFile.Rollback()
 		}
+		if checksumLockFile != nil {
+			checksumLockFile.Rollback()
+		}
 		if jsonLockFile != nil {
 			jsonLockFile.Rollback()
 		}
@@ -162,34 +427,55 @@ func (b *bundleProvider) WriteBundleList(ctx context.Context, list *BundleList,
 	// Write the bundle list files: one for requests with a trailing slash
 	// (where the relative bundle paths are '<bundlefile>'), one for requests
 	// without a trailing slash (where the relative bundle paths are
-	// '<repo>/<bundlefile>').
+	// '<repo>/<bundlefile>'). If a base URL is configured, both lists contain
+	// the same absolute URIs instead.
 	keys := list.sortedCreationTokens()
 	writeListFile := func(f io.Writer, requestUri string) error {
-		out := bufio.NewWriter(f)
-		defer out.Flush()
+		return WriteBundleListFile(f, list, repo, requestUri)
+	}
 
-		fmt.Fprintf(
-			out, "[bundle]\n\tversion = %d\n\tmode = %s\n\theuristic = %s\n\n",
-			list.Version, list.Mode, list.Heuristic)
+	// If signing is enabled, the files served to clients are written along
+	// with a detached signature of their content.
+	signedFiles := []string{}
+	writeSignedLockFile := func(filename string, writeFunc func(io.Writer) error) (common.LockFile, error) {
+		if b.signer == nil {
+			return b.fileSystem.WriteLockFileFunc(filename, writeFunc)
+		}
 
-		uriBase := path.Dir(requestUri) + "/"
-		for _, token := range keys {
-			bundle := list.Bundles[token]
+		content := bytes.Buffer{}
+		err := writeFunc(&content)
+		if err != nil {
+			return nil, err
+		}
 
-			// Get the URI relative to the bundle server root
-			uri := strings.TrimPrefix(bundle.URI, uriBase)
-			if uri == bundle.URI {
-				panic("error resolving bundle URI paths")
-			}
+		signature, err := b.signer.Sign(ctx, bytes.NewReader(content.Bytes()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign %s: %w", filepath.Base(filename), err)
+		}
 
-			fmt.Fprintf(
-				out, "[bundle \"%d\"]\n\turi = %s\n\tcreationToken = %d\n\n",
-				token, uri, token)
+		lockFile, err := b.fileSystem.WriteLockFileFunc(filename, func(f io.Writer) error {
+			_, err := f.Write(content.Bytes())
+			return err
+		})
+		if err != nil {
+			return nil, err
 		}
-		return nil
+
+		signatureLockFile, err := b.fileSystem.WriteLockFileFunc(filename+SignatureSuffix, func(f io.Writer) error {
+			_, err := f.Write(signature)
+			return err
+		})
+		if err != nil {
+			lockFile.Rollback()
+			return nil, err
+		}
+		signatureLockFiles = append(signatureLockFiles, signatureLockFile)
+		signedFiles = append(signedFiles, filepath.Base(filename)+SignatureSuffix)
+
+		return lockFile, nil
 	}
 
-	listLockFile, err := b.fileSystem.WriteLockFileFunc(
+	listLockFile, err := writeSignedLockFile(
 		filepath.Join(repo.WebDir, BundleListFilename),
 		func(f io.Writer) error {
 			return writeListFile(f, path.Join("/", repo.Route)+"/")
@@ -200,7 +486,7 @@ func (b *bundleProvider) WriteBundleList(ctx context.Context, list *BundleList,
 		return err
 	}
 
-	repoListLockFile, err = b.fileSystem.WriteLockFileFunc(
+	repoListLockFile, err = writeSignedLockFile(
 		filepath.Join(repo.WebDir, RepoBundleListFilename),
 		func(f io.Writer) error {
 			return writeListFile(f, path.Join("/", repo.Route))
@@ -211,6 +497,28 @@ func (b *bundleProvider) WriteBundleList(ctx context.Context, list *BundleList,
 		return err
 	}
 
+	// Write the checksum manifest. Bundles without a recorded checksum are
+	// omitted.
+	checksumLockFile, err = writeSignedLockFile(
+		filepath.Join(repo.WebDir, ChecksumManifestFilename),
+		func(f io.Writer) error {
+			out := bufio.NewWriter(f)
+			defer out.Flush()
+
+			for _, token := range keys {
+				bundle := list.Bundles[token]
+				if bundle.Checksum != "" {
+					fmt.Fprintf(out, "%s  %s\n", bundle.Checksum, path.Base(bundle.URI))
+				}
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		rollbackAll()
+		return err
+	}
+
 	// Write the (internal-use) JSON representation of the bundle list
 	jsonLockFile, err = b.fileSystem.WriteLockFileFunc(
 		filepath.Join(repo.RepoDir, BundleListJsonFilename),
@@ -224,7 +532,7 @@ func (b *bundleProvider) WriteBundleList(ctx context.Context, list *BundleList,
 			for written < len(data) {
 				n, writeErr := f.Write(data[written:])
 				if writeErr != nil {
-					return fmt.Errorf("failed to write JSON: %w", err)
+					return fmt.Errorf("failed to write JSON: %w", writeErr)
 				}
 				written += n
 			}
@@ -237,6 +545,39 @@ func (b *bundleProvider) WriteBundleList(ctx context.Context, list *BundleList,
 		return err
 	}
 
+	// Flush & publish the bundles before the lists referencing them, so that
+	// clients never see a list containing a bundle they can't download.
+	// Bundles are never modified after they're created, so existing ones are
+	// skipped when publishing.
+	for _, token := range keys {
+		bundle := list.Bundles[token]
+		err = b.fileSystem.SyncFile(bundle.Filename)
+		if err != nil {
+			rollbackAll()
+			return fmt.Errorf("failed to flush bundle to disk: %w", err)
+		}
+
+		err = b.storage.Publish(ctx, repo, path.Base(bundle.URI), false)
+		if err != nil {
+			rollbackAll()
+			return fmt.Errorf("failed to publish bundle: %w", err)
+		}
+
+		if b.signer != nil {
+			err = b.signBundle(ctx, bundle)
+			if err != nil {
+				rollbackAll()
+				return err
+			}
+
+			err = b.storage.Publish(ctx, repo, path.Base(bundle.URI)+SignatureSuffix, false)
+			if err != nil {
+				rollbackAll()
+				return fmt.Errorf("failed to publish bundle signature: %w", err)
+			}
+		}
+	}
+
 	// Commit all lockfiles
 	err = jsonLockFile.Commit()
 	if err != nil {
@@ -253,6 +594,29 @@ func (b *bundleProvider) WriteBundleList(ctx context.Context, list *BundleList,
 		return fmt.Errorf("failed to rename repo-level bundle list file: %w", err)
 	}
 
+	err = checksumLockFile.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to rename checksum manifest file: %w", err)
+	}
+
+	// The lists and their signatures can't be replaced together, so a client
+	// may briefly see a signature that doesn't match its list; it must retry
+	// rather than treat that as tampering.
+	for _, lockFile := range signatureLockFiles {
+		err = lockFile.Commit()
+		if err != nil {
+			return fmt.Errorf("failed to rename signature file: %w", err)
+		}
+	}
+
+	published := []string{BundleListFilename, RepoBundleListFilename, ChecksumManifestFilename}
+	for _, filename := range append(published, signedFiles...) {
+		err = b.storage.Publish(ctx, repo, filename, true)
+		if err != nil {
+			return fmt.Errorf("failed to publish bundle list: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -347,8 +711,12 @@ func (b *bundleProvider) getBundleHeader(bundle Bundle) (*BundleHeader, error) {
 	return &header, nil
 }
 
-func (b *bundleProvider) getAllPrereqsForIncrementalBundle(list *BundleList) ([]string, error) {
-	prereqs := []string{}
+// getAllPrereqsForIncrementalBundle returns the tips of all bundles in the
+// list, excluded from the next incremental bundle. Tips that no longer exist in
+// the repository (e.g. of branches deleted from the remote, then pruned and
+// garbage collected) are skipped, since Git can't exclude them.
+func (b *bundleProvider) getAllPrereqsForIncrementalBundle(ctx context.Context, repo *core.Repository, list *BundleList) ([]string, error) {
+	tips := []string{}
 
 	for _, bundle := range list.Bundles {
 		header, err := b.getBundleHeader(bundle)
@@ -357,6 +725,18 @@ func (b *bundleProvider) getAllPrereqsForIncrementalBundle(list *BundleList) ([]
 		}
 
 		for _, oid := range header.Refs {
+			tips = append(tips, oid)
+		}
+	}
+
+	missing, err := b.gitHelper.GetMissingObjects(ctx, repo.RepoDir, tips)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bundle tips: %w", err)
+	}
+
+	prereqs := []string{}
+	for _, oid := range tips {
+		if !missing[oid] {
 			prereqs = append(prereqs, "^"+oid)
 		}
 	}
@@ -369,19 +749,19 @@ func (b *bundleProvider) CreateIncrementalBundle(ctx context.Context, repo *core
 	defer exitRegion()
 
 	// Fetch latest updates to repo
-	err := b.gitHelper.UpdateBareRepo(ctx, repo.RepoDir)
+	err := b.gitHelper.UpdateBareRepo(ctx, repo.RepoDir, repo.RemoteConfig(), !repo.NoPrune)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch updates to repo: %w", err)
 	}
 
-	bundle := b.createDistinctBundle(repo, list)
+	bundle := NewBundle(repo, b.distinctCreationToken(list))
 
-	lines, err := b.getAllPrereqsForIncrementalBundle(list)
+	lines, err := b.getAllPrereqsForIncrementalBundle(ctx, repo, list)
 	if err != nil {
 		return nil, err
 	}
 
-	written, err := b.gitHelper.CreateIncrementalBundle(ctx, repo.RepoDir, bundle.Filename, lines)
+	written, err := b.gitHelper.CreateIncrementalBundle(ctx, repo.RepoDir, bundle.Filename, lines, repo.Refs, bundle.Filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create incremental bundle: %w", err)
 	}
@@ -390,63 +770,137 @@ func (b *bundleProvider) CreateIncrementalBundle(ctx context.Context, repo *core
 		return nil, nil
 	}
 
+	err = b.sealNewBundle(ctx, repo, &bundle)
+	if err != nil {
+		return nil, err
+	}
+
 	return &bundle, nil
 }
 
-func (b *bundleProvider) CollapseList(ctx context.Context, repo *core.Repository, list *BundleList) error {
-	ctx, exitRegion := b.logger.Region(ctx, "bundles", "collapse_list")
+func (b *bundleProvider) VerifyBundle(ctx context.Context, repo *core.Repository, bundle Bundle) error {
+	ctx, exitRegion := b.logger.Region(ctx, "bundles", "verify_bundle")
 	defer exitRegion()
 
-	maxBundles := 5
-
-	if len(list.Bundles) <= maxBundles {
-		return nil
+	_, err := b.fileSystem.Stat(bundle.Filename)
+	if err != nil {
+		return fmt.Errorf("failed to read bundle file: %w", err)
 	}
 
-	keys := list.sortedCreationTokens()
+	return b.gitHelper.VerifyBundle(ctx, repo.RepoDir, bundle.Filename)
+}
 
-	refs := make(map[string]string)
+func (b *bundleProvider) ComputeChecksum(ctx context.Context, bundle Bundle) (string, error) {
+	//lint:ignore SA4006 always override the ctx with the result from 'Region()'
+	ctx, exitRegion := b.logger.Region(ctx, "bundles", "compute_checksum")
+	defer exitRegion()
 
-	maxTimestamp := int64(0)
+	file, err := os.Open(bundle.Filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to open bundle file: %w", err)
+	}
+	defer file.Close()
 
-	for i := range keys[0 : len(keys)-maxBundles+1] {
-		bundle := list.Bundles[keys[i]]
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read bundle file: %w", err)
+	}
 
-		if bundle.CreationToken > maxTimestamp {
-			maxTimestamp = bundle.CreationToken
-		}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
 
-		header, err := b.getBundleHeader(bundle)
-		if err != nil {
-			return fmt.Errorf("failed to parse bundle file %s: %w", bundle.Filename, err)
-		}
+// signBundle writes the detached signature of the bundle next to its file,
+// unless it already exists. Bundles never change after they're created, so
+// neither do their signatures.
+func (b *bundleProvider) signBundle(ctx context.Context, bundle Bundle) error {
+	signatureFile := bundle.Filename + SignatureSuffix
+	exists, err := b.fileSystem.FileExists(signatureFile)
+	if err != nil {
+		return fmt.Errorf("failed to check for bundle signature: %w", err)
+	} else if exists {
+		return nil
+	}
 
-		// Ignore the old ref name and instead use the OID
-		// to generate the ref name. This allows us to create new
-		// refs that point to exactly these objects without disturbing
-		// refs/heads/ which is tracking the remote refs.
-		for _, oid := range header.Refs {
-			refs["refs/base/"+oid] = oid
-		}
+	file, err := os.Open(bundle.Filename)
+	if err != nil {
+		return fmt.Errorf("failed to open bundle file: %w", err)
+	}
+	defer file.Close()
 
-		delete(list.Bundles, keys[i])
+	signature, err := b.signer.Sign(ctx, file)
+	if err != nil {
+		return fmt.Errorf("failed to sign bundle %s: %w", filepath.Base(bundle.Filename), err)
 	}
 
-	// TODO: Use Git to determine which OIDs are "maximal" in the set
-	// and which are not implied by the previous ones.
+	lockFile, err := b.fileSystem.WriteLockFileFunc(signatureFile, func(f io.Writer) error {
+		_, err := f.Write(signature)
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-	// TODO: Use Git to determine which OIDs are required as prerequisites
-	// of the remaining bundles and latest ref tips, so we can "GC" the
-	// branches that were never merged and may have been force-pushed or
-	// deleted.
+	err = lockFile.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to rename bundle signature file: %w", err)
+	}
+	return nil
+}
 
-	bundle := NewBundle(repo, maxTimestamp)
+// sealNewBundle verifies a bundle that was just created and records its
+// checksum. If the bundle is invalid, it is deleted so that it can never be
+// added to a bundle list.
+func (b *bundleProvider) sealNewBundle(ctx context.Context, repo *core.Repository, bundle *Bundle) error {
+	err := b.VerifyBundle(ctx, repo, *bundle)
+	if err != nil {
+		b.fileSystem.DeleteFile(bundle.Filename)
+		return fmt.Errorf("new bundle %s failed verification: %w", bundle.Filename, err)
+	}
 
-	err := b.gitHelper.CreateBundleFromRefs(ctx, repo.RepoDir, bundle.Filename, refs)
+	bundle.Checksum, err = b.ComputeChecksum(ctx, *bundle)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to compute checksum of new bundle %s: %w", bundle.Filename, err)
 	}
 
-	list.Bundles[maxTimestamp] = bundle
+	b.logger.AddToCounter(ctx, "bundles", "created", 1)
+	if info, err := b.fileSystem.Stat(bundle.Filename); err == nil {
+		b.logger.Data(ctx, "bundles", "bundle_size", info.Size())
+		b.logger.AddToCounter(ctx, "bundles", "bytes_created", info.Size())
+	}
 	return nil
 }
+
+// InsufficientSpaceError is the error returned when a bundle is not created
+// because the disk is too full to hold it.
+type InsufficientSpaceError struct {
+	Dir       string
+	Required  int64
+	Available int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space to create a bundle in '%s': about %s is needed, but only %s is available",
+		e.Dir, core.FormatApproxByteSize(e.Required), core.FormatApproxByteSize(e.Available))
+}
+
+// ensureSpace checks that a bundle of (about) 'required' bytes fits in the
+// route's web directory. The check is best-effort: if the available space
+// can't be determined, the bundle is created anyway.
+func (b *bundleProvider) ensureSpace(ctx context.Context, repo *core.Repository, required int64) error {
+	available, err := b.fileSystem.AvailableSpace(repo.WebDir)
+	if err != nil || available >= required {
+		return nil
+	}
+	return &InsufficientSpaceError{Dir: repo.WebDir, Required: required, Available: available}
+}
+
+func (b *bundleProvider) EnsureSpaceForBaseBundle(ctx context.Context, repo *core.Repository) error {
+	// A base bundle contains (at most) every object of the repository, in a
+	// pack about the size of the repository's own.
+	required, err := b.fileSystem.DirSize(filepath.Join(repo.RepoDir, "objects"))
+	if err != nil {
+		return fmt.Errorf("failed to estimate size of base bundle: %w", err)
+	}
+	return b.ensureSpace(ctx, repo, required)
+}
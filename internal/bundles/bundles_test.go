@@ -3,11 +3,17 @@ package bundles_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
 	"github.com/git-ecosystem/git-bundle-server/internal/core"
 	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
 	"github.com/stretchr/testify/assert"
@@ -169,6 +175,243 @@ var writeBundleListTests = []struct {
 		},
 		false,
 	},
+	{
+		"Base URL produces absolute URIs",
+		&bundles.BundleList{
+			Version:   1,
+			Mode:      "all",
+			Heuristic: "creationToken",
+			Bundles: map[int64]bundles.Bundle{
+				1: {
+					URI:           "/test/myrepo/bundle-1.bundle",
+					Filename:      "/test/home/git-bundle-server/www/test/myrepo/bundle-1.bundle",
+					CreationToken: 1,
+				},
+			},
+		},
+		&core.Repository{
+			Route:         "test/myrepo",
+			RepoDir:       "/test/home/git-bundle-server/git/test/myrepo/",
+			WebDir:        "/test/home/git-bundle-server/www/test/myrepo/",
+			ServerBaseURL: "https://bundles.example.com/",
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			`	heuristic = creationToken`,
+			``,
+			`[bundle "1"]`,
+			`	uri = https://bundles.example.com/test/myrepo/bundle-1.bundle`,
+			`	creationToken = 1`,
+			``,
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			`	heuristic = creationToken`,
+			``,
+			`[bundle "1"]`,
+			`	uri = https://bundles.example.com/test/myrepo/bundle-1.bundle`,
+			`	creationToken = 1`,
+			``,
+		},
+		false,
+	},
+	{
+		"Route base URL overrides server base URL",
+		&bundles.BundleList{
+			Version:   1,
+			Mode:      "all",
+			Heuristic: "creationToken",
+			Bundles: map[int64]bundles.Bundle{
+				1: {
+					URI:           "/test/myrepo/bundle-1.bundle",
+					Filename:      "/test/home/git-bundle-server/www/test/myrepo/bundle-1.bundle",
+					CreationToken: 1,
+				},
+			},
+		},
+		&core.Repository{
+			Route:         "test/myrepo",
+			RepoDir:       "/test/home/git-bundle-server/git/test/myrepo/",
+			WebDir:        "/test/home/git-bundle-server/www/test/myrepo/",
+			BaseURL:       "https://cdn.example.com/prefix",
+			ServerBaseURL: "https://bundles.example.com",
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			`	heuristic = creationToken`,
+			``,
+			`[bundle "1"]`,
+			`	uri = https://cdn.example.com/prefix/test/myrepo/bundle-1.bundle`,
+			`	creationToken = 1`,
+			``,
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			`	heuristic = creationToken`,
+			``,
+			`[bundle "1"]`,
+			`	uri = https://cdn.example.com/prefix/test/myrepo/bundle-1.bundle`,
+			`	creationToken = 1`,
+			``,
+		},
+		false,
+	},
+	{
+		"Filtered bundles",
+		&bundles.BundleList{
+			Version:   1,
+			Mode:      "all",
+			Heuristic: "creationToken",
+			Bundles: map[int64]bundles.Bundle{
+				1: {
+					URI:           "/test/myrepo/bundle-1.bundle",
+					Filename:      "/test/home/git-bundle-server/www/test/myrepo/bundle-1.bundle",
+					CreationToken: 1,
+					Filter:        "blob:none",
+				},
+			},
+		},
+		&core.Repository{
+			Route:   "test/myrepo",
+			RepoDir: "/test/home/git-bundle-server/git/test/myrepo/",
+			WebDir:  "/test/home/git-bundle-server/www/test/myrepo/",
+			Filter:  "blob:none",
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			`	heuristic = creationToken`,
+			``,
+			`[bundle "1"]`,
+			`	uri = bundle-1.bundle`,
+			`	creationToken = 1`,
+			`	filter = blob:none`,
+			``,
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			`	heuristic = creationToken`,
+			``,
+			`[bundle "1"]`,
+			`	uri = myrepo/bundle-1.bundle`,
+			`	creationToken = 1`,
+			`	filter = blob:none`,
+			``,
+		},
+		false,
+	},
+	{
+		"Depth-limited base bundle",
+		&bundles.BundleList{
+			Version:   1,
+			Mode:      "all",
+			Heuristic: "creationToken",
+			Bundles: map[int64]bundles.Bundle{
+				1: {
+					URI:           "/test/myrepo/bundle-1.bundle",
+					Filename:      "/test/home/git-bundle-server/www/test/myrepo/bundle-1.bundle",
+					CreationToken: 1,
+					Depth:         100,
+				},
+				2: {
+					URI:           "/test/myrepo/bundle-2.bundle",
+					Filename:      "/test/home/git-bundle-server/www/test/myrepo/bundle-2.bundle",
+					CreationToken: 2,
+				},
+			},
+		},
+		&core.Repository{
+			Route:   "test/myrepo",
+			RepoDir: "/test/home/git-bundle-server/git/test/myrepo/",
+			WebDir:  "/test/home/git-bundle-server/www/test/myrepo/",
+			Depth:   100,
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			`	heuristic = creationToken`,
+			``,
+			`[bundle "1"]`,
+			`	uri = bundle-1.bundle`,
+			`	creationToken = 1`,
+			`	depth = 100`,
+			``,
+			`[bundle "2"]`,
+			`	uri = bundle-2.bundle`,
+			`	creationToken = 2`,
+			``,
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			`	heuristic = creationToken`,
+			``,
+			`[bundle "1"]`,
+			`	uri = myrepo/bundle-1.bundle`,
+			`	creationToken = 1`,
+			`	depth = 100`,
+			``,
+			`[bundle "2"]`,
+			`	uri = myrepo/bundle-2.bundle`,
+			`	creationToken = 2`,
+			``,
+		},
+		false,
+	},
+	{
+		"No heuristic",
+		&bundles.BundleList{
+			Version:   1,
+			Mode:      "all",
+			Heuristic: "",
+			Bundles: map[int64]bundles.Bundle{
+				1: {
+					URI:           "/test/myrepo/bundle-1.bundle",
+					Filename:      "/test/home/git-bundle-server/www/test/myrepo/bundle-1.bundle",
+					CreationToken: 1,
+				},
+			},
+		},
+		&core.Repository{
+			Route:   "test/myrepo",
+			RepoDir: "/test/home/git-bundle-server/git/test/myrepo/",
+			WebDir:  "/test/home/git-bundle-server/www/test/myrepo/",
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			``,
+			`[bundle "1"]`,
+			`	uri = bundle-1.bundle`,
+			`	creationToken = 1`,
+			``,
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			``,
+			`[bundle "1"]`,
+			`	uri = myrepo/bundle-1.bundle`,
+			`	creationToken = 1`,
+			``,
+		},
+		false,
+	},
 }
 
 func TestBundles_WriteBundleList(t *testing.T) {
@@ -183,10 +426,25 @@ func TestBundles_WriteBundleList(t *testing.T) {
 	var mockWriteFunc func(io.Writer) error
 	var writeErr error
 
-	bundleProvider := bundles.NewBundleProvider(testLogger, testFileSystem, nil)
+	testStorage := &MockBundleStorage{}
+
+	bundleProvider := bundles.NewBundleProvider(testLogger, testFileSystem, nil, testStorage, nil)
 	for _, tt := range writeBundleListTests {
 		t.Run(tt.title, func(t *testing.T) {
 			// Set up mocks
+			for _, bundle := range tt.bundleList.Bundles {
+				testFileSystem.On("SyncFile", bundle.Filename).Return(nil).Once()
+				testStorage.On("Publish",
+					mock.Anything,
+					tt.repo,
+					filepath.Base(bundle.Filename),
+					false,
+				).Return(nil).Once()
+			}
+			testStorage.On("Publish", mock.Anything, tt.repo, bundles.BundleListFilename, true).Return(nil).Once()
+			testStorage.On("Publish", mock.Anything, tt.repo, bundles.RepoBundleListFilename, true).Return(nil).Once()
+			testStorage.On("Publish", mock.Anything, tt.repo, bundles.ChecksumManifestFilename, true).Return(nil).Once()
+
 			bundleListBuf := &bytes.Buffer{}
 			testFileSystem.On("WriteLockFileFunc",
 				filepath.Join(tt.repo.WebDir, bundles.BundleListFilename),
@@ -209,6 +467,13 @@ func TestBundles_WriteBundleList(t *testing.T) {
 				func(mock.Arguments) { writeErr = mockWriteFunc(repoBundleListBuf) },
 			).Return(repoBundleListLockFile, writeErr).Once()
 
+			checksumLockFile := &MockLockFile{}
+			checksumLockFile.On("Commit").Return(nil).Once()
+			testFileSystem.On("WriteLockFileFunc",
+				filepath.Join(tt.repo.WebDir, bundles.ChecksumManifestFilename),
+				mock.Anything,
+			).Return(checksumLockFile, nil)
+
 			jsonLockFile := &MockLockFile{}
 			jsonLockFile.On("Commit").Return(nil).Once()
 			testFileSystem.On("WriteLockFileFunc",
@@ -234,8 +499,439 @@ func TestBundles_WriteBundleList(t *testing.T) {
 			expectedRepoBundleList := ConcatLines(tt.repoBundleListFile)
 			assert.Equal(t, expectedRepoBundleList, actualRepoBundleList)
 
+			mock.AssertExpectationsForObjects(t, testStorage)
+
 			// Reset mocks
 			testFileSystem.Mock = mock.Mock{}
+			testStorage.Mock = mock.Mock{}
+		})
+	}
+
+	t.Run("Bundle list is not committed if a bundle can't be published", func(t *testing.T) {
+		repo := &core.Repository{
+			Route:   "test/myrepo",
+			RepoDir: "/test/home/git-bundle-server/git/test/myrepo/",
+			WebDir:  "/test/home/git-bundle-server/www/test/myrepo/",
+		}
+		list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+		list.Bundles[1] = bundles.NewBundle(repo, 1)
+
+		lockFile := &MockLockFile{}
+		lockFile.On("Rollback").Return(nil).Times(4)
+		testFileSystem.On("WriteLockFileFunc",
+			mock.AnythingOfType("string"),
+			mock.Anything,
+		).Return(lockFile, nil).Times(4)
+		testFileSystem.On("SyncFile", list.Bundles[1].Filename).Return(nil).Once()
+		testStorage.On("Publish",
+			mock.Anything,
+			repo,
+			"bundle-1.bundle",
+			false,
+		).Return(errors.New("upload failed")).Once()
+
+		err := bundleProvider.WriteBundleList(context.Background(), list, repo)
+		assert.NotNil(t, err)
+
+		// Nothing is committed & the bundle lists are never published
+		mock.AssertExpectationsForObjects(t, testFileSystem, testStorage, lockFile)
+		lockFile.AssertNotCalled(t, "Commit")
+
+		// Reset mocks
+		testFileSystem.Mock = mock.Mock{}
+		testStorage.Mock = mock.Mock{}
+	})
+
+	t.Run("Bundle list is not committed if a bundle can't be flushed to disk", func(t *testing.T) {
+		repo := &core.Repository{
+			Route:   "test/myrepo",
+			RepoDir: "/test/home/git-bundle-server/git/test/myrepo/",
+			WebDir:  "/test/home/git-bundle-server/www/test/myrepo/",
+		}
+		list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+		list.Bundles[1] = bundles.NewBundle(repo, 1)
+
+		lockFile := &MockLockFile{}
+		lockFile.On("Rollback").Return(nil).Times(4)
+		testFileSystem.On("WriteLockFileFunc",
+			mock.AnythingOfType("string"),
+			mock.Anything,
+		).Return(lockFile, nil).Times(4)
+		testFileSystem.On("SyncFile", list.Bundles[1].Filename).Return(errors.New("I/O error")).Once()
+
+		err := bundleProvider.WriteBundleList(context.Background(), list, repo)
+		assert.NotNil(t, err)
+
+		// Nothing is committed or published
+		mock.AssertExpectationsForObjects(t, testFileSystem, lockFile)
+		lockFile.AssertNotCalled(t, "Commit")
+		testStorage.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+		// Reset mocks
+		testFileSystem.Mock = mock.Mock{}
+		testStorage.Mock = mock.Mock{}
+	})
+
+	t.Run("Checksum manifest lists bundles with checksums", func(t *testing.T) {
+		repo := &core.Repository{
+			Route:   "test/myrepo",
+			RepoDir: t.TempDir(),
+			WebDir:  t.TempDir(),
+		}
+		list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+		list.Bundles[1] = bundles.NewBundle(repo, 1)
+		bundle := bundles.NewBundle(repo, 2)
+		bundle.Checksum = strings.Repeat("ab", 32)
+		list.Bundles[2] = bundle
+		for _, bundle := range list.Bundles {
+			err := os.WriteFile(bundle.Filename, []byte("bundle"), 0o600)
+			assert.Nil(t, err)
+		}
+
+		bundleProvider := bundles.NewBundleProvider(testLogger, common.NewFileSystem(), nil, bundles.NewLocalStorage(), nil)
+		err := bundleProvider.WriteBundleList(context.Background(), list, repo)
+		assert.Nil(t, err)
+
+		manifest, err := os.ReadFile(filepath.Join(repo.WebDir, bundles.ChecksumManifestFilename))
+		assert.Nil(t, err)
+		assert.Equal(t, strings.Repeat("ab", 32)+"  bundle-2.bundle\n", string(manifest))
+
+		// The checksums are kept in the stored bundle list
+		stored, err := bundleProvider.GetBundleList(context.Background(), repo)
+		assert.Nil(t, err)
+		assert.Equal(t, "", stored.Bundles[1].Checksum)
+		assert.Equal(t, strings.Repeat("ab", 32), stored.Bundles[2].Checksum)
+	})
+}
+
+func TestBundles_WriteBundleList_Signed(t *testing.T) {
+	repo := &core.Repository{
+		Route:   "test/myrepo",
+		RepoDir: t.TempDir(),
+		WebDir:  t.TempDir(),
+	}
+	list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+	list.Bundles[1] = bundles.NewBundle(repo, 1)
+	list.Bundles[2] = bundles.NewBundle(repo, 2)
+	for _, bundle := range list.Bundles {
+		err := os.WriteFile(bundle.Filename, []byte(filepath.Base(bundle.Filename)), 0o600)
+		assert.Nil(t, err)
+	}
+
+	// The bundle 1 signature already exists, so it must not be replaced
+	existingSignature := filepath.Join(repo.WebDir, "bundle-1.bundle"+bundles.SignatureSuffix)
+	err := os.WriteFile(existingSignature, []byte("existing"), 0o600)
+	assert.Nil(t, err)
+
+	signedContent := []string{}
+	testSigner := &MockSigner{}
+	testSigner.On("Sign", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		data, err := io.ReadAll(args.Get(1).(io.Reader))
+		assert.Nil(t, err)
+		signedContent = append(signedContent, string(data))
+	}).Return([]byte("signature"), nil)
+
+	bundleProvider := bundles.NewBundleProvider(&MockTraceLogger{}, common.NewFileSystem(), nil, bundles.NewLocalStorage(), testSigner)
+	err = bundleProvider.WriteBundleList(context.Background(), list, repo)
+	assert.Nil(t, err)
+
+	// The lists and new bundles are signed
+	for _, filename := range []string{
+		bundles.BundleListFilename,
+		bundles.RepoBundleListFilename,
+		bundles.ChecksumManifestFilename,
+		"bundle-2.bundle",
+	} {
+		content, err := os.ReadFile(filepath.Join(repo.WebDir, filename))
+		assert.Nil(t, err)
+		assert.Contains(t, signedContent, string(content), filename)
+
+		signature, err := os.ReadFile(filepath.Join(repo.WebDir, filename+bundles.SignatureSuffix))
+		assert.Nil(t, err)
+		assert.Equal(t, "signature", string(signature), filename)
+	}
+
+	signature, err := os.ReadFile(existingSignature)
+	assert.Nil(t, err)
+	assert.Equal(t, "existing", string(signature))
+	testSigner.AssertNumberOfCalls(t, "Sign", 4)
+}
+
+func TestBundles_ComputeChecksum(t *testing.T) {
+	repo := &core.Repository{
+		Route:  "test/myrepo",
+		WebDir: t.TempDir(),
+	}
+	bundle := bundles.NewBundle(repo, 1)
+	err := os.WriteFile(bundle.Filename, []byte("hello\n"), 0o600)
+	assert.Nil(t, err)
+
+	bundleProvider := bundles.NewBundleProvider(&MockTraceLogger{}, common.NewFileSystem(), nil, bundles.NewLocalStorage(), nil)
+	checksum, err := bundleProvider.ComputeChecksum(context.Background(), bundle)
+	assert.Nil(t, err)
+	assert.Equal(t, "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", checksum)
+
+	_, err = bundleProvider.ComputeChecksum(context.Background(), bundles.NewBundle(repo, 2))
+	assert.NotNil(t, err)
+}
+
+var parseHeuristicTests = []struct {
+	name string
+
+	expectedHeuristic string
+	expectErr         bool
+}{
+	{"creationToken", bundles.HeuristicCreationToken, false},
+	{"none", "", false},
+	{"", "", true},
+	{"creationtoken", "", true},
+	{"timestamp", "", true},
+}
+
+func TestBundles_ParseHeuristic(t *testing.T) {
+	for _, tt := range parseHeuristicTests {
+		t.Run(tt.name, func(t *testing.T) {
+			heuristic, err := bundles.ParseHeuristic(tt.name)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedHeuristic, heuristic)
+			}
+		})
+	}
+}
+
+var newBundleListJsonTests = []struct {
+	title string
+
+	baseURL    string
+	pathPrefix string
+
+	expectedURIs []string
+}{
+	{
+		"No base URL",
+		"",
+		"",
+		[]string{"/test/myrepo/bundle-1.bundle", "/test/myrepo/bundle-2.bundle"},
+	},
+	{
+		"No base URL with path prefix",
+		"",
+		"/bundles",
+		[]string{"/bundles/test/myrepo/bundle-1.bundle", "/bundles/test/myrepo/bundle-2.bundle"},
+	},
+	{
+		"Base URL",
+		"https://bundles.example.com/",
+		"/bundles",
+		[]string{
+			"https://bundles.example.com/test/myrepo/bundle-1.bundle",
+			"https://bundles.example.com/test/myrepo/bundle-2.bundle",
+		},
+	},
+}
+
+func TestBundles_NewBundleListJson(t *testing.T) {
+	for _, tt := range newBundleListJsonTests {
+		t.Run(tt.title, func(t *testing.T) {
+			repo := &core.Repository{
+				Route:   "test/myrepo",
+				WebDir:  "/test/home/git-bundle-server/www/test/myrepo",
+				BaseURL: tt.baseURL,
+			}
+
+			list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+			for _, bundle := range []bundles.Bundle{bundles.NewBundle(repo, 2), bundles.NewBundle(repo, 1)} {
+				list.Bundles[bundle.CreationToken] = bundle
+			}
+
+			listJson := bundles.NewBundleListJson(list, repo, tt.pathPrefix)
+			assert.Equal(t, 1, listJson.Version)
+			assert.Equal(t, "any", listJson.Mode)
+			assert.Equal(t, bundles.HeuristicCreationToken, listJson.Heuristic)
+
+			uris := []string{}
+			for i, bundle := range listJson.Bundles {
+				assert.Equal(t, int64(i+1), bundle.CreationToken)
+				assert.Equal(t, strconv.Itoa(i+1), bundle.ID)
+				uris = append(uris, bundle.URI)
+			}
+			assert.Equal(t, tt.expectedURIs, uris)
+		})
+	}
+}
+
+func TestBundles_BundleList_Relocate(t *testing.T) {
+	repo := &core.Repository{
+		Route:  "test/myrepo",
+		WebDir: "/test/home/git-bundle-server/www/test/myrepo",
+	}
+	renamedRepo := &core.Repository{
+		Route:  "other/renamed",
+		WebDir: "/test/home/git-bundle-server/www/other/renamed",
+	}
+
+	list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+	for _, bundle := range []bundles.Bundle{bundles.NewBundle(repo, 1), bundles.NewBundle(repo, 2)} {
+		bundle.Checksum = "abcdef"
+		list.Bundles[bundle.CreationToken] = bundle
+	}
+
+	list.Relocate(renamedRepo)
+	assert.Len(t, list.Bundles, 2)
+	for token, bundle := range list.Bundles {
+		expectedName := "bundle-" + strconv.FormatInt(token, 10) + ".bundle"
+		assert.Equal(t, "/other/renamed/"+expectedName, bundle.URI)
+		assert.Equal(t, filepath.Join(renamedRepo.WebDir, expectedName), bundle.Filename)
+		assert.Equal(t, token, bundle.CreationToken)
+		assert.Equal(t, "abcdef", bundle.Checksum)
+	}
+}
+
+func TestBundles_NewBundleList(t *testing.T) {
+	list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+	assert.Equal(t, 1, list.Version)
+	assert.Equal(t, "any", list.Mode)
+	assert.Equal(t, bundles.HeuristicCreationToken, list.Heuristic)
+	assert.Empty(t, list.Bundles)
+
+	list = bundles.NewBundleList("")
+	assert.Equal(t, "any", list.Mode)
+	assert.Equal(t, "", list.Heuristic)
+}
+
+func TestBundles_BundleList_LatestCreationToken(t *testing.T) {
+	repo := &core.Repository{
+		Route:  "test/myrepo",
+		WebDir: "/test/home/git-bundle-server/www/test/myrepo",
+	}
+
+	list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+	assert.Equal(t, int64(0), list.LatestCreationToken())
+
+	for _, token := range []int64{3, 7, 5} {
+		bundle := bundles.NewBundle(repo, token)
+		list.Bundles[bundle.CreationToken] = bundle
+	}
+	assert.Equal(t, int64(7), list.LatestCreationToken())
+}
+
+// Verify that the bundle lists written by the bundle provider are parsed by
+// Git as expected. Git reads bundle lists with its config parser, so
+// 'git config --list' shows the keys and values Git will see.
+func TestBundles_WriteBundleList_GitParser(t *testing.T) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := &core.Repository{
+		Route:   "test/myrepo",
+		RepoDir: filepath.Join(t.TempDir(), "git", "test", "myrepo"),
+		WebDir:  filepath.Join(t.TempDir(), "www", "test", "myrepo"),
+	}
+
+	list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+	list.Bundles[1700000000] = bundles.NewBundle(repo, 1700000000)
+	list.Bundles[1700000600] = bundles.NewBundle(repo, 1700000600)
+	err = os.MkdirAll(repo.WebDir, 0o755)
+	assert.Nil(t, err)
+	for _, bundle := range list.Bundles {
+		err = os.WriteFile(bundle.Filename, []byte("bundle"), 0o600)
+		assert.Nil(t, err)
+	}
+
+	bundleProvider := bundles.NewBundleProvider(&MockTraceLogger{}, common.NewFileSystem(), nil, bundles.NewLocalStorage(), nil)
+	err = bundleProvider.WriteBundleList(context.Background(), list, repo)
+	assert.Nil(t, err)
+
+	expectedConfig := map[string][]string{
+		bundles.BundleListFilename: {
+			"bundle.version=1",
+			"bundle.mode=any",
+			"bundle.heuristic=creationToken",
+			"bundle.1700000000.uri=bundle-1700000000.bundle",
+			"bundle.1700000000.creationtoken=1700000000",
+			"bundle.1700000600.uri=bundle-1700000600.bundle",
+			"bundle.1700000600.creationtoken=1700000600",
+		},
+		bundles.RepoBundleListFilename: {
+			"bundle.version=1",
+			"bundle.mode=any",
+			"bundle.heuristic=creationToken",
+			"bundle.1700000000.uri=myrepo/bundle-1700000000.bundle",
+			"bundle.1700000000.creationtoken=1700000000",
+			"bundle.1700000600.uri=myrepo/bundle-1700000600.bundle",
+			"bundle.1700000600.creationtoken=1700000600",
+		},
+	}
+
+	for filename, expected := range expectedConfig {
+		t.Run(filename, func(t *testing.T) {
+			cmd := exec.Command(gitPath, "config", "--file", filepath.Join(repo.WebDir, filename), "--list")
+			out, err := cmd.Output()
+			assert.Nil(t, err)
+			assert.Equal(t, expected, strings.Split(strings.TrimSpace(string(out)), "\n"))
+		})
+	}
+}
+
+var ensureSpaceForBaseBundleTests = []struct {
+	title string
+
+	// Inputs
+	available    int64
+	availableErr error
+
+	// Expected values
+	expectErr bool
+}{
+	{
+		"enough space",
+		2048,
+		nil,
+		false,
+	},
+	{
+		"not enough space",
+		512,
+		nil,
+		true,
+	},
+	{
+		"available space unknown",
+		0,
+		errors.New("not supported"),
+		false,
+	},
+}
+
+func TestBundles_EnsureSpaceForBaseBundle(t *testing.T) {
+	repo := &core.Repository{
+		Route:   "test/repo",
+		RepoDir: "/test/home/git-bundle-server/git/test/repo",
+		WebDir:  "/test/home/git-bundle-server/www/test/repo",
+	}
+
+	for _, tt := range ensureSpaceForBaseBundleTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testFileSystem := &MockFileSystem{}
+			testFileSystem.On("DirSize", filepath.Join(repo.RepoDir, "objects")).Return(int64(1024), nil)
+			testFileSystem.On("AvailableSpace", repo.WebDir).Return(tt.available, tt.availableErr)
+
+			bundleProvider := bundles.NewBundleProvider(&MockTraceLogger{}, testFileSystem, nil, &MockBundleStorage{}, nil)
+			err := bundleProvider.EnsureSpaceForBaseBundle(context.Background(), repo)
+
+			if tt.expectErr {
+				var spaceErr *bundles.InsufficientSpaceError
+				assert.ErrorAs(t, err, &spaceErr)
+				assert.Equal(t, int64(1024), spaceErr.Required)
+				assert.Equal(t, tt.available, spaceErr.Available)
+			} else {
+				assert.Nil(t, err)
+			}
 		})
 	}
 }
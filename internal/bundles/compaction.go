@@ -0,0 +1,280 @@
+package bundles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+)
+
+// Over time, every update of a route adds an incremental bundle to its bundle
+// list. Because clients download every bundle they don't yet have, a long list
+// of small bundles slows down cloning; compaction keeps the list short by
+// merging bundles once the route's compaction thresholds are exceeded.
+//
+// Merged bundles are written to new files (rather than overwriting one of the
+// bundles they replace) so that clients and caches never see the content of a
+// bundle file change. The replaced bundle files are left in the web directory;
+// they are no longer in the bundle list, so they are not served.
+
+// compactionUnit is a run of consecutive bundles (by creation token) in a
+// bundle list that will be represented by a single bundle after compaction.
+type compactionUnit struct {
+	tokens []int64
+
+	// The total size in bytes of the bundles in the unit.
+	size int64
+}
+
+func (u *compactionUnit) merge(other compactionUnit) {
+	u.tokens = append(u.tokens, other.tokens...)
+	u.size += other.size
+}
+
+// startOfWeek returns the start (Monday 00:00 UTC) of the week containing the
+// given creation token.
+func startOfWeek(token int64) time.Time {
+	t := time.Unix(token, 0).UTC()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+}
+
+func exceedsThresholds(units []compactionUnit, policy core.CompactionPolicy) bool {
+	if len(units) > policy.EffectiveMaxBundles() {
+		return true
+	}
+
+	if policy.MaxIncrementalSize > 0 {
+		incrementalSize := int64(0)
+		for _, unit := range units[1:] {
+			incrementalSize += unit.size
+		}
+		if incrementalSize > policy.MaxIncrementalSize {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rollUpWeeks merges the incremental bundles created in each week before the
+// week of the newest bundle.
+func rollUpWeeks(units []compactionUnit) []compactionUnit {
+	// The base bundle is never part of a weekly rollup
+	rolledUp := []compactionUnit{units[0]}
+	currentWeek := startOfWeek(units[len(units)-1].tokens[0])
+	for _, unit := range units[1:] {
+		week := startOfWeek(unit.tokens[0])
+		last := &rolledUp[len(rolledUp)-1]
+		if len(rolledUp) > 1 && week.Before(currentWeek) && week.Equal(startOfWeek(last.tokens[0])) {
+			last.merge(unit)
+		} else {
+			rolledUp = append(rolledUp, unit)
+		}
+	}
+	return rolledUp
+}
+
+// mergeIntoBase merges the oldest units into the base bundle until the list
+// no longer exceeds the policy's thresholds.
+func mergeIntoBase(units []compactionUnit, policy core.CompactionPolicy) []compactionUnit {
+	for len(units) > 1 && exceedsThresholds(units, policy) {
+		units[0].merge(units[1])
+		units = append(units[:1], units[2:]...)
+	}
+	return units
+}
+
+// compactionGroups determines which bundles in the list should be merged
+// according to the policy, given the size in bytes of each bundle (which may
+// be nil if the policy has no size threshold). Each group is a list of
+// creation tokens, oldest first; the groups themselves are also ordered
+// oldest first.
+func compactionGroups(list *BundleList, policy core.CompactionPolicy, sizes map[int64]int64) [][]int64 {
+	keys := list.sortedCreationTokens()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	units := make([]compactionUnit, 0, len(keys))
+	for _, token := range keys {
+		units = append(units, compactionUnit{tokens: []int64{token}, size: sizes[token]})
+	}
+
+	if !exceedsThresholds(units, policy) {
+		return nil
+	}
+
+	if policy.EffectiveStrategy() == core.CompactionStrategyWeekly {
+		units = rollUpWeeks(units)
+	}
+	units = mergeIntoBase(units, policy)
+
+	groups := [][]int64{}
+	for _, unit := range units {
+		if len(unit.tokens) > 1 {
+			groups = append(groups, unit.tokens)
+		}
+	}
+	return groups
+}
+
+func (b *bundleProvider) getBundleSizes(list *BundleList) (map[int64]int64, error) {
+	sizes := make(map[int64]int64, len(list.Bundles))
+	for token, bundle := range list.Bundles {
+		info, err := os.Stat(bundle.Filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get size of bundle file %s: %w", bundle.Filename, err)
+		}
+		sizes[token] = info.Size()
+	}
+	return sizes, nil
+}
+
+// mergeBundles creates a single bundle containing the content of the bundles
+// with the given creation tokens, which must be consecutive in the list. The
+// new bundle has the creation token of the newest bundle it replaces, so it
+// sorts in the same position relative to the rest of the list. Tips that no
+// longer exist in the repository (e.g. of pruned branches that have since been
+// garbage collected) are left out of the new bundle.
+func (b *bundleProvider) mergeBundles(ctx context.Context, repo *core.Repository, list *BundleList, tokens []int64) error {
+	tips := []string{}
+	firstPrereqs := []string{}
+	mergedSize := int64(0)
+	for i, token := range tokens {
+		bundle := list.Bundles[token]
+		header, err := b.getBundleHeader(bundle)
+		if err != nil {
+			return fmt.Errorf("failed to parse bundle file %s: %w", bundle.Filename, err)
+		}
+		if i == 0 {
+			for oid := range header.PrereqCommits {
+				firstPrereqs = append(firstPrereqs, oid)
+			}
+		}
+
+		info, err := b.fileSystem.Stat(bundle.Filename)
+		if err != nil {
+			return fmt.Errorf("failed to get size of bundle file %s: %w", bundle.Filename, err)
+		}
+		mergedSize += info.Size()
+
+		// Ignore the old ref name and instead use the OID
+		// to generate the ref name. This allows us to create new
+		// refs that point to exactly these objects without disturbing
+		// refs/heads/ which is tracking the remote refs.
+		for _, oid := range header.Refs {
+			tips = append(tips, oid)
+		}
+	}
+
+	// Unless the new bundle replaces the base bundle, it builds on the tips
+	// of all bundles before it.
+	prereqTips := []string{}
+	for _, token := range list.sortedCreationTokens() {
+		if token >= tokens[0] {
+			break
+		}
+
+		bundle := list.Bundles[token]
+		header, err := b.getBundleHeader(bundle)
+		if err != nil {
+			return fmt.Errorf("failed to parse bundle file %s: %w", bundle.Filename, err)
+		}
+		for _, oid := range header.Refs {
+			prereqTips = append(prereqTips, oid)
+		}
+	}
+
+	// A depth-limited base bundle (see 'core.Repository.Depth') has
+	// prerequisites of its own, which the new base bundle keeps, so that
+	// merging into the base doesn't pull in the history beyond its depth.
+	mergesBase := len(prereqTips) == 0
+	baseDepth := 0
+	if mergesBase {
+		prereqTips = firstPrereqs
+		baseDepth = list.Bundles[tokens[0]].Depth
+	}
+
+	missing, err := b.gitHelper.GetMissingObjects(ctx, repo.RepoDir, append(tips, prereqTips...))
+	if err != nil {
+		return fmt.Errorf("failed to check bundle tips: %w", err)
+	}
+
+	refs := make(map[string]string)
+	for _, oid := range tips {
+		if !missing[oid] {
+			refs["refs/base/"+oid] = oid
+		}
+	}
+	if len(refs) == 0 {
+		return errors.New("none of the tips of the merged bundles exist in the repository")
+	}
+
+	prereqs := []string{}
+	for _, oid := range prereqTips {
+		if !missing[oid] {
+			prereqs = append(prereqs, "^"+oid)
+		}
+	}
+
+	prefix := "rollup"
+	if mergesBase {
+		prefix = "base"
+	}
+	bundle := newBundleWithPrefix(repo, prefix, tokens[len(tokens)-1])
+	bundle.Depth = baseDepth
+
+	// The merged bundle is (at most) about as large as the bundles it
+	// replaces, which are only deleted once it has been written.
+	err = b.ensureSpace(ctx, repo, mergedSize)
+	if err != nil {
+		return err
+	}
+
+	err = b.gitHelper.CreateBundleFromRefs(ctx, repo.RepoDir, bundle.Filename, refs, prereqs, bundle.Filter)
+	if err != nil {
+		return fmt.Errorf("failed to create merged bundle: %w", err)
+	}
+
+	err = b.sealNewBundle(ctx, repo, &bundle)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		delete(list.Bundles, token)
+	}
+	list.addBundle(bundle)
+	return nil
+}
+
+// CollapseList compacts the bundle list according to the repository's
+// compaction policy, merging bundles in place in 'list'. The merged bundles
+// are created in the web directory, but the bundle list itself is not
+// written.
+func (b *bundleProvider) CollapseList(ctx context.Context, repo *core.Repository, list *BundleList) error {
+	ctx, exitRegion := b.logger.Region(ctx, "bundles", "collapse_list")
+	defer exitRegion()
+
+	var sizes map[int64]int64
+	if repo.Compaction.MaxIncrementalSize > 0 {
+		var err error
+		sizes, err = b.getBundleSizes(list)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, group := range compactionGroups(list, repo.Compaction, sizes) {
+		err := b.mergeBundles(ctx, repo, list, group)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package bundles_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Creation tokens in consecutive weeks (starting Monday, 13 November 2023).
+const (
+	week1 int64 = 1699833600
+	week2 int64 = week1 + 7*24*60*60
+	week3 int64 = week2 + 7*24*60*60
+	day   int64 = 24 * 60 * 60
+)
+
+// Every test bundle contains a single ref, whose OID is derived from the
+// bundle's creation token.
+func testBundleOid(token int64) string {
+	return fmt.Sprintf("%040x", token)
+}
+
+// writeTestBundle writes a bundle file containing only a bundle header,
+// padded to the given size (if larger than the header).
+func writeTestBundle(t *testing.T, bundle bundles.Bundle, size int) {
+	content := fmt.Sprintf("# v2 git bundle\n%s refs/heads/main\n\n", testBundleOid(bundle.CreationToken))
+	if len(content) < size {
+		content += strings.Repeat("x", size-len(content))
+	}
+	err := os.WriteFile(bundle.Filename, []byte(content), 0o600)
+	assert.Nil(t, err)
+}
+
+type mergedBundle struct {
+	name    string
+	tokens  []int64
+	prereqs []int64
+}
+
+var collapseListTests = []struct {
+	title string
+
+	// Inputs
+	policy     core.CompactionPolicy
+	tokens     []int64
+	bundleSize int
+
+	// Expected values
+	expectedMerges []mergedBundle
+	expectedTokens []int64
+}{
+	{
+		"Under the default threshold",
+		core.CompactionPolicy{},
+		[]int64{1, 2, 3, 4, 5},
+		0,
+		[]mergedBundle{},
+		[]int64{1, 2, 3, 4, 5},
+	},
+	{
+		"Over the default threshold",
+		core.CompactionPolicy{},
+		[]int64{1, 2, 3, 4, 5, 6, 7},
+		0,
+		[]mergedBundle{
+			{"base-3.bundle", []int64{1, 2, 3}, []int64{}},
+		},
+		[]int64{3, 4, 5, 6, 7},
+	},
+	{
+		"Custom maximum bundle count",
+		core.CompactionPolicy{MaxBundles: 2},
+		[]int64{1, 2, 3},
+		0,
+		[]mergedBundle{
+			{"base-2.bundle", []int64{1, 2}, []int64{}},
+		},
+		[]int64{2, 3},
+	},
+	{
+		"Maximum incremental size",
+		core.CompactionPolicy{MaxIncrementalSize: 250},
+		[]int64{1, 2, 3, 4, 5},
+		100,
+		[]mergedBundle{
+			{"base-3.bundle", []int64{1, 2, 3}, []int64{}},
+		},
+		[]int64{3, 4, 5},
+	},
+	{
+		"Under the maximum incremental size",
+		core.CompactionPolicy{MaxIncrementalSize: 400},
+		[]int64{1, 2, 3, 4, 5},
+		100,
+		[]mergedBundle{},
+		[]int64{1, 2, 3, 4, 5},
+	},
+	{
+		"Weekly rollups",
+		core.CompactionPolicy{Strategy: core.CompactionStrategyWeekly},
+		[]int64{week1, week1 + day, week2, week2 + day, week2 + 2*day, week3, week3 + day},
+		0,
+		[]mergedBundle{
+			{
+				fmt.Sprintf("rollup-%d.bundle", week2+2*day),
+				[]int64{week2, week2 + day, week2 + 2*day},
+				[]int64{week1, week1 + day},
+			},
+		},
+		[]int64{week1, week1 + day, week2 + 2*day, week3, week3 + day},
+	},
+	{
+		"Weekly rollups merged into the base bundle",
+		core.CompactionPolicy{Strategy: core.CompactionStrategyWeekly, MaxBundles: 3},
+		[]int64{week1, week1 + day, week2, week2 + day, week3, week3 + day},
+		0,
+		[]mergedBundle{
+			{
+				fmt.Sprintf("base-%d.bundle", week2+day),
+				[]int64{week1, week1 + day, week2, week2 + day},
+				[]int64{},
+			},
+		},
+		[]int64{week2 + day, week3, week3 + day},
+	},
+}
+
+func TestBundles_CollapseList(t *testing.T) {
+	for _, tt := range collapseListTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testGitHelper := &MockGitHelper{}
+			bundleProvider := bundles.NewBundleProvider(&MockTraceLogger{}, common.NewFileSystem(), testGitHelper, &MockBundleStorage{}, nil)
+
+			repo := &core.Repository{
+				Route:      "test/myrepo",
+				RepoDir:    "/test/home/git-bundle-server/git/test/myrepo",
+				WebDir:     t.TempDir(),
+				Compaction: tt.policy,
+			}
+
+			list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+			for _, token := range tt.tokens {
+				bundle := bundles.NewBundle(repo, token)
+				writeTestBundle(t, bundle, tt.bundleSize)
+				list.Bundles[token] = bundle
+			}
+
+			testGitHelper.On("GetMissingObjects",
+				mock.Anything,
+				repo.RepoDir,
+				mock.Anything,
+			).Return(map[string]bool{}, nil).Maybe()
+
+			for _, merge := range tt.expectedMerges {
+				refs := map[string]string{}
+				for _, token := range merge.tokens {
+					refs["refs/base/"+testBundleOid(token)] = testBundleOid(token)
+				}
+				prereqs := []string{}
+				for _, token := range merge.prereqs {
+					prereqs = append(prereqs, "^"+testBundleOid(token))
+				}
+				testGitHelper.On("CreateBundleFromRefs",
+					mock.Anything,
+					repo.RepoDir,
+					filepath.Join(repo.WebDir, merge.name),
+					refs,
+					prereqs,
+					repo.Filter,
+				).Run(func(args mock.Arguments) {
+					err := os.WriteFile(args.String(2), []byte("merged bundle"), 0o600)
+					assert.Nil(t, err)
+				}).Return(nil).Once()
+				testGitHelper.On("VerifyBundle",
+					mock.Anything,
+					repo.RepoDir,
+					filepath.Join(repo.WebDir, merge.name),
+				).Return(nil).Once()
+			}
+
+			err := bundleProvider.CollapseList(context.Background(), repo, list)
+			assert.Nil(t, err)
+
+			testGitHelper.AssertExpectations(t)
+			testGitHelper.AssertNumberOfCalls(t, "CreateBundleFromRefs", len(tt.expectedMerges))
+
+			tokens := []int64{}
+			for _, token := range tt.expectedTokens {
+				if _, contains := list.Bundles[token]; contains {
+					tokens = append(tokens, token)
+				}
+			}
+			assert.Equal(t, tt.expectedTokens, tokens)
+			assert.Len(t, list.Bundles, len(tt.expectedTokens))
+
+			for _, merge := range tt.expectedMerges {
+				bundle := list.Bundles[merge.tokens[len(merge.tokens)-1]]
+				assert.Equal(t, "/test/myrepo/"+merge.name, bundle.URI)
+			}
+		})
+	}
+}
+
+func TestBundles_CollapseListSkipsMissingTips(t *testing.T) {
+	testGitHelper := &MockGitHelper{}
+	bundleProvider := bundles.NewBundleProvider(&MockTraceLogger{}, common.NewFileSystem(), testGitHelper, &MockBundleStorage{}, nil)
+
+	repo := &core.Repository{
+		Route:      "test/myrepo",
+		RepoDir:    "/test/home/git-bundle-server/git/test/myrepo",
+		WebDir:     t.TempDir(),
+		Compaction: core.CompactionPolicy{MaxBundles: 2},
+	}
+
+	list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+	tokens := []int64{week1, week1 + day, week1 + 2*day}
+	for _, token := range tokens {
+		bundle := bundles.NewBundle(repo, token)
+		writeTestBundle(t, bundle, 0)
+		list.Bundles[token] = bundle
+	}
+
+	// The tip of the second bundle was pruned and garbage collected
+	testGitHelper.On("GetMissingObjects",
+		mock.Anything,
+		repo.RepoDir,
+		mock.Anything,
+	).Return(map[string]bool{testBundleOid(week1 + day): true}, nil)
+
+	mergedName := filepath.Join(repo.WebDir, fmt.Sprintf("base-%d.bundle", week1+day))
+	testGitHelper.On("CreateBundleFromRefs",
+		mock.Anything,
+		repo.RepoDir,
+		mergedName,
+		map[string]string{"refs/base/" + testBundleOid(week1): testBundleOid(week1)},
+		[]string{},
+		repo.Filter,
+	).Run(func(args mock.Arguments) {
+		err := os.WriteFile(args.String(2), []byte("merged bundle"), 0o600)
+		assert.Nil(t, err)
+	}).Return(nil).Once()
+	testGitHelper.On("VerifyBundle", mock.Anything, repo.RepoDir, mergedName).Return(nil).Once()
+
+	err := bundleProvider.CollapseList(context.Background(), repo, list)
+	assert.Nil(t, err)
+	testGitHelper.AssertExpectations(t)
+	assert.Len(t, list.Bundles, 2)
+}
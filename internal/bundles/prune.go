@@ -0,0 +1,102 @@
+package bundles
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+)
+
+// StaleFile is a file in the storage of a route that the bundle server no
+// longer needs.
+type StaleFile struct {
+	Filename string
+	Size     int64
+
+	// A short description of why the file is stale.
+	Reason string
+}
+
+const lockFileSuffix string = ".lock"
+
+// FindStaleFiles returns the files of the route that can safely be deleted:
+// bundles that are not in the route's bundle list (and their signatures), and
+// temporary files left behind by a failed update. 'list' must be the route's
+// current bundle list, and the route must be locked for update so that the
+// temporary files of an in-progress update aren't reported.
+func (b *bundleProvider) FindStaleFiles(ctx context.Context, repo *core.Repository, list *BundleList) ([]StaleFile, error) {
+	ctx, exitRegion := b.logger.Region(ctx, "bundles", "find_stale_files")
+	defer exitRegion()
+
+	staleFiles := []StaleFile{}
+
+	bundleFiles, err := b.listBundleFiles(repo, list)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range bundleFiles {
+		if !file.listed {
+			staleFiles = append(staleFiles, StaleFile{
+				Filename: file.filename,
+				Size:     file.size,
+				Reason:   "not in bundle list",
+			})
+		}
+	}
+
+	// Lock files are used to write the bundle lists (and by Git, to write
+	// bundles). The web directory only contains files written by the bundle
+	// server, so any lock file in it is left over from a failed update; the
+	// repository directory is a Git repository, so only the bundle server's
+	// own lock files are considered there.
+	entries, err := b.fileSystem.ReadDirRecursive(repo.WebDir, 1, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read web directory: %w", err)
+	}
+	candidates := []string{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		if strings.HasSuffix(entry.Name(), lockFileSuffix) {
+			candidates = append(candidates, entry.Path())
+			continue
+		}
+
+		// The signature of a bundle is only needed as long as the bundle is.
+		signedFile, isSignature := strings.CutSuffix(entry.Name(), SignatureSuffix)
+		if isSignature && strings.HasSuffix(signedFile, ".bundle") && !list.ContainsBundleFile(signedFile) {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get info of file %s: %w", entry.Path(), err)
+			}
+			staleFiles = append(staleFiles, StaleFile{
+				Filename: entry.Path(),
+				Size:     info.Size(),
+				Reason:   "signature of a bundle not in bundle list",
+			})
+		}
+	}
+	candidates = append(candidates, filepath.Join(repo.RepoDir, BundleListJsonFilename+lockFileSuffix))
+
+	for _, filename := range candidates {
+		info, err := b.fileSystem.Stat(filename)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get info of file %s: %w", filename, err)
+		}
+
+		staleFiles = append(staleFiles, StaleFile{
+			Filename: filename,
+			Size:     info.Size(),
+			Reason:   "temporary file",
+		})
+	}
+
+	return staleFiles, nil
+}
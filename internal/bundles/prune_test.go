@@ -0,0 +1,61 @@
+package bundles_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundles_FindStaleFiles(t *testing.T) {
+	bundleProvider := bundles.NewBundleProvider(&MockTraceLogger{},
+		common.NewFileSystem(), &MockGitHelper{}, bundles.NewLocalStorage(), nil)
+
+	repo := &core.Repository{
+		Route:   "test/myrepo",
+		RepoDir: filepath.Join(t.TempDir(), "git", "test", "myrepo"),
+		WebDir:  filepath.Join(t.TempDir(), "www", "test", "myrepo"),
+	}
+	assert.Nil(t, os.MkdirAll(repo.RepoDir, 0o755))
+	assert.Nil(t, os.MkdirAll(repo.WebDir, 0o755))
+
+	files := map[string]string{
+		// Listed bundle and the bundle lists
+		filepath.Join(repo.WebDir, "bundle-2.bundle"):                                  "listed",
+		filepath.Join(repo.WebDir, "bundle-2.bundle"+bundles.SignatureSuffix):          "signature",
+		filepath.Join(repo.WebDir, bundles.BundleListFilename):                         "list",
+		filepath.Join(repo.WebDir, bundles.BundleListFilename+bundles.SignatureSuffix): "signature",
+
+		// Unlisted bundle and temporary files
+		filepath.Join(repo.WebDir, "bundle-1.bundle"):                         "unlisted",
+		filepath.Join(repo.WebDir, "bundle-1.bundle"+bundles.SignatureSuffix): "unlisted signature",
+		filepath.Join(repo.WebDir, "bundle-3.bundle.lock"):                    "partial bundle",
+		filepath.Join(repo.RepoDir, bundles.BundleListJsonFilename+".lock"):   "partial list",
+
+		// Git's own lock files must not be touched
+		filepath.Join(repo.RepoDir, "index.lock"): "git",
+	}
+	for filename, content := range files {
+		assert.Nil(t, os.WriteFile(filename, []byte(content), 0o600))
+	}
+
+	list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+	list.Bundles[2] = bundles.NewBundle(repo, 2)
+
+	staleFiles, err := bundleProvider.FindStaleFiles(context.Background(), repo, list)
+	assert.Nil(t, err)
+
+	expected := []bundles.StaleFile{
+		{Filename: filepath.Join(repo.WebDir, "bundle-1.bundle"), Size: 8, Reason: "not in bundle list"},
+		{Filename: filepath.Join(repo.WebDir, "bundle-1.bundle"+bundles.SignatureSuffix), Size: 18, Reason: "signature of a bundle not in bundle list"},
+		{Filename: filepath.Join(repo.WebDir, "bundle-3.bundle.lock"), Size: 14, Reason: "temporary file"},
+		{Filename: filepath.Join(repo.RepoDir, bundles.BundleListJsonFilename+".lock"), Size: 12, Reason: "temporary file"},
+	}
+	assert.ElementsMatch(t, expected, staleFiles)
+}
@@ -0,0 +1,221 @@
+package bundles
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+)
+
+// RetentionResult describes the changes made to a route by ApplyRetention.
+type RetentionResult struct {
+	// The bundle files deleted from the web directory.
+	DeletedFiles []string
+
+	// The total size in bytes of the deleted files.
+	ReclaimedBytes int64
+
+	// Whether the bundle list was replaced with a new base bundle because
+	// some of its bundles exceeded the retention limits.
+	Rebased bool
+}
+
+type bundleFile struct {
+	filename string
+	size     int64
+	modTime  time.Time
+
+	// Whether the file is referenced by the route's bundle list.
+	listed bool
+}
+
+// listBundleFiles returns the bundle files in the web directory of the route,
+// oldest first.
+func (b *bundleProvider) listBundleFiles(repo *core.Repository, list *BundleList) ([]bundleFile, error) {
+	listed := make(map[string]bool, len(list.Bundles))
+	for _, bundle := range list.Bundles {
+		listed[filepath.Base(bundle.Filename)] = true
+	}
+
+	entries, err := b.fileSystem.ReadDirRecursive(repo.WebDir, 1, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read web directory: %w", err)
+	}
+
+	files := []bundleFile{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), ".bundle") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get info of bundle file %s: %w", entry.Path(), err)
+		}
+
+		files = append(files, bundleFile{
+			filename: entry.Path(),
+			size:     info.Size(),
+			modTime:  info.ModTime(),
+			listed:   listed[entry.Name()],
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.Before(files[j].modTime)
+		}
+		return files[i].filename < files[j].filename
+	})
+	return files, nil
+}
+
+// selectEvictions determines which of the given bundle files (sorted oldest
+// first) must be removed to satisfy the retention policy. Files no longer in
+// the bundle list are evicted before those that are. If 'protectListed' is
+// true, files in the bundle list are never evicted.
+func selectEvictions(files []bundleFile, policy core.RetentionPolicy, now time.Time, protectListed bool) []bundleFile {
+	candidates := []bundleFile{}
+	for _, file := range files {
+		if !file.listed {
+			candidates = append(candidates, file)
+		}
+	}
+	if !protectListed {
+		for _, file := range files {
+			if file.listed {
+				candidates = append(candidates, file)
+			}
+		}
+	}
+
+	count := len(files)
+	size := int64(0)
+	for _, file := range files {
+		size += file.size
+	}
+
+	evicted := []bundleFile{}
+	for _, file := range candidates {
+		tooMany := policy.MaxBundles > 0 && count > policy.MaxBundles
+		tooLarge := policy.MaxSize > 0 && size > policy.MaxSize
+		tooOld := policy.MaxAge > 0 && now.Sub(file.modTime) > policy.MaxAge
+		if tooMany || tooLarge || tooOld {
+			evicted = append(evicted, file)
+			count--
+			size -= file.size
+		}
+	}
+	return evicted
+}
+
+func (b *bundleProvider) Rebase(ctx context.Context, repo *core.Repository, list *BundleList) (*BundleList, error) {
+	ctx, exitRegion := b.logger.Region(ctx, "bundles", "rebase")
+	defer exitRegion()
+
+	err := b.EnsureSpaceForBaseBundle(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := newBundleWithPrefix(repo, "base", b.distinctCreationToken(list))
+	bundle.Depth = repo.Depth
+	written, err := b.gitHelper.CreateBundle(ctx, repo.RepoDir, bundle.Filename, repo.Refs, bundle.Filter, bundle.Depth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create base bundle: %w", err)
+	}
+	if !written {
+		return nil, fmt.Errorf("refused to write empty base bundle")
+	}
+
+	err = b.sealNewBundle(ctx, repo, &bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	newList := NewBundleList(list.Heuristic)
+	newList.Head = list.Head
+	newList.addBundle(bundle)
+	err = b.WriteBundleList(ctx, newList, repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write bundle list: %w", err)
+	}
+
+	return newList, nil
+}
+
+// deleteBundleFile deletes a file of the route's web directory from the
+// storage backend, then from the web directory. If deleting the published
+// copy fails, the file is kept so that deleting it can be retried.
+func (b *bundleProvider) deleteBundleFile(ctx context.Context, repo *core.Repository, filename string) error {
+	err := b.storage.Delete(ctx, repo, filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	_, err = b.fileSystem.DeleteFile(filename)
+	return err
+}
+
+// ApplyRetention removes the bundle files of the route that exceed the limits
+// of its retention policy, oldest first. 'list' must be the route's current
+// (written) bundle list.
+//
+// Files that are no longer in the bundle list (e.g. bundles that have been
+// merged by compaction) are removed first. If bundles in the list must also be
+// removed, the list is replaced with a single new base bundle; the new list is
+// written before any file is deleted, so the served bundle list never refers
+// to a deleted bundle.
+func (b *bundleProvider) ApplyRetention(ctx context.Context, repo *core.Repository, list *BundleList) (*RetentionResult, error) {
+	ctx, exitRegion := b.logger.Region(ctx, "bundles", "apply_retention")
+	defer exitRegion()
+
+	result := &RetentionResult{DeletedFiles: []string{}}
+	if repo.Retention.IsDefault() {
+		return result, nil
+	}
+
+	now := time.Now()
+	files, err := b.listBundleFiles(repo, list)
+	if err != nil {
+		return nil, err
+	}
+
+	evicted := selectEvictions(files, repo.Retention, now, false)
+	for _, file := range evicted {
+		if file.listed {
+			list, err = b.Rebase(ctx, repo, list)
+			if err != nil {
+				return nil, err
+			}
+			result.Rebased = true
+
+			// The previous bundles are no longer listed, so they may now be
+			// evicted in favor of the new base bundle.
+			files, err = b.listBundleFiles(repo, list)
+			if err != nil {
+				return nil, err
+			}
+			evicted = selectEvictions(files, repo.Retention, now, true)
+			break
+		}
+	}
+
+	for _, file := range evicted {
+		err := b.deleteBundleFile(ctx, repo, file.filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete bundle file %s: %w", file.filename, err)
+		}
+		err = b.deleteBundleFile(ctx, repo, file.filename+SignatureSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete bundle signature %s: %w", file.filename+SignatureSuffix, err)
+		}
+		result.DeletedFiles = append(result.DeletedFiles, file.filename)
+		result.ReclaimedBytes += file.size
+	}
+
+	return result, nil
+}
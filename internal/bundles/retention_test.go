@@ -0,0 +1,177 @@
+package bundles_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type testBundleFile struct {
+	token  int64
+	age    time.Duration
+	listed bool
+}
+
+// Every file in the retention tests is 100 bytes; bundles 1 and 2 are no
+// longer in the bundle list.
+var testBundleFiles = []testBundleFile{
+	{1, 5 * time.Hour, false},
+	{2, 4 * time.Hour, false},
+	{3, 3 * time.Hour, true},
+	{4, 2 * time.Hour, true},
+	{5, 1 * time.Minute, true},
+}
+
+var applyRetentionTests = []struct {
+	title string
+
+	// Inputs
+	policy core.RetentionPolicy
+
+	// Expected values
+	expectedDeleted []int64
+	expectRebase    bool
+}{
+	{
+		"Default policy keeps everything",
+		core.RetentionPolicy{},
+		[]int64{},
+		false,
+	},
+	{
+		"Under all limits",
+		core.RetentionPolicy{MaxBundles: 5, MaxAge: 6 * time.Hour, MaxSize: 500},
+		[]int64{},
+		false,
+	},
+	{
+		"Maximum count removes unlisted bundles first",
+		core.RetentionPolicy{MaxBundles: 3},
+		[]int64{1, 2},
+		false,
+	},
+	{
+		"Maximum size removes unlisted bundles first",
+		core.RetentionPolicy{MaxSize: 400},
+		[]int64{1},
+		false,
+	},
+	{
+		"Maximum age of unlisted bundles",
+		core.RetentionPolicy{MaxAge: 4*time.Hour + 30*time.Minute},
+		[]int64{1},
+		false,
+	},
+	{
+		"Maximum age of listed bundles",
+		core.RetentionPolicy{MaxAge: 90 * time.Minute},
+		[]int64{1, 2, 3, 4},
+		true,
+	},
+	{
+		"Maximum count of listed bundles",
+		core.RetentionPolicy{MaxBundles: 2},
+		[]int64{1, 2, 3, 4},
+		true,
+	},
+}
+
+func TestBundles_ApplyRetention(t *testing.T) {
+	for _, tt := range applyRetentionTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testGitHelper := &MockGitHelper{}
+			testStorage := &MockBundleStorage{}
+			testStorage.On("Publish", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			testStorage.On("Delete", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			bundleProvider := bundles.NewBundleProvider(&MockTraceLogger{},
+				common.NewFileSystem(), testGitHelper, testStorage, nil)
+
+			repo := &core.Repository{
+				Route:     "test/myrepo",
+				RepoDir:   filepath.Join(t.TempDir(), "git", "test", "myrepo"),
+				WebDir:    filepath.Join(t.TempDir(), "www", "test", "myrepo"),
+				Retention: tt.policy,
+			}
+			err := os.MkdirAll(repo.WebDir, 0o755)
+			assert.Nil(t, err)
+
+			list := bundles.NewBundleList(bundles.HeuristicCreationToken)
+			for _, file := range testBundleFiles {
+				bundle := bundles.NewBundle(repo, file.token)
+				err := os.WriteFile(bundle.Filename, []byte(strings.Repeat("x", 100)), 0o600)
+				assert.Nil(t, err)
+
+				modTime := time.Now().Add(-file.age)
+				err = os.Chtimes(bundle.Filename, modTime, modTime)
+				assert.Nil(t, err)
+
+				if file.listed {
+					list.Bundles[file.token] = bundle
+				}
+			}
+
+			err = bundleProvider.WriteBundleList(context.Background(), list, repo)
+			assert.Nil(t, err)
+
+			if tt.expectRebase {
+				testGitHelper.On("CreateBundle",
+					mock.Anything,
+					repo.RepoDir,
+					mock.MatchedBy(func(filename string) bool {
+						return strings.HasPrefix(filepath.Base(filename), "base-")
+					}),
+					[]string(nil),
+					"",
+					0,
+				).Run(func(args mock.Arguments) {
+					err := os.WriteFile(args.String(2), []byte(strings.Repeat("x", 100)), 0o600)
+					assert.Nil(t, err)
+				}).Return(true, nil).Once()
+				testGitHelper.On("VerifyBundle", mock.Anything, repo.RepoDir, mock.Anything).Return(nil).Once()
+			}
+
+			result, err := bundleProvider.ApplyRetention(context.Background(), repo, list)
+			assert.Nil(t, err)
+			testGitHelper.AssertExpectations(t)
+
+			expectedDeleted := []string{}
+			for _, token := range tt.expectedDeleted {
+				expectedDeleted = append(expectedDeleted, bundles.NewBundle(repo, token).Filename)
+			}
+			assert.ElementsMatch(t, expectedDeleted, result.DeletedFiles)
+			assert.Equal(t, int64(100*len(expectedDeleted)), result.ReclaimedBytes)
+			assert.Equal(t, tt.expectRebase, result.Rebased)
+
+			for _, filename := range expectedDeleted {
+				_, err := os.Stat(filename)
+				assert.ErrorIs(t, err, os.ErrNotExist)
+
+				// The published copies are deleted too
+				testStorage.AssertCalled(t, "Delete", mock.Anything, repo, filepath.Base(filename))
+				testStorage.AssertCalled(t, "Delete", mock.Anything, repo, filepath.Base(filename)+bundles.SignatureSuffix)
+			}
+			testStorage.AssertNumberOfCalls(t, "Delete", 2*len(expectedDeleted))
+
+			// The bundle list on disk must only refer to existing bundles
+			newList, err := bundleProvider.GetBundleList(context.Background(), repo)
+			assert.Nil(t, err)
+			for _, bundle := range newList.Bundles {
+				_, err := os.Stat(bundle.Filename)
+				assert.Nil(t, err)
+			}
+			if tt.expectRebase {
+				assert.Len(t, newList.Bundles, 1)
+			}
+		})
+	}
+}
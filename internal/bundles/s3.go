@@ -0,0 +1,409 @@
+package bundles
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+const (
+	s3Algorithm       string = "AWS4-HMAC-SHA256"
+	s3Service         string = "s3"
+	s3DateFormat      string = "20060102"
+	s3TimeFormat      string = "20060102T150405Z"
+	s3UnsignedPayload string = "UNSIGNED-PAYLOAD"
+
+	// The default and maximum lifetimes (in seconds) of presigned download
+	// URLs. The maximum is imposed by the SigV4 query parameter auth scheme.
+	s3DefaultURLExpiry int = 15 * 60
+	s3MaxURLExpiry     int = 7 * 24 * 60 * 60
+)
+
+// S3StorageConfig configures a storage backend using an S3-compatible object
+// storage service (e.g. AWS S3, Google Cloud Storage's XML API, or MinIO).
+type S3StorageConfig struct {
+	// The base URL of the service. Defaults to the AWS S3 endpoint for the
+	// configured region.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	Region string `json:"region"`
+	Bucket string `json:"bucket"`
+
+	// An optional key prefix under which all content is stored. Objects are
+	// named '<prefix>/<route>/<filename>'.
+	Prefix string `json:"prefix,omitempty"`
+
+	// If true, the bucket is specified in the URL path ('<endpoint>/<bucket>')
+	// rather than as a subdomain of the endpoint ('<bucket>.<endpoint>').
+	PathStyle bool `json:"pathStyle,omitempty"`
+
+	// The credentials used to access the bucket. If not set, the standard
+	// 'AWS_ACCESS_KEY_ID', 'AWS_SECRET_ACCESS_KEY', and 'AWS_SESSION_TOKEN'
+	// environment variables are used instead.
+	AccessKeyID     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+
+	// The lifetime (in seconds) of the presigned URLs clients are redirected
+	// to when downloading bundles. Defaults to 15 minutes.
+	URLExpiry int `json:"urlExpiry,omitempty"`
+}
+
+type s3Storage struct {
+	logger   log.TraceLogger
+	client   *http.Client
+	endpoint *url.URL
+	config   S3StorageConfig
+}
+
+func NewS3Storage(l log.TraceLogger, config S3StorageConfig) (BundleStorage, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket is not specified")
+	}
+	if config.Region == "" {
+		return nil, fmt.Errorf("S3 region is not specified")
+	}
+
+	if config.AccessKeyID == "" && config.SecretAccessKey == "" {
+		config.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		config.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if config.SessionToken == "" {
+			config.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("S3 credentials are not configured")
+	}
+
+	if config.URLExpiry == 0 {
+		config.URLExpiry = s3DefaultURLExpiry
+	} else if config.URLExpiry < 0 || config.URLExpiry > s3MaxURLExpiry {
+		return nil, fmt.Errorf("S3 URL expiry must be between 1 and %d seconds", s3MaxURLExpiry)
+	}
+
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	if (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint '%s': must be an http(s) URL", config.Endpoint)
+	}
+
+	return &s3Storage{
+		logger:   l,
+		client:   http.DefaultClient,
+		endpoint: endpoint,
+		config:   config,
+	}, nil
+}
+
+// s3Escape URI-encodes a string as required by SigV4: every byte other than
+// the unreserved characters (and, optionally, '/') is percent-encoded.
+func s3Escape(str string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	params := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (s *s3Storage) objectKey(repo *core.Repository, name string) string {
+	return strings.TrimPrefix(path.Join(s.config.Prefix, repo.Route, name), "/")
+}
+
+func (s *s3Storage) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.config.PathStyle {
+		u.Path = "/" + s.config.Bucket + "/" + key
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	return &u
+}
+
+func (s *s3Storage) credentialScope(t time.Time) string {
+	return strings.Join([]string{t.Format(s3DateFormat), s.config.Region, s3Service, "aws4_request"}, "/")
+}
+
+// sign computes the SigV4 signature of a request to the given URL, returning
+// the signature and the list of signed headers.
+func (s *s3Storage) sign(
+	t time.Time,
+	method string,
+	u *url.URL,
+	query url.Values,
+	headers map[string]string,
+	payloadHash string,
+) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		s3CanonicalQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		t.Format(s3TimeFormat),
+		s.credentialScope(t),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), t.Format(s3DateFormat))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign)), signedHeaders
+}
+
+func (s *s3Storage) newRequest(
+	ctx context.Context,
+	method string,
+	key string,
+	body io.Reader,
+	contentLength int64,
+	payloadHash string,
+) (*http.Request, error) {
+	u := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = contentLength
+
+	t := time.Now().UTC()
+	headers := map[string]string{
+		"host":                 u.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           t.Format(s3TimeFormat),
+	}
+	if s.config.SessionToken != "" {
+		headers["x-amz-security-token"] = s.config.SessionToken
+	}
+
+	signature, signedHeaders := s.sign(t, method, u, url.Values{}, headers, payloadHash)
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.config.AccessKeyID, s.credentialScope(t), signedHeaders, signature))
+
+	return req, nil
+}
+
+func s3ResponseError(resp *http.Response) error {
+	var errResponse struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if xml.Unmarshal(body, &errResponse) == nil && errResponse.Code != "" {
+		return fmt.Errorf("S3 request failed with status %d: %s: %s",
+			resp.StatusCode, errResponse.Code, errResponse.Message)
+	}
+	return fmt.Errorf("S3 request failed with status %d", resp.StatusCode)
+}
+
+func (s *s3Storage) objectExists(ctx context.Context, key string) (bool, error) {
+	emptyHash := sha256.Sum256(nil)
+	req, err := s.newRequest(ctx, http.MethodHead, key, nil, 0, hex.EncodeToString(emptyHash[:]))
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s3ResponseError(resp)
+	}
+}
+
+func fileSHA256(filename string) (string, int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+func (s *s3Storage) Publish(ctx context.Context, repo *core.Repository, name string, overwrite bool) error {
+	ctx, exitRegion := s.logger.Region(ctx, "s3", "publish")
+	defer exitRegion()
+
+	key := s.objectKey(repo, name)
+
+	if !overwrite {
+		exists, err := s.objectExists(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to check for existing object '%s': %w", key, err)
+		} else if exists {
+			return nil
+		}
+	}
+
+	filename := filepath.Join(repo.WebDir, name)
+	payloadHash, size, err := fileSHA256(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", filename, err)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open '%s': %w", filename, err)
+	}
+	defer file.Close()
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, file, size, payloadHash)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload object '%s': %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to upload object '%s': %w", key, s3ResponseError(resp))
+	}
+
+	return nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, repo *core.Repository, name string) error {
+	ctx, exitRegion := s.logger.Region(ctx, "s3", "delete")
+	defer exitRegion()
+
+	key := s.objectKey(repo, name)
+	emptyHash := sha256.Sum256(nil)
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil, 0, hex.EncodeToString(emptyHash[:]))
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete object '%s': %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	// S3 responds to the deletion of a missing object with '204 No Content'
+	// too, but other services may respond with '404 Not Found'.
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("failed to delete object '%s': %w", key, s3ResponseError(resp))
+	}
+}
+
+func (s *s3Storage) presignURL(key string, t time.Time) string {
+	u := s.objectURL(key)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.config.AccessKeyID+"/"+s.credentialScope(t))
+	query.Set("X-Amz-Date", t.Format(s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(s.config.URLExpiry))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if s.config.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.config.SessionToken)
+	}
+
+	signature, _ := s.sign(t, http.MethodGet, u, query, map[string]string{"host": u.Host}, s3UnsignedPayload)
+	query.Set("X-Amz-Signature", signature)
+
+	u.RawQuery = s3CanonicalQuery(query)
+	return u.String()
+}
+
+func (s *s3Storage) URL(ctx context.Context, repo *core.Repository, name string) (string, error) {
+	return s.presignURL(s.objectKey(repo, name), time.Now().UTC()), nil
+}
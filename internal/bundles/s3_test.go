@@ -0,0 +1,293 @@
+package bundles_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+var newS3StorageTests = []struct {
+	title string
+
+	// Inputs
+	config bundles.S3StorageConfig
+
+	// Expected values
+	expectErr bool
+}{
+	{
+		"Valid config",
+		bundles.S3StorageConfig{Region: "us-east-1", Bucket: "bundles", AccessKeyID: "id", SecretAccessKey: "secret"},
+		false,
+	},
+	{
+		"Missing bucket",
+		bundles.S3StorageConfig{Region: "us-east-1", AccessKeyID: "id", SecretAccessKey: "secret"},
+		true,
+	},
+	{
+		"Missing region",
+		bundles.S3StorageConfig{Bucket: "bundles", AccessKeyID: "id", SecretAccessKey: "secret"},
+		true,
+	},
+	{
+		"Missing secret key",
+		bundles.S3StorageConfig{Region: "us-east-1", Bucket: "bundles", AccessKeyID: "id"},
+		true,
+	},
+	{
+		"Invalid endpoint",
+		bundles.S3StorageConfig{Endpoint: "ftp://example.com", Region: "us-east-1", Bucket: "bundles", AccessKeyID: "id", SecretAccessKey: "secret"},
+		true,
+	},
+	{
+		"URL expiry too long",
+		bundles.S3StorageConfig{Region: "us-east-1", Bucket: "bundles", AccessKeyID: "id", SecretAccessKey: "secret", URLExpiry: 8 * 24 * 60 * 60},
+		true,
+	},
+}
+
+func TestS3Storage_New(t *testing.T) {
+	// Don't pick up credentials from the environment
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	for _, tt := range newS3StorageTests {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := bundles.NewS3Storage(&MockTraceLogger{}, tt.config)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+type s3Request struct {
+	method string
+	path   string
+	auth   string
+	body   string
+}
+
+// newTestS3Server starts a fake object storage server, responding to HEAD,
+// PUT, and DELETE requests with the given statuses and recording all requests
+// it receives.
+func newTestS3Server(t *testing.T, headStatus int, putStatus int, deleteStatus int) (*httptest.Server, *[]s3Request) {
+	requests := []s3Request{}
+	lock := &sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		lock.Lock()
+		requests = append(requests, s3Request{
+			method: r.Method,
+			path:   r.URL.Path,
+			auth:   r.Header.Get("Authorization"),
+			body:   string(body),
+		})
+		lock.Unlock()
+
+		switch r.Method {
+		case http.MethodHead:
+			w.WriteHeader(headStatus)
+		case http.MethodPut:
+			w.WriteHeader(putStatus)
+			if putStatus != http.StatusOK {
+				w.Write([]byte("<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>"))
+			}
+		case http.MethodDelete:
+			w.WriteHeader(deleteStatus)
+			if deleteStatus == http.StatusForbidden {
+				w.Write([]byte("<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>"))
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// newTestS3Storage creates an S3 storage backend storing objects under the
+// 'prefix' key prefix of the 'bundles' bucket of the given server.
+func newTestS3Storage(t *testing.T, server *httptest.Server) bundles.BundleStorage {
+	storage, err := bundles.NewS3Storage(&MockTraceLogger{}, bundles.S3StorageConfig{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "bundles",
+		Prefix:          "prefix",
+		PathStyle:       true,
+		AccessKeyID:     "id",
+		SecretAccessKey: "secret",
+	})
+	assert.Nil(t, err)
+	return storage
+}
+
+var s3PublishTests = []struct {
+	title string
+
+	// Inputs
+	overwrite  bool
+	headStatus int
+	putStatus  int
+
+	// Expected values
+	expectedMethods []string
+	expectErr       bool
+}{
+	{"New object is uploaded", false, http.StatusNotFound, http.StatusOK, []string{"HEAD", "PUT"}, false},
+	{"Existing object is skipped", false, http.StatusOK, http.StatusOK, []string{"HEAD"}, false},
+	{"Existing object is overwritten", true, http.StatusOK, http.StatusOK, []string{"PUT"}, false},
+	{"Failed existence check", false, http.StatusForbidden, http.StatusOK, []string{"HEAD"}, true},
+	{"Failed upload", true, http.StatusOK, http.StatusForbidden, []string{"PUT"}, true},
+}
+
+func TestS3Storage_Publish(t *testing.T) {
+	repo := &core.Repository{
+		Route:  "test/myrepo",
+		WebDir: t.TempDir(),
+	}
+	err := os.WriteFile(filepath.Join(repo.WebDir, "bundle-1.bundle"), []byte("bundle content"), 0o600)
+	assert.Nil(t, err)
+
+	for _, tt := range s3PublishTests {
+		t.Run(tt.title, func(t *testing.T) {
+			server, requests := newTestS3Server(t, tt.headStatus, tt.putStatus, http.StatusNoContent)
+			storage := newTestS3Storage(t, server)
+
+			err = storage.Publish(context.Background(), repo, "bundle-1.bundle", tt.overwrite)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+
+			methods := []string{}
+			for _, req := range *requests {
+				methods = append(methods, req.method)
+				assert.Equal(t, "/bundles/prefix/test/myrepo/bundle-1.bundle", req.path)
+				assert.True(t, strings.HasPrefix(req.auth, "AWS4-HMAC-SHA256 Credential=id/"))
+				if req.method == http.MethodPut {
+					assert.Equal(t, "bundle content", req.body)
+				}
+			}
+			assert.Equal(t, tt.expectedMethods, methods)
+		})
+	}
+}
+
+var s3DeleteTests = []struct {
+	title string
+
+	// Inputs
+	deleteStatus int
+
+	// Expected values
+	expectErr bool
+}{
+	{"Object is deleted", http.StatusNoContent, false},
+	{"Missing object is ignored", http.StatusNotFound, false},
+	{"Failed deletion", http.StatusForbidden, true},
+}
+
+func TestS3Storage_Delete(t *testing.T) {
+	repo := &core.Repository{Route: "test/myrepo"}
+
+	for _, tt := range s3DeleteTests {
+		t.Run(tt.title, func(t *testing.T) {
+			server, requests := newTestS3Server(t, http.StatusOK, http.StatusOK, tt.deleteStatus)
+			storage := newTestS3Storage(t, server)
+
+			err := storage.Delete(context.Background(), repo, "bundle-1.bundle")
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+
+			assert.Len(t, *requests, 1)
+			req := (*requests)[0]
+			assert.Equal(t, http.MethodDelete, req.method)
+			assert.Equal(t, "/bundles/prefix/test/myrepo/bundle-1.bundle", req.path)
+			assert.True(t, strings.HasPrefix(req.auth, "AWS4-HMAC-SHA256 Credential=id/"))
+		})
+	}
+}
+
+func TestUnpublishWebDir(t *testing.T) {
+	repo := &core.Repository{
+		Route:  "test/myrepo",
+		WebDir: t.TempDir(),
+	}
+	for _, name := range []string{"bundle-1.bundle", "bundle-1.bundle.sig", "bundle-list"} {
+		err := os.WriteFile(filepath.Join(repo.WebDir, name), []byte("content"), 0o600)
+		assert.Nil(t, err)
+	}
+
+	server, requests := newTestS3Server(t, http.StatusOK, http.StatusOK, http.StatusNoContent)
+	err := bundles.UnpublishWebDir(context.Background(), newTestS3Storage(t, server), repo)
+	assert.Nil(t, err)
+
+	paths := []string{}
+	for _, req := range *requests {
+		assert.Equal(t, http.MethodDelete, req.method)
+		paths = append(paths, req.path)
+	}
+	assert.ElementsMatch(t, []string{
+		"/bundles/prefix/test/myrepo/bundle-1.bundle",
+		"/bundles/prefix/test/myrepo/bundle-1.bundle.sig",
+		"/bundles/prefix/test/myrepo/bundle-list",
+	}, paths)
+
+	// A web directory that doesn't exist has nothing to delete
+	repo.WebDir = filepath.Join(repo.WebDir, "missing")
+	err = bundles.UnpublishWebDir(context.Background(), newTestS3Storage(t, server), repo)
+	assert.Nil(t, err)
+	assert.Len(t, *requests, 3)
+}
+
+func TestS3Storage_URL(t *testing.T) {
+	storage, err := bundles.NewS3Storage(&MockTraceLogger{}, bundles.S3StorageConfig{
+		Region:          "us-west-2",
+		Bucket:          "bundles",
+		AccessKeyID:     "id",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		URLExpiry:       60,
+	})
+	assert.Nil(t, err)
+
+	repo := &core.Repository{Route: "test/myrepo"}
+	rawURL, err := storage.URL(context.Background(), repo, "bundle-1.bundle")
+	assert.Nil(t, err)
+
+	u, err := url.Parse(rawURL)
+	assert.Nil(t, err)
+	assert.Equal(t, "https", u.Scheme)
+	assert.Equal(t, "bundles.s3.us-west-2.amazonaws.com", u.Host)
+	assert.Equal(t, "/test/myrepo/bundle-1.bundle", u.Path)
+
+	query := u.Query()
+	assert.Equal(t, "AWS4-HMAC-SHA256", query.Get("X-Amz-Algorithm"))
+	assert.Regexp(t, `^id/\d{8}/us-west-2/s3/aws4_request$`, query.Get("X-Amz-Credential"))
+	assert.Equal(t, "60", query.Get("X-Amz-Expires"))
+	assert.Equal(t, "host", query.Get("X-Amz-SignedHeaders"))
+	assert.Equal(t, "token", query.Get("X-Amz-Security-Token"))
+	assert.Regexp(t, `^[0-9a-f]{64}$`, query.Get("X-Amz-Signature"))
+}
@@ -0,0 +1,131 @@
+package bundles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+const (
+	// The suffix of the detached signature of a bundle or bundle list file
+	// (e.g. 'bundle-list.sig').
+	SignatureSuffix string = ".sig"
+
+	// The namespace of SSH signatures, which must be given when verifying
+	// them (e.g. 'ssh-keygen -Y verify -n git-bundle-server').
+	SSHSignatureNamespace string = "git-bundle-server"
+)
+
+// Signer creates detached signatures of the content served by the bundle
+// server, so that downstream mirrors can verify where it came from.
+type Signer interface {
+	// Sign returns an ASCII-armored detached signature of the given content.
+	Sign(ctx context.Context, content io.Reader) ([]byte, error)
+}
+
+type signingConfig struct {
+	// The signature format: "ssh" or "gpg".
+	Format string `json:"format"`
+
+	// The signing key: the path to an SSH private key (or to the public key of
+	// a key held by 'ssh-agent'), or the ID of a GPG key.
+	Key string `json:"key"`
+
+	// The program used to sign; defaults to 'ssh-keygen' or 'gpg'.
+	Program string `json:"program,omitempty"`
+}
+
+type commandSigner struct {
+	logger  log.TraceLogger
+	cmdExec cmd.CommandExecutor
+	program string
+	args    []string
+}
+
+// NewSigner creates the signer configured in the bundle server's
+// 'signing.json' file. If the file does not exist, signing is disabled and
+// the returned signer is nil.
+func NewSigner(
+	l log.TraceLogger,
+	u common.UserProvider,
+	c cmd.CommandExecutor,
+) (Signer, error) {
+	user, err := u.CurrentUser()
+	if err != nil {
+		return nil, fmt.Errorf("could not get current user: %w", err)
+	}
+
+	configFile := core.SigningConfigFile(user)
+	fileBytes, err := os.ReadFile(configFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read signing config: %w", err)
+	}
+
+	var config signingConfig
+	err = json.Unmarshal(fileBytes, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing config '%s': %w", configFile, err)
+	}
+
+	if config.Key == "" {
+		return nil, fmt.Errorf("signing config '%s' is missing a 'key'", configFile)
+	}
+
+	signer := &commandSigner{
+		logger:  l,
+		cmdExec: c,
+		program: config.Program,
+	}
+	switch strings.ToLower(config.Format) {
+	case "ssh":
+		if signer.program == "" {
+			signer.program = "ssh-keygen"
+		}
+		// With no file arguments, 'ssh-keygen -Y sign' signs its standard
+		// input and writes the signature to its standard output.
+		signer.args = []string{"-Y", "sign", "-n", SSHSignatureNamespace, "-f", config.Key, "-q"}
+	case "gpg", "openpgp":
+		if signer.program == "" {
+			signer.program = "gpg"
+		}
+		signer.args = []string{"--batch", "--yes", "--armor", "--detach-sign", "--local-user", config.Key}
+	default:
+		return nil, fmt.Errorf("unrecognized signature format '%s'", config.Format)
+	}
+
+	return signer, nil
+}
+
+func (s *commandSigner) Sign(ctx context.Context, content io.Reader) ([]byte, error) {
+	ctx, exitRegion := s.logger.Region(ctx, "signing", "sign")
+	defer exitRegion()
+
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	exitCode, err := s.cmdExec.Run(ctx, s.program, s.args,
+		cmd.Stdin(content),
+		cmd.Stdout(&stdout),
+		cmd.Stderr(&stderr),
+	)
+	if err != nil {
+		return nil, err
+	} else if exitCode != 0 {
+		return nil, fmt.Errorf("'%s' exited with status %d\n%s", s.program, exitCode, stderr.String())
+	} else if stdout.Len() == 0 {
+		return nil, fmt.Errorf("'%s' did not output a signature", s.program)
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,122 @@
+package bundles_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var signerTests = []struct {
+	title string
+
+	// Inputs
+	config string // empty if the config file does not exist
+
+	// Expected values
+	expectedProgram string
+	expectedArgs    []string
+	expectErr       bool
+}{
+	{
+		"No signing config",
+		"",
+		"",
+		nil,
+		false,
+	},
+	{
+		"SSH key",
+		`{"format": "ssh", "key": "/keys/id_ed25519"}`,
+		"ssh-keygen",
+		[]string{"-Y", "sign", "-n", "git-bundle-server", "-f", "/keys/id_ed25519", "-q"},
+		false,
+	},
+	{
+		"GPG key with custom program",
+		`{"format": "GPG", "key": "ABCD1234", "program": "gpg2"}`,
+		"gpg2",
+		[]string{"--batch", "--yes", "--armor", "--detach-sign", "--local-user", "ABCD1234"},
+		false,
+	},
+	{
+		"Missing key",
+		`{"format": "ssh"}`,
+		"",
+		nil,
+		true,
+	},
+	{
+		"Unrecognized format",
+		`{"format": "x509", "key": "mykey"}`,
+		"",
+		nil,
+		true,
+	},
+}
+
+func TestSigner_Sign(t *testing.T) {
+	for _, tt := range signerTests {
+		t.Run(tt.title, func(t *testing.T) {
+			root := t.TempDir()
+			t.Setenv(core.RootEnvVar, root)
+			if tt.config != "" {
+				err := os.WriteFile(filepath.Join(root, "signing.json"), []byte(tt.config), 0o600)
+				assert.Nil(t, err)
+			}
+
+			testUserProvider := &MockUserProvider{}
+			testUserProvider.On("CurrentUser").Return(&user.User{HomeDir: "/test/home"}, nil)
+			testCommandExecutor := &MockCommandExecutor{}
+
+			signer, err := bundles.NewSigner(&MockTraceLogger{}, testUserProvider, testCommandExecutor)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			if tt.expectedProgram == "" {
+				assert.Nil(t, signer)
+				return
+			}
+
+			var stdin io.Reader
+			var stdout io.Writer
+			testCommandExecutor.On("Run",
+				mock.Anything,
+				tt.expectedProgram,
+				tt.expectedArgs,
+				mock.MatchedBy(func(settings []cmd.Setting) bool {
+					for _, setting := range settings {
+						switch setting.Key {
+						case cmd.StdinKey:
+							stdin = setting.Value.(io.Reader)
+						case cmd.StdoutKey:
+							stdout = setting.Value.(io.Writer)
+						}
+					}
+					return stdin != nil && stdout != nil
+				}),
+			).Run(func(mock.Arguments) {
+				content, err := io.ReadAll(stdin)
+				assert.Nil(t, err)
+				stdout.Write([]byte("signature of " + string(content)))
+			}).Return(0, nil).Once()
+
+			signature, err := signer.Sign(context.Background(), strings.NewReader("content"))
+			assert.Nil(t, err)
+			assert.Equal(t, "signature of content", string(signature))
+			testCommandExecutor.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package bundles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// BundleStorage abstracts where the bundles and bundle lists of a route are
+// published for clients to download.
+//
+// Bundles and bundle lists are always written to the route's web directory
+// first (Git needs a local file to write a bundle to, and the bundle headers
+// are read back from those files when creating incremental bundles). The
+// storage backend then determines whether they are served from there by the
+// web server or copied to (and downloaded from) somewhere else.
+type BundleStorage interface {
+	// Publish makes the file with the given name in the route's web directory
+	// available from the storage backend. If 'overwrite' is false and the
+	// file has already been published, it is not published again.
+	Publish(ctx context.Context, repo *core.Repository, name string, overwrite bool) error
+
+	// URL returns a URL from which clients can download the published file
+	// directly, or an empty string if the file should be served from the
+	// route's web directory by the web server.
+	URL(ctx context.Context, repo *core.Repository, name string) (string, error)
+
+	// Delete removes the published copy of the file with the given name, so
+	// that it can no longer be downloaded. It must be called before the file
+	// is removed from the route's web directory. Deleting a file that was
+	// never published is not an error.
+	Delete(ctx context.Context, repo *core.Repository, name string) error
+}
+
+type localStorage struct{}
+
+// NewLocalStorage returns the default storage backend, which serves content
+// directly out of the web directory of each route.
+func NewLocalStorage() BundleStorage {
+	return &localStorage{}
+}
+
+func (localStorage) Publish(ctx context.Context, repo *core.Repository, name string, overwrite bool) error {
+	// The file is already in the web directory, so there's nothing to do.
+	return nil
+}
+
+func (localStorage) URL(ctx context.Context, repo *core.Repository, name string) (string, error) {
+	return "", nil
+}
+
+func (localStorage) Delete(ctx context.Context, repo *core.Repository, name string) error {
+	// The file is only served from the web directory, so removing it from
+	// there is enough.
+	return nil
+}
+
+// UnpublishWebDir deletes the published copies of the files in the route's
+// web directory (see 'BundleStorage.Delete'), before the directory itself is
+// removed.
+func UnpublishWebDir(ctx context.Context, storage BundleStorage, repo *core.Repository) error {
+	entries, err := os.ReadDir(repo.WebDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read web directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		err = storage.Delete(ctx, repo, entry.Name())
+		if err != nil {
+			return fmt.Errorf("failed to delete published file '%s': %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+type storageConfig struct {
+	// The storage backend: "local" (the default) or "s3".
+	Backend string `json:"backend"`
+
+	// Backend-specific settings
+	S3 *S3StorageConfig `json:"s3,omitempty"`
+}
+
+// NewBundleStorage creates the storage backend configured in the 'storage.json'
+// file of the bundle server with the given storage roots. If the file does not
+// exist, the local storage backend is used.
+func NewBundleStorage(
+	l log.TraceLogger,
+	u common.UserProvider,
+	roots core.StorageRoots,
+) (BundleStorage, error) {
+	user, err := u.CurrentUser()
+	if err != nil {
+		return nil, fmt.Errorf("could not get current user: %w", err)
+	}
+
+	configFile := roots.StorageConfigFile(user)
+	fileBytes, err := os.ReadFile(configFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewLocalStorage(), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read storage config: %w", err)
+	}
+
+	var config storageConfig
+	err = json.Unmarshal(fileBytes, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse storage config '%s': %w", configFile, err)
+	}
+
+	switch strings.ToLower(config.Backend) {
+	case "", "local":
+		return NewLocalStorage(), nil
+	case "s3":
+		if config.S3 == nil {
+			return nil, fmt.Errorf("storage config '%s' is missing 's3' settings", configFile)
+		}
+		return NewS3Storage(l, *config.S3)
+	default:
+		return nil, fmt.Errorf("unrecognized storage backend '%s'", config.Backend)
+	}
+}
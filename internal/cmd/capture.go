@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// The maximum number of bytes of each of a command's output streams
+	// recorded by RunCaptured; only the end of a longer stream is kept.
+	maxCapturedBytes = 64 * 1024
+
+	// The number of trailing lines of a command's stderr included in the
+	// ExitError returned by RunCaptured.
+	exitErrorStderrLines = 5
+)
+
+// ExitError is the error returned by RunCaptured when a command exits with a
+// nonzero status.
+type ExitError struct {
+	Command  string
+	ExitCode int
+
+	// The last (non-empty) lines of the command's stderr.
+	StderrTail []string
+}
+
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("'%s' exited with status %d", e.Command, e.ExitCode)
+	if len(e.StderrTail) > 0 {
+		// Keep the message on one line so that it fits in summaries (e.g.
+		// that of 'update-all').
+		msg += ": " + strings.Join(e.StderrTail, "; ")
+	}
+	return msg
+}
+
+// tailBuffer is a writer that keeps the last 'maxCapturedBytes' bytes written
+// to it.
+type tailBuffer struct {
+	lock sync.Mutex
+	buf  []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if excess := len(b.buf) - maxCapturedBytes; excess > 0 {
+		b.buf = append(b.buf[:0], b.buf[excess:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return string(b.buf)
+}
+
+// CapturedOutput is the output of a command run with RunCaptured.
+type CapturedOutput struct {
+	stdout tailBuffer
+	stderr tailBuffer
+}
+
+// Stdout returns the (end of the) standard output of the command.
+func (o *CapturedOutput) Stdout() string {
+	return o.stdout.String()
+}
+
+// Stderr returns the (end of the) standard error of the command.
+func (o *CapturedOutput) Stderr() string {
+	return o.stderr.String()
+}
+
+// lastLines returns the last 'n' non-empty lines of 's'. Carriage returns
+// separate lines too, so that progress meters (e.g. Git's) are split into
+// their updates.
+func lastLines(s string, n int) []string {
+	lines := []string{}
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
@@ -2,9 +2,11 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
 )
@@ -13,12 +15,27 @@ type CommandExecutor interface {
 	RunStdout(ctx context.Context, command string, args ...string) (int, error)
 	RunQuiet(ctx context.Context, command string, args ...string) (int, error)
 	Run(ctx context.Context, command string, args []string, settings ...Setting) (int, error)
+
+	// RunCaptured runs the command like Run, but also records its output
+	// (which is still written wherever the settings direct it). Unlike Run,
+	// a nonzero exit status is an error: an *ExitError that includes the end
+	// of the command's stderr, so that the failure can be diagnosed.
+	RunCaptured(ctx context.Context, command string, args []string, settings ...Setting) (*CapturedOutput, error)
 }
 
 type commandExecutor struct {
 	logger log.TraceLogger
 }
 
+type cmdOptions struct {
+	signals <-chan os.Signal
+	timeout time.Duration
+}
+
+// After a command is canceled, how long to wait for it to exit (and for its
+// output to be closed) before killing it.
+const canceledCommandWaitDelay = 5 * time.Second
+
 func NewCommandExecutor(l log.TraceLogger) CommandExecutor {
 	return &commandExecutor{
 		logger: l,
@@ -31,12 +48,25 @@ func (c *commandExecutor) buildCmd(ctx context.Context, command string, args ...
 		return nil, c.logger.Errorf(ctx, "failed to find '%s' on the path: %w", command, err)
 	}
 
-	cmd := exec.Command(exe, args...)
+	// If the context is done while the command is running (e.g. because the
+	// user pressed Ctrl-C or the command timed out), interrupt the command so
+	// that it can clean up after itself (e.g. Git removes its lock files).
+	// Commands that can't be interrupted, or don't exit in time, are killed.
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Cancel = func() error {
+		err := cmd.Process.Signal(os.Interrupt)
+		if err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	cmd.WaitDelay = canceledCommandWaitDelay
 
 	return cmd, nil
 }
 
-func (c *commandExecutor) applyOptions(ctx context.Context, cmd *exec.Cmd, settings []Setting) {
+func (c *commandExecutor) applyOptions(ctx context.Context, cmd *exec.Cmd, settings []Setting) *cmdOptions {
+	options := &cmdOptions{}
 	for _, setting := range settings {
 		switch setting.Key {
 		case StdinKey:
@@ -50,14 +80,27 @@ func (c *commandExecutor) applyOptions(ctx context.Context, cmd *exec.Cmd, setti
 			if !ok {
 				panic("incorrect env setting type")
 			}
+			// The settings extend (rather than replace) the environment of
+			// the current process, so that e.g. 'HOME' and 'HTTPS_PROXY' are
+			// still passed to the command.
+			if cmd.Env == nil {
+				cmd.Env = os.Environ()
+			}
 			cmd.Env = append(cmd.Env, env...)
+		case SignalsKey:
+			options.signals = setting.Value.(<-chan os.Signal)
+			// The command is stopped by the forwarded signals instead.
+			cmd.Cancel = func() error { return os.ErrProcessDone }
+		case TimeoutKey:
+			options.timeout = setting.Value.(time.Duration)
 		default:
 			panic("invalid cmdSettingKey")
 		}
 	}
+	return options
 }
 
-func (c *commandExecutor) runCmd(ctx context.Context, cmd *exec.Cmd) (int, error) {
+func (c *commandExecutor) runCmd(ctx context.Context, cmd *exec.Cmd, options *cmdOptions) (int, error) {
 	childReady, childExit := c.logger.ChildProcess(ctx, cmd)
 	err := cmd.Start()
 	childReady(err)
@@ -65,10 +108,34 @@ func (c *commandExecutor) runCmd(ctx context.Context, cmd *exec.Cmd) (int, error
 		return -1, c.logger.Errorf(ctx, "command failed to start: %w", err)
 	}
 
+	if options.signals != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				select {
+				case sig := <-options.signals:
+					// Best effort; the process may have already exited
+					cmd.Process.Signal(sig)
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
 	err = cmd.Wait()
 	childExit()
 	_, isExitError := err.(*exec.ExitError)
 
+	// If the command was canceled, its exit code is meaningless
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil && options.signals == nil {
+		if options.timeout > 0 && errors.Is(ctxErr, context.DeadlineExceeded) {
+			return -1, c.logger.Errorf(ctx, "command timed out after %s", options.timeout)
+		}
+		return -1, c.logger.Errorf(ctx, "command was canceled: %w", ctxErr)
+	}
+
 	// If the command succeeded, or ran to completion but returned a nonzero
 	// exit code, return non-erroneous result
 	if err == nil || isExitError {
@@ -87,12 +154,61 @@ func (c *commandExecutor) RunQuiet(ctx context.Context, command string, args ...
 }
 
 func (c *commandExecutor) Run(ctx context.Context, command string, args []string, settings ...Setting) (int, error) {
+	ctx, cancel := withTimeout(ctx, settings)
+	defer cancel()
+
 	cmd, err := c.buildCmd(ctx, command, args...)
 	if err != nil {
 		return -1, err
 	}
 
-	c.applyOptions(ctx, cmd, settings)
+	options := c.applyOptions(ctx, cmd, settings)
+
+	return c.runCmd(ctx, cmd, options)
+}
+
+// withTimeout returns a context that is done once the duration of the timeout
+// setting (if any) elapses. The command is built with this context so that it
+// is canceled when it times out.
+func withTimeout(ctx context.Context, settings []Setting) (context.Context, context.CancelFunc) {
+	for _, setting := range settings {
+		if setting.Key != TimeoutKey {
+			continue
+		}
+		if timeout := setting.Value.(time.Duration); timeout > 0 {
+			return context.WithTimeout(ctx, timeout)
+		}
+	}
+	return ctx, func() {}
+}
+
+func (c *commandExecutor) RunCaptured(ctx context.Context, command string, args []string, settings ...Setting) (*CapturedOutput, error) {
+	output := &CapturedOutput{}
+
+	// Record the output in addition to writing it to the configured writers
+	// (the last output settings take precedence).
+	var stdout, stderr io.Writer = &output.stdout, &output.stderr
+	for _, setting := range settings {
+		switch setting.Key {
+		case StdoutKey:
+			stdout = io.MultiWriter(setting.Value.(io.Writer), &output.stdout)
+		case StderrKey:
+			stderr = io.MultiWriter(setting.Value.(io.Writer), &output.stderr)
+		}
+	}
+	captureSettings := append([]Setting{}, settings...)
+	captureSettings = append(captureSettings, Stdout(stdout), Stderr(stderr))
+
+	exitCode, err := c.Run(ctx, command, args, captureSettings...)
+	if err != nil {
+		return output, err
+	} else if exitCode != 0 {
+		return output, c.logger.Error(ctx, &ExitError{
+			Command:    command,
+			ExitCode:   exitCode,
+			StderrTail: lastLines(output.Stderr(), exitErrorStderrLines),
+		})
+	}
 
-	return c.runCmd(ctx, cmd)
+	return output, nil
 }
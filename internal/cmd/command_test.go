@@ -0,0 +1,50 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCaptured(t *testing.T) {
+	cmdExec := cmd.NewCommandExecutor(&MockTraceLogger{})
+
+	t.Run("success", func(t *testing.T) {
+		stdout := &bytes.Buffer{}
+		output, err := cmdExec.RunCaptured(context.Background(), "git", []string{"--version"},
+			cmd.Stdout(stdout),
+		)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(output.Stdout(), "git version "))
+		assert.Equal(t, output.Stdout(), stdout.String(), "output is still written to the stdout setting")
+	})
+
+	t.Run("failure includes stderr", func(t *testing.T) {
+		_, err := cmdExec.RunCaptured(context.Background(), "git", []string{"not-a-command"})
+
+		var exitErr *cmd.ExitError
+		assert.True(t, errors.As(err, &exitErr))
+		assert.Equal(t, 1, exitErr.ExitCode)
+		assert.Contains(t, err.Error(), "'git' exited with status 1: git: 'not-a-command' is not a git command.")
+	})
+}
+
+func TestRunTimeout(t *testing.T) {
+	cmdExec := cmd.NewCommandExecutor(&MockTraceLogger{})
+
+	// 'git daemon' serves until it is stopped.
+	startTime := time.Now()
+	_, err := cmdExec.Run(context.Background(), "git",
+		[]string{"daemon", "--listen=127.0.0.1", "--port=0", "--base-path=" + t.TempDir()},
+		cmd.Timeout(100*time.Millisecond),
+	)
+	assert.EqualError(t, err, "command timed out after 100ms")
+	assert.Less(t, time.Since(startTime), 5*time.Second)
+}
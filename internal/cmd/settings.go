@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"io"
+	"os"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/utils"
 )
@@ -13,6 +15,8 @@ const (
 	StdoutKey
 	StderrKey
 	EnvKey
+	SignalsKey
+	TimeoutKey
 )
 
 type Setting utils.KeyValue[settingType, any]
@@ -44,3 +48,21 @@ func Env(env []string) Setting {
 		env,
 	}
 }
+
+// ForwardSignals relays the signals received on the given channel to the
+// command while it is running.
+func ForwardSignals(signals <-chan os.Signal) Setting {
+	return Setting{
+		SignalsKey,
+		signals,
+	}
+}
+
+// Timeout cancels the command, as if its context were canceled, if it runs for
+// longer than the given duration. A zero duration means no timeout.
+func Timeout(timeout time.Duration) Setting {
+	return Setting{
+		TimeoutKey,
+		timeout,
+	}
+}
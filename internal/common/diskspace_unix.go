@@ -0,0 +1,16 @@
+//go:build !windows
+
+package common
+
+import "syscall"
+
+// availableSpace returns the number of bytes available to unprivileged users
+// on the filesystem containing the given (existing) path.
+func availableSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
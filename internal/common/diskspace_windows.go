@@ -0,0 +1,27 @@
+//go:build windows
+
+package common
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = modkernel32.NewProc("GetDiskFreeSpaceExW")
+
+// availableSpace returns the number of bytes available to the current user on
+// the volume containing the given (existing) path.
+func availableSpace(path string) (int64, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var available uint64
+	r1, _, err := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&available)), 0, 0)
+	if r1 == 0 {
+		return 0, err
+	}
+	return int64(available), nil
+}
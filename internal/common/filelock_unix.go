@@ -0,0 +1,32 @@
+//go:build !windows
+
+package common
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFileHandle takes an exclusive lock on the file. If 'wait' is false and
+// the lock is held elsewhere, it returns false immediately.
+func lockFileHandle(file *os.File, wait bool) (bool, error) {
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+		if err == nil {
+			return true, nil
+		} else if err == syscall.EWOULDBLOCK {
+			return false, nil
+		} else if err != syscall.EINTR {
+			return false, err
+		}
+	}
+}
+
+func unlockFileHandle(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,55 @@
+//go:build windows
+
+package common
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately uintptr = 0x1
+	lockfileExclusiveLock   uintptr = 0x2
+
+	errorLockViolation syscall.Errno = 33
+)
+
+// Lock the maximum possible byte range so that the lock covers the whole file.
+const allBytes uintptr = 0xFFFFFFFF
+
+// lockFileHandle takes an exclusive lock on the file. If 'wait' is false and
+// the lock is held elsewhere, it returns false immediately.
+func lockFileHandle(file *os.File, wait bool) (bool, error) {
+	flags := lockfileExclusiveLock
+	if !wait {
+		flags |= lockfileFailImmediately
+	}
+
+	overlapped := &syscall.Overlapped{}
+	r1, _, err := procLockFileEx.Call(file.Fd(), flags, 0,
+		allBytes, allBytes, uintptr(unsafe.Pointer(overlapped)))
+	if r1 == 0 {
+		if err == errorLockViolation {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func unlockFileHandle(file *os.File) error {
+	overlapped := &syscall.Overlapped{}
+	r1, _, err := procUnlockFileEx.Call(file.Fd(), 0,
+		allBytes, allBytes, uintptr(unsafe.Pointer(overlapped)))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
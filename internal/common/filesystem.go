@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"syscall"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/utils"
@@ -29,14 +30,44 @@ type lockFile struct {
 	lockFilename string
 }
 
+// Commit atomically replaces the target file with the lock file. Readers of
+// the target file see either its previous or its new content, never a
+// partially-written file.
 func (l *lockFile) Commit() error {
-	return os.Rename(l.lockFilename, l.filename)
+	err := os.Rename(l.lockFilename, l.filename)
+	if err != nil {
+		return err
+	}
+
+	// Make the rename durable so that, after a crash, the file doesn't revert
+	// to its previous content once newer files depend on it. The rename
+	// itself already succeeded, so failing to flush it isn't an error.
+	syncDir(filepath.Dir(l.filename))
+	return nil
 }
 
 func (l *lockFile) Rollback() error {
 	return os.Remove(l.lockFilename)
 }
 
+// FileLock is an exclusive advisory lock held on a file.
+type FileLock interface {
+	Unlock() error
+}
+
+type fileLock struct {
+	file *os.File
+}
+
+func (l *fileLock) Unlock() error {
+	err := unlockFileHandle(l.file)
+	closeErr := l.file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
 type ReadDirEntry interface {
 	Path() string
 	fs.DirEntry
@@ -64,8 +95,29 @@ type FileSystem interface {
 	GetLocalExecutable(name string) (string, error)
 
 	FileExists(filename string) (bool, error)
+
+	// Stat returns the file info of the given file, or an error if it cannot
+	// be read (including if it does not exist).
+	Stat(filename string) (fs.FileInfo, error)
 	WriteFile(filename string, content []byte) error
+
+	// WriteLockFileFunc writes the content of the given file to a lock file
+	// (the filename with a '.lock' suffix), flushing it to disk. The content
+	// replaces the file when the returned LockFile is committed.
 	WriteLockFileFunc(filename string, writeFunc func(io.Writer) error) (LockFile, error)
+
+	// SyncFile flushes the content of the given file (and its directory
+	// entry) to disk.
+	SyncFile(filename string) error
+
+	// AcquireFileLock takes an exclusive advisory lock on the given file
+	// (creating it if it does not exist), blocking until the lock is
+	// available. The lock is held until it is unlocked or the process exits.
+	AcquireFileLock(filename string) (FileLock, error)
+
+	// TryAcquireFileLock is like AcquireFileLock, but does not block if the
+	// lock is held elsewhere. Instead, it returns 'false' (and no lock).
+	TryAcquireFileLock(filename string) (FileLock, bool, error)
 	DeleteFile(filename string) (bool, error)
 	ReadFileLines(filename string) ([]string, error)
 
@@ -77,6 +129,16 @@ type FileSystem interface {
 	//
 	// If 'depth' is <= 0, ReadDirRecursive returns an empty list.
 	ReadDirRecursive(path string, depth int, strictDepth bool) ([]ReadDirEntry, error)
+
+	// DirSize returns the total size in bytes of the regular files in the
+	// given directory and its subdirectories. If the directory does not
+	// exist, 0 is returned.
+	DirSize(path string) (int64, error)
+
+	// AvailableSpace returns the number of bytes available for new files on
+	// the filesystem containing the given path. If the path does not exist
+	// yet, the filesystem of its nearest existing parent directory is used.
+	AvailableSpace(path string) (int64, error)
 }
 
 type fileSystem struct{}
@@ -105,6 +167,10 @@ func (f *fileSystem) GetLocalExecutable(name string) (string, error) {
 		return "", fmt.Errorf("failed to get parent dir of current executable: %w", err)
 	}
 
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+
 	programPath := filepath.Join(exeDir, name)
 	programExists, err := f.FileExists(programPath)
 	if err != nil {
@@ -127,6 +193,10 @@ func (f *fileSystem) FileExists(filename string) (bool, error) {
 	}
 }
 
+func (f *fileSystem) Stat(filename string) (fs.FileInfo, error) {
+	return os.Stat(filename)
+}
+
 func (f *fileSystem) WriteFile(filename string, content []byte) error {
 	err := f.createLeadingDirs(filename)
 	if err != nil {
@@ -147,7 +217,7 @@ func (f *fileSystem) WriteLockFileFunc(filename string, writeFunc func(io.Writer
 	}
 
 	lockFilename := filename + ".lock"
-	lock, err := os.OpenFile(lockFilename, os.O_WRONLY|os.O_CREATE, DefaultFilePermissions)
+	lock, err := os.OpenFile(lockFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, DefaultFilePermissions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
@@ -161,6 +231,16 @@ func (f *fileSystem) WriteLockFileFunc(filename string, writeFunc func(io.Writer
 		return nil, err
 	}
 
+	// Flush the content before it can be committed, so that a crash never
+	// leaves a renamed but incomplete file.
+	err = lock.Sync()
+	if err != nil {
+		// Try to close & rollback - don't worry about errors, we're already failing.
+		lock.Close()
+		lockFile.Rollback()
+		return nil, fmt.Errorf("failed to flush lock file: %w", err)
+	}
+
 	err = lock.Close()
 	if err != nil {
 		// Try to rollback - don't worry about errors, we're already failing.
@@ -171,6 +251,60 @@ func (f *fileSystem) WriteLockFileFunc(filename string, writeFunc func(io.Writer
 	return lockFile, nil
 }
 
+func (f *fileSystem) SyncFile(filename string) error {
+	// Windows requires write access to flush a file.
+	file, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	err = file.Sync()
+	closeErr := file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to flush file: %w", err)
+	} else if closeErr != nil {
+		return fmt.Errorf("failed to close file: %w", closeErr)
+	}
+
+	err = syncDir(filepath.Dir(filename))
+	if err != nil {
+		return fmt.Errorf("failed to flush directory: %w", err)
+	}
+	return nil
+}
+
+func (f *fileSystem) lockFile(filename string, wait bool) (FileLock, bool, error) {
+	err := f.createLeadingDirs(filename)
+	if err != nil {
+		return nil, false, err
+	}
+
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, DefaultFilePermissions)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	acquired, err := lockFileHandle(file, wait)
+	if err != nil {
+		file.Close()
+		return nil, false, fmt.Errorf("failed to lock file: %w", err)
+	} else if !acquired {
+		file.Close()
+		return nil, false, nil
+	}
+
+	return &fileLock{file: file}, true, nil
+}
+
+func (f *fileSystem) AcquireFileLock(filename string) (FileLock, error) {
+	lock, _, err := f.lockFile(filename, true)
+	return lock, err
+}
+
+func (f *fileSystem) TryAcquireFileLock(filename string) (FileLock, bool, error) {
+	return f.lockFile(filename, false)
+}
+
 func (f *fileSystem) DeleteFile(filename string) (bool, error) {
 	err := os.Remove(filename)
 	if err == nil {
@@ -245,3 +379,51 @@ func (f *fileSystem) ReadDirRecursive(path string, depth int, strictDepth bool)
 
 	return out, nil
 }
+
+func (f *fileSystem) DirSize(path string) (int64, error) {
+	size := int64(0)
+	err := filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// The directory (or a file in it) was removed while walking
+				return nil
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute size of '%s': %w", path, err)
+	}
+	return size, nil
+}
+
+func (f *fileSystem) AvailableSpace(path string) (int64, error) {
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			break
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0, err
+		}
+		path = parent
+	}
+
+	return availableSpace(path)
+}
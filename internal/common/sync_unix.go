@@ -0,0 +1,19 @@
+//go:build !windows
+
+package common
+
+import (
+	"os"
+)
+
+// syncDir flushes the entries of the given directory (e.g. a file renamed into
+// it) to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -4,26 +4,135 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
 	"github.com/git-ecosystem/git-bundle-server/internal/utils"
 )
 
-type cronSchedule string
+type CronSchedule string
 
 const (
-	CronDaily  cronSchedule = "0 0 * * *"
-	CronWeekly cronSchedule = "0 0 0 * *"
+	CronQuarterHourly CronSchedule = "*/15 * * * *"
+	CronDaily         CronSchedule = "0 0 * * *"
+	CronWeekly        CronSchedule = "0 0 * * 0"
 )
 
+// Interval approximates the schedule as a fixed interval between runs, for
+// schedulers (like launchd and Task Scheduler) that run jobs periodically rather than at specific
+// times. Only the subset of cron syntax used by the bundle server schedules is
+// supported: the day-of-month and month fields must be '*'.
+func (s CronSchedule) Interval() (time.Duration, error) {
+	fields := strings.Fields(string(s))
+	if len(fields) != 5 || fields[2] != "*" || fields[3] != "*" {
+		return 0, fmt.Errorf("unsupported cron schedule '%s'", s)
+	}
+
+	stepOf := func(field string) (int, bool) {
+		if field == "*" {
+			return 1, true
+		}
+		step, found := strings.CutPrefix(field, "*/")
+		if !found {
+			return 0, false
+		}
+		value, err := strconv.Atoi(step)
+		return value, err == nil && value > 0
+	}
+
+	minute, hour, weekday := fields[0], fields[1], fields[4]
+	if step, ok := stepOf(minute); ok && hour == "*" && weekday == "*" {
+		return time.Duration(step) * time.Minute, nil
+	} else if _, err := strconv.Atoi(minute); err != nil {
+		return 0, fmt.Errorf("unsupported cron schedule '%s'", s)
+	}
+
+	if step, ok := stepOf(hour); ok && weekday == "*" {
+		return time.Duration(step) * time.Hour, nil
+	} else if _, err := strconv.Atoi(hour); err != nil {
+		return 0, fmt.Errorf("unsupported cron schedule '%s'", s)
+	}
+
+	if weekday == "*" {
+		return 24 * time.Hour, nil
+	} else if _, err := strconv.Atoi(weekday); err == nil {
+		return 7 * 24 * time.Hour, nil
+	}
+	return 0, fmt.Errorf("unsupported cron schedule '%s'", s)
+}
+
+const jobLabelPrefix string = "com.git-ecosystem.gitbundleserver"
+
+// jobLabel names a scheduled job after the subcommand it runs, so that each
+// job gets its own service (for schedulers that need one). Any options
+// preceding the subcommand must be in '--flag=value' form.
+func jobLabel(args []string) string {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return fmt.Sprintf("%s.%s", jobLabelPrefix, arg)
+		}
+	}
+	return jobLabelPrefix
+}
+
+// jobKey identifies a scheduled job by its executable's name and its arguments
+// up to the subcommand (e.g. '--root=<dir>' and 'update-all'), so that a job
+// whose schedule or other options changed replaces the previous one rather
+// than running alongside it.
+func jobKey(exePath string, args []string) string {
+	key := []string{filepath.Base(exePath)}
+	for _, arg := range args {
+		key = append(key, arg)
+		if !strings.HasPrefix(arg, "-") {
+			break
+		}
+	}
+	return strings.Join(key, " ")
+}
+
 type CronScheduler interface {
-	AddJob(ctx context.Context, schedule cronSchedule,
+	AddJob(ctx context.Context, schedule CronSchedule,
 		exePath string, args []string) error
 }
 
+// systemdAvailable checks whether the current user's systemd instance can be
+// reached (which is not the case in many containers, for example).
+func systemdAvailable(ctx context.Context, c cmd.CommandExecutor) bool {
+	exitCode, err := c.RunQuiet(ctx, "systemctl", "--user", "show-environment")
+	return err == nil && exitCode == 0
+}
+
+// NewScheduler creates the CronScheduler appropriate for the current system:
+// systemd timers on Linux hosts running systemd, a launchd agent on macOS, a
+// Task Scheduler task on Windows, and crontab otherwise.
+func NewScheduler(
+	ctx context.Context,
+	l log.TraceLogger,
+	u common.UserProvider,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+) CronScheduler {
+	switch runtime.GOOS {
+	case "linux":
+		if systemdAvailable(ctx, c) {
+			return NewSystemdTimerScheduler(l, u, c, fs)
+		}
+	case "darwin":
+		return NewDaemonScheduler(l, daemon.NewLaunchdProvider(l, u, c, fs))
+	case "windows":
+		return NewDaemonScheduler(l, daemon.NewTaskSchedulerProvider(l, u, c, fs))
+	}
+	return NewCronScheduler(l, u, c, fs)
+}
+
 type cronScheduler struct {
 	logger     log.TraceLogger
 	user       common.UserProvider
@@ -47,10 +156,16 @@ func NewCronScheduler(
 
 func (c *cronScheduler) loadExistingSchedule(ctx context.Context) ([]byte, error) {
 	buffer := bytes.Buffer{}
-	exitCode, err := c.cmdExec.Run(ctx, "crontab", []string{"-l"}, cmd.Stdout(&buffer))
+	stderr := bytes.Buffer{}
+	exitCode, err := c.cmdExec.Run(ctx, "crontab", []string{"-l"}, cmd.Stdout(&buffer), cmd.Stderr(&stderr))
 	if err != nil {
 		return nil, c.logger.Error(ctx, err)
 	} else if exitCode != 0 {
+		// Both the Linux and BSD crontab exit with an error (and print "no
+		// crontab for <user>") if the user doesn't have a crontab yet.
+		if strings.Contains(stderr.String(), "no crontab for") {
+			return []byte{}, nil
+		}
 		return nil, c.logger.Errorf(ctx, "'crontab' exited with status %d", exitCode)
 	}
 
@@ -68,41 +183,59 @@ func (c *cronScheduler) commitCronSchedule(ctx context.Context, filename string)
 	return nil
 }
 
-func (c *cronScheduler) AddJob(ctx context.Context,
-	schedule cronSchedule,
-	exePath string,
-	args []string,
-) error {
-	newSchedule := fmt.Sprintf("%s \"%s\" %s",
-		schedule,
-		exePath,
-		utils.Map(args, func(s string) string { return "\"" + s + "\"" }),
-	)
+// The arguments of a crontab entry, double-quoted or not. Older versions wrote
+// the arguments wrapped in brackets (e.g. '["update-all"]').
+var crontabArgPattern = regexp.MustCompile(`\[?"([^"]*)"\]?|(\S+)`)
 
-	scheduleBytes, err := c.loadExistingSchedule(ctx)
-	if err != nil {
-		return c.logger.Errorf(ctx, "failed to get existing cron schedule: %w", err)
+// crontabJobKey returns the jobKey of the job run by a line of a crontab, or
+// an empty string if the line isn't a job (e.g. a comment or a variable).
+func crontabJobKey(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
 	}
 
-	scheduleStr := string(scheduleBytes)
+	// The schedule is either five fields or a nickname (e.g. '@daily')
+	scheduleFields := 5
+	if strings.HasPrefix(line, "@") {
+		scheduleFields = 1
+	}
 
-	// TODO: Use comments to indicate a "region" where our schedule
-	// is set, so we can remove the entire region even if we update
-	// the schedule in the future.
-	if strings.Contains(scheduleStr, newSchedule) {
-		// We already have this schedule, so skip modifying
-		// the crontab schedule.
-		return nil
+	fields := strings.Fields(line)
+	if len(fields) <= scheduleFields || strings.Contains(fields[0], "=") {
+		return ""
+	}
+
+	// Skip the schedule
+	command := line
+	for i := 0; i < scheduleFields; i++ {
+		command = strings.TrimLeft(command, " \t")
+		command = command[strings.IndexAny(command, " \t"):]
 	}
 
-	scheduleBytes = append(scheduleBytes, []byte(schedule)...)
+	args := []string{}
+	for _, match := range crontabArgPattern.FindAllStringSubmatch(command, -1) {
+		if match[2] != "" {
+			args = append(args, match[2])
+		} else {
+			args = append(args, match[1])
+		}
+	}
+	return jobKey(args[0], args[1:])
+}
 
+// writeSchedule replaces the user's crontab with the given lines.
+func (c *cronScheduler) writeSchedule(ctx context.Context, lines []string) error {
 	user, err := c.user.CurrentUser()
 	if err != nil {
 		return c.logger.Error(ctx, err)
 	}
 	scheduleFile := CrontabFile(user)
 
+	scheduleBytes := []byte{}
+	if len(lines) > 0 {
+		scheduleBytes = []byte(strings.Join(lines, "\n") + "\n")
+	}
 	err = c.fileSystem.WriteFile(scheduleFile, scheduleBytes)
 	if err != nil {
 		return c.logger.Errorf(ctx, "failed to write new cron schedule to temp file: %w", err)
@@ -120,3 +253,53 @@ func (c *cronScheduler) AddJob(ctx context.Context,
 
 	return nil
 }
+
+// replaceJob removes the crontab entries running the same job as 'exePath' and
+// 'args' (see jobKey), then adds 'newEntry' if not empty. The crontab is only
+// rewritten if this changes it.
+func (c *cronScheduler) replaceJob(ctx context.Context, exePath string, args []string, newEntry string) error {
+	scheduleBytes, err := c.loadExistingSchedule(ctx)
+	if err != nil {
+		return c.logger.Errorf(ctx, "failed to get existing cron schedule: %w", err)
+	}
+
+	key := jobKey(exePath, args)
+	lines := []string{}
+	found, removed := false, false
+	for _, line := range strings.Split(strings.TrimSuffix(string(scheduleBytes), "\n"), "\n") {
+		if line == "" && len(lines) == 0 {
+			continue
+		} else if newEntry != "" && line == newEntry && !found {
+			found = true
+		} else if crontabJobKey(line) == key {
+			removed = true
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if !removed && (found || newEntry == "") {
+		// We already have this schedule, so skip modifying
+		// the crontab schedule.
+		return nil
+	}
+	if newEntry != "" && !found {
+		lines = append(lines, newEntry)
+	}
+
+	return c.writeSchedule(ctx, lines)
+}
+
+func (c *cronScheduler) AddJob(ctx context.Context,
+	schedule CronSchedule,
+	exePath string,
+	args []string,
+) error {
+	newSchedule := fmt.Sprintf("%s \"%s\" %s",
+		schedule,
+		exePath,
+		strings.Join(utils.Map(args, func(s string) string { return "\"" + s + "\"" }), " "),
+	)
+
+	return c.replaceJob(ctx, exePath, args, newSchedule)
+}
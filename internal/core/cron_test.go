@@ -0,0 +1,195 @@
+package core_test
+
+import (
+	"context"
+	"io"
+	"os/user"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var cronIntervalTests = []struct {
+	title string
+
+	// Inputs
+	schedule core.CronSchedule
+
+	// Expected values
+	expectedInterval time.Duration
+	expectErr        bool
+}{
+	{"Quarter-hourly", core.CronQuarterHourly, 15 * time.Minute, false},
+	{"Daily", core.CronDaily, 24 * time.Hour, false},
+	{"Weekly", core.CronWeekly, 7 * 24 * time.Hour, false},
+	{"Every minute", core.CronSchedule("* * * * *"), time.Minute, false},
+	{"Every six hours", core.CronSchedule("30 */6 * * *"), 6 * time.Hour, false},
+	{"Monthly is unsupported", core.CronSchedule("0 0 1 * *"), 0, true},
+	{"Minute list is unsupported", core.CronSchedule("0,30 * * * *"), 0, true},
+	{"Too few fields", core.CronSchedule("0 0 *"), 0, true},
+}
+
+func TestCronSchedule_Interval(t *testing.T) {
+	for _, tt := range cronIntervalTests {
+		t.Run(tt.title, func(t *testing.T) {
+			interval, err := tt.schedule.Interval()
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedInterval, interval)
+			}
+		})
+	}
+}
+
+var cronAddJobTests = []struct {
+	title string
+
+	// Mocked responses
+	crontabList       Pair[int, error]
+	crontabListStdout string
+	crontabListStderr string
+
+	// Expected values
+	expectedSchedule string
+	expectErr        bool
+}{
+	{
+		"Job is appended to existing crontab",
+		NewPair[int, error](0, nil),
+		"0 * * * * /usr/bin/true\n",
+		"",
+		"0 * * * * /usr/bin/true\n*/15 * * * * \"/bin/git-bundle-server\" \"update-all\" \"--due-only\"\n",
+		false,
+	},
+	{
+		"Existing job is not duplicated",
+		NewPair[int, error](0, nil),
+		"*/15 * * * * \"/bin/git-bundle-server\" \"update-all\" \"--due-only\"\n",
+		"",
+		"",
+		false,
+	},
+	{
+		"Previous schedule of the job is replaced",
+		NewPair[int, error](0, nil),
+		"0 * * * * /usr/bin/true\n0 0 * * * \"/usr/local/bin/git-bundle-server\" \"update-all\"\n@hourly /usr/bin/true\n",
+		"",
+		"0 * * * * /usr/bin/true\n@hourly /usr/bin/true\n*/15 * * * * \"/bin/git-bundle-server\" \"update-all\" \"--due-only\"\n",
+		false,
+	},
+	{
+		"Schedule written by older versions is replaced",
+		NewPair[int, error](0, nil),
+		"0 0 * * * \"/bin/git-bundle-server\" [\"update-all\"]\n",
+		"",
+		"*/15 * * * * \"/bin/git-bundle-server\" \"update-all\" \"--due-only\"\n",
+		false,
+	},
+	{
+		"Duplicate jobs are removed",
+		NewPair[int, error](0, nil),
+		"*/15 * * * * \"/bin/git-bundle-server\" \"update-all\" \"--due-only\"\n0 0 * * * \"/bin/git-bundle-server\" \"update-all\"\n",
+		"",
+		"*/15 * * * * \"/bin/git-bundle-server\" \"update-all\" \"--due-only\"\n",
+		false,
+	},
+	{
+		"Jobs of other storage roots are kept",
+		NewPair[int, error](0, nil),
+		"*/15 * * * * \"/bin/git-bundle-server\" \"--root=/srv/bundles\" \"update-all\" \"--due-only\"\n",
+		"",
+		"*/15 * * * * \"/bin/git-bundle-server\" \"--root=/srv/bundles\" \"update-all\" \"--due-only\"\n*/15 * * * * \"/bin/git-bundle-server\" \"update-all\" \"--due-only\"\n",
+		false,
+	},
+	{
+		"Missing crontab is created",
+		NewPair[int, error](1, nil),
+		"",
+		"crontab: no crontab for testuser\n",
+		"*/15 * * * * \"/bin/git-bundle-server\" \"update-all\" \"--due-only\"\n",
+		false,
+	},
+	{
+		"Other 'crontab' failures are errors",
+		NewPair[int, error](1, nil),
+		"",
+		"crontab: permission denied\n",
+		"",
+		true,
+	},
+}
+
+func TestCronScheduler_AddJob(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+	scheduler := core.NewCronScheduler(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	for _, tt := range cronAddJobTests {
+		t.Run(tt.title, func(t *testing.T) {
+			// Mock responses
+			testCommandExecutor.On("Run",
+				ctx,
+				"crontab",
+				[]string{"-l"},
+				mock.Anything,
+			).Run(func(args mock.Arguments) {
+				for _, setting := range args.Get(3).([]cmd.Setting) {
+					switch setting.Key {
+					case cmd.StdoutKey:
+						io.WriteString(setting.Value.(io.Writer), tt.crontabListStdout)
+					case cmd.StderrKey:
+						io.WriteString(setting.Value.(io.Writer), tt.crontabListStderr)
+					}
+				}
+			}).Return(tt.crontabList.First, tt.crontabList.Second).Once()
+
+			var actualSchedule string
+			if tt.expectedSchedule != "" {
+				scheduleFile := core.CrontabFile(testUser)
+				testFileSystem.On("WriteFile", scheduleFile, mock.Anything).Run(func(args mock.Arguments) {
+					actualSchedule = string(args.Get(1).([]byte))
+				}).Return(nil).Once()
+				testCommandExecutor.On("RunQuiet",
+					ctx,
+					"crontab",
+					[]string{scheduleFile},
+				).Return(0, nil).Once()
+				testFileSystem.On("DeleteFile", scheduleFile).Return(true, nil).Once()
+			}
+
+			// Run "AddJob"
+			err := scheduler.AddJob(ctx, core.CronQuarterHourly, "/bin/git-bundle-server", []string{"update-all", "--due-only"})
+
+			// Assert on expected values
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, tt.expectedSchedule, actualSchedule)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+			// Reset mocks
+			testCommandExecutor.Mock = mock.Mock{}
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
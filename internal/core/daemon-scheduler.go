@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+type daemonScheduler struct {
+	logger   log.TraceLogger
+	provider daemon.DaemonProvider
+}
+
+// NewDaemonScheduler creates a CronScheduler that runs each job as a daemon
+// with a 'StartInterval'. The given daemon provider must support intervals
+// (i.e., launchd or Task Scheduler).
+func NewDaemonScheduler(
+	l log.TraceLogger,
+	d daemon.DaemonProvider,
+) CronScheduler {
+	return &daemonScheduler{
+		logger:   l,
+		provider: d,
+	}
+}
+
+func (s *daemonScheduler) AddJob(ctx context.Context,
+	schedule CronSchedule,
+	exePath string,
+	args []string,
+) error {
+	interval, err := schedule.Interval()
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	config := &daemon.DaemonConfig{
+		Label:         jobLabel(args),
+		Description:   fmt.Sprintf("Git Bundle Server scheduled '%s'", strings.Join(args, " ")),
+		Program:       exePath,
+		Arguments:     args,
+		StartInterval: interval,
+	}
+
+	// Don't force the daemon to be recreated; if it is already registered,
+	// the schedule is already in place.
+	err = s.provider.Create(ctx, config, false)
+	if err != nil {
+		return s.logger.Errorf(ctx, "failed to create scheduled daemon: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,513 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/git-ecosystem/git-bundle-server/internal/utils"
+)
+
+// A configuration archive is a gzipped tarball of JSON files: a manifest
+// (the remote URL of each route and the secrets removed from the export), the
+// route registry (the routes, their settings and update schedules, and the
+// server-wide settings), and the other configuration files of the root.
+const (
+	configArchiveVersion   int    = 1
+	configManifestFilename string = "manifest.json"
+
+	// The largest file read from a configuration archive.
+	maxConfigFileSize int64 = 64 * 1024 * 1024
+)
+
+// The configuration files in the root exported along with the route
+// registry, mapped to the settings removed from them because they are secrets
+// (each a path of JSON object keys separated by '.'). The settings referring
+// to secrets kept elsewhere (e.g. the path of a signing key) are exported.
+var exportedConfigFiles = map[string][]string{
+	"storage.json": {"s3.accessKeyId", "s3.secretAccessKey", "s3.sessionToken"},
+	"signing.json": {},
+}
+
+type configManifest struct {
+	Version   int               `json:"version"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Remotes   map[string]string `json:"remotes"`
+	Redacted  []string          `json:"redacted,omitempty"`
+}
+
+// ServerConfig is the configuration of a bundle server, exported with
+// 'ExportConfig' so that the bundle server can be rebuilt on another host
+// with 'ImportConfig'. It contains no repository data and no secrets.
+type ServerConfig struct {
+	CreatedAt time.Time
+
+	// The URL from which each route's repository is cloned, with any
+	// credentials removed.
+	Remotes map[string]string
+
+	// The configuration files of the root other than the route registry
+	// (e.g. 'storage.json'), by filename.
+	Files map[string][]byte
+
+	// Descriptions of the secrets removed from the configuration (e.g.
+	// "storage.json: s3.secretAccessKey"), which must be configured again
+	// after importing it.
+	Redacted []string
+
+	registry *routeRegistry
+}
+
+// Routes returns the routes of the configuration, sorted.
+func (c *ServerConfig) Routes() []string {
+	routes := utils.Keys(c.registry.Routes)
+	sort.Strings(routes)
+	return routes
+}
+
+// WriteArchive writes the configuration as a gzipped tarball.
+func (c *ServerConfig) WriteArchive(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	writeFile := func(name string, content []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o600,
+			Size:    int64(len(content)),
+			ModTime: c.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(content)
+		return err
+	}
+	writeJSON := func(name string, v any) error {
+		content, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeFile(name, append(content, '\n'))
+	}
+
+	err := writeJSON(configManifestFilename, configManifest{
+		Version:   configArchiveVersion,
+		CreatedAt: c.CreatedAt,
+		Remotes:   c.Remotes,
+		Redacted:  c.Redacted,
+	})
+	if err != nil {
+		return err
+	}
+	err = writeJSON(registryFilename, c.registry)
+	if err != nil {
+		return err
+	}
+
+	filenames := utils.Keys(c.Files)
+	sort.Strings(filenames)
+	for _, name := range filenames {
+		err = writeFile(name, c.Files[name])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ReadConfigArchive reads a configuration written by 'WriteArchive'.
+func ReadConfigArchive(r io.Reader) (*ServerConfig, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a configuration archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := map[string][]byte{}
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read configuration archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if header.Size > maxConfigFileSize {
+			return nil, fmt.Errorf("file '%s' of configuration archive is too large", header.Name)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s' from configuration archive: %w", header.Name, err)
+		}
+		files[header.Name] = content
+	}
+
+	var manifest configManifest
+	manifestBytes, contains := files[configManifestFilename]
+	if !contains {
+		return nil, fmt.Errorf("configuration archive has no '%s'", configManifestFilename)
+	}
+	err = json.Unmarshal(manifestBytes, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid '%s': %w", configManifestFilename, err)
+	}
+	if manifest.Version > configArchiveVersion {
+		return nil, fmt.Errorf("configuration archive version %d is not supported; "+
+			"it may have been written by a newer version of git-bundle-server", manifest.Version)
+	}
+
+	registryBytes, contains := files[registryFilename]
+	if !contains {
+		return nil, fmt.Errorf("configuration archive has no '%s'", registryFilename)
+	}
+	reg := &routeRegistry{}
+	err = json.Unmarshal(registryBytes, reg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid '%s': %w", registryFilename, err)
+	}
+	if reg.Version > registryVersion {
+		return nil, fmt.Errorf("route registry version %d is not supported; "+
+			"it may have been written by a newer version of git-bundle-server", reg.Version)
+	}
+	if reg.Routes == nil {
+		reg.Routes = make(map[string]routeEntry)
+	}
+
+	config := &ServerConfig{
+		CreatedAt: manifest.CreatedAt,
+		Remotes:   manifest.Remotes,
+		Files:     map[string][]byte{},
+		Redacted:  manifest.Redacted,
+		registry:  reg,
+	}
+	if config.Remotes == nil {
+		config.Remotes = map[string]string{}
+	}
+	for name := range exportedConfigFiles {
+		if content, contains := files[name]; contains {
+			config.Files[name] = content
+		}
+	}
+	return config, nil
+}
+
+// redactRemoteURL removes the credentials from the URL of a remote. Over HTTP,
+// the user name may itself be a token, so all user information is removed;
+// otherwise (e.g. 'ssh://git@host/repo'), only the password is. URLs that
+// can't be parsed (e.g. 'git@host:repo') are returned unchanged.
+func redactRemoteURL(remote string) (string, bool) {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil {
+		return remote, false
+	}
+
+	if u.Scheme == "http" || u.Scheme == "https" {
+		u.User = nil
+		return u.String(), true
+	} else if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.User(u.User.Username())
+		return u.String(), true
+	}
+	return remote, false
+}
+
+// redactProxyURL removes the password from the URL of a proxy. The user name
+// is kept, so that it's clear which account's password to configure again.
+func redactProxyURL(proxy string) (string, bool) {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy, false
+	}
+
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.User(u.User.Username())
+		return u.String(), true
+	}
+	return proxy, false
+}
+
+// redactConfigFile removes the settings at the given paths from the JSON
+// content of a configuration file, returning the content and the paths of the
+// settings that were removed.
+func redactConfigFile(content []byte, secrets []string) ([]byte, []string, error) {
+	if len(secrets) == 0 {
+		return content, nil, nil
+	}
+
+	var config map[string]any
+	err := json.Unmarshal(content, &config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	removed := []string{}
+	for _, secret := range secrets {
+		keys := strings.Split(secret, ".")
+		object := config
+		for _, key := range keys[:len(keys)-1] {
+			object, _ = object[key].(map[string]any)
+		}
+		if value, contains := object[keys[len(keys)-1]]; contains && value != "" {
+			delete(object, keys[len(keys)-1])
+			removed = append(removed, secret)
+		}
+	}
+
+	redacted, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(redacted, '\n'), removed, nil
+}
+
+func (r *repoProvider) ExportConfig(ctx context.Context) (*ServerConfig, error) {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "export_config")
+	defer exitRegion()
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := r.readRegistry(user)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ServerConfig{
+		CreatedAt: time.Now().UTC(),
+		Remotes:   map[string]string{},
+		Files:     map[string][]byte{},
+		Redacted:  []string{},
+		registry: &routeRegistry{
+			Version:    registryVersion,
+			BaseURL:    reg.BaseURL,
+			RouteDepth: reg.RouteDepth,
+			Primary:    reg.Primary,
+			Routes:     map[string]routeEntry{},
+			Redirects:  reg.Redirects,
+
+			// The data of deleted routes isn't exported, so they can't be
+			// restored on another host.
+		},
+	}
+
+	// The base of a URL rewrite (e.g. 'https://<token>@mirror.example.com/')
+	// may contain credentials, like a remote URL.
+	for _, rewrite := range reg.URLRewrites {
+		base, redacted := redactRemoteURL(rewrite.Base)
+		if redacted {
+			config.Redacted = append(config.Redacted, fmt.Sprintf("credentials in the URL rewrite of '%s'", rewrite.InsteadOf))
+		}
+		config.registry.URLRewrites = append(config.registry.URLRewrites, git.URLRewrite{
+			Base:      base,
+			InsteadOf: rewrite.InsteadOf,
+		})
+	}
+
+	proxy, redacted := redactProxyURL(reg.Proxy)
+	if redacted {
+		config.Redacted = append(config.Redacted, "credentials in the server-wide proxy")
+	}
+	config.registry.Proxy = proxy
+
+	for route, entry := range reg.Routes {
+		config.registry.Routes[route] = entry
+	}
+	for _, route := range config.Routes() {
+		entry := config.registry.Routes[route]
+		proxy, redacted := redactProxyURL(entry.Proxy)
+		if redacted {
+			config.Redacted = append(config.Redacted, fmt.Sprintf("credentials in the proxy of route '%s'", route))
+			entry.Proxy = proxy
+			config.registry.Routes[route] = entry
+		}
+	}
+
+	// The routes of a replica are mirrored from its primary rather than
+	// cloned, so they have no remotes.
+	clonedRoutes := config.Routes()
+	if reg.Primary != nil {
+		clonedRoutes = []string{}
+	}
+	for _, route := range clonedRoutes {
+		repo, err := reg.repository(user, route, reg.Routes[route])
+		if err != nil {
+			return nil, err
+		}
+		remote, err := r.gitHelper.GetRemoteUrl(ctx, repo.RepoDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get remote URL of route '%s': %w", route, err)
+		}
+
+		remote, redacted := redactRemoteURL(remote)
+		if redacted {
+			config.Redacted = append(config.Redacted, fmt.Sprintf("credentials in the remote URL of route '%s'", route))
+		}
+		config.Remotes[route] = remote
+	}
+
+	filenames := utils.Keys(exportedConfigFiles)
+	sort.Strings(filenames)
+	for _, name := range filenames {
+		lines, err := r.fileSystem.ReadFileLines(filepath.Join(r.roots.bundleroot(user), name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", name, err)
+		} else if len(lines) == 0 {
+			continue
+		}
+
+		content, removed, err := redactConfigFile([]byte(strings.Join(lines, "\n")+"\n"), exportedConfigFiles[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s': %w", name, err)
+		}
+		for _, secret := range removed {
+			config.Redacted = append(config.Redacted, fmt.Sprintf("%s: %s", name, secret))
+		}
+		config.Files[name] = content
+	}
+
+	return config, nil
+}
+
+// ConfigImport describes the changes made by 'ImportConfig'.
+type ConfigImport struct {
+	// The routes registered by the import. Their repositories have not been
+	// cloned yet.
+	Added map[string]Repository
+
+	// The routes of the configuration that were already registered, whose
+	// settings were left unchanged.
+	Skipped []string
+
+	// The configuration files written to the root, and those left unchanged
+	// because they already existed.
+	FilesWritten []string
+	FilesSkipped []string
+}
+
+func (r *repoProvider) importRoutes(user *user.User, config *ServerConfig, result *ConfigImport) error {
+	return r.updateRegistry(user, func(reg *routeRegistry) error {
+		imported := config.registry
+		reg.BaseURL = imported.BaseURL
+		reg.Proxy = imported.Proxy
+		for _, rewrite := range imported.URLRewrites {
+			err := rewrite.Validate()
+			if err != nil {
+				return fmt.Errorf("invalid URL rewrite of '%s': %w", rewrite.InsteadOf, err)
+			}
+		}
+		reg.URLRewrites = imported.URLRewrites
+		reg.Primary = imported.Primary
+
+		if imported.RouteDepth != nil {
+			depth := *imported.RouteDepth
+			err := depth.Validate()
+			if err != nil {
+				return fmt.Errorf("invalid route depth: %w", err)
+			}
+			for route := range reg.Routes {
+				if err := ValidateRoute(route, depth); err != nil {
+					return fmt.Errorf("registered route '%s' is outside of the imported route depth: %w", route, err)
+				}
+			}
+			reg.RouteDepth = &depth
+		}
+
+		for _, route := range config.Routes() {
+			if _, contains := reg.Routes[route]; contains {
+				result.Skipped = append(result.Skipped, route)
+				continue
+			}
+
+			err := ValidateRoute(route, reg.routeDepth())
+			if err != nil {
+				return fmt.Errorf("invalid route '%s': %w", route, err)
+			}
+			err = ValidateRouteNesting(route, utils.Keys(reg.Routes))
+			if err != nil {
+				return err
+			}
+
+			entry := imported.Routes[route]
+			repo, err := reg.repository(user, route, entry)
+			if err != nil {
+				return err
+			}
+			reg.Routes[route] = entry
+			result.Added[route] = repo
+		}
+
+		for oldRoute, newRoute := range imported.Redirects {
+			if _, contains := reg.Routes[oldRoute]; !contains {
+				if reg.Redirects == nil {
+					reg.Redirects = make(map[string]string)
+				}
+				reg.Redirects[oldRoute] = newRoute
+			}
+		}
+		return nil
+	})
+}
+
+func (r *repoProvider) ImportConfig(ctx context.Context, config *ServerConfig, overwrite bool) (*ConfigImport, error) {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "import_config") //lint:ignore SA4006 keep ctx up-to-date
+	defer exitRegion()
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ConfigImport{
+		Added:        map[string]Repository{},
+		Skipped:      []string{},
+		FilesWritten: []string{},
+		FilesSkipped: []string{},
+	}
+
+	filenames := utils.Keys(config.Files)
+	sort.Strings(filenames)
+	for _, name := range filenames {
+		filename := filepath.Join(r.roots.bundleroot(user), name)
+		exists, err := r.fileSystem.FileExists(filename)
+		if err != nil {
+			return nil, err
+		} else if exists && !overwrite {
+			result.FilesSkipped = append(result.FilesSkipped, name)
+			continue
+		}
+
+		err = r.fileSystem.WriteFile(filename, config.Files[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to write '%s': %w", name, err)
+		}
+		result.FilesWritten = append(result.FilesWritten, name)
+	}
+
+	err = r.importRoutes(user, config, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
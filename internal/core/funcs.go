@@ -1,7 +1,13 @@
 package core
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -27,3 +33,341 @@ func GetRouteFromUrl(url string) (string, bool) {
 
 	return "", false
 }
+
+// RouteDepth is the range of the number of '/'-separated elements in the
+// routes of a bundle server, e.g. 1 for routes like '<repo>', 2 for routes
+// like '<owner>/<repo>' (the default), or 1-3 for routes like '<repo>',
+// '<org>/<repo>', or '<org>/<team>/<repo>'.
+type RouteDepth struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// The route depth of bundle servers that don't configure one.
+var DefaultRouteDepth = RouteDepth{Min: 2, Max: 2}
+
+// The maximum number of elements in a route.
+const maxRouteDepth int = 8
+
+// ParseRouteDepth parses a route depth given as '<n>' or '<min>-<max>'.
+func ParseRouteDepth(value string) (RouteDepth, error) {
+	minValue, maxValue, isRange := strings.Cut(value, "-")
+	if !isRange {
+		maxValue = minValue
+	}
+
+	min, err := strconv.Atoi(strings.TrimSpace(minValue))
+	if err != nil {
+		return RouteDepth{}, fmt.Errorf("invalid route depth '%s'", value)
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(maxValue))
+	if err != nil {
+		return RouteDepth{}, fmt.Errorf("invalid route depth '%s'", value)
+	}
+
+	depth := RouteDepth{Min: min, Max: max}
+	return depth, depth.Validate()
+}
+
+// Validate checks that the route depth is a non-empty range within the
+// supported depths.
+func (d RouteDepth) Validate() error {
+	if d.Min < 1 || d.Max > maxRouteDepth || d.Min > d.Max {
+		return fmt.Errorf("route depth must be between 1 and %d", maxRouteDepth)
+	}
+	return nil
+}
+
+func (d RouteDepth) String() string {
+	if d.Min == d.Max {
+		return strconv.Itoa(d.Min)
+	}
+	return fmt.Sprintf("%d-%d", d.Min, d.Max)
+}
+
+// describeRouteForm describes the form of the routes with the given depth,
+// e.g. '<owner>/<repo>'.
+func (d RouteDepth) describeRouteForm() string {
+	form := func(depth int) string {
+		switch depth {
+		case 1:
+			return "'<repo>'"
+		case 2:
+			return "'<owner>/<repo>'"
+		default:
+			return "'" + strings.Repeat("<group>/", depth-1) + "<repo>'"
+		}
+	}
+	if d.Min == d.Max {
+		return form(d.Min)
+	}
+	return fmt.Sprintf("%s to %s", form(d.Min), form(d.Max))
+}
+
+// ValidateRoute checks that the given string can be used as a route: the web
+// server serves routes with a number of '/'-separated elements within the
+// bundle server's route depth (e.g. '<owner>/<repo>'), and each element is
+// used as a directory name.
+func ValidateRoute(route string, depth RouteDepth) error {
+	elements := strings.Split(route, "/")
+	if len(elements) < depth.Min || len(elements) > depth.Max {
+		return fmt.Errorf("route must have the form %s", depth.describeRouteForm())
+	}
+	for _, element := range elements {
+		if element == "" || element == "." || element == ".." || strings.ContainsAny(element, "\\\x00") {
+			return fmt.Errorf("invalid route element '%s'", element)
+		}
+	}
+	return nil
+}
+
+// ValidateRouteNesting checks that the given route neither contains nor is
+// contained in any of the given routes (e.g. 'org' and 'org/repo'), since the
+// directories of routes cannot be nested.
+func ValidateRouteNesting(route string, routes []string) error {
+	for _, other := range routes {
+		if other == route {
+			continue
+		}
+		if strings.HasPrefix(other, route+"/") || strings.HasPrefix(route, other+"/") {
+			return fmt.Errorf("route '%s' cannot be nested with route '%s'", route, other)
+		}
+	}
+	return nil
+}
+
+// ValidateBaseURL checks that the given string can be used as the base URL of
+// bundle URIs: it must be an absolute HTTP(S) URL with no query or fragment,
+// since bundle paths are appended to it.
+func ValidateBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("base URL must be an absolute http(s) URL")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("base URL must not contain a query or fragment")
+	}
+	return nil
+}
+
+// ValidateProxy checks that the given string can be used as the proxy through
+// which repositories are fetched (Git's 'http.proxy'): an absolute URL with
+// one of the proxy protocols supported by Git and no path, query, or
+// fragment.
+func ValidateProxy(proxy string) error {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks4", "socks4a", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("proxy must be an absolute URL with a supported protocol " +
+			"('http', 'https', 'socks4', 'socks4a', 'socks5', or 'socks5h')")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy must specify a host")
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("proxy must not contain a path, query, or fragment")
+	}
+	return nil
+}
+
+// RedactProxy returns the proxy with any password replaced, so that it can be
+// displayed.
+func RedactProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return proxy
+	}
+	return u.Redacted()
+}
+
+// RedactURL returns the URL (e.g. the base of a URL rewrite, or a URL it
+// rewrote) with any credentials removed, so that it can be displayed.
+func RedactURL(rawURL string) string {
+	redacted, _ := redactRemoteURL(rawURL)
+	return redacted
+}
+
+// ValidateFilter checks that the given string is an object filter supported
+// for filtered (partial clone) bundles: 'blob:none' or 'blob:limit=<n>', where
+// '<n>' is a byte count with an optional 'k', 'm', or 'g' suffix (as accepted
+// by Git).
+func ValidateFilter(filter string) error {
+	if filter == "blob:none" {
+		return nil
+	}
+
+	limit, ok := strings.CutPrefix(filter, "blob:limit=")
+	if !ok {
+		return fmt.Errorf("unsupported filter (supported filters are: 'blob:none', 'blob:limit=<n>')")
+	}
+
+	if limit != "" && strings.ContainsAny(limit[len(limit)-1:], "kmgKMG") {
+		limit = limit[:len(limit)-1]
+	}
+	_, err := strconv.ParseUint(limit, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size in blob limit")
+	}
+	return nil
+}
+
+// ValidateRefPattern checks that the given string can be used to select the
+// refs of a route's bundles: a full ref name (e.g. 'refs/heads/main') or a
+// pattern with a single '*' (e.g. 'refs/tags/v*'), usable both in a fetch
+// refspec and by 'git for-each-ref'.
+func ValidateRefPattern(pattern string) error {
+	if !strings.HasPrefix(pattern, "refs/") {
+		return fmt.Errorf("ref pattern must start with 'refs/'")
+	}
+	if strings.HasSuffix(pattern, "/") || strings.HasSuffix(pattern, ".lock") ||
+		strings.Contains(pattern, "//") || strings.Contains(pattern, "..") {
+		return fmt.Errorf("invalid ref pattern")
+	}
+	if strings.ContainsAny(pattern, ":^~?[\\ \t\n") {
+		return fmt.Errorf("ref pattern contains an invalid character")
+	}
+	if strings.Count(pattern, "*") > 1 {
+		return fmt.Errorf("ref pattern must contain at most one '*'")
+	}
+	return nil
+}
+
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+// ParseByteSize parses a size in bytes, optionally followed by one of the
+// (binary) unit suffixes 'K', 'M', 'G', or 'T' (e.g. '512M').
+func ParseByteSize(size string) (int64, error) {
+	number := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSuffix(number, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	value, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+	if value > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("size '%s' is too large", size)
+	}
+	return value * multiplier, nil
+}
+
+// FormatByteSize formats a size in bytes using the largest unit suffix
+// accepted by ParseByteSize that represents it exactly.
+func FormatByteSize(size int64) string {
+	for _, unit := range byteSizeUnits {
+		if size != 0 && size%unit.multiplier == 0 {
+			return fmt.Sprintf("%d%s", size/unit.multiplier, unit.suffix)
+		}
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+// FormatApproxByteSize formats a size in bytes for display, rounded to one
+// decimal place of the largest unit suffix not exceeding it (e.g. '1.5G').
+func FormatApproxByteSize(size int64) string {
+	for _, unit := range byteSizeUnits {
+		if size >= unit.multiplier {
+			value := strconv.FormatFloat(float64(size)/float64(unit.multiplier), 'f', 1, 64)
+			return strings.TrimSuffix(value, ".0") + unit.suffix
+		}
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+// RouteSource is a repository to initialize a route from.
+type RouteSource struct {
+	URL   string
+	Route string
+}
+
+// ParseRouteSources parses a list of repositories to initialize routes from.
+// Each line contains the URL of a repository, optionally followed by the route
+// to host it at (by default, the route is derived from the URL). Blank lines
+// and lines starting with '#' are ignored.
+func ParseRouteSources(content io.Reader) ([]RouteSource, error) {
+	sources := []RouteSource{}
+	routes := map[string]int{}
+
+	scanner := bufio.NewScanner(content)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		} else if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected '<url> [<route>]'", lineNum)
+		}
+
+		source := RouteSource{URL: fields[0]}
+		if len(fields) == 2 {
+			source.Route = fields[1]
+		} else {
+			var ok bool
+			source.Route, ok = GetRouteFromUrl(source.URL)
+			if !ok {
+				return nil, fmt.Errorf("line %d: cannot parse route from url '%s'", lineNum, source.URL)
+			}
+		}
+
+		if previous, contains := routes[source.Route]; contains {
+			return nil, fmt.Errorf("line %d: route '%s' is already used on line %d", lineNum, source.Route, previous)
+		}
+		routes[source.Route] = lineNum
+		sources = append(sources, source)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+// ResolveSubmoduleURL resolves the URL of a submodule, as given in the
+// '.gitmodules' of its superproject, against the URL of the superproject.
+// As in Git, a URL starting with './' or '../' is relative to the
+// superproject's URL (so '../other.git' is a sibling of the superproject);
+// other URLs are returned as-is.
+func ResolveSubmoduleURL(superURL string, submoduleURL string) string {
+	if !strings.HasPrefix(submoduleURL, "./") && !strings.HasPrefix(submoduleURL, "../") {
+		return submoduleURL
+	}
+
+	// Resolve the relative URL against the path of the superproject's URL:
+	// the path of a URL with a scheme, the part after the host of an
+	// scp-like URL (e.g. 'git@github.com:org/repo.git'), or a local path.
+	prefix, superPath := "", strings.TrimSuffix(superURL, "/")
+	if scheme, rest, found := strings.Cut(superPath, "://"); found {
+		host, urlPath, _ := strings.Cut(rest, "/")
+		prefix, superPath = scheme+"://"+host+"/", urlPath
+	} else if host, scpPath, found := strings.Cut(superPath, ":"); found && !strings.Contains(host, "/") {
+		prefix, superPath = host+":", scpPath
+	}
+
+	resolved := path.Join(superPath, submoduleURL)
+	if prefix != "" {
+		resolved = strings.TrimPrefix(resolved, "/")
+	}
+	return prefix + resolved
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// The version of the layout of the bundle server's storage written by this
+// version of git-bundle-server, recorded as the version of the route registry.
+// Version 0 is the legacy routes file that predates the registry.
+const CurrentStorageVersion int = registryVersion
+
+// storageMigrations are the steps upgrading the storage layout, indexed by the
+// version each one upgrades from. Each step modifies the registry as read from
+// the previous layout; the registry is written once every step has run.
+var storageMigrations = []struct {
+	description string
+	migrate     func(reg *routeRegistry) error
+}{
+	{
+		// The legacy routes file is read into the registry (see
+		// 'readLegacyRoutes') and removed when the registry is written.
+		description: "convert the legacy routes file into the JSON route registry",
+		migrate:     func(reg *routeRegistry) error { return nil },
+	},
+}
+
+// StorageMigration describes an upgrade of the storage layout by
+// 'MigrateStorage'.
+type StorageMigration struct {
+	// The version of the layout before and after the migration. If they are
+	// the same, the storage was already up-to-date and nothing was done.
+	FromVersion int
+	ToVersion   int
+
+	// The descriptions of the steps of the migration.
+	Steps []string
+
+	// The file to which the registry (or legacy routes file) was copied
+	// before it was migrated.
+	Backup string
+}
+
+// StorageMigrationSteps returns the descriptions of the steps that upgrade the
+// storage layout from 'version' to the current version.
+func StorageMigrationSteps(version int) []string {
+	steps := []string{}
+	for v := version; v >= 0 && v < len(storageMigrations); v++ {
+		steps = append(steps, storageMigrations[v].description)
+	}
+	return steps
+}
+
+// storageVersion reads the version of the storage layout. Storage with neither
+// a registry nor a legacy routes file (e.g. a new bundle server) is up-to-date.
+func (r *repoProvider) storageVersion(user *user.User) (int, error) {
+	lines, err := r.fileSystem.ReadFileLines(r.roots.registryFile(user))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(lines) == 0 {
+		legacyLines, err := r.fileSystem.ReadFileLines(filepath.Join(r.roots.bundleroot(user), legacyRoutesFilename))
+		if err != nil {
+			return 0, err
+		} else if len(legacyLines) > 0 {
+			return 0, nil
+		}
+		return CurrentStorageVersion, nil
+	}
+
+	var header struct {
+		Version int `json:"version"`
+	}
+	err = json.Unmarshal([]byte(strings.Join(lines, "\n")), &header)
+	if err != nil {
+		return 0, fmt.Errorf("invalid route registry: %w", err)
+	}
+	return header.Version, nil
+}
+
+func (r *repoProvider) StorageVersion(ctx context.Context) (int, error) {
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return 0, err
+	}
+	return r.storageVersion(user)
+}
+
+func (r *repoProvider) MigrateStorage(ctx context.Context) (*StorageMigration, error) {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "migrate_storage") //lint:ignore SA4006 keep ctx up-to-date
+	defer exitRegion()
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := r.fileSystem.AcquireFileLock(filepath.Join(r.roots.bundleroot(user), registryLockFilename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock route registry: %w", err)
+	}
+	defer lock.Unlock()
+
+	version, err := r.storageVersion(user)
+	if err != nil {
+		return nil, err
+	}
+
+	migration := &StorageMigration{
+		FromVersion: version,
+		ToVersion:   CurrentStorageVersion,
+		Steps:       StorageMigrationSteps(version),
+	}
+	if version > CurrentStorageVersion {
+		return nil, fmt.Errorf("storage version %d is not supported; "+
+			"it may have been written by a newer version of git-bundle-server", version)
+	} else if version == CurrentStorageVersion {
+		return migration, nil
+	}
+
+	reg, err := r.readRegistry(user)
+	if err != nil {
+		return nil, err
+	}
+
+	// Back up the file holding the routes, so that the migration can be
+	// undone by hand (e.g. to downgrade git-bundle-server).
+	source := r.roots.registryFile(user)
+	if version == 0 {
+		source = filepath.Join(r.roots.bundleroot(user), legacyRoutesFilename)
+	}
+	lines, err := r.fileSystem.ReadFileLines(source)
+	if err != nil {
+		return nil, err
+	}
+	migration.Backup = fmt.Sprintf("%s.v%d.bak", source, version)
+	err = r.fileSystem.WriteFile(migration.Backup, []byte(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up '%s': %w", source, err)
+	}
+
+	for v := version; v < CurrentStorageVersion; v++ {
+		err = storageMigrations[v].migrate(reg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to %s: %w", storageMigrations[v].description, err)
+		}
+	}
+
+	// The registry is replaced atomically, so the storage is either migrated
+	// completely or left as it was.
+	reg.Version = CurrentStorageVersion
+	err = r.writeRegistry(user, reg)
+	if err != nil {
+		return nil, err
+	}
+
+	return migration, nil
+}
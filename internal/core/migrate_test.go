@@ -0,0 +1,127 @@
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var migrateStorageTests = []struct {
+	title string
+
+	// Mocked responses
+	registryFile []string
+	legacyFile   []string // nil if the legacy routes file is not read
+
+	// Expected values
+	expectedFromVersion int
+	expectedBackup      string // empty if nothing is backed up
+	expectedRegistry    string // empty if the registry is not written
+	expectErr           bool
+}{
+	{
+		title:               "legacy routes file migrated to registry",
+		registryFile:        []string{},
+		legacyFile:          []string{"test/route\tevery=1h0m0s", "another/repo"},
+		expectedFromVersion: 0,
+		expectedBackup:      "/my/test/dir/git-bundle-server/routes.v0.bak",
+		expectedRegistry:    `{"version": 1, "routes": {"test/route": {"updateInterval": "1h0m0s"}, "another/repo": {}}}`,
+	},
+	{
+		title:               "current registry left unchanged",
+		registryFile:        []string{`{"version": 1, "routes": {"test/route": {}}}`},
+		expectedFromVersion: 1,
+	},
+	{
+		title:               "new storage without routes is current",
+		registryFile:        []string{},
+		legacyFile:          []string{},
+		expectedFromVersion: 1,
+	},
+	{
+		title:        "newer registry is not supported",
+		registryFile: []string{`{"version": 2, "routes": {}}`},
+		expectErr:    true,
+	},
+}
+
+func TestRepos_MigrateStorage(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	repoProvider := core.NewRepositoryProvider(testLogger, testUserProvider, testFileSystem, nil)
+
+	for _, tt := range migrateStorageTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testFileLock := &MockFileLock{}
+			testFileLock.On("Unlock").Return(nil).Once()
+			testFileSystem.On("AcquireFileLock",
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.lock"),
+			).Return(testFileLock, nil).Once()
+			testFileSystem.On("ReadFileLines",
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.json"),
+			).Return(tt.registryFile, nil)
+			if tt.legacyFile != nil {
+				testFileSystem.On("ReadFileLines",
+					filepath.Clean("/my/test/dir/git-bundle-server/routes"),
+				).Return(tt.legacyFile, nil)
+			}
+
+			var backupBytes []byte
+			if tt.expectedBackup != "" {
+				testFileSystem.On("WriteFile",
+					filepath.Clean(tt.expectedBackup),
+					mock.MatchedBy(func(content []byte) bool {
+						backupBytes = content
+						return true
+					}),
+				).Return(nil).Once()
+			}
+
+			var registryBytes *bytes.Buffer
+			if tt.expectedRegistry != "" {
+				registryBytes = mockRegistryWrite(testFileSystem)
+			}
+
+			migration, err := repoProvider.MigrateStorage(context.Background())
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedFromVersion, migration.FromVersion)
+				assert.Equal(t, core.CurrentStorageVersion, migration.ToVersion)
+				assert.Equal(t, filepath.Clean(tt.expectedBackup), filepath.Clean(migration.Backup))
+			}
+			mock.AssertExpectationsForObjects(t, testUserProvider, testFileSystem, testFileLock)
+
+			if tt.expectedBackup != "" {
+				assert.Equal(t, "test/route\tevery=1h0m0s\nanother/repo\n", string(backupBytes))
+			}
+			if registryBytes != nil {
+				assert.JSONEq(t, tt.expectedRegistry, registryBytes.String())
+			}
+
+			// Reset mocks
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
+
+func TestStorageMigrationSteps(t *testing.T) {
+	// Every version before the current one has a step to upgrade from it.
+	assert.Len(t, core.StorageMigrationSteps(0), core.CurrentStorageVersion)
+	assert.Empty(t, core.StorageMigrationSteps(core.CurrentStorageVersion))
+}
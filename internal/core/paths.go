@@ -1,22 +1,116 @@
 package core
 
 import (
+	"os"
 	"os/user"
 	"path/filepath"
 )
 
-func bundleroot(user *user.User) string {
+// Environment variables overriding the default storage locations of the bundle
+// server. Each should be set to an absolute path.
+const (
+	// The directory containing the bundle server's configuration (e.g. the
+	// route registry) and, unless overridden, its repositories and web
+	// content. Defaults to '~/git-bundle-server'.
+	RootEnvVar string = "GIT_BUNDLE_SERVER_ROOT"
+
+	// The directory containing the bare repository clones. Defaults to
+	// '<root>/git'.
+	RepoRootEnvVar string = "GIT_BUNDLE_SERVER_REPO_ROOT"
+
+	// The directory containing the bundles and bundle lists served by the web
+	// server. Defaults to '<root>/www'.
+	WebRootEnvVar string = "GIT_BUNDLE_SERVER_WEB_ROOT"
+)
+
+// The locations used by a system-level web server daemon (see 'web-server
+// start --system'), which runs as a dedicated service account rather than a
+// login user.
+const (
+	// The default storage root of a system-level installation.
+	SystemRoot string = "/var/lib/git-bundle-server"
+
+	// The directory containing the configuration files of a system-level
+	// installation (e.g. 'web-server.json').
+	SystemConfigDir string = "/etc/git-bundle-server"
+)
+
+// StorageRoots are the directories in which a bundle server stores its data,
+// for processes serving more than one bundle server (e.g. a web server with
+// virtual hosts). Each root that is set overrides the corresponding default
+// (see RootEnvVar, RepoRootEnvVar, and WebRootEnvVar); if 'Root' is set, the
+// repository and web roots default to directories in it. The zero value uses
+// the defaults.
+type StorageRoots struct {
+	Root     string `json:"root"`
+	RepoRoot string `json:"repoRoot,omitempty"`
+	WebRoot  string `json:"webRoot,omitempty"`
+}
+
+func (s StorageRoots) bundleroot(user *user.User) string {
+	if s.Root != "" {
+		return s.Root
+	}
+	if root := os.Getenv(RootEnvVar); root != "" {
+		return root
+	}
 	return filepath.Join(user.HomeDir, "git-bundle-server")
 }
 
-func webroot(user *user.User) string {
-	return filepath.Join(bundleroot(user), "www")
+func (s StorageRoots) webroot(user *user.User) string {
+	if s.WebRoot != "" {
+		return s.WebRoot
+	}
+	if root := os.Getenv(WebRootEnvVar); root != "" && s.Root == "" {
+		return root
+	}
+	return filepath.Join(s.bundleroot(user), "www")
+}
+
+func (s StorageRoots) reporoot(user *user.User) string {
+	if s.RepoRoot != "" {
+		return s.RepoRoot
+	}
+	if root := os.Getenv(RepoRootEnvVar); root != "" && s.Root == "" {
+		return root
+	}
+	return filepath.Join(s.bundleroot(user), "git")
 }
 
-func reporoot(user *user.User) string {
-	return filepath.Join(bundleroot(user), "git")
+// The directory to which the data of routes deleted with 'delete --trash' is
+// moved.
+func (s StorageRoots) trashroot(user *user.User) string {
+	return filepath.Join(s.bundleroot(user), "trash")
+}
+
+// StorageConfigFile returns the path of the bundle storage configuration (see
+// 'bundles.NewBundleStorage') in the root.
+func (s StorageRoots) StorageConfigFile(user *user.User) string {
+	return filepath.Join(s.bundleroot(user), "storage.json")
+}
+
+// WebRoot returns the directory containing the web directories of all routes.
+func WebRoot(user *user.User) string {
+	return StorageRoots{}.webroot(user)
 }
 
 func CrontabFile(user *user.User) string {
-	return filepath.Join(bundleroot(user), "cron-schedule")
+	return filepath.Join(StorageRoots{}.bundleroot(user), "cron-schedule")
+}
+
+func SigningConfigFile(user *user.User) string {
+	return filepath.Join(StorageRoots{}.bundleroot(user), "signing.json")
+}
+
+// JobQueueFile returns the path of the queue of the web server's background
+// updates (see 'jobs.NewJobQueue').
+func JobQueueFile(user *user.User) string {
+	return filepath.Join(StorageRoots{}.bundleroot(user), "jobs.json")
+}
+
+// NotificationConfigFile returns the path of the configuration of the
+// notifications sent about problems with the bundle server (see
+// 'notify.NewNotifier').
+func NotificationConfigFile(user *user.User) string {
+	return filepath.Join(StorageRoots{}.bundleroot(user), "notifications.json")
 }
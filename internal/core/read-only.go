@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReadOnlyMode describes the read-only mode of a bundle server (e.g. during a
+// storage migration), in which its web server keeps serving the existing
+// bundles, but nothing modifies or deletes its data: background updates are
+// paused and the commands that would modify the data refuse to run.
+type ReadOnlyMode struct {
+	// The time at which the read-only mode was turned on.
+	Since time.Time `json:"since"`
+
+	// Why the bundle server is read-only, if given.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ReadOnlyError is the error returned when an operation would modify the data
+// of a bundle server that is in read-only mode.
+type ReadOnlyError struct {
+	Mode ReadOnlyMode
+}
+
+func (e *ReadOnlyError) Error() string {
+	msg := fmt.Sprintf("the bundle server is in read-only mode since %s", e.Mode.Since.Local().Format(time.RFC3339))
+	if e.Mode.Reason != "" {
+		msg += fmt.Sprintf(" (%s)", e.Mode.Reason)
+	}
+	return msg + "; run 'git-bundle-server read-only off' to leave it"
+}
+
+func (r *repoProvider) GetReadOnlyMode(ctx context.Context) (*ReadOnlyMode, error) {
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := r.readRegistry(user)
+	if err != nil {
+		return nil, err
+	}
+	return reg.ReadOnly, nil
+}
+
+func (r *repoProvider) SetReadOnlyMode(ctx context.Context, mode *ReadOnlyMode) error {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "set_read_only_mode") //lint:ignore SA4006 keep ctx up-to-date
+	defer exitRegion()
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return err
+	}
+
+	return r.updateRegistry(user, func(reg *routeRegistry) error {
+		reg.ReadOnly = mode
+		return nil
+	})
+}
@@ -0,0 +1,437 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+)
+
+// The route registry is stored as JSON in 'routes.json' in the bundle server
+// root. The file is only ever replaced with an atomic rename, so readers never
+// see a partially-written registry and do not need to lock it. Writers hold an
+// exclusive advisory lock on 'routes.lock' for the duration of their
+// read-modify-write transaction so that concurrent writers (e.g. 'init' and
+// 'repair routes') don't lose each other's changes.
+const (
+	registryFilename     string = "routes.json"
+	registryLockFilename string = "routes.lock"
+	registryVersion      int    = 1
+
+	// The routes file used before the JSON registry was introduced. If the
+	// JSON registry does not exist, routes are read from this file; it is
+	// removed the first time the registry is written.
+	legacyRoutesFilename string = "routes"
+)
+
+// routeEntry contains the settings and metadata stored in the registry for a
+// single route. New per-route settings should be added here with 'omitempty'
+// so that routes using the default value are stored compactly.
+type routeEntry struct {
+	UpdateInterval      string            `json:"updateInterval,omitempty"`
+	MaintenanceInterval string            `json:"maintenanceInterval,omitempty"`
+	BaseURL             string            `json:"baseUrl,omitempty"`
+	Compaction          *CompactionPolicy `json:"compaction,omitempty"`
+	Retention           *retentionEntry   `json:"retention,omitempty"`
+	Filter              string            `json:"filter,omitempty"`
+	Depth               int               `json:"depth,omitempty"`
+	Refs                []string          `json:"refs,omitempty"`
+	Proxy               string            `json:"proxy,omitempty"`
+	Aliases             []string          `json:"aliases,omitempty"`
+	Disabled            bool              `json:"disabled,omitempty"`
+	NoPrune             bool              `json:"noPrune,omitempty"`
+	Quota               int64             `json:"quota,omitempty"`
+}
+
+// deletedRouteEntry is the registry entry of a route deleted with its data
+// retained, from which the route can be restored.
+type deletedRouteEntry struct {
+	routeEntry
+	DeletedAt time.Time `json:"deletedAt"`
+
+	// Whether the route's data was moved to the trash directory rather than
+	// kept in place.
+	Trashed bool `json:"trashed,omitempty"`
+}
+
+// retentionEntry is the registry representation of a RetentionPolicy. Like
+// the update interval, the maximum age is stored as a duration string.
+type retentionEntry struct {
+	MaxBundles int    `json:"maxBundles,omitempty"`
+	MaxAge     string `json:"maxAge,omitempty"`
+	MaxSize    int64  `json:"maxSize,omitempty"`
+}
+
+func (e *retentionEntry) policy() (RetentionPolicy, error) {
+	policy := RetentionPolicy{
+		MaxBundles: e.MaxBundles,
+		MaxSize:    e.MaxSize,
+	}
+	if e.MaxAge != "" {
+		maxAge, err := time.ParseDuration(e.MaxAge)
+		if err != nil {
+			return RetentionPolicy{}, err
+		}
+		policy.MaxAge = maxAge
+	}
+	return policy, policy.Validate()
+}
+
+func newRetentionEntry(policy RetentionPolicy) *retentionEntry {
+	entry := &retentionEntry{
+		MaxBundles: policy.MaxBundles,
+		MaxSize:    policy.MaxSize,
+	}
+	if policy.MaxAge > 0 {
+		entry.MaxAge = policy.MaxAge.String()
+	}
+	return entry
+}
+
+type routeRegistry struct {
+	Version int `json:"version"`
+
+	// The server-wide base URL of bundle URIs, used by routes that don't
+	// configure their own.
+	BaseURL string `json:"baseUrl,omitempty"`
+
+	// The server-wide proxy used to fetch routes that don't configure their
+	// own.
+	Proxy string `json:"proxy,omitempty"`
+
+	// The server-wide rules rewriting the URLs of the routes' remotes when
+	// they are cloned and fetched (like Git's 'url.<base>.insteadOf').
+	URLRewrites []git.URLRewrite `json:"urlRewrites,omitempty"`
+
+	// The range of the number of elements in routes, if not the default.
+	RouteDepth *RouteDepth `json:"routeDepth,omitempty"`
+
+	// The primary bundle server mirrored by this one, if it is a replica.
+	Primary *ReplicaSource `json:"primary,omitempty"`
+
+	// The read-only mode of the bundle server, if it is on.
+	ReadOnly *ReadOnlyMode `json:"readOnly,omitempty"`
+
+	Routes map[string]routeEntry `json:"routes"`
+
+	// The routes left behind by 'rename', mapped to the routes they were
+	// renamed to. The web server redirects requests for them.
+	Redirects map[string]string `json:"redirects,omitempty"`
+
+	// The routes deleted with their data retained, which can be restored.
+	Deleted map[string]deletedRouteEntry `json:"deleted,omitempty"`
+
+	// The storage roots in which the registry's repositories are stored.
+	roots StorageRoots
+}
+
+func (s StorageRoots) registryFile(user *user.User) string {
+	return filepath.Join(s.bundleroot(user), registryFilename)
+}
+
+// routeDepth returns the route depth configured in the registry, or the
+// default.
+func (reg *routeRegistry) routeDepth() RouteDepth {
+	if reg.RouteDepth == nil {
+		return DefaultRouteDepth
+	}
+	return *reg.RouteDepth
+}
+
+func newRouteRegistry(roots StorageRoots) *routeRegistry {
+	return &routeRegistry{
+		Version: registryVersion,
+		Routes:  make(map[string]routeEntry),
+		roots:   roots,
+	}
+}
+
+// repository converts the registry entry of a route into a Repository,
+// validating its settings.
+func (reg *routeRegistry) repository(user *user.User, route string, entry routeEntry) (Repository, error) {
+	updateInterval := time.Duration(0)
+	if entry.UpdateInterval != "" {
+		interval, err := time.ParseDuration(entry.UpdateInterval)
+		if err != nil {
+			return Repository{}, fmt.Errorf("invalid update interval for route '%s': %w", route, err)
+		}
+		updateInterval = interval
+	}
+
+	maintenanceInterval, err := parseMaintenanceInterval(entry.MaintenanceInterval)
+	if err != nil {
+		return Repository{}, fmt.Errorf("invalid maintenance interval for route '%s': %w", route, err)
+	}
+
+	compaction := CompactionPolicy{}
+	if entry.Compaction != nil {
+		compaction = *entry.Compaction
+		err := compaction.Validate()
+		if err != nil {
+			return Repository{}, fmt.Errorf("invalid compaction policy for route '%s': %w", route, err)
+		}
+	}
+
+	retention := RetentionPolicy{}
+	if entry.Retention != nil {
+		var err error
+		retention, err = entry.Retention.policy()
+		if err != nil {
+			return Repository{}, fmt.Errorf("invalid retention policy for route '%s': %w", route, err)
+		}
+	}
+
+	if entry.Filter != "" {
+		err := ValidateFilter(entry.Filter)
+		if err != nil {
+			return Repository{}, fmt.Errorf("invalid filter for route '%s': %w", route, err)
+		}
+	}
+
+	if entry.Depth < 0 {
+		return Repository{}, fmt.Errorf("invalid depth for route '%s': depth must not be negative", route)
+	}
+
+	for _, pattern := range entry.Refs {
+		err := ValidateRefPattern(pattern)
+		if err != nil {
+			return Repository{}, fmt.Errorf("invalid ref pattern '%s' for route '%s': %w", pattern, route, err)
+		}
+	}
+
+	if entry.Proxy != "" {
+		err := ValidateProxy(entry.Proxy)
+		if err != nil {
+			return Repository{}, fmt.Errorf("invalid proxy for route '%s': %w", route, err)
+		}
+	}
+
+	if entry.Quota < 0 {
+		return Repository{}, fmt.Errorf("invalid quota for route '%s': quota must not be negative", route)
+	}
+
+	for _, alias := range entry.Aliases {
+		err := ValidateRoute(alias, reg.routeDepth())
+		if err != nil {
+			return Repository{}, fmt.Errorf("invalid alias '%s' for route '%s': %w", alias, route, err)
+		}
+	}
+
+	return Repository{
+		Route:               route,
+		RepoDir:             filepath.Join(reg.roots.reporoot(user), route),
+		WebDir:              filepath.Join(reg.roots.webroot(user), route),
+		UpdateInterval:      updateInterval,
+		MaintenanceInterval: maintenanceInterval,
+		BaseURL:             entry.BaseURL,
+		ServerBaseURL:       reg.BaseURL,
+		Compaction:          compaction,
+		Retention:           retention,
+		Filter:              entry.Filter,
+		Depth:               entry.Depth,
+		Refs:                entry.Refs,
+		Proxy:               entry.Proxy,
+		ServerProxy:         reg.Proxy,
+		ServerURLRewrites:   reg.URLRewrites,
+		Aliases:             entry.Aliases,
+		Disabled:            entry.Disabled,
+		NoPrune:             entry.NoPrune,
+		Quota:               entry.Quota,
+	}, nil
+}
+
+// deletedRepository converts the registry entry of a deleted route into a
+// DeletedRepository.
+func (reg *routeRegistry) deletedRepository(user *user.User, route string, entry deletedRouteEntry) (DeletedRepository, error) {
+	repo, err := reg.repository(user, route, entry.routeEntry)
+	if err != nil {
+		return DeletedRepository{}, err
+	}
+	if entry.Trashed {
+		repo.RepoDir = filepath.Join(reg.roots.trashroot(user), route, "git")
+		repo.WebDir = filepath.Join(reg.roots.trashroot(user), route, "www")
+	}
+	return DeletedRepository{Repository: repo, DeletedAt: entry.DeletedAt, Trashed: entry.Trashed}, nil
+}
+
+func (reg *routeRegistry) repositories(user *user.User) (map[string]Repository, error) {
+	repos := make(map[string]Repository)
+	for route, entry := range reg.Routes {
+		repo, err := reg.repository(user, route, entry)
+		if err != nil {
+			return nil, err
+		}
+		repos[route] = repo
+	}
+	return repos, nil
+}
+
+// The registry value of the MaintenanceDisabled maintenance interval.
+const maintenanceNever string = "never"
+
+func parseMaintenanceInterval(value string) (time.Duration, error) {
+	switch value {
+	case "":
+		return 0, nil
+	case maintenanceNever:
+		return MaintenanceDisabled, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	} else if interval <= 0 {
+		return 0, fmt.Errorf("interval must be positive")
+	}
+	return interval, nil
+}
+
+func formatMaintenanceInterval(interval time.Duration) string {
+	switch {
+	case interval == MaintenanceDisabled:
+		return maintenanceNever
+	case interval > 0:
+		return interval.String()
+	default:
+		return ""
+	}
+}
+
+// newRouteEntry converts a Repository into its registry entry.
+func newRouteEntry(repo Repository) routeEntry {
+	entry := routeEntry{BaseURL: repo.BaseURL, Filter: repo.Filter, Depth: repo.Depth, Refs: repo.Refs, Proxy: repo.Proxy, Aliases: repo.Aliases, Disabled: repo.Disabled, NoPrune: repo.NoPrune, Quota: repo.Quota}
+	if repo.UpdateInterval > 0 {
+		entry.UpdateInterval = repo.UpdateInterval.String()
+	}
+	entry.MaintenanceInterval = formatMaintenanceInterval(repo.MaintenanceInterval)
+	if !repo.Compaction.IsDefault() {
+		compaction := repo.Compaction
+		entry.Compaction = &compaction
+	}
+	if !repo.Retention.IsDefault() {
+		entry.Retention = newRetentionEntry(repo.Retention)
+	}
+	return entry
+}
+
+func (reg *routeRegistry) setRepositories(repos map[string]Repository) {
+	reg.Routes = make(map[string]routeEntry)
+	for route, repo := range repos {
+		reg.Routes[route] = newRouteEntry(repo)
+	}
+
+	// Drop the redirects of routes that are served again (as a route or an
+	// alias) and those to routes that no longer exist.
+	for oldRoute, newRoute := range reg.Redirects {
+		_, isServed := FindRepository(repos, oldRoute)
+		_, targetExists := repos[newRoute]
+		if isServed || !targetExists {
+			delete(reg.Redirects, oldRoute)
+		}
+	}
+
+	// A route registered again (e.g. with 'init') takes over the data kept
+	// in place by its deletion.
+	for route, deleted := range reg.Deleted {
+		if _, isRegistered := repos[route]; isRegistered && !deleted.Trashed {
+			delete(reg.Deleted, route)
+		}
+	}
+}
+
+// Legacy routes file entries are formatted as '<route>[\t<key>=<value>...]'.
+// Tabs are used as a separator because routes may contain spaces.
+const legacyRouteSettingUpdateInterval string = "every"
+
+func parseLegacyRouteEntry(line string) (string, routeEntry, error) {
+	fields := strings.Split(line, "\t")
+	route := fields[0]
+	entry := routeEntry{}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return "", routeEntry{}, fmt.Errorf("malformed setting '%s' for route '%s'", field, route)
+		}
+
+		switch key {
+		case legacyRouteSettingUpdateInterval:
+			entry.UpdateInterval = value
+		default:
+			// Ignore unknown settings for forward compatibility
+		}
+	}
+	return route, entry, nil
+}
+
+func (r *repoProvider) readLegacyRoutes(user *user.User) (*routeRegistry, error) {
+	lines, err := r.fileSystem.ReadFileLines(filepath.Join(r.roots.bundleroot(user), legacyRoutesFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	reg := newRouteRegistry(r.roots)
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		route, entry, err := parseLegacyRouteEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		reg.Routes[route] = entry
+	}
+	return reg, nil
+}
+
+// readRegistry reads the route registry, falling back on the legacy routes
+// file if the registry has not yet been created.
+func (r *repoProvider) readRegistry(user *user.User) (*routeRegistry, error) {
+	lines, err := r.fileSystem.ReadFileLines(r.roots.registryFile(user))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return r.readLegacyRoutes(user)
+	}
+
+	reg := newRouteRegistry(r.roots)
+	err = json.Unmarshal([]byte(strings.Join(lines, "\n")), reg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route registry: %w", err)
+	}
+	if reg.Routes == nil {
+		reg.Routes = make(map[string]routeEntry)
+	}
+	return reg, nil
+}
+
+func (r *repoProvider) writeRegistry(user *user.User, reg *routeRegistry) error {
+	lockFile, err := r.fileSystem.WriteLockFileFunc(r.roots.registryFile(user), func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reg)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write route registry: %w", err)
+	}
+
+	err = lockFile.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to update route registry: %w", err)
+	}
+
+	// Now that the registry has been written, the legacy routes file (if it
+	// exists) has been migrated and is no longer needed.
+	_, err = r.fileSystem.DeleteFile(filepath.Join(r.roots.bundleroot(user), legacyRoutesFilename))
+	if err != nil {
+		return fmt.Errorf("failed to remove legacy routes file: %w", err)
+	}
+
+	return nil
+}
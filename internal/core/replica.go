@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"fmt"
+)
+
+// ReplicaSource configures a bundle server as a replica (or standby) of a
+// primary bundle server: instead of fetching its routes from their remotes,
+// it mirrors the routes and bundles of the primary over the primary's HTTP
+// API (see the 'replica' package).
+type ReplicaSource struct {
+	// The base URL of the primary's web server (e.g.
+	// 'https://bundles.example.com').
+	URL string `json:"url"`
+
+	// The file containing the token of the primary's admin API, used to list
+	// its routes. If empty, no token is sent.
+	TokenFile string `json:"tokenFile,omitempty"`
+}
+
+// Validate checks that the primary's URL is an absolute http(s) URL.
+func (s *ReplicaSource) Validate() error {
+	err := ValidateBaseURL(s.URL)
+	if err != nil {
+		return fmt.Errorf("invalid primary URL: %w", err)
+	}
+	return nil
+}
+
+func (r *repoProvider) GetReplicaSource(ctx context.Context) (*ReplicaSource, error) {
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := r.readRegistry(user)
+	if err != nil {
+		return nil, err
+	}
+	return reg.Primary, nil
+}
+
+func (r *repoProvider) SetReplicaSource(ctx context.Context, source *ReplicaSource) error {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "set_replica_source") //lint:ignore SA4006 keep ctx up-to-date
+	defer exitRegion()
+
+	if source != nil {
+		err := source.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return err
+	}
+
+	return r.updateRegistry(user, func(reg *routeRegistry) error {
+		reg.Primary = source
+		return nil
+	})
+}
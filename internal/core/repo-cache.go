@@ -0,0 +1,168 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The minimum time between checks of whether the route registry has changed.
+const routeCacheCheckInterval time.Duration = time.Second
+
+// CachedRepositoryProvider is a RepositoryProvider that keeps the registered
+// routes (and the redirects of renamed routes) in memory, for long-running
+// processes (like the web server) that read them far more often than they
+// change. The cache is invalidated when the route registry is replaced (e.g.
+// by 'init' or 'delete'), which is checked at most once per second, or
+// explicitly with Reload().
+type CachedRepositoryProvider interface {
+	RepositoryProvider
+
+	// Reload discards the cached routes, so that they are read from the
+	// route registry again on next use.
+	Reload()
+}
+
+// registryState identifies a version of the route registry file by its
+// modification time and size. The registry is only ever replaced with an
+// atomic rename, so any change replaces the file (and its modification time).
+type registryState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+type cachedRepoProvider struct {
+	RepositoryProvider
+	logger     log.TraceLogger
+	user       common.UserProvider
+	fileSystem common.FileSystem
+	roots      StorageRoots
+
+	lock      sync.Mutex
+	valid     bool
+	repos     map[string]Repository
+	redirects map[string]string
+	state     registryState
+	lastCheck time.Time
+}
+
+// NewCachedRepositoryProvider caches the routes of 'provider', which stores its
+// data in the given roots (see NewRepositoryProviderWithRoots).
+func NewCachedRepositoryProvider(logger log.TraceLogger,
+	provider RepositoryProvider,
+	roots StorageRoots,
+	u common.UserProvider,
+	fs common.FileSystem,
+) CachedRepositoryProvider {
+	return &cachedRepoProvider{
+		RepositoryProvider: provider,
+		logger:             logger,
+		user:               u,
+		fileSystem:         fs,
+		roots:              roots,
+	}
+}
+
+// registryState returns the current state of the route registry (or, if it
+// has not been created yet, of the legacy routes file).
+func (r *cachedRepoProvider) registryState() (registryState, error) {
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return registryState{}, err
+	}
+
+	for _, filename := range []string{r.roots.registryFile(user), filepath.Join(r.roots.bundleroot(user), legacyRoutesFilename)} {
+		info, err := r.fileSystem.Stat(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return registryState{}, err
+		}
+		return registryState{exists: true, modTime: info.ModTime(), size: info.Size()}, nil
+	}
+	return registryState{}, nil
+}
+
+// refresh reads the routes again if the cache was invalidated or the route
+// registry changed since they were cached. Must be called with the lock held.
+func (r *cachedRepoProvider) refresh(ctx context.Context) error {
+	now := time.Now()
+	if r.valid && now.Sub(r.lastCheck) < routeCacheCheckInterval {
+		return nil
+	}
+
+	state, err := r.registryState()
+	if err != nil {
+		return err
+	}
+	r.lastCheck = now
+	if r.valid && state == r.state {
+		return nil
+	}
+
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "reload_routes")
+	defer exitRegion()
+
+	repos, err := r.RepositoryProvider.GetRepositories(ctx)
+	if err != nil {
+		return err
+	}
+	redirects, err := r.RepositoryProvider.GetRouteRedirects(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.repos = repos
+	r.redirects = redirects
+	r.state = state
+	r.valid = true
+	r.logger.AddToCounter(ctx, "repo", "route_reloads", 1)
+	return nil
+}
+
+func (r *cachedRepoProvider) GetRepositories(ctx context.Context) (map[string]Repository, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err := r.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Return a copy, so that callers modifying the map don't modify the
+	// cache.
+	repos := make(map[string]Repository, len(r.repos))
+	for route, repo := range r.repos {
+		repos[route] = repo
+	}
+	return repos, nil
+}
+
+func (r *cachedRepoProvider) GetRouteRedirects(ctx context.Context) (map[string]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err := r.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	redirects := make(map[string]string, len(r.redirects))
+	for oldRoute, newRoute := range r.redirects {
+		redirects[oldRoute] = newRoute
+	}
+	return redirects, nil
+}
+
+func (r *cachedRepoProvider) Reload() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.valid = false
+}
@@ -0,0 +1,85 @@
+package core_test
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCachedRepos_GetRepositories(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	repoProvider := core.NewCachedRepositoryProvider(testLogger,
+		core.NewRepositoryProvider(testLogger, testUserProvider, testFileSystem, nil),
+		core.StorageRoots{},
+		testUserProvider,
+		testFileSystem,
+	)
+
+	// Any file will do to describe the state of the registry
+	infoFile := filepath.Join(t.TempDir(), "routes.json")
+	assert.Nil(t, os.WriteFile(infoFile, []byte("{}"), 0o644))
+	registryInfo, err := os.Stat(infoFile)
+	assert.Nil(t, err)
+
+	registryFile := filepath.Clean("/my/test/dir/git-bundle-server/routes.json")
+	registry := []string{`{"version": 1, "routes": {"test/repo": {}}, "redirects": {"old/repo": "test/repo"}}`}
+	expectRead := func() {
+		testFileSystem.On("Stat", registryFile).Return(registryInfo, nil).Once()
+		testFileSystem.On("ReadFileLines", registryFile).Return(registry, nil).Twice()
+	}
+
+	t.Run("Routes are read once", func(t *testing.T) {
+		expectRead()
+
+		repos, err := repoProvider.GetRepositories(context.Background())
+		assert.Nil(t, err)
+		assert.Contains(t, repos, "test/repo")
+
+		// Served from the cache
+		repos, err = repoProvider.GetRepositories(context.Background())
+		assert.Nil(t, err)
+		assert.Contains(t, repos, "test/repo")
+		redirects, err := repoProvider.GetRouteRedirects(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"old/repo": "test/repo"}, redirects)
+
+		mock.AssertExpectationsForObjects(t, testFileSystem)
+	})
+
+	t.Run("Returned routes are copies", func(t *testing.T) {
+		repos, err := repoProvider.GetRepositories(context.Background())
+		assert.Nil(t, err)
+		delete(repos, "test/repo")
+
+		repos, err = repoProvider.GetRepositories(context.Background())
+		assert.Nil(t, err)
+		assert.Contains(t, repos, "test/repo")
+	})
+
+	t.Run("Reload reads the routes again", func(t *testing.T) {
+		testFileSystem.Mock = mock.Mock{}
+		expectRead()
+
+		repoProvider.Reload()
+		repos, err := repoProvider.GetRepositories(context.Background())
+		assert.Nil(t, err)
+		assert.Contains(t, repos, "test/repo")
+
+		mock.AssertExpectationsForObjects(t, testFileSystem)
+	})
+}
@@ -2,28 +2,577 @@ package core
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/user"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
 	"github.com/git-ecosystem/git-bundle-server/internal/git"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/utils"
 )
 
+// The interval at which a route is updated if no custom update interval is
+// configured.
+const DefaultUpdateInterval time.Duration = 24 * time.Hour
+
+// The interval at which maintenance (see 'GitHelper.RunMaintenance') is run on
+// a route's repository if no custom maintenance interval is configured.
+const DefaultMaintenanceInterval time.Duration = 7 * 24 * time.Hour
+
+// The maintenance interval of a route that is never maintained automatically.
+const MaintenanceDisabled time.Duration = -1
+
+const (
+	lastUpdateFilename       string = "last-update"
+	lastMaintenanceFilename  string = "last-maintenance"
+	diskUsageFilename        string = "disk-usage.json"
+	lastUpdateResultFilename string = "last-update-result.json"
+	updateProgressFilename   string = "update-progress.json"
+	updateLockFilename       string = "update.lock"
+)
+
+// UpdateResult describes the outcome of the most recent attempt to update a
+// repository.
+type UpdateResult struct {
+	// The time at which the update started.
+	Time time.Time `json:"time"`
+
+	// How long the update took to complete (or fail).
+	Duration time.Duration `json:"duration"`
+
+	// The number of refs created, updated, or deleted by fetching from the
+	// remote.
+	RefsFetched int `json:"refsFetched"`
+
+	// The number of bundles added to the bundle list.
+	BundlesCreated int `json:"bundlesCreated"`
+
+	// The refs whose history was rewritten on the remote (i.e. updated by a
+	// non-fast-forward fetch, e.g. after a force-push), for which the bundle
+	// list was replaced with a new base bundle.
+	RewrittenRefs []string `json:"rewrittenRefs,omitempty"`
+
+	// The error that caused the update to fail; empty if it succeeded.
+	Error string `json:"error,omitempty"`
+
+	// The number of consecutive failed updates, ending with this one; zero if
+	// it succeeded.
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+}
+
+func (u *UpdateResult) Succeeded() bool {
+	return u.Error == ""
+}
+
+// The phases of an update reported in its UpdateProgress.
+const (
+	UpdatePhaseStart       string = "start"
+	UpdatePhaseFetch       string = "fetch"
+	UpdatePhaseBundle      string = "bundle"
+	UpdatePhaseList        string = "list"
+	UpdatePhaseMaintenance string = "maintenance"
+	UpdatePhaseSync        string = "sync"
+)
+
+// UpdateProgress is the progress of an update in progress, recorded by the
+// update as it runs so that operators can tell whether a long update is
+// progressing or hung.
+type UpdateProgress struct {
+	// The time at which the update started, and at which its progress was
+	// last recorded.
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// The phase of the update: 'start', 'fetch' (fetching from the remote),
+	// 'bundle' (creating a bundle), 'list' (writing the bundle list),
+	// 'maintenance', or 'sync' (syncing a replica from its primary).
+	Phase string `json:"phase"`
+
+	// The stage of the phase reported by Git (e.g. 'Receiving objects'), the
+	// percentage of it that is complete (nil if Git reports none), and the
+	// number of bytes transferred (zero if Git reports none).
+	Stage   string `json:"stage,omitempty"`
+	Percent *int   `json:"percent,omitempty"`
+	Bytes   int64  `json:"bytes,omitempty"`
+}
+
+// DiskUsage is the disk space used by a route, as measured at a given time.
+type DiskUsage struct {
+	// The time at which the disk usage was measured.
+	Time time.Time `json:"time"`
+
+	// The size in bytes of the route's repository.
+	RepoBytes int64 `json:"repoBytes"`
+
+	// The size in bytes of the route's web directory (its bundles and bundle
+	// list).
+	WebBytes int64 `json:"webBytes"`
+}
+
+// Total returns the total disk space in bytes used by the route.
+func (u *DiskUsage) Total() int64 {
+	return u.RepoBytes + u.WebBytes
+}
+
+// QuotaExceededError is the error returned when a route uses more disk space
+// than its quota allows.
+type QuotaExceededError struct {
+	Route string
+	Usage int64
+	Quota int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("route '%s' uses %s of disk space, exceeding its quota of %s",
+		e.Route, FormatApproxByteSize(e.Usage), FormatByteSize(e.Quota))
+}
+
+// RouteNotFoundError is the error returned when an operation references a
+// route that is not registered to the bundle server.
+type RouteNotFoundError struct {
+	Route string
+}
+
+func (e *RouteNotFoundError) Error() string {
+	return fmt.Sprintf("route '%s' is not registered", e.Route)
+}
+
+// The bundle compaction strategies.
+const (
+	// Merge the oldest bundles into the base bundle.
+	CompactionStrategyBase string = "base"
+
+	// Merge the incremental bundles of each past week into a single "rollup"
+	// bundle, then merge the oldest bundles into the base bundle if the bundle
+	// list still exceeds the compaction thresholds.
+	CompactionStrategyWeekly string = "weekly"
+)
+
+// The maximum number of bundles in a bundle list if the route does not
+// configure its own.
+const DefaultMaxBundles int = 5
+
+// CompactionPolicy configures when and how the incremental bundles of a route
+// are merged into fewer, larger bundles. The zero value is the default policy.
+type CompactionPolicy struct {
+	// The maximum number of bundles (including the base bundle) in the bundle
+	// list. If zero, DefaultMaxBundles is used.
+	MaxBundles int `json:"maxBundles,omitempty"`
+
+	// The maximum total size in bytes of the incremental bundles (i.e. all
+	// bundles but the base bundle). If zero, the size is not limited.
+	MaxIncrementalSize int64 `json:"maxIncrementalSize,omitempty"`
+
+	// How bundles are merged once a threshold is exceeded; one of the
+	// 'CompactionStrategy*' constants. If empty, CompactionStrategyBase is
+	// used.
+	Strategy string `json:"strategy,omitempty"`
+}
+
+// IsDefault returns whether the policy uses the default for all settings.
+func (p CompactionPolicy) IsDefault() bool {
+	return p == CompactionPolicy{}
+}
+
+// EffectiveMaxBundles returns the maximum number of bundles in the bundle
+// list, accounting for the default.
+func (p CompactionPolicy) EffectiveMaxBundles() int {
+	if p.MaxBundles > 0 {
+		return p.MaxBundles
+	}
+	return DefaultMaxBundles
+}
+
+// EffectiveStrategy returns the compaction strategy, accounting for the
+// default.
+func (p CompactionPolicy) EffectiveStrategy() string {
+	if p.Strategy != "" {
+		return p.Strategy
+	}
+	return CompactionStrategyBase
+}
+
+// Validate checks that the policy's settings are in range.
+func (p CompactionPolicy) Validate() error {
+	if p.MaxBundles < 0 {
+		return fmt.Errorf("maximum bundle count must not be negative")
+	}
+	if p.MaxBundles == 1 {
+		// A new incremental bundle must always fit in the list alongside
+		// the base bundle.
+		return fmt.Errorf("maximum bundle count must be at least 2")
+	}
+	if p.MaxIncrementalSize < 0 {
+		return fmt.Errorf("maximum incremental bundle size must not be negative")
+	}
+	switch p.Strategy {
+	case "", CompactionStrategyBase, CompactionStrategyWeekly:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compaction strategy '%s' (valid strategies are: '%s', '%s')",
+			p.Strategy, CompactionStrategyBase, CompactionStrategyWeekly)
+	}
+}
+
+// RetentionPolicy limits the bundle files kept in the web directory of a
+// route. A zero limit means that the corresponding property is not limited;
+// the zero value keeps every bundle file.
+type RetentionPolicy struct {
+	// The maximum number of bundle files.
+	MaxBundles int
+
+	// The maximum age of a bundle file (since it was written).
+	MaxAge time.Duration
+
+	// The maximum total size in bytes of the bundle files.
+	MaxSize int64
+}
+
+// IsDefault returns whether the policy uses the default for all settings.
+func (p RetentionPolicy) IsDefault() bool {
+	return p == RetentionPolicy{}
+}
+
+// Validate checks that the policy's settings are in range.
+func (p RetentionPolicy) Validate() error {
+	if p.MaxBundles < 0 {
+		return fmt.Errorf("maximum bundle count must not be negative")
+	}
+	if p.MaxAge < 0 {
+		return fmt.Errorf("maximum age must not be negative")
+	}
+	if p.MaxSize < 0 {
+		return fmt.Errorf("maximum size must not be negative")
+	}
+	return nil
+}
+
 type Repository struct {
 	Route   string
 	RepoDir string
 	WebDir  string
+
+	// The custom interval at which the route should be updated. If zero, the
+	// route is updated on the default schedule.
+	UpdateInterval time.Duration
+
+	// The custom interval at which maintenance is run on the repository when
+	// it is updated. If zero, DefaultMaintenanceInterval is used; if
+	// MaintenanceDisabled, maintenance is only run on demand.
+	MaintenanceInterval time.Duration
+
+	// The base URL (e.g. 'https://bundles.example.com') used to generate
+	// absolute bundle URIs in the route's bundle list. If empty, the
+	// server-wide base URL is used.
+	BaseURL string
+
+	// The server-wide base URL at the time the repository was read from the
+	// route registry. It is not stored with the route; use
+	// 'SetServerBaseURL()' to change it.
+	ServerBaseURL string
+
+	// When and how the route's incremental bundles are merged.
+	Compaction CompactionPolicy
+
+	// Limits on the bundle files kept for the route.
+	Retention RetentionPolicy
+
+	// The object filter (e.g. 'blob:none') applied to the route's bundles, so
+	// that they can be used by partial clones. If empty, bundles contain all
+	// objects. The filter is set when the route is initialized and cannot be
+	// changed, since every bundle of a route must use the same filter.
+	Filter string
+
+	// The maximum number of commits of (first-parent) history of each ref in
+	// the route's base bundles, for repositories too large for a full base
+	// bundle. If zero, base bundles contain the full history. The commits
+	// beyond the depth are prerequisites of the base bundle, so only clients
+	// that already have them can apply it. Incremental bundles build on the
+	// base bundle as usual. Like the filter, the depth is set when the route
+	// is initialized.
+	Depth int
+
+	// The patterns (e.g. 'refs/heads/main', 'refs/tags/v*') of the refs
+	// fetched from the remote and included in the route's bundles. If empty,
+	// all branches are bundled.
+	Refs []string
+
+	// The proxy (e.g. 'http://proxy.example.com:3128') through which the
+	// repository is cloned and fetched. If empty, the server-wide proxy is
+	// used.
+	Proxy string
+
+	// The server-wide proxy at the time the repository was read from the
+	// route registry. It is not stored with the route; use 'SetServerProxy()'
+	// to change it.
+	ServerProxy string
+
+	// The server-wide URL rewrite rules at the time the repository was read
+	// from the route registry, applied when the repository is cloned and
+	// fetched. Use 'SetServerURLRewrites()' to change them.
+	ServerURLRewrites []git.URLRewrite
+
+	// Additional routes (e.g. the same repository under another owner) from
+	// which the web server serves the repository's bundles.
+	Aliases []string
+
+	// Whether the route is disabled: it is not updated by 'update-all' or
+	// the web server, and the web server does not serve its content. Its
+	// settings and data are kept so that it can be enabled again.
+	Disabled bool
+
+	// Whether refs deleted from the remote are kept in the repository (and
+	// in the route's bundles) rather than pruned when the route is updated.
+	NoPrune bool
+
+	// The maximum disk space in bytes used by the route's repository and web
+	// directory. If zero, the disk space is not limited. A route exceeding
+	// its quota is not updated.
+	Quota int64
+}
+
+// DeletedRepository is a route that was deleted with its data retained, and
+// which can be restored with its settings.
+type DeletedRepository struct {
+	Repository
+
+	DeletedAt time.Time
+
+	// Whether the repository's data was moved to the trash directory, in
+	// which case 'RepoDir' and 'WebDir' are the directories in the trash.
+	// Otherwise, the data is kept in place.
+	Trashed bool
+}
+
+// FindRepository returns the repository registered at 'route' or, if there is
+// none, the repository with 'route' as one of its aliases.
+func FindRepository(repos map[string]Repository, route string) (Repository, bool) {
+	if repo, contains := repos[route]; contains {
+		return repo, true
+	}
+	for _, repo := range repos {
+		for _, alias := range repo.Aliases {
+			if alias == route {
+				return repo, true
+			}
+		}
+	}
+	return Repository{}, false
+}
+
+// EffectiveBaseURL returns the base URL of the repository's bundle URIs,
+// accounting for the server-wide default. If empty, bundle URIs are written
+// relative to the bundle list.
+func (r *Repository) EffectiveBaseURL() string {
+	if r.BaseURL != "" {
+		return r.BaseURL
+	}
+	return r.ServerBaseURL
+}
+
+// EffectiveProxy returns the proxy through which the repository is fetched,
+// accounting for the server-wide default. If empty, Git's own configuration
+// (including the 'HTTPS_PROXY' environment variable) applies.
+func (r *Repository) EffectiveProxy() string {
+	if r.Proxy != "" {
+		return r.Proxy
+	}
+	return r.ServerProxy
+}
+
+// RemoteConfig returns the configuration with which the repository is cloned
+// and fetched from its remote.
+func (r *Repository) RemoteConfig() git.RemoteConfig {
+	return git.RemoteConfig{
+		Proxy:       r.EffectiveProxy(),
+		URLRewrites: r.ServerURLRewrites,
+	}
+}
+
+// EffectiveUpdateInterval returns the interval at which the repository should
+// be updated, accounting for the default.
+func (r *Repository) EffectiveUpdateInterval() time.Duration {
+	if r.UpdateInterval > 0 {
+		return r.UpdateInterval
+	}
+	return DefaultUpdateInterval
+}
+
+// Scheduled updates don't start at exactly the same time every run, so allow
+// an update to run slightly early rather than skipping a whole scheduling
+// period.
+const updateDueTolerance time.Duration = time.Minute
+
+// IsUpdateDue returns whether the repository's update interval has elapsed
+// since its last update.
+func (r *Repository) IsUpdateDue(lastUpdate time.Time, now time.Time) bool {
+	return now.Sub(lastUpdate) >= r.EffectiveUpdateInterval()-updateDueTolerance
+}
+
+// EffectiveMaintenanceInterval returns the interval at which maintenance is
+// run on the repository, accounting for the default. If maintenance is
+// disabled, MaintenanceDisabled is returned.
+func (r *Repository) EffectiveMaintenanceInterval() time.Duration {
+	if r.MaintenanceInterval != 0 {
+		return r.MaintenanceInterval
+	}
+	return DefaultMaintenanceInterval
+}
+
+// IsMaintenanceDue returns whether the repository's maintenance interval has
+// elapsed since its last maintenance.
+func (r *Repository) IsMaintenanceDue(lastMaintenance time.Time, now time.Time) bool {
+	interval := r.EffectiveMaintenanceInterval()
+	return interval != MaintenanceDisabled && now.Sub(lastMaintenance) >= interval-updateDueTolerance
 }
 
 type RepositoryProvider interface {
 	CreateRepository(ctx context.Context, route string) (*Repository, error)
 	GetRepositories(ctx context.Context) (map[string]Repository, error)
+
+	// UpdateRoutes modifies the registered routes in a single transaction:
+	// while holding the route registry lock, the current routes are read and
+	// passed to 'updateFunc', which may modify them in place. If 'updateFunc'
+	// returns an error, the registry is left unchanged; otherwise, the
+	// modified routes are written back to the registry.
+	UpdateRoutes(ctx context.Context, updateFunc func(repos map[string]Repository) error) error
+
+	// GetServerBaseURL and SetServerBaseURL get and set the server-wide base
+	// URL of bundle URIs, used by all routes without a base URL of their own.
+	// An empty URL means that bundle URIs are relative.
+	GetServerBaseURL(ctx context.Context) (string, error)
+	SetServerBaseURL(ctx context.Context, baseURL string) error
+
+	// GetServerProxy and SetServerProxy get and set the server-wide proxy
+	// used to fetch every route without a proxy of its own. An empty proxy
+	// means that Git's own configuration applies.
+	GetServerProxy(ctx context.Context) (string, error)
+	SetServerProxy(ctx context.Context, proxy string) error
+
+	// GetServerURLRewrites and SetServerURLRewrites get and set the
+	// server-wide rules rewriting the URLs of the routes' remotes when they
+	// are cloned and fetched. The URLs stored with the routes are unchanged.
+	GetServerURLRewrites(ctx context.Context) ([]git.URLRewrite, error)
+	SetServerURLRewrites(ctx context.Context, rewrites []git.URLRewrite) error
+
+	// GetRouteDepth and SetRouteDepth get and set the range of the number of
+	// elements in the routes of the bundle server (see RouteDepth). The
+	// route depth can only be set if every registered route and alias is
+	// within it.
+	GetRouteDepth(ctx context.Context) (RouteDepth, error)
+	SetRouteDepth(ctx context.Context, depth RouteDepth) error
+
+	// GetReplicaSource and SetReplicaSource get and set the primary bundle
+	// server mirrored by this one. If it is nil, the bundle server is not a
+	// replica, and its routes are fetched from their remotes.
+	GetReplicaSource(ctx context.Context) (*ReplicaSource, error)
+	SetReplicaSource(ctx context.Context, source *ReplicaSource) error
+
+	// GetReadOnlyMode and SetReadOnlyMode get and set the read-only mode of
+	// the bundle server. If it is nil, the read-only mode is off. Honoring it
+	// is up to the callers modifying the bundle server's data.
+	GetReadOnlyMode(ctx context.Context) (*ReadOnlyMode, error)
+	SetReadOnlyMode(ctx context.Context, mode *ReadOnlyMode) error
+
+	// WriteAllRoutes replaces the contents of the route registry with the
+	// given routes (e.g. to rebuild a registry that cannot be read).
 	WriteAllRoutes(ctx context.Context, repos map[string]Repository) error
-	ReadRepositoryStorage(ctx context.Context) (map[string]Repository, error)
+
+	// ReadRepositoryStorage finds the repositories in the repository root
+	// with routes within the given route depth.
+	ReadRepositoryStorage(ctx context.Context, depth RouteDepth) (map[string]Repository, error)
 	RemoveRoute(ctx context.Context, route string) error
+
+	// RenameRoute moves the registration of 'oldRoute', including all of its
+	// settings, to 'newRoute' and returns the renamed repository. If
+	// 'redirect' is true, the web server redirects requests for 'oldRoute' to
+	// 'newRoute'. The repository's directories are not moved.
+	RenameRoute(ctx context.Context, oldRoute string, newRoute string, redirect bool) (*Repository, error)
+
+	// DeleteRoute unregisters the route, but records it (with its settings)
+	// so that it can be restored with 'RestoreRoute()'. If 'trash' is true,
+	// the directories of the returned repository are those in the trash
+	// directory to which the caller must move the repository's data;
+	// otherwise, the data is kept in place.
+	DeleteRoute(ctx context.Context, route string, trash bool) (*DeletedRepository, error)
+
+	// GetDeletedRoutes returns the routes that can be restored.
+	GetDeletedRoutes(ctx context.Context) (map[string]DeletedRepository, error)
+
+	// RestoreRoute registers a deleted route again with the settings it was
+	// deleted with, and returns the restored repository. If its data was
+	// moved to the trash, the caller must move it back first.
+	RestoreRoute(ctx context.Context, route string) (*Repository, error)
+
+	// GetRouteRedirects returns the redirects left by renamed routes, mapping
+	// each old route to the route it now redirects to.
+	GetRouteRedirects(ctx context.Context) (map[string]string, error)
+
+	// GetLastUpdateTime returns the time at which the repository was last
+	// successfully updated. If it has never been updated, the zero time is
+	// returned.
+	GetLastUpdateTime(ctx context.Context, repo *Repository) (time.Time, error)
+	RecordUpdate(ctx context.Context, repo *Repository, updateTime time.Time) error
+
+	// GetLastUpdateResult returns the outcome of the most recent update
+	// attempt (successful or not). If no update has been attempted, nil is
+	// returned.
+	GetLastUpdateResult(ctx context.Context, repo *Repository) (*UpdateResult, error)
+	RecordUpdateResult(ctx context.Context, repo *Repository, result *UpdateResult) error
+
+	// GetUpdateProgress returns the progress of the update of the repository
+	// in progress, or nil if none is. The progress of an update that was
+	// killed is returned (with an increasingly old 'UpdatedAt') until a later
+	// update completes. ClearUpdateProgress is called once the update is done.
+	GetUpdateProgress(ctx context.Context, repo *Repository) (*UpdateProgress, error)
+	RecordUpdateProgress(ctx context.Context, repo *Repository, progress *UpdateProgress) error
+	ClearUpdateProgress(ctx context.Context, repo *Repository) error
+
+	// GetLastMaintenanceTime returns the time at which maintenance was last
+	// run successfully on the repository. If it has never been run, the zero
+	// time is returned.
+	GetLastMaintenanceTime(ctx context.Context, repo *Repository) (time.Time, error)
+	RecordMaintenance(ctx context.Context, repo *Repository, maintenanceTime time.Time) error
+
+	// MeasureDiskUsage measures the disk space used by the repository and
+	// records the measurement, which is then returned by GetDiskUsage. If the
+	// disk usage has never been measured, GetDiskUsage returns nil.
+	MeasureDiskUsage(ctx context.Context, repo *Repository) (*DiskUsage, error)
+	GetDiskUsage(ctx context.Context, repo *Repository) (*DiskUsage, error)
+
+	// StorageVersion returns the version of the layout of the bundle
+	// server's storage on disk. If it is older than CurrentStorageVersion,
+	// the storage must be upgraded with MigrateStorage.
+	StorageVersion(ctx context.Context) (int, error)
+
+	// MigrateStorage upgrades the layout of the bundle server's storage to
+	// CurrentStorageVersion, first backing up the files it replaces.
+	MigrateStorage(ctx context.Context) (*StorageMigration, error)
+
+	// ExportConfig captures the configuration of the bundle server: its
+	// routes (with their settings and remote URLs), its server-wide
+	// settings, and its other configuration files, without any secrets.
+	ExportConfig(ctx context.Context) (*ServerConfig, error)
+
+	// ImportConfig registers the routes of an exported configuration that
+	// aren't already registered and applies its server-wide settings. Its
+	// configuration files are written to the root unless they already exist
+	// (or if 'overwrite' is true). The caller must clone the repositories of
+	// the routes that were added.
+	ImportConfig(ctx context.Context, config *ServerConfig, overwrite bool) (*ConfigImport, error)
+
+	// LockForUpdate takes the repository's exclusive update lock, which
+	// ensures that only one process fetches into the repository and creates
+	// bundles at a time. If 'wait' is true, it blocks until the lock is
+	// available; otherwise, if another process holds the lock, it returns
+	// 'false' (and no lock) immediately.
+	LockForUpdate(ctx context.Context, repo *Repository, wait bool) (common.FileLock, bool, error)
 }
 
 type repoProvider struct {
@@ -31,18 +580,31 @@ type repoProvider struct {
 	user       common.UserProvider
 	fileSystem common.FileSystem
 	gitHelper  git.GitHelper
+	roots      StorageRoots
 }
 
 func NewRepositoryProvider(logger log.TraceLogger,
 	u common.UserProvider,
 	fs common.FileSystem,
 	g git.GitHelper,
+) RepositoryProvider {
+	return NewRepositoryProviderWithRoots(logger, u, fs, g, StorageRoots{})
+}
+
+// NewRepositoryProviderWithRoots creates a RepositoryProvider for the bundle
+// server storing its data in the given roots, rather than the default ones.
+func NewRepositoryProviderWithRoots(logger log.TraceLogger,
+	u common.UserProvider,
+	fs common.FileSystem,
+	g git.GitHelper,
+	roots StorageRoots,
 ) RepositoryProvider {
 	return &repoProvider{
 		logger:     logger,
 		user:       u,
 		fileSystem: fs,
 		gitHelper:  g,
+		roots:      roots,
 	}
 }
 
@@ -57,7 +619,7 @@ func (r *repoProvider) CreateRepository(ctx context.Context, route string) (*Rep
 
 	repos, err := r.GetRepositories(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse routes file: %w", err)
+		return nil, fmt.Errorf("failed to read route registry: %w", err)
 	}
 
 	repo, contains := repos[route]
@@ -65,25 +627,48 @@ func (r *repoProvider) CreateRepository(ctx context.Context, route string) (*Rep
 		return &repo, nil
 	}
 
-	repodir := filepath.Join(reporoot(user), route)
-	web := filepath.Join(webroot(user), route)
+	depth, err := r.GetRouteDepth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read route registry: %w", err)
+	}
+	err = ValidateRoute(route, depth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route '%s': %w", route, err)
+	}
+	err = ValidateRouteNesting(route, utils.Keys(repos))
+	if err != nil {
+		return nil, err
+	}
 
+	web := filepath.Join(r.roots.webroot(user), route)
 	mkdirErr := os.MkdirAll(web, os.ModePerm)
 	if mkdirErr != nil {
 		return nil, fmt.Errorf("failed to create web directory: %w", mkdirErr)
 	}
 
-	repo = Repository{
-		Route:   route,
-		RepoDir: repodir,
-		WebDir:  web,
-	}
-
-	repos[route] = repo
+	err = r.UpdateRoutes(ctx, func(repos map[string]Repository) error {
+		// The route may have been registered concurrently, in which case
+		// we use the existing registration.
+		existing, contains := repos[route]
+		if contains {
+			repo = existing
+			return nil
+		}
+		err := ValidateRouteNesting(route, utils.Keys(repos))
+		if err != nil {
+			return err
+		}
 
-	err = r.WriteAllRoutes(ctx, repos)
+		repo = Repository{
+			Route:   route,
+			RepoDir: filepath.Join(r.roots.reporoot(user), route),
+			WebDir:  web,
+		}
+		repos[route] = repo
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("warning: failed to write route file")
+		return nil, fmt.Errorf("failed to register route: %w", err)
 	}
 
 	return &repo, nil
@@ -93,38 +678,153 @@ func (r *repoProvider) RemoveRoute(ctx context.Context, route string) error {
 	ctx, exitRegion := r.logger.Region(ctx, "repo", "remove_route")
 	defer exitRegion()
 
-	repos, err := r.GetRepositories(ctx)
+	return r.UpdateRoutes(ctx, func(repos map[string]Repository) error {
+		_, contains := repos[route]
+		if !contains {
+			return &RouteNotFoundError{Route: route}
+		}
+
+		delete(repos, route)
+		return nil
+	})
+}
+
+func (r *repoProvider) RenameRoute(ctx context.Context, oldRoute string, newRoute string, redirect bool) (*Repository, error) {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "rename_route") //lint:ignore SA4006 keep ctx up-to-date
+	defer exitRegion()
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+
+	var repo Repository
+	err = r.updateRegistry(user, func(reg *routeRegistry) error {
+		repos, err := reg.repositories(user)
+		if err != nil {
+			return err
+		}
+
+		var contains bool
+		repo, contains = repos[oldRoute]
+		if !contains {
+			return &RouteNotFoundError{Route: oldRoute}
+		}
+		if _, contains := repos[newRoute]; contains {
+			return fmt.Errorf("route '%s' is already registered", newRoute)
+		}
+		err = ValidateRoute(newRoute, reg.routeDepth())
+		if err != nil {
+			return fmt.Errorf("invalid route '%s': %w", newRoute, err)
+		}
+
+		delete(repos, oldRoute)
+		err = ValidateRouteNesting(newRoute, utils.Keys(repos))
+		if err != nil {
+			return err
+		}
+		repo.Route = newRoute
+		repo.RepoDir = filepath.Join(r.roots.reporoot(user), newRoute)
+		repo.WebDir = filepath.Join(r.roots.webroot(user), newRoute)
+		repos[newRoute] = repo
+
+		if reg.Redirects == nil {
+			reg.Redirects = make(map[string]string)
+		}
+		// Routes that redirected to the old route now redirect to the new
+		// one, so that clients are never redirected more than once.
+		for from, to := range reg.Redirects {
+			if to == oldRoute {
+				reg.Redirects[from] = newRoute
+			}
+		}
+		if redirect {
+			reg.Redirects[oldRoute] = newRoute
+		}
+
+		reg.setRepositories(repos)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to parse routes file: %w", err)
+		return nil, err
 	}
 
-	_, contains := repos[route]
-	if !contains {
-		return fmt.Errorf("route '%s' is not registered", route)
+	return &repo, nil
+}
+
+func (r *repoProvider) DeleteRoute(ctx context.Context, route string, trash bool) (*DeletedRepository, error) {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "delete_route") //lint:ignore SA4006 keep ctx up-to-date
+	defer exitRegion()
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return nil, err
 	}
 
-	delete(repos, route)
+	var deleted DeletedRepository
+	err = r.updateRegistry(user, func(reg *routeRegistry) error {
+		repos, err := reg.repositories(user)
+		if err != nil {
+			return err
+		}
+
+		repo, contains := repos[route]
+		if !contains {
+			return &RouteNotFoundError{Route: route}
+		}
+		if existing, contains := reg.Deleted[route]; contains && existing.Trashed {
+			return fmt.Errorf("a deleted copy of route '%s' is already in the trash", route)
+		}
+
+		delete(repos, route)
+		entry := deletedRouteEntry{
+			routeEntry: newRouteEntry(repo),
+			DeletedAt:  time.Now().UTC(),
+			Trashed:    trash,
+		}
+		if reg.Deleted == nil {
+			reg.Deleted = make(map[string]deletedRouteEntry)
+		}
+		reg.Deleted[route] = entry
+
+		deleted, err = reg.deletedRepository(user, route, entry)
+		if err != nil {
+			return err
+		}
+
+		reg.setRepositories(repos)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	return r.WriteAllRoutes(ctx, repos)
+	return &deleted, nil
 }
 
-func (r *repoProvider) WriteAllRoutes(ctx context.Context, repos map[string]Repository) error {
+func (r *repoProvider) GetDeletedRoutes(ctx context.Context) (map[string]DeletedRepository, error) {
 	user, err := r.user.CurrentUser()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	routefile := filepath.Join(bundleroot(user), "routes")
 
-	contents := ""
-	for routes := range repos {
-		contents = contents + routes + "\n"
+	reg, err := r.readRegistry(user)
+	if err != nil {
+		return nil, err
 	}
 
-	return r.fileSystem.WriteFile(routefile, []byte(contents))
+	deleted := make(map[string]DeletedRepository)
+	for route, entry := range reg.Deleted {
+		deleted[route], err = reg.deletedRepository(user, route, entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return deleted, nil
 }
 
-func (r *repoProvider) GetRepositories(ctx context.Context) (map[string]Repository, error) {
-	ctx, exitRegion := r.logger.Region(ctx, "repo", "get_repos") //lint:ignore SA4006 keep ctx up-to-date
+func (r *repoProvider) RestoreRoute(ctx context.Context, route string) (*Repository, error) {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "restore_route") //lint:ignore SA4006 keep ctx up-to-date
 	defer exitRegion()
 
 	user, err := r.user.CurrentUser()
@@ -132,66 +832,502 @@ func (r *repoProvider) GetRepositories(ctx context.Context) (map[string]Reposito
 		return nil, err
 	}
 
-	repos := make(map[string]Repository)
+	var repo Repository
+	err = r.updateRegistry(user, func(reg *routeRegistry) error {
+		repos, err := reg.repositories(user)
+		if err != nil {
+			return err
+		}
+
+		entry, contains := reg.Deleted[route]
+		if !contains {
+			return fmt.Errorf("route '%s' was not deleted with its data retained", route)
+		}
+		if _, contains := repos[route]; contains {
+			return fmt.Errorf("route '%s' is already registered", route)
+		}
+		err = ValidateRouteNesting(route, utils.Keys(repos))
+		if err != nil {
+			return err
+		}
+
+		repo, err = reg.repository(user, route, entry.routeEntry)
+		if err != nil {
+			return err
+		}
+		repos[route] = repo
+		delete(reg.Deleted, route)
+
+		reg.setRepositories(repos)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	routefile := filepath.Join(bundleroot(user), "routes")
+	return &repo, nil
+}
 
-	lines, err := r.fileSystem.ReadFileLines(routefile)
+func (r *repoProvider) GetRouteRedirects(ctx context.Context) (map[string]string, error) {
+	user, err := r.user.CurrentUser()
 	if err != nil {
 		return nil, err
 	}
-	for _, route := range lines {
-		if route == "" {
-			continue
+
+	reg, err := r.readRegistry(user)
+	if err != nil {
+		return nil, err
+	}
+	if reg.Redirects == nil {
+		return map[string]string{}, nil
+	}
+	return reg.Redirects, nil
+}
+
+// updateRegistry reads, modifies, and writes the route registry while holding
+// the registry lock.
+func (r *repoProvider) updateRegistry(user *user.User, updateFunc func(reg *routeRegistry) error) error {
+	lock, err := r.fileSystem.AcquireFileLock(filepath.Join(r.roots.bundleroot(user), registryLockFilename))
+	if err != nil {
+		return fmt.Errorf("failed to lock route registry: %w", err)
+	}
+	defer lock.Unlock()
+
+	reg, err := r.readRegistry(user)
+	if err != nil {
+		return err
+	}
+	if reg.Version > registryVersion {
+		// Rewriting the registry could drop settings we don't know about.
+		return fmt.Errorf("route registry version %d is not supported; "+
+			"it may have been written by a newer version of git-bundle-server", reg.Version)
+	}
+
+	err = updateFunc(reg)
+	if err != nil {
+		return err
+	}
+
+	reg.Version = registryVersion
+	return r.writeRegistry(user, reg)
+}
+
+func (r *repoProvider) UpdateRoutes(ctx context.Context, updateFunc func(repos map[string]Repository) error) error {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "update_routes") //lint:ignore SA4006 keep ctx up-to-date
+	defer exitRegion()
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return err
+	}
+
+	return r.updateRegistry(user, func(reg *routeRegistry) error {
+		repos, err := reg.repositories(user)
+		if err != nil {
+			return err
 		}
 
-		repo := Repository{
-			Route:   route,
-			RepoDir: filepath.Join(reporoot(user), route),
-			WebDir:  filepath.Join(webroot(user), route),
+		err = updateFunc(repos)
+		if err != nil {
+			return err
 		}
-		repos[route] = repo
+
+		reg.setRepositories(repos)
+		return nil
+	})
+}
+
+func (r *repoProvider) GetServerBaseURL(ctx context.Context) (string, error) {
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return "", err
 	}
 
-	return repos, nil
+	reg, err := r.readRegistry(user)
+	if err != nil {
+		return "", err
+	}
+	return reg.BaseURL, nil
 }
 
-func (r *repoProvider) ReadRepositoryStorage(ctx context.Context) (map[string]Repository, error) {
-	ctx, exitRegion := r.logger.Region(ctx, "repo", "get_on_disk_repos")
+func (r *repoProvider) SetServerBaseURL(ctx context.Context, baseURL string) error {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "set_server_base_url") //lint:ignore SA4006 keep ctx up-to-date
+	defer exitRegion()
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return err
+	}
+
+	return r.updateRegistry(user, func(reg *routeRegistry) error {
+		reg.BaseURL = baseURL
+		return nil
+	})
+}
+
+func (r *repoProvider) GetServerProxy(ctx context.Context) (string, error) {
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return "", err
+	}
+
+	reg, err := r.readRegistry(user)
+	if err != nil {
+		return "", err
+	}
+	return reg.Proxy, nil
+}
+
+func (r *repoProvider) SetServerProxy(ctx context.Context, proxy string) error {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "set_server_proxy") //lint:ignore SA4006 keep ctx up-to-date
 	defer exitRegion()
 
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return err
+	}
+
+	return r.updateRegistry(user, func(reg *routeRegistry) error {
+		reg.Proxy = proxy
+		return nil
+	})
+}
+
+func (r *repoProvider) GetServerURLRewrites(ctx context.Context) ([]git.URLRewrite, error) {
 	user, err := r.user.CurrentUser()
 	if err != nil {
 		return nil, err
 	}
 
-	entries, err := r.fileSystem.ReadDirRecursive(reporoot(user), 2, true)
+	reg, err := r.readRegistry(user)
 	if err != nil {
 		return nil, err
 	}
+	return reg.URLRewrites, nil
+}
 
-	repos := make(map[string]Repository)
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
+func (r *repoProvider) SetServerURLRewrites(ctx context.Context, rewrites []git.URLRewrite) error {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "set_server_url_rewrites") //lint:ignore SA4006 keep ctx up-to-date
+	defer exitRegion()
 
-		_, err = r.gitHelper.GetRemoteUrl(ctx, entry.Path())
+	for _, rewrite := range rewrites {
+		err := rewrite.Validate()
 		if err != nil {
-			continue
+			return fmt.Errorf("invalid URL rewrite of '%s': %w", rewrite.InsteadOf, err)
+		}
+	}
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return err
+	}
+
+	return r.updateRegistry(user, func(reg *routeRegistry) error {
+		reg.URLRewrites = rewrites
+		return nil
+	})
+}
+
+func (r *repoProvider) GetRouteDepth(ctx context.Context) (RouteDepth, error) {
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return RouteDepth{}, err
+	}
+
+	reg, err := r.readRegistry(user)
+	if err != nil {
+		return RouteDepth{}, err
+	}
+	return reg.routeDepth(), nil
+}
+
+func (r *repoProvider) SetRouteDepth(ctx context.Context, depth RouteDepth) error {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "set_route_depth") //lint:ignore SA4006 keep ctx up-to-date
+	defer exitRegion()
+
+	err := depth.Validate()
+	if err != nil {
+		return err
+	}
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return err
+	}
+
+	return r.updateRegistry(user, func(reg *routeRegistry) error {
+		for route, entry := range reg.Routes {
+			if err := ValidateRoute(route, depth); err != nil {
+				return fmt.Errorf("route '%s' is outside of the route depth: %w", route, err)
+			}
+			for _, alias := range entry.Aliases {
+				if err := ValidateRoute(alias, depth); err != nil {
+					return fmt.Errorf("alias '%s' of route '%s' is outside of the route depth: %w", alias, route, err)
+				}
+			}
 		}
 
-		pathElems := strings.Split(entry.Path(), string(os.PathSeparator))
-		if len(pathElems) < 2 {
-			return nil, r.logger.Errorf(ctx, "invalid repo path '%s'", entry.Path())
+		if depth == DefaultRouteDepth {
+			reg.RouteDepth = nil
+		} else {
+			reg.RouteDepth = &depth
 		}
-		route := strings.Join(pathElems[len(pathElems)-2:], "/")
-		repos[route] = Repository{
-			Route:   route,
-			RepoDir: filepath.Join(reporoot(user), route),
-			WebDir:  filepath.Join(webroot(user), route),
+		return nil
+	})
+}
+
+func (r *repoProvider) WriteAllRoutes(ctx context.Context, repos map[string]Repository) error {
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return err
+	}
+
+	lock, err := r.fileSystem.AcquireFileLock(filepath.Join(r.roots.bundleroot(user), registryLockFilename))
+	if err != nil {
+		return fmt.Errorf("failed to lock route registry: %w", err)
+	}
+	defer lock.Unlock()
+
+	reg := newRouteRegistry(r.roots)
+	reg.setRepositories(repos)
+	return r.writeRegistry(user, reg)
+}
+
+func (r *repoProvider) GetRepositories(ctx context.Context) (map[string]Repository, error) {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "get_repos") //lint:ignore SA4006 keep ctx up-to-date
+	defer exitRegion()
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := r.readRegistry(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return reg.repositories(user)
+}
+
+func (r *repoProvider) ReadRepositoryStorage(ctx context.Context, depth RouteDepth) (map[string]Repository, error) {
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "get_on_disk_repos")
+	defer exitRegion()
+
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+
+	// Look for repositories from the shallowest depth to the deepest, so
+	// that the contents of repositories that were already found (e.g.
+	// 'myrepo/objects') are not mistaken for deeper routes.
+	repos := make(map[string]Repository)
+	for d := depth.Min; d <= depth.Max; d++ {
+		entries, err := r.fileSystem.ReadDirRecursive(r.roots.reporoot(user), d, true)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+
+			relPath, err := filepath.Rel(r.roots.reporoot(user), entry.Path())
+			if err != nil {
+				return nil, r.logger.Errorf(ctx, "invalid repo path '%s'", entry.Path())
+			}
+			route := filepath.ToSlash(relPath)
+			if ValidateRouteNesting(route, utils.Keys(repos)) != nil {
+				continue
+			}
+
+			_, err = r.gitHelper.GetRemoteUrl(ctx, entry.Path())
+			if err != nil {
+				continue
+			}
+
+			repos[route] = Repository{
+				Route:   route,
+				RepoDir: filepath.Join(r.roots.reporoot(user), route),
+				WebDir:  filepath.Join(r.roots.webroot(user), route),
+			}
 		}
 	}
 
 	return repos, nil
 }
+
+// readTime reads the time (described by 'what', e.g. "last update time")
+// recorded with 'writeTime()' in the given file of the repository. If the file
+// doesn't exist, the zero time is returned.
+func (r *repoProvider) readTime(repo *Repository, filename string, what string) (time.Time, error) {
+	lines, err := r.fileSystem.ReadFileLines(filepath.Join(repo.RepoDir, filename))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(lines) == 0 {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(lines[0]))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %w", what, err)
+	}
+	return t, nil
+}
+
+func (r *repoProvider) writeTime(repo *Repository, filename string, t time.Time) error {
+	return r.fileSystem.WriteFile(
+		filepath.Join(repo.RepoDir, filename),
+		[]byte(t.UTC().Format(time.RFC3339)+"\n"),
+	)
+}
+
+func (r *repoProvider) GetLastUpdateTime(ctx context.Context, repo *Repository) (time.Time, error) {
+	return r.readTime(repo, lastUpdateFilename, "last update time")
+}
+
+func (r *repoProvider) RecordUpdate(ctx context.Context, repo *Repository, updateTime time.Time) error {
+	return r.writeTime(repo, lastUpdateFilename, updateTime)
+}
+
+func (r *repoProvider) GetLastMaintenanceTime(ctx context.Context, repo *Repository) (time.Time, error) {
+	return r.readTime(repo, lastMaintenanceFilename, "last maintenance time")
+}
+
+func (r *repoProvider) RecordMaintenance(ctx context.Context, repo *Repository, maintenanceTime time.Time) error {
+	return r.writeTime(repo, lastMaintenanceFilename, maintenanceTime)
+}
+
+func (r *repoProvider) GetLastUpdateResult(ctx context.Context, repo *Repository) (*UpdateResult, error) {
+	lines, err := r.fileSystem.ReadFileLines(filepath.Join(repo.RepoDir, lastUpdateResultFilename))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	var result UpdateResult
+	err = json.Unmarshal([]byte(strings.Join(lines, "\n")), &result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid last update result: %w", err)
+	}
+	return &result, nil
+}
+
+func (r *repoProvider) RecordUpdateResult(ctx context.Context, repo *Repository, result *UpdateResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to serialize update result: %w", err)
+	}
+
+	return r.fileSystem.WriteFile(
+		filepath.Join(repo.RepoDir, lastUpdateResultFilename),
+		append(data, '\n'),
+	)
+}
+
+func (r *repoProvider) GetUpdateProgress(ctx context.Context, repo *Repository) (*UpdateProgress, error) {
+	lines, err := r.fileSystem.ReadFileLines(filepath.Join(repo.RepoDir, updateProgressFilename))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	var progress UpdateProgress
+	err = json.Unmarshal([]byte(strings.Join(lines, "\n")), &progress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update progress: %w", err)
+	}
+
+	// An update that was killed leaves its progress behind; it is stale once
+	// the result of a later update is recorded.
+	result, err := r.GetLastUpdateResult(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if result != nil && result.Time.After(progress.StartedAt) {
+		return nil, nil
+	}
+	return &progress, nil
+}
+
+func (r *repoProvider) RecordUpdateProgress(ctx context.Context, repo *Repository, progress *UpdateProgress) error {
+	// Replace the file atomically, since it is read while the update runs.
+	lockFile, err := r.fileSystem.WriteLockFileFunc(filepath.Join(repo.RepoDir, updateProgressFilename), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(progress)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write update progress: %w", err)
+	}
+	return lockFile.Commit()
+}
+
+func (r *repoProvider) ClearUpdateProgress(ctx context.Context, repo *Repository) error {
+	_, err := r.fileSystem.DeleteFile(filepath.Join(repo.RepoDir, updateProgressFilename))
+	return err
+}
+
+func (r *repoProvider) MeasureDiskUsage(ctx context.Context, repo *Repository) (*DiskUsage, error) {
+	usage := &DiskUsage{Time: time.Now()}
+
+	var err error
+	usage.RepoBytes, err = r.fileSystem.DirSize(repo.RepoDir)
+	if err != nil {
+		return nil, err
+	}
+	usage.WebBytes, err = r.fileSystem.DirSize(repo.WebDir)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize disk usage: %w", err)
+	}
+	err = r.fileSystem.WriteFile(filepath.Join(repo.RepoDir, diskUsageFilename), append(data, '\n'))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record disk usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+func (r *repoProvider) GetDiskUsage(ctx context.Context, repo *Repository) (*DiskUsage, error) {
+	lines, err := r.fileSystem.ReadFileLines(filepath.Join(repo.RepoDir, diskUsageFilename))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	var usage DiskUsage
+	err = json.Unmarshal([]byte(strings.Join(lines, "\n")), &usage)
+	if err != nil {
+		return nil, fmt.Errorf("invalid disk usage: %w", err)
+	}
+	return &usage, nil
+}
+
+func (r *repoProvider) LockForUpdate(ctx context.Context, repo *Repository, wait bool) (common.FileLock, bool, error) {
+	lockFile := filepath.Join(repo.RepoDir, updateLockFilename)
+	if wait {
+		lock, err := r.fileSystem.AcquireFileLock(lockFile)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to lock repository for update: %w", err)
+		}
+		return lock, true, nil
+	}
+
+	lock, acquired, err := r.fileSystem.TryAcquireFileLock(lockFile)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to lock repository for update: %w", err)
+	}
+	return lock, acquired, nil
+}
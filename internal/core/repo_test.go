@@ -1,17 +1,20 @@
 package core_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"os/user"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
 	"github.com/git-ecosystem/git-bundle-server/internal/core"
 	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
-	"github.com/git-ecosystem/git-bundle-server/internal/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -20,29 +23,47 @@ var getRepositoriesTests = []struct {
 	title string
 
 	// Expected values
-	readFileLines Pair[[]string, error]
+	readRegistryFile Pair[[]string, error]
+	readLegacyFile   []string // nil if the legacy routes file is not read
 
 	// Expected output
 	expectedRepos []core.Repository
 	expectedErr   bool
 }{
 	{
-		"empty file, empty list",
+		"no registry or legacy routes file, empty list",
 		NewPair[[]string, error]([]string{}, nil),
+		[]string{},
 		[]core.Repository{},
 		false,
 	},
 	{
 		"error from filesystem",
 		NewPair([]string{}, errors.New("error")),
+		nil,
 		[]core.Repository{},
 		true,
 	},
+	{
+		"empty registry",
+		NewPair[[]string, error]([]string{
+			`{"version": 1, "routes": {}}`,
+		}, nil),
+		nil,
+		[]core.Repository{},
+		false,
+	},
 	{
 		"one repository",
 		NewPair[[]string, error]([]string{
-			"git/git",
+			`{`,
+			`  "version": 1,`,
+			`  "routes": {`,
+			`    "git/git": {}`,
+			`  }`,
+			`}`,
 		}, nil),
+		nil,
 		[]core.Repository{
 			{
 				Route:   "git/git",
@@ -53,38 +74,246 @@ var getRepositoriesTests = []struct {
 		false,
 	},
 	{
-		"multiple repositories",
+		"multiple repositories with settings",
 		NewPair[[]string, error]([]string{
-			"git/git",
-			"github/github",
-			"org with spaces/repo with spaces",
-			"", // Skips empty lines.
-			"three/deep/repo",
+			`{`,
+			`  "version": 1,`,
+			`  "routes": {`,
+			`    "git/git": {"updateInterval": "15m0s"},`,
+			`    "org with spaces/repo with spaces": {"updateInterval": "2h"},`,
+			`    "three/deep/repo": {},`,
+			`    "future/settings": {"unknown": "value"}`,
+			`  }`,
+			`}`,
+		}, nil),
+		nil,
+		[]core.Repository{
+			{
+				Route:          "git/git",
+				RepoDir:        "/my/test/dir/git-bundle-server/git/git/git",
+				WebDir:         "/my/test/dir/git-bundle-server/www/git/git",
+				UpdateInterval: 15 * time.Minute,
+			},
+			{
+				Route:          "org with spaces/repo with spaces",
+				RepoDir:        "/my/test/dir/git-bundle-server/git/org with spaces/repo with spaces",
+				WebDir:         "/my/test/dir/git-bundle-server/www/org with spaces/repo with spaces",
+				UpdateInterval: 2 * time.Hour,
+			},
+			{
+				Route:   "three/deep/repo",
+				RepoDir: "/my/test/dir/git-bundle-server/git/three/deep/repo",
+				WebDir:  "/my/test/dir/git-bundle-server/www/three/deep/repo",
+			},
+			{
+				Route:   "future/settings",
+				RepoDir: "/my/test/dir/git-bundle-server/git/future/settings",
+				WebDir:  "/my/test/dir/git-bundle-server/www/future/settings",
+			},
+		},
+		false,
+	},
+	{
+		"base URLs",
+		NewPair[[]string, error]([]string{
+			`{`,
+			`  "version": 1,`,
+			`  "baseUrl": "https://bundles.example.com",`,
+			`  "routes": {`,
+			`    "git/git": {"baseUrl": "https://cdn.example.com/git"},`,
+			`    "another/repo": {}`,
+			`  }`,
+			`}`,
+		}, nil),
+		nil,
+		[]core.Repository{
+			{
+				Route:         "git/git",
+				RepoDir:       "/my/test/dir/git-bundle-server/git/git/git",
+				WebDir:        "/my/test/dir/git-bundle-server/www/git/git",
+				BaseURL:       "https://cdn.example.com/git",
+				ServerBaseURL: "https://bundles.example.com",
+			},
+			{
+				Route:         "another/repo",
+				RepoDir:       "/my/test/dir/git-bundle-server/git/another/repo",
+				WebDir:        "/my/test/dir/git-bundle-server/www/another/repo",
+				ServerBaseURL: "https://bundles.example.com",
+			},
+		},
+		false,
+	},
+	{
+		"compaction policy",
+		NewPair[[]string, error]([]string{
+			`{"version": 1, "routes": {"git/git": {"compaction": {"maxBundles": 10, "maxIncrementalSize": 1048576, "strategy": "weekly"}}}}`,
 		}, nil),
+		nil,
 		[]core.Repository{
 			{
 				Route:   "git/git",
 				RepoDir: "/my/test/dir/git-bundle-server/git/git/git",
 				WebDir:  "/my/test/dir/git-bundle-server/www/git/git",
+				Compaction: core.CompactionPolicy{
+					MaxBundles:         10,
+					MaxIncrementalSize: 1 << 20,
+					Strategy:           core.CompactionStrategyWeekly,
+				},
 			},
+		},
+		false,
+	},
+	{
+		"invalid setting",
+		NewPair[[]string, error]([]string{
+			`{"version": 1, "routes": {"git/git": {"updateInterval": "often"}}}`,
+		}, nil),
+		nil,
+		[]core.Repository{},
+		true,
+	},
+	{
+		"maintenance intervals",
+		NewPair[[]string, error]([]string{
+			`{"version": 1, "routes": {"git/git": {"maintenanceInterval": "72h"}, "another/repo": {"maintenanceInterval": "never"}}}`,
+		}, nil),
+		nil,
+		[]core.Repository{
 			{
-				Route:   "github/github",
-				RepoDir: "/my/test/dir/git-bundle-server/git/github/github",
-				WebDir:  "/my/test/dir/git-bundle-server/www/github/github",
+				Route:               "git/git",
+				RepoDir:             "/my/test/dir/git-bundle-server/git/git/git",
+				WebDir:              "/my/test/dir/git-bundle-server/www/git/git",
+				MaintenanceInterval: 72 * time.Hour,
 			},
 			{
-				Route:   "org with spaces/repo with spaces",
-				RepoDir: "/my/test/dir/git-bundle-server/git/org with spaces/repo with spaces",
-				WebDir:  "/my/test/dir/git-bundle-server/www/org with spaces/repo with spaces",
+				Route:               "another/repo",
+				RepoDir:             "/my/test/dir/git-bundle-server/git/another/repo",
+				WebDir:              "/my/test/dir/git-bundle-server/www/another/repo",
+				MaintenanceInterval: core.MaintenanceDisabled,
 			},
+		},
+		false,
+	},
+	{
+		"invalid maintenance interval",
+		NewPair[[]string, error]([]string{
+			`{"version": 1, "routes": {"git/git": {"maintenanceInterval": "-1h"}}}`,
+		}, nil),
+		nil,
+		[]core.Repository{},
+		true,
+	},
+	{
+		"retention policy",
+		NewPair[[]string, error]([]string{
+			`{"version": 1, "routes": {"git/git": {"retention": {"maxBundles": 20, "maxAge": "720h", "maxSize": 1073741824}}}}`,
+		}, nil),
+		nil,
+		[]core.Repository{
 			{
-				Route:   "three/deep/repo",
-				RepoDir: "/my/test/dir/git-bundle-server/git/three/deep/repo",
-				WebDir:  "/my/test/dir/git-bundle-server/www/three/deep/repo",
+				Route:   "git/git",
+				RepoDir: "/my/test/dir/git-bundle-server/git/git/git",
+				WebDir:  "/my/test/dir/git-bundle-server/www/git/git",
+				Retention: core.RetentionPolicy{
+					MaxBundles: 20,
+					MaxAge:     30 * 24 * time.Hour,
+					MaxSize:    1 << 30,
+				},
+			},
+		},
+		false,
+	},
+	{
+		"invalid retention policy",
+		NewPair[[]string, error]([]string{
+			`{"version": 1, "routes": {"git/git": {"retention": {"maxAge": "a month"}}}}`,
+		}, nil),
+		nil,
+		[]core.Repository{},
+		true,
+	},
+	{
+		"object filter",
+		NewPair[[]string, error]([]string{
+			`{"version": 1, "routes": {"git/git": {"filter": "blob:limit=1m"}}}`,
+		}, nil),
+		nil,
+		[]core.Repository{
+			{
+				Route:   "git/git",
+				RepoDir: "/my/test/dir/git-bundle-server/git/git/git",
+				WebDir:  "/my/test/dir/git-bundle-server/www/git/git",
+				Filter:  "blob:limit=1m",
+			},
+		},
+		false,
+	},
+	{
+		"invalid object filter",
+		NewPair[[]string, error]([]string{
+			`{"version": 1, "routes": {"git/git": {"filter": "tree:0"}}}`,
+		}, nil),
+		nil,
+		[]core.Repository{},
+		true,
+	},
+	{
+		"invalid compaction policy",
+		NewPair[[]string, error]([]string{
+			`{"version": 1, "routes": {"git/git": {"compaction": {"strategy": "monthly"}}}}`,
+		}, nil),
+		nil,
+		[]core.Repository{},
+		true,
+	},
+	{
+		"invalid registry",
+		NewPair[[]string, error]([]string{
+			`git/git`,
+		}, nil),
+		nil,
+		[]core.Repository{},
+		true,
+	},
+	{
+		"legacy routes file",
+		NewPair[[]string, error]([]string{}, nil),
+		[]string{
+			"git/git\tevery=15m0s",
+			"org with spaces/repo with spaces\tevery=2h",
+			"", // Skips empty lines.
+			"future/settings\tunknown=value",
+		},
+		[]core.Repository{
+			{
+				Route:          "git/git",
+				RepoDir:        "/my/test/dir/git-bundle-server/git/git/git",
+				WebDir:         "/my/test/dir/git-bundle-server/www/git/git",
+				UpdateInterval: 15 * time.Minute,
+			},
+			{
+				Route:          "org with spaces/repo with spaces",
+				RepoDir:        "/my/test/dir/git-bundle-server/git/org with spaces/repo with spaces",
+				WebDir:         "/my/test/dir/git-bundle-server/www/org with spaces/repo with spaces",
+				UpdateInterval: 2 * time.Hour,
+			},
+			{
+				Route:   "future/settings",
+				RepoDir: "/my/test/dir/git-bundle-server/git/future/settings",
+				WebDir:  "/my/test/dir/git-bundle-server/www/future/settings",
 			},
 		},
 		false,
 	},
+	{
+		"invalid legacy setting",
+		NewPair[[]string, error]([]string{}, nil),
+		[]string{
+			"git/git\tevery=often",
+		},
+		[]core.Repository{},
+		true,
+	},
 }
 
 func TestRepos_GetRepositories(t *testing.T) {
@@ -102,8 +331,13 @@ func TestRepos_GetRepositories(t *testing.T) {
 	for _, tt := range getRepositoriesTests {
 		t.Run(tt.title, func(t *testing.T) {
 			testFileSystem.On("ReadFileLines",
-				mock.AnythingOfType("string"),
-			).Return(tt.readFileLines.First, tt.readFileLines.Second).Once()
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.json"),
+			).Return(tt.readRegistryFile.First, tt.readRegistryFile.Second).Once()
+			if tt.readLegacyFile != nil {
+				testFileSystem.On("ReadFileLines",
+					filepath.Clean("/my/test/dir/git-bundle-server/routes"),
+				).Return(tt.readLegacyFile, nil).Once()
+			}
 
 			actual, err := repoProvider.GetRepositories(context.Background())
 			mock.AssertExpectationsForObjects(t, testUserProvider, testFileSystem)
@@ -121,8 +355,13 @@ func TestRepos_GetRepositories(t *testing.T) {
 					assert.Equal(t, repo.Route, a.Route)
 					assert.Equal(t, filepath.Clean(repo.RepoDir), a.RepoDir)
 					assert.Equal(t, filepath.Clean(repo.WebDir), a.WebDir)
+					assert.Equal(t, repo.UpdateInterval, a.UpdateInterval)
+					assert.Equal(t, repo.MaintenanceInterval, a.MaintenanceInterval)
 				}
 			}
+
+			// Reset mocks
+			testFileSystem.Mock = mock.Mock{}
 		})
 	}
 }
@@ -130,6 +369,7 @@ func TestRepos_GetRepositories(t *testing.T) {
 var readRepositoryStorageTests = []struct {
 	title string
 
+	depth                 core.RouteDepth
 	foundPaths            Pair[[]Pair[string, bool], error] // list of (path, isDir), error
 	foundRouteIsValidRepo map[string]bool                   // map of route -> whether GetRemoteUrl succeeds
 
@@ -138,6 +378,7 @@ var readRepositoryStorageTests = []struct {
 }{
 	{
 		"no dirs found",
+		core.DefaultRouteDepth,
 		NewPair([]Pair[string, bool]{}, error(nil)),
 		map[string]bool{},
 		[]string{},
@@ -145,6 +386,7 @@ var readRepositoryStorageTests = []struct {
 	},
 	{
 		"multiple valid repos found",
+		core.DefaultRouteDepth,
 		NewPair(
 			[]Pair[string, bool]{
 				NewPair("my/repo", true),
@@ -161,6 +403,7 @@ var readRepositoryStorageTests = []struct {
 	},
 	{
 		"ignores non-directories",
+		core.DefaultRouteDepth,
 		NewPair(
 			[]Pair[string, bool]{
 				NewPair("this-is-a/file", false),
@@ -176,6 +419,7 @@ var readRepositoryStorageTests = []struct {
 	},
 	{
 		"ignores invalid Git repos",
+		core.DefaultRouteDepth,
 		NewPair(
 			[]Pair[string, bool]{
 				NewPair("is/a-repo", true),
@@ -190,6 +434,28 @@ var readRepositoryStorageTests = []struct {
 		[]string{"is/a-repo"},
 		false,
 	},
+	{
+		"finds repos at each route depth",
+		core.RouteDepth{Min: 1, Max: 3},
+		NewPair(
+			[]Pair[string, bool]{
+				NewPair("myrepo", true),
+				NewPair("org", true),
+				NewPair("myrepo/objects", true),
+				NewPair("org/team", true),
+				NewPair("org/team/repo", true),
+			},
+			error(nil),
+		),
+		map[string]bool{
+			"myrepo":        true,
+			"org":           false,
+			"org/team":      false,
+			"org/team/repo": true,
+		},
+		[]string{"myrepo", "org/team/repo"},
+		false,
+	},
 }
 
 func TestRepos_ReadRepositoryStorage(t *testing.T) {
@@ -207,16 +473,22 @@ func TestRepos_ReadRepositoryStorage(t *testing.T) {
 
 	for _, tt := range readRepositoryStorageTests {
 		t.Run(tt.title, func(t *testing.T) {
-			testFileSystem.On("ReadDirRecursive",
-				filepath.Clean("/my/test/dir/git-bundle-server/git"),
-				2,
-				true,
-			).Return(utils.Map(tt.foundPaths.First, func(path Pair[string, bool]) common.ReadDirEntry {
-				return TestReadDirEntry{
-					PathVal:  filepath.Join("/my/test/dir/git-bundle-server/git", path.First),
-					IsDirVal: path.Second,
+			for depth := tt.depth.Min; depth <= tt.depth.Max; depth++ {
+				foundPaths := []common.ReadDirEntry{}
+				for _, path := range tt.foundPaths.First {
+					if len(strings.Split(path.First, "/")) == depth {
+						foundPaths = append(foundPaths, TestReadDirEntry{
+							PathVal:  filepath.Join("/my/test/dir/git-bundle-server/git", path.First),
+							IsDirVal: path.Second,
+						})
+					}
 				}
-			}), tt.foundPaths.Second).Once()
+				testFileSystem.On("ReadDirRecursive",
+					filepath.Clean("/my/test/dir/git-bundle-server/git"),
+					depth,
+					true,
+				).Return(foundPaths, tt.foundPaths.Second).Once()
+			}
 
 			for route, isValid := range tt.foundRouteIsValidRepo {
 				call := testGitHelper.On("GetRemoteUrl",
@@ -231,7 +503,7 @@ func TestRepos_ReadRepositoryStorage(t *testing.T) {
 				}
 			}
 
-			actual, err := repoProvider.ReadRepositoryStorage(context.Background())
+			actual, err := repoProvider.ReadRepositoryStorage(context.Background(), tt.depth)
 			mock.AssertExpectationsForObjects(t, testUserProvider, testFileSystem, testGitHelper)
 
 			if tt.expectedErr {
@@ -258,24 +530,43 @@ func TestRepos_ReadRepositoryStorage(t *testing.T) {
 	}
 }
 
+// mockRegistryWrite sets up the mocks for a successful write of the route
+// registry, returning a pointer to the buffer that will contain the written
+// registry.
+func mockRegistryWrite(testFileSystem *MockFileSystem) *bytes.Buffer {
+	registryBytes := &bytes.Buffer{}
+	testLockFile := &MockLockFile{}
+	testLockFile.On("Commit").Return(nil).Once()
+	testFileSystem.On("WriteLockFileFunc",
+		filepath.Clean("/my/test/dir/git-bundle-server/routes.json"),
+		mock.MatchedBy(func(writeFunc func(io.Writer) error) bool {
+			registryBytes.Reset()
+			return writeFunc(registryBytes) == nil
+		}),
+	).Return(testLockFile, nil).Once()
+	testFileSystem.On("DeleteFile",
+		filepath.Clean("/my/test/dir/git-bundle-server/routes"),
+	).Return(false, nil).Once()
+
+	return registryBytes
+}
+
 var writeAllRoutesTests = []struct {
-	title        string
-	repos        map[string]core.Repository
-	expectedFile []string
+	title            string
+	repos            map[string]core.Repository
+	expectedRegistry string
 }{
 	{
 		"empty repo map",
 		map[string]core.Repository{},
-		[]string{""},
+		`{"version": 1, "routes": {}}`,
 	},
 	{
 		"single repo",
 		map[string]core.Repository{
 			"test/route": {Route: "test/route"},
 		},
-		[]string{
-			"test/route",
-		},
+		`{"version": 1, "routes": {"test/route": {}}}`,
 	},
 	{
 		"multiple repos",
@@ -283,10 +574,15 @@ var writeAllRoutesTests = []struct {
 			"test/route":   {Route: "test/route"},
 			"another/repo": {Route: "another/repo"},
 		},
-		[]string{
-			"test/route",
-			"another/repo",
+		`{"version": 1, "routes": {"test/route": {}, "another/repo": {}}}`,
+	},
+	{
+		"repo with update interval",
+		map[string]core.Repository{
+			"test/route":   {Route: "test/route", UpdateInterval: 30 * time.Minute},
+			"another/repo": {Route: "another/repo"},
 		},
+		`{"version": 1, "routes": {"test/route": {"updateInterval": "30m0s"}, "another/repo": {}}}`,
 	},
 }
 
@@ -304,36 +600,937 @@ func TestRepos_WriteAllRoutes(t *testing.T) {
 
 	for _, tt := range writeAllRoutesTests {
 		t.Run(tt.title, func(t *testing.T) {
-			var actualFilename string
-			var actualFileBytes []byte
-
-			testFileSystem.On("WriteFile",
-				mock.MatchedBy(func(filename string) bool {
-					actualFilename = filename
-					return true
-				}),
-				mock.MatchedBy(func(fileBytes any) bool {
-					// Save off value and always match
-					actualFileBytes = fileBytes.([]byte)
-					return true
-				}),
-			).Return(nil).Once()
+			testFileLock := &MockFileLock{}
+			testFileLock.On("Unlock").Return(nil).Once()
+			testFileSystem.On("AcquireFileLock",
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.lock"),
+			).Return(testFileLock, nil).Once()
+			registryBytes := mockRegistryWrite(testFileSystem)
 
 			err := repoProvider.WriteAllRoutes(context.Background(), tt.repos)
 			assert.Nil(t, err)
-			mock.AssertExpectationsForObjects(t, testUserProvider, testFileSystem)
+			mock.AssertExpectationsForObjects(t, testUserProvider, testFileSystem, testFileLock)
+
+			// Check registry contents
+			assert.JSONEq(t, tt.expectedRegistry, registryBytes.String())
+
+			// Reset mocks
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
+
+var updateRoutesTests = []struct {
+	title string
+
+	// Inputs
+	updateFunc func(repos map[string]core.Repository) error
+
+	// Mocked responses
+	registryFile []string
+	legacyFile   []string // nil if the legacy routes file is not read
+
+	// Expected values
+	expectedRegistry string // empty if the registry is not written
+	expectErr        bool
+}{
+	{
+		"route added to existing registry",
+		func(repos map[string]core.Repository) error {
+			repos["new/route"] = core.Repository{Route: "new/route", UpdateInterval: time.Hour}
+			return nil
+		},
+		[]string{`{"version": 1, "routes": {"test/route": {"updateInterval": "30m0s"}}}`},
+		nil,
+		`{"version": 1, "routes": {"test/route": {"updateInterval": "30m0s"}, "new/route": {"updateInterval": "1h0m0s"}}}`,
+		false,
+	},
+	{
+		"route removed from existing registry",
+		func(repos map[string]core.Repository) error {
+			delete(repos, "test/route")
+			return nil
+		},
+		[]string{`{"version": 1, "routes": {"test/route": {}, "another/repo": {}}}`},
+		nil,
+		`{"version": 1, "routes": {"another/repo": {}}}`,
+		false,
+	},
+	{
+		"route base URL set; server base URL preserved",
+		func(repos map[string]core.Repository) error {
+			repo := repos["test/route"]
+			repo.BaseURL = "https://cdn.example.com"
+			repos["test/route"] = repo
+			return nil
+		},
+		[]string{`{"version": 1, "baseUrl": "https://bundles.example.com", "routes": {"test/route": {}}}`},
+		nil,
+		`{"version": 1, "baseUrl": "https://bundles.example.com", "routes": {"test/route": {"baseUrl": "https://cdn.example.com"}}}`,
+		false,
+	},
+	{
+		"route compaction policy set",
+		func(repos map[string]core.Repository) error {
+			repo := repos["test/route"]
+			repo.Compaction = core.CompactionPolicy{MaxBundles: 10}
+			repos["test/route"] = repo
+			return nil
+		},
+		[]string{`{"version": 1, "routes": {"test/route": {}}}`},
+		nil,
+		`{"version": 1, "routes": {"test/route": {"compaction": {"maxBundles": 10}}}}`,
+		false,
+	},
+	{
+		"route retention policy set",
+		func(repos map[string]core.Repository) error {
+			repo := repos["test/route"]
+			repo.Retention = core.RetentionPolicy{MaxAge: 24 * time.Hour}
+			repos["test/route"] = repo
+			return nil
+		},
+		[]string{`{"version": 1, "routes": {"test/route": {}}}`},
+		nil,
+		`{"version": 1, "routes": {"test/route": {"retention": {"maxAge": "24h0m0s"}}}}`,
+		false,
+	},
+	{
+		"route object filter set",
+		func(repos map[string]core.Repository) error {
+			repo := repos["test/route"]
+			repo.Filter = "blob:none"
+			repos["test/route"] = repo
+			return nil
+		},
+		[]string{`{"version": 1, "routes": {"test/route": {}}}`},
+		nil,
+		`{"version": 1, "routes": {"test/route": {"filter": "blob:none"}}}`,
+		false,
+	},
+	{
+		"redirects to removed routes are dropped",
+		func(repos map[string]core.Repository) error {
+			delete(repos, "test/route")
+			return nil
+		},
+		[]string{`{"version": 1, "routes": {"test/route": {}, "another/repo": {}}, "redirects": {"old/route": "test/route", "old/repo": "another/repo"}}`},
+		nil,
+		`{"version": 1, "routes": {"another/repo": {}}, "redirects": {"old/repo": "another/repo"}}`,
+		false,
+	},
+	{
+		"route aliases set",
+		func(repos map[string]core.Repository) error {
+			repo := repos["test/route"]
+			repo.Aliases = []string{"mirror/route"}
+			repos["test/route"] = repo
+			return nil
+		},
+		[]string{`{"version": 1, "routes": {"test/route": {}}, "redirects": {"mirror/route": "test/route"}}`},
+		nil,
+		`{"version": 1, "routes": {"test/route": {"aliases": ["mirror/route"]}}}`,
+		false,
+	},
+	{
+		"route disabled",
+		func(repos map[string]core.Repository) error {
+			repo := repos["test/route"]
+			repo.Disabled = true
+			repos["test/route"] = repo
+			return nil
+		},
+		[]string{`{"version": 1, "routes": {"test/route": {}}}`},
+		nil,
+		`{"version": 1, "routes": {"test/route": {"disabled": true}}}`,
+		false,
+	},
+	{
+		"route registered again takes over its retained data",
+		func(repos map[string]core.Repository) error {
+			repos["test/route"] = core.Repository{Route: "test/route"}
+			return nil
+		},
+		[]string{`{"version": 1, "routes": {}, "deleted": {"test/route": {"deletedAt": "2023-04-01T12:30:00Z"}, "another/repo": {"deletedAt": "2023-04-01T12:30:00Z"}}}`},
+		nil,
+		`{"version": 1, "routes": {"test/route": {}}, "deleted": {"another/repo": {"deletedAt": "2023-04-01T12:30:00Z"}}}`,
+		false,
+	},
+	{
+		"legacy routes file is migrated",
+		func(repos map[string]core.Repository) error {
+			return nil
+		},
+		[]string{},
+		[]string{"test/route\tevery=30m0s", "another/repo"},
+		`{"version": 1, "routes": {"test/route": {"updateInterval": "30m0s"}, "another/repo": {}}}`,
+		false,
+	},
+	{
+		"error from update function leaves registry unchanged",
+		func(repos map[string]core.Repository) error {
+			return errors.New("route is not registered")
+		},
+		[]string{`{"version": 1, "routes": {"test/route": {}}}`},
+		nil,
+		"",
+		true,
+	},
+	{
+		"registry from newer version is not overwritten",
+		func(repos map[string]core.Repository) error {
+			return nil
+		},
+		[]string{`{"version": 2, "routes": {"test/route": {"newSetting": true}}}`},
+		nil,
+		"",
+		true,
+	},
+}
+
+func TestRepos_UpdateRoutes(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	repoProvider := core.NewRepositoryProvider(testLogger, testUserProvider, testFileSystem, nil)
+
+	for _, tt := range updateRoutesTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testFileLock := &MockFileLock{}
+			testFileLock.On("Unlock").Return(nil).Once()
+			testFileSystem.On("AcquireFileLock",
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.lock"),
+			).Return(testFileLock, nil).Once()
+			testFileSystem.On("ReadFileLines",
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.json"),
+			).Return(tt.registryFile, nil).Once()
+			if tt.legacyFile != nil {
+				testFileSystem.On("ReadFileLines",
+					filepath.Clean("/my/test/dir/git-bundle-server/routes"),
+				).Return(tt.legacyFile, nil).Once()
+			}
 
-			// Check filename
-			expectedFilename := filepath.Clean("/my/test/dir/git-bundle-server/routes")
-			assert.Equal(t, expectedFilename, actualFilename)
+			var registryBytes *bytes.Buffer
+			if tt.expectedRegistry != "" {
+				registryBytes = mockRegistryWrite(testFileSystem)
+			}
 
-			// Check routes file contents
-			fileLines := strings.Split(strings.TrimSpace(string(actualFileBytes)), "\n")
+			err := repoProvider.UpdateRoutes(context.Background(), tt.updateFunc)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			mock.AssertExpectationsForObjects(t, testUserProvider, testFileSystem, testFileLock)
 
-			assert.ElementsMatch(t, tt.expectedFile, fileLines)
+			if registryBytes != nil {
+				assert.JSONEq(t, tt.expectedRegistry, registryBytes.String())
+			}
 
 			// Reset mocks
 			testFileSystem.Mock = mock.Mock{}
 		})
 	}
 }
+
+func TestRepos_FindRepository(t *testing.T) {
+	repos := map[string]core.Repository{
+		"test/route":   {Route: "test/route", Aliases: []string{"mirror/route", "other/name"}},
+		"another/repo": {Route: "another/repo"},
+	}
+
+	repo, contains := core.FindRepository(repos, "test/route")
+	assert.True(t, contains)
+	assert.Equal(t, "test/route", repo.Route)
+
+	repo, contains = core.FindRepository(repos, "other/name")
+	assert.True(t, contains)
+	assert.Equal(t, "test/route", repo.Route)
+
+	_, contains = core.FindRepository(repos, "missing/route")
+	assert.False(t, contains)
+}
+
+var renameRouteTests = []struct {
+	title            string
+	oldRoute         string
+	newRoute         string
+	redirect         bool
+	registryFile     string
+	expectedRegistry string
+	expectErr        bool
+}{
+	{
+		"settings move to the new route",
+		"test/route",
+		"new/route",
+		false,
+		`{"version": 1, "routes": {"test/route": {"filter": "blob:none"}, "another/repo": {}}}`,
+		`{"version": 1, "routes": {"new/route": {"filter": "blob:none"}, "another/repo": {}}}`,
+		false,
+	},
+	{
+		"redirect from the old route",
+		"test/route",
+		"new/route",
+		true,
+		`{"version": 1, "routes": {"test/route": {}}}`,
+		`{"version": 1, "routes": {"new/route": {}}, "redirects": {"test/route": "new/route"}}`,
+		false,
+	},
+	{
+		"existing redirects follow the route",
+		"test/route",
+		"new/route",
+		true,
+		`{"version": 1, "routes": {"test/route": {}}, "redirects": {"first/route": "test/route"}}`,
+		`{"version": 1, "routes": {"new/route": {}}, "redirects": {"first/route": "new/route", "test/route": "new/route"}}`,
+		false,
+	},
+	{
+		"renaming back to a redirected route removes its redirect",
+		"new/route",
+		"test/route",
+		false,
+		`{"version": 1, "routes": {"new/route": {}}, "redirects": {"test/route": "new/route"}}`,
+		`{"version": 1, "routes": {"test/route": {}}}`,
+		false,
+	},
+	{
+		"old route is not registered",
+		"missing/route",
+		"new/route",
+		false,
+		`{"version": 1, "routes": {"test/route": {}}}`,
+		"",
+		true,
+	},
+	{
+		"new route is already registered",
+		"test/route",
+		"another/repo",
+		false,
+		`{"version": 1, "routes": {"test/route": {}, "another/repo": {}}}`,
+		"",
+		true,
+	},
+}
+
+func TestRepos_RenameRoute(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	repoProvider := core.NewRepositoryProvider(testLogger, testUserProvider, testFileSystem, nil)
+
+	for _, tt := range renameRouteTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testFileLock := &MockFileLock{}
+			testFileLock.On("Unlock").Return(nil).Once()
+			testFileSystem.On("AcquireFileLock",
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.lock"),
+			).Return(testFileLock, nil).Once()
+			testFileSystem.On("ReadFileLines",
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.json"),
+			).Return([]string{tt.registryFile}, nil).Once()
+
+			var registryBytes *bytes.Buffer
+			if tt.expectedRegistry != "" {
+				registryBytes = mockRegistryWrite(testFileSystem)
+			}
+
+			repo, err := repoProvider.RenameRoute(context.Background(), tt.oldRoute, tt.newRoute, tt.redirect)
+			mock.AssertExpectationsForObjects(t, testUserProvider, testFileSystem, testFileLock)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.newRoute, repo.Route)
+				assert.Equal(t, filepath.Clean("/my/test/dir/git-bundle-server/git/"+tt.newRoute), repo.RepoDir)
+				assert.Equal(t, filepath.Clean("/my/test/dir/git-bundle-server/www/"+tt.newRoute), repo.WebDir)
+				assert.JSONEq(t, tt.expectedRegistry, registryBytes.String())
+			}
+
+			// Reset mocks
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
+
+var deleteRouteTests = []struct {
+	title           string
+	trash           bool
+	registryFile    string
+	expectedRepoDir string
+	expectedWebDir  string
+	expectErr       bool
+}{
+	{
+		"data kept in place",
+		false,
+		`{"version": 1, "routes": {"test/route": {"filter": "blob:none"}}}`,
+		"/my/test/dir/git-bundle-server/git/test/route",
+		"/my/test/dir/git-bundle-server/www/test/route",
+		false,
+	},
+	{
+		"data moved to the trash",
+		true,
+		`{"version": 1, "routes": {"test/route": {"filter": "blob:none"}}}`,
+		"/my/test/dir/git-bundle-server/trash/test/route/git",
+		"/my/test/dir/git-bundle-server/trash/test/route/www",
+		false,
+	},
+	{
+		"route is not registered",
+		false,
+		`{"version": 1, "routes": {"another/repo": {}}}`,
+		"", "",
+		true,
+	},
+	{
+		"route is already in the trash",
+		true,
+		`{"version": 1, "routes": {"test/route": {}}, "deleted": {"test/route": {"deletedAt": "2023-04-01T12:30:00Z", "trashed": true}}}`,
+		"", "",
+		true,
+	},
+}
+
+func TestRepos_DeleteRoute(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	repoProvider := core.NewRepositoryProvider(testLogger, testUserProvider, testFileSystem, nil)
+
+	for _, tt := range deleteRouteTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testFileLock := &MockFileLock{}
+			testFileLock.On("Unlock").Return(nil).Once()
+			testFileSystem.On("AcquireFileLock",
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.lock"),
+			).Return(testFileLock, nil).Once()
+			testFileSystem.On("ReadFileLines",
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.json"),
+			).Return([]string{tt.registryFile}, nil).Once()
+
+			var registryBytes *bytes.Buffer
+			if !tt.expectErr {
+				registryBytes = mockRegistryWrite(testFileSystem)
+			}
+
+			deleted, err := repoProvider.DeleteRoute(context.Background(), "test/route", tt.trash)
+			mock.AssertExpectationsForObjects(t, testUserProvider, testFileSystem, testFileLock)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, "test/route", deleted.Route)
+				assert.Equal(t, "blob:none", deleted.Filter)
+				assert.Equal(t, tt.trash, deleted.Trashed)
+				assert.Equal(t, filepath.Clean(tt.expectedRepoDir), deleted.RepoDir)
+				assert.Equal(t, filepath.Clean(tt.expectedWebDir), deleted.WebDir)
+
+				// The route is replaced by its deleted entry
+				var registry map[string]any
+				assert.Nil(t, json.Unmarshal(registryBytes.Bytes(), &registry))
+				assert.Empty(t, registry["routes"])
+				deletedEntry := registry["deleted"].(map[string]any)["test/route"].(map[string]any)
+				assert.Equal(t, "blob:none", deletedEntry["filter"])
+				assert.NotEmpty(t, deletedEntry["deletedAt"])
+			}
+
+			// Reset mocks
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
+
+var restoreRouteTests = []struct {
+	title            string
+	registryFile     string
+	expectedRegistry string
+	expectErr        bool
+}{
+	{
+		"settings are restored",
+		`{"version": 1, "routes": {}, "deleted": {"test/route": {"filter": "blob:none", "deletedAt": "2023-04-01T12:30:00Z", "trashed": true}}}`,
+		`{"version": 1, "routes": {"test/route": {"filter": "blob:none"}}}`,
+		false,
+	},
+	{
+		"route was not deleted",
+		`{"version": 1, "routes": {}}`,
+		"",
+		true,
+	},
+	{
+		"route is registered again",
+		`{"version": 1, "routes": {"test/route": {}}, "deleted": {"test/route": {"deletedAt": "2023-04-01T12:30:00Z", "trashed": true}}}`,
+		"",
+		true,
+	},
+}
+
+func TestRepos_RestoreRoute(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	repoProvider := core.NewRepositoryProvider(testLogger, testUserProvider, testFileSystem, nil)
+
+	for _, tt := range restoreRouteTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testFileLock := &MockFileLock{}
+			testFileLock.On("Unlock").Return(nil).Once()
+			testFileSystem.On("AcquireFileLock",
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.lock"),
+			).Return(testFileLock, nil).Once()
+			testFileSystem.On("ReadFileLines",
+				filepath.Clean("/my/test/dir/git-bundle-server/routes.json"),
+			).Return([]string{tt.registryFile}, nil).Once()
+
+			var registryBytes *bytes.Buffer
+			if tt.expectedRegistry != "" {
+				registryBytes = mockRegistryWrite(testFileSystem)
+			}
+
+			repo, err := repoProvider.RestoreRoute(context.Background(), "test/route")
+			mock.AssertExpectationsForObjects(t, testUserProvider, testFileSystem, testFileLock)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, filepath.Clean("/my/test/dir/git-bundle-server/git/test/route"), repo.RepoDir)
+				assert.Equal(t, filepath.Clean("/my/test/dir/git-bundle-server/www/test/route"), repo.WebDir)
+				assert.JSONEq(t, tt.expectedRegistry, registryBytes.String())
+			}
+
+			// Reset mocks
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
+
+func TestRepos_SetServerBaseURL(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	repoProvider := core.NewRepositoryProvider(testLogger, testUserProvider, testFileSystem, nil)
+
+	testFileLock := &MockFileLock{}
+	testFileLock.On("Unlock").Return(nil).Once()
+	testFileSystem.On("AcquireFileLock",
+		filepath.Clean("/my/test/dir/git-bundle-server/routes.lock"),
+	).Return(testFileLock, nil).Once()
+	testFileSystem.On("ReadFileLines",
+		filepath.Clean("/my/test/dir/git-bundle-server/routes.json"),
+	).Return([]string{`{"version": 1, "routes": {"test/route": {"updateInterval": "30m0s"}}}`}, nil).Once()
+	registryBytes := mockRegistryWrite(testFileSystem)
+
+	err := repoProvider.SetServerBaseURL(context.Background(), "https://bundles.example.com")
+	assert.Nil(t, err)
+	mock.AssertExpectationsForObjects(t, testFileSystem, testFileLock)
+	assert.JSONEq(t,
+		`{"version": 1, "baseUrl": "https://bundles.example.com", "routes": {"test/route": {"updateInterval": "30m0s"}}}`,
+		registryBytes.String(),
+	)
+}
+
+func TestRepos_ReadOnlyMode(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	repoProvider := core.NewRepositoryProvider(testLogger, testUserProvider, testFileSystem, nil)
+
+	t.Run("Turning on read-only mode", func(t *testing.T) {
+		testFileLock := &MockFileLock{}
+		testFileLock.On("Unlock").Return(nil).Once()
+		testFileSystem.On("AcquireFileLock",
+			filepath.Clean("/my/test/dir/git-bundle-server/routes.lock"),
+		).Return(testFileLock, nil).Once()
+		testFileSystem.On("ReadFileLines",
+			filepath.Clean("/my/test/dir/git-bundle-server/routes.json"),
+		).Return([]string{`{"version": 1, "routes": {"test/route": {}}}`}, nil).Once()
+		registryBytes := mockRegistryWrite(testFileSystem)
+
+		err := repoProvider.SetReadOnlyMode(context.Background(), &core.ReadOnlyMode{
+			Since:  time.Date(2023, 4, 1, 12, 30, 0, 0, time.UTC),
+			Reason: "storage migration",
+		})
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testFileSystem, testFileLock)
+		assert.JSONEq(t,
+			`{"version": 1, "readOnly": {"since": "2023-04-01T12:30:00Z", "reason": "storage migration"}, "routes": {"test/route": {}}}`,
+			registryBytes.String(),
+		)
+	})
+
+	t.Run("Reading read-only mode", func(t *testing.T) {
+		testFileSystem.On("ReadFileLines",
+			filepath.Clean("/my/test/dir/git-bundle-server/routes.json"),
+		).Return([]string{`{"version": 1, "readOnly": {"since": "2023-04-01T12:30:00Z"}, "routes": {}}`}, nil).Once()
+
+		mode, err := repoProvider.GetReadOnlyMode(context.Background())
+		assert.Nil(t, err)
+		if assert.NotNil(t, mode) {
+			assert.True(t, mode.Since.Equal(time.Date(2023, 4, 1, 12, 30, 0, 0, time.UTC)))
+			assert.Empty(t, mode.Reason)
+		}
+	})
+
+	t.Run("Read-only mode off", func(t *testing.T) {
+		testFileSystem.On("ReadFileLines",
+			filepath.Clean("/my/test/dir/git-bundle-server/routes.json"),
+		).Return([]string{`{"version": 1, "routes": {}}`}, nil).Once()
+
+		mode, err := repoProvider.GetReadOnlyMode(context.Background())
+		assert.Nil(t, err)
+		assert.Nil(t, mode)
+	})
+}
+
+var updateResultTests = []struct {
+	title  string
+	result core.UpdateResult
+}{
+	{
+		"successful update",
+		core.UpdateResult{
+			Time:           time.Date(2023, 4, 1, 12, 30, 0, 0, time.UTC),
+			Duration:       3*time.Second + 250*time.Millisecond,
+			RefsFetched:    2,
+			BundlesCreated: 1,
+		},
+	},
+	{
+		"successful no-op update",
+		core.UpdateResult{
+			Time:     time.Date(2023, 4, 1, 12, 30, 0, 0, time.UTC),
+			Duration: 800 * time.Millisecond,
+		},
+	},
+	{
+		"failed update",
+		core.UpdateResult{
+			Time:     time.Date(2023, 4, 1, 12, 30, 0, 0, time.UTC),
+			Duration: 5 * time.Second,
+			Error:    "failed to fetch latest refs: 'git' exited with status 128",
+		},
+	},
+}
+
+func TestRepos_UpdateResult(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	repoProvider := core.NewRepositoryProvider(testLogger, nil, testFileSystem, nil)
+
+	repo := &core.Repository{
+		Route:   "test/route",
+		RepoDir: "/my/test/dir/git-bundle-server/git/test/route",
+	}
+	resultFile := filepath.Join(repo.RepoDir, "last-update-result.json")
+
+	t.Run("no update attempted", func(t *testing.T) {
+		testFileSystem.On("ReadFileLines", resultFile).Return([]string{}, nil).Once()
+
+		result, err := repoProvider.GetLastUpdateResult(context.Background(), repo)
+		assert.Nil(t, err)
+		assert.Nil(t, result)
+		mock.AssertExpectationsForObjects(t, testFileSystem)
+
+		testFileSystem.Mock = mock.Mock{}
+	})
+
+	for _, tt := range updateResultTests {
+		t.Run(tt.title, func(t *testing.T) {
+			var actualFileBytes []byte
+
+			testFileSystem.On("WriteFile",
+				resultFile,
+				mock.MatchedBy(func(fileBytes any) bool {
+					// Save off value and always match
+					actualFileBytes = fileBytes.([]byte)
+					return true
+				}),
+			).Return(nil).Once()
+
+			// Record the result, then read it back
+			err := repoProvider.RecordUpdateResult(context.Background(), repo, &tt.result)
+			assert.Nil(t, err)
+
+			testFileSystem.On("ReadFileLines", resultFile).Return(
+				strings.Split(strings.TrimSpace(string(actualFileBytes)), "\n"), nil,
+			).Once()
+
+			result, err := repoProvider.GetLastUpdateResult(context.Background(), repo)
+			assert.Nil(t, err)
+			if assert.NotNil(t, result) {
+				assert.True(t, tt.result.Time.Equal(result.Time))
+				assert.Equal(t, tt.result.Duration, result.Duration)
+				assert.Equal(t, tt.result.RefsFetched, result.RefsFetched)
+				assert.Equal(t, tt.result.BundlesCreated, result.BundlesCreated)
+				assert.Equal(t, tt.result.Error, result.Error)
+				assert.Equal(t, tt.result.Error == "", result.Succeeded())
+			}
+			mock.AssertExpectationsForObjects(t, testFileSystem)
+
+			// Reset mocks
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
+
+func TestRepos_UpdateProgress(t *testing.T) {
+	ctx := context.Background()
+	repoProvider := core.NewRepositoryProvider(&MockTraceLogger{}, nil, common.NewFileSystem(), nil)
+	repo := &core.Repository{Route: "test/route", RepoDir: t.TempDir()}
+
+	startTime := time.Now().Truncate(time.Second)
+	percent := 45
+	recorded := &core.UpdateProgress{
+		StartedAt: startTime,
+		UpdatedAt: startTime.Add(time.Minute),
+		Phase:     core.UpdatePhaseFetch,
+		Stage:     "Receiving objects",
+		Percent:   &percent,
+		Bytes:     1 << 20,
+	}
+
+	progress, err := repoProvider.GetUpdateProgress(ctx, repo)
+	assert.Nil(t, err)
+	assert.Nil(t, progress)
+
+	t.Run("Recorded progress is read back", func(t *testing.T) {
+		assert.Nil(t, repoProvider.RecordUpdateProgress(ctx, repo, recorded))
+
+		progress, err := repoProvider.GetUpdateProgress(ctx, repo)
+		assert.Nil(t, err)
+		if assert.NotNil(t, progress) {
+			assert.True(t, startTime.Equal(progress.StartedAt))
+			assert.Equal(t, "Receiving objects", progress.Stage)
+			assert.Equal(t, &percent, progress.Percent)
+			assert.Equal(t, int64(1<<20), progress.Bytes)
+		}
+	})
+
+	t.Run("Progress of the update being recorded is still current", func(t *testing.T) {
+		// e.g. while maintenance runs after the update's result is recorded
+		assert.Nil(t, repoProvider.RecordUpdateResult(ctx, repo, &core.UpdateResult{Time: startTime}))
+
+		progress, err := repoProvider.GetUpdateProgress(ctx, repo)
+		assert.Nil(t, err)
+		assert.NotNil(t, progress)
+	})
+
+	t.Run("Progress left by a killed update is stale after a later update", func(t *testing.T) {
+		assert.Nil(t, repoProvider.RecordUpdateResult(ctx, repo, &core.UpdateResult{Time: startTime.Add(time.Hour)}))
+
+		progress, err := repoProvider.GetUpdateProgress(ctx, repo)
+		assert.Nil(t, err)
+		assert.Nil(t, progress)
+	})
+
+	t.Run("Cleared progress", func(t *testing.T) {
+		recorded.StartedAt = startTime.Add(2 * time.Hour)
+		assert.Nil(t, repoProvider.RecordUpdateProgress(ctx, repo, recorded))
+		assert.Nil(t, repoProvider.ClearUpdateProgress(ctx, repo))
+
+		progress, err := repoProvider.GetUpdateProgress(ctx, repo)
+		assert.Nil(t, err)
+		assert.Nil(t, progress)
+	})
+}
+
+var lockForUpdateTests = []struct {
+	title string
+
+	// Inputs
+	wait bool
+
+	// Mocked responses
+	lockAvailable bool
+	lockErr       error
+
+	// Expected values
+	expectAcquired bool
+	expectErr      bool
+}{
+	{
+		"waits for lock",
+		true,
+		true,
+		nil,
+		true,
+		false,
+	},
+	{
+		"lock available without waiting",
+		false,
+		true,
+		nil,
+		true,
+		false,
+	},
+	{
+		"lock held elsewhere without waiting",
+		false,
+		false,
+		nil,
+		false,
+		false,
+	},
+	{
+		"error locking",
+		false,
+		false,
+		errors.New("permission denied"),
+		false,
+		true,
+	},
+}
+
+func TestRepos_LockForUpdate(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	repoProvider := core.NewRepositoryProvider(testLogger, nil, testFileSystem, nil)
+
+	repo := &core.Repository{
+		Route:   "test/route",
+		RepoDir: "/my/test/dir/git-bundle-server/git/test/route",
+	}
+	lockFile := filepath.Join(repo.RepoDir, "update.lock")
+
+	for _, tt := range lockForUpdateTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testFileLock := &MockFileLock{}
+			var lock common.FileLock
+			if tt.lockAvailable {
+				lock = testFileLock
+			}
+
+			if tt.wait {
+				testFileSystem.On("AcquireFileLock", lockFile).Return(lock, tt.lockErr).Once()
+			} else {
+				testFileSystem.On("TryAcquireFileLock", lockFile).Return(lock, tt.lockAvailable, tt.lockErr).Once()
+			}
+
+			actualLock, acquired, err := repoProvider.LockForUpdate(context.Background(), repo, tt.wait)
+			mock.AssertExpectationsForObjects(t, testFileSystem)
+
+			assert.Equal(t, tt.expectAcquired, acquired)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			if tt.expectAcquired {
+				assert.Equal(t, testFileLock, actualLock)
+			} else {
+				assert.Nil(t, actualLock)
+			}
+
+			// Reset mocks
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
+
+func TestRepos_StorageRoots(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	repoProvider := core.NewRepositoryProvider(testLogger, testUserProvider, testFileSystem, nil)
+
+	t.Setenv(core.RootEnvVar, "/etc/bundle-server")
+	t.Setenv(core.RepoRootEnvVar, "")
+	t.Setenv(core.WebRootEnvVar, "/mnt/www")
+
+	testFileSystem.On("ReadFileLines",
+		filepath.Clean("/etc/bundle-server/routes.json"),
+	).Return([]string{`{"version": 1, "routes": {"git/git": {}}}`}, nil).Once()
+
+	repos, err := repoProvider.GetRepositories(context.Background())
+	assert.Nil(t, err)
+	mock.AssertExpectationsForObjects(t, testFileSystem)
+
+	if assert.Contains(t, repos, "git/git") {
+		repo := repos["git/git"]
+		assert.Equal(t, filepath.Clean("/etc/bundle-server/git/git/git"), repo.RepoDir)
+		assert.Equal(t, filepath.Clean("/mnt/www/git/git"), repo.WebDir)
+	}
+}
+
+func TestRepos_ExplicitStorageRoots(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testFileSystem := &MockFileSystem{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	repoProvider := core.NewRepositoryProviderWithRoots(testLogger, testUserProvider, testFileSystem, nil,
+		core.StorageRoots{Root: "/srv/foo"},
+	)
+
+	// The roots of the environment don't apply to explicit roots.
+	t.Setenv(core.RootEnvVar, "/etc/bundle-server")
+	t.Setenv(core.RepoRootEnvVar, "/mnt/git")
+	t.Setenv(core.WebRootEnvVar, "/mnt/www")
+
+	testFileSystem.On("ReadFileLines",
+		filepath.Clean("/srv/foo/routes.json"),
+	).Return([]string{`{"version": 1, "routes": {"git/git": {}}}`}, nil).Once()
+
+	repos, err := repoProvider.GetRepositories(context.Background())
+	assert.Nil(t, err)
+	mock.AssertExpectationsForObjects(t, testFileSystem)
+
+	if assert.Contains(t, repos, "git/git") {
+		repo := repos["git/git"]
+		assert.Equal(t, filepath.Clean("/srv/foo/git/git/git"), repo.RepoDir)
+		assert.Equal(t, filepath.Clean("/srv/foo/www/git/git"), repo.WebDir)
+	}
+}
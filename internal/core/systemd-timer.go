@@ -0,0 +1,223 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+const timerServiceTemplate string = `[Unit]
+Description={{.Description}}
+
+[Service]
+Type=oneshot
+{{template "exec_start" .}}
+`
+
+const timerTemplate string = `[Unit]
+Description={{.Description}}
+
+[Timer]
+OnCalendar={{.OnCalendar}}
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`
+
+type timerUnitConfig struct {
+	Description string
+	Program     string
+	Arguments   []string
+	OnCalendar  string
+}
+
+var weekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// onCalendar converts a cron schedule into the equivalent systemd calendar
+// event expression (see systemd.time(7)). Only the subset of cron syntax used
+// by the bundle server schedules is supported: the day-of-month and month
+// fields must be '*'.
+func onCalendar(schedule CronSchedule) (string, error) {
+	fields := strings.Fields(string(schedule))
+	if len(fields) != 5 || fields[2] != "*" || fields[3] != "*" {
+		return "", fmt.Errorf("unsupported cron schedule '%s'", schedule)
+	}
+
+	timeField := func(field string) (string, error) {
+		if field == "*" {
+			return "*", nil
+		} else if step, found := strings.CutPrefix(field, "*/"); found {
+			if _, err := strconv.Atoi(step); err != nil {
+				return "", fmt.Errorf("invalid step '%s'", field)
+			}
+			return "00/" + step, nil
+		} else if value, err := strconv.Atoi(field); err == nil {
+			return fmt.Sprintf("%02d", value), nil
+		}
+		return "", fmt.Errorf("invalid value '%s'", field)
+	}
+
+	minute, err := timeField(fields[0])
+	if err != nil {
+		return "", fmt.Errorf("unsupported cron schedule '%s': %w", schedule, err)
+	}
+	hour, err := timeField(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("unsupported cron schedule '%s': %w", schedule, err)
+	}
+
+	calendar := fmt.Sprintf("*-*-* %s:%s:00", hour, minute)
+	if fields[4] != "*" {
+		day, err := strconv.Atoi(fields[4])
+		if err != nil || day < 0 || day > 7 {
+			return "", fmt.Errorf("unsupported cron schedule '%s': invalid weekday '%s'", schedule, fields[4])
+		}
+		calendar = weekdays[day%7] + " " + calendar
+	}
+
+	return calendar, nil
+}
+
+type systemdTimerScheduler struct {
+	logger     log.TraceLogger
+	user       common.UserProvider
+	cmdExec    cmd.CommandExecutor
+	fileSystem common.FileSystem
+
+	// The crontab, in which older versions scheduled the jobs
+	crontab *cronScheduler
+}
+
+func NewSystemdTimerScheduler(
+	l log.TraceLogger,
+	u common.UserProvider,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+) CronScheduler {
+	return &systemdTimerScheduler{
+		logger:     l,
+		user:       u,
+		cmdExec:    c,
+		fileSystem: fs,
+		crontab: &cronScheduler{
+			logger:     l,
+			user:       u,
+			cmdExec:    c,
+			fileSystem: fs,
+		},
+	}
+}
+
+func (s *systemdTimerScheduler) systemctl(ctx context.Context, args ...string) error {
+	args = append([]string{"--user"}, args...)
+	exitCode, err := s.cmdExec.RunQuiet(ctx, "systemctl", args...)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	if exitCode != 0 {
+		return s.logger.Errorf(ctx, "'systemctl %s' exited with status %d", strings.Join(args, " "), exitCode)
+	}
+
+	return nil
+}
+
+// writeUnit writes the unit file if its contents have changed, returning
+// whether the file was written.
+func (s *systemdTimerScheduler) writeUnit(ctx context.Context, filename string, content []byte) (bool, error) {
+	existingLines, err := s.fileSystem.ReadFileLines(filename)
+	if err != nil {
+		return false, s.logger.Errorf(ctx, "could not read unit file '%s': %w", filename, err)
+	}
+
+	if strings.Join(existingLines, "\n") == strings.TrimSuffix(string(content), "\n") {
+		return false, nil
+	}
+
+	err = s.fileSystem.WriteFile(filename, content)
+	if err != nil {
+		return false, s.logger.Errorf(ctx, "unable to write unit file '%s': %w", filename, err)
+	}
+
+	return true, nil
+}
+
+func (s *systemdTimerScheduler) AddJob(ctx context.Context,
+	schedule CronSchedule,
+	exePath string,
+	args []string,
+) error {
+	calendar, err := onCalendar(schedule)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	user, err := s.user.CurrentUser()
+	if err != nil {
+		return s.logger.Errorf(ctx, "could not get current user for systemd timer: %w", err)
+	}
+
+	label := jobLabel(args)
+
+	config := timerUnitConfig{
+		Description: fmt.Sprintf("Git Bundle Server scheduled '%s'", strings.Join(args, " ")),
+		Program:     exePath,
+		Arguments:   args,
+		OnCalendar:  calendar,
+	}
+
+	unitDir := filepath.Join(user.HomeDir, ".config", "systemd", "user")
+	changed := false
+	for _, unit := range []struct {
+		filename string
+		template string
+	}{
+		{filepath.Join(unitDir, label+".service"), timerServiceTemplate},
+		{filepath.Join(unitDir, label+".timer"), timerTemplate},
+	} {
+		var content bytes.Buffer
+		t, err := daemon.NewSystemdUnitTemplate(filepath.Base(unit.filename), unit.template)
+		if err != nil {
+			return s.logger.Errorf(ctx, "unable to generate systemd timer configuration: %w", err)
+		}
+		t.Execute(&content, config)
+
+		written, err := s.writeUnit(ctx, unit.filename, content.Bytes())
+		if err != nil {
+			return err
+		}
+		changed = changed || written
+	}
+
+	if !changed {
+		// We already have this schedule, so skip reloading.
+		return nil
+	}
+
+	err = s.systemctl(ctx, "daemon-reload")
+	if err != nil {
+		return s.logger.Errorf(ctx, "failed to reload systemd units: %w", err)
+	}
+
+	err = s.systemctl(ctx, "enable", "--now", label+".timer")
+	if err != nil {
+		return s.logger.Errorf(ctx, "failed to enable systemd timer: %w", err)
+	}
+
+	// Remove the crontab entry of the same job written before the timer
+	// replaced it, if any, so that the job doesn't run twice. Hosts without
+	// 'crontab' have no entry to remove, so failing to read it (which is
+	// traced) is not an error.
+	s.crontab.replaceJob(ctx, exePath, args, "")
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package core_test
+
+import (
+	"context"
+	"io"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var systemdTimerAddJobTests = []struct {
+	title string
+
+	// Inputs
+	schedule core.CronSchedule
+
+	// Mocked responses
+	existingTimerLines []string
+	existingCrontab    string
+
+	// Expected values
+	expectedOnCalendar string
+	expectedCrontab    string
+	expectReload       bool
+	expectErr          bool
+}{
+	{
+		"Quarter-hourly schedule creates timer and enables it",
+		core.CronQuarterHourly,
+		[]string{},
+		"",
+		"OnCalendar=*-*-* *:00/15:00",
+		"",
+		true,
+		false,
+	},
+	{
+		"Daily schedule",
+		core.CronDaily,
+		[]string{},
+		"",
+		"OnCalendar=*-*-* 00:00:00",
+		"",
+		true,
+		false,
+	},
+	{
+		"Weekly schedule",
+		core.CronWeekly,
+		[]string{},
+		"",
+		"OnCalendar=Sun *-*-* 00:00:00",
+		"",
+		true,
+		false,
+	},
+	{
+		"Crontab entry of the job is removed",
+		core.CronQuarterHourly,
+		[]string{},
+		"0 * * * * /usr/bin/true\n*/15 * * * * \"/usr/local/bin/git-bundle-server\" \"update-all\" \"--due-only\"\n",
+		"OnCalendar=*-*-* *:00/15:00",
+		"0 * * * * /usr/bin/true\n",
+		true,
+		false,
+	},
+	{
+		"Unchanged units are not rewritten or reloaded",
+		core.CronQuarterHourly,
+		[]string{
+			"[Unit]",
+			"Description=Git Bundle Server scheduled 'update-all --due-only'",
+			"",
+			"[Timer]",
+			"OnCalendar=*-*-* *:00/15:00",
+			"Persistent=true",
+			"",
+			"[Install]",
+			"WantedBy=timers.target",
+		},
+		"",
+		"OnCalendar=*-*-* *:00/15:00",
+		"",
+		false,
+		false,
+	},
+	{
+		"Unsupported schedule is rejected",
+		core.CronSchedule("0 0 1 * *"),
+		nil,
+		"",
+		"",
+		"",
+		false,
+		true,
+	},
+}
+
+func TestSystemdTimer_AddJob(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+	exePath := "/usr/local/bin/git-bundle-server"
+	args := []string{"update-all", "--due-only"}
+
+	unitDir := filepath.Join(testUser.HomeDir, ".config", "systemd", "user")
+	serviceFile := filepath.Join(unitDir, "com.git-ecosystem.gitbundleserver.update-all.service")
+	timerFile := filepath.Join(unitDir, "com.git-ecosystem.gitbundleserver.update-all.timer")
+
+	scheduler := core.NewSystemdTimerScheduler(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	for _, tt := range systemdTimerAddJobTests {
+		t.Run(tt.title, func(t *testing.T) {
+			var writtenTimer string
+
+			// Mock responses
+			if !tt.expectErr {
+				testFileSystem.On("ReadFileLines", serviceFile).Return([]string{
+					"[Unit]",
+					"Description=Git Bundle Server scheduled 'update-all --due-only'",
+					"",
+					"[Service]",
+					"Type=oneshot",
+					"ExecStart='/usr/local/bin/git-bundle-server' 'update-all' '--due-only'",
+				}, nil).Once()
+				testFileSystem.On("ReadFileLines", timerFile).Return(tt.existingTimerLines, nil).Once()
+			}
+			if tt.expectReload {
+				testFileSystem.On("WriteFile", timerFile, mock.Anything).Run(func(args mock.Arguments) {
+					writtenTimer = string(args.Get(1).([]byte))
+				}).Return(nil).Once()
+				testCommandExecutor.On("RunQuiet",
+					ctx,
+					"systemctl",
+					[]string{"--user", "daemon-reload"},
+				).Return(0, nil).Once()
+				testCommandExecutor.On("RunQuiet",
+					ctx,
+					"systemctl",
+					[]string{"--user", "enable", "--now", "com.git-ecosystem.gitbundleserver.update-all.timer"},
+				).Return(0, nil).Once()
+
+				// The crontab is checked for an entry of the job
+				crontabExitCode := 0
+				if tt.existingCrontab == "" {
+					crontabExitCode = 1
+				}
+				testCommandExecutor.On("Run",
+					ctx,
+					"crontab",
+					[]string{"-l"},
+					mock.Anything,
+				).Run(func(args mock.Arguments) {
+					for _, setting := range args.Get(3).([]cmd.Setting) {
+						if setting.Key == cmd.StdoutKey && tt.existingCrontab != "" {
+							io.WriteString(setting.Value.(io.Writer), tt.existingCrontab)
+						} else if setting.Key == cmd.StderrKey && tt.existingCrontab == "" {
+							io.WriteString(setting.Value.(io.Writer), "no crontab for testuser\n")
+						}
+					}
+				}).Return(crontabExitCode, nil).Once()
+			}
+			var writtenCrontab string
+			if tt.expectedCrontab != "" {
+				crontabFile := core.CrontabFile(testUser)
+				testFileSystem.On("WriteFile", crontabFile, mock.Anything).Run(func(args mock.Arguments) {
+					writtenCrontab = string(args.Get(1).([]byte))
+				}).Return(nil).Once()
+				testCommandExecutor.On("RunQuiet",
+					ctx,
+					"crontab",
+					[]string{crontabFile},
+				).Return(0, nil).Once()
+				testFileSystem.On("DeleteFile", crontabFile).Return(true, nil).Once()
+			}
+
+			// Run "AddJob"
+			err := scheduler.AddJob(ctx, tt.schedule, exePath, args)
+
+			// Assert on expected values
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			if tt.expectReload {
+				assert.Contains(t, strings.Split(writtenTimer, "\n"), tt.expectedOnCalendar)
+			}
+			assert.Equal(t, tt.expectedCrontab, writtenCrontab)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+			// Reset mocks
+			testCommandExecutor.Mock = mock.Mock{}
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
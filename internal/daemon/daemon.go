@@ -3,7 +3,10 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"runtime"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
@@ -15,6 +18,106 @@ type DaemonConfig struct {
 	Description string
 	Program     string
 	Arguments   []string
+
+	// If non-zero, the program is run periodically at this interval rather
+	// than kept running. Currently only supported by launchd and Task
+	// Scheduler.
+	StartInterval time.Duration
+
+	// If non-zero, the daemon manager listens on this TCP port and passes the
+	// listening socket to the program when it starts (socket activation), so
+	// that connections are not refused while the program restarts.
+	// Currently only supported by systemd.
+	SocketPort int
+
+	// Whether the daemon manager restarts the program when it exits. Not
+	// supported by rc.d scripts.
+	RestartPolicy RestartPolicy
+
+	// Environment variables set for the program. Not supported by Task
+	// Scheduler.
+	Environment map[string]string
+
+	// The resource limits of the program. Not supported by Task Scheduler.
+	Limits ResourceLimits
+}
+
+// ResourceLimits are the limits on the resources used by the program of a
+// daemon. A limit of 0 leaves the daemon manager's default in place.
+type ResourceLimits struct {
+	// The maximum number of open files (i.e. 'ulimit -n'), which includes the
+	// connections of the web server.
+	OpenFiles int
+
+	// The maximum resident memory of the program, in bytes. Not supported by
+	// rc.d scripts.
+	Memory int64
+}
+
+// RestartPolicy configures when a daemon manager restarts the program of a
+// daemon after it exits.
+type RestartPolicy string
+
+const (
+	// The program is not restarted (the default).
+	RestartNever RestartPolicy = ""
+
+	// The program is restarted if it crashes or exits with a non-zero status.
+	RestartOnFailure RestartPolicy = "on-failure"
+
+	// The program is restarted whenever it exits, unless it was stopped with
+	// 'Stop'. The daemon managers that stop a program by signaling it (launchd
+	// and Task Scheduler) cannot tell a stop from a successful exit, so they
+	// treat this like 'RestartOnFailure'.
+	RestartAlways RestartPolicy = "always"
+)
+
+// DaemonStatus describes the state of a daemon.
+type DaemonStatus struct {
+	// Whether the daemon is configured on the system (see 'Create').
+	Installed bool
+
+	// Whether the daemon's program is running.
+	Running bool
+
+	// The daemon manager's own description of the daemon's state (e.g.
+	// 'active (running)' or 'Ready'). Empty if the daemon is not installed.
+	State string
+
+	// The process ID of the running program, or 0 if it is not running (or
+	// the daemon manager does not report it).
+	PID int
+
+	// When the running program was started, or the zero time if it is not
+	// running (or the daemon manager does not report it).
+	StartTime time.Time
+
+	// The exit code of the last run of the program, or nil if it has not
+	// exited since the daemon was loaded (or the daemon manager does not
+	// report it).
+	LastExitCode *int
+
+	// The file to which the output of the program is written, if any.
+	LogPath string
+}
+
+// Uptime returns how long the program has been running as of 'now', or 0 if
+// it is not running or its start time is unknown.
+func (s *DaemonStatus) Uptime(now time.Time) time.Duration {
+	if !s.Running || s.StartTime.IsZero() {
+		return 0
+	}
+	return now.Sub(s.StartTime)
+}
+
+// LogOptions configures which of a daemon's logs are shown by 'Logs'.
+type LogOptions struct {
+	// The number of the most recent lines of the logs to show.
+	Lines int
+
+	// If true, keep showing new lines of the logs as they are written, until
+	// the context is canceled (or the process is interrupted).
+	Follow bool
 }
 
 type DaemonProvider interface {
@@ -24,10 +127,34 @@ type DaemonProvider interface {
 
 	Stop(ctx context.Context, label string) error
 
+	// Restart stops the daemon (if it is running) and starts it again.
+	Restart(ctx context.Context, label string) error
+
+	Status(ctx context.Context, label string) (*DaemonStatus, error)
+
+	// Logs writes the output of the daemon, as recorded by the daemon
+	// manager, to 'w'. Not every daemon manager records it.
+	Logs(ctx context.Context, label string, options LogOptions, w io.Writer) error
+
 	Remove(ctx context.Context, label string) error
 }
 
+// systemdAvailable checks whether the systemd instance managing the given
+// services (see 'systemd.scopeArgs') can be reached, which is not the case on
+// hosts booted with another init system or in many containers.
+func systemdAvailable(ctx context.Context, c cmd.CommandExecutor, scopeArgs ...string) bool {
+	exitCode, err := c.RunQuiet(ctx, "systemctl", append(scopeArgs, "show-environment")...)
+	return err == nil && exitCode == 0
+}
+
+// openrcAvailable checks whether the host was booted with OpenRC.
+func openrcAvailable(fs common.FileSystem) bool {
+	booted, err := fs.FileExists("/run/openrc/softlevel")
+	return err == nil && booted
+}
+
 func NewDaemonProvider(
+	ctx context.Context,
 	l log.TraceLogger,
 	u common.UserProvider,
 	c cmd.CommandExecutor,
@@ -35,12 +162,52 @@ func NewDaemonProvider(
 ) (DaemonProvider, error) {
 	switch thisOs := runtime.GOOS; thisOs {
 	case "linux":
-		// Use systemd/systemctl
-		return NewSystemdProvider(l, u, c, fs), nil
+		if systemdAvailable(ctx, c, "--user") {
+			// Use systemd/systemctl
+			return NewSystemdProvider(l, u, c, fs), nil
+		} else if openrcAvailable(fs) && os.Geteuid() == 0 {
+			// Use OpenRC/rc-service, which can only be managed by root
+			return NewOpenRCProvider(l, c, fs, ""), nil
+		}
+
+		// Otherwise, fall back on a self-contained init script (e.g. in a
+		// container without an init system)
+		return NewRcdProvider(l, u, c, fs), nil
 	case "darwin":
 		// Use launchd/launchctl
 		return NewLaunchdProvider(l, u, c, fs), nil
+	case "windows":
+		// Use Task Scheduler/schtasks
+		return NewTaskSchedulerProvider(l, u, c, fs), nil
+	case "freebsd", "openbsd":
+		// Use an rc.d script
+		return NewRcdProvider(l, u, c, fs), nil
 	default:
 		return nil, fmt.Errorf("cannot configure daemon handler for OS '%s'", thisOs)
 	}
 }
+
+// NewSystemDaemonProvider returns a provider of system-level daemons, which are
+// started at boot and run as the (typically dedicated) service account
+// 'systemUser' rather than the current user. Managing them requires root.
+func NewSystemDaemonProvider(
+	ctx context.Context,
+	l log.TraceLogger,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+	systemUser string,
+) (DaemonProvider, error) {
+	switch thisOs := runtime.GOOS; thisOs {
+	case "linux":
+		if systemdAvailable(ctx, c) {
+			return NewSystemdSystemProvider(l, c, fs, systemUser), nil
+		} else if openrcAvailable(fs) {
+			return NewOpenRCProvider(l, c, fs, systemUser), nil
+		}
+		return nil, fmt.Errorf("system daemons require systemd or OpenRC")
+	case "darwin":
+		return NewLaunchdSystemProvider(l, c, fs, systemUser), nil
+	default:
+		return nil, fmt.Errorf("system daemons are not supported on OS '%s'", thisOs)
+	}
+}
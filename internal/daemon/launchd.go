@@ -5,7 +5,11 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
@@ -36,26 +40,65 @@ func xmlName(name string) xml.Name {
 }
 
 func (p *plist) addKeyValue(key string, value any) {
-	p.Config.Elements = append(p.Config.Elements, xmlItem{XMLName: xmlName("key"), Value: key})
+	p.Config.Elements = append(p.Config.Elements,
+		xmlItem{XMLName: xmlName("key"), Value: key},
+		plistValue(value),
+	)
+}
+
+// plistDict converts a map into a plist dictionary, sorted by key.
+func plistDict[T any](value map[string]T) xmlArray {
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dict := xmlArray{XMLName: xmlName("dict"), Elements: []interface{}{}}
+	for _, key := range keys {
+		dict.Elements = append(dict.Elements,
+			xmlItem{XMLName: xmlName("key"), Value: key},
+			plistValue(value[key]),
+		)
+	}
+	return dict
+}
+
+// plistValue converts a value into its plist element.
+func plistValue(value any) interface{} {
 	switch value := value.(type) {
 	case string:
-		p.Config.Elements = append(p.Config.Elements, xmlItem{XMLName: xmlName("string"), Value: value})
+		return xmlItem{XMLName: xmlName("string"), Value: value}
+	case int:
+		return xmlItem{XMLName: xmlName("integer"), Value: strconv.Itoa(value)}
+	case bool:
+		return xmlItem{XMLName: xmlName(strconv.FormatBool(value))}
 	case []string:
-		p.Config.Elements = append(p.Config.Elements,
-			xmlArray{
-				XMLName: xmlName("array"),
-				Elements: utils.Map(value, func(e string) interface{} {
-					return xmlItem{XMLName: xmlName("string"), Value: e}
-				}),
-			},
-		)
+		return xmlArray{
+			XMLName: xmlName("array"),
+			Elements: utils.Map(value, func(e string) interface{} {
+				return xmlItem{XMLName: xmlName("string"), Value: e}
+			}),
+		}
+	case map[string]bool:
+		return plistDict(value)
+	case map[string]string:
+		return plistDict(value)
+	case map[string]int:
+		return plistDict(value)
 	default:
-		panic("Invalid value type in 'addKeyValue'")
+		panic("Invalid value type in 'plistValue'")
 	}
 }
 
 const domainFormat string = "user/%s"
 
+// The domain and plist directory of system daemons.
+const (
+	systemDomain     string = "system"
+	launchDaemonsDir string = "/Library/LaunchDaemons"
+)
+
 const LaunchdNoSuchProcessErrorCode int = 3
 const LaunchdServiceNotFoundErrorCode int = 113
 
@@ -64,6 +107,8 @@ type launchdConfig struct {
 	LimitLoadToSessionType string
 	StdOut                 string
 	StdErr                 string
+	UserName               string
+	RunAtLoad              bool
 }
 
 func (c *launchdConfig) toPlist() *plist {
@@ -73,7 +118,12 @@ func (c *launchdConfig) toPlist() *plist {
 	}
 	p.addKeyValue("Label", c.Label)
 	p.addKeyValue("Program", c.Program)
-	p.addKeyValue("LimitLoadToSessionType", c.LimitLoadToSessionType)
+	if c.LimitLoadToSessionType != "" {
+		p.addKeyValue("LimitLoadToSessionType", c.LimitLoadToSessionType)
+	}
+	if c.UserName != "" {
+		p.addKeyValue("UserName", c.UserName)
+	}
 	p.addKeyValue("StandardOutPath", c.StdOut)
 	p.addKeyValue("StandardErrorPath", c.StdErr)
 
@@ -89,6 +139,39 @@ func (c *launchdConfig) toPlist() *plist {
 	copy(args[1:], c.Arguments[:])
 	p.addKeyValue("ProgramArguments", args)
 
+	if c.StartInterval > 0 {
+		p.addKeyValue("StartInterval", int(c.StartInterval.Seconds()))
+	}
+	if c.RunAtLoad {
+		p.addKeyValue("RunAtLoad", true)
+	}
+
+	if len(c.Environment) > 0 {
+		p.addKeyValue("EnvironmentVariables", c.Environment)
+	}
+
+	// The hard limits are set as well, since the soft limits can't exceed
+	// them.
+	limits := map[string]int{}
+	if c.Limits.OpenFiles > 0 {
+		limits["NumberOfFiles"] = c.Limits.OpenFiles
+	}
+	if c.Limits.Memory > 0 {
+		limits["ResidentSetSize"] = int(c.Limits.Memory)
+	}
+	if len(limits) > 0 {
+		p.addKeyValue("SoftResourceLimits", limits)
+		p.addKeyValue("HardResourceLimits", limits)
+	}
+
+	// Restart the program if it exits unsuccessfully (including crashes).
+	// launchd throttles restarts to one every ten seconds by default. With
+	// 'RestartAlways', the program is likewise not restarted after exiting
+	// successfully, since that is how it is stopped (see 'Stop').
+	if c.RestartPolicy == RestartOnFailure || c.RestartPolicy == RestartAlways {
+		p.addKeyValue("KeepAlive", map[string]bool{"SuccessfulExit": false})
+	}
+
 	return p
 }
 
@@ -97,6 +180,10 @@ type launchd struct {
 	user       common.UserProvider
 	cmdExec    cmd.CommandExecutor
 	fileSystem common.FileSystem
+
+	// If non-empty, the service is a system daemon (rather than an agent of
+	// the current user) run as this user.
+	systemUser string
 }
 
 func NewLaunchdProvider(
@@ -113,6 +200,38 @@ func NewLaunchdProvider(
 	}
 }
 
+// NewLaunchdSystemProvider returns a provider of launchd daemons in the system
+// domain, which are started at boot and run as 'systemUser'. Managing them
+// requires root.
+func NewLaunchdSystemProvider(
+	l log.TraceLogger,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+	systemUser string,
+) DaemonProvider {
+	return &launchd{
+		logger:     l,
+		cmdExec:    c,
+		fileSystem: fs,
+		systemUser: systemUser,
+	}
+}
+
+// paths returns the plist file of the service 'label' and the domain target
+// to which it is bootstrapped.
+func (l *launchd) paths(label string) (string, string, error) {
+	if l.systemUser != "" {
+		return filepath.Join(launchDaemonsDir, fmt.Sprintf("%s.plist", label)), systemDomain, nil
+	}
+
+	user, err := l.user.CurrentUser()
+	if err != nil {
+		return "", "", fmt.Errorf("could not get current user for launchd service: %w", err)
+	}
+	return filepath.Join(user.HomeDir, "Library", "LaunchAgents", fmt.Sprintf("%s.plist", label)),
+		fmt.Sprintf(domainFormat, user.Uid), nil
+}
+
 func (l *launchd) isBootstrapped(ctx context.Context, serviceTarget string) (bool, error) {
 	// run 'launchctl print' on given service target to see if it exists
 	exitCode, err := l.cmdExec.RunQuiet(ctx, "launchctl", "print", serviceTarget)
@@ -168,6 +287,13 @@ func (l *launchd) Create(ctx context.Context, config *DaemonConfig, force bool)
 		StdOut:                 "/dev/null",
 		StdErr:                 "/dev/null",
 	}
+	if l.systemUser != "" {
+		// System daemons aren't limited to a session, and are started at
+		// boot.
+		lConfig.LimitLoadToSessionType = ""
+		lConfig.UserName = l.systemUser
+		lConfig.RunAtLoad = true
+	}
 
 	// Generate the configuration
 	var newPlist bytes.Buffer
@@ -181,13 +307,10 @@ func (l *launchd) Create(ctx context.Context, config *DaemonConfig, force bool)
 	}
 
 	// Check the existing file - if it's the same as the new content, do not overwrite
-	user, err := l.user.CurrentUser()
+	filename, domainTarget, err := l.paths(config.Label)
 	if err != nil {
-		return l.logger.Errorf(ctx, "could not get current user for launchd service: %w", err)
+		return l.logger.Error(ctx, err)
 	}
-
-	filename := filepath.Join(user.HomeDir, "Library", "LaunchAgents", fmt.Sprintf("%s.plist", config.Label))
-	domainTarget := fmt.Sprintf(domainFormat, user.Uid)
 	serviceTarget := fmt.Sprintf("%s/%s", domainTarget, config.Label)
 
 	alreadyLoaded, err := l.isBootstrapped(ctx, serviceTarget)
@@ -232,12 +355,10 @@ func (l *launchd) Create(ctx context.Context, config *DaemonConfig, force bool)
 }
 
 func (l *launchd) Start(ctx context.Context, label string) error {
-	user, err := l.user.CurrentUser()
+	_, domainTarget, err := l.paths(label)
 	if err != nil {
-		return l.logger.Errorf(ctx, "could not get current user for launchd service: %w", err)
+		return l.logger.Error(ctx, err)
 	}
-
-	domainTarget := fmt.Sprintf(domainFormat, user.Uid)
 	serviceTarget := fmt.Sprintf("%s/%s", domainTarget, label)
 	exitCode, err := l.cmdExec.RunQuiet(ctx, "launchctl", "kickstart", serviceTarget)
 	if err != nil {
@@ -252,12 +373,10 @@ func (l *launchd) Start(ctx context.Context, label string) error {
 }
 
 func (l *launchd) Stop(ctx context.Context, label string) error {
-	user, err := l.user.CurrentUser()
+	_, domainTarget, err := l.paths(label)
 	if err != nil {
-		return l.logger.Errorf(ctx, "could not get current user for launchd service: %w", err)
+		return l.logger.Error(ctx, err)
 	}
-
-	domainTarget := fmt.Sprintf(domainFormat, user.Uid)
 	serviceTarget := fmt.Sprintf("%s/%s", domainTarget, label)
 	exitCode, err := l.cmdExec.RunQuiet(ctx, "launchctl", "kill", "SIGINT", serviceTarget)
 	if err != nil {
@@ -274,14 +393,106 @@ func (l *launchd) Stop(ctx context.Context, label string) error {
 	return nil
 }
 
-func (l *launchd) Remove(ctx context.Context, label string) error {
-	user, err := l.user.CurrentUser()
+func (l *launchd) Restart(ctx context.Context, label string) error {
+	_, domainTarget, err := l.paths(label)
+	if err != nil {
+		return l.logger.Error(ctx, err)
+	}
+
+	// '-k' kills the running instance of the service (if any) before
+	// starting it again.
+	serviceTarget := fmt.Sprintf("%s/%s", domainTarget, label)
+	exitCode, err := l.cmdExec.RunQuiet(ctx, "launchctl", "kickstart", "-k", serviceTarget)
+	if err != nil {
+		return l.logger.Error(ctx, err)
+	}
+
+	if exitCode != 0 {
+		return l.logger.Errorf(ctx, "'launchctl kickstart' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (l *launchd) Status(ctx context.Context, label string) (*DaemonStatus, error) {
+	filename, domainTarget, err := l.paths(label)
 	if err != nil {
-		return l.logger.Errorf(ctx, "could not get current user for launchd service: %w", err)
+		return nil, l.logger.Error(ctx, err)
 	}
 
-	filename := filepath.Join(user.HomeDir, "Library", "LaunchAgents", fmt.Sprintf("%s.plist", label))
-	domainTarget := fmt.Sprintf(domainFormat, user.Uid)
+	installed, err := l.fileSystem.FileExists(filename)
+	if err != nil {
+		return nil, l.logger.Errorf(ctx, "could not determine whether plist '%s' exists: %w", filename, err)
+	}
+
+	serviceTarget := fmt.Sprintf("%s/%s", domainTarget, label)
+	var output bytes.Buffer
+	exitCode, err := l.cmdExec.Run(ctx, "launchctl", []string{"print", serviceTarget}, cmd.Stdout(&output))
+	if err != nil {
+		return nil, l.logger.Error(ctx, err)
+	}
+
+	if exitCode != 0 && exitCode != LaunchdServiceNotFoundErrorCode {
+		return nil, l.logger.Errorf(ctx, "'launchctl print' exited with status %d", exitCode)
+	}
+
+	status := parseLaunchdStatus(output.String())
+	status.Installed = installed
+	return status, nil
+}
+
+// parseLaunchdStatus reads the status of a service from the output of
+// 'launchctl print'. The output is meant for humans rather than programs, so
+// only the top-level 'key = value' lines that are unlikely to change are read.
+func parseLaunchdStatus(output string) *DaemonStatus {
+	properties := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		// Nested properties (e.g. of the service's endpoints) are indented
+		// further, and may reuse the same keys.
+		if !strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "\t\t") {
+			continue
+		}
+		key, value, found := strings.Cut(strings.TrimSpace(line), " = ")
+		if found {
+			properties[key] = value
+		}
+	}
+
+	status := &DaemonStatus{
+		State: properties["state"],
+	}
+
+	// The state is 'running' rather than e.g. 'not running' or 'waiting'.
+	status.Running = status.State == "running"
+	if pid, err := strconv.Atoi(properties["pid"]); err == nil && status.Running {
+		status.PID = pid
+	}
+
+	// The last exit code may be followed by its meaning (e.g. '78: EX_CONFIG');
+	// before the service has exited, it is '(never exited)'.
+	lastExitCode, _, _ := strings.Cut(properties["last exit code"], ":")
+	if exitCode, err := strconv.Atoi(lastExitCode); err == nil {
+		status.LastExitCode = &exitCode
+	}
+
+	if path := properties["stdout path"]; path != "/dev/null" {
+		status.LogPath = path
+	}
+
+	return status
+}
+
+func (l *launchd) Logs(ctx context.Context, label string, options LogOptions, w io.Writer) error {
+	// The output of the service is discarded (see 'Create').
+	return l.logger.Errorf(ctx, "launchd does not record the output of '%s'; "+
+		"use the logs of the program (e.g. its '--log-file') instead", label)
+}
+
+func (l *launchd) Remove(ctx context.Context, label string) error {
+	filename, domainTarget, err := l.paths(label)
+	if err != nil {
+		return l.logger.Error(ctx, err)
+	}
 	serviceTarget := fmt.Sprintf("%s/%s", domainTarget, label)
 
 	_, err = l.bootout(ctx, serviceTarget)
@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
 	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
@@ -218,6 +219,146 @@ var launchdCreatePlistTests = []struct {
 			"<string>another-arg</string>",
 			"</array>",
 
+			"</dict>",
+			"</plist>",
+		},
+	},
+	{
+		title: "Created plist captures start interval",
+		config: &daemon.DaemonConfig{
+			Label:         "test-with-interval",
+			Program:       "/path/to/the/program",
+			Arguments:     []string{"update-all"},
+			StartInterval: 15 * time.Minute,
+		},
+		expectedPlistLines: []string{
+			`<?xml version="1.0" encoding="UTF-8"?>`,
+			`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">`,
+			`<plist version="1.0">`,
+			"<dict>",
+
+			"<key>Label</key>",
+			"<string>test-with-interval</string>",
+
+			"<key>Program</key>",
+			"<string>/path/to/the/program</string>",
+
+			"<key>LimitLoadToSessionType</key>",
+			"<string>Background</string>",
+
+			"<key>StandardOutPath</key>",
+			"<string>/dev/null</string>",
+
+			"<key>StandardErrorPath</key>",
+			"<string>/dev/null</string>",
+
+			"<key>ProgramArguments</key>",
+			"<array>",
+			"<string>/path/to/the/program</string>",
+			"<string>update-all</string>",
+			"</array>",
+
+			"<key>StartInterval</key>",
+			"<integer>900</integer>",
+
+			"</dict>",
+			"</plist>",
+		},
+	}, {
+		title: "Created plist keeps failed program alive",
+		config: &daemon.DaemonConfig{
+			Label:         "test-with-restart",
+			Program:       "/path/to/the/program",
+			RestartPolicy: daemon.RestartOnFailure,
+		},
+		expectedPlistLines: []string{
+			`<?xml version="1.0" encoding="UTF-8"?>`,
+			`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">`,
+			`<plist version="1.0">`,
+			"<dict>",
+
+			"<key>Label</key>",
+			"<string>test-with-restart</string>",
+
+			"<key>Program</key>",
+			"<string>/path/to/the/program</string>",
+
+			"<key>LimitLoadToSessionType</key>",
+			"<string>Background</string>",
+
+			"<key>StandardOutPath</key>",
+			"<string>/dev/null</string>",
+
+			"<key>StandardErrorPath</key>",
+			"<string>/dev/null</string>",
+
+			"<key>ProgramArguments</key>",
+			"<array>",
+			"<string>/path/to/the/program</string>",
+			"</array>",
+
+			"<key>KeepAlive</key>",
+			"<dict>",
+			"<key>SuccessfulExit</key>",
+			"<false>",
+			"</false>",
+			"</dict>",
+
+			"</dict>",
+			"</plist>",
+		},
+	}, {
+		title: "Created plist sets environment and resource limits",
+		config: &daemon.DaemonConfig{
+			Label:       "test-with-env",
+			Program:     "/path/to/the/program",
+			Environment: map[string]string{"HTTPS_PROXY": "http://proxy:3128"},
+			Limits:      daemon.ResourceLimits{OpenFiles: 65536},
+		},
+		expectedPlistLines: []string{
+			`<?xml version="1.0" encoding="UTF-8"?>`,
+			`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">`,
+			`<plist version="1.0">`,
+			"<dict>",
+
+			"<key>Label</key>",
+			"<string>test-with-env</string>",
+
+			"<key>Program</key>",
+			"<string>/path/to/the/program</string>",
+
+			"<key>LimitLoadToSessionType</key>",
+			"<string>Background</string>",
+
+			"<key>StandardOutPath</key>",
+			"<string>/dev/null</string>",
+
+			"<key>StandardErrorPath</key>",
+			"<string>/dev/null</string>",
+
+			"<key>ProgramArguments</key>",
+			"<array>",
+			"<string>/path/to/the/program</string>",
+			"</array>",
+
+			"<key>EnvironmentVariables</key>",
+			"<dict>",
+			"<key>HTTPS_PROXY</key>",
+			"<string>http://proxy:3128</string>",
+			"</dict>",
+
+			"<key>SoftResourceLimits</key>",
+			"<dict>",
+			"<key>NumberOfFiles</key>",
+			"<integer>65536</integer>",
+			"</dict>",
+
+			"<key>HardResourceLimits</key>",
+			"<dict>",
+			"<key>NumberOfFiles</key>",
+			"<integer>65536</integer>",
+			"</dict>",
+
 			"</dict>",
 			"</plist>",
 		},
@@ -588,3 +729,150 @@ func TestLaunchd_Remove(t *testing.T) {
 		testFileSystem.Mock = mock.Mock{}
 	}
 }
+
+var launchdStatusTests = []struct {
+	title string
+
+	// Inputs
+	plistExists   bool
+	printExitCode int
+	printOutput   string
+
+	// Expected values
+	expectedStatus daemon.DaemonStatus
+}{
+	{
+		"Running",
+		true,
+		0,
+		"gui/123/com.example.testdaemon = {\n\tactive count = 1\n\tstdout path = /dev/null\n" +
+			"\tstate = running\n\tpid = 1234\n\tlast exit code = (never exited)\n" +
+			"\tendpoints = {\n\t\tstate = active\n\t}\n}\n",
+		daemon.DaemonStatus{Installed: true, Running: true, State: "running", PID: 1234},
+	},
+	{
+		"Bootstrapped but not running",
+		true,
+		0,
+		"gui/123/com.example.testdaemon = {\n\tactive count = 0\n\tstdout path = /tmp/out.log\n" +
+			"\tstate = not running\n\tlast exit code = 78: EX_CONFIG\n}\n",
+		daemon.DaemonStatus{Installed: true, Running: false, State: "not running", LastExitCode: PtrTo(78), LogPath: "/tmp/out.log"},
+	},
+	{
+		"Not bootstrapped",
+		true,
+		daemon.LaunchdServiceNotFoundErrorCode,
+		"",
+		daemon.DaemonStatus{Installed: true, Running: false},
+	},
+	{
+		"Not installed",
+		false,
+		daemon.LaunchdServiceNotFoundErrorCode,
+		"",
+		daemon.DaemonStatus{Installed: false, Running: false},
+	},
+}
+
+func TestLaunchd_Status(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	launchd := daemon.NewLaunchdProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	for _, tt := range launchdStatusTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testFileSystem.On("FileExists",
+				filepath.Clean(fmt.Sprintf("/my/test/dir/Library/LaunchAgents/%s.plist", basicDaemonConfig.Label)),
+			).Return(tt.plistExists, nil).Once()
+			testCommandExecutor.On("Run",
+				ctx,
+				"launchctl",
+				[]string{"print", fmt.Sprintf("user/123/%s", basicDaemonConfig.Label)},
+				mock.AnythingOfType("[]cmd.Setting"),
+			).Run(writeStdout(tt.printOutput)).Return(tt.printExitCode, nil).Once()
+
+			status, err := launchd.Status(ctx, basicDaemonConfig.Label)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedStatus, *status)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+		})
+
+		// Reset the mocks between tests
+		testCommandExecutor.Mock = mock.Mock{}
+		testFileSystem.Mock = mock.Mock{}
+	}
+}
+
+func TestLaunchd_System(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	launchd := daemon.NewLaunchdSystemProvider(testLogger, testCommandExecutor, testFileSystem, "_gitbundleserver")
+
+	t.Run("Create bootstraps a system daemon", func(t *testing.T) {
+		var actualFileBytes []byte
+		filename := "/Library/LaunchDaemons/com.example.testdaemon.plist"
+
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"launchctl",
+			[]string{"print", "system/com.example.testdaemon"},
+		).Return(daemon.LaunchdServiceNotFoundErrorCode, nil).Once()
+		testFileSystem.On("FileExists", filename).Return(false, nil).Once()
+		testFileSystem.On("WriteFile",
+			filename,
+			mock.MatchedBy(func(fileBytes any) bool {
+				actualFileBytes = fileBytes.([]byte)
+				return true
+			}),
+		).Return(nil).Once()
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"launchctl",
+			[]string{"bootstrap", "system", filename},
+		).Return(0, nil).Once()
+
+		err := launchd.Create(ctx, &basicDaemonConfig, false)
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+		// Remove the indentation of the plist before checking its contents
+		fileContents := regexp.MustCompile(`>\s+<`).ReplaceAllString(string(actualFileBytes), "><")
+		assert.Contains(t, fileContents, "<key>UserName</key><string>_gitbundleserver</string>")
+		assert.Contains(t, fileContents, "<key>RunAtLoad</key><true></true>")
+		assert.NotContains(t, fileContents, "LimitLoadToSessionType")
+	})
+
+	// Reset the mock structure between tests
+	testCommandExecutor.Mock = mock.Mock{}
+	testFileSystem.Mock = mock.Mock{}
+
+	t.Run("Start kickstarts the system daemon", func(t *testing.T) {
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"launchctl",
+			[]string{"kickstart", "system/com.example.testdaemon"},
+		).Return(0, nil).Once()
+
+		err := launchd.Start(ctx, basicDaemonConfig.Label)
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor)
+	})
+}
@@ -0,0 +1,301 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The service is started with 'start-stop-daemon' or, if it is restarted (see
+// 'DaemonConfig.RestartPolicy'), supervised by 'supervise-daemon', which
+// restarts it whenever it exits. 'command_args' is evaluated by the shell, so
+// each argument is quoted within it. On stop, the program is given 30 seconds
+// to shut down gracefully before it is killed.
+const openrcTemplate string = `#!/sbin/openrc-run
+#
+# {{.Description}}
+
+description={{sh_escape .Description}}
+command={{sh_escape .Program}}
+command_args={{sh_escape (sh_join .Arguments)}}
+{{- if .User}}
+command_user={{sh_escape .User}}
+{{- end}}
+output_log={{sh_escape .LogFile}}
+error_log={{sh_escape .LogFile}}
+retry="SIGTERM/30/SIGKILL/5"
+{{- if .RestartPolicy}}
+supervisor=supervise-daemon
+respawn_delay=5
+respawn_max=0
+{{- else}}
+command_background=true
+pidfile={{sh_escape .PidFile}}
+{{- end}}
+{{- if .Limits.OpenFiles}}
+rc_ulimit="-n {{.Limits.OpenFiles}}"
+{{- end}}
+{{- range $key, $value := .Environment}}
+export {{sh_escape (printf "%s=%s" $key $value)}}
+{{- end}}
+
+depend() {
+	need net
+}
+`
+
+// The directory of OpenRC init scripts.
+const openrcInitDir string = "/etc/init.d"
+
+// Exit codes of 'rc-service <name> status' and the service states they
+// report.
+var openrcStates = map[int]string{
+	0:  "started",
+	3:  "stopped",
+	32: "crashed",
+}
+
+type openrcConfig struct {
+	DaemonConfig
+	PidFile string
+	LogFile string
+
+	// The user as which a system service is run (empty to run it as root).
+	User string
+}
+
+type openrc struct {
+	logger     log.TraceLogger
+	cmdExec    cmd.CommandExecutor
+	fileSystem common.FileSystem
+
+	// If non-empty, the service is a system service, added to the default
+	// runlevel (so that it is started at boot) and run as this user.
+	systemUser string
+}
+
+// NewOpenRCProvider returns a provider of OpenRC services, for Linux
+// distributions (e.g. Alpine) that don't use systemd. OpenRC services are
+// always installed system-wide, so managing them requires root. If
+// 'systemUser' is non-empty, services are started at boot and run as that
+// user; otherwise, they run as root.
+func NewOpenRCProvider(
+	l log.TraceLogger,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+	systemUser string,
+) DaemonProvider {
+	return &openrc{
+		logger:     l,
+		cmdExec:    c,
+		fileSystem: fs,
+		systemUser: systemUser,
+	}
+}
+
+// The name of the service of a daemon. OpenRC treats a '.' in a service name
+// specially (e.g. 'net.eth0'), so the same name as an rc.d script is used.
+func (o *openrc) serviceName(label string) string {
+	return rcdName(label)
+}
+
+func (o *openrc) scriptFile(label string) string {
+	return filepath.Join(openrcInitDir, o.serviceName(label))
+}
+
+func (o *openrc) pidFile(label string) string {
+	return filepath.Join("/run", fmt.Sprintf("%s.pid", o.serviceName(label)))
+}
+
+func (o *openrc) logFile(label string) string {
+	return filepath.Join("/var/log", fmt.Sprintf("%s.log", o.serviceName(label)))
+}
+
+func (o *openrc) rcService(ctx context.Context, label string, command string) (int, error) {
+	exitCode, err := o.cmdExec.RunQuiet(ctx, "rc-service", o.serviceName(label), command)
+	if err != nil {
+		return -1, o.logger.Error(ctx, err)
+	}
+	return exitCode, nil
+}
+
+func (o *openrc) Create(ctx context.Context, config *DaemonConfig, force bool) error {
+	oConfig := &openrcConfig{
+		DaemonConfig: *config,
+		PidFile:      o.pidFile(config.Label),
+		LogFile:      o.logFile(config.Label),
+		User:         o.systemUser,
+	}
+
+	// Generate the configuration
+	shEscape := func(str string) string {
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(str, "'", `'\''`))
+	}
+	var newScript bytes.Buffer
+	t, err := template.New(config.Label).Funcs(template.FuncMap{
+		"sh_escape": shEscape,
+		"sh_join": func(args []string) string {
+			escaped := make([]string, len(args))
+			for i, arg := range args {
+				escaped[i] = shEscape(arg)
+			}
+			return strings.Join(escaped, " ")
+		},
+	}).Parse(openrcTemplate)
+	if err != nil {
+		return o.logger.Errorf(ctx, "unable to generate OpenRC configuration: %w", err)
+	}
+	t.Execute(&newScript, oConfig)
+
+	filename := o.scriptFile(config.Label)
+
+	// Check whether the file exists
+	fileExists, err := o.fileSystem.FileExists(filename)
+	if err != nil {
+		return o.logger.Errorf(ctx, "could not determine whether init script '%s' exists: %w", filename, err)
+	}
+
+	if !force && fileExists {
+		// File already exists and we aren't forcing a refresh, so we do nothing
+		return nil
+	}
+
+	err = o.fileSystem.WriteFile(filename, newScript.Bytes())
+	if err != nil {
+		return o.logger.Errorf(ctx, "unable to write init script: %w", err)
+	}
+
+	// 'rc-service' executes the script directly.
+	exitCode, err := o.cmdExec.RunQuiet(ctx, "chmod", "755", filename)
+	if err != nil {
+		return o.logger.Error(ctx, err)
+	} else if exitCode != 0 {
+		return o.logger.Errorf(ctx, "'chmod' exited with status %d", exitCode)
+	}
+
+	// Add system services to the default runlevel, so that they are started
+	// at boot.
+	if o.systemUser != "" {
+		exitCode, err := o.cmdExec.RunQuiet(ctx, "rc-update", "add", o.serviceName(config.Label), "default")
+		if err != nil {
+			return o.logger.Error(ctx, err)
+		} else if exitCode != 0 {
+			return o.logger.Errorf(ctx, "'rc-update add' exited with status %d", exitCode)
+		}
+	}
+
+	return nil
+}
+
+func (o *openrc) Start(ctx context.Context, label string) error {
+	exitCode, err := o.rcService(ctx, label, "start")
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		return o.logger.Errorf(ctx, "'rc-service start' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (o *openrc) Stop(ctx context.Context, label string) error {
+	// Don't throw an error if the service was never created
+	fileExists, err := o.fileSystem.FileExists(o.scriptFile(label))
+	if err != nil {
+		return o.logger.Errorf(ctx, "could not determine whether init script exists: %w", err)
+	} else if !fileExists {
+		return nil
+	}
+
+	exitCode, err := o.rcService(ctx, label, "stop")
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		return o.logger.Errorf(ctx, "'rc-service stop' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (o *openrc) Restart(ctx context.Context, label string) error {
+	exitCode, err := o.rcService(ctx, label, "restart")
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		return o.logger.Errorf(ctx, "'rc-service restart' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (o *openrc) Status(ctx context.Context, label string) (*DaemonStatus, error) {
+	fileExists, err := o.fileSystem.FileExists(o.scriptFile(label))
+	if err != nil {
+		return nil, o.logger.Errorf(ctx, "could not determine whether init script exists: %w", err)
+	} else if !fileExists {
+		return &DaemonStatus{}, nil
+	}
+
+	exitCode, err := o.rcService(ctx, label, "status")
+	if err != nil {
+		return nil, err
+	}
+
+	status := &DaemonStatus{
+		Installed: true,
+		Running:   exitCode == 0,
+		State:     openrcStates[exitCode],
+		LogPath:   o.logFile(label),
+	}
+	if status.State == "" {
+		status.State = fmt.Sprintf("unknown (status %d)", exitCode)
+	}
+
+	// Only services started without a supervisor have a pidfile of their
+	// own (that of 'supervise-daemon' is the supervisor's).
+	if status.Running {
+		status.PID, status.StartTime = readPidFile(o.fileSystem, o.pidFile(label))
+	}
+
+	return status, nil
+}
+
+func (o *openrc) Logs(ctx context.Context, label string, options LogOptions, w io.Writer) error {
+	err := tailLogFile(ctx, o.cmdExec, o.fileSystem, o.logFile(label), options, w)
+	if err != nil {
+		return o.logger.Error(ctx, err)
+	}
+	return nil
+}
+
+func (o *openrc) Remove(ctx context.Context, label string) error {
+	// Remove system services from the default runlevel. 'rc-update' fails if
+	// the service isn't in it, which is fine.
+	if o.systemUser != "" {
+		_, err := o.cmdExec.RunQuiet(ctx, "rc-update", "del", o.serviceName(label), "default")
+		if err != nil {
+			return o.logger.Error(ctx, err)
+		}
+	}
+
+	_, err := o.fileSystem.DeleteFile(o.scriptFile(label))
+	if err != nil {
+		return o.logger.Errorf(ctx, "could not delete init script: %w", err)
+	}
+
+	return nil
+}
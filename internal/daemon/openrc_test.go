@@ -0,0 +1,170 @@
+package daemon_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var openrcCreateScriptTests = []struct {
+	title string
+
+	// Inputs
+	config     *daemon.DaemonConfig
+	systemUser string
+
+	// Expected values
+	expectedFilename string
+	expectedLines    []string
+}{
+	{
+		title:            "Created script runs program in the background",
+		config:           &basicDaemonConfig,
+		expectedFilename: "com_example_testdaemon",
+		expectedLines: []string{
+			"#!/sbin/openrc-run",
+			"command='/usr/local/bin/test/git-bundle-web-server'",
+			"command_args=''",
+			"command_background=true",
+			"pidfile='/run/com_example_testdaemon.pid'",
+			"output_log='/var/log/com_example_testdaemon.log'",
+		},
+	}, {
+		title: "Created script quotes args within command_args",
+		config: &daemon.DaemonConfig{
+			Label:   "test-escape",
+			Program: "/path/to/the/program with a space",
+			Arguments: []string{
+				"--my-option",
+				"an arg with single quotes ' and spaces!",
+			},
+		},
+		expectedFilename: "test_escape",
+		expectedLines: []string{
+			"command='/path/to/the/program with a space'",
+			`command_args=''\''--my-option'\'' '\''an arg with single quotes '\''\'\'''\'' and spaces!'\'''`,
+		},
+	}, {
+		title: "Restarted service is supervised",
+		config: &daemon.DaemonConfig{
+			Label:         "test-restart",
+			Program:       "/path/to/the/program",
+			RestartPolicy: daemon.RestartOnFailure,
+			Environment:   map[string]string{"HTTPS_PROXY": "http://proxy:3128"},
+			Limits:        daemon.ResourceLimits{OpenFiles: 65536},
+		},
+		systemUser:       "git-bundle-server",
+		expectedFilename: "test_restart",
+		expectedLines: []string{
+			"supervisor=supervise-daemon",
+			"respawn_max=0",
+			"command_user='git-bundle-server'",
+			"export 'HTTPS_PROXY=http://proxy:3128'",
+			`rc_ulimit="-n 65536"`,
+		},
+	},
+}
+
+func TestOpenRC_Create(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	for _, tt := range openrcCreateScriptTests {
+		t.Run(tt.title, func(t *testing.T) {
+			var actualFileBytes []byte
+			openrc := daemon.NewOpenRCProvider(testLogger, testCommandExecutor, testFileSystem, tt.systemUser)
+			filename := "/etc/init.d/" + tt.expectedFilename
+
+			// Mock responses for successful fresh write
+			testFileSystem.On("FileExists", filename).Return(false, nil).Once()
+			testFileSystem.On("WriteFile",
+				filename,
+				mock.MatchedBy(func(fileBytes any) bool {
+					// Save off value and always match
+					actualFileBytes = fileBytes.([]byte)
+					return true
+				}),
+			).Return(nil).Once()
+			testCommandExecutor.On("RunQuiet",
+				ctx,
+				"chmod",
+				[]string{"755", filename},
+			).Return(0, nil).Once()
+			if tt.systemUser != "" {
+				testCommandExecutor.On("RunQuiet",
+					ctx,
+					"rc-update",
+					[]string{"add", tt.expectedFilename, "default"},
+				).Return(0, nil).Once()
+			}
+
+			err := openrc.Create(ctx, tt.config, false)
+			assert.Nil(t, err)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+			// Check script content
+			scriptLines := strings.Split(string(actualFileBytes), "\n")
+			for _, line := range tt.expectedLines {
+				assert.Contains(t, scriptLines, line)
+			}
+
+			// Reset mocks
+			testCommandExecutor.Mock = mock.Mock{}
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
+
+func TestOpenRC_Status(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	openrc := daemon.NewOpenRCProvider(testLogger, testCommandExecutor, testFileSystem, "")
+
+	t.Run("Reports crashed service", func(t *testing.T) {
+		testFileSystem.On("FileExists",
+			"/etc/init.d/com_example_testdaemon",
+		).Return(true, nil).Once()
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"rc-service",
+			[]string{"com_example_testdaemon", "status"},
+		).Return(32, nil).Once()
+
+		status, err := openrc.Status(ctx, basicDaemonConfig.Label)
+		assert.Nil(t, err)
+		assert.True(t, status.Installed)
+		assert.False(t, status.Running)
+		assert.Equal(t, "crashed", status.State)
+		assert.Equal(t, "/var/log/com_example_testdaemon.log", status.LogPath)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+	})
+
+	// Reset the mock structure between tests
+	testCommandExecutor.Mock = mock.Mock{}
+	testFileSystem.Mock = mock.Mock{}
+
+	t.Run("Not installed without init script", func(t *testing.T) {
+		testFileSystem.On("FileExists",
+			"/etc/init.d/com_example_testdaemon",
+		).Return(false, nil).Once()
+
+		status, err := openrc.Status(ctx, basicDaemonConfig.Label)
+		assert.Nil(t, err)
+		assert.False(t, status.Installed)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+	})
+}
@@ -0,0 +1,368 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The rc.d script is self-contained (rather than using the platform-specific
+// 'rc.subr' helpers) so that it works the same on FreeBSD and OpenBSD and can
+// be run by an unprivileged user. For the same reason, it is also used on
+// Linux hosts without systemd or OpenRC (e.g. containers). It accepts the FreeBSD 'one'-prefixed
+// commands so that it can also be installed system-wide without an rcvar.
+const rcdTemplate string = `#!/bin/sh
+#
+# PROVIDE: {{.Name}}
+# REQUIRE: NETWORKING
+# KEYWORD: shutdown
+#
+# {{.Description}}
+
+pidfile={{sh_escape .PidFile}}
+logfile={{sh_escape .LogFile}}
+
+is_running() {
+	[ -f "$pidfile" ] && kill -0 "$(cat "$pidfile")" 2>/dev/null
+}
+
+case "$1" in
+start|onestart|faststart)
+	if is_running; then
+		echo "{{.Name}} is already running"
+		exit 0
+	fi
+	{{- range $key, $value := .Environment}}
+	export {{sh_escape (printf "%s=%s" $key $value)}}
+	{{- end}}
+	{{- if .Limits.OpenFiles}}
+	ulimit -n {{.Limits.OpenFiles}}
+	{{- end}}
+	nohup {{sh_escape .Program}}{{range .Arguments}} {{sh_escape .}}{{end}} >>"$logfile" 2>&1 &
+	echo $! >"$pidfile"
+	;;
+stop|onestop|faststop)
+	if ! is_running; then
+		echo "{{.Name}} is not running"
+		exit 0
+	fi
+	pid="$(cat "$pidfile")"
+	kill -INT "$pid"
+
+	# Wait (up to 30s) for the graceful shutdown to finish, so that the
+	# daemon can be started again right away.
+	tries=0
+	while kill -0 "$pid" 2>/dev/null && [ "$tries" -lt 30 ]; do
+		sleep 1
+		tries=$((tries + 1))
+	done
+	rm -f "$pidfile"
+	;;
+status|onestatus)
+	if is_running; then
+		echo "{{.Name}} is running as pid $(cat "$pidfile")"
+	else
+		echo "{{.Name}} is not running"
+		exit 1
+	fi
+	;;
+restart|onerestart)
+	/bin/sh "$0" stop && /bin/sh "$0" start
+	;;
+*)
+	echo "Usage: $0 {start|stop|restart|status}" >&2
+	exit 1
+	;;
+esac
+`
+
+type rcdConfig struct {
+	DaemonConfig
+	Name    string
+	PidFile string
+	LogFile string
+}
+
+type rcd struct {
+	logger     log.TraceLogger
+	user       common.UserProvider
+	cmdExec    cmd.CommandExecutor
+	fileSystem common.FileSystem
+}
+
+func NewRcdProvider(
+	l log.TraceLogger,
+	u common.UserProvider,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+) DaemonProvider {
+	return &rcd{
+		logger:     l,
+		user:       u,
+		cmdExec:    c,
+		fileSystem: fs,
+	}
+}
+
+// rcdName converts a daemon label into a valid rc.d script name (which must
+// also be usable as a shell variable name).
+func rcdName(label string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, label)
+}
+
+func (r *rcd) scriptDir() (string, error) {
+	user, err := r.user.CurrentUser()
+	if err != nil {
+		return "", fmt.Errorf("could not get current user for rc.d service: %w", err)
+	}
+	return filepath.Join(user.HomeDir, ".config", "rc.d"), nil
+}
+
+func (r *rcd) runScript(ctx context.Context, label string, command string) (int, error) {
+	dir, err := r.scriptDir()
+	if err != nil {
+		return -1, r.logger.Error(ctx, err)
+	}
+
+	exitCode, err := r.cmdExec.RunQuiet(ctx, "/bin/sh", filepath.Join(dir, rcdName(label)), command)
+	if err != nil {
+		return -1, r.logger.Error(ctx, err)
+	}
+	return exitCode, nil
+}
+
+func (r *rcd) Create(ctx context.Context, config *DaemonConfig, force bool) error {
+	dir, err := r.scriptDir()
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	name := rcdName(config.Label)
+	rConfig := &rcdConfig{
+		DaemonConfig: *config,
+		Name:         name,
+		PidFile:      filepath.Join(dir, fmt.Sprintf("%s.pid", name)),
+		LogFile:      filepath.Join(dir, fmt.Sprintf("%s.log", name)),
+	}
+
+	// Generate the configuration
+	var newScript bytes.Buffer
+	t, err := template.New(name).Funcs(template.FuncMap{
+		"sh_escape": func(str string) string {
+			return fmt.Sprintf("'%s'", strings.ReplaceAll(str, "'", `'\''`))
+		},
+	}).Parse(rcdTemplate)
+	if err != nil {
+		return r.logger.Errorf(ctx, "unable to generate rc.d configuration: %w", err)
+	}
+	t.Execute(&newScript, rConfig)
+
+	filename := filepath.Join(dir, name)
+
+	// Check whether the file exists
+	fileExists, err := r.fileSystem.FileExists(filename)
+	if err != nil {
+		return r.logger.Errorf(ctx, "could not determine whether rc.d script '%s' exists: %w", name, err)
+	}
+
+	if !force && fileExists {
+		// File already exists and we aren't forcing a refresh, so we do nothing
+		return nil
+	}
+
+	err = r.fileSystem.WriteFile(filename, newScript.Bytes())
+	if err != nil {
+		return r.logger.Errorf(ctx, "unable to write rc.d script: %w", err)
+	}
+
+	return nil
+}
+
+func (r *rcd) Start(ctx context.Context, label string) error {
+	exitCode, err := r.runScript(ctx, label, "start")
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		return r.logger.Errorf(ctx, "rc.d script 'start' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (r *rcd) Stop(ctx context.Context, label string) error {
+	dir, err := r.scriptDir()
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	// Don't throw an error if the service was never created
+	fileExists, err := r.fileSystem.FileExists(filepath.Join(dir, rcdName(label)))
+	if err != nil {
+		return r.logger.Errorf(ctx, "could not determine whether rc.d script exists: %w", err)
+	} else if !fileExists {
+		return nil
+	}
+
+	exitCode, err := r.runScript(ctx, label, "stop")
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		return r.logger.Errorf(ctx, "rc.d script 'stop' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (r *rcd) Restart(ctx context.Context, label string) error {
+	exitCode, err := r.runScript(ctx, label, "restart")
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		return r.logger.Errorf(ctx, "rc.d script 'restart' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (r *rcd) Status(ctx context.Context, label string) (*DaemonStatus, error) {
+	dir, err := r.scriptDir()
+	if err != nil {
+		return nil, r.logger.Error(ctx, err)
+	}
+
+	fileExists, err := r.fileSystem.FileExists(filepath.Join(dir, rcdName(label)))
+	if err != nil {
+		return nil, r.logger.Errorf(ctx, "could not determine whether rc.d script exists: %w", err)
+	} else if !fileExists {
+		return &DaemonStatus{}, nil
+	}
+
+	// The 'status' command exits with status 0 if (and only if) the daemon is
+	// running.
+	exitCode, err := r.runScript(ctx, label, "status")
+	if err != nil {
+		return nil, err
+	}
+
+	name := rcdName(label)
+	status := &DaemonStatus{
+		Installed: true,
+		Running:   exitCode == 0,
+		State:     "not running",
+		LogPath:   filepath.Join(dir, fmt.Sprintf("%s.log", name)),
+	}
+	if !status.Running {
+		return status, nil
+	}
+	status.State = "running"
+
+	status.PID, status.StartTime = readPidFile(r.fileSystem, filepath.Join(dir, fmt.Sprintf("%s.pid", name)))
+
+	return status, nil
+}
+
+// readPidFile returns the PID in the pidfile of a running daemon and the time
+// it was started. The pidfile is written when the daemon is started, so it was
+// last modified then. Returns 0 (and the zero time) if the pidfile can't be
+// read.
+func readPidFile(fileSystem common.FileSystem, pidFile string) (int, time.Time) {
+	pid := 0
+	lines, err := fileSystem.ReadFileLines(pidFile)
+	if err == nil && len(lines) > 0 {
+		pid, _ = strconv.Atoi(strings.TrimSpace(lines[0]))
+	}
+	if pid == 0 {
+		return 0, time.Time{}
+	}
+
+	startTime := time.Time{}
+	if info, err := fileSystem.Stat(pidFile); err == nil {
+		startTime = info.ModTime()
+	}
+	return pid, startTime
+}
+
+func (r *rcd) Logs(ctx context.Context, label string, options LogOptions, w io.Writer) error {
+	dir, err := r.scriptDir()
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	// The rc.d script appends the output of the daemon to its log file.
+	err = tailLogFile(ctx, r.cmdExec, r.fileSystem, filepath.Join(dir, fmt.Sprintf("%s.log", rcdName(label))), options, w)
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	return nil
+}
+
+// tailLogFile writes the lines of the log file of a daemon selected by
+// 'options' to 'w', with 'tail'.
+func tailLogFile(
+	ctx context.Context,
+	cmdExec cmd.CommandExecutor,
+	fileSystem common.FileSystem,
+	logFile string,
+	options LogOptions,
+	w io.Writer,
+) error {
+	fileExists, err := fileSystem.FileExists(logFile)
+	if err != nil {
+		return fmt.Errorf("could not determine whether log file exists: %w", err)
+	} else if !fileExists {
+		return fmt.Errorf("log file '%s' does not exist", logFile)
+	}
+
+	args := []string{"-n", strconv.Itoa(options.Lines)}
+	if options.Follow {
+		args = append(args, "-f")
+	}
+	args = append(args, logFile)
+
+	exitCode, err := cmdExec.Run(ctx, "tail", args, cmd.Stdout(w))
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		return fmt.Errorf("'tail' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (r *rcd) Remove(ctx context.Context, label string) error {
+	dir, err := r.scriptDir()
+	if err != nil {
+		return r.logger.Error(ctx, err)
+	}
+
+	_, err = r.fileSystem.DeleteFile(filepath.Join(dir, rcdName(label)))
+	if err != nil {
+		return r.logger.Errorf(ctx, "could not delete rc.d script: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package daemon_test
+
+import (
+	"context"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var rcdCreateBehaviorTests = []struct {
+	title string
+
+	// Inputs
+	config *daemon.DaemonConfig
+	force  BoolArg
+
+	// Mocked responses (ordered per list!)
+	fileExists []Pair[bool, error]
+	writeFile  []error
+
+	// Expected values
+	expectErr bool
+}{
+	{
+		"Fresh rc.d script created if none exists",
+		&basicDaemonConfig,
+		Any,
+		[]Pair[bool, error]{NewPair[bool, error](false, nil)}, // file exists
+		[]error{nil}, // write file
+		false,
+	},
+	{
+		"rc.d script exists, doesn't write file",
+		&basicDaemonConfig,
+		False,
+		[]Pair[bool, error]{NewPair[bool, error](true, nil)}, // file exists
+		[]error{}, // write file
+		false,
+	},
+	{
+		"'force' option overwrites rc.d script",
+		&basicDaemonConfig,
+		True,
+		[]Pair[bool, error]{NewPair[bool, error](true, nil)}, // file exists
+		[]error{nil}, // write file
+		false,
+	},
+}
+
+var rcdCreateScriptTests = []struct {
+	title string
+
+	// Inputs
+	config *daemon.DaemonConfig
+
+	// Expected values
+	expectedFilename string
+	expectedLines    []string
+}{
+	{
+		title:            "Created script uses sanitized name",
+		config:           &basicDaemonConfig,
+		expectedFilename: "com_example_testdaemon",
+		expectedLines: []string{
+			"# PROVIDE: com_example_testdaemon",
+			"# Test service",
+			"pidfile='/my/test/dir/.config/rc.d/com_example_testdaemon.pid'",
+			"logfile='/my/test/dir/.config/rc.d/com_example_testdaemon.log'",
+			"nohup '/usr/local/bin/test/git-bundle-web-server' >>\"$logfile\" 2>&1 &",
+		},
+	},
+	{
+		title: "Created script captures args, quoted and escaped",
+		config: &daemon.DaemonConfig{
+			Label:   "test-escape",
+			Program: "/path/to/the/program with a space",
+			Arguments: []string{
+				"--my-option",
+				"an arg with single quotes ' and spaces!",
+			},
+		},
+		expectedFilename: "test_escape",
+		expectedLines: []string{
+			`nohup '/path/to/the/program with a space' '--my-option' 'an arg with single quotes '\'' and spaces!' >>"$logfile" 2>&1 &`,
+		},
+	}, {
+		title: "Created script sets environment and open file limit",
+		config: &daemon.DaemonConfig{
+			Label:       "test-env",
+			Program:     "/path/to/the/program",
+			Environment: map[string]string{"HTTPS_PROXY": "http://proxy:3128", "GIT_TRACE2_EVENT": "/tmp/trace 1"},
+			Limits:      daemon.ResourceLimits{OpenFiles: 65536},
+		},
+		expectedFilename: "test_env",
+		expectedLines: []string{
+			"export 'GIT_TRACE2_EVENT=/tmp/trace 1'",
+			"export 'HTTPS_PROXY=http://proxy:3128'",
+			"ulimit -n 65536",
+		},
+	},
+}
+
+func TestRcd_Create(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	testCommandExecutor := &MockCommandExecutor{}
+
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	rcd := daemon.NewRcdProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	for _, tt := range rcdCreateBehaviorTests {
+		forceArg := tt.force.ToBoolList()
+		for _, force := range forceArg {
+			t.Run(fmt.Sprintf("%s (force='%t')", tt.title, force), func(t *testing.T) {
+				// Mock responses
+				for _, retVal := range tt.fileExists {
+					testFileSystem.On("FileExists",
+						mock.AnythingOfType("string"),
+					).Return(retVal.First, retVal.Second).Once()
+				}
+				for _, retVal := range tt.writeFile {
+					testFileSystem.On("WriteFile",
+						mock.AnythingOfType("string"),
+						mock.Anything,
+					).Return(retVal).Once()
+				}
+
+				// Run "Create"
+				err := rcd.Create(ctx, tt.config, force)
+
+				// Assert on expected values
+				if tt.expectErr {
+					assert.NotNil(t, err)
+				} else {
+					assert.Nil(t, err)
+				}
+				mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+				// Reset mocks
+				testCommandExecutor.Mock = mock.Mock{}
+				testFileSystem.Mock = mock.Mock{}
+			})
+		}
+	}
+
+	// Verify content of created file
+	for _, tt := range rcdCreateScriptTests {
+		t.Run(tt.title, func(t *testing.T) {
+			var actualFilename string
+			var actualFileBytes []byte
+
+			// Mock responses for successful fresh write
+			testFileSystem.On("FileExists",
+				mock.AnythingOfType("string"),
+			).Return(false, nil).Once()
+			testFileSystem.On("WriteFile",
+				mock.MatchedBy(func(filename string) bool {
+					actualFilename = filename
+					return true
+				}),
+				mock.MatchedBy(func(fileBytes any) bool {
+					// Save off value and always match
+					actualFileBytes = fileBytes.([]byte)
+					return true
+				}),
+			).Return(nil).Once()
+
+			err := rcd.Create(ctx, tt.config, false)
+			assert.Nil(t, err)
+			mock.AssertExpectationsForObjects(t, testFileSystem)
+
+			// Check filename
+			assert.Equal(t, filepath.Join("/my/test/dir/.config/rc.d", tt.expectedFilename), actualFilename)
+
+			// Check script content
+			scriptLines := strings.Split(string(actualFileBytes), "\n")
+			assert.Equal(t, "#!/bin/sh", scriptLines[0])
+			for i := range scriptLines {
+				scriptLines[i] = strings.TrimSpace(scriptLines[i])
+			}
+			for _, line := range tt.expectedLines {
+				assert.Contains(t, scriptLines, line)
+			}
+
+			// Reset mocks
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
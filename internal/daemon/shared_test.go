@@ -1,7 +1,11 @@
 package daemon_test
 
 import (
+	"io"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
+	"github.com/stretchr/testify/mock"
 )
 
 /*********************************************/
@@ -13,3 +17,19 @@ var basicDaemonConfig = daemon.DaemonConfig{
 	Description: "Test service",
 	Program:     "/usr/local/bin/test/git-bundle-web-server",
 }
+
+/*********************************************/
+/****************** Helpers ******************/
+/*********************************************/
+
+// writeStdout returns a function for 'mock.Call.Run' writing the given output
+// to the stdout of a mocked 'CommandExecutor.Run'.
+func writeStdout(output string) func(mock.Arguments) {
+	return func(args mock.Arguments) {
+		for _, setting := range args.Get(3).([]cmd.Setting) {
+			if setting.Key == cmd.StdoutKey {
+				setting.Value.(io.Writer).Write([]byte(output))
+			}
+		}
+	}
+}
@@ -4,23 +4,108 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
 )
 
+// If the service is restarted (see 'DaemonConfig.RestartPolicy'), it is never
+// given up on ('StartLimitIntervalSec=0'); instead, the delay between restarts
+// grows from 5 seconds to 5 minutes. (Versions of systemd older than 254 ignore
+// 'RestartSteps' and 'RestartMaxDelaySec', always waiting 5 seconds.)
 const serviceTemplate string = `[Unit]
 Description={{.Description}}
+{{- if .SocketPort}}
+Requires={{.Label}}.socket
+After={{.Label}}.socket
+{{- end}}
+{{- if .RestartPolicy}}
+StartLimitIntervalSec=0
+{{- end}}
 
 [Service]
 Type=simple
-ExecStart={{sq_escape .Program}}{{range .Arguments}} {{sq_escape .}}{{end}}
+{{- if .User}}
+User={{.User}}
+{{- end}}
+{{template "exec_start" .}}
+{{- if .RestartPolicy}}
+Restart={{.RestartPolicy}}
+RestartSec=5s
+RestartSteps=6
+RestartMaxDelaySec=5min
+{{- end}}
+{{- range $key, $value := .Environment}}
+Environment={{dq_escape (printf "%s=%s" $key $value)}}
+{{- end}}
+{{- if .Limits.OpenFiles}}
+LimitNOFILE={{.Limits.OpenFiles}}
+{{- end}}
+{{- if .Limits.Memory}}
+MemoryMax={{.Limits.Memory}}
+{{- end}}
+{{- if .User}}
+
+[Install]
+WantedBy=multi-user.target
+{{- end}}
+`
+
+const socketTemplate string = `[Unit]
+Description={{.Description}} (socket)
+
+[Socket]
+ListenStream={{.SocketPort}}
+{{- if .User}}
+
+[Install]
+WantedBy=sockets.target
+{{- end}}
 `
 
+// The 'ExecStart=' line of a unit running '.Program' with '.Arguments'.
+const execStartTemplate string = `{{define "exec_start"}}ExecStart={{sq_escape .Program}}{{range .Arguments}} {{sq_escape .}}{{end}}{{end}}`
+
+// NewSystemdUnitTemplate parses the template of a systemd unit file. The
+// template can quote values with the 'sq_escape' and 'dq_escape' functions, and
+// write the 'ExecStart=' line running '.Program' with '.Arguments' with the
+// 'exec_start' template.
+func NewSystemdUnitTemplate(name string, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(template.FuncMap{
+		"sq_escape": func(str string) string {
+			return fmt.Sprintf("'%s'", strings.ReplaceAll(str, "'", "\\'"))
+		},
+		"dq_escape": func(str string) string {
+			// Unit files expand specifiers (e.g. '%h') in quoted values, too.
+			str = strings.ReplaceAll(str, "%", "%%")
+			return strconv.Quote(str)
+		},
+	}).Parse(execStartTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return t.Parse(text)
+}
+
+// The directory of the unit files of system services.
+const systemdSystemUnitDir string = "/etc/systemd/system"
+
+// systemdConfig is the configuration from which a service's unit files are
+// generated.
+type systemdConfig struct {
+	DaemonConfig
+
+	// The user as which a system service is run (empty for user services).
+	User string
+}
+
 const SystemdUnitNotInstalledErrorCode int = 5
 
 type systemd struct {
@@ -28,6 +113,10 @@ type systemd struct {
 	user       common.UserProvider
 	cmdExec    cmd.CommandExecutor
 	fileSystem common.FileSystem
+
+	// If non-empty, the service is a system service (rather than a service of
+	// the current user's service manager) run as this user.
+	systemUser string
 }
 
 func NewSystemdProvider(
@@ -44,38 +133,91 @@ func NewSystemdProvider(
 	}
 }
 
+// NewSystemdSystemProvider returns a provider of system services, which are
+// enabled to start at boot and run as 'systemUser'. Managing them requires
+// root.
+func NewSystemdSystemProvider(
+	l log.TraceLogger,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+	systemUser string,
+) DaemonProvider {
+	return &systemd{
+		logger:     l,
+		cmdExec:    c,
+		fileSystem: fs,
+		systemUser: systemUser,
+	}
+}
+
+// scopeArgs returns the arguments selecting the service manager of the
+// services, to be passed to 'systemctl' and 'journalctl'.
+func (s *systemd) scopeArgs(args ...string) []string {
+	if s.systemUser != "" {
+		return args
+	}
+	return append([]string{"--user"}, args...)
+}
+
+// systemctl runs 'systemctl' with the given arguments against the service
+// manager of the services, returning its exit code.
+func (s *systemd) systemctl(ctx context.Context, args ...string) (int, error) {
+	return s.cmdExec.RunQuiet(ctx, "systemctl", s.scopeArgs(args...)...)
+}
+
+func (s *systemd) unitFile(label string) (string, error) {
+	return s.unitFileOfType(label, "service")
+}
+
+// socketUnitFile returns the path of the socket unit with which the service
+// unit 'label' is socket-activated (see 'DaemonConfig.SocketPort').
+func (s *systemd) socketUnitFile(label string) (string, error) {
+	return s.unitFileOfType(label, "socket")
+}
+
+func (s *systemd) unitFileOfType(label string, unitType string) (string, error) {
+	if s.systemUser != "" {
+		return filepath.Join(systemdSystemUnitDir, fmt.Sprintf("%s.%s", label, unitType)), nil
+	}
+
+	user, err := s.user.CurrentUser()
+	if err != nil {
+		return "", fmt.Errorf("could not get current user for systemd service: %w", err)
+	}
+	return filepath.Join(user.HomeDir, ".config", "systemd", "user", fmt.Sprintf("%s.%s", label, unitType)), nil
+}
+
 func (s *systemd) reloadDaemon(ctx context.Context) error {
-	exitCode, err := s.cmdExec.RunQuiet(ctx, "systemctl", "--user", "daemon-reload")
+	exitCode, err := s.systemctl(ctx, "daemon-reload")
 	if err != nil {
 		return s.logger.Error(ctx, err)
 	}
 
 	if exitCode != 0 {
-		return s.logger.Errorf(ctx, "'systemctl --user daemon-reload' exited with status %d", exitCode)
+		return s.logger.Errorf(ctx, "'systemctl daemon-reload' exited with status %d", exitCode)
 	}
 
 	return nil
 }
 
 func (s *systemd) Create(ctx context.Context, config *DaemonConfig, force bool) error {
-	user, err := s.user.CurrentUser()
-	if err != nil {
-		return s.logger.Errorf(ctx, "could not get current user for systemd service: %w", err)
+	sConfig := &systemdConfig{
+		DaemonConfig: *config,
+		User:         s.systemUser,
 	}
 
 	// Generate the configuration
 	var newServiceUnit bytes.Buffer
-	t, err := template.New(config.Label).Funcs(template.FuncMap{
-		"sq_escape": func(str string) string {
-			return fmt.Sprintf("'%s'", strings.ReplaceAll(str, "'", "\\'"))
-		},
-	}).Parse(serviceTemplate)
+	t, err := NewSystemdUnitTemplate(config.Label, serviceTemplate)
 	if err != nil {
 		return s.logger.Errorf(ctx, "unable to generate systemd configuration: %w", err)
 	}
-	t.Execute(&newServiceUnit, config)
+	t.Execute(&newServiceUnit, sConfig)
 
-	filename := filepath.Join(user.HomeDir, ".config", "systemd", "user", fmt.Sprintf("%s.service", config.Label))
+	filename, err := s.unitFile(config.Label)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
 
 	// Check whether the file exists
 	fileExists, err := s.fileSystem.FileExists(filename)
@@ -94,24 +236,85 @@ func (s *systemd) Create(ctx context.Context, config *DaemonConfig, force bool)
 		return s.logger.Errorf(ctx, "unable to write service unit: %w", err)
 	}
 
-	// Reload the user-scoped service units after adding
+	// Write the socket unit from which the service is activated, if any. The
+	// service unit requires it, so it is started along with the service, but
+	// is not restarted with it.
+	if config.SocketPort != 0 {
+		var newSocketUnit bytes.Buffer
+		t, err := NewSystemdUnitTemplate(config.Label+".socket", socketTemplate)
+		if err != nil {
+			return s.logger.Errorf(ctx, "unable to generate systemd configuration: %w", err)
+		}
+		t.Execute(&newSocketUnit, sConfig)
+
+		socketFilename, err := s.socketUnitFile(config.Label)
+		if err != nil {
+			return s.logger.Error(ctx, err)
+		}
+		err = s.fileSystem.WriteFile(socketFilename, newSocketUnit.Bytes())
+		if err != nil {
+			return s.logger.Errorf(ctx, "unable to write socket unit: %w", err)
+		}
+	}
+
+	// Reload the service units after adding
 	err = s.reloadDaemon(ctx)
 	if err != nil {
 		return s.logger.Error(ctx, err)
 	}
 
+	// Enable system services, so that they are started at boot.
+	if s.systemUser != "" {
+		err = s.setEnabled(ctx, config.Label, true)
+		if err != nil {
+			return s.logger.Error(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// setEnabled enables (or disables) the system service 'label' and its socket
+// unit (if any) to start at boot.
+func (s *systemd) setEnabled(ctx context.Context, label string, enable bool) error {
+	units := []string{label}
+	socketFilename, err := s.socketUnitFile(label)
+	if err != nil {
+		return err
+	}
+	socketExists, err := s.fileSystem.FileExists(socketFilename)
+	if err != nil {
+		return fmt.Errorf("could not determine whether socket unit '%s' exists: %w", label, err)
+	}
+	if socketExists {
+		units = append([]string{label + ".socket"}, units...)
+	}
+
+	verb := "enable"
+	if !enable {
+		verb = "disable"
+	}
+	exitCode, err := s.systemctl(ctx, append([]string{verb}, units...)...)
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 && (enable || exitCode != SystemdUnitNotInstalledErrorCode) {
+		return fmt.Errorf("'systemctl %s' exited with status %d", verb, exitCode)
+	}
+
 	return nil
 }
 
 func (s *systemd) Start(ctx context.Context, label string) error {
 	// TODO: warn user if already running
-	exitCode, err := s.cmdExec.RunQuiet(ctx, "systemctl", "--user", "start", label)
+	exitCode, err := s.systemctl(ctx, "start", label)
 	if err != nil {
 		return s.logger.Error(ctx, err)
 	}
 
 	if exitCode != 0 {
-		return s.logger.Errorf(ctx, "'systemctl stop' exited with status %d", exitCode)
+		return s.logger.Errorf(ctx, "'systemctl start' exited with status %d", exitCode)
 	}
 
 	return nil
@@ -119,7 +322,9 @@ func (s *systemd) Start(ctx context.Context, label string) error {
 
 func (s *systemd) Stop(ctx context.Context, label string) error {
 	// TODO: warn user if already stopped
-	exitCode, err := s.cmdExec.RunQuiet(ctx, "systemctl", "--user", "stop", label)
+	// Stop the service's socket unit (if any) first, so that a connection
+	// doesn't start the service again.
+	exitCode, err := s.systemctl(ctx, "stop", label+".socket", label)
 	if err != nil {
 		return s.logger.Error(ctx, err)
 	}
@@ -131,19 +336,148 @@ func (s *systemd) Stop(ctx context.Context, label string) error {
 	return nil
 }
 
+func (s *systemd) Restart(ctx context.Context, label string) error {
+	exitCode, err := s.systemctl(ctx, "restart", label)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	if exitCode != 0 {
+		return s.logger.Errorf(ctx, "'systemctl restart' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (s *systemd) Status(ctx context.Context, label string) (*DaemonStatus, error) {
+	filename, err := s.unitFile(label)
+	if err != nil {
+		return nil, s.logger.Error(ctx, err)
+	}
+
+	installed, err := s.fileSystem.FileExists(filename)
+	if err != nil {
+		return nil, s.logger.Errorf(ctx, "could not determine whether service unit '%s' exists: %w", label, err)
+	}
+
+	var output bytes.Buffer
+	exitCode, err := s.cmdExec.Run(ctx, "systemctl",
+		s.scopeArgs("show", label, "--property="+strings.Join(systemdStatusProperties, ",")),
+		cmd.Stdout(&output))
+	if err != nil {
+		return nil, s.logger.Error(ctx, err)
+	}
+
+	if exitCode != 0 {
+		return nil, s.logger.Errorf(ctx, "'systemctl show' exited with status %d", exitCode)
+	}
+
+	status := parseSystemdStatus(output.String())
+	status.Installed = installed
+	return status, nil
+}
+
+// The unit properties from which the status of a service is read (see
+// 'parseSystemdStatus').
+var systemdStatusProperties = []string{
+	"ActiveState",
+	"SubState",
+	"MainPID",
+	"ExecMainStartTimestamp",
+	"ExecMainExitTimestamp",
+	"ExecMainStatus",
+}
+
+// The format of timestamps in the output of 'systemctl show'.
+const systemdTimestampFormat string = "Mon 2006-01-02 15:04:05 MST"
+
+// parseSystemdStatus reads the status of a service from the 'key=value' lines
+// of the output of 'systemctl show'.
+func parseSystemdStatus(output string) *DaemonStatus {
+	properties := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if found {
+			properties[key] = value
+		}
+	}
+
+	status := &DaemonStatus{
+		State: properties["ActiveState"],
+	}
+	if subState := properties["SubState"]; subState != "" {
+		status.State = fmt.Sprintf("%s (%s)", status.State, subState)
+	}
+
+	// 'is-active' reports units in these states as active.
+	activeState := properties["ActiveState"]
+	status.Running = activeState == "active" || activeState == "reloading"
+
+	if pid, err := strconv.Atoi(properties["MainPID"]); err == nil && status.Running {
+		status.PID = pid
+	}
+	if startTime, err := time.Parse(systemdTimestampFormat, properties["ExecMainStartTimestamp"]); err == nil && status.Running {
+		status.StartTime = startTime
+	}
+
+	// The exit code is only meaningful if the program has exited.
+	if properties["ExecMainExitTimestamp"] != "" {
+		if exitCode, err := strconv.Atoi(properties["ExecMainStatus"]); err == nil {
+			status.LastExitCode = &exitCode
+		}
+	}
+
+	return status
+}
+
+func (s *systemd) Logs(ctx context.Context, label string, options LogOptions, w io.Writer) error {
+	args := s.scopeArgs("--unit", label, "--no-pager", "--lines", strconv.Itoa(options.Lines))
+	if options.Follow {
+		args = append(args, "--follow")
+	}
+
+	exitCode, err := s.cmdExec.Run(ctx, "journalctl", args, cmd.Stdout(w))
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	if exitCode != 0 {
+		return s.logger.Errorf(ctx, "'journalctl' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
 func (s *systemd) Remove(ctx context.Context, label string) error {
-	user, err := s.user.CurrentUser()
+	filename, err := s.unitFile(label)
 	if err != nil {
-		return s.logger.Errorf(ctx, "could not get current user for launchd service: %w", err)
+		return s.logger.Error(ctx, err)
+	}
+
+	// Disable system services before removing their units, which 'systemctl
+	// disable' reads to find what to disable.
+	if s.systemUser != "" {
+		err = s.setEnabled(ctx, label, false)
+		if err != nil {
+			return s.logger.Error(ctx, err)
+		}
 	}
-	filename := filepath.Join(user.HomeDir, ".config", "systemd", "user", fmt.Sprintf("%s.service", label))
 
 	_, err = s.fileSystem.DeleteFile(filename)
 	if err != nil {
 		return s.logger.Errorf(ctx, "could not delete service unit: %w", err)
 	}
 
-	// Reload the user-scoped service units after removing
+	socketFilename, err := s.socketUnitFile(label)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+	_, err = s.fileSystem.DeleteFile(socketFilename)
+	if err != nil {
+		return s.logger.Errorf(ctx, "could not delete socket unit: %w", err)
+	}
+
+	// Reload the service units after removing
 	err = s.reloadDaemon(ctx)
 	if err != nil {
 		return s.logger.Error(ctx, err)
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
 	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
@@ -76,6 +77,7 @@ var systemdCreateServiceUnitTests = []struct {
 
 	// Expected values
 	expectedServiceUnitLines []string
+	expectedSocketUnitLines  []string
 }{
 	{
 		title:  "Created service unit contents are correct",
@@ -122,6 +124,73 @@ var systemdCreateServiceUnitTests = []struct {
 			"ExecStart='/path/to/the/program with a space' '--my-option' 'an arg with double quotes \", single quotes \\', and spaces!'",
 		},
 	},
+	{
+		title: "Socket-activated service unit requires socket unit",
+		config: &daemon.DaemonConfig{
+			Label:       "test-socket",
+			Description: "A socket-activated program",
+			Program:     "/path/to/the/program",
+			SocketPort:  8080,
+		},
+		expectedServiceUnitLines: []string{
+			"[Unit]",
+			"Description=A socket-activated program",
+			"Requires=test-socket.socket",
+			"After=test-socket.socket",
+			"[Service]",
+			"Type=simple",
+			"ExecStart='/path/to/the/program'",
+		},
+		expectedSocketUnitLines: []string{
+			"[Unit]",
+			"Description=A socket-activated program (socket)",
+			"[Socket]",
+			"ListenStream=8080",
+		},
+	}, {
+		title: "Service unit restarts with backoff",
+		config: &daemon.DaemonConfig{
+			Label:         "test-restart",
+			Description:   "A restarted program",
+			Program:       "/path/to/the/program",
+			RestartPolicy: daemon.RestartAlways,
+		},
+		expectedServiceUnitLines: []string{
+			"[Unit]",
+			"Description=A restarted program",
+			"StartLimitIntervalSec=0",
+			"[Service]",
+			"Type=simple",
+			"ExecStart='/path/to/the/program'",
+			"Restart=always",
+			"RestartSec=5s",
+			"RestartSteps=6",
+			"RestartMaxDelaySec=5min",
+		},
+	}, {
+		title: "Service unit sets environment and resource limits",
+		config: &daemon.DaemonConfig{
+			Label:       "test-env",
+			Description: "A program with limits",
+			Program:     "/path/to/the/program",
+			Environment: map[string]string{
+				"GIT_TRACE2_EVENT": "/home/user/%h trace.json",
+				"HTTPS_PROXY":      "http://proxy:3128",
+			},
+			Limits: daemon.ResourceLimits{OpenFiles: 65536, Memory: 1 << 30},
+		},
+		expectedServiceUnitLines: []string{
+			"[Unit]",
+			"Description=A program with limits",
+			"[Service]",
+			"Type=simple",
+			"ExecStart='/path/to/the/program'",
+			`Environment="GIT_TRACE2_EVENT=/home/user/%%h trace.json"`,
+			`Environment="HTTPS_PROXY=http://proxy:3128"`,
+			"LimitNOFILE=65536",
+			"MemoryMax=1073741824",
+		},
+	},
 }
 
 func TestSystemd_Create(t *testing.T) {
@@ -190,6 +259,8 @@ func TestSystemd_Create(t *testing.T) {
 		t.Run(tt.title, func(t *testing.T) {
 			var actualFilename string
 			var actualFileBytes []byte
+			var actualSocketFilename string
+			var actualSocketFileBytes []byte
 
 			// Mock responses for successful fresh write
 			testCommandExecutor.On("RunQuiet",
@@ -204,6 +275,9 @@ func TestSystemd_Create(t *testing.T) {
 			// Use mock to save off input args
 			testFileSystem.On("WriteFile",
 				mock.MatchedBy(func(filename string) bool {
+					if !strings.HasSuffix(filename, ".service") {
+						return false
+					}
 					actualFilename = filename
 					return true
 				}),
@@ -213,6 +287,21 @@ func TestSystemd_Create(t *testing.T) {
 					return true
 				}),
 			).Return(nil).Once()
+			if tt.expectedSocketUnitLines != nil {
+				testFileSystem.On("WriteFile",
+					mock.MatchedBy(func(filename string) bool {
+						if !strings.HasSuffix(filename, ".socket") {
+							return false
+						}
+						actualSocketFilename = filename
+						return true
+					}),
+					mock.MatchedBy(func(fileBytes any) bool {
+						actualSocketFileBytes = fileBytes.([]byte)
+						return true
+					}),
+				).Return(nil).Once()
+			}
 
 			err := systemd.Create(ctx, tt.config, false)
 			assert.Nil(t, err)
@@ -230,6 +319,16 @@ func TestSystemd_Create(t *testing.T) {
 				regexp.MustCompile(`\n+`).ReplaceAllString(fileContents, "\n"), "\n")
 			assert.ElementsMatch(t, tt.expectedServiceUnitLines, serviceUnitLines)
 
+			// Check the socket unit, if any
+			if tt.expectedSocketUnitLines != nil {
+				expectedSocketFilename := filepath.Clean(fmt.Sprintf("/my/test/dir/.config/systemd/user/%s.socket", tt.config.Label))
+				assert.Equal(t, expectedSocketFilename, actualSocketFilename)
+
+				socketUnitLines := strings.Split(
+					regexp.MustCompile(`\n+`).ReplaceAllString(strings.TrimSpace(string(actualSocketFileBytes)), "\n"), "\n")
+				assert.ElementsMatch(t, tt.expectedSocketUnitLines, socketUnitLines)
+			}
+
 			// Reset mocks
 			testCommandExecutor.Mock = mock.Mock{}
 			testFileSystem.Mock = mock.Mock{}
@@ -306,7 +405,7 @@ func TestSystemd_Stop(t *testing.T) {
 		testCommandExecutor.On("RunQuiet",
 			ctx,
 			"systemctl",
-			[]string{"--user", "stop", basicDaemonConfig.Label},
+			[]string{"--user", "stop", basicDaemonConfig.Label + ".socket", basicDaemonConfig.Label},
 		).Return(0, nil).Once()
 
 		err := systemd.Stop(ctx, basicDaemonConfig.Label)
@@ -405,12 +504,18 @@ func TestSystemd_Remove(t *testing.T) {
 		t.Run(tt.title, func(t *testing.T) {
 			// Setup expected values
 			expectedFilename := filepath.Clean(fmt.Sprintf("/my/test/dir/.config/systemd/user/%s.service", tt.label))
+			expectedSocketFilename := filepath.Clean(fmt.Sprintf("/my/test/dir/.config/systemd/user/%s.socket", tt.label))
 
 			// Mock responses
 			if tt.deleteFile != nil {
 				testFileSystem.On("DeleteFile",
 					expectedFilename,
 				).Return(tt.deleteFile.First, tt.deleteFile.Second).Once()
+				if tt.deleteFile.Second == nil {
+					testFileSystem.On("DeleteFile",
+						expectedSocketFilename,
+					).Return(false, nil).Once()
+				}
 			}
 			if tt.systemctlDaemonReload != nil {
 				testCommandExecutor.On("RunQuiet",
@@ -422,7 +527,7 @@ func TestSystemd_Remove(t *testing.T) {
 
 			// Call function
 			err := systemd.Remove(ctx, tt.label)
-			mock.AssertExpectationsForObjects(t, testCommandExecutor)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
 			if tt.expectErr {
 				assert.NotNil(t, err)
 			} else {
@@ -435,3 +540,251 @@ func TestSystemd_Remove(t *testing.T) {
 		testFileSystem.Mock = mock.Mock{}
 	}
 }
+
+func TestSystemd_Restart(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testCommandExecutor := &MockCommandExecutor{}
+
+	ctx := context.Background()
+
+	systemd := daemon.NewSystemdProvider(testLogger, nil, testCommandExecutor, nil)
+
+	// Test #1: systemctl succeeds
+	t.Run("Calls correct systemctl command", func(t *testing.T) {
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"systemctl",
+			[]string{"--user", "restart", basicDaemonConfig.Label},
+		).Return(0, nil).Once()
+
+		err := systemd.Restart(ctx, basicDaemonConfig.Label)
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor)
+	})
+
+	// Reset the mock structure between tests
+	testCommandExecutor.Mock = mock.Mock{}
+
+	// Test #2: systemctl fails
+	t.Run("Returns error when systemctl fails", func(t *testing.T) {
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			mock.AnythingOfType("string"),
+			mock.AnythingOfType("[]string"),
+		).Return(1, nil).Once()
+
+		err := systemd.Restart(ctx, basicDaemonConfig.Label)
+		assert.NotNil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor)
+	})
+}
+
+var systemdStatusTests = []struct {
+	title string
+
+	// Inputs
+	unitExists bool
+	showOutput string
+
+	// Expected values
+	expectedStatus daemon.DaemonStatus
+}{
+	{
+		"Running",
+		true,
+		"ActiveState=active\nSubState=running\nMainPID=1234\n" +
+			"ExecMainStartTimestamp=Thu 2024-01-04 10:00:00 UTC\nExecMainExitTimestamp=\nExecMainStatus=0\n",
+		daemon.DaemonStatus{
+			Installed: true,
+			Running:   true,
+			State:     "active (running)",
+			PID:       1234,
+			StartTime: time.Date(2024, 1, 4, 10, 0, 0, 0, time.UTC),
+		},
+	},
+	{
+		"Exited",
+		true,
+		"ActiveState=failed\nSubState=failed\nMainPID=0\n" +
+			"ExecMainStartTimestamp=Thu 2024-01-04 10:00:00 UTC\n" +
+			"ExecMainExitTimestamp=Thu 2024-01-04 11:00:00 UTC\nExecMainStatus=1\n",
+		daemon.DaemonStatus{
+			Installed:    true,
+			Running:      false,
+			State:        "failed (failed)",
+			LastExitCode: PtrTo(1),
+		},
+	},
+	{
+		"Not installed",
+		false,
+		"ActiveState=inactive\nSubState=dead\nMainPID=0\n" +
+			"ExecMainStartTimestamp=\nExecMainExitTimestamp=\nExecMainStatus=0\n",
+		daemon.DaemonStatus{
+			Installed: false,
+			Running:   false,
+			State:     "inactive (dead)",
+		},
+	},
+}
+
+func TestSystemd_Status(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	systemd := daemon.NewSystemdProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	for _, tt := range systemdStatusTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testFileSystem.On("FileExists",
+				filepath.Clean(fmt.Sprintf("/my/test/dir/.config/systemd/user/%s.service", basicDaemonConfig.Label)),
+			).Return(tt.unitExists, nil).Once()
+			testCommandExecutor.On("Run",
+				ctx,
+				"systemctl",
+				[]string{"--user", "show", basicDaemonConfig.Label,
+					"--property=ActiveState,SubState,MainPID,ExecMainStartTimestamp,ExecMainExitTimestamp,ExecMainStatus"},
+				mock.AnythingOfType("[]cmd.Setting"),
+			).Run(writeStdout(tt.showOutput)).Return(0, nil).Once()
+
+			status, err := systemd.Status(ctx, basicDaemonConfig.Label)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedStatus, *status)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+		})
+
+		// Reset the mocks between tests
+		testCommandExecutor.Mock = mock.Mock{}
+		testFileSystem.Mock = mock.Mock{}
+	}
+}
+
+func TestSystemd_Logs(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testCommandExecutor := &MockCommandExecutor{}
+
+	ctx := context.Background()
+
+	systemd := daemon.NewSystemdProvider(testLogger, nil, testCommandExecutor, nil)
+
+	t.Run("Calls correct journalctl command", func(t *testing.T) {
+		testCommandExecutor.On("Run",
+			ctx,
+			"journalctl",
+			[]string{"--user", "--unit", basicDaemonConfig.Label, "--no-pager", "--lines", "50", "--follow"},
+			mock.AnythingOfType("[]cmd.Setting"),
+		).Run(writeStdout("Server is running\n")).Return(0, nil).Once()
+
+		var output strings.Builder
+		err := systemd.Logs(ctx, basicDaemonConfig.Label, daemon.LogOptions{Lines: 50, Follow: true}, &output)
+		assert.Nil(t, err)
+		assert.Equal(t, "Server is running\n", output.String())
+		mock.AssertExpectationsForObjects(t, testCommandExecutor)
+	})
+}
+
+func TestSystemd_System(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	systemd := daemon.NewSystemdSystemProvider(testLogger, testCommandExecutor, testFileSystem, "git-bundle-server")
+
+	t.Run("Create writes and enables a system service unit", func(t *testing.T) {
+		var actualFileBytes []byte
+
+		testFileSystem.On("FileExists",
+			"/etc/systemd/system/com.example.testdaemon.service",
+		).Return(false, nil).Once()
+		testFileSystem.On("WriteFile",
+			"/etc/systemd/system/com.example.testdaemon.service",
+			mock.MatchedBy(func(fileBytes any) bool {
+				actualFileBytes = fileBytes.([]byte)
+				return true
+			}),
+		).Return(nil).Once()
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"systemctl",
+			[]string{"daemon-reload"},
+		).Return(0, nil).Once()
+		testFileSystem.On("FileExists",
+			"/etc/systemd/system/com.example.testdaemon.socket",
+		).Return(false, nil).Once()
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"systemctl",
+			[]string{"enable", "com.example.testdaemon"},
+		).Return(0, nil).Once()
+
+		err := systemd.Create(ctx, &basicDaemonConfig, false)
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+		fileContents := string(actualFileBytes)
+		assert.Contains(t, fileContents, "\nUser=git-bundle-server\n")
+		assert.Contains(t, fileContents, "[Install]\nWantedBy=multi-user.target\n")
+	})
+
+	// Reset the mock structure between tests
+	testCommandExecutor.Mock = mock.Mock{}
+	testFileSystem.Mock = mock.Mock{}
+
+	t.Run("Start uses the system service manager", func(t *testing.T) {
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"systemctl",
+			[]string{"start", basicDaemonConfig.Label},
+		).Return(0, nil).Once()
+
+		err := systemd.Start(ctx, basicDaemonConfig.Label)
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor)
+	})
+
+	// Reset the mock structure between tests
+	testCommandExecutor.Mock = mock.Mock{}
+
+	t.Run("Remove disables and deletes the system units", func(t *testing.T) {
+		testFileSystem.On("FileExists",
+			"/etc/systemd/system/com.example.testdaemon.socket",
+		).Return(true, nil).Once()
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"systemctl",
+			[]string{"disable", "com.example.testdaemon.socket", "com.example.testdaemon"},
+		).Return(0, nil).Once()
+		testFileSystem.On("DeleteFile",
+			"/etc/systemd/system/com.example.testdaemon.service",
+		).Return(true, nil).Once()
+		testFileSystem.On("DeleteFile",
+			"/etc/systemd/system/com.example.testdaemon.socket",
+		).Return(true, nil).Once()
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"systemctl",
+			[]string{"daemon-reload"},
+		).Return(0, nil).Once()
+
+		err := systemd.Remove(ctx, basicDaemonConfig.Label)
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+	})
+}
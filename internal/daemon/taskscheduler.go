@@ -0,0 +1,395 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/utils"
+)
+
+// Windows services run under system accounts and must implement the Service
+// Control Manager protocol, so instead (like the user-scoped systemd and
+// launchd daemons) the daemon is registered as a Task Scheduler task that runs
+// in the domain of the current user.
+
+const TaskSchedulerTaskNotFoundErrorCode int = 1
+
+// 'schtasks' is documented to accept XML task definitions in UTF-16.
+const taskXMLHeader string = `<?xml version="1.0" encoding="UTF-16"?>` + "\n"
+
+type taskRepetition struct {
+	Interval string `xml:"Interval"`
+}
+
+type taskTimeTrigger struct {
+	Repetition    taskRepetition `xml:"Repetition"`
+	StartBoundary string         `xml:"StartBoundary"`
+	Enabled       bool           `xml:"Enabled"`
+}
+
+type taskPrincipal struct {
+	Id        string `xml:"id,attr"`
+	LogonType string `xml:"LogonType"`
+	RunLevel  string `xml:"RunLevel"`
+}
+
+type taskSettings struct {
+	MultipleInstancesPolicy    string `xml:"MultipleInstancesPolicy"`
+	DisallowStartIfOnBatteries bool   `xml:"DisallowStartIfOnBatteries"`
+	StopIfGoingOnBatteries     bool   `xml:"StopIfGoingOnBatteries"`
+	StartWhenAvailable         bool   `xml:"StartWhenAvailable"`
+	ExecutionTimeLimit         string `xml:"ExecutionTimeLimit"`
+
+	RestartOnFailure *taskRestartOnFailure `xml:"RestartOnFailure,omitempty"`
+}
+
+type taskRestartOnFailure struct {
+	Interval string `xml:"Interval"`
+	Count    int    `xml:"Count"`
+}
+
+type taskExec struct {
+	Command   string `xml:"Command"`
+	Arguments string `xml:"Arguments,omitempty"`
+}
+
+type task struct {
+	XMLName     xml.Name `xml:"http://schemas.microsoft.com/windows/2004/02/mit/task Task"`
+	Version     string   `xml:"version,attr"`
+	Description string   `xml:"RegistrationInfo>Description"`
+	Triggers    struct {
+		TimeTrigger *taskTimeTrigger `xml:"TimeTrigger,omitempty"`
+	} `xml:"Triggers"`
+	Principal taskPrincipal `xml:"Principals>Principal"`
+	Settings  taskSettings  `xml:"Settings"`
+	Actions   struct {
+		Context string   `xml:"Context,attr"`
+		Exec    taskExec `xml:"Exec"`
+	} `xml:"Actions"`
+}
+
+// taskDuration formats a duration in the ISO 8601 format used by Task
+// Scheduler (e.g. 'PT15M').
+func taskDuration(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("P%dD", d/(24*time.Hour))
+	} else if d%time.Hour == 0 {
+		return fmt.Sprintf("PT%dH", d/time.Hour)
+	}
+	return fmt.Sprintf("PT%dM", d/time.Minute)
+}
+
+// quoteWindowsArg quotes an argument so that it is parsed back into the same
+// string by the Windows C runtime (see 'CommandLineToArgvW').
+func quoteWindowsArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"") {
+		return arg
+	}
+
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	backslashes := 0
+	for _, c := range arg {
+		switch c {
+		case '\\':
+			backslashes++
+		case '"':
+			// Escape the preceding backslashes (already written once) and
+			// the quote itself
+			quoted.WriteString(strings.Repeat("\\", backslashes+1))
+			backslashes = 0
+		default:
+			backslashes = 0
+		}
+		quoted.WriteRune(c)
+	}
+	// Escape trailing backslashes so they don't escape the closing quote
+	quoted.WriteString(strings.Repeat("\\", backslashes))
+	quoted.WriteByte('"')
+	return quoted.String()
+}
+
+func (c *DaemonConfig) toTask() *task {
+	t := &task{
+		Version:     "1.2",
+		Description: c.Description,
+		Principal: taskPrincipal{
+			Id:        "Author",
+			LogonType: "InteractiveToken",
+			RunLevel:  "LeastPrivilege",
+		},
+		Settings: taskSettings{
+			MultipleInstancesPolicy:    "IgnoreNew",
+			DisallowStartIfOnBatteries: false,
+			StopIfGoingOnBatteries:     false,
+			StartWhenAvailable:         true,
+			// Don't stop long-running processes (like the web server)
+			ExecutionTimeLimit: "PT0S",
+		},
+	}
+	if c.RestartPolicy == RestartOnFailure || c.RestartPolicy == RestartAlways {
+		// Task Scheduler only restarts failed tasks, at most once a minute
+		// and (at most) 999 times.
+		t.Settings.RestartOnFailure = &taskRestartOnFailure{
+			Interval: "PT1M",
+			Count:    999,
+		}
+	}
+	if c.StartInterval > 0 {
+		t.Triggers.TimeTrigger = &taskTimeTrigger{
+			Repetition:    taskRepetition{Interval: taskDuration(c.StartInterval)},
+			StartBoundary: "2000-01-01T00:00:00",
+			Enabled:       true,
+		}
+	}
+	t.Actions.Context = "Author"
+	t.Actions.Exec = taskExec{
+		Command:   c.Program,
+		Arguments: strings.Join(utils.Map(c.Arguments, quoteWindowsArg), " "),
+	}
+	return t
+}
+
+func encodeUTF16(str string) []byte {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, uint16(0xFEFF))
+	binary.Write(&buffer, binary.LittleEndian, utf16.Encode([]rune(str)))
+	return buffer.Bytes()
+}
+
+type taskScheduler struct {
+	logger     log.TraceLogger
+	user       common.UserProvider
+	cmdExec    cmd.CommandExecutor
+	fileSystem common.FileSystem
+}
+
+func NewTaskSchedulerProvider(
+	l log.TraceLogger,
+	u common.UserProvider,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+) DaemonProvider {
+	return &taskScheduler{
+		logger:     l,
+		user:       u,
+		cmdExec:    c,
+		fileSystem: fs,
+	}
+}
+
+func (s *taskScheduler) taskFile(label string) (string, error) {
+	user, err := s.user.CurrentUser()
+	if err != nil {
+		return "", fmt.Errorf("could not get current user for scheduled task: %w", err)
+	}
+	return filepath.Join(user.HomeDir, "AppData", "Local", "git-bundle-server", fmt.Sprintf("%s.xml", label)), nil
+}
+
+func (s *taskScheduler) taskExists(ctx context.Context, label string) (bool, error) {
+	exitCode, err := s.cmdExec.RunQuiet(ctx, "schtasks", "/Query", "/TN", label)
+	if err != nil {
+		return false, s.logger.Error(ctx, err)
+	}
+
+	if exitCode == 0 {
+		return true, nil
+	} else if exitCode == TaskSchedulerTaskNotFoundErrorCode {
+		return false, nil
+	} else {
+		return false, s.logger.Errorf(ctx, "could not determine if task '%s' exists: "+
+			"'schtasks /Query' exited with status '%d'", label, exitCode)
+	}
+}
+
+func (s *taskScheduler) Create(ctx context.Context, config *DaemonConfig, force bool) error {
+	// Generate the configuration
+	var newTask bytes.Buffer
+	newTask.WriteString(taskXMLHeader)
+	encoder := xml.NewEncoder(&newTask)
+	encoder.Indent("", "  ")
+	err := encoder.Encode(config.toTask())
+	if err != nil {
+		return s.logger.Errorf(ctx, "could not encode task: %w", err)
+	}
+
+	filename, err := s.taskFile(config.Label)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	alreadyExists, err := s.taskExists(ctx, config.Label)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	// If not forcing re-configuration & the task is already registered, do
+	// nothing
+	if !force && alreadyExists {
+		return nil
+	}
+
+	err = s.fileSystem.WriteFile(filename, encodeUTF16(newTask.String()))
+	if err != nil {
+		return s.logger.Errorf(ctx, "unable to write task file: %w", err)
+	}
+
+	// Register (or replace) the task
+	exitCode, err := s.cmdExec.RunQuiet(ctx, "schtasks", "/Create", "/TN", config.Label, "/XML", filename, "/F")
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	if exitCode != 0 {
+		return s.logger.Errorf(ctx, "'schtasks /Create' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (s *taskScheduler) Start(ctx context.Context, label string) error {
+	exitCode, err := s.cmdExec.RunQuiet(ctx, "schtasks", "/Run", "/TN", label)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	if exitCode != 0 {
+		return s.logger.Errorf(ctx, "'schtasks /Run' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (s *taskScheduler) Stop(ctx context.Context, label string) error {
+	exitCode, err := s.cmdExec.RunQuiet(ctx, "schtasks", "/End", "/TN", label)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	// Don't throw an error if the task hasn't been registered
+	if exitCode != 0 && exitCode != TaskSchedulerTaskNotFoundErrorCode {
+		return s.logger.Errorf(ctx, "'schtasks /End' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (s *taskScheduler) Restart(ctx context.Context, label string) error {
+	err := s.Stop(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	return s.Start(ctx, label)
+}
+
+func (s *taskScheduler) Status(ctx context.Context, label string) (*DaemonStatus, error) {
+	var output bytes.Buffer
+	exitCode, err := s.cmdExec.Run(ctx, "schtasks",
+		[]string{"/Query", "/TN", label, "/FO", "CSV", "/V", "/NH"},
+		cmd.Stdout(&output))
+	if err != nil {
+		return nil, s.logger.Error(ctx, err)
+	}
+
+	if exitCode == TaskSchedulerTaskNotFoundErrorCode {
+		return &DaemonStatus{}, nil
+	} else if exitCode != 0 {
+		return nil, s.logger.Errorf(ctx, "'schtasks /Query' exited with status %d", exitCode)
+	}
+
+	status, err := parseTaskSchedulerStatus(output.String())
+	if err != nil {
+		return nil, s.logger.Errorf(ctx, "could not parse status of task '%s': %w", label, err)
+	}
+	return status, nil
+}
+
+// The columns of the verbose CSV output of 'schtasks /Query' read by
+// 'parseTaskSchedulerStatus'.
+const (
+	taskStatusColumn      int = 3
+	taskLastRunTimeColumn int = 5
+	taskLastResultColumn  int = 6
+)
+
+// The 'Last Result' of a task that is running or has never run, rather than
+// an exit code.
+const (
+	taskResultRunning  int = 0x41301
+	taskResultNeverRun int = 0x41303
+)
+
+// The format of the 'Last Run Time' of a task in US English.
+const taskLastRunTimeFormat string = "1/2/2006 3:04:05 PM"
+
+// parseTaskSchedulerStatus reads the status of a task from the verbose CSV
+// output (without a header) of 'schtasks /Query'. Task Scheduler does not
+// report the process ID of a running task.
+func parseTaskSchedulerStatus(output string) (*DaemonStatus, error) {
+	record, err := csv.NewReader(strings.NewReader(output)).Read()
+	if err != nil {
+		return nil, err
+	} else if len(record) <= taskLastResultColumn {
+		return nil, fmt.Errorf("expected at least %d columns, got %d", taskLastResultColumn+1, len(record))
+	}
+
+	status := &DaemonStatus{
+		Installed: true,
+		State:     record[taskStatusColumn],
+		Running:   record[taskStatusColumn] == "Running",
+	}
+
+	// The last run time is only parsed in the default (US English) format.
+	if startTime, err := time.ParseInLocation(taskLastRunTimeFormat, record[taskLastRunTimeColumn], time.Local); err == nil && status.Running {
+		status.StartTime = startTime
+	}
+
+	lastResult, err := strconv.Atoi(record[taskLastResultColumn])
+	if err == nil && lastResult != taskResultRunning && lastResult != taskResultNeverRun {
+		status.LastExitCode = &lastResult
+	}
+
+	return status, nil
+}
+
+func (s *taskScheduler) Logs(ctx context.Context, label string, options LogOptions, w io.Writer) error {
+	return s.logger.Errorf(ctx, "Task Scheduler does not record the output of '%s'; "+
+		"use the logs of the program (e.g. its '--log-file') instead", label)
+}
+
+func (s *taskScheduler) Remove(ctx context.Context, label string) error {
+	filename, err := s.taskFile(label)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	exitCode, err := s.cmdExec.RunQuiet(ctx, "schtasks", "/Delete", "/TN", label, "/F")
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	if exitCode != 0 && exitCode != TaskSchedulerTaskNotFoundErrorCode {
+		return s.logger.Errorf(ctx, "'schtasks /Delete' exited with status %d", exitCode)
+	}
+
+	_, err = s.fileSystem.DeleteFile(filename)
+	if err != nil {
+		return s.logger.Errorf(ctx, "could not delete task file: %w", err)
+	}
+
+	return nil
+}
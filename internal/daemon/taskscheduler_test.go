@@ -0,0 +1,348 @@
+package daemon_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var taskSchedulerCreateBehaviorTests = []struct {
+	title string
+
+	// Inputs
+	config *daemon.DaemonConfig
+	force  BoolArg
+
+	// Mocked responses (ordered per list!)
+	schtasksQuery  []Pair[int, error]
+	writeFile      []error
+	schtasksCreate []Pair[int, error]
+
+	// Expected values
+	expectErr bool
+}{
+	{
+		"Fresh task created if none exists",
+		&basicDaemonConfig,
+		Any,
+		[]Pair[int, error]{NewPair[int, error](daemon.TaskSchedulerTaskNotFoundErrorCode, nil)}, // schtasks /Query
+		[]error{nil}, // write file
+		[]Pair[int, error]{NewPair[int, error](0, nil)}, // schtasks /Create
+		false,
+	},
+	{
+		"Task exists, doesn't write file or register",
+		&basicDaemonConfig,
+		False,
+		[]Pair[int, error]{NewPair[int, error](0, nil)}, // schtasks /Query
+		[]error{},            // write file
+		[]Pair[int, error]{}, // schtasks /Create
+		false,
+	},
+	{
+		"'force' option overwrites existing task",
+		&basicDaemonConfig,
+		True,
+		[]Pair[int, error]{NewPair[int, error](0, nil)}, // schtasks /Query
+		[]error{nil}, // write file
+		[]Pair[int, error]{NewPair[int, error](0, nil)}, // schtasks /Create
+		false,
+	},
+	{
+		"Failure to register task is an error",
+		&basicDaemonConfig,
+		Any,
+		[]Pair[int, error]{NewPair[int, error](daemon.TaskSchedulerTaskNotFoundErrorCode, nil)}, // schtasks /Query
+		[]error{nil}, // write file
+		[]Pair[int, error]{NewPair[int, error](1, nil)}, // schtasks /Create
+		true,
+	},
+}
+
+var taskSchedulerCreateTaskTests = []struct {
+	title string
+
+	// Inputs
+	config *daemon.DaemonConfig
+
+	// Expected values
+	expectedLines []string
+	missingLines  []string
+}{
+	{
+		title:  "Created task has no trigger",
+		config: &basicDaemonConfig,
+		expectedLines: []string{
+			"<Description>Test service</Description>",
+			"<Command>/usr/local/bin/test/git-bundle-web-server</Command>",
+			"<ExecutionTimeLimit>PT0S</ExecutionTimeLimit>",
+		},
+		missingLines: []string{
+			"<TimeTrigger>",
+			"<Arguments></Arguments>",
+			"<RestartOnFailure>",
+		},
+	},
+	{
+		title: "Created task quotes arguments",
+		config: &daemon.DaemonConfig{
+			Label:     "test-with-args",
+			Program:   `C:\Program Files\git-bundle-server\git-bundle-server.exe`,
+			Arguments: []string{"--port", "8080", `C:\with space\`, `a "quoted" arg`},
+		},
+		expectedLines: []string{
+			`<Command>C:\Program Files\git-bundle-server\git-bundle-server.exe</Command>`,
+			`<Arguments>--port 8080 &#34;C:\with space\\&#34; &#34;a \&#34;quoted\&#34; arg&#34;</Arguments>`,
+		},
+	},
+	{
+		title: "Created task escapes backslashes before quotes",
+		config: &daemon.DaemonConfig{
+			Label:     "test-with-escaped-quotes",
+			Program:   "/path/to/the/program",
+			Arguments: []string{`a\"b`, `a\\"b`},
+		},
+		expectedLines: []string{
+			`<Arguments>&#34;a\\\&#34;b&#34; &#34;a\\\\\&#34;b&#34;</Arguments>`,
+		},
+	},
+	{
+		title: "Created task captures start interval",
+		config: &daemon.DaemonConfig{
+			Label:         "test-with-interval",
+			Program:       "/path/to/the/program",
+			Arguments:     []string{"update-all"},
+			StartInterval: 15 * time.Minute,
+		},
+		expectedLines: []string{
+			"<TimeTrigger>",
+			"<Interval>PT15M</Interval>",
+			"<Arguments>update-all</Arguments>",
+		},
+	}, {
+		title: "Created task restarts on failure",
+		config: &daemon.DaemonConfig{
+			Label:         "test-with-restart",
+			Program:       "/path/to/the/program",
+			RestartPolicy: daemon.RestartOnFailure,
+		},
+		expectedLines: []string{
+			"<RestartOnFailure>",
+			"<Interval>PT1M</Interval>",
+			"<Count>999</Count>",
+		},
+	},
+}
+
+func decodeUTF16(t *testing.T, content []byte) string {
+	if !assert.True(t, len(content) >= 2 && len(content)%2 == 0, "content is not UTF-16") {
+		return ""
+	}
+	codeUnits := make([]uint16, len(content)/2)
+	for i := range codeUnits {
+		codeUnits[i] = binary.LittleEndian.Uint16(content[2*i:])
+	}
+	assert.Equal(t, uint16(0xFEFF), codeUnits[0], "missing byte order mark")
+	return string(utf16.Decode(codeUnits[1:]))
+}
+
+func TestTaskScheduler_Create(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	testCommandExecutor := &MockCommandExecutor{}
+
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	taskScheduler := daemon.NewTaskSchedulerProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	// Verify schtasks commands called
+	for _, tt := range taskSchedulerCreateBehaviorTests {
+		forceArg := tt.force.ToBoolList()
+		for _, force := range forceArg {
+			t.Run(fmt.Sprintf("%s (force='%t')", tt.title, force), func(t *testing.T) {
+				// Mock responses
+				for _, retVal := range tt.schtasksQuery {
+					testCommandExecutor.On("RunQuiet",
+						ctx,
+						"schtasks",
+						mock.MatchedBy(func(args []string) bool { return args[0] == "/Query" }),
+					).Return(retVal.First, retVal.Second).Once()
+				}
+				for _, retVal := range tt.schtasksCreate {
+					testCommandExecutor.On("RunQuiet",
+						ctx,
+						"schtasks",
+						mock.MatchedBy(func(args []string) bool { return args[0] == "/Create" }),
+					).Return(retVal.First, retVal.Second).Once()
+				}
+				for _, retVal := range tt.writeFile {
+					testFileSystem.On("WriteFile",
+						mock.AnythingOfType("string"),
+						mock.Anything,
+					).Return(retVal).Once()
+				}
+
+				// Run "Create"
+				err := taskScheduler.Create(ctx, tt.config, force)
+
+				// Assert on expected values
+				if tt.expectErr {
+					assert.NotNil(t, err)
+				} else {
+					assert.Nil(t, err)
+				}
+				mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+				// Reset mocks
+				testCommandExecutor.Mock = mock.Mock{}
+				testFileSystem.Mock = mock.Mock{}
+			})
+		}
+	}
+
+	// Verify content of created file
+	for _, tt := range taskSchedulerCreateTaskTests {
+		t.Run(tt.title, func(t *testing.T) {
+			var actualFilename string
+			var actualFileBytes []byte
+
+			// Mock responses for successful fresh write
+			testCommandExecutor.On("RunQuiet",
+				ctx,
+				"schtasks",
+				mock.MatchedBy(func(args []string) bool { return args[0] == "/Query" }),
+			).Return(daemon.TaskSchedulerTaskNotFoundErrorCode, nil).Once()
+			testCommandExecutor.On("RunQuiet",
+				ctx,
+				"schtasks",
+				mock.MatchedBy(func(args []string) bool { return args[0] == "/Create" }),
+			).Return(0, nil).Once()
+
+			// Use mock to save off input args
+			testFileSystem.On("WriteFile",
+				mock.MatchedBy(func(filename string) bool {
+					actualFilename = filename
+					return true
+				}),
+				mock.MatchedBy(func(fileBytes any) bool {
+					// Save off value and always match
+					actualFileBytes = fileBytes.([]byte)
+					return true
+				}),
+			).Return(nil).Once()
+
+			err := taskScheduler.Create(ctx, tt.config, false)
+			assert.Nil(t, err)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+			// Check filename
+			expectedFilename := filepath.Join("/my/test/dir", "AppData", "Local", "git-bundle-server", fmt.Sprintf("%s.xml", tt.config.Label))
+			assert.Equal(t, expectedFilename, actualFilename)
+
+			// Check XML content
+			taskXML := decodeUTF16(t, actualFileBytes)
+			assert.True(t, strings.HasPrefix(taskXML, `<?xml version="1.0" encoding="UTF-16"?>`))
+			taskLines := strings.Split(taskXML, "\n")
+			for i := range taskLines {
+				taskLines[i] = strings.TrimSpace(taskLines[i])
+			}
+			for _, line := range tt.expectedLines {
+				assert.Contains(t, taskLines, line)
+			}
+			for _, line := range tt.missingLines {
+				assert.NotContains(t, taskLines, line)
+			}
+
+			// Reset mocks
+			testCommandExecutor.Mock = mock.Mock{}
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
+
+var taskSchedulerStatusTests = []struct {
+	title string
+
+	// Inputs
+	queryExitCode int
+	queryOutput   string
+
+	// Expected values
+	expectedStatus daemon.DaemonStatus
+}{
+	{
+		"Running",
+		0,
+		"\"HOST\",\"\\com.example.testdaemon\",\"N/A\",\"Running\",\"Interactive only\"," +
+			"\"1/4/2024 10:00:00 AM\",\"267009\",\"testuser\"\r\n",
+		daemon.DaemonStatus{
+			Installed: true,
+			Running:   true,
+			State:     "Running",
+			StartTime: time.Date(2024, 1, 4, 10, 0, 0, 0, time.Local),
+		},
+	},
+	{
+		"Ready",
+		0,
+		"\"HOST\",\"\\com.example.testdaemon\",\"N/A\",\"Ready\",\"Interactive only\"," +
+			"\"1/4/2024 10:00:00 AM\",\"1\",\"testuser\"\r\n",
+		daemon.DaemonStatus{Installed: true, Running: false, State: "Ready", LastExitCode: PtrTo(1)},
+	},
+	{
+		"Not installed",
+		daemon.TaskSchedulerTaskNotFoundErrorCode,
+		"",
+		daemon.DaemonStatus{Installed: false, Running: false},
+	},
+}
+
+func TestTaskScheduler_Status(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testCommandExecutor := &MockCommandExecutor{}
+
+	ctx := context.Background()
+
+	taskScheduler := daemon.NewTaskSchedulerProvider(testLogger, nil, testCommandExecutor, nil)
+
+	for _, tt := range taskSchedulerStatusTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testCommandExecutor.On("Run",
+				ctx,
+				"schtasks",
+				[]string{"/Query", "/TN", basicDaemonConfig.Label, "/FO", "CSV", "/V", "/NH"},
+				mock.AnythingOfType("[]cmd.Setting"),
+			).Run(writeStdout(tt.queryOutput)).Return(tt.queryExitCode, nil).Once()
+
+			status, err := taskScheduler.Status(ctx, basicDaemonConfig.Label)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedStatus, *status)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor)
+		})
+
+		// Reset the mock structure between tests
+		testCommandExecutor.Mock = mock.Mock{}
+	}
+}
@@ -4,45 +4,161 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
 )
 
+// FetchError is the error returned when Git fails to clone or fetch from a
+// repository's remote.
+type FetchError struct {
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// BundleError is the error returned when Git fails to create a bundle.
+type BundleError struct {
+	Err error
+}
+
+func (e *BundleError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BundleError) Unwrap() error {
+	return e.Err
+}
+
+// Submodule is a submodule declared in the '.gitmodules' file of a
+// repository.
+type Submodule struct {
+	Name string
+	Path string
+
+	// The URL of the submodule as given in '.gitmodules', which may be
+	// relative to the URL of the repository (see core.ResolveSubmoduleURL).
+	URL string
+}
+
 type GitHelper interface {
-	CreateBundle(ctx context.Context, repoDir string, filename string) (bool, error)
-	CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string) error
-	CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string) (bool, error)
-	CloneBareRepo(ctx context.Context, url string, destination string) error
-	UpdateBareRepo(ctx context.Context, repoDir string) error
+	// The bundle creation functions take an object filter (e.g. 'blob:none')
+	// to create a filtered bundle for partial clones; if empty, the bundle
+	// contains all objects. 'refPatterns' select the refs in the bundle (see
+	// GetRefs); if empty, all branches are bundled. If 'depth' is positive,
+	// CreateBundle only bundles that many commits of the (first-parent)
+	// history of each ref; older commits are prerequisites of the bundle.
+	CreateBundle(ctx context.Context, repoDir string, filename string, refPatterns []string, filter string, depth int) (bool, error)
+	CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string, prereqs []string, filter string) error
+	CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string, refPatterns []string, filter string) (bool, error)
+	VerifyBundle(ctx context.Context, repoDir string, filename string) error
+	// CloneBareRepo and UpdateBareRepo clone and fetch the repository,
+	// connecting to its remote as configured by 'remote' (see RemoteConfig).
+	// Their progress and timeouts are configured by the helper's Options. If
+	// 'prune' is set, UpdateBareRepo deletes the refs that no longer exist on
+	// the remote.
+	CloneBareRepo(ctx context.Context, url string, destination string, remote RemoteConfig) error
+	UpdateBareRepo(ctx context.Context, repoDir string, remote RemoteConfig, prune bool) error
+
+	// UpdateHead queries the remote for its HEAD and returns the ref it points
+	// to (its default branch, e.g. 'refs/heads/main'), or an empty string if
+	// the remote's HEAD is unknown. If the ref exists in the repository, the
+	// repository's HEAD is pointed at it. GetHead returns the ref the
+	// repository's HEAD points to, or an empty string if it is detached.
+	UpdateHead(ctx context.Context, repoDir string, remote RemoteConfig) (string, error)
+	GetHead(ctx context.Context, repoDir string) (string, error)
+
+	// SetFetchRefPatterns configures the repository to fetch only the refs
+	// matching the given patterns from its remote; if empty, all branches
+	// are fetched.
+	SetFetchRefPatterns(ctx context.Context, repoDir string, patterns []string) error
+	GetBranches(ctx context.Context, repoDir string) (map[string]string, error)
+
+	// GetRefs returns the names of the refs in the repository matching the
+	// given patterns, as in 'git for-each-ref'.
+	GetRefs(ctx context.Context, repoDir string, patterns []string) ([]string, error)
+
+	// GetMissingObjects returns the subset of the given object IDs that do
+	// not exist in the repository (e.g. the tips of pruned refs that have
+	// since been garbage collected).
+	GetMissingObjects(ctx context.Context, repoDir string, oids []string) (map[string]bool, error)
+
+	// IsAncestor returns whether the commit 'ancestor' is reachable from the
+	// commit 'descendant', i.e. whether a ref moving from one to the other
+	// is a fast-forward.
+	IsAncestor(ctx context.Context, repoDir string, ancestor string, descendant string) (bool, error)
+
+	// RunMaintenance garbage collects and repacks the repository into a
+	// single pack with a reachability bitmap, and writes its commit-graph, to
+	// keep the repository small and bundle creation fast.
+	RunMaintenance(ctx context.Context, repoDir string) error
 	GetRemoteUrl(ctx context.Context, repoDir string) (string, error)
+
+	// GetSubmodules returns the submodules declared in the '.gitmodules'
+	// file of the repository's default branch (its 'HEAD'), sorted by name.
+	GetSubmodules(ctx context.Context, repoDir string) ([]Submodule, error)
+}
+
+// The maximum duration of a fetch, unless configured otherwise (see Options).
+const DefaultFetchTimeout time.Duration = time.Hour
+
+// Options configure how a GitHelper clones and fetches repositories.
+type Options struct {
+	// The writer to which Git's progress is relayed while cloning and
+	// fetching. If nil, no progress is shown.
+	Progress io.Writer
+
+	// The maximum durations of a clone and of a fetch, after which Git is
+	// killed and the operation fails (e.g. if the remote stopped responding).
+	// Zero means no limit.
+	CloneTimeout time.Duration
+	FetchTimeout time.Duration
+
+	// How clones and fetches that fail because of a transient network error
+	// are retried.
+	Retry RetryPolicy
 }
 
 type gitHelper struct {
 	logger  log.TraceLogger
 	cmdExec cmd.CommandExecutor
+	options Options
 }
 
 func NewGitHelper(l log.TraceLogger, c cmd.CommandExecutor) GitHelper {
+	return NewGitHelperWithOptions(l, c, Options{
+		FetchTimeout: DefaultFetchTimeout,
+		Retry:        DefaultRetryPolicy,
+	})
+}
+
+func NewGitHelperWithOptions(l log.TraceLogger, c cmd.CommandExecutor, options Options) GitHelper {
 	return &gitHelper{
 		logger:  l,
 		cmdExec: c,
+		options: options,
 	}
 }
 
 func (g *gitHelper) gitCommand(ctx context.Context, args ...string) error {
-	exitCode, err := g.cmdExec.Run(ctx, "git", args,
+	_, err := g.cmdExec.RunCaptured(ctx, "git", args,
 		cmd.Stdout(os.Stdout),
 		cmd.Stderr(os.Stderr),
 		cmd.Env([]string{"LC_CTYPE=C"}),
 	)
-
 	if err != nil {
 		return g.logger.Error(ctx, err)
-	} else if exitCode != 0 {
-		return g.logger.Errorf(ctx, "'git' exited with status %d", exitCode)
 	}
 
 	return nil
@@ -90,21 +206,183 @@ func (g *gitHelper) gitCommandWithStdin(ctx context.Context, stdinLines []string
 	return nil
 }
 
-func (g *gitHelper) CreateBundle(ctx context.Context, repoDir string, filename string) (bool, error) {
-	err := g.gitCommand(ctx,
-		"-C", repoDir, "bundle", "create",
-		filename, "--branches")
+// remoteCommand runs a Git command that clones or fetches from a remote (with
+// the given timeout), relaying its progress as configured and reporting it as
+// the given operation (see WithProgressFunc). It is not retried; see
+// withRetries.
+func (g *gitHelper) remoteCommand(ctx context.Context, operation string, timeout time.Duration, args ...string) error {
+	stderr, flush := g.progressStderr(ctx, operation, g.remoteStderr())
+	_, err := g.cmdExec.RunCaptured(ctx, "git", args,
+		cmd.Stdout(os.Stdout),
+		cmd.Stderr(stderr),
+		cmd.Env([]string{"LC_CTYPE=C"}),
+		cmd.Timeout(timeout),
+	)
+	flush()
+	if err != nil {
+		return g.logger.Error(ctx, err)
+	}
+
+	return nil
+}
+
+// remoteStderr returns the writer to which the stderr of clones and fetches
+// (including their progress) is written.
+func (g *gitHelper) remoteStderr() io.Writer {
+	if g.options.Progress != nil {
+		return g.options.Progress
+	}
+	return os.Stderr
+}
+
+// progressArg returns the argument that makes 'git clone' or 'git fetch' show
+// its progress if it is relayed or reported, and hides it otherwise.
+func (g *gitHelper) progressArg(ctx context.Context) string {
+	if g.options.Progress != nil || progressFunc(ctx) != nil {
+		return "--progress"
+	}
+	return "--no-progress"
+}
+
+// bundleCreateArgs returns the arguments of 'git bundle create', including
+// the object filter (if any), and whether to show its progress.
+func bundleCreateArgs(repoDir string, filename string, filter string, progress bool, revArgs ...string) []string {
+	args := []string{"-C", repoDir, "bundle", "create"}
+	if progress {
+		args = append(args, "--progress")
+	}
+	args = append(args, filename)
+	args = append(args, revArgs...)
+	if filter != "" {
+		args = append(args, "--filter="+filter)
+	}
+	return args
+}
+
+// createBundle runs 'git bundle create', writing 'stdinLines' (if not nil) to
+// its stdin. If its progress is reported (see WithProgressFunc), the progress
+// is parsed from its stderr.
+func (g *gitHelper) createBundle(ctx context.Context, stdinLines []string, repoDir string, filename string, filter string, revArgs ...string) error {
+	if progressFunc(ctx) == nil {
+		args := bundleCreateArgs(repoDir, filename, filter, false, revArgs...)
+		if stdinLines == nil {
+			return g.gitCommand(ctx, args...)
+		}
+		return g.gitCommandWithStdin(ctx, stdinLines, args...)
+	}
+
+	stdin := bytes.Buffer{}
+	for _, line := range stdinLines {
+		stdin.WriteString(line + "\n")
+	}
+	stderr := bytes.Buffer{}
+	progressStderr, flush := g.progressStderr(ctx, "bundle", &stderr)
+	exitCode, err := g.cmdExec.Run(ctx, "git", bundleCreateArgs(repoDir, filename, filter, true, revArgs...),
+		cmd.Stdin(&stdin),
+		cmd.Stdout(os.Stdout),
+		cmd.Stderr(progressStderr),
+		cmd.Env([]string{"LC_CTYPE=C"}),
+	)
+	flush()
+
+	if err != nil {
+		return g.logger.Error(ctx, err)
+	} else if exitCode != 0 {
+		return g.logger.Errorf(ctx, "'git' exited with status %d\n%s", exitCode, stderr.String())
+	}
+	return nil
+}
+
+// removePartialBundle deletes the output of a failed 'git bundle create': the
+// bundle's lock file, which Git leaves behind if it is killed (e.g. when the
+// command is cancelled), and the bundle itself, if it was written.
+func removePartialBundle(filename string) {
+	os.Remove(filename + ".lock")
+	os.Remove(filename)
+}
+
+func (g *gitHelper) CreateBundle(ctx context.Context, repoDir string, filename string, refPatterns []string, filter string, depth int) (bool, error) {
+	if depth > 0 {
+		return g.createShallowBundle(ctx, repoDir, filename, refPatterns, filter, depth)
+	}
+	if len(refPatterns) > 0 {
+		return g.CreateIncrementalBundle(ctx, repoDir, filename, []string{}, refPatterns, filter)
+	}
+
+	err := g.createBundle(ctx, nil, repoDir, filename, filter, "--branches")
 	if err != nil {
 		if strings.Contains(err.Error(), "Refusing to create empty bundle") {
 			return false, nil
 		}
+		removePartialBundle(filename)
+		return false, &BundleError{Err: err}
+	}
+
+	return true, nil
+}
+
+// createShallowBundle creates a bundle of the last 'depth' commits of the
+// first-parent history of each ref matching 'refPatterns' (or of each branch),
+// excluding the commit 'depth' commits before each ref's tip (and its
+// history). Refs with shorter histories are bundled in full.
+func (g *gitHelper) createShallowBundle(ctx context.Context, repoDir string, filename string, refPatterns []string, filter string, depth int) (bool, error) {
+	if len(refPatterns) == 0 {
+		refPatterns = []string{"refs/heads/"}
+	}
+	refs, err := g.GetRefs(ctx, repoDir, refPatterns)
+	if err != nil {
 		return false, err
+	} else if len(refs) == 0 {
+		// Nothing to bundle
+		return false, nil
+	}
+
+	// Resolve the commit beyond the depth of each ref in one go; 'git
+	// cat-file' reports the ones that don't exist (because the ref's history
+	// is too short) as missing.
+	stdin := bytes.Buffer{}
+	for _, ref := range refs {
+		fmt.Fprintf(&stdin, "%s~%d\n", ref, depth)
+	}
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	exitCode, err := g.cmdExec.Run(ctx, "git", []string{"-C", repoDir, "cat-file", "--batch-check=%(objectname)"},
+		cmd.Stdin(&stdin),
+		cmd.Stdout(&stdout),
+		cmd.Stderr(&stderr),
+		cmd.Env([]string{"LC_CTYPE=C"}),
+	)
+	if err != nil {
+		return false, g.logger.Error(ctx, err)
+	} else if exitCode != 0 {
+		return false, g.logger.Errorf(ctx, "failed to resolve bundle boundary: 'git' exited with status %d\n%s", exitCode, stderr.String())
+	}
+
+	stdinLines := refs
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasSuffix(line, " missing") {
+			continue
+		}
+		stdinLines = append(stdinLines, "^"+line)
+	}
+
+	err = g.createBundle(ctx, stdinLines, repoDir, filename, filter, "--stdin")
+	if err != nil {
+		if strings.Contains(err.Error(), "Refusing to create empty bundle") {
+			return false, nil
+		}
+		removePartialBundle(filename)
+		return false, &BundleError{Err: err}
 	}
 
 	return true, nil
 }
 
-func (g *gitHelper) CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string) error {
+// CreateBundleFromRefs creates a bundle containing the given refs (created in
+// the repository if they don't already exist). 'prereqs' are excluded from the
+// bundle in the same way as in CreateIncrementalBundle.
+func (g *gitHelper) CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string, prereqs []string, filter string) error {
 	refNames := []string{}
 
 	for ref, oid := range refs {
@@ -116,36 +394,61 @@ func (g *gitHelper) CreateBundleFromRefs(ctx context.Context, repoDir string, fi
 		refNames = append(refNames, ref)
 	}
 
-	err := g.gitCommandWithStdin(ctx,
-		refNames,
-		"-C", repoDir, "bundle", "create",
-		filename, "--stdin")
+	err := g.createBundle(ctx, append(refNames, prereqs...), repoDir, filename, filter, "--stdin")
 	if err != nil {
-		return err
+		removePartialBundle(filename)
+		return &BundleError{Err: err}
 	}
 
 	return nil
 }
 
-func (g *gitHelper) CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string) (bool, error) {
-	err := g.gitCommandWithStdin(ctx,
-		prereqs, "-C", repoDir, "bundle", "create",
-		filename, "--stdin", "--branches")
+func (g *gitHelper) CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string, refPatterns []string, filter string) (bool, error) {
+	stdinLines := append([]string{}, prereqs...)
+	revArgs := []string{"--stdin", "--branches"}
+	if len(refPatterns) > 0 {
+		refs, err := g.GetRefs(ctx, repoDir, refPatterns)
+		if err != nil {
+			return false, err
+		} else if len(refs) == 0 {
+			// Nothing to bundle
+			return false, nil
+		}
+
+		stdinLines = append(refs, prereqs...)
+		revArgs = []string{"--stdin"}
+	}
+
+	err := g.createBundle(ctx, stdinLines, repoDir, filename, filter, revArgs...)
 	if err != nil {
 		if strings.Contains(err.Error(), "Refusing to create empty bundle") {
 			return false, nil
 		}
-		return false, err
+		removePartialBundle(filename)
+		return false, &BundleError{Err: err}
 	}
 
 	return true, nil
 }
 
-func (g *gitHelper) CloneBareRepo(ctx context.Context, url string, destination string) error {
-	gitErr := g.gitCommand(ctx, "clone", "--bare", url, destination)
+// VerifyBundle checks that the given file is a valid bundle whose
+// prerequisites are all present in the repository.
+func (g *gitHelper) VerifyBundle(ctx context.Context, repoDir string, filename string) error {
+	_, _, gitErr := g.gitCommandQuiet(ctx, "-C", repoDir, "bundle", "verify", "--quiet", filename)
+	if gitErr != nil {
+		return g.logger.Errorf(ctx, "failed to verify bundle: %w", gitErr)
+	}
+	return nil
+}
+
+func (g *gitHelper) CloneBareRepo(ctx context.Context, url string, destination string, remote RemoteConfig) error {
+	gitErr := g.withRetries(ctx, "clone", func(ctx context.Context) error {
+		return g.remoteCommand(ctx, "clone", g.options.CloneTimeout,
+			append(remote.args(), "clone", "--bare", g.progressArg(ctx), url, destination)...)
+	})
 
 	if gitErr != nil {
-		return g.logger.Errorf(ctx, "failed to clone repository: %w", gitErr)
+		return &FetchError{Err: g.logger.Errorf(ctx, "failed to clone repository: %w", gitErr)}
 	}
 
 	gitErr = g.gitCommand(ctx, "-C", destination, "config", "remote.origin.fetch", "+refs/heads/*:refs/heads/*")
@@ -153,18 +456,139 @@ func (g *gitHelper) CloneBareRepo(ctx context.Context, url string, destination s
 		return g.logger.Errorf(ctx, "failed to configure refspec: %w", gitErr)
 	}
 
-	gitErr = g.gitCommand(ctx, "-C", destination, "fetch", "origin")
+	gitErr = g.withRetries(ctx, "fetch", func(ctx context.Context) error {
+		return g.remoteCommand(ctx, "fetch", g.options.FetchTimeout,
+			append(remote.args(), "-C", destination, "fetch", g.progressArg(ctx), "origin")...)
+	})
 	if gitErr != nil {
-		return g.logger.Errorf(ctx, "failed to fetch latest refs: %w", gitErr)
+		return &FetchError{Err: g.logger.Errorf(ctx, "failed to fetch latest refs: %w", gitErr)}
 	}
 
 	return nil
 }
 
-func (g *gitHelper) UpdateBareRepo(ctx context.Context, repoDir string) error {
-	gitErr := g.gitCommand(ctx, "-C", repoDir, "fetch", "origin")
+func (g *gitHelper) UpdateBareRepo(ctx context.Context, repoDir string, remote RemoteConfig, prune bool) error {
+	pruneArg := "--no-prune"
+	if prune {
+		pruneArg = "--prune"
+	}
+
+	gitErr := g.withRetries(ctx, "fetch", func(ctx context.Context) error {
+		return g.remoteCommand(ctx, "fetch", g.options.FetchTimeout,
+			append(remote.args(), "-C", repoDir, "fetch", g.progressArg(ctx), pruneArg, "origin")...)
+	})
 	if gitErr != nil {
-		return g.logger.Errorf(ctx, "failed to fetch latest refs: %w", gitErr)
+		return &FetchError{Err: g.logger.Errorf(ctx, "failed to fetch latest refs: %w", gitErr)}
+	}
+
+	return nil
+}
+
+func (g *gitHelper) UpdateHead(ctx context.Context, repoDir string, remote RemoteConfig) (string, error) {
+	stdout := bytes.Buffer{}
+	gitErr := g.withRetries(ctx, "ls-remote", func(ctx context.Context) error {
+		stdout.Reset()
+		_, err := g.cmdExec.RunCaptured(ctx, "git",
+			append(remote.args(), "-C", repoDir, "ls-remote", "--symref", "origin", "HEAD"),
+			cmd.Stdout(&stdout),
+			cmd.Stderr(g.remoteStderr()),
+			cmd.Env([]string{"LC_CTYPE=C"}),
+			cmd.Timeout(g.options.FetchTimeout),
+		)
+		if err != nil {
+			return g.logger.Error(ctx, err)
+		}
+		return nil
+	})
+	if gitErr != nil {
+		return "", &FetchError{Err: g.logger.Errorf(ctx, "failed to query remote HEAD: %w", gitErr)}
+	}
+
+	// A symbolic HEAD is listed as 'ref: <ref>\tHEAD'; without one (e.g. if
+	// the remote is empty, or its transport doesn't report symrefs), the
+	// remote's default branch is unknown.
+	head := ""
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if ref, found := strings.CutPrefix(line, "ref: "); found {
+			head, _, _ = strings.Cut(ref, "\t")
+			break
+		}
+	}
+	if head == "" {
+		return "", nil
+	}
+
+	// Only point HEAD at refs that were fetched, so that it never dangles
+	// (e.g. if the default branch is excluded by the route's ref patterns).
+	exitCode, err := g.cmdExec.Run(ctx, "git", []string{"-C", repoDir, "rev-parse", "--verify", "--quiet", head},
+		cmd.Env([]string{"LC_CTYPE=C"}),
+	)
+	if err != nil {
+		return "", g.logger.Error(ctx, err)
+	}
+	if exitCode == 0 {
+		gitErr = g.gitCommand(ctx, "-C", repoDir, "symbolic-ref", "HEAD", head)
+		if gitErr != nil {
+			return "", g.logger.Errorf(ctx, "failed to update HEAD: %w", gitErr)
+		}
+	}
+
+	return head, nil
+}
+
+func (g *gitHelper) GetHead(ctx context.Context, repoDir string) (string, error) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	exitCode, err := g.cmdExec.Run(ctx, "git", []string{"-C", repoDir, "symbolic-ref", "--quiet", "HEAD"},
+		cmd.Stdout(&stdout),
+		cmd.Stderr(&stderr),
+		cmd.Env([]string{"LC_CTYPE=C"}),
+	)
+	if err != nil {
+		return "", g.logger.Error(ctx, err)
+	}
+
+	// 'git symbolic-ref --quiet' exits with 1 if HEAD is detached, and with
+	// another nonzero status on error.
+	switch exitCode {
+	case 0:
+		return strings.TrimSpace(stdout.String()), nil
+	case 1:
+		return "", nil
+	default:
+		return "", g.logger.Errorf(ctx, "failed to read HEAD: 'git' exited with status %d\n%s", exitCode, stderr.String())
+	}
+}
+
+func (g *gitHelper) SetFetchRefPatterns(ctx context.Context, repoDir string, patterns []string) error {
+	refspecs := []string{"+refs/heads/*:refs/heads/*"}
+	if len(patterns) > 0 {
+		refspecs = []string{}
+		for _, pattern := range patterns {
+			refspecs = append(refspecs, fmt.Sprintf("+%s:%s", pattern, pattern))
+		}
+	}
+
+	// Replace all existing refspecs with the first, then add the rest
+	gitErr := g.gitCommand(ctx, "-C", repoDir, "config", "--replace-all", "remote.origin.fetch", refspecs[0])
+	for _, refspec := range refspecs[1:] {
+		if gitErr != nil {
+			break
+		}
+		gitErr = g.gitCommand(ctx, "-C", repoDir, "config", "--add", "remote.origin.fetch", refspec)
+	}
+	if gitErr != nil {
+		return g.logger.Errorf(ctx, "failed to configure refspecs: %w", gitErr)
+	}
+
+	// Only fetch the tags matching a pattern, rather than every tag pointing
+	// into the fetched history. Without patterns, tags are never bundled, so
+	// tag fetching is left as is.
+	if len(patterns) > 0 {
+		gitErr = g.gitCommand(ctx, "-C", repoDir, "config", "remote.origin.tagOpt", "--no-tags")
+		if gitErr != nil {
+			return g.logger.Errorf(ctx, "failed to configure tag fetching: %w", gitErr)
+		}
 	}
 
 	return nil
@@ -177,3 +601,185 @@ func (g *gitHelper) GetRemoteUrl(ctx context.Context, repoDir string) (string, e
 	}
 	return strings.TrimSpace(stdout.String()), nil
 }
+
+func (g *gitHelper) GetSubmodules(ctx context.Context, repoDir string) ([]Submodule, error) {
+	submodules := []Submodule{}
+
+	// A repository without a '.gitmodules' file (or without any commit) has
+	// no submodules.
+	exitCode, err := g.cmdExec.Run(ctx, "git", []string{"-C", repoDir, "cat-file", "-e", "HEAD:.gitmodules"},
+		cmd.Env([]string{"LC_CTYPE=C"}),
+	)
+	if err != nil {
+		return nil, g.logger.Error(ctx, err)
+	} else if exitCode != 0 {
+		return submodules, nil
+	}
+
+	// Each entry is printed as '<key>\n<value>\0'. 'git config' exits with 1
+	// if no key matches.
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	exitCode, err = g.cmdExec.Run(ctx, "git",
+		[]string{"-C", repoDir, "config", "--blob", "HEAD:.gitmodules", "--null", "--get-regexp", `^submodule\..*\.(path|url)$`},
+		cmd.Stdout(&stdout),
+		cmd.Stderr(&stderr),
+		cmd.Env([]string{"LC_CTYPE=C"}),
+	)
+	if err != nil {
+		return nil, g.logger.Error(ctx, err)
+	} else if exitCode == 1 {
+		return submodules, nil
+	} else if exitCode != 0 {
+		return nil, g.logger.Errorf(ctx, "failed to read submodules: 'git' exited with status %d\n%s", exitCode, stderr.String())
+	}
+
+	byName := map[string]*Submodule{}
+	names := []string{}
+	for _, entry := range strings.Split(stdout.String(), "\x00") {
+		key, value, found := strings.Cut(entry, "\n")
+		if !found {
+			continue
+		}
+
+		// The key is 'submodule.<name>.<variable>', where the name may
+		// contain dots.
+		key = strings.TrimPrefix(key, "submodule.")
+		dot := strings.LastIndex(key, ".")
+		if dot < 0 {
+			continue
+		}
+		name, variable := key[:dot], key[dot+1:]
+
+		submodule, exists := byName[name]
+		if !exists {
+			submodule = &Submodule{Name: name}
+			byName[name] = submodule
+			names = append(names, name)
+		}
+		if variable == "path" {
+			submodule.Path = value
+		} else {
+			submodule.URL = value
+		}
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		// Git ignores submodules without a path or URL
+		if submodule := byName[name]; submodule.Path != "" && submodule.URL != "" {
+			submodules = append(submodules, *submodule)
+		}
+	}
+	return submodules, nil
+}
+
+// GetBranches returns the object IDs of all branches in the repository, keyed
+// by full ref name.
+func (g *gitHelper) GetBranches(ctx context.Context, repoDir string) (map[string]string, error) {
+	stdout, _, gitErr := g.gitCommandQuiet(ctx,
+		"-C", repoDir, "for-each-ref",
+		"--format=%(objectname) %(refname)", "refs/heads/")
+	if gitErr != nil {
+		return nil, g.logger.Errorf(ctx, "failed to list branches: %w", gitErr)
+	}
+
+	branches := make(map[string]string)
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		oid, ref, found := strings.Cut(strings.TrimSpace(line), " ")
+		if found {
+			branches[ref] = oid
+		}
+	}
+	return branches, nil
+}
+
+func (g *gitHelper) GetRefs(ctx context.Context, repoDir string, patterns []string) ([]string, error) {
+	args := append([]string{"-C", repoDir, "for-each-ref", "--format=%(refname)"}, patterns...)
+	stdout, _, gitErr := g.gitCommandQuiet(ctx, args...)
+	if gitErr != nil {
+		return nil, g.logger.Errorf(ctx, "failed to list refs: %w", gitErr)
+	}
+
+	refs := []string{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if ref := strings.TrimSpace(line); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+func (g *gitHelper) RunMaintenance(ctx context.Context, repoDir string) error {
+	// 'git gc' repacks all reachable objects into a single pack (pruning old
+	// unreachable objects) and writes the commit-graph; the configuration
+	// makes sure it also writes a bitmap, which speeds up counting the objects
+	// of a bundle.
+	gitErr := g.gitCommand(ctx,
+		"-C", repoDir,
+		"-c", "repack.writeBitmaps=true",
+		"-c", "gc.writeCommitGraph=true",
+		"gc", "--quiet")
+	if gitErr != nil {
+		return g.logger.Errorf(ctx, "failed to garbage collect repository: %w", gitErr)
+	}
+
+	return nil
+}
+
+func (g *gitHelper) GetMissingObjects(ctx context.Context, repoDir string, oids []string) (map[string]bool, error) {
+	missing := make(map[string]bool)
+	if len(oids) == 0 {
+		return missing, nil
+	}
+
+	stdin := bytes.Buffer{}
+	for _, oid := range oids {
+		stdin.WriteString(oid + "\n")
+	}
+
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	exitCode, err := g.cmdExec.Run(ctx, "git", []string{"-C", repoDir, "cat-file", "--batch-check"},
+		cmd.Stdin(&stdin),
+		cmd.Stdout(&stdout),
+		cmd.Stderr(&stderr),
+		cmd.Env([]string{"LC_CTYPE=C"}),
+	)
+	if err != nil {
+		return nil, g.logger.Error(ctx, err)
+	} else if exitCode != 0 {
+		return nil, g.logger.Errorf(ctx, "failed to check objects: 'git' exited with status %d\n%s", exitCode, stderr.String())
+	}
+
+	// Each line is either '<oid> <type> <size>' or '<oid> missing'
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		oid, status, found := strings.Cut(strings.TrimSpace(line), " ")
+		if found && status == "missing" {
+			missing[oid] = true
+		}
+	}
+	return missing, nil
+}
+
+func (g *gitHelper) IsAncestor(ctx context.Context, repoDir string, ancestor string, descendant string) (bool, error) {
+	stderr := bytes.Buffer{}
+	exitCode, err := g.cmdExec.Run(ctx, "git", []string{"-C", repoDir, "merge-base", "--is-ancestor", ancestor, descendant},
+		cmd.Stderr(&stderr),
+		cmd.Env([]string{"LC_CTYPE=C"}),
+	)
+	if err != nil {
+		return false, g.logger.Error(ctx, err)
+	}
+
+	// 'git merge-base --is-ancestor' exits with 1 if the commit is not an
+	// ancestor, and with another nonzero status on error.
+	switch exitCode {
+	case 0:
+		return true, nil
+	case 1:
+		return false, nil
+	default:
+		return false, g.logger.Errorf(ctx, "failed to compare commits: 'git' exited with status %d\n%s", exitCode, stderr.String())
+	}
+}
@@ -1,9 +1,11 @@
 package git_test
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/git"
@@ -19,12 +21,14 @@ var createIncrementalBundleTests = []struct {
 	repoDir  string
 	filename string
 	prereqs  []string
+	filter   string
 
 	// Mocked responses
 	bundleCreate       Pair[int, error]
 	bundleCreateStderr string
 
 	// Expected values
+	expectedArgs          []string
 	expectedBundleCreated bool
 	expectErr             bool
 }{
@@ -34,10 +38,30 @@ var createIncrementalBundleTests = []struct {
 		"/test/home/git-bundle-server/git/test/myrepo/",
 		"/test/home/git-bundle-server/www/test/myrepo/bundle-1234.bundle",
 		[]string{"^018d4b8a"},
+		"",
+
+		NewPair[int, error](0, nil),
+		"",
+
+		[]string{"-C", "/test/home/git-bundle-server/git/test/myrepo/", "bundle", "create",
+			"/test/home/git-bundle-server/www/test/myrepo/bundle-1234.bundle", "--stdin", "--branches"},
+		true,
+		false,
+	},
+	{
+		"Successful filtered bundle creation",
+
+		"/test/home/git-bundle-server/git/test/myrepo/",
+		"/test/home/git-bundle-server/www/test/myrepo/bundle-1234.bundle",
+		[]string{"^018d4b8a"},
+		"blob:none",
 
 		NewPair[int, error](0, nil),
 		"",
 
+		[]string{"-C", "/test/home/git-bundle-server/git/test/myrepo/", "bundle", "create",
+			"/test/home/git-bundle-server/www/test/myrepo/bundle-1234.bundle", "--stdin", "--branches",
+			"--filter=blob:none"},
 		true,
 		false,
 	},
@@ -47,10 +71,13 @@ var createIncrementalBundleTests = []struct {
 		"/test/home/git-bundle-server/git/test/myrepo/",
 		"/test/home/git-bundle-server/www/test/myrepo/bundle-5678.bundle",
 		[]string{"^0793b0ce", "^3649daa0"},
+		"",
 
 		NewPair[int, error](128, nil),
 		"fatal: Refusing to create empty bundle",
 
+		[]string{"-C", "/test/home/git-bundle-server/git/test/myrepo/", "bundle", "create",
+			"/test/home/git-bundle-server/www/test/myrepo/bundle-5678.bundle", "--stdin", "--branches"},
 		false,
 		false,
 	},
@@ -72,7 +99,7 @@ func TestGit_CreateIncrementalBundle(t *testing.T) {
 			testCommandExecutor.On("Run",
 				mock.Anything,
 				"git",
-				[]string{"-C", tt.repoDir, "bundle", "create", tt.filename, "--stdin", "--branches"},
+				tt.expectedArgs,
 				mock.MatchedBy(func(settings []cmd.Setting) bool {
 					var ok bool
 					stdin = nil
@@ -98,7 +125,7 @@ func TestGit_CreateIncrementalBundle(t *testing.T) {
 			}).Return(tt.bundleCreate.First, tt.bundleCreate.Second)
 
 			// Run 'CreateIncrementalBundle()'
-			actualBundleCreated, err := gitHelper.CreateIncrementalBundle(context.Background(), tt.repoDir, tt.filename, tt.prereqs)
+			actualBundleCreated, err := gitHelper.CreateIncrementalBundle(context.Background(), tt.repoDir, tt.filename, tt.prereqs, []string{}, tt.filter)
 
 			// Assert on expected values
 			assert.Equal(t, tt.expectedBundleCreated, actualBundleCreated)
@@ -123,3 +150,541 @@ func TestGit_CreateIncrementalBundle(t *testing.T) {
 		})
 	}
 }
+
+func TestGit_CreateIncrementalBundle_Progress(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testCommandExecutor := &MockCommandExecutor{}
+	gitHelper := git.NewGitHelper(testLogger, testCommandExecutor)
+
+	var stderr io.Writer
+	testCommandExecutor.On("Run",
+		mock.Anything,
+		"git",
+		[]string{"-C", "/test/repo", "bundle", "create", "--progress", "/test/bundle-1234.bundle", "--stdin", "--branches"},
+		mock.MatchedBy(func(settings []cmd.Setting) bool {
+			for _, setting := range settings {
+				if setting.Key == cmd.StderrKey {
+					stderr = setting.Value.(io.Writer)
+				}
+			}
+			return stderr != nil
+		}),
+	).Run(func(mock.Arguments) {
+		// Git redraws its progress with '\r', and may split lines across
+		// writes
+		stderr.Write([]byte("Enumerating objects: 12, done.\nCounting objects:  50% (6/12)\rCounting obj"))
+		stderr.Write([]byte("ects: 100% (12/12), done.\nwarning: unrelated output\n"))
+		stderr.Write([]byte("Writing objects:  25% (3/12), 1.50 MiB | 2.00 MiB/s\r"))
+	}).Return(0, nil)
+
+	progress := []git.Progress{}
+	ctx := git.WithProgressFunc(context.Background(), func(p git.Progress) {
+		progress = append(progress, p)
+	})
+
+	created, err := gitHelper.CreateIncrementalBundle(ctx, "/test/repo", "/test/bundle-1234.bundle", []string{"^018d4b8a"}, []string{}, "")
+	assert.NoError(t, err)
+	assert.True(t, created)
+	mock.AssertExpectationsForObjects(t, testCommandExecutor)
+
+	assert.Equal(t, []git.Progress{
+		{Operation: "bundle", Stage: "Enumerating objects", Percent: -1},
+		{Operation: "bundle", Stage: "Counting objects", Percent: 50},
+		{Operation: "bundle", Stage: "Counting objects", Percent: 100},
+		{Operation: "bundle", Stage: "Writing objects", Percent: 25, Bytes: 3 << 19},
+	}, progress)
+}
+
+func TestGit_GetBranches(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testCommandExecutor := &MockCommandExecutor{}
+
+	gitHelper := git.NewGitHelper(testLogger, testCommandExecutor)
+
+	repoDir := "/test/home/git-bundle-server/git/test/myrepo/"
+	testCommandExecutor.On("Run",
+		mock.Anything,
+		"git",
+		[]string{"-C", repoDir, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads/"},
+		mock.MatchedBy(func(settings []cmd.Setting) bool {
+			for _, setting := range settings {
+				if setting.Key == cmd.StdoutKey {
+					stdout := setting.Value.(io.Writer)
+					stdout.Write([]byte("018d4b8a refs/heads/main\n3649daa0 refs/heads/topic\n"))
+				}
+			}
+			return true
+		}),
+	).Return(0, nil).Once()
+
+	branches, err := gitHelper.GetBranches(context.Background(), repoDir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"refs/heads/main":  "018d4b8a",
+		"refs/heads/topic": "3649daa0",
+	}, branches)
+	mock.AssertExpectationsForObjects(t, testCommandExecutor)
+}
+
+var verifyBundleTests = []struct {
+	title string
+
+	// Mocked responses
+	exitCode int
+	stderr   string
+
+	// Expected values
+	expectErr bool
+}{
+	{"Valid bundle", 0, "", false},
+	{"Missing prerequisites", 1, "error: Repository lacks these prerequisite commits:", true},
+	{"Corrupt bundle", 128, "error: '/bundle-1.bundle' does not look like a v2 or v3 bundle file", true},
+}
+
+func TestGit_VerifyBundle(t *testing.T) {
+	repoDir := "/test/home/git-bundle-server/git/test/myrepo/"
+	filename := "/test/home/git-bundle-server/www/test/myrepo/bundle-1.bundle"
+
+	for _, tt := range verifyBundleTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testCommandExecutor := &MockCommandExecutor{}
+			gitHelper := git.NewGitHelper(&MockTraceLogger{}, testCommandExecutor)
+
+			testCommandExecutor.On("Run",
+				mock.Anything,
+				"git",
+				[]string{"-C", repoDir, "bundle", "verify", "--quiet", filename},
+				mock.MatchedBy(func(settings []cmd.Setting) bool {
+					for _, setting := range settings {
+						if setting.Key == cmd.StderrKey {
+							stderr := setting.Value.(io.Writer)
+							stderr.Write([]byte(tt.stderr))
+						}
+					}
+					return true
+				}),
+			).Return(tt.exitCode, nil).Once()
+
+			err := gitHelper.VerifyBundle(context.Background(), repoDir, filename)
+			if tt.expectErr {
+				assert.ErrorContains(t, err, tt.stderr)
+			} else {
+				assert.NoError(t, err)
+			}
+			mock.AssertExpectationsForObjects(t, testCommandExecutor)
+		})
+	}
+}
+
+var isAncestorTests = []struct {
+	title string
+
+	// Mocked responses
+	exitCode int
+
+	// Expected values
+	expectAncestor bool
+	expectErr      bool
+}{
+	{"Fast-forward", 0, true, false},
+	{"Rewritten history", 1, false, false},
+	{"Missing commit", 128, false, true},
+}
+
+func TestGit_IsAncestor(t *testing.T) {
+	repoDir := "/test/home/git-bundle-server/git/test/myrepo/"
+
+	for _, tt := range isAncestorTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testCommandExecutor := &MockCommandExecutor{}
+			gitHelper := git.NewGitHelper(&MockTraceLogger{}, testCommandExecutor)
+
+			testCommandExecutor.On("Run",
+				mock.Anything,
+				"git",
+				[]string{"-C", repoDir, "merge-base", "--is-ancestor", "018d4b8a", "3649daa0"},
+				mock.Anything,
+			).Return(tt.exitCode, nil).Once()
+
+			isAncestor, err := gitHelper.IsAncestor(context.Background(), repoDir, "018d4b8a", "3649daa0")
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectAncestor, isAncestor)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor)
+		})
+	}
+}
+
+var updateHeadTests = []struct {
+	title string
+
+	// Mocked responses
+	lsRemoteOutput string
+	refExists      bool
+
+	// Expected values
+	expectHead   string
+	expectUpdate bool
+}{
+	{
+		"Default branch was fetched",
+		"ref: refs/heads/main\tHEAD\n3649daa0fc4f8ae1ea1dbc4ac4b3b3fb2e5c0e7d\tHEAD\n",
+		true,
+		"refs/heads/main",
+		true,
+	},
+	{
+		"Default branch not fetched",
+		"ref: refs/heads/trunk\tHEAD\n3649daa0fc4f8ae1ea1dbc4ac4b3b3fb2e5c0e7d\tHEAD\n",
+		false,
+		"refs/heads/trunk",
+		false,
+	},
+	{
+		"No symbolic HEAD",
+		"3649daa0fc4f8ae1ea1dbc4ac4b3b3fb2e5c0e7d\tHEAD\n",
+		false,
+		"",
+		false,
+	},
+}
+
+func TestGit_UpdateHead(t *testing.T) {
+	repoDir := "/test/home/git-bundle-server/git/test/myrepo/"
+
+	for _, tt := range updateHeadTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testCommandExecutor := &MockCommandExecutor{}
+			gitHelper := git.NewGitHelper(&MockTraceLogger{}, testCommandExecutor)
+
+			testCommandExecutor.On("RunCaptured",
+				mock.Anything,
+				"git",
+				[]string{"-C", repoDir, "ls-remote", "--symref", "origin", "HEAD"},
+				mock.Anything,
+			).Run(func(args mock.Arguments) {
+				for _, setting := range args.Get(3).([]cmd.Setting) {
+					if setting.Key == cmd.StdoutKey {
+						setting.Value.(io.Writer).Write([]byte(tt.lsRemoteOutput))
+					}
+				}
+			}).Return(nil, nil).Once()
+
+			if tt.expectHead != "" {
+				exitCode := 1
+				if tt.refExists {
+					exitCode = 0
+				}
+				testCommandExecutor.On("Run",
+					mock.Anything,
+					"git",
+					[]string{"-C", repoDir, "rev-parse", "--verify", "--quiet", tt.expectHead},
+					mock.Anything,
+				).Return(exitCode, nil).Once()
+			}
+			if tt.expectUpdate {
+				testCommandExecutor.On("RunCaptured",
+					mock.Anything,
+					"git",
+					[]string{"-C", repoDir, "symbolic-ref", "HEAD", tt.expectHead},
+					mock.Anything,
+				).Return(nil, nil).Once()
+			}
+
+			head, err := gitHelper.UpdateHead(context.Background(), repoDir, git.RemoteConfig{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectHead, head)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor)
+		})
+	}
+}
+
+func TestGit_GetRefs(t *testing.T) {
+	testCommandExecutor := &MockCommandExecutor{}
+	gitHelper := git.NewGitHelper(&MockTraceLogger{}, testCommandExecutor)
+
+	repoDir := "/test/home/git-bundle-server/git/test/myrepo/"
+	testCommandExecutor.On("Run",
+		mock.Anything,
+		"git",
+		[]string{"-C", repoDir, "for-each-ref", "--format=%(refname)", "refs/heads/main", "refs/tags/v*"},
+		mock.MatchedBy(func(settings []cmd.Setting) bool {
+			for _, setting := range settings {
+				if setting.Key == cmd.StdoutKey {
+					stdout := setting.Value.(io.Writer)
+					stdout.Write([]byte("refs/heads/main\nrefs/tags/v1.0\nrefs/tags/v2.0\n"))
+				}
+			}
+			return true
+		}),
+	).Return(0, nil).Once()
+
+	refs, err := gitHelper.GetRefs(context.Background(), repoDir, []string{"refs/heads/main", "refs/tags/v*"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"refs/heads/main", "refs/tags/v1.0", "refs/tags/v2.0"}, refs)
+	mock.AssertExpectationsForObjects(t, testCommandExecutor)
+}
+
+func TestGit_CreateBundle_Depth(t *testing.T) {
+	testCommandExecutor := &MockCommandExecutor{}
+	gitHelper := git.NewGitHelper(&MockTraceLogger{}, testCommandExecutor)
+
+	repoDir := "/test/home/git-bundle-server/git/test/myrepo/"
+	filename := "/test/home/git-bundle-server/www/test/myrepo/base-1234.bundle"
+
+	// runCommand returns a mocked run of a command that writes the given
+	// output to its stdout and records its stdin.
+	runCommand := func(output string, stdin *string) func(mock.Arguments) {
+		return func(args mock.Arguments) {
+			for _, setting := range args.Get(3).([]cmd.Setting) {
+				switch setting.Key {
+				case cmd.StdoutKey:
+					setting.Value.(io.Writer).Write([]byte(output))
+				case cmd.StdinKey:
+					input, _ := io.ReadAll(setting.Value.(io.Reader))
+					*stdin = string(input)
+				}
+			}
+		}
+	}
+
+	var refPatterns, boundaries, revs string
+	testCommandExecutor.On("Run",
+		mock.Anything,
+		"git",
+		[]string{"-C", repoDir, "for-each-ref", "--format=%(refname)", "refs/heads/"},
+		mock.Anything,
+	).Run(runCommand("refs/heads/main\nrefs/heads/topic\n", &refPatterns)).Return(0, nil).Once()
+	testCommandExecutor.On("Run",
+		mock.Anything,
+		"git",
+		[]string{"-C", repoDir, "cat-file", "--batch-check=%(objectname)"},
+		mock.Anything,
+	).Run(runCommand("018d4b8a\nrefs/heads/topic~10 missing\n", &boundaries)).Return(0, nil).Once()
+	testCommandExecutor.On("Run",
+		mock.Anything,
+		"git",
+		[]string{"-C", repoDir, "bundle", "create", filename, "--stdin"},
+		mock.Anything,
+	).Run(runCommand("", &revs)).Return(0, nil).Once()
+
+	written, err := gitHelper.CreateBundle(context.Background(), repoDir, filename, []string{}, "", 10)
+	assert.NoError(t, err)
+	assert.True(t, written)
+
+	// The ref with a shorter history is bundled in full
+	assert.Equal(t, "refs/heads/main~10\nrefs/heads/topic~10\n", boundaries)
+	assert.Equal(t, "refs/heads/main\nrefs/heads/topic\n^018d4b8a\n", revs)
+	mock.AssertExpectationsForObjects(t, testCommandExecutor)
+}
+
+func TestGit_GetSubmodules(t *testing.T) {
+	repoDir := "/test/home/git-bundle-server/git/test/myrepo/"
+
+	t.Run("No .gitmodules", func(t *testing.T) {
+		testCommandExecutor := &MockCommandExecutor{}
+		gitHelper := git.NewGitHelper(&MockTraceLogger{}, testCommandExecutor)
+
+		testCommandExecutor.On("Run",
+			mock.Anything,
+			"git",
+			[]string{"-C", repoDir, "cat-file", "-e", "HEAD:.gitmodules"},
+			mock.Anything,
+		).Return(128, nil).Once()
+
+		submodules, err := gitHelper.GetSubmodules(context.Background(), repoDir)
+		assert.NoError(t, err)
+		assert.Empty(t, submodules)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor)
+	})
+
+	t.Run("Submodules", func(t *testing.T) {
+		testCommandExecutor := &MockCommandExecutor{}
+		gitHelper := git.NewGitHelper(&MockTraceLogger{}, testCommandExecutor)
+
+		testCommandExecutor.On("Run",
+			mock.Anything,
+			"git",
+			[]string{"-C", repoDir, "cat-file", "-e", "HEAD:.gitmodules"},
+			mock.Anything,
+		).Return(0, nil).Once()
+		testCommandExecutor.On("Run",
+			mock.Anything,
+			"git",
+			[]string{"-C", repoDir, "config", "--blob", "HEAD:.gitmodules", "--null", "--get-regexp", `^submodule\..*\.(path|url)$`},
+			mock.Anything,
+		).Run(func(args mock.Arguments) {
+			for _, setting := range args.Get(3).([]cmd.Setting) {
+				if setting.Key == cmd.StdoutKey {
+					setting.Value.(io.Writer).Write([]byte(
+						"submodule.vendor/lib.v2.path\nvendor/lib\x00" +
+							"submodule.vendor/lib.v2.url\n../lib.git\x00" +
+							"submodule.docs.url\nhttps://github.com/org/docs.git\x00" +
+							"submodule.docs.path\ndocs\x00" +
+							"submodule.broken.path\nbroken\x00"))
+				}
+			}
+		}).Return(0, nil).Once()
+
+		submodules, err := gitHelper.GetSubmodules(context.Background(), repoDir)
+		assert.NoError(t, err)
+		assert.Equal(t, []git.Submodule{
+			{Name: "docs", Path: "docs", URL: "https://github.com/org/docs.git"},
+			{Name: "vendor/lib.v2", Path: "vendor/lib", URL: "../lib.git"},
+		}, submodules)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor)
+	})
+}
+
+var rewriteURLTests = []struct {
+	url      string
+	expected string
+}{
+	{"https://github.com/org/repo.git", "https://mirror.example.com/github/org/repo.git"},
+	{"https://github.com/internal/repo.git", "https://internal.example.com/repo.git"},
+	{"git@github.com:org/repo.git", "git@github.com:org/repo.git"},
+}
+
+func TestGit_RewriteURL(t *testing.T) {
+	rewrites := []git.URLRewrite{
+		{Base: "https://mirror.example.com/github/", InsteadOf: "https://github.com/"},
+		{Base: "https://internal.example.com/", InsteadOf: "https://github.com/internal/"},
+	}
+
+	for _, tt := range rewriteURLTests {
+		t.Run(tt.url, func(t *testing.T) {
+			// The rule with the longest matching prefix applies
+			assert.Equal(t, tt.expected, git.RewriteURL(tt.url, rewrites))
+		})
+	}
+}
+
+var setFetchRefPatternsTests = []struct {
+	title string
+
+	// Inputs
+	patterns []string
+
+	// Expected values
+	expectedCommands [][]string
+}{
+	{
+		"All branches",
+		[]string{},
+		[][]string{
+			{"config", "--replace-all", "remote.origin.fetch", "+refs/heads/*:refs/heads/*"},
+		},
+	},
+	{
+		"Ref patterns",
+		[]string{"refs/heads/main", "refs/tags/v*"},
+		[][]string{
+			{"config", "--replace-all", "remote.origin.fetch", "+refs/heads/main:refs/heads/main"},
+			{"config", "--add", "remote.origin.fetch", "+refs/tags/v*:refs/tags/v*"},
+			{"config", "remote.origin.tagOpt", "--no-tags"},
+		},
+	},
+}
+
+func TestGit_SetFetchRefPatterns(t *testing.T) {
+	repoDir := "/test/home/git-bundle-server/git/test/myrepo/"
+
+	for _, tt := range setFetchRefPatternsTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testCommandExecutor := &MockCommandExecutor{}
+			gitHelper := git.NewGitHelper(&MockTraceLogger{}, testCommandExecutor)
+
+			for _, command := range tt.expectedCommands {
+				testCommandExecutor.On("RunCaptured",
+					mock.Anything,
+					"git",
+					append([]string{"-C", repoDir}, command...),
+					mock.Anything,
+				).Return(nil, nil).Once()
+			}
+
+			err := gitHelper.SetFetchRefPatterns(context.Background(), repoDir, tt.patterns)
+			assert.NoError(t, err)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor)
+			testCommandExecutor.AssertNumberOfCalls(t, "RunCaptured", len(tt.expectedCommands))
+		})
+	}
+}
+
+var updateBareRepoTests = []struct {
+	title string
+
+	remote   git.RemoteConfig
+	progress io.Writer
+	timeout  time.Duration
+
+	expectedArgs []string
+}{
+	{
+		"No proxy",
+		git.RemoteConfig{},
+		nil,
+		0,
+		[]string{"-C", "/test/repo", "fetch", "--no-progress", "--prune", "origin"},
+	},
+	{
+		"Proxy",
+		git.RemoteConfig{Proxy: "http://proxy.example.com:3128"},
+		nil,
+		0,
+		[]string{"-c", "http.proxy=http://proxy.example.com:3128", "-C", "/test/repo", "fetch", "--no-progress", "--prune", "origin"},
+	},
+	{
+		"URL rewrites",
+		git.RemoteConfig{URLRewrites: []git.URLRewrite{
+			{Base: "https://mirror.example.com/", InsteadOf: "https://github.com/"},
+			{Base: "ssh://git@mirror.example.com/", InsteadOf: "git@github.com:"},
+		}},
+		nil,
+		0,
+		[]string{
+			"-c", "url.https://mirror.example.com/.insteadOf=https://github.com/",
+			"-c", "url.ssh://git@mirror.example.com/.insteadOf=git@github.com:",
+			"-C", "/test/repo", "fetch", "--no-progress", "--prune", "origin",
+		},
+	},
+	{
+		"Progress and timeout",
+		git.RemoteConfig{},
+		&bytes.Buffer{},
+		time.Minute,
+		[]string{"-C", "/test/repo", "fetch", "--progress", "--prune", "origin"},
+	},
+}
+
+func TestGit_UpdateBareRepo(t *testing.T) {
+	for _, tt := range updateBareRepoTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testCommandExecutor := &MockCommandExecutor{}
+			gitHelper := git.NewGitHelperWithOptions(&MockTraceLogger{}, testCommandExecutor,
+				git.Options{Progress: tt.progress, FetchTimeout: tt.timeout})
+
+			testCommandExecutor.On("RunCaptured",
+				mock.Anything,
+				"git",
+				tt.expectedArgs,
+				mock.MatchedBy(func(settings []cmd.Setting) bool {
+					for _, setting := range settings {
+						if setting.Key == cmd.TimeoutKey {
+							return setting.Value == tt.timeout
+						}
+					}
+					return false
+				}),
+			).Return(nil, nil).Once()
+
+			err := gitHelper.UpdateBareRepo(context.Background(), "/test/repo", tt.remote, true)
+			assert.NoError(t, err)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor)
+		})
+	}
+}
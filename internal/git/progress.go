@@ -0,0 +1,163 @@
+package git
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Progress is the progress of a long-running Git operation, as reported by Git
+// on its stderr.
+type Progress struct {
+	// The operation in progress: 'clone', 'fetch', or 'bundle'.
+	Operation string
+
+	// The stage of the operation reported by Git (e.g. 'Receiving objects'),
+	// and the percentage of it that is complete (-1 if Git reports none, e.g.
+	// for 'Enumerating objects').
+	Stage   string
+	Percent int
+
+	// The number of bytes transferred, if Git reports it (e.g. while
+	// receiving objects); zero otherwise.
+	Bytes int64
+}
+
+// ProgressFunc is called with each progress update of the Git operations run
+// with a context returned by WithProgressFunc.
+type ProgressFunc func(progress Progress)
+
+type progressFuncKey struct{}
+
+// WithProgressFunc returns a context with which the clones, fetches, and bundle
+// creations of a GitHelper report their progress to 'f'. The progress is
+// reported in addition to being shown as configured by the helper's Options.
+func WithProgressFunc(ctx context.Context, f ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressFuncKey{}, f)
+}
+
+func progressFunc(ctx context.Context) ProgressFunc {
+	f, _ := ctx.Value(progressFuncKey{}).(ProgressFunc)
+	return f
+}
+
+var (
+	// e.g. 'Receiving objects:  45% (450/1000), 1.20 MiB | 2.00 MiB/s'
+	progressPercentRegex = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*[a-z]):\s+(\d+)% \(\d+/\d+\)(?:, ([0-9.]+) (bytes|KiB|MiB|GiB))?`)
+
+	// e.g. 'Enumerating objects: 1234, done.'
+	progressCountRegex = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*[a-z]): \d+(?:, done\.)?$`)
+
+	byteUnits = map[string]float64{
+		"bytes": 1,
+		"KiB":   1 << 10,
+		"MiB":   1 << 20,
+		"GiB":   1 << 30,
+	}
+)
+
+// parseProgress parses a line of Git's progress output, returning false if the
+// line is not progress (e.g. an error message).
+func parseProgress(operation string, line string) (Progress, bool) {
+	// Progress of the remote's side of a fetch, e.g. 'remote: Counting
+	// objects: ...'
+	line = strings.TrimSpace(strings.TrimPrefix(line, "remote: "))
+
+	if match := progressPercentRegex.FindStringSubmatch(line); match != nil {
+		progress := Progress{Operation: operation, Stage: match[1]}
+		progress.Percent, _ = strconv.Atoi(match[2])
+		if match[3] != "" {
+			size, err := strconv.ParseFloat(match[3], 64)
+			if err == nil {
+				progress.Bytes = int64(size * byteUnits[match[4]])
+			}
+		}
+		return progress, true
+	}
+	if match := progressCountRegex.FindStringSubmatch(line); match != nil {
+		return Progress{Operation: operation, Stage: match[1], Percent: -1}, true
+	}
+	return Progress{}, false
+}
+
+// progressWriter splits Git's stderr into progress, which it reports to a
+// ProgressFunc (and relays to 'progress', if set), and other output (e.g.
+// errors), which it relays to 'next'. Git redraws its progress by ending lines
+// with '\r', so both '\r' and '\n' end a line.
+type progressWriter struct {
+	operation string
+	f         ProgressFunc
+	next      io.Writer
+	progress  io.Writer
+
+	lock    sync.Mutex
+	partial []byte
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		end := strings.IndexAny(string(w.partial), "\r\n")
+		if end < 0 {
+			break
+		}
+		line := w.partial[:end+1]
+		err := w.writeLine(line)
+		w.partial = w.partial[end+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// flush writes the output not ending with a newline, if any.
+func (w *progressWriter) flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if len(w.partial) > 0 {
+		w.writeLine(w.partial)
+		w.partial = nil
+	}
+}
+
+func (w *progressWriter) writeLine(line []byte) error {
+	progress, isProgress := parseProgress(w.operation, string(line))
+	if !isProgress {
+		_, err := w.next.Write(line)
+		return err
+	}
+
+	w.f(progress)
+	if w.progress != nil {
+		_, err := w.progress.Write(line)
+		return err
+	}
+	return nil
+}
+
+// progressStderr returns the writer to which to write the stderr of the given
+// operation if its progress is reported (see WithProgressFunc), and otherwise
+// 'stderr' itself, along with the function to call once the operation is done
+// to write any output not ending with a newline.
+func (g *gitHelper) progressStderr(ctx context.Context, operation string, stderr io.Writer) (io.Writer, func()) {
+	f := progressFunc(ctx)
+	if f == nil {
+		return stderr, func() {}
+	}
+
+	w := &progressWriter{
+		operation: operation,
+		f:         f,
+		next:      stderr,
+		progress:  g.options.Progress,
+	}
+	return w, w.flush
+}
@@ -0,0 +1,73 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// URLRewrite is a rule rewriting the URLs of remotes, like Git's
+// 'url.<base>.insteadOf': a URL starting with 'InsteadOf' is rewritten to start
+// with 'Base' instead.
+type URLRewrite struct {
+	Base      string `json:"base"`
+	InsteadOf string `json:"insteadOf"`
+}
+
+// Validate checks that the rule can be passed to Git on its command line.
+func (r URLRewrite) Validate() error {
+	if r.Base == "" || r.InsteadOf == "" {
+		return fmt.Errorf("the base and the prefix it replaces must not be empty")
+	}
+	if strings.Contains(r.Base, "=") {
+		// Git reads 'url.<base>.insteadOf=<prefix>' up to the first '='
+		return fmt.Errorf("the base must not contain '='")
+	}
+	if strings.ContainsAny(r.Base+r.InsteadOf, "\n\x00") {
+		return fmt.Errorf("the base and the prefix must not contain newlines")
+	}
+	return nil
+}
+
+// RemoteConfig configures how Git connects to the remote of a repository when
+// cloning and fetching it.
+type RemoteConfig struct {
+	// The proxy through which to connect (Git's 'http.proxy'). If empty,
+	// Git's own configuration applies.
+	Proxy string
+
+	// The rules rewriting the URL of the remote, in addition to those of
+	// Git's own configuration. The URL stored in the repository is
+	// unchanged.
+	URLRewrites []URLRewrite
+}
+
+// args returns the arguments configuring Git to connect to the remote as
+// configured.
+func (r RemoteConfig) args() []string {
+	args := []string{}
+	if r.Proxy != "" {
+		args = append(args, "-c", "http.proxy="+r.Proxy)
+	}
+	for _, rewrite := range r.URLRewrites {
+		args = append(args, "-c", fmt.Sprintf("url.%s.insteadOf=%s", rewrite.Base, rewrite.InsteadOf))
+	}
+	return args
+}
+
+// RewriteURL returns the URL to which Git connects for a remote with the given
+// URL under the given rules. As in Git, the rule with the longest matching
+// prefix applies; if none matches, the URL is returned as-is.
+func RewriteURL(url string, rewrites []URLRewrite) string {
+	var match *URLRewrite
+	for i := range rewrites {
+		if strings.HasPrefix(url, rewrites[i].InsteadOf) &&
+			(match == nil || len(rewrites[i].InsteadOf) > len(match.InsteadOf)) {
+			match = &rewrites[i]
+		}
+	}
+
+	if match == nil {
+		return url
+	}
+	return match.Base + strings.TrimPrefix(url, match.InsteadOf)
+}
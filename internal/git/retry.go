@@ -0,0 +1,117 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+)
+
+// RetryPolicy configures how clones and fetches that fail because of a
+// (likely) transient network error are retried.
+type RetryPolicy struct {
+	// The maximum number of attempts, including the first. One (or less)
+	// means failures are never retried.
+	Attempts int
+
+	// The delay before the first retry. The delay doubles with every retry.
+	BaseDelay time.Duration
+
+	// The fraction (from 0 to 1) by which each delay is randomly lengthened
+	// or shortened, so that many routes failing at once don't retry in
+	// lockstep.
+	Jitter float64
+}
+
+// The retry policy, unless configured otherwise (see Options).
+var DefaultRetryPolicy RetryPolicy = RetryPolicy{
+	Attempts:  3,
+	BaseDelay: 5 * time.Second,
+	Jitter:    0.2,
+}
+
+// The messages printed by Git when it fails because of a network error that
+// may not recur, e.g. a dropped connection. Failures that are sure to recur
+// (e.g. a missing repository or invalid credentials) aren't retried.
+var transientErrorMessages = []string{
+	"could not resolve host",
+	"connection reset",
+	"connection refused",
+	"couldn't connect to server",
+	"connection timed out",
+	"operation timed out",
+	"the remote end hung up unexpectedly",
+	"early eof",
+	"rpc failed",
+	"unexpected disconnect",
+	"gnutls_handshake() failed",
+	"ssl_error_syscall",
+	"the requested url returned error: 429",
+	"the requested url returned error: 500",
+	"the requested url returned error: 502",
+	"the requested url returned error: 503",
+	"the requested url returned error: 504",
+}
+
+// isTransientError returns whether the given error of a clone or fetch is
+// likely to be caused by a transient network error.
+func isTransientError(err error) bool {
+	var exitErr *cmd.ExitError
+	if !errors.As(err, &exitErr) {
+		// E.g. a timeout, which would likely just time out again.
+		return false
+	}
+
+	for _, line := range exitErr.StderrTail {
+		line = strings.ToLower(line)
+		for _, message := range transientErrorMessages {
+			if strings.Contains(line, message) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the given retry (starting from 1).
+func (p RetryPolicy) delay(retry int) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if p.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// withRetries runs 'attempt' until it succeeds, fails with a non-transient
+// error, or has been tried as many times as the retry policy allows. Each retry
+// is recorded in a trace2 region (including the delay before it).
+func (g *gitHelper) withRetries(ctx context.Context, label string, attempt func(ctx context.Context) error) error {
+	// Time the operation as a whole, including its retries.
+	stopTimer := g.logger.StartTimer(ctx, "git", label)
+	defer stopTimer()
+
+	policy := g.options.Retry
+	err := attempt(ctx)
+	for retry := 1; retry < policy.Attempts && err != nil && isTransientError(err); retry++ {
+		g.logger.AddToCounter(ctx, "git", label+"_retries", 1)
+		err = func() error {
+			retryCtx, exitRegion := g.logger.Region(ctx, "git", label+"_retry")
+			defer exitRegion()
+
+			delay := policy.delay(retry)
+			fmt.Fprintf(g.remoteStderr(), "Retrying %s in %s (attempt %d of %d)\n",
+				label, delay.Round(100*time.Millisecond), retry+1, policy.Attempts)
+			select {
+			case <-retryCtx.Done():
+				return retryCtx.Err()
+			case <-time.After(delay):
+			}
+			return attempt(retryCtx)
+		}()
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package git_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var transientErr = &cmd.ExitError{
+	Command:    "git",
+	ExitCode:   128,
+	StderrTail: []string{"fatal: unable to access 'https://example.com/repo.git/': Could not resolve host: example.com"},
+}
+
+var permanentErr = &cmd.ExitError{
+	Command:    "git",
+	ExitCode:   128,
+	StderrTail: []string{"fatal: repository 'https://example.com/repo.git/' not found"},
+}
+
+var retryTests = []struct {
+	title string
+
+	// Mocked responses, one per attempt
+	fetchErrs []error
+
+	// Expected values
+	expectedAttempts int
+	expectErr        bool
+}{
+	{
+		"Success",
+		[]error{nil},
+		1,
+		false,
+	},
+	{
+		"Transient failure, then success",
+		[]error{transientErr, nil},
+		2,
+		false,
+	},
+	{
+		"Transient failures exhaust attempts",
+		[]error{transientErr, transientErr, transientErr},
+		3,
+		true,
+	},
+	{
+		"Permanent failure is not retried",
+		[]error{permanentErr},
+		1,
+		true,
+	},
+	{
+		"Timeout is not retried",
+		[]error{errors.New("command timed out after 1h0m0s")},
+		1,
+		true,
+	},
+}
+
+func TestGit_UpdateBareRepoRetries(t *testing.T) {
+	for _, tt := range retryTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testCommandExecutor := &MockCommandExecutor{}
+			gitHelper := git.NewGitHelperWithOptions(&MockTraceLogger{}, testCommandExecutor, git.Options{
+				Retry: git.RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, Jitter: 0.5},
+			})
+
+			for _, fetchErr := range tt.fetchErrs {
+				testCommandExecutor.On("RunCaptured",
+					mock.Anything,
+					"git",
+					[]string{"-C", "/test/repo", "fetch", "--no-progress", "--prune", "origin"},
+					mock.Anything,
+				).Return(nil, fetchErr).Once()
+			}
+
+			err := gitHelper.UpdateBareRepo(context.Background(), "/test/repo", git.RemoteConfig{}, true)
+			if tt.expectErr {
+				var fetchErr *git.FetchError
+				assert.True(t, errors.As(err, &fetchErr))
+			} else {
+				assert.NoError(t, err)
+			}
+			testCommandExecutor.AssertNumberOfCalls(t, "RunCaptured", tt.expectedAttempts)
+		})
+	}
+}
@@ -0,0 +1,401 @@
+// Package jobs implements the queue of the background updates run by the web
+// server (see 'git-bundle-web-server --auto-update'). The queue is stored in
+// the bundle server's root, so that queued updates survive restarts of the web
+// server and can be listed and cancelled with 'git-bundle-server jobs'.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The version of the queue file's format written by this version of the
+// bundle server.
+const queueVersion int = 1
+
+// The lock serializing changes to the queue file. It is separate from the
+// queue file so that readers never wait for it.
+const queueLockFilename string = "jobs.lock"
+
+// Priority orders the pending jobs: jobs with a higher priority run first, and
+// jobs with the same priority run in the order they were queued.
+type Priority int
+
+const (
+	// Updates started by the web server's scheduler.
+	PriorityLow Priority = iota
+
+	// Updates triggered by a push to the remote (i.e. a webhook).
+	PriorityNormal
+
+	// Updates requested by an operator through the admin API.
+	PriorityHigh
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return strconv.Itoa(int(p))
+}
+
+func (p Priority) MarshalText() ([]byte, error) {
+	if _, ok := priorityNames[p]; !ok {
+		return nil, fmt.Errorf("invalid priority %d", int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+func (p *Priority) UnmarshalText(text []byte) error {
+	for priority, name := range priorityNames {
+		if name == string(text) {
+			*p = priority
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid priority '%s'", string(text))
+}
+
+// State is the state of a job in the queue. Jobs leave the queue when they
+// finish, so there are no states for finished jobs.
+type State string
+
+const (
+	StatePending State = "pending"
+	StateRunning State = "running"
+
+	// A running job that was cancelled, which the web server stops at its
+	// next check (see Runner).
+	StateCancelled State = "cancelled"
+)
+
+// Job is an update of a route in the queue.
+type Job struct {
+	ID    int64  `json:"id"`
+	Route string `json:"route"`
+
+	// What queued the job (e.g. 'scheduled', 'webhook', or 'admin').
+	Reason   string   `json:"reason"`
+	Priority Priority `json:"priority"`
+	State    State    `json:"state"`
+
+	QueuedAt  time.Time  `json:"queuedAt"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+}
+
+type queueFile struct {
+	Version int   `json:"version"`
+	NextID  int64 `json:"nextId"`
+	Jobs    []Job `json:"jobs"`
+}
+
+// sortJobs sorts the jobs in the order they are listed: the running (and
+// cancelled) jobs in the order they started, followed by the pending jobs in
+// the order they will run.
+func sortJobs(jobs []Job) {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		a, b := jobs[i], jobs[j]
+		if (a.State == StatePending) != (b.State == StatePending) {
+			return a.State != StatePending
+		}
+		if a.State != StatePending {
+			return a.StartedAt.Before(*b.StartedAt)
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.ID < b.ID
+	})
+}
+
+type JobQueue interface {
+	// Enqueue queues an update of the given route, unless one is already
+	// pending (an update may be pending while another one runs). In that
+	// case, the pending job's priority is raised to 'priority' (and its
+	// reason replaced) if it is lower. Returns the pending job, and whether
+	// it was queued by this call.
+	Enqueue(ctx context.Context, route string, reason string, priority Priority) (Job, bool, error)
+
+	// List returns the jobs in the queue: the running jobs, followed by the
+	// pending jobs in the order they will run.
+	List(ctx context.Context) ([]Job, error)
+
+	// Cancel cancels the job with the given ID or, if 'idOrRoute' is not an
+	// ID, the jobs of the given route. Pending jobs are removed from the
+	// queue, while running jobs are marked as cancelled, to be stopped by the
+	// web server. Returns the cancelled jobs, which are empty if none match.
+	Cancel(ctx context.Context, idOrRoute string) ([]Job, error)
+
+	// Claim marks the next pending job as running and returns it, or returns
+	// nil if no job can run. A job cannot run while another job of its route
+	// is running.
+	Claim(ctx context.Context) (*Job, error)
+
+	// Finish removes the job with the given ID from the queue once it is no
+	// longer running.
+	Finish(ctx context.Context, id int64) error
+
+	// Requeue marks the running jobs (e.g. those interrupted when the web
+	// server stopped) as pending again, in their original order, and removes
+	// those that were cancelled.
+	Requeue(ctx context.Context) error
+}
+
+type jobQueue struct {
+	logger     log.TraceLogger
+	fileSystem common.FileSystem
+	filename   string
+}
+
+// NewJobQueue creates a job queue stored in the given file. The file is created
+// when the first job is queued.
+func NewJobQueue(l log.TraceLogger, fs common.FileSystem, filename string) JobQueue {
+	return &jobQueue{
+		logger:     l,
+		fileSystem: fs,
+		filename:   filename,
+	}
+}
+
+func (q *jobQueue) read() (*queueFile, error) {
+	lines, err := q.fileSystem.ReadFileLines(q.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := &queueFile{Version: queueVersion, NextID: 1, Jobs: []Job{}}
+	if len(lines) == 0 {
+		return queue, nil
+	}
+
+	err = json.Unmarshal([]byte(strings.Join(lines, "\n")), queue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job queue: %w", err)
+	}
+	if queue.Version > queueVersion {
+		return nil, fmt.Errorf("job queue version %d is not supported; "+
+			"it may have been written by a newer version of git-bundle-server", queue.Version)
+	}
+	return queue, nil
+}
+
+// update applies 'updateFunc' to the queue while holding its lock, writing the
+// queue back if the function reports that it changed.
+func (q *jobQueue) update(updateFunc func(queue *queueFile) bool) error {
+	lock, err := q.fileSystem.AcquireFileLock(filepath.Join(filepath.Dir(q.filename), queueLockFilename))
+	if err != nil {
+		return fmt.Errorf("failed to lock job queue: %w", err)
+	}
+	defer lock.Unlock()
+
+	queue, err := q.read()
+	if err != nil {
+		return err
+	}
+	if !updateFunc(queue) {
+		return nil
+	}
+
+	queue.Version = queueVersion
+	sortJobs(queue.Jobs)
+	lockFile, err := q.fileSystem.WriteLockFileFunc(q.filename, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(queue)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write job queue: %w", err)
+	}
+	return lockFile.Commit()
+}
+
+func (q *jobQueue) Enqueue(ctx context.Context, route string, reason string, priority Priority) (Job, bool, error) {
+	//lint:ignore SA4006 keep ctx up-to-date
+	ctx, exitRegion := q.logger.Region(ctx, "jobs", "enqueue")
+	defer exitRegion()
+
+	var job Job
+	queued := false
+	err := q.update(func(queue *queueFile) bool {
+		for i := range queue.Jobs {
+			pending := &queue.Jobs[i]
+			if pending.Route != route || pending.State != StatePending {
+				continue
+			}
+			job = *pending
+			if pending.Priority >= priority {
+				return false
+			}
+			pending.Priority = priority
+			pending.Reason = reason
+			job = *pending
+			return true
+		}
+
+		job = Job{
+			ID:       queue.NextID,
+			Route:    route,
+			Reason:   reason,
+			Priority: priority,
+			State:    StatePending,
+			QueuedAt: time.Now().UTC(),
+		}
+		queue.NextID++
+		queue.Jobs = append(queue.Jobs, job)
+		queued = true
+		return true
+	})
+	if err != nil {
+		return Job{}, false, err
+	}
+	return job, queued, nil
+}
+
+func (q *jobQueue) List(ctx context.Context) ([]Job, error) {
+	// The queue file is replaced atomically, so it can be read without
+	// taking its lock.
+	queue, err := q.read()
+	if err != nil {
+		return nil, err
+	}
+	sortJobs(queue.Jobs)
+	return queue.Jobs, nil
+}
+
+func (q *jobQueue) Cancel(ctx context.Context, idOrRoute string) ([]Job, error) {
+	//lint:ignore SA4006 keep ctx up-to-date
+	ctx, exitRegion := q.logger.Region(ctx, "jobs", "cancel")
+	defer exitRegion()
+
+	id, err := strconv.ParseInt(idOrRoute, 10, 64)
+	isID := err == nil
+
+	cancelled := []Job{}
+	err = q.update(func(queue *queueFile) bool {
+		remaining := make([]Job, 0, len(queue.Jobs))
+		for _, job := range queue.Jobs {
+			if (isID && job.ID != id) || (!isID && job.Route != idOrRoute) || job.State == StateCancelled {
+				remaining = append(remaining, job)
+				continue
+			}
+
+			if job.State == StateRunning {
+				job.State = StateCancelled
+				remaining = append(remaining, job)
+			}
+			cancelled = append(cancelled, job)
+		}
+		queue.Jobs = remaining
+		return len(cancelled) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cancelled, nil
+}
+
+func (q *jobQueue) Claim(ctx context.Context) (*Job, error) {
+	//lint:ignore SA4006 keep ctx up-to-date
+	ctx, exitRegion := q.logger.Region(ctx, "jobs", "claim")
+	defer exitRegion()
+
+	var claimed *Job
+	err := q.update(func(queue *queueFile) bool {
+		running := map[string]bool{}
+		for _, job := range queue.Jobs {
+			if job.State != StatePending {
+				running[job.Route] = true
+			}
+		}
+
+		sortJobs(queue.Jobs)
+		for i := range queue.Jobs {
+			job := &queue.Jobs[i]
+			if job.State != StatePending || running[job.Route] {
+				continue
+			}
+
+			now := time.Now().UTC()
+			job.State = StateRunning
+			job.StartedAt = &now
+			claimedJob := *job
+			claimed = &claimedJob
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+func (q *jobQueue) Finish(ctx context.Context, id int64) error {
+	//lint:ignore SA4006 keep ctx up-to-date
+	ctx, exitRegion := q.logger.Region(ctx, "jobs", "finish")
+	defer exitRegion()
+
+	return q.update(func(queue *queueFile) bool {
+		for i, job := range queue.Jobs {
+			if job.ID == id {
+				queue.Jobs = append(queue.Jobs[:i], queue.Jobs[i+1:]...)
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (q *jobQueue) Requeue(ctx context.Context) error {
+	//lint:ignore SA4006 keep ctx up-to-date
+	ctx, exitRegion := q.logger.Region(ctx, "jobs", "requeue")
+	defer exitRegion()
+
+	return q.update(func(queue *queueFile) bool {
+		changed := false
+		remaining := make([]Job, 0, len(queue.Jobs))
+		for _, job := range queue.Jobs {
+			switch job.State {
+			case StateCancelled:
+				changed = true
+				continue
+			case StateRunning:
+				job.State = StatePending
+				job.StartedAt = nil
+				changed = true
+			}
+			remaining = append(remaining, job)
+		}
+
+		// Only one job of each route may be pending, so keep the first of a
+		// route that had both a running and a pending job.
+		seen := map[string]bool{}
+		queue.Jobs = remaining[:0]
+		sortJobs(remaining)
+		for _, job := range remaining {
+			if seen[job.Route] {
+				changed = true
+				continue
+			}
+			seen[job.Route] = true
+			queue.Jobs = append(queue.Jobs, job)
+		}
+		return changed
+	})
+}
@@ -0,0 +1,198 @@
+package jobs_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/jobs"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestQueue(t *testing.T) jobs.JobQueue {
+	return jobs.NewJobQueue(&MockTraceLogger{}, common.NewFileSystem(), filepath.Join(t.TempDir(), "jobs.json"))
+}
+
+func routes(jobList []jobs.Job) []string {
+	result := make([]string, 0, len(jobList))
+	for _, job := range jobList {
+		result = append(result, job.Route)
+	}
+	return result
+}
+
+func TestJobQueue_Enqueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("One pending job per route", func(t *testing.T) {
+		queue := newTestQueue(t)
+
+		first, queued, err := queue.Enqueue(ctx, "test/repo", "scheduled", jobs.PriorityLow)
+		assert.Nil(t, err)
+		assert.True(t, queued)
+
+		second, queued, err := queue.Enqueue(ctx, "test/repo", "scheduled", jobs.PriorityLow)
+		assert.Nil(t, err)
+		assert.False(t, queued)
+		assert.Equal(t, first.ID, second.ID)
+
+		list, err := queue.List(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, list, 1)
+	})
+
+	t.Run("A higher priority raises the pending job's", func(t *testing.T) {
+		queue := newTestQueue(t)
+
+		_, _, err := queue.Enqueue(ctx, "test/repo", "scheduled", jobs.PriorityLow)
+		assert.Nil(t, err)
+
+		job, queued, err := queue.Enqueue(ctx, "test/repo", "admin", jobs.PriorityHigh)
+		assert.Nil(t, err)
+		assert.False(t, queued)
+		assert.Equal(t, jobs.PriorityHigh, job.Priority)
+		assert.Equal(t, "admin", job.Reason)
+
+		// A lower priority doesn't lower it back
+		job, _, err = queue.Enqueue(ctx, "test/repo", "webhook", jobs.PriorityNormal)
+		assert.Nil(t, err)
+		assert.Equal(t, jobs.PriorityHigh, job.Priority)
+		assert.Equal(t, "admin", job.Reason)
+	})
+
+	t.Run("A route may be pending while it runs", func(t *testing.T) {
+		queue := newTestQueue(t)
+
+		_, _, err := queue.Enqueue(ctx, "test/repo", "webhook", jobs.PriorityNormal)
+		assert.Nil(t, err)
+		running, err := queue.Claim(ctx)
+		assert.Nil(t, err)
+		assert.NotNil(t, running)
+
+		_, queued, err := queue.Enqueue(ctx, "test/repo", "webhook", jobs.PriorityNormal)
+		assert.Nil(t, err)
+		assert.True(t, queued)
+
+		// ...but the pending job doesn't run until the running one finishes
+		next, err := queue.Claim(ctx)
+		assert.Nil(t, err)
+		assert.Nil(t, next)
+
+		assert.Nil(t, queue.Finish(ctx, running.ID))
+		next, err = queue.Claim(ctx)
+		assert.Nil(t, err)
+		assert.NotNil(t, next)
+	})
+}
+
+func TestJobQueue_Claim(t *testing.T) {
+	ctx := context.Background()
+	queue := newTestQueue(t)
+
+	for _, enqueue := range []struct {
+		route    string
+		priority jobs.Priority
+	}{
+		{"test/scheduled-1", jobs.PriorityLow},
+		{"test/webhook", jobs.PriorityNormal},
+		{"test/scheduled-2", jobs.PriorityLow},
+		{"test/admin", jobs.PriorityHigh},
+	} {
+		_, _, err := queue.Enqueue(ctx, enqueue.route, "test", enqueue.priority)
+		assert.Nil(t, err)
+	}
+
+	list, err := queue.List(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test/admin", "test/webhook", "test/scheduled-1", "test/scheduled-2"}, routes(list))
+
+	claimed := []string{}
+	for {
+		job, err := queue.Claim(ctx)
+		assert.Nil(t, err)
+		if job == nil {
+			break
+		}
+		assert.Equal(t, jobs.StateRunning, job.State)
+		assert.NotNil(t, job.StartedAt)
+		claimed = append(claimed, job.Route)
+	}
+	assert.Equal(t, routes(list), claimed)
+}
+
+func TestJobQueue_Cancel(t *testing.T) {
+	ctx := context.Background()
+	queue := newTestQueue(t)
+
+	running, _, err := queue.Enqueue(ctx, "test/repo", "webhook", jobs.PriorityNormal)
+	assert.Nil(t, err)
+	_, err = queue.Claim(ctx)
+	assert.Nil(t, err)
+	pending, _, err := queue.Enqueue(ctx, "test/repo", "webhook", jobs.PriorityNormal)
+	assert.Nil(t, err)
+	other, _, err := queue.Enqueue(ctx, "test/other", "scheduled", jobs.PriorityLow)
+	assert.Nil(t, err)
+
+	t.Run("Unknown ID", func(t *testing.T) {
+		cancelled, err := queue.Cancel(ctx, "1234")
+		assert.Nil(t, err)
+		assert.Empty(t, cancelled)
+	})
+
+	t.Run("By ID", func(t *testing.T) {
+		cancelled, err := queue.Cancel(ctx, "3")
+		assert.Nil(t, err)
+		assert.Len(t, cancelled, 1)
+		assert.Equal(t, other.ID, cancelled[0].ID)
+	})
+
+	t.Run("By route", func(t *testing.T) {
+		cancelled, err := queue.Cancel(ctx, "test/repo")
+		assert.Nil(t, err)
+		assert.Len(t, cancelled, 2)
+
+		// The pending job is removed, while the running one is marked for the
+		// runner to stop
+		list, err := queue.List(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, list, 1)
+		assert.Equal(t, running.ID, list[0].ID)
+		assert.Equal(t, jobs.StateCancelled, list[0].State)
+		assert.NotEqual(t, pending.ID, list[0].ID)
+
+		// Cancelling again has no effect
+		cancelled, err = queue.Cancel(ctx, "test/repo")
+		assert.Nil(t, err)
+		assert.Empty(t, cancelled)
+	})
+}
+
+func TestJobQueue_Requeue(t *testing.T) {
+	ctx := context.Background()
+	queue := newTestQueue(t)
+
+	for _, route := range []string{"test/running", "test/cancelled", "test/both"} {
+		_, _, err := queue.Enqueue(ctx, route, "scheduled", jobs.PriorityLow)
+		assert.Nil(t, err)
+		_, err = queue.Claim(ctx)
+		assert.Nil(t, err)
+	}
+	_, err := queue.Cancel(ctx, "test/cancelled")
+	assert.Nil(t, err)
+	_, _, err = queue.Enqueue(ctx, "test/both", "webhook", jobs.PriorityNormal)
+	assert.Nil(t, err)
+	_, _, err = queue.Enqueue(ctx, "test/pending", "scheduled", jobs.PriorityLow)
+	assert.Nil(t, err)
+
+	assert.Nil(t, queue.Requeue(ctx))
+
+	list, err := queue.List(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test/both", "test/running", "test/pending"}, routes(list))
+	for _, job := range list {
+		assert.Equal(t, jobs.StatePending, job.State)
+		assert.Nil(t, job.StartedAt)
+	}
+}
@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The interval at which the runner checks whether its running jobs were
+// cancelled (e.g. with 'git-bundle-server jobs cancel').
+const cancelPollInterval time.Duration = 5 * time.Second
+
+// RunFunc runs a job, stopping early if the given context is cancelled.
+type RunFunc func(ctx context.Context, job Job) error
+
+// PauseFunc returns whether the runner must not start any job for now (e.g.
+// while the bundle server is read-only).
+type PauseFunc func(ctx context.Context) bool
+
+// Runner runs the jobs of a queue in the background, up to a maximum number
+// at a time.
+type Runner struct {
+	logger     log.TraceLogger
+	appLogger  log.AppLogger
+	queue      JobQueue
+	run        RunFunc
+	maxRunning int
+	paused     PauseFunc
+
+	wake   chan struct{}
+	stop   chan struct{}
+	loopWg sync.WaitGroup
+	jobsWg sync.WaitGroup
+
+	// The jobs being run, by ID, with the functions cancelling them
+	runningLock sync.Mutex
+	running     map[int64]runningJob
+}
+
+type runningJob struct {
+	job    Job
+	cancel context.CancelFunc
+}
+
+func NewRunner(logger log.TraceLogger,
+	appLogger log.AppLogger,
+	queue JobQueue,
+	maxRunning int,
+	run RunFunc,
+) *Runner {
+	return &Runner{
+		logger:     logger,
+		appLogger:  appLogger,
+		queue:      queue,
+		run:        run,
+		maxRunning: maxRunning,
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		running:    make(map[int64]runningJob),
+	}
+}
+
+// SetPauseFunc sets the function consulted before starting jobs: while it
+// returns true, the queued jobs stay pending (the running jobs are left to
+// complete). It must be called before Start.
+func (r *Runner) SetPauseFunc(paused PauseFunc) {
+	r.paused = paused
+}
+
+// Start requeues the jobs interrupted when the queue was last run, then runs
+// the queued jobs in the background until Stop is called.
+func (r *Runner) Start(ctx context.Context) error {
+	err := r.queue.Requeue(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.loopWg.Add(1)
+	go func() {
+		defer r.loopWg.Done()
+		ctx, exitThread := r.logger.Goroutine(ctx, "job-runner")
+		defer exitThread()
+
+		ticker := time.NewTicker(cancelPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			default:
+			}
+
+			r.stopCancelled(ctx)
+			r.startJobs(ctx)
+
+			select {
+			case <-r.stop:
+				return
+			case <-r.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Notify wakes the runner to check the queue for newly queued (or cancelled)
+// jobs without waiting for its next check.
+func (r *Runner) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+		// The runner is already due to wake up
+	}
+}
+
+// Running returns the jobs being run, sorted by route.
+func (r *Runner) Running() []Job {
+	r.runningLock.Lock()
+	defer r.runningLock.Unlock()
+
+	jobs := make([]Job, 0, len(r.running))
+	for _, running := range r.running {
+		jobs = append(jobs, running.job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Route < jobs[j].Route })
+	return jobs
+}
+
+// Stop stops starting jobs and waits for the running jobs to complete. The
+// pending jobs stay queued until the queue is run again.
+func (r *Runner) Stop() {
+	close(r.stop)
+	r.loopWg.Wait()
+	r.jobsWg.Wait()
+}
+
+// stopCancelled cancels the running jobs that were cancelled in the queue.
+func (r *Runner) stopCancelled(ctx context.Context) {
+	r.runningLock.Lock()
+	defer r.runningLock.Unlock()
+	if len(r.running) == 0 {
+		return
+	}
+
+	jobs, err := r.queue.List(ctx)
+	if err != nil {
+		r.appLogger.Errorf(ctx, "Failed to read job queue: %s", err)
+		return
+	}
+
+	active := make(map[int64]bool, len(jobs))
+	for _, job := range jobs {
+		active[job.ID] = job.State == StateRunning
+	}
+	for id, running := range r.running {
+		if !active[id] {
+			running.cancel()
+		}
+	}
+}
+
+// startJobs runs queued jobs until the maximum number of jobs is running or no
+// more jobs can run.
+func (r *Runner) startJobs(ctx context.Context) {
+	if r.paused != nil && r.paused(ctx) {
+		return
+	}
+
+	for {
+		r.runningLock.Lock()
+		full := len(r.running) >= r.maxRunning
+		r.runningLock.Unlock()
+		if full {
+			return
+		}
+
+		job, err := r.queue.Claim(ctx)
+		if err != nil {
+			r.appLogger.Errorf(ctx, "Failed to read job queue: %s", err)
+			return
+		} else if job == nil {
+			return
+		}
+		r.startJob(ctx, *job)
+	}
+}
+
+func (r *Runner) startJob(ctx context.Context, job Job) {
+	jobCtx, cancel := context.WithCancel(ctx)
+
+	r.runningLock.Lock()
+	r.running[job.ID] = runningJob{job: job, cancel: cancel}
+	r.runningLock.Unlock()
+
+	r.jobsWg.Add(1)
+	go func() {
+		defer r.jobsWg.Done()
+		ctx, exitThread := r.logger.Goroutine(jobCtx, "job")
+		defer exitThread()
+
+		err := r.run(ctx, job)
+		if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+			r.appLogger.Warnf(ctx, "Update (%s) of %s was cancelled", job.Reason, job.Route)
+		} else if err != nil {
+			r.appLogger.Errorf(ctx, "Update (%s) of %s failed: %s", job.Reason, job.Route, err)
+		} else {
+			r.appLogger.Infof(ctx, "Update (%s) of %s complete", job.Reason, job.Route)
+		}
+		cancel()
+
+		err = r.queue.Finish(ctx, job.ID)
+		if err != nil {
+			r.appLogger.Errorf(ctx, "Failed to remove job %d from the queue: %s", job.ID, err)
+		}
+
+		r.runningLock.Lock()
+		delete(r.running, job.ID)
+		r.runningLock.Unlock()
+
+		// Another job may now be able to run
+		r.Notify()
+	}()
+}
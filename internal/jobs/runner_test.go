@@ -0,0 +1,127 @@
+package jobs_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/jobs"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Runs queued jobs up to the limit", func(t *testing.T) {
+		queue := newTestQueue(t)
+		for _, route := range []string{"test/a", "test/b", "test/c"} {
+			_, _, err := queue.Enqueue(ctx, route, "test", jobs.PriorityNormal)
+			assert.Nil(t, err)
+		}
+
+		var lock sync.Mutex
+		running, maxRunning := 0, 0
+		ran := []string{}
+		runner := jobs.NewRunner(&MockTraceLogger{}, log.NopAppLogger(), queue, 2,
+			func(ctx context.Context, job jobs.Job) error {
+				lock.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				lock.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				lock.Lock()
+				running--
+				ran = append(ran, job.Route)
+				lock.Unlock()
+				return nil
+			})
+		assert.Nil(t, runner.Start(ctx))
+
+		assert.Eventually(t, func() bool {
+			list, err := queue.List(ctx)
+			return err == nil && len(list) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+		runner.Stop()
+
+		assert.ElementsMatch(t, []string{"test/a", "test/b", "test/c"}, ran)
+		assert.Equal(t, 2, maxRunning)
+	})
+
+	t.Run("Stops cancelled jobs", func(t *testing.T) {
+		queue := newTestQueue(t)
+		_, _, err := queue.Enqueue(ctx, "test/repo", "test", jobs.PriorityNormal)
+		assert.Nil(t, err)
+
+		started := make(chan struct{})
+		runner := jobs.NewRunner(&MockTraceLogger{}, log.NopAppLogger(), queue, 1,
+			func(ctx context.Context, job jobs.Job) error {
+				close(started)
+				<-ctx.Done()
+				return ctx.Err()
+			})
+		assert.Nil(t, runner.Start(ctx))
+		<-started
+		assert.Len(t, runner.Running(), 1)
+
+		_, err = queue.Cancel(ctx, "test/repo")
+		assert.Nil(t, err)
+
+		runner.Notify()
+		assert.Eventually(t, func() bool {
+			return len(runner.Running()) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+		runner.Stop()
+
+		list, err := queue.List(ctx)
+		assert.Nil(t, err)
+		assert.Empty(t, list)
+	})
+
+	t.Run("Holds queued jobs while paused", func(t *testing.T) {
+		queue := newTestQueue(t)
+		_, _, err := queue.Enqueue(ctx, "test/repo", "test", jobs.PriorityNormal)
+		assert.Nil(t, err)
+
+		var lock sync.Mutex
+		paused := true
+		ran := make(chan struct{})
+		runner := jobs.NewRunner(&MockTraceLogger{}, log.NopAppLogger(), queue, 1,
+			func(ctx context.Context, job jobs.Job) error {
+				close(ran)
+				return nil
+			})
+		runner.SetPauseFunc(func(ctx context.Context) bool {
+			lock.Lock()
+			defer lock.Unlock()
+			return paused
+		})
+		assert.Nil(t, runner.Start(ctx))
+
+		runner.Notify()
+		time.Sleep(50 * time.Millisecond)
+		list, err := queue.List(ctx)
+		assert.Nil(t, err)
+		if assert.Len(t, list, 1) {
+			assert.Equal(t, jobs.StatePending, list[0].State)
+		}
+
+		lock.Lock()
+		paused = false
+		lock.Unlock()
+		runner.Notify()
+
+		select {
+		case <-ran:
+		case <-time.After(5 * time.Second):
+			t.Error("the job did not run after the runner was resumed")
+		}
+		runner.Stop()
+	})
+}
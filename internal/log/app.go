@@ -0,0 +1,204 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The levels, formats, and targets of application logs, by name.
+var (
+	AppLogLevels = []string{"debug", "info", "warn", "error"}
+
+	AppLogFormats = []string{"console", "json"}
+
+	AppLogTargets = []string{"file", "syslog", "journald"}
+)
+
+// AppLogConfig configures an AppLogger.
+type AppLogConfig struct {
+	// The minimum level (one of AppLogLevels) of the messages logged.
+	Level string
+
+	// The encoding (one of AppLogFormats) of each message: 'console' for
+	// tab-separated, human-readable lines or 'json' for one JSON object per
+	// line.
+	Format string
+
+	// Where messages are sent (one of AppLogTargets): 'file' to append them
+	// to File, 'syslog' to send them to the syslog daemon at SyslogAddress,
+	// or 'journald' to send them to the local journald. Defaults to 'file'.
+	Target string
+
+	// The file to which messages are appended. If empty, messages are written
+	// to the default output of the logger instead.
+	File string
+
+	// The address of the syslog daemon (see parseSyslogAddress); if empty,
+	// the local syslog daemon.
+	SyslogAddress string
+
+	// The size (in bytes) at which the file is rotated, the age after which
+	// rotated files are removed, and the number of rotated files that are
+	// kept. Zero means no limit.
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+// AppLogger logs operator-facing messages describing what the application is
+// doing (e.g. the requests served by the web server). Unlike the events of a
+// TraceLogger, which are telemetry for debugging and performance analysis, the
+// messages are meant to be read by the people running the application.
+//
+// Each message is annotated with the trace2 session ID and thread of the
+// context (if any), so that it can be correlated with the trace2 events, and
+// with the ID of the HTTP request being handled (if any).
+type AppLogger interface {
+	Debugf(ctx context.Context, format string, a ...any)
+	Infof(ctx context.Context, format string, a ...any)
+	Warnf(ctx context.Context, format string, a ...any)
+	Errorf(ctx context.Context, format string, a ...any)
+
+	// Close flushes any buffered messages and closes the log file or
+	// connection to syslog or journald (if any).
+	Close() error
+}
+
+type appLogger struct {
+	logger *zap.Logger
+	closer io.Closer
+}
+
+// NewAppLogger creates an AppLogger as configured by 'config', writing to
+// 'defaultOut' unless a log file, syslog, or journald is configured. An empty level or format
+// defaults to 'info' and 'console', respectively.
+func NewAppLogger(config AppLogConfig, defaultOut io.Writer) (AppLogger, error) {
+	level := zapcore.InfoLevel
+	if config.Level != "" {
+		err := level.UnmarshalText([]byte(strings.ToLower(config.Level)))
+		if err != nil || level > zapcore.ErrorLevel {
+			return nil, fmt.Errorf("invalid log level '%s'", config.Level)
+		}
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "time"
+	encoderConfig.MessageKey = "msg"
+	encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	encoderConfig.EncodeDuration = zapcore.StringDurationEncoder
+
+	target := strings.ToLower(config.Target)
+	if target == "syslog" {
+		// The syslog daemon records the time and severity of each message
+		// itself.
+		encoderConfig.TimeKey = ""
+		encoderConfig.LevelKey = ""
+	}
+
+	var encoder zapcore.Encoder
+	switch strings.ToLower(config.Format) {
+	case "", "console":
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	case "json":
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	default:
+		return nil, fmt.Errorf("invalid log format '%s'", config.Format)
+	}
+
+	// Messages sent to syslog and journald are identified by the name of the
+	// program.
+	identifier := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+
+	switch target {
+	case "", "file":
+		l := &appLogger{}
+		out := defaultOut
+		if config.File != "" {
+			file, err := newRotatingFile(config.File, config.MaxSize, config.MaxAge, config.MaxBackups)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open log file: %w", err)
+			}
+			l.closer = file
+			out = file
+		}
+		l.logger = zap.New(zapcore.NewCore(encoder, zapcore.Lock(zapcore.AddSync(out)), level))
+		return l, nil
+	case "syslog":
+		writer, err := dialSyslog(config.SyslogAddress, identifier)
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to syslog: %w", err)
+		}
+		return &appLogger{
+			logger: zap.New(newSyslogCore(level, encoder, writer)),
+			closer: writer,
+		}, nil
+	case "journald":
+		core, err := dialJournald(level, identifier)
+		if err != nil {
+			return nil, err
+		}
+		return &appLogger{logger: zap.New(core), closer: core}, nil
+	default:
+		return nil, fmt.Errorf("invalid log target '%s'", config.Target)
+	}
+}
+
+// NopAppLogger returns an AppLogger that discards every message.
+func NopAppLogger() AppLogger {
+	return &appLogger{logger: zap.NewNop()}
+}
+
+// contextFields returns the trace2 session ID and thread and the HTTP request
+// ID of the context, if it has them.
+func contextFields(ctx context.Context) []zap.Field {
+	fields := []zap.Field{}
+	if ok, sid := getContextValue[string](ctx, sidId); ok {
+		fields = append(fields, zap.String("sid", sid))
+	}
+	if ok, thread := getContextValue[string](ctx, threadNameId); ok {
+		fields = append(fields, zap.String("thread", thread))
+	}
+	if requestId := RequestId(ctx); requestId != "" {
+		fields = append(fields, zap.String("request_id", requestId))
+	}
+	return fields
+}
+
+func (l *appLogger) log(ctx context.Context, level zapcore.Level, format string, a ...any) {
+	if entry := l.logger.Check(level, fmt.Sprintf(format, a...)); entry != nil {
+		entry.Write(contextFields(ctx)...)
+	}
+}
+
+func (l *appLogger) Debugf(ctx context.Context, format string, a ...any) {
+	l.log(ctx, zapcore.DebugLevel, format, a...)
+}
+
+func (l *appLogger) Infof(ctx context.Context, format string, a ...any) {
+	l.log(ctx, zapcore.InfoLevel, format, a...)
+}
+
+func (l *appLogger) Warnf(ctx context.Context, format string, a ...any) {
+	l.log(ctx, zapcore.WarnLevel, format, a...)
+}
+
+func (l *appLogger) Errorf(ctx context.Context, format string, a ...any) {
+	l.log(ctx, zapcore.ErrorLevel, format, a...)
+}
+
+func (l *appLogger) Close() error {
+	l.logger.Sync()
+	if l.closer != nil {
+		return l.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestAppLogger_Levels(t *testing.T) {
+	out := &bytes.Buffer{}
+	appLogger, err := NewAppLogger(AppLogConfig{Level: "warn"}, out)
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	appLogger.Debugf(ctx, "debug message")
+	appLogger.Infof(ctx, "info message")
+	appLogger.Warnf(ctx, "warning about %s", "org/repo")
+	appLogger.Errorf(ctx, "error message")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "\tWARN\twarning about org/repo")
+	assert.Contains(t, lines[1], "\tERROR\terror message")
+}
+
+func TestAppLogger_JsonFile(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "server.log")
+	appLogger, err := NewAppLogger(AppLogConfig{Format: "json", File: logFile}, nil)
+	assert.Nil(t, err)
+
+	// Log with the context of a trace2 thread
+	tr2 := &Trace2{logger: zap.NewNop(), lastChildId: -1}
+	ctx := tr2.logStart(context.Background())
+	ctx, exitThread := tr2.Goroutine(ctx, "request")
+	appLogger.Infof(ctx, "Serving %s", "org/repo")
+	exitThread()
+	assert.Nil(t, appLogger.Close())
+
+	data, err := os.ReadFile(logFile)
+	assert.Nil(t, err)
+	entry := map[string]any{}
+	err = json.Unmarshal(data, &entry)
+	assert.Nil(t, err)
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "Serving org/repo", entry["msg"])
+	assert.NotEmpty(t, entry["sid"])
+	assert.Equal(t, "th01:request", entry["thread"])
+}
+
+func TestAppLogger_InvalidConfig(t *testing.T) {
+	_, err := NewAppLogger(AppLogConfig{Level: "fatal"}, nil)
+	assert.NotNil(t, err)
+
+	_, err = NewAppLogger(AppLogConfig{Format: "xml"}, nil)
+	assert.NotNil(t, err)
+
+	_, err = NewAppLogger(AppLogConfig{Target: "eventlog"}, nil)
+	assert.NotNil(t, err)
+
+	_, err = NewAppLogger(AppLogConfig{Target: "syslog", SyslogAddress: "https://logs.example.com"}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestAppLogger_RequestId(t *testing.T) {
+	out := &bytes.Buffer{}
+	appLogger, err := NewAppLogger(AppLogConfig{Format: "json"}, out)
+	assert.Nil(t, err)
+
+	ctx := WithRequestId(context.Background(), "abc-123")
+	appLogger.Infof(ctx, "Started update")
+
+	entry := map[string]any{}
+	err = json.Unmarshal(out.Bytes(), &entry)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc-123", entry["request_id"])
+}
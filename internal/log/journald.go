@@ -0,0 +1,137 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// The socket on which journald receives entries in its native protocol.
+const journaldSocket string = "/run/systemd/journal/socket"
+
+// The syslog priorities (as used by journald) of each level.
+var journaldPriorities = map[zapcore.Level]int{
+	zapcore.DebugLevel: 7,
+	zapcore.InfoLevel:  6,
+	zapcore.WarnLevel:  4,
+	zapcore.ErrorLevel: 3,
+}
+
+// journaldCore is a zapcore.Core sending each entry to journald with its
+// native protocol, so that the fields of the entry (e.g. the trace2 session ID)
+// are recorded as journal fields (e.g. 'SID') that can be queried with
+// 'journalctl', rather than as text in the message.
+type journaldCore struct {
+	zapcore.LevelEnabler
+	conn       net.Conn
+	identifier string
+	fields     []zapcore.Field
+}
+
+// dialJournald connects to the local journald, identifying entries with
+// 'identifier' (their 'SYSLOG_IDENTIFIER').
+func dialJournald(level zapcore.LevelEnabler, identifier string) (*journaldCore, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to journald: %w", err)
+	}
+	return &journaldCore{
+		LevelEnabler: level,
+		conn:         conn,
+		identifier:   identifier,
+	}, nil
+}
+
+// journaldFieldName converts the name of a field (e.g. 'route_count') to a
+// valid journal field name (e.g. 'ROUTE_COUNT'): upper case letters, digits,
+// and underscores, not starting with an underscore.
+func journaldFieldName(name string) string {
+	fieldName := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	return strings.TrimLeft(fieldName, "_")
+}
+
+// appendJournaldField appends a field to an entry in journald's native
+// protocol. Values containing newlines are length-prefixed.
+func appendJournaldField(buf *bytes.Buffer, name string, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(buf, "%s=%s\n", name, value)
+		return
+	}
+
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// encodeJournaldEntry encodes the entry (with its fields) in journald's native
+// protocol.
+func (c *journaldCore) encodeJournaldEntry(entry zapcore.Entry, fields []zapcore.Field) []byte {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range append(c.fields[:len(c.fields):len(c.fields)], fields...) {
+		field.AddTo(encoder)
+	}
+
+	buf := &bytes.Buffer{}
+	appendJournaldField(buf, "MESSAGE", entry.Message)
+	appendJournaldField(buf, "PRIORITY", fmt.Sprint(journaldPriorities[entry.Level]))
+	appendJournaldField(buf, "SYSLOG_IDENTIFIER", c.identifier)
+
+	names := make([]string, 0, len(encoder.Fields))
+	for name := range encoder.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fieldName := journaldFieldName(name)
+		if fieldName == "" {
+			continue
+		}
+		appendJournaldField(buf, fieldName, fmt.Sprint(encoder.Fields[name]))
+	}
+	return buf.Bytes()
+}
+
+func (c *journaldCore) With(fields []zapcore.Field) zapcore.Core {
+	return &journaldCore{
+		LevelEnabler: c.LevelEnabler,
+		conn:         c.conn,
+		identifier:   c.identifier,
+		fields:       append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *journaldCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *journaldCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	_, err := c.conn.Write(c.encodeJournaldEntry(entry, fields))
+	return err
+}
+
+func (c *journaldCore) Sync() error {
+	return nil
+}
+
+func (c *journaldCore) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,45 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestJournaldFieldName(t *testing.T) {
+	assert.Equal(t, "SID", journaldFieldName("sid"))
+	assert.Equal(t, "ROUTE_COUNT", journaldFieldName("route.count"))
+	assert.Equal(t, "PRIVATE", journaldFieldName("_private"))
+	assert.Equal(t, "", journaldFieldName("__"))
+}
+
+func TestEncodeJournaldEntry(t *testing.T) {
+	core := &journaldCore{
+		LevelEnabler: zapcore.InfoLevel,
+		identifier:   "git-bundle-web-server",
+		fields:       []zapcore.Field{zap.String("thread", "main")},
+	}
+
+	entry := core.encodeJournaldEntry(
+		zapcore.Entry{Level: zapcore.WarnLevel, Message: "Slow update"},
+		[]zapcore.Field{zap.String("sid", "abc")},
+	)
+	assert.Equal(t,
+		"MESSAGE=Slow update\n"+
+			"PRIORITY=4\n"+
+			"SYSLOG_IDENTIFIER=git-bundle-web-server\n"+
+			"SID=abc\n"+
+			"THREAD=main\n",
+		string(entry))
+
+	// Multi-line values are length-prefixed
+	entry = core.encodeJournaldEntry(zapcore.Entry{Level: zapcore.ErrorLevel, Message: "a\nb"}, nil)
+	assert.Equal(t,
+		"MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n"+
+			"PRIORITY=3\n"+
+			"SYSLOG_IDENTIFIER=git-bundle-web-server\n"+
+			"THREAD=main\n",
+		string(entry))
+}
@@ -15,7 +15,29 @@ type loggedError error
 type TraceLogger interface {
 	Region(ctx context.Context, category string, label string) (context.Context, func())
 	ChildProcess(ctx context.Context, cmd *exec.Cmd) (func(error), func())
+
+	// Goroutine attributes the events logged with the returned context to a
+	// new trace2 thread named after 'name' (e.g. 'th01:update-worker') rather
+	// than to the main thread, until the returned function is called. Call it
+	// at the start of each goroutine (or request handler) that logs events.
+	Goroutine(ctx context.Context, name string) (context.Context, func())
 	LogCommand(ctx context.Context, commandName string) context.Context
+
+	// Data logs the value (e.g. the size of a bundle) of 'key' as a 'data'
+	// event. DataJSON logs a value that is encoded as JSON (e.g. a struct) as
+	// a 'data_json' event instead.
+	Data(ctx context.Context, category string, key string, value any)
+	DataJSON(ctx context.Context, category string, key string, value any)
+
+	// StartTimer starts an interval of the timer 'name' (e.g. timing a fetch),
+	// returning the function that ends it. The intervals of each timer are
+	// summarized in a 'timer' event when the process exits.
+	StartTimer(ctx context.Context, category string, name string) func()
+
+	// AddToCounter adds 'value' to the counter 'name', which is reported in a
+	// 'counter' event when the process exits.
+	AddToCounter(ctx context.Context, category string, name string, value int64)
+
 	Error(ctx context.Context, err error) error
 	Errorf(ctx context.Context, format string, a ...any) error
 	Exit(ctx context.Context, exitCode int)
@@ -0,0 +1,257 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/buildinfo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OpenTelemetry environment variables (see the OpenTelemetry specification).
+// Besides the ones below, the OTLP exporters read the rest of their
+// configuration (e.g. OTEL_EXPORTER_OTLP_HEADERS) from the environment
+// themselves.
+const (
+	otelSdkDisabled     string = "OTEL_SDK_DISABLED"
+	otelEndpoint        string = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otelTracesEndpoint  string = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	otelMetricsEndpoint string = "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"
+	otelLogLevel        string = "OTEL_LOG_LEVEL"
+
+	// The W3C trace context of the span that started the process (e.g. the
+	// web server running an update), which the process' spans descend from.
+	otelTraceParent string = "TRACEPARENT"
+)
+
+const (
+	otelScopeName string = "github.com/git-ecosystem/git-bundle-server"
+
+	otelShutdownTimeout time.Duration = 10 * time.Second
+)
+
+// The bucket boundaries (in seconds) of the histograms of trace2 timers,
+// which time anything from serving a request to cloning a repository.
+var otelDurationBuckets = []float64{
+	0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600,
+}
+
+// otelAttribute returns the attribute 'key' with the given value, which is
+// converted to a string if it isn't a number or boolean.
+func otelAttribute(key string, value any) attribute.KeyValue {
+	switch v := value.(type) {
+	case int:
+		return attribute.Int(key, v)
+	case int32:
+		return attribute.Int64(key, int64(v))
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
+
+// setSpanError marks the span as failed. Only the first error is kept, since
+// errors are logged again (wrapped) as they are returned up the stack.
+func setSpanError(span trace.Span, message string) {
+	if s, ok := span.(sdktrace.ReadOnlySpan); ok && s.Status().Code == codes.Error {
+		return
+	}
+	span.SetStatus(codes.Error, message)
+}
+
+// traceParent returns the W3C 'traceparent' identifying the span as the
+// parent of spans in other processes.
+func traceParent(span trace.Span) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(trace.ContextWithSpan(context.Background(), span), carrier)
+	return carrier.Get("traceparent")
+}
+
+// childSpanName names the span of a child process after its executable and
+// subcommand (e.g. 'git fetch'), skipping Git's global options (e.g. '-C
+// <path>'), so that spans of the same command share a name.
+func childSpanName(argv []string) string {
+	if len(argv) == 0 {
+		return "exec"
+	}
+
+	name := strings.TrimSuffix(filepath.Base(argv[0]), ".exe")
+	for i := 1; i < len(argv); i++ {
+		switch {
+		case argv[i] == "-C" || argv[i] == "-c":
+			i++
+		case strings.HasPrefix(argv[i], "-"):
+			continue
+		default:
+			return name + " " + argv[i]
+		}
+	}
+	return name
+}
+
+// warnOTel prints a warning about a failed export if OpenTelemetry's debug
+// logging is enabled; otherwise, telemetry is dropped silently so that an
+// unavailable collector doesn't affect the commands being traced.
+func warnOTel(err error) {
+	if strings.EqualFold(os.Getenv(otelLogLevel), "debug") {
+		fmt.Fprintf(os.Stderr, "warning: otel: %s\n", err)
+	}
+}
+
+// otelExporter exports spans and metrics to an OpenTelemetry collector with
+// the OTLP/HTTP protocol, using the OpenTelemetry SDK.
+type otelExporter struct {
+	// The providers of the exported signals (nil if the signal's endpoint
+	// isn't configured).
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+
+	tracer trace.Tracer
+	meter  metric.Meter
+}
+
+// otelSignalConfigured returns whether the signal is exported, i.e. whether
+// either its own endpoint or the general endpoint is configured.
+func otelSignalConfigured(signalEnvKey string) bool {
+	return os.Getenv(signalEnvKey) != "" || os.Getenv(otelEndpoint) != ""
+}
+
+// newOTelExporterFromEnv returns the exporter configured by the OpenTelemetry
+// environment variables, or nil if no endpoint is configured. Spans and
+// metrics are exported in the background (spans in batches, metrics every
+// minute) until the exporter is shut down.
+func newOTelExporterFromEnv() *otelExporter {
+	if disabled, _ := strconv.ParseBool(os.Getenv(otelSdkDisabled)); disabled {
+		return nil
+	}
+
+	exportTraces := otelSignalConfigured(otelTracesEndpoint)
+	exportMetrics := otelSignalConfigured(otelMetricsEndpoint)
+	if !exportTraces && !exportMetrics {
+		return nil
+	}
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(warnOTel))
+
+	// The service name defaults to the executable's name, unless set by
+	// OTEL_SERVICE_NAME (or OTEL_RESOURCE_ATTRIBUTES).
+	ctx := context.Background()
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")),
+			attribute.String("service.version", buildinfo.VersionString()),
+			attribute.Int("process.pid", os.Getpid()),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		warnOTel(err)
+	}
+
+	e := &otelExporter{}
+	if exportTraces {
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			warnOTel(err)
+			return nil
+		}
+		e.tracerProvider = sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(res),
+		)
+		e.tracer = e.tracerProvider.Tracer(otelScopeName, trace.WithInstrumentationVersion(buildinfo.VersionString()))
+	}
+	if exportMetrics {
+		exporter, err := otlpmetrichttp.New(ctx)
+		if err != nil {
+			warnOTel(err)
+			return nil
+		}
+		e.meterProvider = sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+			sdkmetric.WithResource(res),
+		)
+		e.meter = e.meterProvider.Meter(otelScopeName, metric.WithInstrumentationVersion(buildinfo.VersionString()))
+	}
+
+	return e
+}
+
+// startSpan starts a span, the child of the span in the context (if any), or
+// returns a nil span if spans aren't exported.
+func (e *otelExporter) startSpan(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	if e.tracer == nil {
+		return ctx, nil
+	}
+	return e.tracer.Start(ctx, name, trace.WithSpanKind(kind))
+}
+
+// addToCounter adds to the cumulative sum 'name' (e.g. a trace2 counter).
+func (e *otelExporter) addToCounter(ctx context.Context, name string, value int64) {
+	if e.meter == nil {
+		return
+	}
+
+	counter, err := e.meter.Int64Counter(name, metric.WithUnit("1"))
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	counter.Add(ctx, value)
+}
+
+// recordDuration adds an interval to the histogram 'name' (e.g. of a trace2
+// timer), in seconds.
+func (e *otelExporter) recordDuration(ctx context.Context, name string, interval time.Duration) {
+	if e.meter == nil {
+		return
+	}
+
+	histogram, err := e.meter.Float64Histogram(name,
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(otelDurationBuckets...),
+	)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	histogram.Record(ctx, interval.Seconds())
+}
+
+// shutdown exports the remaining spans and the final value of the metrics,
+// then stops the background exports.
+func (e *otelExporter) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), otelShutdownTimeout)
+	defer cancel()
+
+	if e.tracerProvider != nil {
+		if err := e.tracerProvider.Shutdown(ctx); err != nil {
+			otel.Handle(err)
+		}
+	}
+	if e.meterProvider != nil {
+		if err := e.meterProvider.Shutdown(ctx); err != nil {
+			otel.Handle(err)
+		}
+	}
+}
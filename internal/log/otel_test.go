@@ -0,0 +1,138 @@
+package log
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+var childSpanNameTests = []struct {
+	argv     []string
+	expected string
+}{
+	{[]string{"git", "-C", "/repo", "fetch", "origin"}, "git fetch"},
+	{[]string{"git", "-c", "core.quotePath=false", "--no-pager", "bundle", "create"}, "git bundle"},
+	{[]string{"/usr/bin/git-bundle-server", "update", "org/repo"}, "git-bundle-server update"},
+	{[]string{"git"}, "git"},
+	{[]string{}, "exec"},
+}
+
+func TestChildSpanName(t *testing.T) {
+	for _, tt := range childSpanNameTests {
+		assert.Equal(t, tt.expected, childSpanName(tt.argv))
+	}
+}
+
+// otlpCollector records the messages exported to it, by path.
+type otlpCollector struct {
+	lock     sync.Mutex
+	messages map[string][][]byte
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.messages[r.URL.Path] = append(c.messages[r.URL.Path], body)
+}
+
+func TestTrace2_OpenTelemetry(t *testing.T) {
+	collector := &otlpCollector{messages: map[string][][]byte{}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	t.Setenv(otelEndpoint, server.URL)
+	t.Setenv(otelTraceParent, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	tr2 := &Trace2{logger: zap.NewNop(), lastChildId: -1}
+
+	ctx := tr2.LogCommand(context.Background(), "update")
+	regionCtx, leaveRegion := tr2.Region(ctx, "update", "fetch")
+	tr2.Data(regionCtx, "update", "route", "org/repo")
+
+	cmd := exec.Command("git", "version")
+	childReady, childExit := tr2.ChildProcess(regionCtx, cmd)
+	childReady(cmd.Run())
+	childExit()
+
+	tr2.Errorf(regionCtx, "failed to fetch: %w", errors.New("timeout"))
+	leaveRegion()
+	tr2.AddToCounter(ctx, "bundles", "created", 2)
+	tr2.logExit(ctx, 1)
+
+	// Spans
+	assert.Len(t, collector.messages["/v1/traces"], 1)
+	traces := &coltracepb.ExportTraceServiceRequest{}
+	err := proto.Unmarshal(collector.messages["/v1/traces"][0], traces)
+	assert.Nil(t, err)
+	spans := map[string]*tracepb.Span{}
+	for _, span := range traces.ResourceSpans[0].ScopeSpans[0].Spans {
+		spans[span.Name] = span
+	}
+	assert.Len(t, spans, 3)
+
+	root := spans["log.test update"]
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", hex.EncodeToString(root.TraceId))
+	assert.Equal(t, "b7ad6b7169203331", hex.EncodeToString(root.ParentSpanId))
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, root.Status.Code)
+
+	region := spans["update/fetch"]
+	assert.Equal(t, root.TraceId, region.TraceId)
+	assert.Equal(t, root.SpanId, region.ParentSpanId)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, region.Status.Code)
+	assert.Equal(t, "failed to fetch: timeout", region.Status.Message)
+	assert.Contains(t, spanAttributes(region), "update.route=org/repo")
+
+	child := spans["git version"]
+	assert.Equal(t, region.SpanId, child.ParentSpanId)
+	assert.Contains(t, spanAttributes(child), "process.exit_code=0")
+	assert.Equal(t,
+		fmt.Sprintf("%s=00-%x-%x-01", otelTraceParent, child.TraceId, child.SpanId),
+		cmd.Env[len(cmd.Env)-1])
+
+	// Metrics
+	assert.Len(t, collector.messages["/v1/metrics"], 1)
+	metrics := &colmetricpb.ExportMetricsServiceRequest{}
+	err = proto.Unmarshal(collector.messages["/v1/metrics"][0], metrics)
+	assert.Nil(t, err)
+	counter := metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+	assert.Equal(t, "bundles.created", counter.Name)
+	assert.True(t, counter.GetSum().IsMonotonic)
+	assert.Equal(t, int64(2), counter.GetSum().DataPoints[0].GetAsInt())
+}
+
+// spanAttributes returns the attributes of the span as 'key=value' strings.
+func spanAttributes(span *tracepb.Span) []string {
+	attributes := []string{}
+	for _, attr := range span.Attributes {
+		value := attr.Value.GetStringValue()
+		if _, ok := attr.Value.Value.(*commonpb.AnyValue_IntValue); ok {
+			value = fmt.Sprint(attr.Value.GetIntValue())
+		}
+		attributes = append(attributes, attr.Key+"="+value)
+	}
+	return attributes
+}
+
+func TestTrace2_OpenTelemetryDisabled(t *testing.T) {
+	t.Setenv(otelEndpoint, "")
+	tr2 := &Trace2{logger: zap.NewNop(), lastChildId: -1}
+
+	ctx := tr2.LogCommand(context.Background(), "update")
+	assert.Nil(t, currentSpan(ctx))
+	assert.Nil(t, tr2.exporter())
+}
@@ -0,0 +1,55 @@
+package log
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// The environment variable through which the ID of the HTTP request on behalf
+// of which a process was started (e.g. an update triggered by a webhook) is
+// passed to the process.
+const requestIdEnvVar string = "GIT_BUNDLE_SERVER_REQUEST_ID"
+
+// The maximum length of a request ID given by a client, to keep it from
+// bloating the logs.
+const maxRequestIdLength int = 128
+
+// NewRequestId returns the ID of an HTTP request: the ID given by the client
+// (e.g. in the 'X-Request-Id' header), if it is valid, otherwise a new random
+// ID.
+func NewRequestId(clientId string) string {
+	if isValidRequestId(clientId) {
+		return clientId
+	}
+	return uuid.New().String()
+}
+
+// isValidRequestId checks that a request ID is non-empty, not too long, and
+// consists only of printable ASCII characters (so that it can be safely
+// logged and echoed in a header).
+func isValidRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// WithRequestId returns a context in which the application log messages,
+// trace2 events, and child processes (e.g. updates) are attributed to the
+// HTTP request with the given ID.
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdId, requestId)
+}
+
+// RequestId returns the ID of the HTTP request to which the context is
+// attributed, or an empty string if there is none.
+func RequestId(ctx context.Context) string {
+	_, requestId := getContextValue[string](ctx, requestIdId)
+	return requestId
+}
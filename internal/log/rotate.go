@@ -0,0 +1,162 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The format of the timestamp in the names of rotated log files, which sorts
+// chronologically and is valid on every platform.
+const rotatedTimeFormat string = "2006-01-02T15-04-05.000"
+
+// rotatingFile appends to a log file, rotating it once it reaches its maximum
+// size: the file is renamed to a backup named after the time of the rotation
+// (e.g. 'server-2024-01-02T15-04-05.000.log' for 'server.log') and a new file
+// is started. Backups older than the maximum age or beyond the maximum number
+// of backups are removed after each rotation.
+//
+// Several processes (e.g. the web server and the updates it runs) may append
+// to the same file, so the file is reopened whenever it has been moved, either
+// by another process' rotation or by an external tool (e.g. logrotate).
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	lock     sync.Mutex
+	file     *os.File
+	fileInfo os.FileInfo
+}
+
+// newRotatingFile opens the log file at 'path' for appending. A zero maximum
+// size, age, or number of backups means no limit.
+func newRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.fileInfo = fileInfo
+	return nil
+}
+
+// currentSize returns the size of the log file, reopening it first if it was
+// moved.
+func (r *rotatingFile) currentSize() (int64, error) {
+	info, err := os.Stat(r.path)
+	if err == nil && os.SameFile(info, r.fileInfo) {
+		return info.Size(), nil
+	}
+
+	r.file.Close()
+	err = r.open()
+	if err != nil {
+		return 0, err
+	}
+	return r.fileInfo.Size(), nil
+}
+
+func (r *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(r.path)
+	return strings.TrimSuffix(r.path, ext) + "-" + t.UTC().Format(rotatedTimeFormat) + ext
+}
+
+// backups returns the paths of the rotated log files with the time of their
+// rotation, oldest first.
+func (r *rotatingFile) backups() ([]string, []time.Time) {
+	ext := filepath.Ext(r.path)
+	prefix := strings.TrimSuffix(r.path, ext) + "-"
+	matches, _ := filepath.Glob(strings.TrimSuffix(r.path, ext) + "-*" + ext)
+	sort.Strings(matches)
+
+	paths := []string{}
+	times := []time.Time{}
+	for _, match := range matches {
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ext)
+		t, err := time.Parse(rotatedTimeFormat, timestamp)
+		if err != nil {
+			// Not a backup of this file
+			continue
+		}
+		paths = append(paths, match)
+		times = append(times, t)
+	}
+	return paths, times
+}
+
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+
+	// Another process may rotate the file at the same time; if it got there
+	// first, just open the new file.
+	now := time.Now()
+	err := os.Rename(r.path, r.backupName(now))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = r.open()
+	if err != nil {
+		return err
+	}
+
+	// Remove backups that are too old, then the oldest of those remaining
+	// beyond the maximum number.
+	paths, times := r.backups()
+	for i, path := range paths {
+		tooOld := r.maxAge > 0 && now.Sub(times[i]) > r.maxAge
+		tooMany := r.maxBackups > 0 && len(paths)-i > r.maxBackups
+		if tooOld || tooMany {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	size, err := r.currentSize()
+	if err != nil {
+		return 0, err
+	}
+	if r.maxSize > 0 && size > 0 && size+int64(len(p)) > r.maxSize {
+		err = r.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return r.file.Write(p)
+}
+
+func (r *rotatingFile) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,82 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile_MaxSize(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "server.log")
+	file, err := newRotatingFile(logFile, 10, 0, 2)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	// Each write after the first exceeds the maximum size, so it starts a new
+	// file; only the two most recent backups are kept.
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = file.Write([]byte(line))
+		assert.Nil(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	data, err := os.ReadFile(logFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "fourth\n", string(data))
+
+	backups, _ := file.backups()
+	assert.Len(t, backups, 2)
+	data, err = os.ReadFile(backups[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "second\n", string(data))
+}
+
+func TestRotatingFile_MaxAge(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "server.log")
+	file, err := newRotatingFile(logFile, 1, 24*time.Hour, 0)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	oldBackup := file.backupName(time.Now().Add(-48 * time.Hour))
+	recentBackup := file.backupName(time.Now().Add(-time.Hour))
+	unrelated := filepath.Join(dir, "server-notes.log")
+	for _, path := range []string{oldBackup, recentBackup, unrelated} {
+		assert.Nil(t, os.WriteFile(path, []byte("old\n"), 0o644))
+	}
+
+	_, err = file.Write([]byte("first\n"))
+	assert.Nil(t, err)
+	_, err = file.Write([]byte("second\n"))
+	assert.Nil(t, err)
+
+	assert.NoFileExists(t, oldBackup)
+	assert.FileExists(t, recentBackup)
+	assert.FileExists(t, unrelated)
+	backups, _ := file.backups()
+	assert.Len(t, backups, 2)
+}
+
+func TestRotatingFile_ReopensMovedFile(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "server.log")
+	file, err := newRotatingFile(logFile, 0, 0, 0)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	_, err = file.Write([]byte("before\n"))
+	assert.Nil(t, err)
+
+	// Rotated by another process (or e.g. logrotate)
+	assert.Nil(t, os.Rename(logFile, filepath.Join(dir, "server.log.1")))
+
+	_, err = file.Write([]byte("after\n"))
+	assert.Nil(t, err)
+
+	data, err := os.ReadFile(logFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "after\n", string(data))
+}
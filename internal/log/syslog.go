@@ -0,0 +1,108 @@
+package log
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// syslogWriter sends messages to a syslog daemon with the severity of the
+// method called (see 'log/syslog.Writer').
+type syslogWriter interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+	Close() error
+}
+
+// parseSyslogAddress parses the address of a syslog daemon, given as a URL
+// (e.g. 'udp://logs.example.com:514', 'tcp://logs.example.com:601', or
+// 'unix:///dev/log'), into the network and address to connect to. An empty
+// address is the local syslog daemon, for which the network and address are
+// empty.
+func parseSyslogAddress(address string) (string, string, error) {
+	if address == "" {
+		return "", "", nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog address '%s': %w", address, err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "udp", "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("invalid syslog address '%s': missing host", address)
+		}
+		if u.Port() == "" {
+			return strings.ToLower(u.Scheme), u.Host + ":514", nil
+		}
+		return strings.ToLower(u.Scheme), u.Host, nil
+	case "unix", "unixgram":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("invalid syslog address '%s': missing socket path", address)
+		}
+		return strings.ToLower(u.Scheme), u.Path, nil
+	default:
+		return "", "", fmt.Errorf("invalid syslog address '%s': scheme must be 'udp', 'tcp', or 'unix'", address)
+	}
+}
+
+// syslogCore is a zapcore.Core sending each entry to a syslog daemon. The
+// daemon records the time, severity, and program of each message, so only
+// the message and its fields are encoded.
+type syslogCore struct {
+	zapcore.LevelEnabler
+	encoder zapcore.Encoder
+	writer  syslogWriter
+}
+
+func newSyslogCore(level zapcore.LevelEnabler, encoder zapcore.Encoder, writer syslogWriter) *syslogCore {
+	return &syslogCore{
+		LevelEnabler: level,
+		encoder:      encoder,
+		writer:       writer,
+	}
+}
+
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	encoder := c.encoder.Clone()
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+	return newSyslogCore(c.LevelEnabler, encoder, c.writer)
+}
+
+func (c *syslogCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *syslogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+	message := strings.TrimSuffix(buf.String(), "\n")
+	buf.Free()
+
+	switch {
+	case entry.Level >= zapcore.ErrorLevel:
+		return c.writer.Err(message)
+	case entry.Level == zapcore.WarnLevel:
+		return c.writer.Warning(message)
+	case entry.Level == zapcore.InfoLevel:
+		return c.writer.Info(message)
+	default:
+		return c.writer.Debug(message)
+	}
+}
+
+func (c *syslogCore) Sync() error {
+	return nil
+}
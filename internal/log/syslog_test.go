@@ -0,0 +1,74 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var parseSyslogAddressTests = []struct {
+	title string
+
+	address string
+
+	expectedNetwork string
+	expectedAddress string
+	expectErr       bool
+}{
+	{"Empty address is the local daemon", "", "", "", false},
+	{"UDP with port", "udp://logs.example.com:1514", "udp", "logs.example.com:1514", false},
+	{"TCP with default port", "tcp://logs.example.com", "tcp", "logs.example.com:514", false},
+	{"Unix socket", "unix:///dev/log", "unix", "/dev/log", false},
+	{"Missing host", "udp://", "", "", true},
+	{"Missing socket path", "unixgram://", "", "", true},
+	{"Unknown scheme", "https://logs.example.com", "", "", true},
+}
+
+func TestParseSyslogAddress(t *testing.T) {
+	for _, tt := range parseSyslogAddressTests {
+		t.Run(tt.title, func(t *testing.T) {
+			network, address, err := parseSyslogAddress(tt.address)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedNetwork, network)
+			assert.Equal(t, tt.expectedAddress, address)
+		})
+	}
+}
+
+type fakeSyslogWriter struct {
+	messages []string
+}
+
+func (w *fakeSyslogWriter) record(severity string, m string) error {
+	w.messages = append(w.messages, severity+": "+m)
+	return nil
+}
+
+func (w *fakeSyslogWriter) Debug(m string) error   { return w.record("debug", m) }
+func (w *fakeSyslogWriter) Info(m string) error    { return w.record("info", m) }
+func (w *fakeSyslogWriter) Warning(m string) error { return w.record("warning", m) }
+func (w *fakeSyslogWriter) Err(m string) error     { return w.record("err", m) }
+func (w *fakeSyslogWriter) Close() error           { return nil }
+
+func TestSyslogCore(t *testing.T) {
+	encoder := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"})
+	writer := &fakeSyslogWriter{}
+	logger := zap.New(newSyslogCore(zapcore.InfoLevel, encoder, writer)).With(zap.String("sid", "abc"))
+
+	logger.Debug("ignored")
+	logger.Info("started", zap.Int("routes", 2))
+	logger.Warn("slow")
+	logger.Error("failed")
+
+	assert.Equal(t, []string{
+		`info: {"msg":"started","sid":"abc","routes":2}`,
+		`warning: {"msg":"slow","sid":"abc"}`,
+		`err: {"msg":"failed","sid":"abc"}`,
+	}, writer.messages)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package log
+
+import (
+	"log/syslog"
+)
+
+// dialSyslog connects to the syslog daemon at the given address (see
+// parseSyslogAddress), tagging messages with 'tag'.
+func dialSyslog(address string, tag string) (syslogWriter, error) {
+	network, raddr, err := parseSyslogAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+}
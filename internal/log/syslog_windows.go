@@ -0,0 +1,11 @@
+//go:build windows
+
+package log
+
+import (
+	"fmt"
+)
+
+func dialSyslog(address string, tag string) (syslogWriter, error) {
+	return nil, fmt.Errorf("syslog is not supported on Windows")
+}
@@ -2,28 +2,42 @@ package log
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/git-ecosystem/git-bundle-server/internal/buildinfo"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 // Trace2 environment variables
 const (
-	// TODO: handle GIT_TRACE2 by adding a separate output config (see zapcore
-	// "AdvancedConfiguration" example:
-	// https://pkg.go.dev/go.uber.org/zap#example-package-AdvancedConfiguration)
-	trace2Event string = "GIT_TRACE2_EVENT"
+	trace2Normal string = "GIT_TRACE2"
+	trace2Brief  string = "GIT_TRACE2_BRIEF"
+	trace2Event  string = "GIT_TRACE2_EVENT"
+
+	trace2DstDebug string = "GIT_TRACE2_DST_DEBUG"
+
+	// The session ID of the parent process, inherited by (and exported to)
+	// child processes so that their traces can be correlated.
+	trace2ParentSid string = "GIT_TRACE2_PARENT_SID"
 )
 
 // Global start time
@@ -31,11 +45,16 @@ var globalStart = time.Now().UTC()
 
 const trace2TimeFormat string = "2006-01-02T15:04:05.000000Z"
 
+// The version of the trace2 event format, as logged by Git.
+const trace2EventFormatVersion string = "3"
+
 type ctxKey int
 
 const (
 	sidId ctxKey = iota
 	parentRegionId
+	threadNameId
+	requestIdId
 )
 
 type trace2Region struct {
@@ -43,67 +62,209 @@ type trace2Region struct {
 	tStart time.Time
 }
 
+// The accumulated intervals of a trace2 timer.
+type trace2Timer struct {
+	intervals int
+	total     time.Duration
+	min       time.Duration
+	max       time.Duration
+}
+
+// The name of a timer or counter.
+type trace2StatName struct {
+	category string
+	name     string
+}
+
 type Trace2 struct {
-	logger      *zap.Logger
-	lastChildId int32
+	logger       *zap.Logger
+	lastChildId  int32
+	lastThreadId int32
+
+	// The timers and counters of the process, reported when it exits.
+	statsLock sync.Mutex
+	timers    map[trace2StatName]*trace2Timer
+	counters  map[trace2StatName]int64
+
+	// The OpenTelemetry exporter (nil if not configured), created the first
+	// time it is used, and the span of the process' command.
+	otelOnce sync.Once
+	otel     *otelExporter
+	rootSpan trace.Span
 }
 
-func getTrace2OutputPaths(envKey string) []string {
-	tr2Output := os.Getenv(envKey)
+// warnTrace2 prints a warning about the trace2 output configuration if Git
+// would (i.e., if GIT_TRACE2_DST_DEBUG is set to a positive number).
+func warnTrace2(format string, a ...any) {
+	if debug, _ := strconv.Atoi(os.Getenv(trace2DstDebug)); debug > 0 {
+		fmt.Fprintf(os.Stderr, "warning: trace2: "+format+"\n", a...)
+	}
+}
+
+// trace2Output writes trace2 events to the target of a trace2 environment
+// variable. Like Git, it stops writing to the target once a write fails (e.g.
+// because the collector reading from a socket went away), rather than failing
+// every write after it.
+type trace2Output struct {
+	lock     sync.Mutex
+	envKey   string
+	target   string
+	out      io.Writer
+	disabled bool
+}
+
+func newTrace2Output(envKey string, target string, out io.Writer) zapcore.WriteSyncer {
+	return &trace2Output{envKey: envKey, target: target, out: out}
+}
 
-	// Configure the output
-	if tr2, err := strconv.Atoi(tr2Output); err == nil {
-		// Handle numeric values
-		if tr2 == 1 {
-			return []string{"stderr"}
+func (o *trace2Output) Write(p []byte) (int, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if !o.disabled {
+		_, err := o.out.Write(p)
+		if err != nil {
+			o.disabled = true
+			warnTrace2("could not write to '%s' for '%s' tracing: %s", o.target, o.envKey, err)
 		}
-		// TODO: handle file handles 2-9 and unix sockets
-	} else if tr2Output != "" {
-		// Assume we received a path
-		fileInfo, err := os.Stat(tr2Output)
-		if err == nil && fileInfo.IsDir() {
-			// If the path is an existing directory, generate a filename
-			return []string{
-				filepath.Join(tr2Output, fmt.Sprintf("trace2_%s.txt", globalStart.Format(trace2TimeFormat))),
-			}
-		} else {
-			// Create leading directories
-			parentDir := path.Dir(tr2Output)
-			os.MkdirAll(parentDir, 0o755)
-			return []string{tr2Output}
+	}
+	return len(p), nil
+}
+
+func (o *trace2Output) Sync() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	// Flushing the output is best-effort (e.g. stderr can't be synced).
+	if file, ok := o.out.(*os.File); ok && !o.disabled {
+		file.Sync()
+	}
+	return nil
+}
+
+// openTrace2Socket connects to the Unix domain socket target of a trace2
+// environment variable ('af_unix:[stream:|dgram:]<path>'). Without a socket
+// type, a stream socket is tried before a datagram socket.
+func openTrace2Socket(envKey string, target string) zapcore.WriteSyncer {
+	socketPath := strings.TrimPrefix(target, "af_unix:")
+	networks := []string{"unix", "unixgram"}
+	if strings.HasPrefix(socketPath, "stream:") {
+		socketPath = strings.TrimPrefix(socketPath, "stream:")
+		networks = []string{"unix"}
+	} else if strings.HasPrefix(socketPath, "dgram:") {
+		socketPath = strings.TrimPrefix(socketPath, "dgram:")
+		networks = []string{"unixgram"}
+	}
+
+	if !filepath.IsAbs(socketPath) {
+		warnTrace2("socket path must be absolute for '%s' tracing: '%s'", envKey, socketPath)
+		return nil
+	}
+
+	var err error
+	for _, network := range networks {
+		var conn net.Conn
+		conn, err = net.Dial(network, socketPath)
+		if err == nil {
+			return newTrace2Output(envKey, socketPath, conn)
 		}
 	}
+	warnTrace2("could not connect to socket '%s' for '%s' tracing: %s", socketPath, envKey, err)
+	return nil
+}
+
+// getTrace2WriteSyncer returns the output configured by the trace2
+// environment variable 'envKey', which is interpreted like Git does: '1' (or
+// 'true') for stderr, a file descriptor from 2 to 9, a Unix domain socket
+// ('af_unix:[stream:|dgram:]<path>'), or the path to a file (or to a
+// directory, in which a new file is created). If the variable is unset,
+// disabled ('0' or 'false'), or the output cannot be opened, it returns nil.
+func getTrace2WriteSyncer(envKey string) zapcore.WriteSyncer {
+	tr2Output := os.Getenv(envKey)
+
+	switch {
+	case tr2Output == "" || tr2Output == "0" || strings.EqualFold(tr2Output, "false"):
+		return nil
+	case tr2Output == "1" || tr2Output == "2" || strings.EqualFold(tr2Output, "true"):
+		return newTrace2Output(envKey, "stderr", os.Stderr)
+	case len(tr2Output) == 1 && tr2Output[0] >= '3' && tr2Output[0] <= '9':
+		fd := uintptr(tr2Output[0] - '0')
+		name := fmt.Sprintf("fd %d", fd)
+		return newTrace2Output(envKey, name, os.NewFile(fd, name))
+	case strings.HasPrefix(tr2Output, "af_unix:"):
+		return openTrace2Socket(envKey, tr2Output)
+	}
+
+	if _, err := strconv.Atoi(tr2Output); err == nil {
+		warnTrace2("unknown value for '%s': '%s'", envKey, tr2Output)
+		return nil
+	}
 
-	return []string{}
+	// Assume we received a path
+	filename := tr2Output
+	fileInfo, err := os.Stat(tr2Output)
+	if err == nil && fileInfo.IsDir() {
+		// If the path is an existing directory, generate a filename
+		filename = filepath.Join(tr2Output, fmt.Sprintf("trace2_%s.txt", globalStart.Format(trace2TimeFormat)))
+	} else {
+		// Create leading directories
+		parentDir := path.Dir(tr2Output)
+		os.MkdirAll(parentDir, 0o755)
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o666)
+	if err != nil {
+		warnTrace2("could not open '%s' for '%s' tracing: %s", filename, envKey, err)
+		return nil
+	}
+	return newTrace2Output(envKey, filename, file)
 }
 
-func createTrace2ZapLogger() *zap.Logger {
-	loggerConfig := zap.NewProductionConfig()
+// newTrace2Core returns a core writing every trace2 event with the given
+// encoder to the output configured by the environment variable 'envKey' (see
+// getTrace2WriteSyncer), or a no-op core if there is no output.
+func newTrace2Core(envKey string, encoder zapcore.Encoder) zapcore.Core {
+	output := getTrace2WriteSyncer(envKey)
+	if output == nil {
+		return zapcore.NewNopCore()
+	}
+	return zapcore.NewCore(encoder, output, zap.DebugLevel)
+}
 
-	// Configure the output for GIT_TRACE2_EVENT
-	loggerConfig.OutputPaths = getTrace2OutputPaths(trace2Event)
-	loggerConfig.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
+func newTrace2EventEncoder() zapcore.Encoder {
+	encoderConfig := zap.NewProductionEncoderConfig()
 
 	// Encode UTC time
-	loggerConfig.EncoderConfig.TimeKey = "time"
-	loggerConfig.EncoderConfig.EncodeTime = zapcore.TimeEncoder(
+	encoderConfig.TimeKey = "time"
+	encoderConfig.EncodeTime = zapcore.TimeEncoder(
 		func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 			enc.AppendString(t.UTC().Format(trace2TimeFormat))
 		},
 	)
 
 	// Ensure durations are logged in units of seconds
-	loggerConfig.EncoderConfig.EncodeDuration = zapcore.SecondsDurationEncoder
+	encoderConfig.EncodeDuration = zapcore.SecondsDurationEncoder
 
 	// Re-purpose the "message" to represent the (always-present) "event" key
-	loggerConfig.EncoderConfig.MessageKey = "event"
+	encoderConfig.MessageKey = "event"
+
+	// Don't print the log level or the caller; we'll customize the caller
+	// fields manually
+	encoderConfig.LevelKey = ""
+	encoderConfig.CallerKey = ""
 
-	// Don't print the log level
-	loggerConfig.EncoderConfig.LevelKey = ""
+	return zapcore.NewJSONEncoder(encoderConfig)
+}
 
-	// Disable caller info, we'll customize those fields manually
-	logger, _ := loggerConfig.Build(zap.WithCaller(false))
-	return logger
+func createTrace2ZapLogger() *zap.Logger {
+	brief, _ := strconv.ParseBool(os.Getenv(trace2Brief))
+
+	// Every event is written to both GIT_TRACE2_EVENT (as JSON) and GIT_TRACE2
+	// (as text), if configured.
+	return zap.New(zapcore.NewTee(
+		newTrace2Core(trace2Event, newTrace2EventEncoder()),
+		newTrace2Core(trace2Normal, newTrace2NormalEncoder(brief)),
+	))
 }
 
 func NewTrace2() traceLoggerInternal {
@@ -159,16 +320,73 @@ func getOrSetContextValue[T any](
 	return ctx, value
 }
 
+// newSid returns a new session ID. Like Git, if the process was started by
+// another process with a session ID (e.g. the web server running an update),
+// the new ID is the parent's ID followed by a component of its own, e.g.
+// '<parent-sid>/<uuid>'.
+func newSid() string {
+	sid := uuid.New().String()
+	if parentSid := strings.TrimSpace(os.Getenv(trace2ParentSid)); parentSid != "" {
+		sid = parentSid + "/" + sid
+	}
+	return sid
+}
+
+// exporter returns the OpenTelemetry exporter configured by the environment,
+// or nil if spans and metrics aren't exported.
+func (t *Trace2) exporter() *otelExporter {
+	t.otelOnce.Do(func() {
+		t.otel = newOTelExporterFromEnv()
+	})
+	return t.otel
+}
+
+// startSpan starts an OpenTelemetry span, the child of the span in the
+// context (if any). If spans aren't exported, the span is nil.
+func (t *Trace2) startSpan(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	if t.exporter() == nil {
+		return ctx, nil
+	}
+	return t.otel.startSpan(ctx, name, kind)
+}
+
+func (t *Trace2) endSpan(span trace.Span) {
+	if span != nil {
+		span.End()
+	}
+}
+
+// currentSpan returns the span in the context, if it is one of ours (rather
+// than the remote parent of the process' spans).
+func currentSpan(ctx context.Context) trace.Span {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return nil
+	}
+	return span
+}
+
+// WithTraceParent returns a context in which the spans started (if any) are
+// children of the remote span identified by the W3C 'traceparent' (e.g. of
+// the HTTP request being handled). An invalid 'traceparent' is ignored.
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
+
 func (t *Trace2) sharedFields(ctx context.Context) (context.Context, fieldList) {
 	fields := fieldList{}
 
 	// Get the session ID
-	ctx, sid := getOrSetContextValue(ctx, sidId, uuid.New)
-	fields = append(fields, zap.String("sid", sid.String()))
-
-	// Hardcode the thread to "main" because Go doesn't like to share its
-	// internal info about threading.
-	fields = append(fields, zap.String("thread", "main"))
+	ctx, sid := getOrSetContextValue(ctx, sidId, newSid)
+	fields = append(fields, zap.String("sid", sid))
+
+	// Go doesn't identify goroutines, so the thread is the one named with
+	// Goroutine (if any).
+	_, thread := getContextValue[string](ctx, threadNameId)
+	if thread == "" {
+		thread = "main"
+	}
+	fields = append(fields, zap.String("thread", thread))
 
 	// Get the caller of the function in trace2.go
 	// Skip up two levels:
@@ -189,15 +407,68 @@ func (t *Trace2) sharedFields(ctx context.Context) (context.Context, fieldList)
 func (t *Trace2) logStart(ctx context.Context) context.Context {
 	ctx, sharedFields := t.sharedFields(ctx)
 
+	// Like Git, log the executable's version (and the version of the event
+	// format) before anything else.
+	t.logger.Info("version", sharedFields.withTime().with(
+		zap.String("evt", trace2EventFormatVersion),
+		zap.String("exe", buildinfo.VersionString()),
+	)...)
+
 	t.logger.Info("start", sharedFields.withTime().with(
 		zap.Strings("argv", os.Args),
 	)...)
 
+	// If the process was started on behalf of an HTTP request (e.g. an update
+	// triggered by a webhook), attribute its events to the request.
+	if requestId := strings.TrimSpace(os.Getenv(requestIdEnvVar)); requestId != "" {
+		ctx = WithRequestId(ctx, requestId)
+		t.Data(ctx, "http", "request_id", requestId)
+	}
+
 	return ctx
 }
 
+// sortedStatNames returns the names of the given timers or counters, sorted
+// by category and name.
+func sortedStatNames[T any](stats map[trace2StatName]T) []trace2StatName {
+	names := make([]trace2StatName, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].category != names[j].category {
+			return names[i].category < names[j].category
+		}
+		return names[i].name < names[j].name
+	})
+	return names
+}
+
 func (t *Trace2) logExit(ctx context.Context, exitCode int) {
 	_, sharedFields := t.sharedFields(ctx)
+
+	// Like Git, report the timers and counters of the process before it exits.
+	t.statsLock.Lock()
+	for _, name := range sortedStatNames(t.timers) {
+		timer := t.timers[name]
+		t.logger.Debug("timer", sharedFields.withTime().with(
+			zap.String("category", name.category),
+			zap.String("name", name.name),
+			zap.Int("intervals", timer.intervals),
+			zap.Duration("t_total", timer.total),
+			zap.Duration("t_min", timer.min),
+			zap.Duration("t_max", timer.max),
+		)...)
+	}
+	for _, name := range sortedStatNames(t.counters) {
+		t.logger.Debug("counter", sharedFields.withTime().with(
+			zap.String("category", name.category),
+			zap.String("name", name.name),
+			zap.Int64("count", t.counters[name]),
+		)...)
+	}
+	t.statsLock.Unlock()
+
 	fields := sharedFields.with(
 		zap.Int("code", exitCode),
 	)
@@ -205,6 +476,17 @@ func (t *Trace2) logExit(ctx context.Context, exitCode int) {
 	t.logger.Info("atexit", fields.withTime()...)
 
 	t.logger.Sync()
+
+	if t.rootSpan != nil {
+		t.rootSpan.SetAttributes(otelAttribute("process.exit_code", exitCode))
+		if exitCode != 0 {
+			setSpanError(t.rootSpan, fmt.Sprintf("exited with code %d", exitCode))
+		}
+		t.endSpan(t.rootSpan)
+	}
+	if t.exporter() != nil {
+		t.otel.shutdown()
+	}
 }
 
 func (t *Trace2) Region(ctx context.Context, category string, label string) (context.Context, func()) {
@@ -222,6 +504,7 @@ func (t *Trace2) Region(ctx context.Context, category string, label string) (con
 		nesting.tStart = time.Now()
 	}
 	ctx = context.WithValue(ctx, parentRegionId, nesting)
+	ctx, span := t.startSpan(ctx, category+"/"+label, trace.SpanKindInternal)
 
 	regionFields := fieldList{
 		zap.String("category", category),
@@ -231,6 +514,32 @@ func (t *Trace2) Region(ctx context.Context, category string, label string) (con
 	t.logger.Debug("region_enter", sharedFields.withNesting(nesting, false).with(regionFields...)...)
 	return ctx, func() {
 		t.logger.Debug("region_leave", sharedFields.withNesting(nesting, true).with(regionFields...)...)
+		t.endSpan(span)
+	}
+}
+
+func (t *Trace2) Goroutine(ctx context.Context, name string) (context.Context, func()) {
+	// Name the thread like Git does, numbering threads from 1 (the main thread
+	// being 0).
+	threadId := atomic.AddInt32(&t.lastThreadId, 1)
+	ctx = context.WithValue(ctx, threadNameId, fmt.Sprintf("th%02d:%s", threadId, name))
+
+	// Regions are nested within their thread, so the thread starts outside of
+	// any region.
+	thread := trace2Region{
+		level:  -1,
+		tStart: time.Now(),
+	}
+	ctx = context.WithValue(ctx, parentRegionId, thread)
+	ctx, span := t.startSpan(ctx, name, trace.SpanKindInternal)
+
+	ctx, sharedFields := t.sharedFields(ctx)
+	t.logger.Debug("thread_start", sharedFields.withTime()...)
+	return ctx, func() {
+		t.logger.Debug("thread_exit", sharedFields.withTime().with(
+			zap.Duration("t_rel", time.Since(thread.tStart)),
+		)...)
+		t.endSpan(span)
 	}
 }
 
@@ -238,6 +547,36 @@ func (t *Trace2) ChildProcess(ctx context.Context, cmd *exec.Cmd) (func(error),
 	var startTime time.Time
 	_, sharedFields := t.sharedFields(ctx)
 
+	// Export our session ID to the child, so that its traces (e.g. Git's) can
+	// be correlated with ours.
+	_, sid := getContextValue[string](ctx, sidId)
+	if sid != "" {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", trace2ParentSid, sid))
+	}
+
+	// Likewise, a child started on behalf of an HTTP request is attributed to
+	// the request.
+	if requestId := RequestId(ctx); requestId != "" {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", requestIdEnvVar, requestId))
+	}
+
+	// Likewise, the child's spans (e.g. of an update run by the web server)
+	// are children of the span of the child process.
+	_, span := t.startSpan(ctx, childSpanName(cmd.Args), trace.SpanKindInternal)
+	if span != nil {
+		span.SetAttributes(otelAttribute("process.command_args", strings.Join(cmd.Args, " ")))
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", otelTraceParent, traceParent(span)))
+	}
+
 	// Get the child id by atomically incrementing the lastChildId
 	childId := atomic.AddInt32(&t.lastChildId, 1)
 	t.logger.Debug("child_start", sharedFields.with(
@@ -252,11 +591,21 @@ func (t *Trace2) ChildProcess(ctx context.Context, cmd *exec.Cmd) (func(error),
 		if execError != nil {
 			ready = zap.String("ready", "error")
 		}
+		if span != nil {
+			if execError != nil {
+				// The process never started, so it won't exit either.
+				setSpanError(span, execError.Error())
+				t.endSpan(span)
+			} else {
+				span.SetAttributes(otelAttribute("process.pid", cmd.Process.Pid))
+			}
+		}
 		t.logger.Debug("child_ready", sharedFields.with(
 			zap.Int32("child_id", childId),
 			zap.Int("pid", cmd.Process.Pid),
 			ready,
 			zap.Strings("argv", cmd.Args),
+			zap.Duration("t_rel", time.Since(startTime)),
 		)...)
 	}
 
@@ -267,6 +616,13 @@ func (t *Trace2) ChildProcess(ctx context.Context, cmd *exec.Cmd) (func(error),
 			zap.Int("code", cmd.ProcessState.ExitCode()),
 			zap.Duration("t_rel", time.Since(startTime)),
 		)...)
+		if span != nil {
+			span.SetAttributes(otelAttribute("process.exit_code", cmd.ProcessState.ExitCode()))
+			if !cmd.ProcessState.Success() {
+				setSpanError(span, fmt.Sprintf("exited with code %d", cmd.ProcessState.ExitCode()))
+			}
+			t.endSpan(span)
+		}
 	}
 
 	// Approximate the process runtime by starting the timer now
@@ -275,11 +631,98 @@ func (t *Trace2) ChildProcess(ctx context.Context, cmd *exec.Cmd) (func(error),
 	return childReady, childExit
 }
 
+// withDataNesting adds the nesting of a 'data' or 'data_json' event: the
+// nesting of the region it is logged in (if any) plus one, and the time
+// since the region started.
+func (l fieldList) withDataNesting(ctx context.Context) fieldList {
+	hasRegion, region := getContextValue[trace2Region](ctx, parentRegionId)
+	if !hasRegion {
+		return l.with(zap.Int("nesting", 0))
+	}
+	region.level++
+	return l.withNesting(region, true)
+}
+
+func (t *Trace2) Data(ctx context.Context, category string, key string, value any) {
+	_, sharedFields := t.sharedFields(ctx)
+	t.logger.Debug("data", sharedFields.withTime().withDataNesting(ctx).with(
+		zap.String("category", category),
+		zap.String("key", key),
+		zap.String("value", fmt.Sprint(value)),
+	)...)
+	if span := currentSpan(ctx); span != nil {
+		span.SetAttributes(otelAttribute(category+"."+key, value))
+	}
+}
+
+func (t *Trace2) DataJSON(ctx context.Context, category string, key string, value any) {
+	_, sharedFields := t.sharedFields(ctx)
+	t.logger.Debug("data_json", sharedFields.withTime().withDataNesting(ctx).with(
+		zap.String("category", category),
+		zap.String("key", key),
+		zap.Reflect("value", value),
+	)...)
+	if span := currentSpan(ctx); span != nil {
+		if encoded, err := json.Marshal(value); err == nil {
+			span.SetAttributes(otelAttribute(category+"."+key, string(encoded)))
+		}
+	}
+}
+
+func (t *Trace2) StartTimer(ctx context.Context, category string, name string) func() {
+	startTime := time.Now()
+	return func() {
+		interval := time.Since(startTime)
+		if t.exporter() != nil {
+			t.otel.recordDuration(ctx, fmt.Sprintf("%s.%s.duration", category, name), interval)
+		}
+
+		t.statsLock.Lock()
+		defer t.statsLock.Unlock()
+		if t.timers == nil {
+			t.timers = make(map[trace2StatName]*trace2Timer)
+		}
+
+		timer, ok := t.timers[trace2StatName{category, name}]
+		if !ok {
+			timer = &trace2Timer{min: interval}
+			t.timers[trace2StatName{category, name}] = timer
+		}
+		timer.intervals++
+		timer.total += interval
+		if interval < timer.min {
+			timer.min = interval
+		}
+		if interval > timer.max {
+			timer.max = interval
+		}
+	}
+}
+
+func (t *Trace2) AddToCounter(ctx context.Context, category string, name string, value int64) {
+	if t.exporter() != nil {
+		t.otel.addToCounter(ctx, fmt.Sprintf("%s.%s", category, name), value)
+	}
+
+	t.statsLock.Lock()
+	defer t.statsLock.Unlock()
+	if t.counters == nil {
+		t.counters = make(map[trace2StatName]int64)
+	}
+	t.counters[trace2StatName{category, name}] += value
+}
+
 func (t *Trace2) LogCommand(ctx context.Context, commandName string) context.Context {
 	ctx, sharedFields := t.sharedFields(ctx)
 
 	t.logger.Info("cmd_name", sharedFields.with(zap.String("name", commandName))...)
 
+	// The command's span is the root of the process' spans, and the child of
+	// the span that started the process (if any).
+	ctx = WithTraceParent(ctx, os.Getenv(otelTraceParent))
+	ctx, t.rootSpan = t.startSpan(ctx,
+		strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")+" "+commandName, trace.SpanKindInternal)
+
 	return ctx
 }
 
@@ -292,6 +735,12 @@ func (t *Trace2) Error(ctx context.Context, err error) error {
 			zap.String("msg", err.Error()),
 			zap.String("fmt", err.Error()))...)
 	}
+
+	// Unlike the error event, every span that the error is returned through
+	// failed.
+	if span := currentSpan(ctx); span != nil {
+		setSpanError(span, err.Error())
+	}
 	return loggedError(err)
 }
 
@@ -314,6 +763,10 @@ func (t *Trace2) Errorf(ctx context.Context, format string, a ...any) error {
 			zap.String("msg", err.Error()),
 			zap.String("fmt", format))...)
 	}
+
+	if span := currentSpan(ctx); span != nil {
+		setSpanError(span, err.Error())
+	}
 	return err
 }
 
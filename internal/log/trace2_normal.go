@@ -0,0 +1,151 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// The width of the time and source location prefixing each line of the normal
+// format, as in Git's 'tr2_tgt_normal.c'.
+const trace2NormalPrefixWidth int = 50
+
+const trace2NormalTimeFormat string = "15:04:05.000000"
+
+var trace2NormalBufferPool = buffer.NewPool()
+
+// trace2NormalEncoder encodes the trace2 events logged by 'Trace2' in the
+// normal (plain text) format of GIT_TRACE2, one line per event, e.g.:
+//
+//	12:28:42.620009 main.go:38                        version v1.0.0
+//
+// Like Git, it omits the time and source location if 'brief' is set (see
+// GIT_TRACE2_BRIEF), and ignores the events that only the event and perf
+// formats include (e.g. regions and data).
+type trace2NormalEncoder struct {
+	*zapcore.MapObjectEncoder
+	brief bool
+}
+
+func newTrace2NormalEncoder(brief bool) zapcore.Encoder {
+	return &trace2NormalEncoder{
+		MapObjectEncoder: zapcore.NewMapObjectEncoder(),
+		brief:            brief,
+	}
+}
+
+func (e *trace2NormalEncoder) Clone() zapcore.Encoder {
+	clone := zapcore.NewMapObjectEncoder()
+	for key, value := range e.Fields {
+		clone.Fields[key] = value
+	}
+	return &trace2NormalEncoder{
+		MapObjectEncoder: clone,
+		brief:            e.brief,
+	}
+}
+
+func (e *trace2NormalEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	enc := e.Clone().(*trace2NormalEncoder)
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+
+	buf := trace2NormalBufferPool.Get()
+	payload := enc.payload(entry.Message)
+	if payload == "" {
+		// Not an event of the normal format; write nothing.
+		return buf, nil
+	}
+
+	if !e.brief {
+		buf.AppendString(entry.Time.Local().Format(trace2NormalTimeFormat))
+		buf.AppendByte(' ')
+		if file, ok := enc.Fields["file"].(string); ok {
+			buf.AppendString(fmt.Sprintf("%s:%d ", file, enc.Fields["line"]))
+		}
+		for buf.Len() < trace2NormalPrefixWidth {
+			buf.AppendByte(' ')
+		}
+	}
+
+	buf.AppendString(payload)
+	buf.AppendByte('\n')
+	return buf, nil
+}
+
+// payload formats the event with the given name like Git's normal target, or
+// returns an empty string if the event isn't part of the normal format.
+func (e *trace2NormalEncoder) payload(event string) string {
+	switch event {
+	case "version":
+		return fmt.Sprintf("version %s", e.Fields["exe"])
+	case "start":
+		return fmt.Sprintf("start %s", quoteArgvPretty(e.strings("argv")))
+	case "exit", "atexit":
+		return fmt.Sprintf("%s elapsed:%.6f code:%d", event, e.seconds("t_abs"), e.Fields["code"])
+	case "error":
+		return fmt.Sprintf("error %s", e.Fields["msg"])
+	case "cmd_name":
+		// The command hierarchy of a bundle server command is the command.
+		return fmt.Sprintf("cmd_name %s (%s)", e.Fields["name"], e.Fields["name"])
+	case "child_start":
+		return fmt.Sprintf("child_start[%d] %s", e.Fields["child_id"], quoteArgvPretty(e.strings("argv")))
+	case "child_ready":
+		return fmt.Sprintf("child_ready[%d] pid:%d ready:%s elapsed:%.6f",
+			e.Fields["child_id"], e.Fields["pid"], e.Fields["ready"], e.seconds("t_rel"))
+	case "child_exit":
+		return fmt.Sprintf("child_exit[%d] pid:%d code:%d elapsed:%.6f",
+			e.Fields["child_id"], e.Fields["pid"], e.Fields["code"], e.seconds("t_rel"))
+	case "timer":
+		return fmt.Sprintf("timer %s/%s intervals:%d total:%8.6f min:%8.6f max:%8.6f",
+			e.Fields["category"], e.Fields["name"], e.Fields["intervals"],
+			e.seconds("t_total"), e.seconds("t_min"), e.seconds("t_max"))
+	case "counter":
+		return fmt.Sprintf("counter %s/%s value:%d", e.Fields["category"], e.Fields["name"], e.Fields["count"])
+	default:
+		return ""
+	}
+}
+
+func (e *trace2NormalEncoder) strings(key string) []string {
+	values, _ := e.Fields[key].([]interface{})
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		out = append(out, fmt.Sprint(value))
+	}
+	return out
+}
+
+func (e *trace2NormalEncoder) seconds(key string) float64 {
+	duration, _ := e.Fields[key].(time.Duration)
+	return duration.Seconds()
+}
+
+// quoteArgvPretty joins the arguments with spaces, quoting those that the
+// shell would not read as a single word, like Git's
+// 'sq_append_quote_argv_pretty()'.
+func quoteArgvPretty(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		mustQuote := arg == ""
+		for _, c := range arg {
+			isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+			if !isAlnum && !strings.ContainsRune("+,-./:=@_^", c) {
+				mustQuote = true
+				break
+			}
+		}
+
+		if mustQuote {
+			arg = strings.ReplaceAll(arg, "'", `'\''`)
+			arg = strings.ReplaceAll(arg, "!", `'\!'`)
+			arg = "'" + arg + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,81 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var trace2NormalTests = []struct {
+	title string
+
+	// Inputs
+	event  string
+	fields []zap.Field
+	brief  bool
+
+	// Expected values
+	expectedLine string
+}{
+	{
+		"start with quoted arguments",
+		"start",
+		[]zap.Field{
+			zap.String("file", "main.go"),
+			zap.Int("line", 12),
+			zap.Strings("argv", []string{"git-bundle-server", "init", "it's here", ""}),
+		},
+		false,
+		"12:28:42.620009 main.go:12                        start git-bundle-server init 'it'\\''s here' ''\n",
+	},
+	{
+		"brief exit",
+		"exit",
+		[]zap.Field{
+			zap.String("file", "trace2.go"),
+			zap.Int("line", 200),
+			zap.Int("code", 3),
+			zap.Duration("t_abs", 1500*time.Millisecond),
+		},
+		true,
+		"exit elapsed:1.500000 code:3\n",
+	},
+	{
+		"child exit",
+		"child_exit",
+		[]zap.Field{
+			zap.Int32("child_id", 2),
+			zap.Int("pid", 1234),
+			zap.Int("code", 0),
+			zap.Duration("t_rel", 25*time.Millisecond),
+		},
+		true,
+		"child_exit[2] pid:1234 code:0 elapsed:0.025000\n",
+	},
+	{
+		"region events are omitted",
+		"region_enter",
+		[]zap.Field{
+			zap.String("category", "bundles"),
+			zap.String("label", "collapse_list"),
+		},
+		false,
+		"",
+	},
+}
+
+func TestTrace2NormalEncoder(t *testing.T) {
+	entryTime := time.Date(2023, 4, 1, 12, 28, 42, 620009000, time.Local)
+
+	for _, tt := range trace2NormalTests {
+		t.Run(tt.title, func(t *testing.T) {
+			encoder := newTrace2NormalEncoder(tt.brief)
+			buf, err := encoder.EncodeEntry(zapcore.Entry{Message: tt.event, Time: entryTime}, tt.fields)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedLine, buf.String())
+		})
+	}
+}
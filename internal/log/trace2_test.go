@@ -0,0 +1,121 @@
+package log
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var trace2WriteSyncerTests = []struct {
+	title string
+
+	// Inputs
+	value string
+
+	// Expected values
+	expectOutput bool
+}{
+	{"unset", "", false},
+	{"disabled", "0", false},
+	{"disabled by name", "False", false},
+	{"stderr", "1", true},
+	{"stderr by name", "true", true},
+	{"file descriptor", "5", true},
+	{"unknown number", "10", false},
+	{"relative socket path", "af_unix:trace.sock", false},
+	{"missing socket", "af_unix:stream:/nonexistent/trace.sock", false},
+}
+
+func TestGetTrace2WriteSyncer(t *testing.T) {
+	for _, tt := range trace2WriteSyncerTests {
+		t.Run(tt.title, func(t *testing.T) {
+			t.Setenv("TEST_TRACE2", tt.value)
+			output := getTrace2WriteSyncer("TEST_TRACE2")
+			assert.Equal(t, tt.expectOutput, output != nil)
+		})
+	}
+
+	t.Run("file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "traces", "trace.txt")
+		t.Setenv("TEST_TRACE2", filename)
+
+		output := getTrace2WriteSyncer("TEST_TRACE2")
+		assert.NotNil(t, output)
+		_, err := output.Write([]byte("version v1.0.0\n"))
+		assert.Nil(t, err)
+
+		content, err := os.ReadFile(filename)
+		assert.Nil(t, err)
+		assert.Equal(t, "version v1.0.0\n", string(content))
+	})
+}
+
+func TestTrace2_SessionIdInheritance(t *testing.T) {
+	t.Setenv(trace2ParentSid, "parent-sid")
+	tr2 := &Trace2{logger: zap.NewNop(), lastChildId: -1}
+
+	ctx := tr2.logStart(context.Background())
+	_, sid := getContextValue[string](ctx, sidId)
+	assert.True(t, strings.HasPrefix(sid, "parent-sid/"), "SID %q does not extend the parent SID", sid)
+
+	cmd := exec.Command("git", "version")
+	tr2.ChildProcess(ctx, cmd)
+	assert.Equal(t, trace2ParentSid+"="+sid, cmd.Env[len(cmd.Env)-1])
+}
+
+func TestTrace2_RequestIdInheritance(t *testing.T) {
+	t.Setenv(requestIdEnvVar, "abc-123")
+	tr2 := &Trace2{logger: zap.NewNop(), lastChildId: -1}
+
+	ctx := tr2.logStart(context.Background())
+	assert.Equal(t, "abc-123", RequestId(ctx))
+
+	cmd := exec.Command("git", "version")
+	tr2.ChildProcess(ctx, cmd)
+	assert.Contains(t, cmd.Env, requestIdEnvVar+"=abc-123")
+}
+
+func TestTrace2_TimersAndCounters(t *testing.T) {
+	tr2 := &Trace2{logger: zap.NewNop(), lastChildId: -1}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		stopTimer := tr2.StartTimer(ctx, "git", "fetch")
+		stopTimer()
+	}
+	tr2.AddToCounter(ctx, "bundles", "created", 1)
+	tr2.AddToCounter(ctx, "bundles", "created", 2)
+
+	timer := tr2.timers[trace2StatName{"git", "fetch"}]
+	assert.Equal(t, 3, timer.intervals)
+	assert.LessOrEqual(t, timer.min, timer.max)
+	assert.LessOrEqual(t, timer.max, timer.total)
+	assert.Equal(t, int64(3), tr2.counters[trace2StatName{"bundles", "created"}])
+}
+
+func TestTrace2_Goroutine(t *testing.T) {
+	tr2 := &Trace2{logger: zap.NewNop(), lastChildId: -1}
+	ctx := context.Background()
+
+	ctx1, exitThread1 := tr2.Goroutine(ctx, "update-worker")
+	defer exitThread1()
+	ctx2, exitThread2 := tr2.Goroutine(ctx, "update-worker")
+	defer exitThread2()
+
+	_, thread1 := getContextValue[string](ctx1, threadNameId)
+	_, thread2 := getContextValue[string](ctx2, threadNameId)
+	assert.Equal(t, "th01:update-worker", thread1)
+	assert.Equal(t, "th02:update-worker", thread2)
+
+	// Regions in the thread are nested from the top level.
+	regionCtx, exitRegion := tr2.Region(ctx1, "update", "fetch")
+	defer exitRegion()
+	_, region := getContextValue[trace2Region](regionCtx, parentRegionId)
+	assert.Equal(t, 0, region.level)
+}
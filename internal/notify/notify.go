@@ -0,0 +1,225 @@
+// Package notify sends notifications of problems with the bundle server (e.g.
+// a route that keeps failing to update) to the sinks configured in the bundle
+// server's 'notifications.json' file.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The kinds of events notified.
+const (
+	// A route failed to update the configured number of times in a row.
+	EventUpdateFailed string = "update-failed"
+
+	// A route that had failed to update (and was notified as such) updated
+	// successfully.
+	EventUpdateRecovered string = "update-recovered"
+
+	// The web server's TLS certificate expires within the configured period.
+	EventCertExpiring string = "cert-expiring"
+
+	// A test notification, sent by 'git-bundle-server notify'.
+	EventTest string = "test"
+)
+
+const (
+	defaultUpdateFailures int = 3
+	defaultCertExpiryDays int = 14
+)
+
+// Event is a notification sent to each sink.
+type Event struct {
+	Kind string    `json:"kind"`
+	Time time.Time `json:"time"`
+
+	// The host running the bundle server.
+	Host string `json:"host"`
+
+	// The route concerned by the event, if any.
+	Route string `json:"route,omitempty"`
+
+	// A one-line description of the event, and more details (e.g. the error
+	// of a failed update), if any.
+	Summary string `json:"summary"`
+	Details string `json:"details,omitempty"`
+}
+
+// NewEvent creates an event of the given kind that happened now.
+func NewEvent(kind string, route string, summary string, details string) Event {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return Event{
+		Kind:    kind,
+		Time:    time.Now(),
+		Host:    host,
+		Route:   route,
+		Summary: summary,
+		Details: details,
+	}
+}
+
+// Config is the content of the 'notifications.json' file.
+type Config struct {
+	// The number of consecutive failed updates of a route after which it is
+	// notified (default 3).
+	UpdateFailures int `json:"updateFailures,omitempty"`
+
+	// The number of days before the expiry of the web server's TLS
+	// certificate from which it is notified (default 14).
+	CertExpiryDays int `json:"certExpiryDays,omitempty"`
+
+	Sinks []SinkConfig `json:"sinks"`
+}
+
+// SinkConfig configures a destination of the notifications.
+type SinkConfig struct {
+	// The kind of sink: 'webhook' (the event is POSTed as JSON), 'slack' (a
+	// message is POSTed to a Slack-compatible incoming webhook), or 'smtp'
+	// (the event is emailed).
+	Type string `json:"type"`
+
+	// The URL of a 'webhook' or 'slack' sink, and the headers sent with each
+	// request to a 'webhook' sink (e.g. for authentication).
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// The address ('host:port') of the SMTP server of an 'smtp' sink, the
+	// username and the file containing the password with which to
+	// authenticate (if any), and the sender and recipients of the emails.
+	Server       string   `json:"server,omitempty"`
+	Username     string   `json:"username,omitempty"`
+	PasswordFile string   `json:"passwordFile,omitempty"`
+	From         string   `json:"from,omitempty"`
+	To           []string `json:"to,omitempty"`
+}
+
+// sink sends events to a single destination.
+type sink interface {
+	name() string
+	send(ctx context.Context, event Event) error
+}
+
+// Notifier sends events to the configured sinks.
+type Notifier struct {
+	logger         log.TraceLogger
+	sinks          []sink
+	updateFailures int
+	certExpiry     time.Duration
+}
+
+// NewNotifier creates the notifier configured in the bundle server's
+// 'notifications.json' file. If the file does not exist, notifications are
+// disabled and the returned notifier is nil.
+func NewNotifier(l log.TraceLogger, u common.UserProvider) (*Notifier, error) {
+	user, err := u.CurrentUser()
+	if err != nil {
+		return nil, fmt.Errorf("could not get current user: %w", err)
+	}
+
+	configFile := core.NotificationConfigFile(user)
+	fileBytes, err := os.ReadFile(configFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read notification config: %w", err)
+	}
+
+	var config Config
+	err = json.Unmarshal(fileBytes, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse notification config '%s': %w", configFile, err)
+	}
+
+	n, err := NewNotifierFromConfig(l, config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification config '%s': %w", configFile, err)
+	}
+	return n, nil
+}
+
+// NewNotifierFromConfig creates a notifier sending events to the sinks of the
+// given config.
+func NewNotifierFromConfig(l log.TraceLogger, config Config) (*Notifier, error) {
+	if config.UpdateFailures < 0 || config.CertExpiryDays < 0 {
+		return nil, fmt.Errorf("'updateFailures' and 'certExpiryDays' must not be negative")
+	}
+	if config.UpdateFailures == 0 {
+		config.UpdateFailures = defaultUpdateFailures
+	}
+	if config.CertExpiryDays == 0 {
+		config.CertExpiryDays = defaultCertExpiryDays
+	}
+
+	n := &Notifier{
+		logger:         l,
+		sinks:          []sink{},
+		updateFailures: config.UpdateFailures,
+		certExpiry:     time.Duration(config.CertExpiryDays) * 24 * time.Hour,
+	}
+
+	if len(config.Sinks) == 0 {
+		return nil, fmt.Errorf("no sinks are configured")
+	}
+	for i, sinkConfig := range config.Sinks {
+		var s sink
+		var err error
+		switch strings.ToLower(sinkConfig.Type) {
+		case "webhook":
+			s, err = newWebhookSink(sinkConfig)
+		case "slack":
+			s, err = newSlackSink(sinkConfig)
+		case "smtp":
+			s, err = newSMTPSink(sinkConfig)
+		default:
+			err = fmt.Errorf("unrecognized type '%s'", sinkConfig.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sink %d: %w", i+1, err)
+		}
+		n.sinks = append(n.sinks, s)
+	}
+
+	return n, nil
+}
+
+// UpdateFailures returns the number of consecutive failed updates of a route
+// after which it is notified.
+func (n *Notifier) UpdateFailures() int {
+	return n.updateFailures
+}
+
+// CertExpiry returns how long before the expiry of the web server's TLS
+// certificate it is notified.
+func (n *Notifier) CertExpiry() time.Duration {
+	return n.certExpiry
+}
+
+// Notify sends the event to every sink. A sink failing to send it doesn't
+// prevent the others from sending it; the errors of all failed sinks are
+// returned.
+func (n *Notifier) Notify(ctx context.Context, event Event) error {
+	ctx, exitRegion := n.logger.Region(ctx, "notify", "notify")
+	defer exitRegion()
+
+	errs := []error{}
+	for _, s := range n.sinks {
+		err := s.send(ctx, event)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify %s: %w", s.name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
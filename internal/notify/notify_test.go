@@ -0,0 +1,163 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/notify"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+var notifierConfigTests = []struct {
+	title  string
+	config notify.Config
+
+	expectedUpdateFailures int
+	expectedCertExpiry     time.Duration
+	expectErr              bool
+}{
+	{
+		"Defaults",
+		notify.Config{Sinks: []notify.SinkConfig{{Type: "webhook", URL: "https://example.com/hook"}}},
+		3,
+		14 * 24 * time.Hour,
+		false,
+	},
+	{
+		"Custom thresholds",
+		notify.Config{
+			UpdateFailures: 1,
+			CertExpiryDays: 30,
+			Sinks:          []notify.SinkConfig{{Type: "slack", URL: "https://hooks.example.com/T000/B000"}},
+		},
+		1,
+		30 * 24 * time.Hour,
+		false,
+	},
+	{
+		"SMTP sink",
+		notify.Config{Sinks: []notify.SinkConfig{{
+			Type:   "smtp",
+			Server: "smtp.example.com:587",
+			From:   "bundles@example.com",
+			To:     []string{"ops@example.com"},
+		}}},
+		3,
+		14 * 24 * time.Hour,
+		false,
+	},
+	{
+		"No sinks",
+		notify.Config{},
+		0,
+		0,
+		true,
+	},
+	{
+		"Unknown sink type",
+		notify.Config{Sinks: []notify.SinkConfig{{Type: "pager", URL: "https://example.com"}}},
+		0,
+		0,
+		true,
+	},
+	{
+		"Webhook without URL",
+		notify.Config{Sinks: []notify.SinkConfig{{Type: "webhook"}}},
+		0,
+		0,
+		true,
+	},
+	{
+		"SMTP server without port",
+		notify.Config{Sinks: []notify.SinkConfig{{
+			Type:   "smtp",
+			Server: "smtp.example.com",
+			From:   "bundles@example.com",
+			To:     []string{"ops@example.com"},
+		}}},
+		0,
+		0,
+		true,
+	},
+	{
+		"Negative threshold",
+		notify.Config{
+			UpdateFailures: -1,
+			Sinks:          []notify.SinkConfig{{Type: "webhook", URL: "https://example.com/hook"}},
+		},
+		0,
+		0,
+		true,
+	},
+}
+
+func TestNotifier_Config(t *testing.T) {
+	for _, tt := range notifierConfigTests {
+		t.Run(tt.title, func(t *testing.T) {
+			notifier, err := notify.NewNotifierFromConfig(&MockTraceLogger{}, tt.config)
+			if tt.expectErr {
+				assert.Error(t, err)
+				assert.Nil(t, notifier)
+				return
+			}
+
+			assert.NoError(t, err)
+			if assert.NotNil(t, notifier) {
+				assert.Equal(t, tt.expectedUpdateFailures, notifier.UpdateFailures())
+				assert.Equal(t, tt.expectedCertExpiry, notifier.CertExpiry())
+			}
+		})
+	}
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	var lock sync.Mutex
+	received := map[string]map[string]any{}
+	headers := map[string]http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		body := map[string]any{}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		assert.NoError(t, err)
+
+		lock.Lock()
+		defer lock.Unlock()
+		received[r.URL.Path] = body
+		headers[r.URL.Path] = r.Header
+	}))
+	defer server.Close()
+
+	notifier, err := notify.NewNotifierFromConfig(&MockTraceLogger{}, notify.Config{
+		Sinks: []notify.SinkConfig{
+			{Type: "webhook", URL: server.URL + "/webhook", Headers: map[string]string{"Authorization": "Bearer secret"}},
+			{Type: "slack", URL: server.URL + "/slack"},
+			{Type: "webhook", URL: server.URL + "/broken"},
+		},
+	})
+	assert.NoError(t, err)
+
+	event := notify.NewEvent(notify.EventUpdateFailed, "test/repo",
+		"test/repo failed to update 3 times in a row", "fatal: could not read from remote")
+	err = notifier.Notify(context.Background(), event)
+
+	// The broken sink fails, but doesn't prevent the others from notifying
+	assert.ErrorContains(t, err, "500")
+
+	assert.Equal(t, "update-failed", received["/webhook"]["kind"])
+	assert.Equal(t, "test/repo", received["/webhook"]["route"])
+	assert.Equal(t, "fatal: could not read from remote", received["/webhook"]["details"])
+	assert.Equal(t, "Bearer secret", headers["/webhook"].Get("Authorization"))
+
+	assert.Contains(t, received["/slack"]["text"], "test/repo failed to update 3 times in a row")
+	assert.Contains(t, received["/slack"]["text"], "fatal: could not read from remote")
+}
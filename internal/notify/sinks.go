@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/buildinfo"
+)
+
+const sendTimeout time.Duration = 30 * time.Second
+
+// postJson POSTs the given value as JSON to the URL, failing unless the
+// response has a 2xx status.
+func postJson(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", buildinfo.UserAgent("git-bundle-server"))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST returned '%s'", resp.Status)
+	}
+	return nil
+}
+
+// validateURL checks that the URL of a sink is an HTTP(S) URL, and returns it
+// without credentials for use in messages.
+func validateURL(rawURL string) (string, error) {
+	if rawURL == "" {
+		return "", fmt.Errorf("missing 'url'")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid 'url': %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid 'url' '%s': the scheme must be 'http' or 'https'", u.Redacted())
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// webhookSink POSTs each event as JSON to a URL.
+type webhookSink struct {
+	url     string
+	host    string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhookSink(config SinkConfig) (*webhookSink, error) {
+	host, err := validateURL(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &webhookSink{
+		url:     config.URL,
+		host:    host,
+		headers: config.Headers,
+		client:  &http.Client{Timeout: sendTimeout},
+	}, nil
+}
+
+func (s *webhookSink) name() string {
+	return "webhook " + s.host
+}
+
+func (s *webhookSink) send(ctx context.Context, event Event) error {
+	return postJson(ctx, s.client, s.url, s.headers, event)
+}
+
+// slackSink posts each event as a message to a Slack-compatible incoming
+// webhook (e.g. Slack, Mattermost, or Rocket.Chat).
+type slackSink struct {
+	url    string
+	host   string
+	client *http.Client
+}
+
+func newSlackSink(config SinkConfig) (*slackSink, error) {
+	host, err := validateURL(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &slackSink{
+		url:    config.URL,
+		host:   host,
+		client: &http.Client{Timeout: sendTimeout},
+	}, nil
+}
+
+func (s *slackSink) name() string {
+	return "Slack webhook " + s.host
+}
+
+// slackMessage formats the event as the text of a message.
+func slackMessage(event Event) string {
+	text := fmt.Sprintf("*git-bundle-server on %s*: %s", event.Host, event.Summary)
+	if event.Details != "" {
+		text += "\n```\n" + strings.TrimSpace(event.Details) + "\n```"
+	}
+	return text
+}
+
+func (s *slackSink) send(ctx context.Context, event Event) error {
+	return postJson(ctx, s.client, s.url, nil, map[string]string{"text": slackMessage(event)})
+}
+
+// smtpSink emails each event.
+type smtpSink struct {
+	server string
+	auth   smtp.Auth
+	from   string
+	to     []string
+}
+
+func newSMTPSink(config SinkConfig) (*smtpSink, error) {
+	if config.Server == "" {
+		return nil, fmt.Errorf("missing 'server'")
+	}
+	host, _, err := net.SplitHostPort(config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'server' '%s': %w", config.Server, err)
+	}
+	if config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("missing 'from' or 'to'")
+	}
+
+	s := &smtpSink{
+		server: config.Server,
+		from:   config.From,
+		to:     config.To,
+	}
+	if config.Username != "" {
+		password, err := os.ReadFile(config.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read SMTP password: %w", err)
+		}
+		// PLAIN authentication is only used over TLS (or with localhost), so
+		// the password is never sent in the clear.
+		s.auth = smtp.PlainAuth("", config.Username, strings.TrimSpace(string(password)), host)
+	}
+	return s, nil
+}
+
+func (s *smtpSink) name() string {
+	return "SMTP server " + s.server
+}
+
+// emailMessage formats the event as an email from 'from' to 'to'.
+func emailMessage(event Event, from string, to []string) []byte {
+	msg := bytes.Buffer{}
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: [git-bundle-server] %s\r\n", event.Summary)
+	fmt.Fprintf(&msg, "Date: %s\r\n", event.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\n", event.Summary)
+	if event.Details != "" {
+		for _, line := range strings.Split(strings.TrimSpace(event.Details), "\n") {
+			fmt.Fprintf(&msg, "%s\r\n", line)
+		}
+		fmt.Fprintf(&msg, "\r\n")
+	}
+	fmt.Fprintf(&msg, "Host: %s\r\n", event.Host)
+	if event.Route != "" {
+		fmt.Fprintf(&msg, "Route: %s\r\n", event.Route)
+	}
+	fmt.Fprintf(&msg, "Time: %s\r\n", event.Time.Format(time.RFC3339))
+	return msg.Bytes()
+}
+
+func (s *smtpSink) send(ctx context.Context, event Event) error {
+	// 'smtp.SendMail' can't be cancelled, so only give up waiting for it.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.server, s.auth, s.from, s.to, emailMessage(event, s.from, s.to))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(sendTimeout):
+		return fmt.Errorf("timed out after %s", sendTimeout)
+	}
+}
@@ -0,0 +1,206 @@
+package replica
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/buildinfo"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+)
+
+// The endpoint of the primary's admin API listing its routes (see
+// 'git-bundle-web-server --admin-token-file').
+const adminRoutesPath string = "/-/admin/routes"
+
+// Route is a route of the primary bundle server, as listed by its admin API,
+// with the settings mirrored by its replicas.
+type Route struct {
+	Route    string   `json:"route"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Disabled bool     `json:"disabled,omitempty"`
+	Filter   string   `json:"filter,omitempty"`
+
+	// The update interval of the route on the primary (e.g. '1h0m0s'), so
+	// that replicas check for new bundles as often as they are created. Empty
+	// if the route uses the default interval.
+	UpdateInterval string `json:"updateInterval,omitempty"`
+}
+
+// NewRoute returns the route of the given repository as listed to replicas.
+func NewRoute(repo *core.Repository) Route {
+	route := Route{
+		Route:    repo.Route,
+		Aliases:  repo.Aliases,
+		Disabled: repo.Disabled,
+		Filter:   repo.Filter,
+	}
+	if repo.UpdateInterval > 0 {
+		route.UpdateInterval = repo.UpdateInterval.String()
+	}
+	return route
+}
+
+// Client downloads the routes, bundle lists, and bundles of a primary bundle
+// server over HTTP.
+type Client struct {
+	baseURL    *url.URL
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient creates a client of the primary configured by 'source', reading
+// its admin token (if any).
+func NewClient(source *core.ReplicaSource, httpClient *http.Client) (*Client, error) {
+	err := source.Validate()
+	if err != nil {
+		return nil, err
+	}
+	baseURL, _ := url.Parse(strings.TrimSuffix(source.URL, "/"))
+
+	token := ""
+	if source.TokenFile != "" {
+		tokenBytes, err := os.ReadFile(source.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read admin token of primary: %w", err)
+		}
+		token = strings.TrimSpace(string(tokenBytes))
+	}
+
+	return &Client{
+		baseURL:    baseURL,
+		token:      token,
+		httpClient: httpClient,
+	}, nil
+}
+
+// resolve returns the URL of the given path (relative to the primary's base
+// URL) or URI (as in the primary's bundle lists).
+func (c *Client) resolve(ref string) (*url.URL, error) {
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	if refURL.IsAbs() {
+		return refURL, nil
+	}
+
+	// Bundle URIs are absolute paths that include the path under which the
+	// primary is mounted (if any); other paths are relative to it.
+	resolved := *c.baseURL
+	if !strings.HasPrefix(ref, resolved.Path+"/") {
+		refURL.Path = path.Join(resolved.Path, refURL.Path)
+	}
+	resolved.Path = refURL.Path
+	resolved.RawQuery = refURL.RawQuery
+	return &resolved, nil
+}
+
+// get sends a GET request for the given path or URI of the primary, and
+// returns the response if its status is '200 OK'. The admin token is only
+// sent with requests to the admin API.
+func (c *Client) get(ctx context.Context, ref string, admin bool) (*http.Response, error) {
+	reqURL, err := c.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", buildinfo.UserAgent("git-bundle-server"))
+	if admin && c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s returned '%s'", reqURL.Redacted(), resp.Status)
+	}
+	return resp, nil
+}
+
+func (c *Client) getJson(ctx context.Context, ref string, admin bool, v any) error {
+	resp, err := c.get(ctx, ref, admin)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("failed to parse response to GET %s: %w", ref, err)
+	}
+	return nil
+}
+
+// ListRoutes lists the routes of the primary.
+func (c *Client) ListRoutes(ctx context.Context) ([]Route, error) {
+	routes := []Route{}
+	err := c.getJson(ctx, adminRoutesPath, true, &routes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes of primary: %w", err)
+	}
+	return routes, nil
+}
+
+// GetBundleList downloads the bundle list of the given route of the primary.
+func (c *Client) GetBundleList(ctx context.Context, route string) (*bundles.BundleListJson, error) {
+	list := &bundles.BundleListJson{}
+	err := c.getJson(ctx, path.Join("/", route, bundles.BundleListJsonFilename), false, list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bundle list of '%s' from primary: %w", route, err)
+	}
+	return list, nil
+}
+
+// DownloadBundle downloads the bundle at the given URI of the primary to
+// 'filename'. If 'checksum' is non-empty, the download must match it. The
+// file is only created once the download is complete.
+func (c *Client) DownloadBundle(ctx context.Context, uri string, filename string, checksum string) (int64, error) {
+	resp, err := c.get(ctx, uri, false)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmpFile, hash), resp.Body)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to download %s: %w", uri, err)
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); checksum != "" && actual != checksum {
+		return 0, fmt.Errorf("checksum of %s is %s, expected %s", uri, actual, checksum)
+	}
+
+	err = os.Rename(tmpFile.Name(), filename)
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,233 @@
+package replica
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+)
+
+// RouteSync describes the changes made by 'SyncRoutes'.
+type RouteSync struct {
+	// The routes registered because they were added to the primary.
+	Added []string
+
+	// The routes whose mirrored settings changed on the primary.
+	Changed []string
+
+	// The routes unregistered (and whose data was removed) because they no
+	// longer exist on the primary.
+	Removed []string
+
+	// The routes of the primary that can't be registered (e.g. because they
+	// are outside of the replica's route depth), mapped to the reason.
+	Failed map[string]string
+}
+
+// mirrorRoute applies the settings of the primary's route to the replica's
+// repository, returning whether any of them changed.
+func mirrorRoute(repo *core.Repository, route Route) (bool, error) {
+	interval := time.Duration(0)
+	if route.UpdateInterval != "" {
+		var err error
+		interval, err = time.ParseDuration(route.UpdateInterval)
+		if err != nil {
+			return false, fmt.Errorf("invalid update interval: %w", err)
+		}
+	}
+
+	changed := repo.Disabled != route.Disabled ||
+		repo.Filter != route.Filter ||
+		repo.UpdateInterval != interval ||
+		fmt.Sprint(repo.Aliases) != fmt.Sprint(route.Aliases)
+
+	repo.Aliases = route.Aliases
+	repo.Disabled = route.Disabled
+	repo.Filter = route.Filter
+	repo.UpdateInterval = interval
+	return changed, nil
+}
+
+// SyncRoutes registers the routes of the primary that the replica doesn't
+// have, updates the mirrored settings (see 'Route') of the others, and
+// unregisters the routes that no longer exist on the primary, removing their
+// data.
+func SyncRoutes(ctx context.Context, repoProvider core.RepositoryProvider, routes []Route) (*RouteSync, error) {
+	result := &RouteSync{
+		Added:   []string{},
+		Changed: []string{},
+		Removed: []string{},
+		Failed:  map[string]string{},
+	}
+
+	depth, err := repoProvider.GetRouteDepth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []core.Repository{}
+	err = repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+		primaryRoutes := map[string]bool{}
+		for _, route := range routes {
+			primaryRoutes[route.Route] = true
+
+			repo, contains := repos[route.Route]
+			if !contains {
+				err := core.ValidateRoute(route.Route, depth)
+				if err != nil {
+					result.Failed[route.Route] = err.Error()
+					continue
+				}
+				repo = core.Repository{Route: route.Route}
+			}
+
+			changed, err := mirrorRoute(&repo, route)
+			if err != nil {
+				result.Failed[route.Route] = err.Error()
+				continue
+			}
+			repos[route.Route] = repo
+
+			if !contains {
+				result.Added = append(result.Added, route.Route)
+			} else if changed {
+				result.Changed = append(result.Changed, route.Route)
+			}
+		}
+
+		for route, repo := range repos {
+			if !primaryRoutes[route] {
+				removed = append(removed, repo)
+				delete(repos, route)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repo := range removed {
+		err = os.RemoveAll(repo.WebDir)
+		if err != nil {
+			return nil, err
+		}
+		err = os.RemoveAll(repo.RepoDir)
+		if err != nil {
+			return nil, err
+		}
+		result.Removed = append(result.Removed, repo.Route)
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Changed)
+	sort.Strings(result.Removed)
+	return result, nil
+}
+
+// BundleSync describes the changes made by 'SyncBundles'.
+type BundleSync struct {
+	// The bundles downloaded from the primary, and their total size.
+	Downloaded      int
+	DownloadedBytes int64
+
+	// The bundle files deleted because they are no longer in the primary's
+	// bundle list.
+	Deleted []string
+}
+
+// SyncBundles downloads the bundle list of the repository's route from the
+// primary along with the bundles the replica doesn't have yet, and replaces
+// the route's bundle list with it. The bundles no longer in the list are then
+// deleted. The route must be locked for update.
+func SyncBundles(ctx context.Context,
+	client *Client,
+	bundleProvider bundles.BundleProvider,
+	repo *core.Repository,
+) (*BundleSync, error) {
+	result := &BundleSync{Deleted: []string{}}
+
+	primaryList, err := client.GetBundleList(ctx, repo.Route)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bundles never change once created, so a bundle in the current list
+	// doesn't need to be downloaded again.
+	current, err := bundleProvider.GetBundleList(ctx, repo)
+	if err != nil {
+		current = bundles.NewBundleList(primaryList.Heuristic)
+	}
+
+	// The internal bundle list is stored in the repository directory, which
+	// a replica doesn't otherwise use.
+	for _, dir := range []string{repo.WebDir, repo.RepoDir} {
+		err = os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	list := bundles.NewBundleList(primaryList.Heuristic)
+	list.Version = primaryList.Version
+	list.Mode = primaryList.Mode
+	list.Head = primaryList.Head
+	changed := len(current.Bundles) != len(primaryList.Bundles) || current.Heuristic != primaryList.Heuristic ||
+		current.Head != primaryList.Head
+	for _, primaryBundle := range primaryList.Bundles {
+		bundleURI, err := client.resolve(primaryBundle.URI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle URI '%s': %w", primaryBundle.URI, err)
+		}
+		name := path.Base(bundleURI.Path)
+		bundle := bundles.Bundle{
+			URI:           path.Join("/", repo.Route, name),
+			Filename:      filepath.Join(repo.WebDir, name),
+			CreationToken: primaryBundle.CreationToken,
+			Checksum:      primaryBundle.Checksum,
+			Filter:        primaryBundle.Filter,
+		}
+
+		existing, contains := current.Bundles[bundle.CreationToken]
+		_, statErr := os.Stat(bundle.Filename)
+		if !contains || existing.URI != bundle.URI || existing.Checksum != bundle.Checksum || statErr != nil {
+			size, err := client.DownloadBundle(ctx, primaryBundle.URI, bundle.Filename, bundle.Checksum)
+			if err != nil {
+				return nil, err
+			}
+			result.Downloaded++
+			result.DownloadedBytes += size
+			changed = true
+		}
+		list.Bundles[bundle.CreationToken] = bundle
+	}
+
+	if !changed {
+		return result, nil
+	}
+
+	err = bundleProvider.WriteBundleList(ctx, list, repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write bundle list: %w", err)
+	}
+
+	staleFiles, err := bundleProvider.FindStaleFiles(ctx, repo, list)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range staleFiles {
+		err = os.Remove(file.Filename)
+		if err != nil {
+			return nil, err
+		}
+		result.Deleted = append(result.Deleted, file.Filename)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,187 @@
+package replica_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/replica"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestPrimary starts a primary bundle server serving the given routes and
+// the bundles of 'org/repo'.
+func newTestPrimary(t *testing.T, routes []replica.Route, bundleContent map[string]string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/-/admin/routes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer my-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(routes)
+	})
+	mux.HandleFunc("/org/repo/bundle-list.json", func(w http.ResponseWriter, r *http.Request) {
+		list := bundles.BundleListJson{
+			Version:   1,
+			Mode:      "any",
+			Heuristic: bundles.HeuristicCreationToken,
+			Bundles:   []bundles.BundleJson{},
+		}
+		token := int64(1)
+		for name, content := range bundleContent {
+			checksum := sha256.Sum256([]byte(content))
+			list.Bundles = append(list.Bundles, bundles.BundleJson{
+				URI:           "/org/repo/" + name,
+				CreationToken: token,
+				Checksum:      hex.EncodeToString(checksum[:]),
+			})
+			token++
+		}
+		json.NewEncoder(w).Encode(list)
+	})
+	mux.HandleFunc("/org/repo/", func(w http.ResponseWriter, r *http.Request) {
+		content, contains := bundleContent[filepath.Base(r.URL.Path)]
+		if !contains {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(content))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestReplica(t *testing.T) core.RepositoryProvider {
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(&user.User{HomeDir: t.TempDir()}, nil)
+	return core.NewRepositoryProviderWithRoots(&MockTraceLogger{}, testUserProvider, common.NewFileSystem(), &MockGitHelper{},
+		core.StorageRoots{Root: t.TempDir()})
+}
+
+func TestReplica_SyncRoutes(t *testing.T) {
+	ctx := context.Background()
+	primary := newTestPrimary(t, []replica.Route{
+		{Route: "org/repo", Aliases: []string{"org/alias"}, UpdateInterval: "10m0s"},
+		{Route: "org/kept", Disabled: true},
+		{Route: "org/nested/repo"},
+	}, nil)
+
+	repoProvider := newTestReplica(t)
+	err := repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+		repos["org/kept"] = core.Repository{Route: "org/kept"}
+		repos["org/old"] = core.Repository{Route: "org/old"}
+		return nil
+	})
+	assert.Nil(t, err)
+	repos, err := repoProvider.GetRepositories(ctx)
+	assert.Nil(t, err)
+	oldWebDir := repos["org/old"].WebDir
+	assert.Nil(t, os.MkdirAll(oldWebDir, os.ModePerm))
+
+	client, err := replica.NewClient(&core.ReplicaSource{URL: primary.URL}, primary.Client())
+	assert.Nil(t, err)
+	_, err = client.ListRoutes(ctx)
+	assert.NotNil(t, err, "routes must not be listed without the admin token")
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenFile, []byte("my-token\n"), 0o600))
+	client, err = replica.NewClient(&core.ReplicaSource{URL: primary.URL, TokenFile: tokenFile}, primary.Client())
+	assert.Nil(t, err)
+	routes, err := client.ListRoutes(ctx)
+	assert.Nil(t, err)
+
+	result, err := replica.SyncRoutes(ctx, repoProvider, routes)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"org/repo"}, result.Added)
+	assert.Equal(t, []string{"org/kept"}, result.Changed)
+	assert.Equal(t, []string{"org/old"}, result.Removed)
+	assert.Contains(t, result.Failed, "org/nested/repo")
+
+	repos, err = repoProvider.GetRepositories(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, repos, 2)
+	assert.Equal(t, []string{"org/alias"}, repos["org/repo"].Aliases)
+	assert.Equal(t, "10m0s", repos["org/repo"].UpdateInterval.String())
+	assert.True(t, repos["org/kept"].Disabled)
+	assert.NoDirExists(t, oldWebDir)
+
+	// A second sync has nothing to do
+	result, err = replica.SyncRoutes(ctx, repoProvider, routes)
+	assert.Nil(t, err)
+	assert.Empty(t, result.Added)
+	assert.Empty(t, result.Changed)
+	assert.Empty(t, result.Removed)
+}
+
+func TestReplica_SyncBundles(t *testing.T) {
+	ctx := context.Background()
+	bundleContent := map[string]string{"bundle-1.bundle": "first bundle\n"}
+	primary := newTestPrimary(t, nil, bundleContent)
+
+	repoProvider := newTestReplica(t)
+	err := repoProvider.UpdateRoutes(ctx, func(repos map[string]core.Repository) error {
+		repos["org/repo"] = core.Repository{Route: "org/repo"}
+		return nil
+	})
+	assert.Nil(t, err)
+	repo, err := repoProvider.CreateRepository(ctx, "org/repo")
+	assert.Nil(t, err)
+
+	client, err := replica.NewClient(&core.ReplicaSource{URL: primary.URL}, primary.Client())
+	assert.Nil(t, err)
+	bundleProvider := bundles.NewBundleProvider(&MockTraceLogger{}, common.NewFileSystem(), nil, bundles.NewLocalStorage(), nil)
+
+	result, err := replica.SyncBundles(ctx, client, bundleProvider, repo)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Downloaded)
+	assert.FileExists(t, filepath.Join(repo.WebDir, "bundle-1.bundle"))
+
+	list, err := bundleProvider.GetBundleList(ctx, repo)
+	assert.Nil(t, err)
+	assert.Len(t, list.Bundles, 1)
+	assert.Equal(t, "/org/repo/bundle-1.bundle", list.Bundles[1].URI)
+
+	// Bundles that were already downloaded are kept
+	result, err = replica.SyncBundles(ctx, client, bundleProvider, repo)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, result.Downloaded)
+
+	// Bundles no longer on the primary are deleted
+	delete(bundleContent, "bundle-1.bundle")
+	bundleContent["bundle-2.bundle"] = "collapsed bundle\n"
+	result, err = replica.SyncBundles(ctx, client, bundleProvider, repo)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Downloaded)
+	assert.Equal(t, []string{filepath.Join(repo.WebDir, "bundle-1.bundle")}, result.Deleted)
+	assert.NoFileExists(t, filepath.Join(repo.WebDir, "bundle-1.bundle"))
+}
+
+func TestReplica_DownloadBundleChecksum(t *testing.T) {
+	ctx := context.Background()
+	primary := newTestPrimary(t, nil, map[string]string{"bundle-1.bundle": "first bundle\n"})
+
+	client, err := replica.NewClient(&core.ReplicaSource{URL: primary.URL}, primary.Client())
+	assert.Nil(t, err)
+
+	filename := filepath.Join(t.TempDir(), "bundle-1.bundle")
+	_, err = client.DownloadBundle(ctx, "/org/repo/bundle-1.bundle", filename, "0000")
+	assert.NotNil(t, err)
+	assert.NoFileExists(t, filename)
+
+	_, err = client.DownloadBundle(ctx, "/org/repo/missing.bundle", filename, "")
+	assert.NotNil(t, err)
+	assert.NoFileExists(t, filename)
+}
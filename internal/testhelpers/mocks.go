@@ -11,6 +11,8 @@ import (
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -102,6 +104,14 @@ func (l *MockTraceLogger) ChildProcess(ctx context.Context, cmd *exec.Cmd) (func
 	return mockWithDefault(fnArgs, 0, func(error) {}), mockWithDefault(fnArgs, 1, func() {})
 }
 
+func (l *MockTraceLogger) Goroutine(ctx context.Context, name string) (context.Context, func()) {
+	fnArgs := mock.Arguments{}
+	if methodIsMocked(&l.Mock) {
+		fnArgs = l.Called(ctx, name)
+	}
+	return mockWithDefault(fnArgs, 0, ctx), mockWithDefault(fnArgs, 1, func() {})
+}
+
 func (l *MockTraceLogger) LogCommand(ctx context.Context, commandName string) context.Context {
 	fnArgs := mock.Arguments{}
 	if methodIsMocked(&l.Mock) {
@@ -110,6 +120,32 @@ func (l *MockTraceLogger) LogCommand(ctx context.Context, commandName string) co
 	return mockWithDefault(fnArgs, 0, ctx)
 }
 
+func (l *MockTraceLogger) Data(ctx context.Context, category string, key string, value any) {
+	if methodIsMocked(&l.Mock) {
+		l.Called(ctx, category, key, value)
+	}
+}
+
+func (l *MockTraceLogger) DataJSON(ctx context.Context, category string, key string, value any) {
+	if methodIsMocked(&l.Mock) {
+		l.Called(ctx, category, key, value)
+	}
+}
+
+func (l *MockTraceLogger) StartTimer(ctx context.Context, category string, name string) func() {
+	fnArgs := mock.Arguments{}
+	if methodIsMocked(&l.Mock) {
+		fnArgs = l.Called(ctx, category, name)
+	}
+	return mockWithDefault(fnArgs, 0, func() {})
+}
+
+func (l *MockTraceLogger) AddToCounter(ctx context.Context, category string, name string, value int64) {
+	if methodIsMocked(&l.Mock) {
+		l.Called(ctx, category, name, value)
+	}
+}
+
 func (l *MockTraceLogger) Error(ctx context.Context, err error) error {
 	// Input validation
 	if err == nil {
@@ -177,6 +213,12 @@ func (m *MockCommandExecutor) Run(ctx context.Context, command string, args []st
 	return fnArgs.Int(0), fnArgs.Error(1)
 }
 
+func (m *MockCommandExecutor) RunCaptured(ctx context.Context, command string, args []string, settings ...cmd.Setting) (*cmd.CapturedOutput, error) {
+	fnArgs := m.Called(ctx, command, args, settings)
+	output, _ := fnArgs.Get(0).(*cmd.CapturedOutput)
+	return output, fnArgs.Error(1)
+}
+
 type MockLockFile struct {
 	mock.Mock
 }
@@ -191,6 +233,15 @@ func (m *MockLockFile) Rollback() error {
 	return fnArgs.Error(0)
 }
 
+type MockFileLock struct {
+	mock.Mock
+}
+
+func (m *MockFileLock) Unlock() error {
+	fnArgs := m.Called()
+	return fnArgs.Error(0)
+}
+
 type MockFileSystem struct {
 	mock.Mock
 }
@@ -205,6 +256,12 @@ func (m *MockFileSystem) FileExists(filename string) (bool, error) {
 	return fnArgs.Bool(0), fnArgs.Error(1)
 }
 
+func (m *MockFileSystem) Stat(filename string) (fs.FileInfo, error) {
+	fnArgs := m.Called(filename)
+	info, _ := fnArgs.Get(0).(fs.FileInfo)
+	return info, fnArgs.Error(1)
+}
+
 func (m *MockFileSystem) WriteFile(filename string, content []byte) error {
 	fnArgs := m.Called(filename, content)
 	return fnArgs.Error(0)
@@ -215,6 +272,23 @@ func (m *MockFileSystem) WriteLockFileFunc(filename string, writeFunc func(io.Wr
 	return fnArgs.Get(0).(common.LockFile), fnArgs.Error(1)
 }
 
+func (m *MockFileSystem) SyncFile(filename string) error {
+	fnArgs := m.Called(filename)
+	return fnArgs.Error(0)
+}
+
+func (m *MockFileSystem) AcquireFileLock(filename string) (common.FileLock, error) {
+	fnArgs := m.Called(filename)
+	lock, _ := fnArgs.Get(0).(common.FileLock)
+	return lock, fnArgs.Error(1)
+}
+
+func (m *MockFileSystem) TryAcquireFileLock(filename string) (common.FileLock, bool, error) {
+	fnArgs := m.Called(filename)
+	lock, _ := fnArgs.Get(0).(common.FileLock)
+	return lock, fnArgs.Bool(1), fnArgs.Error(2)
+}
+
 func (m *MockFileSystem) DeleteFile(filename string) (bool, error) {
 	fnArgs := m.Called(filename)
 	return fnArgs.Bool(0), fnArgs.Error(1)
@@ -230,31 +304,86 @@ func (m *MockFileSystem) ReadDirRecursive(path string, depth int, strictDepth bo
 	return fnArgs.Get(0).([]common.ReadDirEntry), fnArgs.Error(1)
 }
 
+func (m *MockFileSystem) DirSize(path string) (int64, error) {
+	fnArgs := m.Called(path)
+	return fnArgs.Get(0).(int64), fnArgs.Error(1)
+}
+
+func (m *MockFileSystem) AvailableSpace(path string) (int64, error) {
+	fnArgs := m.Called(path)
+	return fnArgs.Get(0).(int64), fnArgs.Error(1)
+}
+
 type MockGitHelper struct {
 	mock.Mock
 }
 
-func (m *MockGitHelper) CreateBundle(ctx context.Context, repoDir string, filename string) (bool, error) {
-	fnArgs := m.Called(ctx, repoDir, filename)
+func (m *MockGitHelper) CreateBundle(ctx context.Context, repoDir string, filename string, refPatterns []string, filter string, depth int) (bool, error) {
+	fnArgs := m.Called(ctx, repoDir, filename, refPatterns, filter, depth)
 	return fnArgs.Bool(0), fnArgs.Error(1)
 }
 
-func (m *MockGitHelper) CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string) error {
-	fnArgs := m.Called(ctx, repoDir, filename, refs)
+func (m *MockGitHelper) CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string, prereqs []string, filter string) error {
+	fnArgs := m.Called(ctx, repoDir, filename, refs, prereqs, filter)
 	return fnArgs.Error(0)
 }
 
-func (m *MockGitHelper) CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string) (bool, error) {
-	fnArgs := m.Called(ctx, repoDir, filename, prereqs)
+func (m *MockGitHelper) CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string, refPatterns []string, filter string) (bool, error) {
+	fnArgs := m.Called(ctx, repoDir, filename, prereqs, refPatterns, filter)
 	return fnArgs.Bool(0), fnArgs.Error(1)
 }
 
-func (m *MockGitHelper) CloneBareRepo(ctx context.Context, url string, destination string) error {
-	fnArgs := m.Called(ctx, url, destination)
+func (m *MockGitHelper) VerifyBundle(ctx context.Context, repoDir string, filename string) error {
+	fnArgs := m.Called(ctx, repoDir, filename)
+	return fnArgs.Error(0)
+}
+
+func (m *MockGitHelper) CloneBareRepo(ctx context.Context, url string, destination string, remote git.RemoteConfig) error {
+	fnArgs := m.Called(ctx, url, destination, remote)
+	return fnArgs.Error(0)
+}
+
+func (m *MockGitHelper) UpdateBareRepo(ctx context.Context, repoDir string, remote git.RemoteConfig, prune bool) error {
+	fnArgs := m.Called(ctx, repoDir, remote, prune)
+	return fnArgs.Error(0)
+}
+
+func (m *MockGitHelper) UpdateHead(ctx context.Context, repoDir string, remote git.RemoteConfig) (string, error) {
+	fnArgs := m.Called(ctx, repoDir, remote)
+	return fnArgs.String(0), fnArgs.Error(1)
+}
+
+func (m *MockGitHelper) GetHead(ctx context.Context, repoDir string) (string, error) {
+	fnArgs := m.Called(ctx, repoDir)
+	return fnArgs.String(0), fnArgs.Error(1)
+}
+
+func (m *MockGitHelper) SetFetchRefPatterns(ctx context.Context, repoDir string, patterns []string) error {
+	fnArgs := m.Called(ctx, repoDir, patterns)
 	return fnArgs.Error(0)
 }
 
-func (m *MockGitHelper) UpdateBareRepo(ctx context.Context, repoDir string) error {
+func (m *MockGitHelper) GetBranches(ctx context.Context, repoDir string) (map[string]string, error) {
+	fnArgs := m.Called(ctx, repoDir)
+	return fnArgs.Get(0).(map[string]string), fnArgs.Error(1)
+}
+
+func (m *MockGitHelper) GetRefs(ctx context.Context, repoDir string, patterns []string) ([]string, error) {
+	fnArgs := m.Called(ctx, repoDir, patterns)
+	return fnArgs.Get(0).([]string), fnArgs.Error(1)
+}
+
+func (m *MockGitHelper) GetMissingObjects(ctx context.Context, repoDir string, oids []string) (map[string]bool, error) {
+	fnArgs := m.Called(ctx, repoDir, oids)
+	return fnArgs.Get(0).(map[string]bool), fnArgs.Error(1)
+}
+
+func (m *MockGitHelper) IsAncestor(ctx context.Context, repoDir string, ancestor string, descendant string) (bool, error) {
+	fnArgs := m.Called(ctx, repoDir, ancestor, descendant)
+	return fnArgs.Bool(0), fnArgs.Error(1)
+}
+
+func (m *MockGitHelper) RunMaintenance(ctx context.Context, repoDir string) error {
 	fnArgs := m.Called(ctx, repoDir)
 	return fnArgs.Error(0)
 }
@@ -263,3 +392,50 @@ func (m *MockGitHelper) GetRemoteUrl(ctx context.Context, repoDir string) (strin
 	fnArgs := m.Called(ctx, repoDir)
 	return fnArgs.String(0), fnArgs.Error(1)
 }
+
+func (m *MockGitHelper) GetSubmodules(ctx context.Context, repoDir string) ([]git.Submodule, error) {
+	fnArgs := m.Called(ctx, repoDir)
+	return fnArgs.Get(0).([]git.Submodule), fnArgs.Error(1)
+}
+
+type MockBundleStorage struct {
+	mock.Mock
+}
+
+func (m *MockBundleStorage) Publish(ctx context.Context, repo *core.Repository, name string, overwrite bool) error {
+	fnArgs := m.Called(ctx, repo, name, overwrite)
+	return fnArgs.Error(0)
+}
+
+func (m *MockBundleStorage) URL(ctx context.Context, repo *core.Repository, name string) (string, error) {
+	fnArgs := m.Called(ctx, repo, name)
+	return fnArgs.String(0), fnArgs.Error(1)
+}
+
+func (m *MockBundleStorage) Delete(ctx context.Context, repo *core.Repository, name string) error {
+	fnArgs := m.Called(ctx, repo, name)
+	return fnArgs.Error(0)
+}
+
+// MockRepositoryProvider mocks the methods of 'core.RepositoryProvider'
+// needed by tests so far; calling any other method panics.
+type MockRepositoryProvider struct {
+	core.RepositoryProvider
+	mock.Mock
+}
+
+func (m *MockRepositoryProvider) GetRepositories(ctx context.Context) (map[string]core.Repository, error) {
+	fnArgs := m.Called(ctx)
+	repos, _ := fnArgs.Get(0).(map[string]core.Repository)
+	return repos, fnArgs.Error(1)
+}
+
+type MockSigner struct {
+	mock.Mock
+}
+
+func (m *MockSigner) Sign(ctx context.Context, content io.Reader) ([]byte, error) {
+	fnArgs := m.Called(ctx, content)
+	signature, _ := fnArgs.Get(0).([]byte)
+	return signature, fnArgs.Error(1)
+}
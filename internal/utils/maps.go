@@ -25,3 +25,12 @@ func SegmentKeys[T comparable, S any, R any](mapA map[T]S, mapB map[T]R) (inters
 
 	return
 }
+
+// Keys returns the keys of a map (with *no guaranteed order*).
+func Keys[T comparable, S any](m map[T]S) []T {
+	keys := make([]T, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
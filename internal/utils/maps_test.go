@@ -118,3 +118,8 @@ func TestSegmentKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestKeys(t *testing.T) {
+	assert.Empty(t, utils.Keys(map[string]int{}))
+	assert.ElementsMatch(t, []string{"A", "B"}, utils.Keys(map[string]int{"A": 1, "B": 2}))
+}
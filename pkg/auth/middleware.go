@@ -13,7 +13,10 @@ import (
 type AuthMiddleware interface {
 	// Authorize interprets the contents of a bundle server request of a valid
 	// format (i.e., /<owner>/<repo>[/<bundle>]) and returns an AuthResult
-	// indicating whether the request should be allowed or denied. If the
+	// indicating whether the request should be allowed or denied. For routes
+	// with a configured route depth other than two, 'owner' is every element
+	// of the route but the last (e.g. "org/team", or "" for a top-level
+	// route) and 'repo' is the last. If the
 	// AuthResult is invalid (not created with Allow() or Deny()), the server
 	// will respond with a 500 status.
 	Authorize(r *http.Request, owner string, repo string) AuthResult
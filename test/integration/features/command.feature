@@ -26,6 +26,18 @@ Feature: Bundle server command tests
     When I run the bundle server CLI command 'update integration/bundle'
     Then the bundles are fetched and the bundle list is updated
 
+  Scenario: The update command with '--base' replaces the bundle list with a single base bundle
+    Given no bundle server repository exists at route 'integration/base'
+    Given a new remote repository with main branch 'main'
+    Given the remote is cloned
+    Given 5 commits are pushed to the remote branch 'main'
+    Given a bundle server repository is created at route 'integration/base' for the remote
+    Given 2 commits are pushed to the remote branch 'main'
+    When I run the bundle server CLI command 'update integration/base'
+    When I run the bundle server CLI command 'update --base integration/base'
+    Then the bundle list contains a single base bundle
+    Then the previous bundles are left for pruning
+
   Scenario: The stop command updates the routes file
     Given no bundle server repository exists at route 'integration/stop'
     Given a new remote repository with main branch 'main'
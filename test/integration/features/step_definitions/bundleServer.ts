@@ -75,6 +75,31 @@ Then('the bundles are fetched and the bundle list is updated', async function (t
   }
 })
 
+Then('the bundle list contains a single base bundle', async function (this: IntegrationBundleServerWorld) {
+  if (!this.commandResult || !this.bundleServer.route) {
+    throw new Error("Bundle server not updated")
+  }
+  utils.assertStatus(0, this.commandResult)
+
+  const bundleList = fs.readFileSync(`${utils.wwwPath()}/${this.bundleServer.route}/bundle-list`).toString()
+  const uris = bundleList.split('\n')
+    .map(line => line.trim())
+    .filter(line => line.startsWith('uri = '))
+  assert.strictEqual(uris.length, 1, `Unexpected bundle list:\n${bundleList}`)
+  assert.match(uris[0], /^uri = (.*\/)?base-\d+\.bundle$/)
+})
+
+Then('the previous bundles are left for pruning', async function (this: IntegrationBundleServerWorld) {
+  if (!this.bundleServer.initialBundleCount) {
+    throw new Error("Bundle server not initialized")
+  }
+
+  // The initial bundles and the incremental bundle of the first update are
+  // still on disk alongside the new base bundle, until they are pruned
+  const currentBundleCount = this.bundleServer.getBundleCount()
+  assert.strictEqual(currentBundleCount, this.bundleServer.initialBundleCount + 2)
+})
+
 Then('the route is removed from the routes file', async function (this: IntegrationBundleServerWorld) {
   if (this.bundleServer.route) {
     var routesPath = utils.routesPath()
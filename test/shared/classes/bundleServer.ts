@@ -121,7 +121,7 @@ export class BundleServer {
 
     // Delete the added route
     if (this.route) {
-      child_process.spawnSync(this.bundleServerCmd, ["delete", this.route])
+      child_process.spawnSync(this.bundleServerCmd, ["delete", "--force", this.route])
     }
   }
 }
@@ -40,5 +40,5 @@ export function repoRoot(pathParam: string): string {
 }
 
 export function routesPath(): string {
-  return path.resolve(bundleRoot, "routes")
+  return path.resolve(bundleRoot, "routes.json")
 }